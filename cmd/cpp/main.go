@@ -1,11 +1,26 @@
 package main
 
 import (
+	"bufio"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
-
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"text/template"
+	"time"
+
+	"github.com/prabhakaran-jm/cilium-policypilot/internal/apply"
+	"github.com/prabhakaran-jm/cilium-policypilot/internal/config"
 	"github.com/prabhakaran-jm/cilium-policypilot/internal/explain"
+	"github.com/prabhakaran-jm/cilium-policypilot/internal/graph"
 	"github.com/prabhakaran-jm/cilium-policypilot/internal/hubble"
+	"github.com/prabhakaran-jm/cilium-policypilot/internal/sim"
 	"github.com/prabhakaran-jm/cilium-policypilot/internal/synth"
 	"github.com/prabhakaran-jm/cilium-policypilot/internal/validate"
 	"github.com/prabhakaran-jm/cilium-policypilot/internal/verify"
@@ -19,7 +34,30 @@ func main() {
 		Long:  "Learn from Hubble flows, propose minimal Cilium policies, verify them safely, and explain results.",
 	}
 
-	root.AddCommand(cmdLearn(), cmdPropose(), cmdVerify(), cmdExplain())
+	root.AddCommand(cmdLearn(), cmdPropose(), cmdVerify(), cmdExplain(), cmdSimulate(), cmdConvert(), cmdDiff(), cmdApply())
+
+	// Flags not given on the command line come from the environment, then
+	// from the config file
+	var configFile string
+	root.PersistentFlags().StringVar(&configFile, "config", "", "Config file with flag defaults per command (default: "+config.DefaultFile+" in the working directory, if present)")
+	root.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		path, err := config.Find(configFile)
+		if err != nil {
+			return err
+		}
+		file, err := config.Load(path)
+		if err != nil {
+			return err
+		}
+		var commands []string
+		for _, command := range root.Commands() {
+			commands = append(commands, command.Name())
+		}
+		if err := file.Check(commands); err != nil {
+			return err
+		}
+		return config.Apply(cmd.Name(), cmd.Flags(), file, os.LookupEnv, "help", "config")
+	}
 
 	if err := root.Execute(); err != nil {
 		fmt.Fprintln(os.Stderr, err)
@@ -28,15 +66,24 @@ func main() {
 }
 
 func cmdLearn() *cobra.Command {
-	var inputFile string
+	var inputFiles []string
 	var outputFile string
 	var captureDuration string
+	var captureOpts hubble.CaptureOptions
 	var hubbleEndpoint string
+	var apiOpts hubble.APIOptions
+	var dedupe bool
+	var quiet bool
+	var list bool
+	var limit int
+	var watch bool
+	var watchInterval time.Duration
+	var proposeOutput string
 
 	cmd := &cobra.Command{
 		Use:   "learn",
 		Short: "Capture or read Hubble flows",
-		Long:  "Read flows from a JSON file or capture them from Hubble CLI.\nIf no input file is provided, attempts to read from out/flows.json.",
+		Long:  "Read flows from a JSON file, directly from the Hubble API, or by running hubble observe\nwith --duration, --namespace, --pod or --node.\nWith --watch, keep capturing every --interval and save the growing set of distinct flows\nuntil interrupted.\nIf none of these is provided, attempts to read from out/flows.json.",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			// Set default output file if not provided
 			if outputFile == "" {
@@ -56,16 +103,120 @@ func cmdLearn() *cobra.Command {
 			var collection *hubble.FlowCollection
 			var err error
 
-			// If input file is provided, validate and read from it
-			if inputFile != "" {
-				if err := validate.FilePath(inputFile); err != nil {
-					return fmt.Errorf("invalid input file: %w", err)
+			if hubbleEndpoint != "" && len(inputFiles) > 0 {
+				return fmt.Errorf("--input and --hubble-endpoint are mutually exclusive")
+			}
+			if hubbleEndpoint != "" && dedupe {
+				return fmt.Errorf("--dedupe is only supported when reading from a file")
+			}
+			captureOpts.Since = captureDuration
+			capture := captureOpts.Since != "" || len(captureOpts.Namespaces) > 0 || len(captureOpts.Pods) > 0 || len(captureOpts.Nodes) > 0
+			if capture && (len(inputFiles) > 0 || hubbleEndpoint != "") {
+				return fmt.Errorf("--duration, --namespace, --pod and --node capture with the hubble CLI and cannot be combined with --input or --hubble-endpoint")
+			}
+			if watch {
+				if len(inputFiles) > 0 || hubbleEndpoint != "" {
+					return fmt.Errorf("--watch captures with the hubble CLI and cannot be combined with --input or --hubble-endpoint")
+				}
+				if captureDuration != "" {
+					return fmt.Errorf("--duration cannot be combined with --watch; each capture covers the last --interval")
+				}
+				if watchInterval <= 0 {
+					return fmt.Errorf("invalid --interval %s: must be positive", watchInterval)
+				}
+			}
+			if proposeOutput != "" {
+				if !watch {
+					return fmt.Errorf("--propose-output requires --watch; run 'cpp propose' on a saved capture instead")
+				}
+				if err := validate.OutputPath(proposeOutput); err != nil {
+					return fmt.Errorf("invalid --propose-output path: %w", err)
+				}
+				if err := validate.FileExtension(proposeOutput, ".yaml"); err != nil {
+					if err2 := validate.FileExtension(proposeOutput, ".yml"); err2 != nil {
+						return fmt.Errorf("--propose-output must be YAML (.yaml or .yml): %w", err)
+					}
+				}
+			}
+			if captureOpts.Timeout < 0 {
+				return fmt.Errorf("invalid --capture-timeout %s: must be 0 (no timeout) or positive", captureOpts.Timeout)
+			}
+			if captureOpts.Attempts < 1 {
+				return fmt.Errorf("invalid --capture-attempts %d: must be at least 1", captureOpts.Attempts)
+			}
+			if limit < 0 {
+				return fmt.Errorf("invalid --limit %d: must be 0 (no limit) or positive", limit)
+			}
+			captureOpts.RetryBackoff = hubble.DefaultCaptureRetryBackoff
+			captureOpts.OnRetry = func(attempt int, err error, wait time.Duration) {
+				fmt.Fprintf(os.Stderr, "Warning: capture attempt %d of %d failed: %v; retrying in %s\n", attempt, captureOpts.Attempts, err, wait)
+			}
+			if apiOpts.TLSCAFile != "" {
+				if err := validate.FilePath(apiOpts.TLSCAFile); err != nil {
+					return fmt.Errorf("invalid TLS CA file: %w", err)
+				}
+			}
+
+			// If a Hubble API endpoint is provided, read flows from it
+			if hubbleEndpoint != "" {
+				if apiOpts.Follow > 0 {
+					fmt.Printf("Reading flows from Hubble API at %s (following for %s)...\n", hubbleEndpoint, apiOpts.Follow)
+				} else {
+					fmt.Printf("Reading flows from Hubble API at %s...\n", hubbleEndpoint)
 				}
-				if err := validate.FileExtension(inputFile, ".json"); err != nil {
-					return fmt.Errorf("input file must be JSON: %w", err)
+				reader := hubble.NewHubbleReader()
+				collection, err = reader.ReadFlowsFromHubbleAPI(cmd.Context(), hubbleEndpoint, apiOpts)
+				if err != nil {
+					return fmt.Errorf("failed to read flows from Hubble API: %w", err)
+				}
+			} else if watch {
+				// Capture repeatedly until interrupted, saving whenever the
+				// set of distinct flows grows; the final save below flushes it
+				ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+				defer stop()
+				fmt.Printf("Watching flows with hubble observe every %s; press Ctrl+C to stop...\n", watchInterval)
+				collection, err = hubble.NewHubbleReader().WatchFlows(ctx, hubble.WatchOptions{
+					Capture:  captureOpts,
+					Interval: watchInterval,
+					OnCapture: func(collection *hubble.FlowCollection, added int) error {
+						fmt.Printf("[%s] Captured %d new distinct flow(s), %d in total\n", time.Now().Format(time.TimeOnly), added, len(collection.Flows))
+						if added == 0 {
+							return nil
+						}
+						if err := hubble.WriteFlowsToFile(collection, outputFile); err != nil {
+							return fmt.Errorf("failed to write flows: %w", err)
+						}
+						if proposeOutput != "" {
+							return reproposePolicies(collection, proposeOutput)
+						}
+						return nil
+					},
+					OnError: func(err error) {
+						fmt.Fprintf(os.Stderr, "Warning: capture failed: %v; retrying in %s\n", err, watchInterval)
+					},
+				})
+				if err != nil {
+					return fmt.Errorf("failed to watch flows: %w", err)
+				}
+				fmt.Println("Stopped watching")
+			} else if capture {
+				// Capture with hubble observe, then read the capture back
+				fmt.Println("Capturing flows with hubble observe...")
+				if err := hubble.NewHubbleReader().CaptureFlows(cmd.Context(), captureOpts, outputFile); err != nil {
+					return fmt.Errorf("failed to capture flows: %w", err)
+				}
+				collection, err = readFlowsFile(outputFile, dedupe)
+				if err != nil {
+					return fmt.Errorf("failed to read captured flows: %w", err)
+				}
+			} else if len(inputFiles) > 0 {
+				// If input files are provided, validate and read from them
+				paths, err := expandFlowsInputs(inputFiles)
+				if err != nil {
+					return fmt.Errorf("invalid input file: %w", err)
 				}
-				fmt.Printf("Reading flows from %s...\n", inputFile)
-				collection, err = hubble.ReadFlowsFromFile(inputFile)
+				fmt.Printf("Reading flows from %s...\n", flowsSources(paths))
+				collection, err = readFlowsFiles(paths, dedupe)
 				if err != nil {
 					return fmt.Errorf("failed to read flows from file: %w", err)
 				}
@@ -74,7 +225,7 @@ func cmdLearn() *cobra.Command {
 				defaultFile := "out/flows.json"
 				if _, err := os.Stat(defaultFile); err == nil {
 					fmt.Printf("Reading flows from %s...\n", defaultFile)
-					collection, err = hubble.ReadFlowsFromFile(defaultFile)
+					collection, err = readFlowsFile(defaultFile, dedupe)
 					if err != nil {
 						return fmt.Errorf("failed to read flows from file: %w", err)
 					}
@@ -84,15 +235,15 @@ func cmdLearn() *cobra.Command {
 					fmt.Println("Tip: Use 'hubble observe -o json > out/flows.json' to capture flows, or")
 					fmt.Println("     provide an input file with --input flag.")
 					collection = &hubble.FlowCollection{
-						Schema: "cpp.flows.v1",
+						Schema: hubble.CurrentSchema,
 						Flows:  []*hubble.Flow{},
 					}
 				}
 			}
 
-			// Validate collection schema
-			if collection.Schema == "" {
-				return fmt.Errorf("invalid flows file: missing schema field")
+			// Validate collection schema, migrating older flow files
+			if err := hubble.ValidateSchema(collection); err != nil {
+				return fmt.Errorf("invalid flows file: %w", err)
 			}
 
 			// Parse flows to validate and get statistics
@@ -106,6 +257,12 @@ func cmdLearn() *cobra.Command {
 			if len(collection.Flows) > 0 && len(parsedFlows) == 0 {
 				fmt.Fprintf(os.Stderr, "Warning: No flows could be parsed. Check that flows have required fields (source, destination, l4).\n")
 			}
+			if !quiet && len(parsedFlows) > 0 {
+				printFlowStats(hubble.ComputeStats(parsedFlows))
+			}
+			if list && len(parsedFlows) > 0 {
+				printFlowList(hubble.ListFlows(parsedFlows), limit)
+			}
 
 			// Write to output file
 			if err := hubble.WriteFlowsToFile(collection, outputFile); err != nil {
@@ -117,18 +274,74 @@ func cmdLearn() *cobra.Command {
 		},
 	}
 
-	cmd.Flags().StringVarP(&inputFile, "input", "i", "", "Input flows JSON file (default: out/flows.json)")
+	cmd.Flags().StringArrayVarP(&inputFiles, "input", "i", nil, "Input flows JSON file or glob, or - for stdin; repeat to merge several captures (default: out/flows.json)")
 	cmd.Flags().StringVarP(&outputFile, "output", "o", "", "Output flows JSON file (default: out/flows.json)")
-	cmd.Flags().StringVarP(&captureDuration, "duration", "d", "", "Duration to capture flows (e.g., '--since 5m' or '--last 100')")
-	cmd.Flags().StringVar(&hubbleEndpoint, "hubble-endpoint", "", "Hubble API endpoint (for future API integration)")
+	cmd.Flags().StringVarP(&captureDuration, "duration", "d", "", "Capture flows with hubble observe from this long ago, e.g. 5m (or an RFC3339 timestamp)")
+	cmd.Flags().StringSliceVarP(&captureOpts.Namespaces, "namespace", "n", nil, "Capture with hubble observe only flows from or to these namespaces")
+	cmd.Flags().StringSliceVar(&captureOpts.Pods, "pod", nil, "Capture with hubble observe only flows from or to these pods, as [namespace/]name")
+	cmd.Flags().StringSliceVar(&captureOpts.Nodes, "node", nil, "Capture with hubble observe only flows observed on these nodes")
+	cmd.Flags().DurationVar(&captureOpts.Timeout, "capture-timeout", hubble.DefaultCaptureTimeout, "Stop a hubble observe run that takes longer than this (0 = no timeout)")
+	cmd.Flags().IntVar(&captureOpts.Attempts, "capture-attempts", hubble.DefaultCaptureAttempts, "Run hubble observe up to this many times if it fails or times out, backing off between attempts")
+	cmd.Flags().BoolVar(&watch, "watch", false, "Keep capturing with hubble observe every --interval, saving the accumulated distinct flows whenever they change, until interrupted")
+	cmd.Flags().DurationVar(&watchInterval, "interval", time.Minute, "Time between captures with --watch; each capture covers this long")
+	cmd.Flags().StringVar(&proposeOutput, "propose-output", "", "With --watch, also re-propose policies with default settings and write them to this YAML file whenever the flows change")
+	cmd.Flags().BoolVarP(&quiet, "quiet", "q", false, "Do not print the capture summary (verdicts, endpoints, namespaces, top talkers)")
+	cmd.Flags().BoolVar(&list, "list", false, "Print a table of the distinct flows (source, destination, protocol/port, verdict) with their counts, most frequent first")
+	cmd.Flags().IntVar(&limit, "limit", 50, "Maximum number of rows printed by --list (0 = no limit)")
+	cmd.Flags().BoolVar(&dedupe, "dedupe", false, "Stream the input files and keep only one copy of each distinct flow across them (bounded memory for large captures)")
+	cmd.Flags().StringVar(&hubbleEndpoint, "hubble-endpoint", "", "Hubble API endpoint to read flows from (e.g., localhost:4245)")
+	cmd.Flags().Uint64Var(&apiOpts.Last, "hubble-last", hubble.DefaultAPILast, "Number of recent flows to read from the Hubble API")
+	cmd.Flags().DurationVar(&apiOpts.Follow, "hubble-follow", 0, "Keep streaming new flows from the Hubble API for this long (e.g., 30s)")
+	cmd.Flags().BoolVar(&apiOpts.TLS, "hubble-tls", false, "Connect to the Hubble API using TLS (default: plaintext)")
+	cmd.Flags().StringVar(&apiOpts.TLSCAFile, "hubble-tls-ca", "", "CA certificate file to verify the Hubble API server")
+	cmd.Flags().StringVar(&apiOpts.TLSServerName, "hubble-tls-server-name", "", "Server name to verify the Hubble API certificate against")
 
 	return cmd
 }
 
+// stdoutPath is the --output value that writes to stdout instead of a file
+const stdoutPath = "-"
+
 func cmdPropose() *cobra.Command {
-	var inputFile string
+	var inputFiles []string
 	var outputFile string
 	var namespaceFilter string
+	var includeNamespaces []string
+	var excludeNamespaces []string
+	var portsFilter []int
+	var protocolsFilter []string
+	var cidrAggregation string
+	var cidrAggregate bool
+	var cidrMaxPrefix int
+	var outputFormat string
+	var outputEncoding string
+	var clusterWide bool
+	var policyNamespace string
+	var nameTemplate string
+	var l7 bool
+	var maxSelectorLabels int
+	var labelKeys []string
+	var ignoreLabelPrefixes []string
+	var collapsePorts bool
+	var minFlows int
+	var maxRulesPerPolicy int
+	var maxPortsPerRule int
+	var skipIntraNamespace bool
+	var crossNamespaceWildcard bool
+	var defaultDeny bool
+	var allowSystemNamespaces bool
+	var split bool
+	var outputDir string
+	var ownerReferences []string
+	var groupBy string
+	var externalIngress string
+	var noProvenance bool
+	var comments bool
+	var interactive bool
+	var since string
+	var until string
+	var requireTimestamp bool
+	var detectReplies bool
 
 	cmd := &cobra.Command{
 		Use:   "propose",
@@ -136,107 +349,424 @@ func cmdPropose() *cobra.Command {
 		Long:  "Generate CiliumNetworkPolicies from parsed flows.\nReads flows from out/flows.json (or specified input file) and generates policies.",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			// Set default input file if not provided
-			if inputFile == "" {
-				inputFile = "out/flows.json"
+			if len(inputFiles) == 0 {
+				inputFiles = []string{"out/flows.json"}
+			}
+
+			// Validate output encoding
+			if outputEncoding != "yaml" && outputEncoding != "json" {
+				return fmt.Errorf("invalid output format '%s': must be 'yaml' or 'json'", outputEncoding)
 			}
 
 			// Set default output file if not provided
 			if outputFile == "" {
-				outputFile = "out/policy.yaml"
+				outputFile = "out/policy." + outputEncoding
+			}
+			// With -o -, policies go to stdout and progress to stderr, so
+			// the output can be piped into kubectl apply -f -
+			toStdout := outputFile == stdoutPath && !split
+			progress := os.Stdout
+			if toStdout {
+				progress = os.Stderr
 			}
 
-			// Validate input file
-			if err := validate.FilePath(inputFile); err != nil {
+			// Validate input files
+			inputPaths, err := expandFlowsInputs(inputFiles)
+			if err != nil {
 				return fmt.Errorf("invalid input file: %w", err)
 			}
-			if err := validate.FileExtension(inputFile, ".json"); err != nil {
-				return fmt.Errorf("input file must be JSON: %w", err)
-			}
 
-			// Validate output path
-			if err := validate.OutputPath(outputFile); err != nil {
-				return fmt.Errorf("invalid output path: %w", err)
-			}
-			if err := validate.FileExtension(outputFile, ".yaml"); err != nil {
-				// Also accept .yml extension
-				if err2 := validate.FileExtension(outputFile, ".yml"); err2 != nil {
-					return fmt.Errorf("output file must be YAML (.yaml or .yml): %w", err)
+			// Validate output path; --split writes to --output-dir instead
+			if split {
+				if outputDir == "" {
+					return fmt.Errorf("--output-dir cannot be empty")
+				}
+				if cmd.Flags().Changed("output") {
+					fmt.Fprintf(os.Stderr, "Warning: --output is ignored with --split; writing one file per policy to %s\n", outputDir)
+				}
+			} else if cmd.Flags().Changed("output-dir") {
+				return fmt.Errorf("--output-dir requires --split")
+			} else if !toStdout {
+				if err := validate.OutputPath(outputFile); err != nil {
+					return fmt.Errorf("invalid output path: %w", err)
+				}
+				if outputEncoding == "json" {
+					if err := validate.FileExtension(outputFile, ".json"); err != nil {
+						return fmt.Errorf("output file must be JSON with --output-format json: %w", err)
+					}
+				} else if err := validate.FileExtension(outputFile, ".yaml"); err != nil {
+					// Also accept .yml extension
+					if err2 := validate.FileExtension(outputFile, ".yml"); err2 != nil {
+						return fmt.Errorf("output file must be YAML (.yaml or .yml): %w", err)
+					}
 				}
 			}
 
-			// Validate namespace filter if provided
+			// Validate namespace filters; --namespace includes one more
+			var nsFilter hubble.NamespaceFilter
 			if namespaceFilter != "" {
 				if err := validate.Namespace(namespaceFilter); err != nil {
 					return fmt.Errorf("invalid namespace filter: %w", err)
 				}
+				nsFilter.Include = append(nsFilter.Include, namespaceFilter)
+			}
+			for _, namespace := range includeNamespaces {
+				if err := validate.Namespace(namespace); err != nil {
+					return fmt.Errorf("invalid --include-namespaces: %w", err)
+				}
+				if !slices.Contains(nsFilter.Include, namespace) {
+					nsFilter.Include = append(nsFilter.Include, namespace)
+				}
+			}
+			for _, namespace := range excludeNamespaces {
+				if err := validate.Namespace(namespace); err != nil {
+					return fmt.Errorf("invalid --exclude-namespaces: %w", err)
+				}
+				if slices.Contains(nsFilter.Include, namespace) {
+					return fmt.Errorf("namespace '%s' is both included and excluded", namespace)
+				}
+				nsFilter.Exclude = append(nsFilter.Exclude, namespace)
+			}
+
+			// Validate port and protocol filters if provided
+			var portFilter hubble.PortFilter
+			for _, port := range portsFilter {
+				if port < 1 || port > 65535 {
+					return fmt.Errorf("invalid --ports value %d: must be between 1 and 65535", port)
+				}
+				portFilter.Ports = append(portFilter.Ports, uint16(port))
+			}
+			for _, value := range protocolsFilter {
+				protocol, err := hubble.ParseProtocol(value)
+				if err != nil {
+					return fmt.Errorf("invalid --protocols: %w", err)
+				}
+				portFilter.Protocols = append(portFilter.Protocols, protocol)
+			}
+
+			// Validate policy namespace override if provided
+			if policyNamespace != "" {
+				if err := validate.Namespace(policyNamespace); err != nil {
+					return fmt.Errorf("invalid policy namespace: %w", err)
+				}
+				if clusterWide {
+					return fmt.Errorf("--policy-namespace is not supported with --cluster-wide (cluster-wide policies have no namespace)")
+				}
+			}
+
+			// Validate output format
+			if outputFormat != "cilium" && outputFormat != "k8s" {
+				return fmt.Errorf("invalid format '%s': must be 'cilium' or 'k8s'", outputFormat)
+			}
+			if clusterWide && outputFormat == "k8s" {
+				return fmt.Errorf("--cluster-wide is not supported with --format k8s (NetworkPolicy is always namespaced)")
+			}
+			if l7 && outputFormat == "k8s" {
+				return fmt.Errorf("--l7 is not supported with --format k8s (NetworkPolicy has no L7 rules)")
+			}
+			if outputEncoding == "json" && outputFormat == "k8s" {
+				return fmt.Errorf("--output-format json is not supported with --format k8s")
+			}
+			if outputEncoding == "json" && split {
+				return fmt.Errorf("--output-format json is not supported with --split")
+			}
+			if defaultDeny && outputFormat == "k8s" {
+				return fmt.Errorf("--default-deny is not supported with --format k8s (an empty NetworkPolicy denies all traffic)")
+			}
+			if comments && (outputFormat == "k8s" || outputEncoding == "json") {
+				return fmt.Errorf("--comments is only supported for CiliumNetworkPolicy YAML output")
+			}
+
+			if groupBy != synth.GroupByLabels && groupBy != synth.GroupByWorkload {
+				return fmt.Errorf("invalid --group-by '%s': must be '%s' or '%s'", groupBy, synth.GroupByLabels, synth.GroupByWorkload)
+			}
+			if externalIngress != synth.ExternalIngressCIDR && externalIngress != synth.ExternalIngressWorld {
+				return fmt.Errorf("invalid --external-ingress '%s': must be '%s' or '%s'", externalIngress, synth.ExternalIngressCIDR, synth.ExternalIngressWorld)
+			}
+
+			// Build synthesis options
+			opts := synth.Options{
+				GroupBy:            groupBy,
+				ExternalIngress:    externalIngress,
+				ClusterWide:        clusterWide,
+				PolicyNamespace:    policyNamespace,
+				L7:                 l7,
+				CollapsePorts:      collapsePorts,
+				SkipIntraNamespace: skipIntraNamespace,
+				DefaultDeny:        defaultDeny,
+
+				CrossNamespaceWildcard: crossNamespaceWildcard,
+			}
+			var reviewer *ruleReviewer
+			if interactive {
+				if inputPaths[0] == hubble.StdinPath {
+					return fmt.Errorf("--interactive reads answers from stdin and cannot be combined with --input -")
+				}
+				if !isTerminal(os.Stdin) {
+					return fmt.Errorf("--interactive needs a terminal on stdin; drop --interactive to write every rule")
+				}
+				reviewer = &ruleReviewer{in: bufio.NewReader(os.Stdin), out: progress}
+				opts.ReviewRule = reviewer.review
+			}
+			if !noProvenance {
+				opts.Provenance = &synth.Provenance{
+					GeneratedAt:   time.Now(),
+					SourceCapture: flowsSources(inputPaths),
+				}
+			}
+			if maxSelectorLabels < 0 {
+				return fmt.Errorf("invalid --max-selector-labels %d: must be 0 (no limit) or positive", maxSelectorLabels)
+			}
+			opts.MaxSelectorLabels = maxSelectorLabels
+			opts.RuleComments = comments
+			if nameTemplate != "" {
+				tmpl, err := template.New("name").Option("missingkey=error").Parse(nameTemplate)
+				if err != nil {
+					return fmt.Errorf("invalid --name-template: %w", err)
+				}
+				opts.NameTemplate = tmpl
+			}
+			for _, key := range labelKeys {
+				if strings.TrimSpace(key) == "" {
+					return fmt.Errorf("invalid --label-keys: empty label key")
+				}
+				opts.LabelKeys = append(opts.LabelKeys, strings.TrimSpace(key))
+			}
+			if minFlows < 1 {
+				return fmt.Errorf("invalid --min-flows %d: must be at least 1", minFlows)
+			}
+			opts.MinFlows = minFlows
+			if maxRulesPerPolicy < 0 {
+				return fmt.Errorf("invalid --max-rules-per-policy %d: must be 0 (no limit) or positive", maxRulesPerPolicy)
+			}
+			if maxPortsPerRule < 1 || maxPortsPerRule > synth.CiliumMaxPortsPerRule {
+				return fmt.Errorf("invalid --max-ports-per-rule %d: must be between 1 and %d", maxPortsPerRule, synth.CiliumMaxPortsPerRule)
+			}
+			opts.MaxRulesPerPolicy = maxRulesPerPolicy
+			opts.MaxPortsPerRule = maxPortsPerRule
+			opts.OnLimit = func(message string) {
+				fmt.Fprintf(os.Stderr, "Warning: %s\n", message)
+			}
+			timeFilter, err := parseTimeFilter(since, until, requireTimestamp)
+			if err != nil {
+				return err
+			}
+			if opts.IgnoreLabelPrefixes, err = parseLabelPrefixes(ignoreLabelPrefixes); err != nil {
+				return err
+			}
+			for _, value := range ownerReferences {
+				owner, err := synth.ParseOwnerReference(value)
+				if err != nil {
+					return fmt.Errorf("invalid --output-owner-references: %w", err)
+				}
+				opts.OwnerReferences = append(opts.OwnerReferences, owner)
+			}
+			// --cidr-prefix is an alias sharing --cidr-aggregation's value,
+			// so setting both would silently keep the last one
+			cidrAggregationFlag := "--cidr-aggregation"
+			if cmd.Flags().Changed("cidr-prefix") {
+				if cmd.Flags().Changed("cidr-aggregation") {
+					return fmt.Errorf("--cidr-prefix is an alias for --cidr-aggregation; set only one")
+				}
+				cidrAggregationFlag = "--cidr-prefix"
+			}
+			if cidrAggregation != "" {
+				prefixLen, err := synth.ParsePrefixLen(cidrAggregation)
+				if err != nil {
+					return fmt.Errorf("invalid %s: %w", cidrAggregationFlag, err)
+				}
+				opts.CIDRPrefixLen = prefixLen
+			}
+			if cmd.Flags().Changed("cidr-max-prefix") && !cidrAggregate {
+				return fmt.Errorf("--cidr-max-prefix requires --cidr-aggregate")
+			}
+			if cidrAggregate {
+				if cidrAggregation != "" {
+					return fmt.Errorf("--cidr-aggregate cannot be combined with %s", cidrAggregationFlag)
+				}
+				if cidrMaxPrefix < 1 || cidrMaxPrefix > 32 {
+					return fmt.Errorf("invalid --cidr-max-prefix %d: must be between 1 and 32", cidrMaxPrefix)
+				}
+				opts.CIDRMergePrefixLen = cidrMaxPrefix
 			}
 
 			// Read flows
-			fmt.Printf("Reading flows from %s...\n", inputFile)
-			collection, err := hubble.ReadFlowsFromFile(inputFile)
+			fmt.Fprintf(progress, "Reading flows from %s...\n", flowsSources(inputPaths))
+			collection, err := readFlowsInputs(inputPaths)
 			if err != nil {
 				return fmt.Errorf("failed to read flows: %w", err)
 			}
 
-			// Validate collection
-			if collection == nil {
-				return fmt.Errorf("invalid flows file: collection is nil")
-			}
-			if collection.Schema == "" {
-				return fmt.Errorf("invalid flows file: missing schema field")
+			// Validate collection schema, migrating older flow files
+			if err := hubble.ValidateSchema(collection); err != nil {
+				return fmt.Errorf("invalid flows file: %w", err)
 			}
 
-			// Parse flows
+			// Parse flows, keeping those in the time window, and collapse
+			// repeated tuples
 			parsedFlows, err := hubble.ParseFlows(collection)
 			if err != nil {
 				return fmt.Errorf("failed to parse flows: %w", err)
 			}
+			if detectReplies {
+				if replies := hubble.DetectReplies(parsedFlows); replies > 0 {
+					fmt.Fprintf(progress, "Ignoring %d reply flow(s) not reported as replies by Hubble\n", replies)
+				}
+			}
+			if parsedFlows, err = filterFlowsByTime(parsedFlows, timeFilter, progress); err != nil {
+				return err
+			}
+			parsedFlows = hubble.DeduplicateFlows(parsedFlows)
 
 			if len(parsedFlows) == 0 {
 				return fmt.Errorf("no valid flows found to generate policies from")
 			}
 
-			// Apply namespace filter if provided
-			if namespaceFilter != "" {
-				filtered := make([]*hubble.ParsedFlow, 0)
-				for _, flow := range parsedFlows {
-					// Include flows where source or destination matches the namespace
-					if flow.SourceNamespace == namespaceFilter || flow.DestNamespace == namespaceFilter {
-						filtered = append(filtered, flow)
+			// Apply namespace filters if provided, keeping flows whose
+			// source or destination matches
+			if !nsFilter.IsZero() {
+				filtered := hubble.FilterFlowsByNamespace(parsedFlows, nsFilter)
+				if len(filtered) == 0 {
+					if len(nsFilter.Include) == 1 {
+						return fmt.Errorf("no flows found in namespace '%s'", nsFilter.Include[0])
+					}
+					return fmt.Errorf("no flows match the namespace filters")
+				}
+				switch len(nsFilter.Include) {
+				case 0:
+					fmt.Fprintf(progress, "Filtered out %d flows from or to excluded namespaces\n", len(parsedFlows)-len(filtered))
+				case 1:
+					fmt.Fprintf(progress, "Filtered to %d flows in namespace '%s'\n", len(filtered), nsFilter.Include[0])
+				default:
+					// A flow between two included namespaces counts for both
+					fmt.Fprintf(progress, "Filtered to %d flows in %d namespaces:\n", len(filtered), len(nsFilter.Include))
+					for _, namespace := range nsFilter.Include {
+						fmt.Fprintf(progress, "  %s: %d flows\n", namespace, hubble.CountFlowsInNamespace(filtered, namespace))
 					}
 				}
+				parsedFlows = filtered
+			}
+
+			// Apply port and protocol filters if provided
+			if !portFilter.IsZero() {
+				filtered := hubble.FilterFlowsByPort(parsedFlows, portFilter)
 				if len(filtered) == 0 {
-					return fmt.Errorf("no flows found in namespace '%s'", namespaceFilter)
+					return fmt.Errorf("no flows match --ports/--protocols")
 				}
+				fmt.Fprintf(progress, "Filtered out %d flows not matching --ports/--protocols\n", len(parsedFlows)-len(filtered))
 				parsedFlows = filtered
-				fmt.Printf("Filtered to %d flows in namespace '%s'\n", len(parsedFlows), namespaceFilter)
 			}
 
-			fmt.Printf("Found %d parsed flows\n", len(parsedFlows))
+			fmt.Fprintf(progress, "Found %d unique flows\n", len(parsedFlows))
 
 			// Synthesize policies
-			fmt.Println("Synthesizing policies...")
-			policies, err := synth.SynthesizePolicies(parsedFlows)
+			fmt.Fprintln(progress, "Synthesizing policies...")
+			policies, suppressed, err := synth.SynthesizePoliciesWithSuppressed(parsedFlows, opts)
 			if err != nil {
 				return fmt.Errorf("failed to synthesize policies: %w", err)
 			}
 
+			if len(suppressed) > 0 {
+				fmt.Fprintf(os.Stderr, "Suppressed %d rule(s) observed fewer than %d times:\n", len(suppressed), minFlows)
+				for _, rule := range suppressed {
+					fmt.Fprintf(os.Stderr, "  - %s\n", rule)
+				}
+			}
+
+			if reviewer != nil {
+				fmt.Fprintf(progress, "Approved %d of %d ingress rules\n", reviewer.approved, reviewer.reviewed)
+			}
+
 			if len(policies) == 0 {
+				if reviewer != nil && reviewer.reviewed > 0 {
+					return fmt.Errorf("no policies generated: every rule was rejected in review")
+				}
+				if len(suppressed) > 0 {
+					return fmt.Errorf("no policies generated: every rule was observed fewer than --min-flows %d times", minFlows)
+				}
 				return fmt.Errorf("no policies generated (flows may be missing required metadata)")
 			}
 
-			fmt.Printf("Generated %d policy(ies)\n", len(policies))
+			fmt.Fprintf(progress, "Generated %d policy(ies)\n", len(policies))
 
-			// Write policies to file
-			if err := synth.WritePoliciesToFile(policies, outputFile); err != nil {
-				return fmt.Errorf("failed to write policies: %w", err)
+			if !allowSystemNamespaces {
+				warnings := synth.AuditPolicies(policies)
+				for _, warning := range warnings {
+					fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+				}
+				if len(warnings) > 0 {
+					fmt.Fprintf(os.Stderr, "Review these rules, or pass --allow-system-namespaces if they are intended\n")
+				}
 			}
 
-			fmt.Printf("Policies saved to %s\n", outputFile)
+			// Translate to Kubernetes NetworkPolicies if requested
+			if outputFormat == "k8s" {
+				networkPolicies := make([]*synth.NetworkPolicy, 0, len(policies))
+				for _, policy := range policies {
+					networkPolicies = append(networkPolicies, synth.ConvertToNetworkPolicy(policy))
+				}
+
+				if split {
+					paths, err := synth.WriteNetworkPoliciesToDir(networkPolicies, outputDir)
+					if err != nil {
+						return fmt.Errorf("failed to write policies: %w", err)
+					}
+					fmt.Fprintf(progress, "Policies saved to %d file(s) in %s\n", len(paths), outputDir)
+				} else if toStdout {
+					if err := synth.WriteNetworkPolicies(os.Stdout, networkPolicies); err != nil {
+						return fmt.Errorf("failed to write policies: %w", err)
+					}
+				} else {
+					if err := synth.WriteNetworkPoliciesToFile(networkPolicies, outputFile); err != nil {
+						return fmt.Errorf("failed to write policies: %w", err)
+					}
+					fmt.Fprintf(progress, "Policies saved to %s\n", outputFile)
+				}
+
+				for _, policy := range networkPolicies {
+					fmt.Fprintf(progress, "  - %s/%s (namespace: %s)\n",
+						policy.Kind,
+						policy.Metadata.Name,
+						policy.Metadata.Namespace)
+				}
+
+				return nil
+			}
+
+			// Write policies to file, or one file per policy with --split
+			if split {
+				paths, err := synth.WritePoliciesToDir(policies, outputDir)
+				if err != nil {
+					return fmt.Errorf("failed to write policies: %w", err)
+				}
+				fmt.Fprintf(progress, "Policies saved to %d file(s) in %s\n", len(paths), outputDir)
+			} else if toStdout && outputEncoding == "json" {
+				data, err := synth.PoliciesToJSON(policies)
+				if err != nil {
+					return fmt.Errorf("failed to write policies: %w", err)
+				}
+				if _, err := os.Stdout.Write(data); err != nil {
+					return fmt.Errorf("failed to write policies: %w", err)
+				}
+			} else if toStdout {
+				if err := synth.WritePolicies(os.Stdout, policies); err != nil {
+					return fmt.Errorf("failed to write policies: %w", err)
+				}
+			} else if outputEncoding == "json" {
+				if err := synth.WritePoliciesToJSONFile(policies, outputFile); err != nil {
+					return fmt.Errorf("failed to write policies: %w", err)
+				}
+				fmt.Fprintf(progress, "Policies saved to %s\n", outputFile)
+			} else {
+				if err := synth.WritePoliciesToFile(policies, outputFile); err != nil {
+					return fmt.Errorf("failed to write policies: %w", err)
+				}
+				fmt.Fprintf(progress, "Policies saved to %s\n", outputFile)
+			}
 
 			// Print summary
 			for _, policy := range policies {
-				fmt.Printf("  - %s/%s (namespace: %s)\n",
+				fmt.Fprintf(progress, "  - %s/%s (namespace: %s)\n",
 					policy.Kind,
 					policy.Metadata.Name,
 					policy.Metadata.Namespace)
@@ -246,43 +776,166 @@ func cmdPropose() *cobra.Command {
 		},
 	}
 
-	cmd.Flags().StringVarP(&inputFile, "input", "i", "", "Input flows JSON file (default: out/flows.json)")
-	cmd.Flags().StringVarP(&outputFile, "output", "o", "", "Output policy YAML file (default: out/policy.yaml)")
+	cmd.Flags().StringArrayVarP(&inputFiles, "input", "i", nil, "Input flows JSON file or glob, or - for stdin; repeat to merge several captures (default: out/flows.json)")
+	cmd.Flags().StringVarP(&outputFile, "output", "o", "", "Output policy file, or - for stdout (default: out/policy.yaml, or out/policy.json with --output-format json)")
+	cmd.Flags().StringVar(&outputEncoding, "output-format", "yaml", "Output file format: 'yaml' (multi-document) or 'json' (array of policies)")
+	cmd.Flags().BoolVar(&split, "split", false, "Write each policy to its own <namespace>-<name>.yaml file in --output-dir instead of a single --output file")
+	cmd.Flags().StringVar(&outputDir, "output-dir", "out/policies", "Output directory for --split")
 	cmd.Flags().StringVarP(&namespaceFilter, "namespace", "n", "", "Filter flows by namespace (optional)")
+	cmd.Flags().StringSliceVar(&includeNamespaces, "include-namespaces", nil, "Only use flows from or to these namespaces, e.g. shop,billing (optional)")
+	cmd.Flags().StringSliceVar(&excludeNamespaces, "exclude-namespaces", nil, "Drop flows from or to these namespaces, e.g. kube-system,cilium (optional)")
+	cmd.Flags().IntSliceVar(&portsFilter, "ports", nil, "Only use flows to these destination ports, e.g. 443,8080; flows without a port (ICMP) are dropped (optional)")
+	cmd.Flags().StringSliceVar(&protocolsFilter, "protocols", nil, "Only use flows with these protocols: TCP, UDP, SCTP, ICMP, ICMPv6 (optional)")
+	cmd.Flags().StringVar(&cidrAggregation, "cidr-aggregation", "", "Broadest prefix to aggregate external IPs into for toCIDR rules, e.g. /24 (default: one /32 or /128 per IP)")
+	cmd.Flags().StringVar(&cidrAggregation, "cidr-prefix", "", "Alias for --cidr-aggregation")
+	cmd.Flags().BoolVar(&cidrAggregate, "cidr-aggregate", false, "Merge external IPs into the fewest CIDRs that cover exactly the observed IPs, never allowing unobserved hosts")
+	cmd.Flags().IntVar(&cidrMaxPrefix, "cidr-max-prefix", synth.DefaultIPv4AggregationPrefix, "Broadest IPv4 prefix --cidr-aggregate may produce (IPv6 is never broader than /64)")
+	cmd.Flags().StringVar(&externalIngress, "external-ingress", synth.ExternalIngressCIDR, "Allow clients outside the cluster by their IP with 'cidr' (fromCIDR /32 or /128 per client) or all of them with 'world' (fromEntities: [world])")
+	cmd.Flags().StringVar(&outputFormat, "format", "cilium", "Policy format: 'cilium' (CiliumNetworkPolicy) or 'k8s' (NetworkPolicy)")
+	cmd.Flags().BoolVar(&clusterWide, "cluster-wide", false, "Emit CiliumClusterwideNetworkPolicies with namespace-qualified selectors")
+	cmd.Flags().StringVar(&policyNamespace, "policy-namespace", "", "Place all generated policies in this namespace, pinning their selectors to the endpoints' own namespaces and prefixing their names with them; not supported with --cluster-wide (optional)")
+	cmd.Flags().StringVar(&nameTemplate, "name-template", "", "Go template for policy names, with {{.Namespace}}, {{.App}}, {{.Direction}} and {{.Labels}}, e.g. '{{.Namespace}}-{{.App}}-{{.Direction}}' (default: <app>-policy)")
+	cmd.Flags().StringSliceVar(&labelKeys, "label-keys", nil, "Only use labels with these keys in selectors, e.g. app,component (default: all but noise labels like pod-template-hash)")
+	cmd.Flags().StringSliceVar(&ignoreLabelPrefixes, "ignore-label-prefix", nil, "Also leave labels with these key prefixes out of selectors, e.g. version (Cilium policy/namespace labels and per-pod hashes are always left out)")
+	cmd.Flags().IntVar(&maxSelectorLabels, "max-selector-labels", 0, "Cap labels per selector, keeping the most stable keys (namespace label always kept; 0 = no limit)")
+	cmd.Flags().StringVar(&since, "since", "", "Only use flows observed at or after this time: RFC3339 or a duration before now, e.g. 1h")
+	cmd.Flags().StringVar(&until, "until", "", "Only use flows observed at or before this time: RFC3339 or a duration before now, e.g. 10m")
+	cmd.Flags().BoolVar(&requireTimestamp, "require-timestamp", false, "Drop flows without a timestamp instead of keeping them")
+	cmd.Flags().BoolVar(&detectReplies, "detect-replies", true, "Treat flows Hubble did not mark is_reply as replies when they answer a SYN or mirror an observed flow from a lower port, so they add no rules")
+	cmd.Flags().StringVar(&groupBy, "group-by", synth.GroupByLabels, "Key endpoints on 'labels' or on their 'workload' (e.g. Deployment), using the labels shared by all of its pods")
+	cmd.Flags().BoolVar(&allowSystemNamespaces, "allow-system-namespaces", false, "Don't warn about policies that select or allow traffic to and from kube-system, kube-public or cilium pods")
+	cmd.Flags().BoolVar(&defaultDeny, "default-deny", false, "Also emit a <name>-default-deny policy with enableDefaultDeny set for ingress and egress for each selected endpoint, keeping default-deny in effect without allow rules")
+	cmd.Flags().BoolVar(&skipIntraNamespace, "skip-intra-namespace", false, "Ignore flows within a namespace, generating rules only for cross-namespace and external traffic and allowing all traffic within each policy's namespace")
+	cmd.Flags().BoolVar(&crossNamespaceWildcard, "cross-namespace-wildcard", false, "Allow a client app seen in several namespaces talking to the same endpoint from any namespace with one rule, instead of one rule per namespace")
+	cmd.Flags().IntVar(&maxRulesPerPolicy, "max-rules-per-policy", 500, "Split policies with more ingress or egress rules than this into several policies with the same selector (0 = no limit)")
+	cmd.Flags().IntVar(&maxPortsPerRule, "max-ports-per-rule", synth.CiliumMaxPortsPerRule, "Split toPorts entries with more ports than this into several entries (at most 40, Cilium's limit)")
+	cmd.Flags().IntVar(&minFlows, "min-flows", 1, "Only emit ingress rules for source/port pairs observed at least this many times in the input (a learn --dedupe capture keeps each distinct flow once); rarer ones are reported as suppressed")
+	cmd.Flags().BoolVar(&collapsePorts, "collapse-ports", false, "Merge contiguous ingress ports from the same source into port/endPort ranges")
+	cmd.Flags().BoolVar(&interactive, "interactive", false, "Review each generated ingress rule before writing: y keeps it, n (default) drops it, a keeps it and all remaining rules, q drops it and all remaining rules")
+	cmd.Flags().BoolVar(&comments, "comments", false, "Comment each ingress rule with the number of flows it was derived from, their source and dates; off by default as comments break YAML-equality diffs")
+	cmd.Flags().BoolVar(&noProvenance, "no-provenance", false, "Don't label policies as managed by PolicyPilot or annotate them with the generation time, source capture, fingerprint and flow count, e.g. for clean diffs")
+	cmd.Flags().StringArrayVar(&ownerReferences, "output-owner-references", nil, "Set metadata.ownerReferences on every policy to this owner, as apiVersion/Kind/name/uid (repeatable); the owner must be cluster-scoped or in the policies' namespace")
+	cmd.Flags().BoolVar(&l7, "l7", false, "Restrict ports with observed HTTP requests to those methods and paths (toPorts[].rules.http)")
 
 	return cmd
 }
 
 func cmdVerify() *cobra.Command {
 	var policyFile string
+	var requireNamespace bool
+	var strict bool
+	var flowsFile string
+	var apiVersions []string
+	var format string
+	var exclude []string
 
 	cmd := &cobra.Command{
 		Use:   "verify",
 		Short: "Verify CiliumNetworkPolicy YAML syntax and structure",
-		Long:  "Validates policy YAML files for correct syntax, required fields, and CiliumNetworkPolicy structure.",
+		Long:  "Validates policy YAML files for correct syntax, required fields, and CiliumNetworkPolicy structure.\nWith a directory as --input, verifies every *.yaml and *.yml file in the tree.",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			// Set default policy file if not provided
 			if policyFile == "" {
 				policyFile = "out/policy.yaml"
 			}
 
-			// Validate input file
-			if err := validate.FilePath(policyFile); err != nil {
-				return fmt.Errorf("invalid policy file: %w", err)
+			// Validate input file, or walk the input directory
+			info, err := os.Stat(policyFile)
+			isDir := err == nil && info.IsDir()
+			if !isDir {
+				if err := validate.FilePath(policyFile); err != nil {
+					return fmt.Errorf("invalid policy file: %w", err)
+				}
+				if err := validate.FileExtension(policyFile, ".yaml"); err != nil {
+					// Also accept .yml extension
+					if err2 := validate.FileExtension(policyFile, ".yml"); err2 != nil {
+						return fmt.Errorf("policy file must be YAML (.yaml or .yml): %w", err)
+					}
+				}
+				if len(exclude) > 0 {
+					return fmt.Errorf("--exclude only applies when --input is a directory")
+				}
 			}
-			if err := validate.FileExtension(policyFile, ".yaml"); err != nil {
-				// Also accept .yml extension
-				if err2 := validate.FileExtension(policyFile, ".yml"); err2 != nil {
-					return fmt.Errorf("policy file must be YAML (.yaml or .yml): %w", err)
+
+			if flowsFile != "" {
+				if err := validate.FilePath(flowsFile); err != nil {
+					return fmt.Errorf("invalid flows file: %w", err)
+				}
+				if err := validate.FileExtensionOrGzip(flowsFile, ".json"); err != nil {
+					return fmt.Errorf("flows file must be JSON: %w", err)
+				}
+			}
+
+			for _, version := range apiVersions {
+				if strings.TrimSpace(version) == "" {
+					return fmt.Errorf("invalid --api-versions: empty apiVersion")
 				}
 			}
+			if format != "text" && format != "json" {
+				return fmt.Errorf("invalid format '%s': must be 'text' or 'json'", format)
+			}
 
-			fmt.Printf("Verifying policies in %s...\n", policyFile)
+			// With --format json, stdout carries only the result
+			if format == "text" {
+				fmt.Printf("Verifying policies in %s...\n", policyFile)
+			}
 
-			// Verify policies
-			result, err := verify.VerifyPolicies(policyFile)
-			if err != nil {
-				return fmt.Errorf("verification failed: %w", err)
+			// Verify policies, checking allowed ports against observed flows if given
+			opts := verify.Options{
+				APIVersions:      apiVersions,
+				RequireNamespace: requireNamespace,
+				Strict:           strict,
+				Exclude:          exclude,
+			}
+			var result *verify.VerificationResult
+			if flowsFile != "" {
+				collection, err := hubble.ReadFlowsFromFile(flowsFile)
+				if err != nil {
+					return fmt.Errorf("failed to read flows: %w", err)
+				}
+				if err := hubble.ValidateSchema(collection); err != nil {
+					return fmt.Errorf("invalid flows file: %w", err)
+				}
+				parsedFlows, err := hubble.ParseFlows(collection)
+				if err != nil {
+					return fmt.Errorf("failed to parse flows: %w", err)
+				}
+				// Replies do not show a port being used, as for propose
+				hubble.DetectReplies(parsedFlows)
+				parsedFlows = hubble.DeduplicateFlows(parsedFlows)
+				if format == "text" {
+					fmt.Printf("Checking allowed ports against %d unique flows from %s...\n", len(parsedFlows), flowsFile)
+				}
+
+				if isDir {
+					result, err = verify.VerifyPolicyDirectoryAgainstFlows(policyFile, parsedFlows, opts)
+				} else {
+					result, err = verify.VerifyPoliciesAgainstFlows(policyFile, parsedFlows, opts)
+				}
+				if err != nil {
+					return fmt.Errorf("verification failed: %w", err)
+				}
+			} else {
+				if isDir {
+					result, err = verify.VerifyPolicyDirectory(policyFile, opts)
+				} else {
+					result, err = verify.VerifyPoliciesWithOptions(policyFile, opts)
+				}
+				if err != nil {
+					return fmt.Errorf("verification failed: %w", err)
+				}
+			}
+
+			if format == "json" {
+				data, err := json.MarshalIndent(result, "", "  ")
+				if err != nil {
+					return fmt.Errorf("failed to marshal verification result: %w", err)
+				}
+				fmt.Println(string(data))
+				if !result.Valid {
+					return fmt.Errorf("policy verification failed")
+				}
+				return nil
 			}
 
 			// Print results
@@ -299,6 +952,9 @@ func cmdVerify() *cobra.Command {
 			// Print policy details
 			for i, policy := range result.Policies {
 				fmt.Printf("\n  Policy %d: %s/%s\n", i+1, policy.Kind, policy.Name)
+				if policy.File != "" {
+					fmt.Printf("    File: %s\n", policy.File)
+				}
 				if policy.Namespace != "" {
 					fmt.Printf("    Namespace: %s\n", policy.Namespace)
 				}
@@ -328,6 +984,10 @@ func cmdVerify() *cobra.Command {
 				}
 			}
 
+			if len(result.Files) > 0 {
+				printFileResults(result.Files)
+			}
+
 			// Exit with error if validation failed
 			if !result.Valid {
 				return fmt.Errorf("policy verification failed")
@@ -338,95 +998,225 @@ func cmdVerify() *cobra.Command {
 		},
 	}
 
-	cmd.Flags().StringVarP(&policyFile, "input", "i", "", "Input policy YAML file (default: out/policy.yaml)")
+	cmd.Flags().StringVarP(&policyFile, "input", "i", "", "Input policy YAML file, or a directory to verify every *.yaml and *.yml file in it (default: out/policy.yaml)")
+	cmd.Flags().StringSliceVar(&exclude, "exclude", nil, "With a directory --input, skip files and directories matching these globs, e.g. '*-test.yaml' (added to the directory's .cppignore)")
+	cmd.Flags().BoolVar(&requireNamespace, "require-namespace", false, "Fail CiliumNetworkPolicies that omit metadata.namespace instead of defaulting to 'default'")
+	cmd.Flags().StringVarP(&flowsFile, "flows", "f", "", "Flows JSON file to check against: warn about ingress ports no flow used (optional)")
+	cmd.Flags().StringSliceVar(&apiVersions, "api-versions", verify.DefaultAPIVersions, "Accepted policy apiVersions; other cilium.io versions are reported as warnings")
+	cmd.Flags().BoolVar(&strict, "strict", false, "Treat warnings as errors and exit non-zero if any are found (e.g. for CI)")
+	cmd.Flags().StringVar(&format, "format", "text", "Output format: 'text' or 'json' (the full result, including per-policy errors and warnings, on stdout)")
 
 	return cmd
 }
 
 func cmdExplain() *cobra.Command {
-	var flowsFile string
+	var flowsFiles []string
 	var policiesFile string
 	var outputFile string
+	var reportFormat string
+	var graphFormat string
+	var graphDirection string
+	var maxNodes int
+	var maxEdges int
+	var graphFlat bool
+	var since string
+	var until string
+	var requireTimestamp bool
+	var ignoreLabelPrefixes []string
+	var rawLabels bool
+	var graphDetail string
+	var graphObservedDirection bool
+	var anonymize bool
+	var redactKeys []string
 
 	cmd := &cobra.Command{
 		Use:   "explain",
 		Short: "Generate HTML report with policy summary and network graph",
-		Long:  "Generate an HTML report with flow statistics, generated policies, and network visualization.",
+		Long:  "Generate an HTML report with flow statistics, generated policies, and network visualization.\nWith --format text, print a plain-text summary to stdout instead.",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			// Set defaults
-			if flowsFile == "" {
-				flowsFile = "out/flows.json"
+			if len(flowsFiles) == 0 {
+				flowsFiles = []string{"out/flows.json"}
 			}
 			if policiesFile == "" {
 				policiesFile = "out/policy.yaml"
 			}
+			if reportFormat != "html" && reportFormat != "text" {
+				return fmt.Errorf("invalid format '%s': must be 'html' or 'text'", reportFormat)
+			}
+			if reportFormat == "text" && (outputFile != "" || graphFormat == "json") {
+				return fmt.Errorf("--format text prints to stdout and cannot be combined with --output or --graph-format json")
+			}
+			if graphFormat != "mermaid" && graphFormat != "json" {
+				return fmt.Errorf("invalid graph format '%s': must be 'mermaid' or 'json'", graphFormat)
+			}
+			graphDirection = strings.ToUpper(graphDirection)
+			if graphDirection != graph.DirectionTopDown && graphDirection != graph.DirectionLeftRight {
+				return fmt.Errorf("invalid graph direction '%s': must be 'TD' or 'LR'", graphDirection)
+			}
+			if maxNodes < 1 || maxEdges < 1 {
+				return fmt.Errorf("--max-nodes and --max-edges must be at least 1")
+			}
+			if graphDetail != graph.DetailApp && graphDetail != graph.DetailPod {
+				return fmt.Errorf("invalid graph detail '%s': must be '%s' or '%s'", graphDetail, graph.DetailApp, graph.DetailPod)
+			}
+			timeFilter, err := parseTimeFilter(since, until, requireTimestamp)
+			if err != nil {
+				return err
+			}
+			extraPrefixes, err := parseLabelPrefixes(ignoreLabelPrefixes)
+			if err != nil {
+				return err
+			}
+			if anonymize && cmd.Flags().Changed("policies") {
+				return fmt.Errorf("--anonymize generates policies from the anonymized flows and cannot be combined with --policies, whose names would not be anonymized")
+			}
+			if cmd.Flags().Changed("redact-keys") {
+				if !anonymize {
+					return fmt.Errorf("--redact-keys requires --anonymize")
+				}
+				for _, key := range redactKeys {
+					if strings.TrimSpace(key) == "" {
+						return fmt.Errorf("invalid --redact-keys: empty label key")
+					}
+				}
+			}
+			// Progress goes to stderr when stdout carries the text report
+			progress := os.Stdout
+			if reportFormat == "text" {
+				progress = os.Stderr
+			}
 			if outputFile == "" {
 				outputFile = "out/report.html"
+				if graphFormat == "json" {
+					outputFile = "out/graph.json"
+				}
 			}
 
 			// Validate input files
-			if err := validate.FilePath(flowsFile); err != nil {
+			flowsPaths, err := expandFlowsInputs(flowsFiles)
+			if err != nil {
 				return fmt.Errorf("invalid flows file: %w", err)
 			}
-			if err := validate.FileExtension(flowsFile, ".json"); err != nil {
-				return fmt.Errorf("flows file must be JSON: %w", err)
-			}
 
 			// Validate output path
-			if err := validate.OutputPath(outputFile); err != nil {
-				return fmt.Errorf("invalid output path: %w", err)
-			}
-			if err := validate.FileExtension(outputFile, ".html"); err != nil {
-				return fmt.Errorf("output file must be HTML: %w", err)
+			if reportFormat == "html" {
+				if err := validate.OutputPath(outputFile); err != nil {
+					return fmt.Errorf("invalid output path: %w", err)
+				}
+				if graphFormat == "json" {
+					if err := validate.FileExtension(outputFile, ".json"); err != nil {
+						return fmt.Errorf("output file must be JSON with --graph-format json: %w", err)
+					}
+				} else if err := validate.FileExtension(outputFile, ".html"); err != nil {
+					return fmt.Errorf("output file must be HTML: %w", err)
+				}
 			}
 
-			fmt.Printf("Reading flows from %s...\n", flowsFile)
-			collection, err := hubble.ReadFlowsFromFile(flowsFile)
+			fmt.Fprintf(progress, "Reading flows from %s...\n", flowsSources(flowsPaths))
+			collection, err := readFlowsInputs(flowsPaths)
 			if err != nil {
 				return fmt.Errorf("failed to read flows: %w", err)
 			}
+			if err := hubble.ValidateSchema(collection); err != nil {
+				return fmt.Errorf("invalid flows file: %w", err)
+			}
 
-			// Parse flows
+			// Parse flows, keeping those in the time window, and collapse
+			// repeated tuples
 			parsedFlows, err := hubble.ParseFlows(collection)
 			if err != nil {
 				return fmt.Errorf("failed to parse flows: %w", err)
 			}
+			// Replies are drawn from the client that opened the connection
+			if replies := hubble.DetectReplies(parsedFlows); replies > 0 {
+				fmt.Fprintf(progress, "Detected %d reply flow(s) not reported as replies by Hubble\n", replies)
+			}
+			if parsedFlows, err = filterFlowsByTime(parsedFlows, timeFilter, progress); err != nil {
+				return err
+			}
+			if anonymize {
+				parsedFlows = explain.NewRedactor(redactKeys).Redact(parsedFlows)
+				fmt.Fprintln(progress, "Anonymized namespaces, pods, workloads, IPs, DNS names and workload labels")
+			}
+			// Deduplication merges replicas of a workload, which the pod
+			// graph keeps apart
+			if graphDetail != graph.DetailPod {
+				parsedFlows = hubble.DeduplicateFlows(parsedFlows)
+			}
 
 			if len(parsedFlows) == 0 {
 				return fmt.Errorf("no valid flows found")
 			}
 
-			fmt.Printf("Found %d parsed flows\n", len(parsedFlows))
+			if graphDetail == graph.DetailPod {
+				fmt.Fprintf(progress, "Found %d flows\n", len(parsedFlows))
+			} else {
+				fmt.Fprintf(progress, "Found %d unique flows\n", len(parsedFlows))
+			}
 
-			// Read policies if file exists
+			// Read policies if file exists; anonymized reports only show
+			// policies generated from the anonymized flows
 			var policies []*synth.Policy
-			if _, err := os.Stat(policiesFile); err == nil {
-				fmt.Printf("Reading policies from %s...\n", policiesFile)
-				// For now, we'll synthesize policies from flows
-				// In the future, we could parse the YAML file
-				policies, err = synth.SynthesizePolicies(parsedFlows)
+			if _, err := os.Stat(policiesFile); err == nil && !anonymize {
+				fmt.Fprintf(progress, "Reading policies from %s...\n", policiesFile)
+				policies, err = synth.ParsePoliciesFromFile(policiesFile)
 				if err != nil {
-					return fmt.Errorf("failed to synthesize policies: %w", err)
+					return fmt.Errorf("failed to read policies: %w", err)
 				}
-				fmt.Printf("Found %d policies\n", len(policies))
+				fmt.Fprintf(progress, "Found %d policies\n", len(policies))
 			} else {
 				// Generate policies from flows
-				fmt.Println("No policy file found. Generating policies from flows...")
-				policies, err = synth.SynthesizePolicies(parsedFlows)
+				if anonymize {
+					fmt.Fprintln(progress, "Generating policies from the anonymized flows...")
+				} else {
+					fmt.Fprintln(progress, "No policy file found. Generating policies from flows...")
+				}
+				policies, err = synth.SynthesizePoliciesWithOptions(parsedFlows, synth.Options{IgnoreLabelPrefixes: extraPrefixes})
 				if err != nil {
 					return fmt.Errorf("failed to synthesize policies: %w", err)
 				}
 			}
 
 			// Generate report
-			fmt.Println("Generating report...")
-			reportData, err := explain.GenerateReport(parsedFlows, policies)
+			fmt.Fprintln(progress, "Generating report...")
+			graphFlows := parsedFlows
+			if !rawLabels {
+				prefixes := append(slices.Clone(hubble.DefaultIgnoredLabelPrefixes), extraPrefixes...)
+				graphFlows = hubble.NormalizeFlowLabels(parsedFlows, prefixes)
+			}
+			reportOpts := explain.ReportOptions{Graph: graph.Options{Detail: graphDetail, ObservedDirection: graphObservedDirection}}
+			reportData, err := explain.GenerateReportWithOptions(graphFlows, policies, reportOpts)
 			if err != nil {
 				return fmt.Errorf("failed to generate report: %w", err)
 			}
+			// The text report lists the cautions itself
+			if reportFormat == "text" {
+				return explain.WriteTextReport(reportData, os.Stdout)
+			}
+			for _, caution := range reportData.Quality.Cautions() {
+				fmt.Fprintf(os.Stderr, "Warning: %s; capture longer before trusting the generated policies\n", caution)
+			}
+
+			// Write the graph alone as JSON if requested
+			if graphFormat == "json" {
+				if err := explain.WriteGraphJSON(reportData, outputFile); err != nil {
+					return err
+				}
+				fmt.Printf("Graph saved to %s\n", outputFile)
+				fmt.Printf("  - %d nodes\n", len(reportData.Graph.Nodes))
+				fmt.Printf("  - %d edges\n", len(reportData.Graph.Edges))
+				return nil
+			}
 
 			// Write HTML report
-			if err := explain.WriteHTMLReport(reportData, outputFile); err != nil {
+			renderOpts := explain.RenderOptions{Graph: graph.MermaidOptions{
+				Direction: graphDirection,
+				MaxNodes:  maxNodes,
+				MaxEdges:  maxEdges,
+				Flat:      graphFlat,
+			}}
+			if err := explain.WriteHTMLReportWithOptions(reportData, outputFile, renderOpts); err != nil {
 				return fmt.Errorf("failed to write HTML report: %w", err)
 			}
 
@@ -440,9 +1230,787 @@ func cmdExplain() *cobra.Command {
 		},
 	}
 
-	cmd.Flags().StringVarP(&flowsFile, "flows", "f", "", "Input flows JSON file (default: out/flows.json)")
+	cmd.Flags().StringArrayVarP(&flowsFiles, "flows", "f", nil, "Input flows JSON file or glob, or - for stdin; repeat to merge several captures (default: out/flows.json)")
 	cmd.Flags().StringVarP(&policiesFile, "policies", "p", "", "Input policies YAML file (default: out/policy.yaml)")
-	cmd.Flags().StringVarP(&outputFile, "output", "o", "", "Output HTML report file (default: out/report.html)")
+	cmd.Flags().StringVarP(&outputFile, "output", "o", "", "Output HTML report file (default: out/report.html, or out/graph.json with --graph-format json)")
+	cmd.Flags().StringVar(&reportFormat, "format", "html", "Report format: 'html' (written to --output) or 'text' (summary printed to stdout)")
+	cmd.Flags().StringVar(&graphFormat, "graph-format", "mermaid", "Graph output format: mermaid (HTML report) or json (graph nodes and edges only)")
+	cmd.Flags().StringVar(&graphDirection, "graph-direction", "TD", "Network graph layout: TD (top-down) or LR (left-right)")
+	cmd.Flags().StringVar(&graphDetail, "graph-detail", graph.DetailApp, "Network graph nodes: 'app' (one node per app label) or 'pod' (one node per pod, with its labels and workload as metadata)")
+	cmd.Flags().BoolVar(&graphObservedDirection, "graph-observed-direction", false, "Draw reply flows from server to client as observed, dotted, instead of adding them to the client's edge; for debugging reply detection")
+	cmd.Flags().BoolVar(&graphFlat, "graph-flat", false, "Draw the network graph without grouping pods into namespace subgraphs")
+	cmd.Flags().IntVar(&maxNodes, "max-nodes", graph.DefaultMaxNodes, "Maximum nodes in the network graph; larger graphs show the most connected nodes")
+	cmd.Flags().IntVar(&maxEdges, "max-edges", graph.DefaultMaxEdges, "Maximum edges in the network graph; larger graphs show the edges with the most flows")
+	cmd.Flags().StringSliceVar(&ignoreLabelPrefixes, "ignore-label-prefix", nil, "Also leave labels with these key prefixes out of the graph and synthesized policies, e.g. version")
+	cmd.Flags().BoolVar(&rawLabels, "raw-labels", false, "Show endpoints in the graph with all their labels, including Cilium policy/namespace labels and per-pod hashes")
+	cmd.Flags().StringVar(&since, "since", "", "Only use flows observed at or after this time: RFC3339 or a duration before now, e.g. 1h")
+	cmd.Flags().StringVar(&until, "until", "", "Only use flows observed at or before this time: RFC3339 or a duration before now, e.g. 10m")
+	cmd.Flags().BoolVar(&requireTimestamp, "require-timestamp", false, "Drop flows without a timestamp instead of keeping them")
+	cmd.Flags().BoolVar(&anonymize, "anonymize", false, "Replace namespaces, pod and workload names, IPs, DNS names and the values of --redact-keys labels with stable pseudonyms, to share the report")
+	cmd.Flags().StringSliceVar(&redactKeys, "redact-keys", explain.DefaultRedactKeys, "Label keys whose values --anonymize replaces (without the k8s: source); other labels are kept")
 
 	return cmd
 }
+
+func cmdSimulate() *cobra.Command {
+	var flowsFiles []string
+	var policiesFile string
+	var threshold float64
+	var format string
+	var detectReplies bool
+	var trace bool
+
+	cmd := &cobra.Command{
+		Use:   "simulate",
+		Short: "Replay flows against policies and report the flows they deny",
+		Long:  "Replay captured flows against CiliumNetworkPolicies to confirm the policies allow\nall observed traffic. Each flow is matched against the ingress rules of the\npolicies selecting its destination and the egress rules of those selecting its\nsource. Exits non-zero when coverage is below --threshold.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(flowsFiles) == 0 {
+				flowsFiles = []string{"out/flows.json"}
+			}
+			if policiesFile == "" {
+				policiesFile = "out/policy.yaml"
+			}
+			if threshold < 0 || threshold > 100 {
+				return fmt.Errorf("invalid --threshold %g: must be between 0 and 100", threshold)
+			}
+			if format != "text" && format != "json" {
+				return fmt.Errorf("invalid format '%s': must be 'text' or 'json'", format)
+			}
+			if err := validate.FilePath(policiesFile); err != nil {
+				return fmt.Errorf("invalid policy file: %w", err)
+			}
+			flowsPaths, err := expandFlowsInputs(flowsFiles)
+			if err != nil {
+				return fmt.Errorf("invalid flows file: %w", err)
+			}
+
+			// With --format json, stdout carries only the result
+			progress := os.Stdout
+			if format == "json" {
+				progress = os.Stderr
+			}
+
+			fmt.Fprintf(progress, "Reading flows from %s...\n", flowsSources(flowsPaths))
+			collection, err := readFlowsInputs(flowsPaths)
+			if err != nil {
+				return fmt.Errorf("failed to read flows: %w", err)
+			}
+			if err := hubble.ValidateSchema(collection); err != nil {
+				return fmt.Errorf("invalid flows file: %w", err)
+			}
+			parsedFlows, err := hubble.ParseFlows(collection)
+			if err != nil {
+				return fmt.Errorf("failed to parse flows: %w", err)
+			}
+			if detectReplies {
+				hubble.DetectReplies(parsedFlows)
+			}
+			// Flows are replayed as captured, not deduplicated, so the
+			// simulator does not share a blind spot of the fingerprint
+
+			policies, err := synth.ParsePoliciesFromFile(policiesFile)
+			if err != nil {
+				return fmt.Errorf("failed to read policies: %w", err)
+			}
+
+			fmt.Fprintf(progress, "Replaying %d flows against %d policies from %s...\n", len(parsedFlows), len(policies), policiesFile)
+			result := sim.Simulate(policies, parsedFlows)
+
+			if format == "json" {
+				data, err := json.MarshalIndent(struct {
+					*sim.Result
+					Coverage float64 `json:"coverage"`
+				}{result, result.Coverage()}, "", "  ")
+				if err != nil {
+					return fmt.Errorf("failed to marshal simulation result: %w", err)
+				}
+				fmt.Println(string(data))
+			} else {
+				printSimulation(result, trace)
+			}
+
+			// Exit with error so CI can gate on gaps in the policies
+			if result.Coverage() < threshold {
+				cmd.SilenceUsage = true
+				return fmt.Errorf("coverage %.1f%% is below --threshold %g%%", result.Coverage(), threshold)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringArrayVarP(&flowsFiles, "flows", "f", nil, "Input flows JSON file or glob, or - for stdin; repeat to merge several captures (default: out/flows.json)")
+	cmd.Flags().StringVarP(&policiesFile, "policies", "p", "", "Input policies YAML file (default: out/policy.yaml)")
+	cmd.Flags().Float64Var(&threshold, "threshold", 100, "Exit non-zero if the policies allow less than this percentage of the flows")
+	cmd.Flags().StringVar(&format, "format", "text", "Output format: 'text' or 'json'")
+	cmd.Flags().BoolVar(&detectReplies, "detect-replies", true, "Skip flows Hubble did not mark is_reply that answer a SYN or mirror an observed flow from a lower port, as for propose")
+	cmd.Flags().BoolVar(&trace, "trace", false, "Also list the allowed flows with the policy rules allowing them")
+
+	return cmd
+}
+
+func cmdConvert() *cobra.Command {
+	var inputFile string
+	var outputFile string
+	var from string
+	var to string
+
+	cmd := &cobra.Command{
+		Use:   "convert",
+		Short: "Convert policies between Cilium and Kubernetes formats",
+		Long:  "Convert CiliumNetworkPolicies (cnp) to Kubernetes NetworkPolicies (knp) or back.\nConstructs the target format cannot express are dropped with a warning; a dropped peer never widens a rule.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// Set default output file if not provided
+			if outputFile == "" {
+				outputFile = "out/converted.yaml"
+			}
+
+			if inputFile == "" {
+				return fmt.Errorf("--input is required")
+			}
+			if err := validate.FilePath(inputFile); err != nil {
+				return fmt.Errorf("invalid input file: %w", err)
+			}
+			if err := validate.OutputPath(outputFile); err != nil {
+				return fmt.Errorf("invalid output path: %w", err)
+			}
+			if err := validate.FileExtension(outputFile, ".yaml"); err != nil {
+				// Also accept .yml extension
+				if err2 := validate.FileExtension(outputFile, ".yml"); err2 != nil {
+					return fmt.Errorf("output file must be YAML (.yaml or .yml): %w", err)
+				}
+			}
+
+			for _, format := range []string{from, to} {
+				if format != "cnp" && format != "knp" {
+					return fmt.Errorf("invalid format '%s': must be 'cnp' or 'knp'", format)
+				}
+			}
+			if from == to {
+				return fmt.Errorf("--from and --to must differ")
+			}
+
+			fmt.Printf("Reading policies from %s...\n", inputFile)
+			var warnings []string
+			var count int
+
+			if from == "cnp" {
+				policies, err := synth.ParsePoliciesFromFile(inputFile)
+				if err != nil {
+					return fmt.Errorf("failed to read policies: %w", err)
+				}
+				networkPolicies := make([]*synth.NetworkPolicy, 0, len(policies))
+				for _, policy := range policies {
+					np, policyWarnings := synth.ConvertToNetworkPolicyWithWarnings(policy)
+					networkPolicies = append(networkPolicies, np)
+					warnings = append(warnings, qualifyWarnings(policy.Metadata, policyWarnings)...)
+				}
+				if err := synth.WriteNetworkPoliciesToFile(networkPolicies, outputFile); err != nil {
+					return fmt.Errorf("failed to write policies: %w", err)
+				}
+				count = len(networkPolicies)
+			} else {
+				networkPolicies, err := synth.ParseNetworkPoliciesFromFile(inputFile)
+				if err != nil {
+					return fmt.Errorf("failed to read policies: %w", err)
+				}
+				policies := make([]*synth.Policy, 0, len(networkPolicies))
+				for _, np := range networkPolicies {
+					policy, policyWarnings := synth.ConvertFromNetworkPolicy(np)
+					policies = append(policies, policy)
+					warnings = append(warnings, qualifyWarnings(np.Metadata, policyWarnings)...)
+				}
+				if err := synth.WritePoliciesToFile(policies, outputFile); err != nil {
+					return fmt.Errorf("failed to write policies: %w", err)
+				}
+				count = len(policies)
+			}
+
+			for _, warning := range warnings {
+				fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+			}
+			fmt.Printf("Converted %d policies from %s to %s (%d warnings)\n", count, from, to, len(warnings))
+			fmt.Printf("Policies saved to %s\n", outputFile)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&inputFile, "input", "i", "", "Input policy YAML file")
+	cmd.Flags().StringVarP(&outputFile, "output", "o", "", "Output policy YAML file (default: out/converted.yaml)")
+	cmd.Flags().StringVar(&from, "from", "cnp", "Input format: cnp (CiliumNetworkPolicy/CiliumClusterwideNetworkPolicy) or knp (Kubernetes NetworkPolicy)")
+	cmd.Flags().StringVar(&to, "to", "knp", "Output format: cnp or knp")
+
+	return cmd
+}
+
+func cmdDiff() *cobra.Command {
+	var oldFile string
+	var newFile string
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "diff",
+		Short: "Compare two policy sets and report changed access",
+		Long:  "Compare an approved policy set (--old) with a newly generated one (--new).\nPolicies are matched by kind, namespace, name and endpoint selector, and each\nadded or removed source, destination and port is reported.\nExits non-zero when the policy sets differ.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// Set default new file if not provided
+			if newFile == "" {
+				newFile = "out/policy.yaml"
+			}
+
+			if oldFile == "" {
+				return fmt.Errorf("--old is required")
+			}
+			for _, file := range []string{oldFile, newFile} {
+				if err := validate.FilePath(file); err != nil {
+					return fmt.Errorf("invalid policy file: %w", err)
+				}
+			}
+			if format != "text" && format != "json" {
+				return fmt.Errorf("invalid format '%s': must be 'text' or 'json'", format)
+			}
+
+			oldPolicies, err := synth.ParsePoliciesFromFile(oldFile)
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %w", oldFile, err)
+			}
+			newPolicies, err := synth.ParsePoliciesFromFile(newFile)
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %w", newFile, err)
+			}
+
+			diff := synth.DiffPolicies(oldPolicies, newPolicies)
+
+			if format == "json" {
+				data, err := json.MarshalIndent(diff, "", "  ")
+				if err != nil {
+					return fmt.Errorf("failed to marshal diff: %w", err)
+				}
+				fmt.Println(string(data))
+			} else {
+				printPolicyDiff(diff, oldFile, newFile)
+			}
+
+			// Exit with error so CI can gate on new access
+			if !diff.Empty() {
+				cmd.SilenceUsage = true
+				added, removed, modified := diff.Counts()
+				return fmt.Errorf("policies differ: %d added, %d removed, %d modified", added, removed, modified)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&oldFile, "old", "", "Approved policy YAML file to compare against")
+	cmd.Flags().StringVar(&newFile, "new", "", "Policy YAML file to check (default: out/policy.yaml)")
+	cmd.Flags().StringVar(&format, "format", "text", "Output format: 'text' or 'json'")
+
+	return cmd
+}
+
+func cmdApply() *cobra.Command {
+	var policyFile string
+	var dryRun bool
+	var confirm bool
+	var opts apply.Options
+
+	cmd := &cobra.Command{
+		Use:   "apply",
+		Short: "Apply policies with kubectl, or check them with a server-side dry run",
+		Long:  "Run kubectl apply on each document in the policy file and report the result per policy.\nWith --dry-run the API server validates the policies without persisting them.\nWithout --dry-run, --confirm is required to change the cluster.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// Set default policy file if not provided
+			if policyFile == "" {
+				policyFile = "out/policy.yaml"
+			}
+
+			if err := validate.FilePath(policyFile); err != nil {
+				return fmt.Errorf("invalid policy file: %w", err)
+			}
+			if dryRun && confirm {
+				return fmt.Errorf("--dry-run and --confirm cannot be used together")
+			}
+			if !dryRun && !confirm {
+				return fmt.Errorf("refusing to change the cluster without --confirm; use --dry-run to only validate the policies")
+			}
+			opts.DryRun = dryRun
+
+			mode := "Applying"
+			if dryRun {
+				mode = "Validating (server-side dry run)"
+			}
+			if opts.Context != "" {
+				fmt.Printf("%s policies from %s in context %s...\n", mode, policyFile, opts.Context)
+			} else {
+				fmt.Printf("%s policies from %s...\n", mode, policyFile)
+			}
+
+			results, err := apply.ApplyFile(cmd.Context(), policyFile, opts)
+			if err != nil {
+				return fmt.Errorf("apply failed: %w", err)
+			}
+
+			failed := 0
+			for _, result := range results {
+				name := result.Name
+				if result.Namespace != "" {
+					name = result.Namespace + "/" + name
+				}
+				if result.Succeeded() {
+					fmt.Printf("  ✓ document %d: %s/%s\n", result.Document, result.Kind, name)
+					continue
+				}
+				failed++
+				fmt.Printf("  ✗ document %d: %s/%s: %v\n", result.Document, result.Kind, name, result.Err)
+				for _, line := range strings.Split(result.Output, "\n") {
+					if line != "" {
+						fmt.Printf("      %s\n", line)
+					}
+				}
+			}
+
+			if failed > 0 {
+				cmd.SilenceUsage = true
+				return fmt.Errorf("%d of %d policies were rejected", failed, len(results))
+			}
+			fmt.Printf("\n✓ All %d policies accepted\n", len(results))
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&policyFile, "input", "i", "", "Input policy YAML file (default: out/policy.yaml)")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Validate the policies with kubectl apply --dry-run=server without persisting them")
+	cmd.Flags().BoolVar(&confirm, "confirm", false, "Apply the policies to the cluster (required without --dry-run)")
+	cmd.Flags().StringVar(&opts.Context, "context", "", "kubeconfig context passed to kubectl (default: current context)")
+	cmd.Flags().StringVar(&opts.Kubectl, "kubectl", "kubectl", "kubectl binary to run")
+
+	return cmd
+}
+
+// printSimulation prints the coverage and uncovered flows of a simulation
+func printSimulation(result *sim.Result, trace bool) {
+	fmt.Printf("\nCoverage: %.1f%% (%d of %d flows allowed", result.Coverage(), result.Allowed, result.Flows)
+	if result.Replies > 0 {
+		fmt.Printf(", %d replies skipped", result.Replies)
+	}
+	fmt.Println(")")
+
+	if trace && len(result.Covered) > 0 {
+		fmt.Println("\nCovered flows:")
+		for _, flow := range result.Covered {
+			allowedBy := "no policy selects either endpoint"
+			if len(flow.AllowedBy) > 0 {
+				rules := make([]string, 0, len(flow.AllowedBy))
+				for _, match := range flow.AllowedBy {
+					rules = append(rules, match.String())
+				}
+				allowedBy = "allowed by " + strings.Join(rules, ", ")
+			}
+			fmt.Printf("  - %s -> %s %s (%d flows): %s\n", flow.Source, flow.Destination, flow.Traffic, flow.Flows, allowedBy)
+		}
+	}
+
+	if len(result.Uncovered) == 0 {
+		fmt.Println("\n✓ The policies allow every flow")
+		return
+	}
+	fmt.Println("\nUncovered flows:")
+	for _, flow := range result.Uncovered {
+		fmt.Printf("  - %s %s -> %s %s (%d flows): denied by %s\n", flow.Direction, flow.Source, flow.Destination, flow.Traffic, flow.Flows, strings.Join(flow.Policies, ", "))
+	}
+}
+
+// printPolicyDiff prints a diff with + for added and - for removed access
+func printPolicyDiff(diff *synth.PolicyDiff, oldFile, newFile string) {
+	fmt.Printf("Comparing %s -> %s\n", oldFile, newFile)
+	if diff.Empty() {
+		fmt.Printf("\n✓ No differences found (%d policies unchanged)\n", diff.Unchanged)
+		return
+	}
+
+	markers := map[string]string{
+		synth.ChangeAdded:    "+",
+		synth.ChangeRemoved:  "-",
+		synth.ChangeModified: "~",
+	}
+	for _, change := range diff.Changes {
+		name := change.Name
+		if change.Namespace != "" {
+			name = change.Namespace + "/" + name
+		}
+		fmt.Printf("\n%s %s/%s (%s)\n", markers[change.Change], change.Kind, name, change.Change)
+		fmt.Printf("    Selector: %s\n", change.Selector)
+		for _, access := range change.Added {
+			fmt.Printf("    + %s\n", access)
+		}
+		for _, access := range change.Removed {
+			fmt.Printf("    - %s\n", access)
+		}
+	}
+
+	added, removed, modified := diff.Counts()
+	fmt.Printf("\nSummary: %d added, %d removed, %d modified, %d unchanged policies\n", added, removed, modified, diff.Unchanged)
+}
+
+// qualifyWarnings prefixes conversion warnings with the policy they refer to
+func qualifyWarnings(metadata synth.PolicyMetadata, warnings []string) []string {
+	name := metadata.Name
+	if metadata.Namespace != "" {
+		name = metadata.Namespace + "/" + name
+	}
+
+	qualified := make([]string, 0, len(warnings))
+	for _, warning := range warnings {
+		qualified = append(qualified, fmt.Sprintf("%s: %s", name, warning))
+	}
+	return qualified
+}
+
+// validateFlowsInput checks a flows input path, accepting "-" for stdin
+func validateFlowsInput(path string) error {
+	if path == hubble.StdinPath {
+		return nil
+	}
+	if err := validate.FilePath(path); err != nil {
+		return err
+	}
+	if err := validate.FileExtensionOrGzip(path, ".json"); err != nil {
+		return fmt.Errorf("must be JSON: %w", err)
+	}
+	return nil
+}
+
+// flowsSource names a flows input path in progress messages
+func flowsSource(path string) string {
+	if path == hubble.StdinPath {
+		return "stdin"
+	}
+	return path
+}
+
+// flowsSources names flows input paths in progress messages
+func flowsSources(paths []string) string {
+	names := make([]string, len(paths))
+	for i, path := range paths {
+		names[i] = flowsSource(path)
+	}
+	return strings.Join(names, ", ")
+}
+
+// expandFlowsInputs expands glob patterns in flows input paths, e.g.
+// captures/*.json, and validates each file. "-" reads stdin and must be the
+// only input.
+func expandFlowsInputs(patterns []string) ([]string, error) {
+	var paths []string
+	for _, pattern := range patterns {
+		if pattern == hubble.StdinPath {
+			if len(patterns) > 1 {
+				return nil, fmt.Errorf("- (stdin) cannot be combined with other input files")
+			}
+			return patterns, nil
+		}
+		if !strings.ContainsAny(pattern, "*?[") {
+			paths = append(paths, pattern)
+			continue
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %s: %w", pattern, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no files match %s", pattern)
+		}
+		paths = append(paths, matches...)
+	}
+
+	for _, path := range paths {
+		if err := validateFlowsInput(path); err != nil {
+			if len(paths) > 1 {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			return nil, err
+		}
+	}
+	return paths, nil
+}
+
+// readFlowsInputs reads flows files into one collection, as they were
+// captured, e.g. per namespace or per hour, into separate files
+func readFlowsInputs(paths []string) (*hubble.FlowCollection, error) {
+	collections := make([]*hubble.FlowCollection, 0, len(paths))
+	for _, path := range paths {
+		collection, err := hubble.ReadFlowsFromFile(path)
+		if err == nil && len(paths) > 1 {
+			// Migrate each file, so files in older schemas merge with newer ones
+			err = hubble.ValidateSchema(collection)
+		}
+		if err != nil {
+			if len(paths) > 1 {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			return nil, err
+		}
+		collections = append(collections, collection)
+	}
+	return hubble.MergeCollections(collections...)
+}
+
+// readFlowsFiles is like readFlowsInputs, reporting each file's format. If
+// dedupe is set, the files are streamed, keeping one copy of each distinct
+// flow across all of them.
+func readFlowsFiles(paths []string, dedupe bool) (*hubble.FlowCollection, error) {
+	if len(paths) == 1 {
+		return readFlowsFile(paths[0], dedupe)
+	}
+	if dedupe {
+		collection, dedup, err := hubble.ReadUniqueFlowsFromFiles(paths...)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Printf("Streamed %d flows from %d files, %d unique\n", dedup.Total(), len(paths), dedup.Unique())
+		return collection, nil
+	}
+
+	collections := make([]*hubble.FlowCollection, 0, len(paths))
+	for _, path := range paths {
+		collection, format, err := hubble.ReadFlowsFromFileWithFormat(path)
+		if err == nil {
+			err = hubble.ValidateSchema(collection)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		fmt.Printf("Detected input format of %s: %s\n", path, format)
+		collections = append(collections, collection)
+	}
+	return hubble.MergeCollections(collections...)
+}
+
+// readFlowsFile reads a flows file, optionally streaming it and collapsing
+// duplicate flows on the fly
+func readFlowsFile(path string, dedupe bool) (*hubble.FlowCollection, error) {
+	if !dedupe {
+		collection, format, err := hubble.ReadFlowsFromFileWithFormat(path)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Printf("Detected input format: %s\n", format)
+		return collection, nil
+	}
+
+	collection, dedup, err := hubble.ReadUniqueFlowsFromFile(path)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("Streamed %d flows, %d unique\n", dedup.Total(), dedup.Unique())
+	return collection, nil
+}
+
+// printFileResults prints the per-file summary of verifying a directory
+func printFileResults(files []verify.FileResult) {
+	fmt.Printf("\n  Files:\n")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, file := range files {
+		status := "✓"
+		if !file.Valid {
+			status = "✗"
+		}
+		fmt.Fprintf(w, "    %s %s\t%d policies\t%d errors\t%d warnings\n", status, file.Path, file.Policies, file.Errors, file.Warnings)
+	}
+	w.Flush()
+}
+
+// reproposePolicies synthesizes policies from the flows accumulated by
+// learn --watch with propose's default settings and writes them to path.
+// Flows yielding no policy yet leave path unchanged.
+func reproposePolicies(collection *hubble.FlowCollection, path string) error {
+	parsedFlows, err := hubble.ParseFlows(collection)
+	if err != nil {
+		return fmt.Errorf("failed to parse flows: %w", err)
+	}
+	hubble.DetectReplies(parsedFlows)
+	policies, err := synth.SynthesizePoliciesWithOptions(hubble.DeduplicateFlows(parsedFlows), synth.Options{})
+	if err != nil {
+		return fmt.Errorf("failed to synthesize policies: %w", err)
+	}
+	if len(policies) == 0 {
+		return nil
+	}
+	if err := synth.WritePoliciesToFile(policies, path); err != nil {
+		return fmt.Errorf("failed to write policies: %w", err)
+	}
+	fmt.Printf("Re-proposed %d policy(ies) to %s\n", len(policies), path)
+	return nil
+}
+
+// printFlowStats prints the capture summary shown by learn
+func printFlowStats(stats *hubble.Stats) {
+	verdicts := make([]string, 0, len(stats.Verdicts))
+	for verdict := range stats.Verdicts {
+		verdicts = append(verdicts, verdict)
+	}
+	slices.Sort(verdicts)
+	for i, verdict := range verdicts {
+		verdicts[i] = fmt.Sprintf("%s %d", verdict, stats.Verdicts[verdict])
+	}
+
+	fmt.Printf("  Verdicts:   %d allowed, %d denied", stats.Allowed, stats.Denied)
+	if len(verdicts) > 0 {
+		fmt.Printf(" (%s)", strings.Join(verdicts, ", "))
+	}
+	fmt.Println()
+	fmt.Printf("  Endpoints:  %d sources, %d destinations\n", stats.Sources, stats.Destinations)
+	fmt.Printf("  Namespaces: %d", len(stats.Namespaces))
+	if len(stats.Namespaces) > 0 {
+		fmt.Printf(" (%s)", strings.Join(stats.Namespaces, ", "))
+	}
+	fmt.Println()
+	if len(stats.TopTalkers) > 0 {
+		fmt.Println("  Top talkers:")
+		for _, talker := range stats.TopTalkers {
+			fmt.Printf("    %-40s %d flows\n", talker.Endpoint, talker.Flows)
+		}
+	}
+}
+
+// ruleReviewer asks on the terminal whether to keep each proposed rule, for
+// propose --interactive
+type ruleReviewer struct {
+	in *bufio.Reader
+	// out receives the prompts
+	out io.Writer
+	// answer, once set by "a" or "q", applies to every remaining rule
+	answer   *bool
+	reviewed int
+	approved int
+}
+
+// review prompts for one rule; end of input rejects it and every remaining rule
+func (r *ruleReviewer) review(rule synth.ProposedRule) (bool, error) {
+	r.reviewed++
+	approved, err := r.ask(rule)
+	if approved {
+		r.approved++
+	}
+	return approved, err
+}
+
+func (r *ruleReviewer) ask(rule synth.ProposedRule) (bool, error) {
+	if r.answer != nil {
+		return *r.answer, nil
+	}
+
+	for {
+		fmt.Fprintf(r.out, "allow %s → %s : %s? [y/N/a/q] ", strings.Join(rule.Sources, ", "), rule.Destination, strings.Join(rule.Traffic, ", "))
+		line, err := r.in.ReadString('\n')
+		if err == io.EOF && line == "" {
+			fmt.Fprintln(r.out)
+			answer := false
+			r.answer = &answer
+			return false, nil
+		} else if err != nil && err != io.EOF {
+			return false, fmt.Errorf("failed to read answer: %w", err)
+		}
+
+		switch strings.ToLower(strings.TrimSpace(line)) {
+		case "y", "yes":
+			return true, nil
+		case "", "n", "no":
+			return false, nil
+		case "a", "all":
+			answer := true
+			r.answer = &answer
+			return true, nil
+		case "q", "quit":
+			answer := false
+			r.answer = &answer
+			return false, nil
+		default:
+			fmt.Fprintln(r.out, "y - keep this rule, n - drop it, a - keep it and all remaining rules, q - drop it and all remaining rules")
+		}
+	}
+}
+
+// isTerminal reports whether f is a character device such as a terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// printFlowList prints flow summaries as a table, truncated to limit rows
+// unless limit is 0
+func printFlowList(summaries []hubble.FlowSummary, limit int) {
+	omitted := 0
+	if limit > 0 && len(summaries) > limit {
+		omitted = len(summaries) - limit
+		summaries = summaries[:limit]
+	}
+
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  SOURCE\t\tDESTINATION\tTRAFFIC\tVERDICT\tFLOWS")
+	for _, summary := range summaries {
+		verdict := summary.Verdict
+		if verdict == "" {
+			verdict = "-"
+		}
+		fmt.Fprintf(w, "  %s\t→\t%s\t%s\t%s\t%d\n", summary.Source, summary.Destination, summary.Traffic, verdict, summary.Flows)
+	}
+	w.Flush()
+	if omitted > 0 {
+		fmt.Printf("  ... %d more distinct flows omitted (raise --limit, or 0 for all)\n", omitted)
+	}
+	fmt.Println()
+}
+
+// parseLabelPrefixes validates the --ignore-label-prefix flag; an empty
+// prefix would match every label
+func parseLabelPrefixes(values []string) ([]string, error) {
+	var prefixes []string
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			return nil, fmt.Errorf("invalid --ignore-label-prefix: empty prefix")
+		}
+		prefixes = append(prefixes, value)
+	}
+	return prefixes, nil
+}
+
+// parseTimeFilter builds the flow time window from the --since and --until flags
+func parseTimeFilter(since, until string, requireTimestamp bool) (hubble.TimeFilter, error) {
+	filter := hubble.TimeFilter{RequireTimestamp: requireTimestamp}
+	now := time.Now()
+
+	var err error
+	if since != "" {
+		if filter.Since, err = hubble.ParseTimeBound(since, now); err != nil {
+			return filter, fmt.Errorf("invalid --since: %w", err)
+		}
+	}
+	if until != "" {
+		if filter.Until, err = hubble.ParseTimeBound(until, now); err != nil {
+			return filter, fmt.Errorf("invalid --until: %w", err)
+		}
+	}
+	if !filter.Since.IsZero() && !filter.Until.IsZero() && filter.Until.Before(filter.Since) {
+		return filter, fmt.Errorf("--until (%s) is before --since (%s)", filter.Until.Format(time.RFC3339), filter.Since.Format(time.RFC3339))
+	}
+
+	return filter, nil
+}
+
+// filterFlowsByTime applies a time window to parsed flows, reporting how
+// many were kept on progress
+func filterFlowsByTime(flows []*hubble.ParsedFlow, filter hubble.TimeFilter, progress io.Writer) ([]*hubble.ParsedFlow, error) {
+	if filter.IsZero() {
+		return flows, nil
+	}
+
+	filtered := hubble.FilterFlowsByTime(flows, filter)
+	if len(filtered) == 0 {
+		return nil, fmt.Errorf("no flows found in the --since/--until window")
+	}
+	fmt.Fprintf(progress, "Filtered to %d of %d flows by time\n", len(filtered), len(flows))
+	return filtered, nil
+}
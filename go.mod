@@ -3,11 +3,18 @@ module github.com/prabhakaran-jm/cilium-policypilot
 go 1.23.5
 
 require (
+	github.com/cilium/cilium v1.16.5
 	github.com/spf13/cobra v1.10.1
+	github.com/spf13/pflag v1.0.9
+	google.golang.org/grpc v1.68.1
+	google.golang.org/protobuf v1.35.2
 	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
-	github.com/spf13/pflag v1.0.9 // indirect
+	golang.org/x/net v0.29.0 // indirect
+	golang.org/x/sys v0.28.0 // indirect
+	golang.org/x/text v0.21.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20241206012308-a4fef0638583 // indirect
 )
@@ -0,0 +1,141 @@
+package apply
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/prabhakaran-jm/cilium-policypilot/internal/validate"
+	"gopkg.in/yaml.v3"
+)
+
+// Runner runs kubectl with the given arguments, feeding stdin to it, and
+// returns what it wrote to stdout and stderr
+type Runner func(ctx context.Context, args []string, stdin []byte) (stdout, stderr []byte, err error)
+
+// Options configures how policies are applied
+type Options struct {
+	// Kubectl is the kubectl binary to run (default: "kubectl" on PATH)
+	Kubectl string
+
+	// Context is passed to kubectl as --context, if set
+	Context string
+
+	// DryRun asks the API server to validate each document without
+	// persisting it (kubectl apply --dry-run=server)
+	DryRun bool
+
+	// Runner replaces the kubectl invocation, e.g. in tests
+	Runner Runner
+}
+
+// DocumentResult is the outcome of applying one YAML document
+type DocumentResult struct {
+	// Document is the 1-based position of the document in the file
+	Document  int
+	Kind      string
+	Name      string
+	Namespace string
+	// Output is kubectl's combined stdout and stderr, trimmed
+	Output string
+	// Err is non-nil if kubectl rejected the document
+	Err error
+}
+
+// Succeeded reports whether kubectl accepted the document
+func (r DocumentResult) Succeeded() bool {
+	return r.Err == nil
+}
+
+// ApplyFile runs kubectl apply once per document in filePath so each
+// policy's result is attributed individually. Comment-only documents are
+// skipped. An error is returned only if the file cannot be read or kubectl
+// cannot be found; kubectl failures are reported in the results.
+func ApplyFile(ctx context.Context, filePath string, opts Options) ([]DocumentResult, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %w", err)
+	}
+
+	run := opts.Runner
+	if run == nil {
+		kubectl := opts.Kubectl
+		if kubectl == "" {
+			kubectl = "kubectl"
+		}
+		path, err := exec.LookPath(kubectl)
+		if err != nil {
+			return nil, fmt.Errorf("kubectl not found: %w", err)
+		}
+		run = kubectlRunner(path)
+	}
+
+	args := []string{"apply"}
+	if opts.Context != "" {
+		args = append(args, "--context", opts.Context)
+	}
+	if opts.DryRun {
+		args = append(args, "--dry-run=server")
+	}
+	args = append(args, "-f", "-")
+
+	results := make([]DocumentResult, 0)
+	for i, doc := range validate.SplitYAMLDocuments(string(data)) {
+		if isCommentOnly(doc) {
+			continue
+		}
+
+		var meta struct {
+			Kind     string `yaml:"kind"`
+			Metadata struct {
+				Name      string `yaml:"name"`
+				Namespace string `yaml:"namespace"`
+			} `yaml:"metadata"`
+		}
+		// Documents that fail to parse are still sent so kubectl reports why
+		_ = yaml.Unmarshal([]byte(doc), &meta)
+
+		stdout, stderr, err := run(ctx, args, []byte(doc))
+		results = append(results, DocumentResult{
+			Document:  i + 1,
+			Kind:      meta.Kind,
+			Name:      meta.Metadata.Name,
+			Namespace: meta.Metadata.Namespace,
+			Output:    strings.TrimSpace(string(stdout) + string(stderr)),
+			Err:       err,
+		})
+	}
+
+	if len(results) == 0 {
+		return nil, fmt.Errorf("no documents found in %s", filePath)
+	}
+
+	return results, nil
+}
+
+// isCommentOnly reports whether a document is empty or only has comments
+func isCommentOnly(doc string) bool {
+	for _, line := range strings.Split(doc, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			return false
+		}
+	}
+	return true
+}
+
+// kubectlRunner returns a Runner that executes the kubectl binary
+func kubectlRunner(kubectl string) Runner {
+	return func(ctx context.Context, args []string, stdin []byte) ([]byte, []byte, error) {
+		var stdout, stderr bytes.Buffer
+		cmd := exec.CommandContext(ctx, kubectl, args...)
+		cmd.Stdin = bytes.NewReader(stdin)
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		err := cmd.Run()
+		return stdout.Bytes(), stderr.Bytes(), err
+	}
+}
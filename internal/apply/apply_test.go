@@ -0,0 +1,114 @@
+package apply
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const policies = `# Generated policies
+---
+apiVersion: cilium.io/v2
+kind: CiliumNetworkPolicy
+metadata:
+  name: catalog-policy
+  namespace: shop
+spec:
+  endpointSelector:
+    matchLabels:
+      k8s:app: catalog
+---
+apiVersion: cilium.io/v2
+kind: CiliumNetworkPolicy
+metadata:
+  name: cart-policy
+  namespace: shop
+spec:
+  endpointSelector:
+    matchLabels:
+      k8s:app: cart
+`
+
+func TestApplyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(path, []byte(policies), 0644); err != nil {
+		t.Fatalf("Failed to write policy file: %v", err)
+	}
+
+	var calls [][]string
+	runner := func(ctx context.Context, args []string, stdin []byte) ([]byte, []byte, error) {
+		calls = append(calls, args)
+		if strings.Contains(string(stdin), "cart-policy") {
+			return nil, []byte("Error from server (Invalid): spec.endpointSelector: Invalid value\n"), errors.New("exit status 1")
+		}
+		return []byte("ciliumnetworkpolicy.cilium.io/catalog-policy created (server dry run)\n"), nil, nil
+	}
+
+	tests := []struct {
+		name     string
+		opts     Options
+		wantArgs []string
+	}{
+		{
+			name:     "dry run",
+			opts:     Options{DryRun: true, Runner: runner},
+			wantArgs: []string{"apply", "--dry-run=server", "-f", "-"},
+		},
+		{
+			name:     "context",
+			opts:     Options{Context: "staging", Runner: runner},
+			wantArgs: []string{"apply", "--context", "staging", "-f", "-"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls = nil
+			results, err := ApplyFile(context.Background(), path, tt.opts)
+			if err != nil {
+				t.Fatalf("ApplyFile() error = %v", err)
+			}
+
+			// The comment-only header document is not sent
+			if len(calls) != 2 {
+				t.Fatalf("Expected kubectl to run once per policy, got %d calls", len(calls))
+			}
+			if !reflect.DeepEqual(calls[0], tt.wantArgs) {
+				t.Errorf("kubectl args = %v, want %v", calls[0], tt.wantArgs)
+			}
+
+			if len(results) != 2 {
+				t.Fatalf("Expected 2 results, got %d", len(results))
+			}
+			catalog, cart := results[0], results[1]
+			if !catalog.Succeeded() || catalog.Name != "catalog-policy" || catalog.Document != 2 {
+				t.Errorf("Unexpected catalog result: %+v", catalog)
+			}
+			if cart.Succeeded() || cart.Name != "cart-policy" || cart.Namespace != "shop" || cart.Document != 3 {
+				t.Errorf("Unexpected cart result: %+v", cart)
+			}
+			if !strings.Contains(cart.Output, "Invalid value") {
+				t.Errorf("Expected kubectl stderr in output, got %q", cart.Output)
+			}
+		})
+	}
+}
+
+func TestApplyFileNoDocuments(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(path, []byte("# nothing here\n---\n"), 0644); err != nil {
+		t.Fatalf("Failed to write policy file: %v", err)
+	}
+
+	runner := func(ctx context.Context, args []string, stdin []byte) ([]byte, []byte, error) {
+		t.Errorf("kubectl should not run")
+		return nil, nil, nil
+	}
+	if _, err := ApplyFile(context.Background(), path, Options{Runner: runner}); err == nil {
+		t.Errorf("Expected error for a file without documents")
+	}
+}
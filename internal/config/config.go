@@ -0,0 +1,146 @@
+// Package config sets command flag defaults from a .cpp.yaml file and CPP_*
+// environment variables
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultFile is the config file looked up in the working directory when no
+// path is given
+const DefaultFile = ".cpp.yaml"
+
+// EnvPrefix starts the environment variable of every flag, e.g.
+// CPP_PROPOSE_MIN_FLOWS for propose --min-flows
+const EnvPrefix = "CPP_"
+
+// File holds flag values by command and flag name, e.g.
+//
+//	propose:
+//	  label-keys: [app, component]
+//	  min-flows: 2
+type File struct {
+	// Path is the file the values were read from
+	Path     string
+	Commands map[string]map[string]interface{}
+}
+
+// Find returns the config file to load: path if set, which must exist,
+// otherwise DefaultFile if it exists in the working directory, otherwise ""
+func Find(path string) (string, error) {
+	if path != "" {
+		if _, err := os.Stat(path); err != nil {
+			return "", fmt.Errorf("config file not found: %w", err)
+		}
+		return path, nil
+	}
+	if _, err := os.Stat(DefaultFile); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to read %s: %w", DefaultFile, err)
+	}
+	return DefaultFile, nil
+}
+
+// Load reads a config file. An empty path gives an empty File.
+func Load(path string) (*File, error) {
+	file := &File{Path: path, Commands: make(map[string]map[string]interface{})}
+	if path == "" {
+		return file, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	if err := yaml.Unmarshal(data, &file.Commands); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	if file.Commands == nil {
+		file.Commands = make(map[string]map[string]interface{})
+	}
+	return file, nil
+}
+
+// Check reports sections of the file naming no command in commands
+func (f *File) Check(commands []string) error {
+	var unknown []string
+	for name := range f.Commands {
+		if !slices.Contains(commands, name) {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("invalid config file %s: unknown commands %s; must be one of %s",
+			f.Path, strings.Join(unknown, ", "), strings.Join(commands, ", "))
+	}
+	return nil
+}
+
+// EnvName returns the environment variable setting a command's flag, e.g.
+// CPP_PROPOSE_MIN_FLOWS
+func EnvName(command, flag string) string {
+	name := strings.ToUpper(command + "_" + flag)
+	return EnvPrefix + strings.NewReplacer("-", "_", ".", "_").Replace(name)
+}
+
+// Apply sets the flags of a command that were not given on the command line
+// from the environment, then from the command's section of the file, so
+// that a flag wins over its environment variable, which wins over the file,
+// which wins over the built-in default. List values in the file are added
+// one item at a time; environment values are parsed like the flag's own.
+// Flags set this way are not marked Changed, so checks for flags given on
+// the command line, e.g. --output-dir requiring --split, ignore them.
+// skip names flags left alone, e.g. help.
+func Apply(command string, flags *pflag.FlagSet, file *File, lookupEnv func(string) (string, bool), skip ...string) error {
+	values := file.Commands[command]
+	for name := range values {
+		if flags.Lookup(name) == nil || slices.Contains(skip, name) {
+			return fmt.Errorf("invalid config file %s: %s has no flag --%s", file.Path, command, name)
+		}
+	}
+
+	var err error
+	flags.VisitAll(func(flag *pflag.Flag) {
+		if err != nil || flag.Changed || slices.Contains(skip, flag.Name) {
+			return
+		}
+
+		defer func() { flag.Changed = false }()
+
+		envName := EnvName(command, flag.Name)
+		if value, ok := lookupEnv(envName); ok {
+			if setErr := flags.Set(flag.Name, value); setErr != nil {
+				err = fmt.Errorf("invalid %s: %w", envName, setErr)
+			}
+			return
+		}
+
+		value, ok := values[flag.Name]
+		if !ok || value == nil {
+			return
+		}
+		items, isList := value.([]interface{})
+		if !isList {
+			items = []interface{}{value}
+		}
+		for _, item := range items {
+			if setErr := flags.Set(flag.Name, fmt.Sprint(item)); setErr != nil {
+				err = fmt.Errorf("invalid config file %s: %s.%s: %w", file.Path, command, flag.Name, setErr)
+				return
+			}
+		}
+	})
+	return err
+}
@@ -0,0 +1,194 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+// proposeFlags returns a flag set like propose's, parsed from args
+func proposeFlags(t *testing.T, args ...string) (*pflag.FlagSet, *int, *[]string, *bool) {
+	t.Helper()
+	flags := pflag.NewFlagSet("propose", pflag.ContinueOnError)
+	minFlows := flags.Int("min-flows", 1, "")
+	labelKeys := flags.StringSlice("label-keys", nil, "")
+	l7 := flags.Bool("l7", false, "")
+	flags.Bool("help", false, "")
+	if err := flags.Parse(args); err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	return flags, minFlows, labelKeys, l7
+}
+
+func TestApplyPrecedence(t *testing.T) {
+	file := &File{Path: ".cpp.yaml", Commands: map[string]map[string]interface{}{
+		"propose": {"min-flows": 3},
+	}}
+	env := map[string]string{"CPP_PROPOSE_MIN_FLOWS": "4"}
+
+	tests := []struct {
+		name     string
+		args     []string
+		env      map[string]string
+		file     *File
+		expected int
+	}{
+		{name: "built-in default", file: &File{}, expected: 1},
+		{name: "file over default", file: file, expected: 3},
+		{name: "env over file", env: env, file: file, expected: 4},
+		{name: "flag over env", args: []string{"--min-flows=5"}, env: env, file: file, expected: 5},
+		{name: "flag set to the default", args: []string{"--min-flows=1"}, env: env, file: file, expected: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags, minFlows, _, _ := proposeFlags(t, tt.args...)
+			lookupEnv := func(name string) (string, bool) {
+				value, ok := tt.env[name]
+				return value, ok
+			}
+			if err := Apply("propose", flags, tt.file, lookupEnv, "help"); err != nil {
+				t.Fatalf("Apply() error = %v", err)
+			}
+			if *minFlows != tt.expected {
+				t.Errorf("--min-flows = %d, want %d", *minFlows, tt.expected)
+			}
+		})
+	}
+}
+
+func TestApplyValues(t *testing.T) {
+	noEnv := func(string) (string, bool) { return "", false }
+
+	// Lists replace the default item by item; other commands' sections are
+	// ignored
+	flags, _, labelKeys, l7 := proposeFlags(t)
+	file := &File{Path: ".cpp.yaml", Commands: map[string]map[string]interface{}{
+		"propose": {"label-keys": []interface{}{"app", "component"}, "l7": true},
+		"explain": {"format": "html"},
+	}}
+	if err := Apply("propose", flags, file, noEnv, "help"); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if !reflect.DeepEqual(*labelKeys, []string{"app", "component"}) || !*l7 {
+		t.Errorf("--label-keys, --l7 = %v, %v, want [app component], true", *labelKeys, *l7)
+	}
+
+	// Environment lists are parsed like the flag
+	flags, _, labelKeys, _ = proposeFlags(t)
+	lookupEnv := func(name string) (string, bool) { return "app,tier", name == "CPP_PROPOSE_LABEL_KEYS" }
+	if err := Apply("propose", flags, &File{}, lookupEnv, "help"); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if !reflect.DeepEqual(*labelKeys, []string{"app", "tier"}) {
+		t.Errorf("--label-keys = %v, want [app tier]", *labelKeys)
+	}
+
+	for _, tt := range []struct {
+		name   string
+		values map[string]interface{}
+		env    string
+		err    string
+	}{
+		{name: "unknown flag", values: map[string]interface{}{"min-flow": 2}, err: "propose has no flag --min-flow"},
+		{name: "skipped flag", values: map[string]interface{}{"help": true}, err: "propose has no flag --help"},
+		{name: "invalid file value", values: map[string]interface{}{"min-flows": "two"}, err: "propose.min-flows"},
+		{name: "invalid env value", env: "two", err: "invalid CPP_PROPOSE_MIN_FLOWS"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			flags, _, _, _ := proposeFlags(t)
+			file := &File{Path: ".cpp.yaml", Commands: map[string]map[string]interface{}{"propose": tt.values}}
+			lookupEnv := func(name string) (string, bool) { return tt.env, tt.env != "" && name == "CPP_PROPOSE_MIN_FLOWS" }
+			err := Apply("propose", flags, file, lookupEnv, "help")
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Apply() error = %v, want one containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestApplyLeavesFlagsUnchanged(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, DefaultFile)
+	if err := os.WriteFile(path, []byte("propose:\n  output-dir: out/policies\n  label-keys: [app]\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	file, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	// --output-dir from the file without --split on the command line
+	flags, minFlows, labelKeys, _ := proposeFlags(t)
+	outputDir := flags.String("output-dir", "", "")
+	flags.Bool("split", false, "")
+	lookupEnv := func(name string) (string, bool) { return "2", name == "CPP_PROPOSE_MIN_FLOWS" }
+	if err := Apply("propose", flags, file, lookupEnv, "help"); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if *outputDir != "out/policies" || *minFlows != 2 || !reflect.DeepEqual(*labelKeys, []string{"app"}) {
+		t.Errorf("--output-dir, --min-flows, --label-keys = %q, %d, %v, want out/policies, 2, [app]", *outputDir, *minFlows, *labelKeys)
+	}
+	for _, name := range []string{"output-dir", "min-flows", "label-keys", "split"} {
+		if flags.Changed(name) {
+			t.Errorf("Expected --%s not to be marked changed", name)
+		}
+	}
+}
+
+func TestFindAndLoad(t *testing.T) {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	// Without a file nothing is loaded
+	path, err := Find("")
+	if err != nil || path != "" {
+		t.Fatalf("Find() = %q, %v, want no file", path, err)
+	}
+	file, err := Load(path)
+	if err != nil || len(file.Commands) != 0 {
+		t.Fatalf("Load() = %+v, %v, want an empty file", file, err)
+	}
+	if _, err := Find(filepath.Join(dir, "missing.yaml")); err == nil {
+		t.Error("Find() with a missing --config succeeded, want an error")
+	}
+
+	content := "propose:\n  min-flows: 2\n  label-keys: [app]\n"
+	if err := os.WriteFile(DefaultFile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if path, err = Find(""); err != nil || path != DefaultFile {
+		t.Fatalf("Find() = %q, %v, want %s", path, err, DefaultFile)
+	}
+	if file, err = Load(path); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	expected := map[string]map[string]interface{}{"propose": {"min-flows": 2, "label-keys": []interface{}{"app"}}}
+	if !reflect.DeepEqual(file.Commands, expected) {
+		t.Errorf("Commands = %v, want %v", file.Commands, expected)
+	}
+
+	if err := file.Check([]string{"learn", "propose"}); err != nil {
+		t.Errorf("Check() error = %v", err)
+	}
+	if err := file.Check([]string{"learn"}); err == nil || !strings.Contains(err.Error(), "unknown commands propose") {
+		t.Errorf("Check() error = %v, want unknown commands propose", err)
+	}
+}
+
+func TestEnvName(t *testing.T) {
+	if got := EnvName("propose", "min-flows"); got != "CPP_PROPOSE_MIN_FLOWS" {
+		t.Errorf("EnvName() = %s, want CPP_PROPOSE_MIN_FLOWS", got)
+	}
+}
@@ -0,0 +1,56 @@
+package explain
+
+import (
+	"fmt"
+
+	"github.com/prabhakaran-jm/cilium-policypilot/internal/hubble"
+	"github.com/prabhakaran-jm/cilium-policypilot/internal/synth"
+)
+
+// Capture quality thresholds below which the report cautions that the
+// capture may be incomplete
+const (
+	// minCompleteRatio is the share of flows that should have complete
+	// metadata
+	minCompleteRatio = 0.9
+	// maxSkippedRatio is the share of flows synthesis may skip
+	maxSkippedRatio = 0.1
+)
+
+// CaptureQuality estimates how complete a capture is, to judge whether to
+// capture longer before trusting the generated policies
+type CaptureQuality struct {
+	hubble.Coverage
+	// SkippedFlows counts flows synthesis derives no rule from for lack of
+	// endpoint or port information. Replies are expected to add no rule and
+	// are not counted.
+	SkippedFlows int
+}
+
+// collectCaptureQuality measures the capture quality of flows
+func collectCaptureQuality(flows []*hubble.ParsedFlow) CaptureQuality {
+	quality := CaptureQuality{Coverage: *hubble.ComputeCoverage(flows)}
+	for _, flow := range flows {
+		if !flow.IsReply && !synth.ContributesRule(flow) {
+			quality.SkippedFlows += flow.Occurrences()
+		}
+	}
+	return quality
+}
+
+// Cautions explains why the capture may be incomplete, or is empty if it
+// looks complete
+func (q *CaptureQuality) Cautions() []string {
+	if q.Flows == 0 {
+		return nil
+	}
+
+	var cautions []string
+	if ratio := q.Ratio(); ratio < minCompleteRatio {
+		cautions = append(cautions, fmt.Sprintf("only %.0f%% of flows have both endpoints identified and an L4 protocol", ratio*100))
+	}
+	if float64(q.SkippedFlows) > maxSkippedRatio*float64(q.Flows) {
+		cautions = append(cautions, fmt.Sprintf("%d of %d flows add no policy rule for lack of endpoint or port information", q.SkippedFlows, q.Flows))
+	}
+	return cautions
+}
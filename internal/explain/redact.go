@@ -0,0 +1,200 @@
+package explain
+
+import (
+	"maps"
+	"net/netip"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/prabhakaran-jm/cilium-policypilot/internal/hubble"
+)
+
+// namespaceLabel is the label Cilium gives every endpoint for its namespace
+const namespaceLabel = "k8s:io.kubernetes.pod.namespace"
+
+// DefaultRedactKeys are the label keys, without their "k8s:" source, whose
+// values a Redactor replaces by default: those that name a workload
+var DefaultRedactKeys = []string{
+	"app",
+	"name",
+	"component",
+	"k8s-app",
+	"app.kubernetes.io/name",
+	"app.kubernetes.io/instance",
+	"app.kubernetes.io/component",
+	"app.kubernetes.io/part-of",
+}
+
+// Redactor replaces the names in flows with pseudonyms, so that a report can
+// be shared without revealing namespaces, pods, workloads, IPs, DNS names or
+// the values of the labels in its keys. Each distinct name maps to one
+// pseudonym, so the graph and the policies keep their shape.
+//
+// Pseudonyms are assigned in the sorted order of the names they replace:
+// the same flows always yield the same output, and unlike hashes they
+// cannot be reversed by guessing likely names.
+type Redactor struct {
+	keys map[string]bool
+}
+
+// NewRedactor creates a Redactor replacing the values of labels with these
+// keys, given without their "k8s:" source (e.g. app)
+func NewRedactor(keys []string) *Redactor {
+	r := &Redactor{keys: make(map[string]bool, len(keys))}
+	for _, key := range keys {
+		r.keys[strings.TrimPrefix(key, "k8s:")] = true
+	}
+	return r
+}
+
+// pseudonyms maps the names of one kind to pseudonyms
+type pseudonyms map[string]string
+
+// add records a name to be given a pseudonym; empty names stay empty
+func (p pseudonyms) add(name string) {
+	if name != "" {
+		p[name] = ""
+	}
+}
+
+// assign gives the recorded names, in sorted order, the pseudonyms returned
+// by format for 0, 1, 2, ...
+func (p pseudonyms) assign(format func(i int) string) {
+	for i, name := range slices.Sorted(maps.Keys(p)) {
+		p[name] = format(i)
+	}
+}
+
+// Redact returns redacted copies of flows; flows itself is left unchanged.
+// Cilium and Kubernetes metadata labels other than the namespace label (see
+// hubble.DefaultIgnoredLabelPrefixes) are dropped, since they repeat names.
+// Labels with other keys are kept as they are. HTTP paths and hosts are
+// cleared.
+func (r *Redactor) Redact(flows []*hubble.ParsedFlow) []*hubble.ParsedFlow {
+	namespaces, pods, workloads := pseudonyms{}, pseudonyms{}, pseudonyms{}
+	ips, dnsNames, values := pseudonyms{}, pseudonyms{}, pseudonyms{}
+	for _, flow := range flows {
+		for _, side := range []struct {
+			namespace, pod, workload, ip string
+			labels                       map[string]string
+		}{
+			{flow.SourceNamespace, flow.SourcePod, flow.SourceWorkload, flow.SourceIP, flow.SourceLabels},
+			{flow.DestNamespace, flow.DestPod, flow.DestWorkload, flow.DestIP, flow.DestLabels},
+		} {
+			namespaces.add(side.namespace)
+			pods.add(side.pod)
+			if _, name, found := strings.Cut(side.workload, "/"); found {
+				workloads.add(name)
+			}
+			ips.add(side.ip)
+			for key, value := range side.labels {
+				if key == namespaceLabel {
+					namespaces.add(value)
+				} else if r.redacts(key) {
+					values.add(value)
+				}
+			}
+		}
+		dnsNames.add(flow.DestDNSName)
+	}
+
+	namespaces.assign(func(i int) string { return "ns-" + letters(i) })
+	pods.assign(func(i int) string { return "pod-" + letters(i) })
+	workloads.assign(func(i int) string { return "workload-" + letters(i) })
+	dnsNames.assign(func(i int) string { return "host-" + letters(i) + ".example" })
+	values.assign(letters)
+	assignIPs(ips)
+
+	result := make([]*hubble.ParsedFlow, 0, len(flows))
+	for _, flow := range flows {
+		redacted := *flow
+		redacted.SourceNamespace = namespaces[flow.SourceNamespace]
+		redacted.SourcePod = pods[flow.SourcePod]
+		redacted.SourceWorkload = redactWorkload(flow.SourceWorkload, workloads)
+		redacted.SourceIP = ips[flow.SourceIP]
+		redacted.SourceLabels = r.redactLabels(flow.SourceLabels, namespaces, values)
+		redacted.DestNamespace = namespaces[flow.DestNamespace]
+		redacted.DestPod = pods[flow.DestPod]
+		redacted.DestWorkload = redactWorkload(flow.DestWorkload, workloads)
+		redacted.DestIP = ips[flow.DestIP]
+		redacted.DestLabels = r.redactLabels(flow.DestLabels, namespaces, values)
+		redacted.DestDNSName = dnsNames[flow.DestDNSName]
+		redacted.HTTPPath = ""
+		redacted.HTTPHost = ""
+		result = append(result, &redacted)
+	}
+	return result
+}
+
+// redacts reports whether the value of a label with this key is replaced
+func (r *Redactor) redacts(key string) bool {
+	return r.keys[labelName(key)]
+}
+
+// labelName returns a label key without its source, e.g. app for k8s:app
+func labelName(key string) string {
+	if _, name, found := strings.Cut(key, ":"); found {
+		return name
+	}
+	return key
+}
+
+// redactLabels returns labels with the namespace label and the labels with
+// redacted keys replaced, e.g. k8s:app=catalog by k8s:app=app-c, and
+// metadata labels dropped
+func (r *Redactor) redactLabels(labels map[string]string, namespaces, values pseudonyms) map[string]string {
+	result := make(map[string]string, len(labels))
+	for key, value := range labels {
+		switch {
+		case key == namespaceLabel:
+			result[key] = namespaces[value]
+		case hubble.IsIgnoredLabel(key, hubble.DefaultIgnoredLabelPrefixes):
+		case r.redacts(key) && value != "":
+			result[key] = path.Base(labelName(key)) + "-" + values[value]
+		default:
+			result[key] = value
+		}
+	}
+	return result
+}
+
+// redactWorkload replaces the name of a kind/name workload, keeping its kind
+func redactWorkload(workload string, workloads pseudonyms) string {
+	kind, name, found := strings.Cut(workload, "/")
+	if !found {
+		return ""
+	}
+	return kind + "/" + workloads[name]
+}
+
+// assignIPs gives IPv4 addresses pseudonyms from the 198.18.0.0/15
+// benchmarking range and IPv6 addresses from the 2001:db8::/32
+// documentation range, so redacted flows still carry valid IPs of the same
+// family. Anything else becomes "ip-a", "ip-b", ...
+func assignIPs(ips pseudonyms) {
+	v4, v6 := netip.MustParseAddr("198.18.0.0"), netip.MustParseAddr("2001:db8::")
+	other := 0
+	for _, ip := range slices.Sorted(maps.Keys(ips)) {
+		addr, err := netip.ParseAddr(ip)
+		switch {
+		case err != nil:
+			ips[ip] = "ip-" + letters(other)
+			other++
+		case addr.Unmap().Is4():
+			v4 = v4.Next()
+			ips[ip] = v4.String()
+		default:
+			v6 = v6.Next()
+			ips[ip] = v6.String()
+		}
+	}
+}
+
+// letters numbers pseudonyms a, b, ..., z, aa, ab, ...
+func letters(i int) string {
+	if i < 26 {
+		return string(rune('a' + i))
+	}
+	return letters(i/26-1) + letters(i%26)
+}
@@ -0,0 +1,101 @@
+package explain
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/prabhakaran-jm/cilium-policypilot/internal/hubble"
+)
+
+func TestRedactor(t *testing.T) {
+	flows := []*hubble.ParsedFlow{
+		{
+			SourceLabels:    map[string]string{"k8s:app": "frontend", "k8s:io.kubernetes.pod.namespace": "shop", "k8s:io.cilium.k8s.policy.serviceaccount": "frontend-sa", "k8s:tier": "web"},
+			SourceNamespace: "shop",
+			SourcePod:       "frontend-7d9f-abcde",
+			SourceWorkload:  "Deployment/frontend",
+			SourceIP:        "10.0.0.12",
+			DestLabels:      map[string]string{"k8s:app": "catalog", "k8s:app.kubernetes.io/name": "catalog"},
+			DestNamespace:   "payments",
+			DestPod:         "catalog-0",
+			DestIP:          "10.0.1.7",
+			DestPort:        8080,
+			Protocol:        "TCP",
+			HTTPMethod:      "GET",
+			HTTPPath:        "/customers/42",
+			HTTPHost:        "catalog.payments",
+		},
+		{
+			SourceLabels:    map[string]string{"k8s:app": "catalog"},
+			SourceNamespace: "payments",
+			SourcePod:       "catalog-0",
+			SourceIP:        "fd00::7",
+			DestLabels:      map[string]string{"reserved:world": ""},
+			DestIP:          "203.0.113.10",
+			DestDNSName:     "api.bank.internal",
+			DestPort:        443,
+			Protocol:        "TCP",
+		},
+	}
+
+	redactor := NewRedactor(DefaultRedactKeys)
+	redacted := redactor.Redact(flows)
+
+	expected := []*hubble.ParsedFlow{
+		{
+			SourceLabels:    map[string]string{"k8s:app": "app-b", "k8s:io.kubernetes.pod.namespace": "ns-b", "k8s:tier": "web"},
+			SourceNamespace: "ns-b",
+			SourcePod:       "pod-b",
+			SourceWorkload:  "Deployment/workload-a",
+			SourceIP:        "198.18.0.1",
+			DestLabels:      map[string]string{"k8s:app": "app-a", "k8s:app.kubernetes.io/name": "name-a"},
+			DestNamespace:   "ns-a",
+			DestPod:         "pod-a",
+			DestIP:          "198.18.0.2",
+			DestPort:        8080,
+			Protocol:        "TCP",
+			HTTPMethod:      "GET",
+		},
+		{
+			SourceLabels:    map[string]string{"k8s:app": "app-a"},
+			SourceNamespace: "ns-a",
+			SourcePod:       "pod-a",
+			SourceIP:        "2001:db8::1",
+			DestLabels:      map[string]string{"reserved:world": ""},
+			DestIP:          "198.18.0.3",
+			DestDNSName:     "host-a.example",
+			DestPort:        443,
+			Protocol:        "TCP",
+		},
+	}
+	if !reflect.DeepEqual(redacted, expected) {
+		for i := range redacted {
+			t.Errorf("Redact()[%d] = %+v, want %+v", i, *redacted[i], *expected[i])
+		}
+	}
+	if flows[0].SourcePod != "frontend-7d9f-abcde" || flows[0].SourceLabels["k8s:app"] != "frontend" {
+		t.Errorf("Redact() modified its input: %+v", *flows[0])
+	}
+
+	// The same flows, in any order, yield the same pseudonyms
+	again := redactor.Redact([]*hubble.ParsedFlow{flows[1], flows[0]})
+	if !reflect.DeepEqual([]*hubble.ParsedFlow{again[1], again[0]}, redacted) {
+		t.Errorf("Redact() is not deterministic: got %+v and %+v", again, redacted)
+	}
+
+	// Labels outside the redacted keys are kept
+	if kept := NewRedactor([]string{"tier"}).Redact(flows[:1])[0].SourceLabels; !reflect.DeepEqual(kept, map[string]string{"k8s:app": "frontend", "k8s:io.kubernetes.pod.namespace": "ns-b", "k8s:tier": "tier-a"}) {
+		t.Errorf("Redact() with keys [tier] labels = %v", kept)
+	}
+}
+
+func TestLetters(t *testing.T) {
+	var got []string
+	for _, i := range []int{0, 25, 26, 27, 701, 702} {
+		got = append(got, letters(i))
+	}
+	if want := []string{"a", "z", "aa", "ab", "zz", "aaa"}; !slices.Equal(got, want) {
+		t.Errorf("letters() = %v, want %v", got, want)
+	}
+}
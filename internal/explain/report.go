@@ -2,12 +2,14 @@ package explain
 
 import (
 	"fmt"
+	"html"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
 	"time"
 
+	"github.com/prabhakaran-jm/cilium-policypilot/internal/fileutil"
 	"github.com/prabhakaran-jm/cilium-policypilot/internal/graph"
 	"github.com/prabhakaran-jm/cilium-policypilot/internal/hubble"
 	"github.com/prabhakaran-jm/cilium-policypilot/internal/synth"
@@ -23,51 +25,119 @@ type ReportData struct {
 	Graph           *graph.Graph
 	Namespaces      []string
 	Protocols       map[string]int
+	L7Protocols     map[string]int
+	DropReasons     []DropReasonCount
+	BusiestEdges    []graph.Edge
+	PortExposure    map[hubble.PortKey]*hubble.PortExposure
+	Quality         CaptureQuality
 }
 
-// GenerateReport generates an HTML report from flows and policies.
-// Collects statistics, generates network graph, and prepares data
-// for HTML report generation.
+// DropReasonCount is the number of dropped flows with one drop reason
+type DropReasonCount struct {
+	Reason string
+	Flows  int
+}
+
+// busiestEdgeLimit is the number of connections listed in the busiest edges section
+const busiestEdgeLimit = 10
+
+// ReportOptions controls how report data is collected
+type ReportOptions struct {
+	// Graph controls how the network graph is built
+	Graph graph.Options
+}
+
+// GenerateReport collects the report data for flows and policies: flow
+// statistics, capture quality and the network graph. The data is rendered
+// separately, by WriteHTMLReport or WriteTextReport.
 func GenerateReport(flows []*hubble.ParsedFlow, policies []*synth.Policy) (*ReportData, error) {
+	return GenerateReportWithOptions(flows, policies, ReportOptions{})
+}
+
+// GenerateReportWithOptions collects the report data like GenerateReport,
+// using the given options
+func GenerateReportWithOptions(flows []*hubble.ParsedFlow, policies []*synth.Policy, opts ReportOptions) (*ReportData, error) {
 	// Generate network graph
-	networkGraph := graph.GenerateGraph(flows)
+	networkGraph := graph.GenerateGraphWithOptions(flows, opts.Graph)
 
 	// Collect statistics
 	namespaces := collectNamespaces(flows)
 	protocols := collectProtocols(flows)
+	l7Protocols := collectL7Protocols(flows)
+
+	flowCount := 0
+	for _, flow := range flows {
+		flowCount += flow.Occurrences()
+	}
 
 	data := &ReportData{
 		GeneratedAt:     time.Now(),
-		FlowCount:       len(flows),
+		FlowCount:       flowCount,
 		ParsedFlowCount: len(flows),
 		PolicyCount:     len(policies),
 		Policies:        policies,
 		Graph:           networkGraph,
 		Namespaces:      namespaces,
 		Protocols:       protocols,
+		L7Protocols:     l7Protocols,
+		DropReasons:     collectDropReasons(flows),
+		BusiestEdges:    networkGraph.BusiestEdges(busiestEdgeLimit),
+		PortExposure:    hubble.PortExposureMap(flows),
+		Quality:         collectCaptureQuality(flows),
 	}
 
 	return data, nil
 }
 
-// WriteHTMLReport writes an HTML report to a file
+// RenderOptions controls optional HTML report rendering
+type RenderOptions struct {
+	// Graph controls how the network graph is drawn
+	Graph graph.MermaidOptions
+}
+
+// WriteHTMLReport writes an HTML report to a file using default rendering
+// options
 func WriteHTMLReport(data *ReportData, filePath string) error {
-	html := generateHTML(data)
+	return WriteHTMLReportWithOptions(data, filePath, RenderOptions{})
+}
+
+// WriteHTMLReportWithOptions writes an HTML report to a file
+func WriteHTMLReportWithOptions(data *ReportData, filePath string, opts RenderOptions) error {
+	html := generateHTML(data, opts)
 
 	// Ensure output directory exists
 	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
 		return fmt.Errorf("failed to create output directory: %w", err)
 	}
 
-	if err := os.WriteFile(filePath, []byte(html), 0644); err != nil {
+	if err := fileutil.WriteFile(filePath, []byte(html), 0644); err != nil {
 		return fmt.Errorf("failed to write HTML report: %w", err)
 	}
 
 	return nil
 }
 
+// WriteGraphJSON writes the report's network graph to a JSON file
+func WriteGraphJSON(data *ReportData, filePath string) error {
+	content, err := data.Graph.ToJSON()
+	if err != nil {
+		return err
+	}
+
+	// Ensure output directory exists
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	if err := fileutil.WriteFile(filePath, append(content, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write graph JSON: %w", err)
+	}
+
+	return nil
+}
+
 // generateHTML creates the HTML content
-func generateHTML(data *ReportData) string {
+func generateHTML(data *ReportData, opts RenderOptions) string {
 	var sb strings.Builder
 
 	sb.WriteString(`<!DOCTYPE html>
@@ -169,6 +239,22 @@ func generateHTML(data *ReportData) string {
             border-radius: 20px;
             font-size: 0.9em;
         }
+        .drop-table {
+            border-collapse: collapse;
+            width: 100%;
+        }
+        .drop-table th, .drop-table td {
+            text-align: left;
+            padding: 8px 12px;
+            border-bottom: 1px solid #eee;
+        }
+        .caution {
+            background: #fff7e6;
+            border-left: 4px solid #d97706;
+            padding: 10px 15px;
+            margin-bottom: 15px;
+            border-radius: 5px;
+        }
         .namespace-list {
             display: flex;
             flex-wrap: wrap;
@@ -207,14 +293,48 @@ func generateHTML(data *ReportData) string {
             <div class="value">` + fmt.Sprintf("%d", len(data.Protocols)) + `</div>
         </div>
     </div>
-
+` + renderQualityHTML(data.Quality) + `
     <div class="section">
         <h2>📊 Network Graph</h2>
         <div class="mermaid">
-` + data.Graph.ToMermaid() + `
+` + data.Graph.ToMermaidWithOptions(opts.Graph) + `
         </div>
     </div>
 
+    <div class="section">
+        <h2>🔥 Busiest Connections</h2>
+        <ul class="policy-list">`)
+
+	for _, edge := range data.BusiestEdges {
+		sb.WriteString(fmt.Sprintf(`
+            <li class="policy-item"><strong>%s → %s</strong> (%s): %d flows</li>`,
+			edge.From, edge.To, html.EscapeString(edge.Label), edge.Count))
+	}
+
+	sb.WriteString(`
+        </ul>
+    </div>
+
+    <div class="section">
+        <h2>🔌 Port Exposure</h2>
+        <ul class="policy-list">`)
+
+	for _, key := range hubble.SortedPortKeys(data.PortExposure) {
+		exposure := data.PortExposure[key]
+		sb.WriteString(fmt.Sprintf(`
+            <li class="policy-item"><strong>%s</strong>: %d flows
+                <br><small>Served by: %s</small>
+                <br><small>Clients: %s</small>
+            </li>`,
+			key, exposure.Flows,
+			html.EscapeString(strings.Join(exposure.Servers, ", ")),
+			html.EscapeString(strings.Join(exposure.Clients, ", "))))
+	}
+
+	sb.WriteString(`
+        </ul>
+    </div>
+
     <div class="section">
         <h2>📋 Generated Policies</h2>
         <ul class="policy-list">`)
@@ -226,7 +346,7 @@ func generateHTML(data *ReportData) string {
                 <br>
                 <small>Protects endpoints matching: %s</small>`,
 			policy.Metadata.Name,
-			policy.Metadata.Namespace,
+			formatNamespace(policy),
 			formatLabels(policy.Spec.EndpointSelector.MatchLabels)))
 
 		// Add ingress rules details
@@ -242,13 +362,18 @@ func generateHTML(data *ReportData) string {
 				for _, ep := range rule.FromEndpoints {
 					fromEndpoints = append(fromEndpoints, formatLabels(ep.MatchLabels))
 				}
+				for _, entity := range rule.FromEntities {
+					fromEndpoints = append(fromEndpoints, "entity:"+entity)
+				}
+				fromEndpoints = append(fromEndpoints, rule.FromCIDR...)
 				// Format ports
 				ports := make([]string, 0)
 				for _, portRule := range rule.ToPorts {
 					for _, pp := range portRule.Ports {
-						ports = append(ports, fmt.Sprintf("%s/%s", pp.Port, pp.Protocol))
+						ports = append(ports, formatPort(pp)+formatHTTPRules(portRule.Rules))
 					}
 				}
+				ports = append(ports, formatICMPRules(rule.ICMPs)...)
 				if len(fromEndpoints) > 0 && len(ports) > 0 {
 					sb.WriteString(fmt.Sprintf("From %s → Ports: %s", strings.Join(fromEndpoints, ", "), strings.Join(ports, ", ")))
 				}
@@ -269,13 +394,21 @@ func generateHTML(data *ReportData) string {
 				for _, ep := range rule.ToEndpoints {
 					toEndpoints = append(toEndpoints, formatLabels(ep.MatchLabels))
 				}
+				for _, fqdn := range rule.ToFQDNs {
+					toEndpoints = append(toEndpoints, formatFQDN(fqdn))
+				}
+				for _, entity := range rule.ToEntities {
+					toEndpoints = append(toEndpoints, "entity:"+entity)
+				}
+				toEndpoints = append(toEndpoints, rule.ToCIDR...)
 				// Format ports
 				ports := make([]string, 0)
 				for _, portRule := range rule.ToPorts {
 					for _, pp := range portRule.Ports {
-						ports = append(ports, fmt.Sprintf("%s/%s", pp.Port, pp.Protocol))
+						ports = append(ports, formatPort(pp))
 					}
 				}
+				ports = append(ports, formatICMPRules(rule.ICMPs)...)
 				if len(toEndpoints) > 0 && len(ports) > 0 {
 					sb.WriteString(fmt.Sprintf("To %s → Ports: %s", strings.Join(toEndpoints, ", "), strings.Join(ports, ", ")))
 				} else if len(ports) > 0 {
@@ -324,6 +457,44 @@ func generateHTML(data *ReportData) string {
         </div>
     </div>
 
+    <div class="section">
+        <h2>🧩 L7 Protocols</h2>
+        <div class="protocol-list">`)
+
+	if len(data.L7Protocols) == 0 {
+		sb.WriteString(`<p style="color: #666;">No application-layer traffic observed. L7 visibility requires Cilium's L7 proxy (e.g. an L7 policy or visibility annotation).</p>`)
+	}
+	l7Names := make([]string, 0, len(data.L7Protocols))
+	for protocol := range data.L7Protocols {
+		l7Names = append(l7Names, protocol)
+	}
+	sort.Strings(l7Names)
+	for _, protocol := range l7Names {
+		sb.WriteString(fmt.Sprintf(`<span class="protocol-badge">%s: %d</span>`, protocol, data.L7Protocols[protocol]))
+	}
+
+	sb.WriteString(`
+        </div>
+    </div>`)
+
+	if len(data.DropReasons) > 0 {
+		sb.WriteString(`
+
+    <div class="section">
+        <h2>🚫 Top Drop Reasons</h2>
+        <table class="drop-table">
+            <tr><th>Reason</th><th>Flows</th></tr>`)
+		for _, reason := range data.DropReasons {
+			sb.WriteString(fmt.Sprintf(`
+            <tr><td>%s</td><td>%d</td></tr>`, html.EscapeString(reason.Reason), reason.Flows))
+		}
+		sb.WriteString(`
+        </table>
+    </div>`)
+	}
+
+	sb.WriteString(`
+
     <script>
         mermaid.initialize({ startOnLoad: true, theme: 'default' });
     </script>
@@ -358,12 +529,103 @@ func collectProtocols(flows []*hubble.ParsedFlow) map[string]int {
 	protocols := make(map[string]int)
 	for _, flow := range flows {
 		if flow.Protocol != "" {
-			protocols[flow.Protocol]++
+			protocols[flow.Protocol] += flow.Occurrences()
+		}
+	}
+	return protocols
+}
+
+// collectDropReasons counts dropped and denied flows by drop reason, most
+// frequent first. Drops without a reason are counted as UNKNOWN.
+func collectDropReasons(flows []*hubble.ParsedFlow) []DropReasonCount {
+	counts := make(map[string]int)
+	for _, flow := range flows {
+		if !flow.IsDenied() && flow.DropReason == "" {
+			continue
+		}
+		reason := flow.DropReason
+		if reason == "" {
+			reason = "UNKNOWN"
+		}
+		counts[reason] += flow.Occurrences()
+	}
+
+	reasons := make([]DropReasonCount, 0, len(counts))
+	for reason, count := range counts {
+		reasons = append(reasons, DropReasonCount{Reason: reason, Flows: count})
+	}
+	sort.Slice(reasons, func(i, j int) bool {
+		if reasons[i].Flows != reasons[j].Flows {
+			return reasons[i].Flows > reasons[j].Flows
+		}
+		return reasons[i].Reason < reasons[j].Reason
+	})
+	return reasons
+}
+
+// collectL7Protocols counts application-layer protocols (HTTP, DNS, Kafka)
+// seen by the L7 proxy. Flows without an L7 record are not counted.
+func collectL7Protocols(flows []*hubble.ParsedFlow) map[string]int {
+	protocols := make(map[string]int)
+	for _, flow := range flows {
+		if flow.L7Protocol != "" {
+			protocols[flow.L7Protocol] += flow.Occurrences()
 		}
 	}
 	return protocols
 }
 
+// formatNamespace formats a policy's namespace, noting cluster-wide policies
+func formatNamespace(policy *synth.Policy) string {
+	if policy.Kind == "CiliumClusterwideNetworkPolicy" {
+		return "cluster-wide"
+	}
+	return policy.Metadata.Namespace
+}
+
+// formatFQDN formats an FQDN selector as a string
+func formatFQDN(fqdn synth.FQDNSelector) string {
+	if fqdn.MatchName != "" {
+		return fqdn.MatchName
+	}
+	return fqdn.MatchPattern
+}
+
+// formatPort formats a port or port range with its protocol, e.g. "8080-8083/TCP"
+func formatPort(pp synth.PortProtocol) string {
+	if pp.EndPort > 0 {
+		return fmt.Sprintf("%s-%d/%s", pp.Port, pp.EndPort, pp.Protocol)
+	}
+	return fmt.Sprintf("%s/%s", pp.Port, pp.Protocol)
+}
+
+// formatICMPRules formats ICMP rules like ports, e.g. "ICMP type 8"
+func formatICMPRules(rules []synth.ICMPRule) []string {
+	var result []string
+	for _, rule := range rules {
+		for _, field := range rule.Fields {
+			protocol := "ICMP"
+			if field.Family == "IPv6" {
+				protocol = "ICMPv6"
+			}
+			result = append(result, fmt.Sprintf("%s type %d", protocol, field.Type))
+		}
+	}
+	return result
+}
+
+// formatHTTPRules formats L7 HTTP rules as a suffix for a port, e.g. " [GET /api/v1]"
+func formatHTTPRules(rules *synth.L7Rules) string {
+	if rules == nil || len(rules.HTTP) == 0 {
+		return ""
+	}
+	requests := make([]string, 0, len(rules.HTTP))
+	for _, rule := range rules.HTTP {
+		requests = append(requests, strings.TrimSpace(rule.Method+" "+rule.Path))
+	}
+	return " [" + html.EscapeString(strings.Join(requests, ", ")) + "]"
+}
+
 // formatLabels formats labels map as a string
 func formatLabels(labels map[string]string) string {
 	if len(labels) == 0 {
@@ -377,3 +639,39 @@ func formatLabels(labels map[string]string) string {
 	sort.Strings(pairs)
 	return strings.Join(pairs, ", ")
 }
+
+// renderQualityHTML renders the capture quality section, led by a caution
+// if the capture looks incomplete
+func renderQualityHTML(quality CaptureQuality) string {
+	var sb strings.Builder
+	sb.WriteString(`
+    <div class="section">
+        <h2>🧪 Capture Quality</h2>`)
+	if cautions := quality.Cautions(); len(cautions) > 0 {
+		sb.WriteString(fmt.Sprintf(`
+        <p class="caution">⚠️ This capture may be incomplete: %s. Capture longer before trusting the generated policies.</p>`,
+			html.EscapeString(strings.Join(cautions, "; "))))
+	}
+	sb.WriteString(fmt.Sprintf(`
+        <table class="drop-table">
+            <tr><td>Flows with complete metadata</td><td>%d of %d (%.0f%%)</td></tr>
+            <tr><td>Flows skipped during synthesis</td><td>%d</td></tr>
+            <tr><td>Pods only opening connections</td><td>%s</td></tr>
+            <tr><td>Pods only accepting connections</td><td>%s</td></tr>
+        </table>
+    </div>
+`,
+		quality.CompleteFlows, quality.Flows, quality.Ratio()*100,
+		quality.SkippedFlows,
+		html.EscapeString(formatNames(quality.SourceOnly)),
+		html.EscapeString(formatNames(quality.DestinationOnly))))
+	return sb.String()
+}
+
+// formatNames joins endpoint names, or returns "none"
+func formatNames(names []string) string {
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ", ")
+}
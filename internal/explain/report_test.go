@@ -0,0 +1,283 @@
+package explain
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/prabhakaran-jm/cilium-policypilot/internal/graph"
+	"github.com/prabhakaran-jm/cilium-policypilot/internal/hubble"
+)
+
+func TestCollectL7Protocols(t *testing.T) {
+	tests := []struct {
+		name     string
+		flows    []*hubble.ParsedFlow
+		expected map[string]int
+	}{
+		{
+			name:     "no L7 records",
+			flows:    []*hubble.ParsedFlow{{Protocol: "TCP"}, {Protocol: "UDP"}},
+			expected: map[string]int{},
+		},
+		{
+			name: "mixed protocols",
+			flows: []*hubble.ParsedFlow{
+				{Protocol: "TCP", L7Protocol: "HTTP"},
+				{Protocol: "TCP", L7Protocol: "HTTP"},
+				{Protocol: "UDP", L7Protocol: "DNS"},
+				{Protocol: "TCP", L7Protocol: "Kafka"},
+				{Protocol: "TCP"},
+			},
+			expected: map[string]int{"HTTP": 2, "DNS": 1, "Kafka": 1},
+		},
+		{
+			name: "deduplicated flows are weighted by occurrences",
+			flows: []*hubble.ParsedFlow{
+				{Protocol: "TCP", L7Protocol: "HTTP", Count: 5},
+				{Protocol: "UDP", L7Protocol: "DNS"},
+			},
+			expected: map[string]int{"HTTP": 5, "DNS": 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := collectL7Protocols(tt.flows); !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("collectL7Protocols() = %v, want %v", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestGenerateHTMLL7Protocols(t *testing.T) {
+	flows := []*hubble.ParsedFlow{
+		{Protocol: "UDP", L7Protocol: "DNS"},
+		{Protocol: "TCP", L7Protocol: "HTTP"},
+	}
+	data, err := GenerateReport(flows, nil)
+	if err != nil {
+		t.Fatalf("GenerateReport() error = %v", err)
+	}
+
+	html := generateHTML(data, RenderOptions{})
+	if !strings.Contains(html, "L7 Protocols") {
+		t.Fatal("Expected an L7 Protocols section")
+	}
+	dns, http := strings.Index(html, "DNS: 1"), strings.Index(html, "HTTP: 1")
+	if dns < 0 || http < 0 || dns > http {
+		t.Errorf("Expected sorted badges DNS: 1 then HTTP: 1")
+	}
+}
+
+func TestGenerateHTMLPortExposure(t *testing.T) {
+	flows := []*hubble.ParsedFlow{
+		{SourceLabels: map[string]string{"k8s:app": "frontend"}, SourceNamespace: "shop", DestLabels: map[string]string{"k8s:app": "catalog"}, DestNamespace: "shop", DestPort: 8080, Protocol: "TCP"},
+		{SourceLabels: map[string]string{"k8s:app": "frontend"}, SourceNamespace: "shop", DestLabels: map[string]string{"k8s:app": "redis"}, DestNamespace: "shop", DestPort: 6379, Protocol: "TCP"},
+	}
+	data, err := GenerateReport(flows, nil)
+	if err != nil {
+		t.Fatalf("GenerateReport() error = %v", err)
+	}
+
+	html := generateHTML(data, RenderOptions{})
+	if !strings.Contains(html, "Port Exposure") {
+		t.Fatal("Expected a Port Exposure section")
+	}
+	redis, catalog := strings.Index(html, "<strong>6379/TCP</strong>"), strings.Index(html, "<strong>8080/TCP</strong>")
+	if redis < 0 || catalog < 0 || redis > catalog {
+		t.Errorf("Expected ports listed in numeric order")
+	}
+	if !strings.Contains(html, "Served by: shop/catalog") {
+		t.Errorf("Expected the catalog server to be listed")
+	}
+}
+
+func TestGenerateHTMLDropReasons(t *testing.T) {
+	tests := []struct {
+		name     string
+		flows    []*hubble.ParsedFlow
+		expected []DropReasonCount
+	}{
+		{
+			name:     "no dropped flows",
+			flows:    []*hubble.ParsedFlow{{Protocol: "TCP", Verdict: "FORWARDED"}},
+			expected: []DropReasonCount{},
+		},
+		{
+			name: "sorted by frequency",
+			flows: []*hubble.ParsedFlow{
+				{Protocol: "TCP", Verdict: "DROPPED", DropReason: "STALE_OR_UNROUTABLE_IP"},
+				{Protocol: "TCP", Verdict: "DROPPED", DropReason: "POLICY_DENIED", Count: 3},
+				{Protocol: "UDP", Verdict: "DROPPED"},
+				{Protocol: "TCP", Verdict: "FORWARDED"},
+			},
+			expected: []DropReasonCount{
+				{Reason: "POLICY_DENIED", Flows: 3},
+				{Reason: "STALE_OR_UNROUTABLE_IP", Flows: 1},
+				{Reason: "UNKNOWN", Flows: 1},
+			},
+		},
+		{
+			// Deduplication keeps drop reasons apart on the same tuple
+			name: "reasons on the same tuple",
+			flows: hubble.DeduplicateFlows([]*hubble.ParsedFlow{
+				{Protocol: "TCP", DestPort: 8080, Verdict: "DROPPED", DropReason: "POLICY_DENIED", Count: 5},
+				{Protocol: "TCP", DestPort: 8080, Verdict: "DROPPED", DropReason: "CT_MAP_INSERTION_FAILED", Count: 3},
+			}),
+			expected: []DropReasonCount{
+				{Reason: "POLICY_DENIED", Flows: 5},
+				{Reason: "CT_MAP_INSERTION_FAILED", Flows: 3},
+			},
+		},
+		{
+			name: "denied flows",
+			flows: []*hubble.ParsedFlow{
+				{Protocol: "TCP", Verdict: "DENIED"},
+				{Protocol: "TCP", Verdict: "DROPPED", DropReason: "POLICY_DENIED"},
+			},
+			expected: []DropReasonCount{
+				{Reason: "POLICY_DENIED", Flows: 1},
+				{Reason: "UNKNOWN", Flows: 1},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := GenerateReport(tt.flows, nil)
+			if err != nil {
+				t.Fatalf("GenerateReport() error = %v", err)
+			}
+			if !reflect.DeepEqual(data.DropReasons, tt.expected) {
+				t.Errorf("DropReasons = %v, want %v", data.DropReasons, tt.expected)
+			}
+
+			html := generateHTML(data, RenderOptions{})
+			if hasSection := strings.Contains(html, "Top Drop Reasons"); hasSection != (len(tt.expected) > 0) {
+				t.Errorf("Drop reasons section rendered = %v, want %v", hasSection, len(tt.expected) > 0)
+			}
+		})
+	}
+}
+
+func TestRenderText(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     *ReportData
+		expected string
+	}{
+		{
+			name: "empty sections are omitted",
+			data: &ReportData{FlowCount: 0, Graph: &graph.Graph{}},
+			expected: `PolicyPilot Report
+Flows:      0 (0 unique)
+Policies:   0
+Namespaces: 0
+`,
+		},
+		{
+			name: "full summary",
+			data: &ReportData{
+				FlowCount:       7,
+				ParsedFlowCount: 3,
+				PolicyCount:     2,
+				Namespaces:      []string{"kube-system", "shop"},
+				Protocols:       map[string]int{"UDP": 2, "TCP": 5},
+				L7Protocols:     map[string]int{"DNS": 2},
+				DropReasons:     []DropReasonCount{{Reason: "POLICY_DENIED", Flows: 1}},
+				BusiestEdges: []graph.Edge{
+					{From: "shop_frontend", To: "shop_catalog", Label: "8080/TCP", Count: 5},
+				},
+				Quality: CaptureQuality{
+					Coverage:     hubble.Coverage{Flows: 7, CompleteFlows: 5, SourceOnly: []string{"shop/loadgen"}},
+					SkippedFlows: 2,
+				},
+			},
+			expected: `PolicyPilot Report
+Flows:      7 (3 unique)
+Policies:   2
+Namespaces: 2 (kube-system, shop)
+
+Capture quality:
+  Complete metadata        5 of 7 (71%)
+  Skipped in synthesis     2
+  Only opening             shop/loadgen
+  Only accepting           none
+  Caution: only 71% of flows have both endpoints identified and an L4 protocol
+  Caution: 2 of 7 flows add no policy rule for lack of endpoint or port information
+
+Protocols:
+  TCP                      5
+  UDP                      2
+
+L7 protocols:
+  DNS                      2
+
+Top drop reasons:
+  POLICY_DENIED            1
+
+Busiest connections:
+  shop_frontend -> shop_catalog (8080/TCP): 5 flows
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := renderText(tt.data); result != tt.expected {
+				t.Errorf("renderText() =\n%s\nwant:\n%s", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCaptureQuality(t *testing.T) {
+	frontend := map[string]string{"k8s:app": "frontend"}
+	catalog := map[string]string{"k8s:app": "catalog"}
+	complete := &hubble.ParsedFlow{SourceLabels: frontend, SourceNamespace: "shop", DestLabels: catalog, DestNamespace: "shop", DestPort: 8080, Protocol: "TCP", Count: 9}
+	reply := &hubble.ParsedFlow{SourceLabels: catalog, SourceNamespace: "shop", DestLabels: frontend, DestNamespace: "shop", DestPort: 41000, Protocol: "TCP", IsReply: true}
+	noPort := &hubble.ParsedFlow{SourceLabels: frontend, SourceNamespace: "shop", DestLabels: catalog, DestNamespace: "shop", Count: 2}
+
+	tests := []struct {
+		name     string
+		flows    []*hubble.ParsedFlow
+		skipped  int
+		cautions int
+	}{
+		{
+			name:  "replies are not skipped",
+			flows: []*hubble.ParsedFlow{complete, reply},
+		},
+		{
+			name:     "incomplete flows are skipped",
+			flows:    []*hubble.ParsedFlow{complete, reply, noPort},
+			skipped:  2,
+			cautions: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := GenerateReport(tt.flows, nil)
+			if err != nil {
+				t.Fatalf("GenerateReport() error = %v", err)
+			}
+			if data.Quality.SkippedFlows != tt.skipped {
+				t.Errorf("SkippedFlows = %d, want %d", data.Quality.SkippedFlows, tt.skipped)
+			}
+			cautions := data.Quality.Cautions()
+			if len(cautions) != tt.cautions {
+				t.Errorf("Cautions() = %v, want %d", cautions, tt.cautions)
+			}
+
+			html := generateHTML(data, RenderOptions{})
+			if !strings.Contains(html, "Capture Quality") {
+				t.Fatal("Expected a Capture Quality section")
+			}
+			if hasCaution := strings.Contains(html, "may be incomplete"); hasCaution != (tt.cautions > 0) {
+				t.Errorf("Caution rendered = %v, want %v", hasCaution, tt.cautions > 0)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package explain
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// WriteTextReport writes a plain-text summary of the report to w, suited to
+// CI logs where an HTML file is not practical
+func WriteTextReport(data *ReportData, w io.Writer) error {
+	_, err := io.WriteString(w, renderText(data))
+	return err
+}
+
+// renderText creates the plain-text summary: totals, capture quality, the
+// protocol histograms, drop reasons and the busiest connections
+func renderText(data *ReportData) string {
+	var sb strings.Builder
+
+	sb.WriteString("PolicyPilot Report\n")
+	fmt.Fprintf(&sb, "Flows:      %d (%d unique)\n", data.FlowCount, data.ParsedFlowCount)
+	fmt.Fprintf(&sb, "Policies:   %d\n", data.PolicyCount)
+	fmt.Fprintf(&sb, "Namespaces: %d", len(data.Namespaces))
+	if len(data.Namespaces) > 0 {
+		fmt.Fprintf(&sb, " (%s)", strings.Join(data.Namespaces, ", "))
+	}
+	sb.WriteString("\n")
+
+	if quality := data.Quality; quality.Flows > 0 {
+		sb.WriteString("\nCapture quality:\n")
+		fmt.Fprintf(&sb, "  %-24s %d of %d (%.0f%%)\n", "Complete metadata", quality.CompleteFlows, quality.Flows, quality.Ratio()*100)
+		fmt.Fprintf(&sb, "  %-24s %d\n", "Skipped in synthesis", quality.SkippedFlows)
+		fmt.Fprintf(&sb, "  %-24s %s\n", "Only opening", formatNames(quality.SourceOnly))
+		fmt.Fprintf(&sb, "  %-24s %s\n", "Only accepting", formatNames(quality.DestinationOnly))
+		for _, caution := range quality.Cautions() {
+			fmt.Fprintf(&sb, "  Caution: %s\n", caution)
+		}
+	}
+
+	writeCounts(&sb, "Protocols", data.Protocols)
+	writeCounts(&sb, "L7 protocols", data.L7Protocols)
+
+	if len(data.DropReasons) > 0 {
+		sb.WriteString("\nTop drop reasons:\n")
+		for _, reason := range data.DropReasons {
+			fmt.Fprintf(&sb, "  %-24s %d\n", reason.Reason, reason.Flows)
+		}
+	}
+
+	if len(data.BusiestEdges) > 0 {
+		sb.WriteString("\nBusiest connections:\n")
+		for _, edge := range data.BusiestEdges {
+			fmt.Fprintf(&sb, "  %s -> %s (%s): %d flows\n", edge.From, edge.To, edge.Label, edge.Count)
+		}
+	}
+
+	return sb.String()
+}
+
+// writeCounts writes a titled histogram, most frequent first, or nothing if
+// counts is empty
+func writeCounts(sb *strings.Builder, title string, counts map[string]int) {
+	if len(counts) == 0 {
+		return
+	}
+
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+
+	fmt.Fprintf(sb, "\n%s:\n", title)
+	for _, key := range keys {
+		fmt.Fprintf(sb, "  %-24s %d\n", key, counts[key])
+	}
+}
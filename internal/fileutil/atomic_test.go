@@ -0,0 +1,93 @@
+package fileutil
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "policy.yaml")
+
+	for _, content := range []string{"first\n", "second\n"} {
+		if err := WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != content {
+			t.Errorf("content = %q, want %q", data, content)
+		}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0644 {
+		t.Errorf("mode = %v, want 0644", info.Mode().Perm())
+	}
+	assertNoTempFiles(t, dir)
+}
+
+func TestWriteAtomicError(t *testing.T) {
+	errInterrupted := errors.New("interrupted")
+	partialWrite := func(w io.Writer) error {
+		if _, err := w.Write([]byte("partial")); err != nil {
+			return err
+		}
+		return errInterrupted
+	}
+
+	t.Run("existing file is kept", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "policy.yaml")
+		if err := os.WriteFile(path, []byte("original\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := WriteAtomic(path, 0644, partialWrite); !errors.Is(err, errInterrupted) {
+			t.Fatalf("WriteAtomic() error = %v, want %v", err, errInterrupted)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "original\n" {
+			t.Errorf("content = %q, want original content", data)
+		}
+		assertNoTempFiles(t, dir)
+	})
+
+	t.Run("no file is created", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "policy.yaml")
+
+		if err := WriteAtomic(path, 0644, partialWrite); !errors.Is(err, errInterrupted) {
+			t.Fatalf("WriteAtomic() error = %v, want %v", err, errInterrupted)
+		}
+
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("Expected no file after failed write, got err = %v", err)
+		}
+		assertNoTempFiles(t, dir)
+	})
+}
+
+// assertNoTempFiles fails if a temporary file was left behind in dir
+func assertNoTempFiles(t *testing.T, dir string) {
+	t.Helper()
+	matches, err := filepath.Glob(filepath.Join(dir, ".*.tmp-*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) > 0 {
+		t.Errorf("Expected temporary files to be cleaned up, found %v", matches)
+	}
+}
@@ -1,7 +1,9 @@
 package graph
 
 import (
+	"encoding/json"
 	"fmt"
+	"slices"
 	"sort"
 	"strings"
 
@@ -10,32 +12,84 @@ import (
 
 // Node represents a node in the network graph
 type Node struct {
-	ID        string
-	Label     string
-	Namespace string
-	Type      string // "pod", "service", etc.
+	ID        string `json:"id"`
+	Label     string `json:"label"`
+	Namespace string `json:"namespace,omitempty"`
+	Type      string `json:"type"` // "pod", "host" or "external"
+
+	// PodName, Workload and Labels describe the pod a node stands for with
+	// DetailPod; they are empty for nodes aggregated by labels
+	PodName  string            `json:"podName,omitempty"`
+	Workload string            `json:"workload,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"`
 }
 
 // Edge represents a connection between nodes
 type Edge struct {
-	From     string
-	To       string
-	Port     uint16
-	Protocol string
-	Label    string
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Port     uint16 `json:"port"`
+	Protocol string `json:"protocol"`
+	Label    string `json:"label"`
+	Count    int    `json:"count,omitempty"` // number of observed flows between the two nodes
+
+	// Initiator is the ID of the node that opened the connections the edge
+	// stands for. It is From, except for edges drawn from reply flows with
+	// Options.ObservedDirection, where it is To.
+	Initiator string `json:"initiator"`
+	// Bidirectional is set when each of the two nodes opened connections to
+	// the other
+	Bidirectional bool `json:"bidirectional,omitempty"`
 }
 
 // Graph represents a network graph
 type Graph struct {
-	Nodes []Node
-	Edges []Edge
+	Nodes []Node `json:"nodes"`
+	Edges []Edge `json:"edges"`
+}
+
+// Graph detail levels
+const (
+	// DetailApp keys nodes on their app label, so replicas of a workload
+	// share one node
+	DetailApp = "app"
+	// DetailPod keys nodes on their pod name, so each replica is a distinct
+	// node; endpoints without a pod name are keyed as with DetailApp
+	DetailPod = "pod"
+)
+
+// Options controls how GenerateGraphWithOptions builds a graph
+type Options struct {
+	// Detail is DetailApp (the default when empty) or DetailPod
+	Detail string
+
+	// ObservedDirection draws reply flows from the server to the client, as
+	// observed, instead of from the client that opened the connection. It
+	// shows what reply detection classified, for debugging.
+	ObservedDirection bool
+}
+
+// edgeKey identifies an edge while flows are aggregated
+type edgeKey struct {
+	from, to string
+	// reply is set for edges drawn from reply flows in their observed
+	// direction
+	reply bool
 }
 
 // GenerateGraph creates a network graph from parsed flows.
 // Extracts unique nodes (pods) and edges (connections) from flows,
 // creating a representation suitable for visualization.
 // Aggregates multiple flows between the same nodes into a single edge.
+// Edges point from the node that opened the connections, so flows marked
+// as replies (see hubble.DetectReplies) add to the edge the other way.
 func GenerateGraph(flows []*hubble.ParsedFlow) *Graph {
+	return GenerateGraphWithOptions(flows, Options{})
+}
+
+// GenerateGraphWithOptions creates a network graph like GenerateGraph, with
+// nodes keyed as set by opts.Detail
+func GenerateGraphWithOptions(flows []*hubble.ParsedFlow, opts Options) *Graph {
 	graph := &Graph{
 		Nodes: make([]Node, 0),
 		Edges: make([]Edge, 0),
@@ -44,55 +98,64 @@ func GenerateGraph(flows []*hubble.ParsedFlow) *Graph {
 	// Track unique nodes
 	nodeMap := make(map[string]Node)
 
-	// Track edges by source->destination, aggregating ports/protocols
-	edgeMap := make(map[string]map[string][]string) // source -> dest -> []protocol:port
+	// Track edges by initiator->responder, aggregating ports/protocols
+	var edgeKeys []edgeKey
+	edgePorts := make(map[edgeKey][]string) // protocol:port, in order of first use
+	edgeCounts := make(map[edgeKey]int)     // flow count
+	edgeFirst := make(map[edgeKey]Edge)     // protocol and port of the first flow
 
 	// Process flows to extract nodes and edges
 	for _, flow := range flows {
 		// Skip flows without proper source/destination
-		if len(flow.SourceLabels) == 0 || len(flow.DestLabels) == 0 {
+		sourceNode, ok := sourceNode(flow)
+		if !ok {
+			continue
+		}
+		destNode, ok := destinationNode(flow)
+		if !ok {
 			continue
 		}
 
 		// Create or get source node
-		sourceID := getNodeID(flow.SourceLabels, flow.SourceNamespace)
+		if opts.Detail == DetailPod {
+			sourceNode = withPod(sourceNode, flow.SourcePod, flow.SourceWorkload, flow.SourceLabels)
+		}
+		sourceID := sourceNode.ID
 		if _, exists := nodeMap[sourceID]; !exists {
-			sourceNode := Node{
-				ID:        sourceID,
-				Label:     getNodeLabel(flow.SourceLabels),
-				Namespace: flow.SourceNamespace,
-				Type:      "pod",
-			}
 			nodeMap[sourceID] = sourceNode
 		}
 
 		// Create or get destination node
-		destID := getNodeID(flow.DestLabels, flow.DestNamespace)
+		if opts.Detail == DetailPod {
+			destNode = withPod(destNode, flow.DestPod, flow.DestWorkload, flow.DestLabels)
+		}
+		destID := destNode.ID
 		if _, exists := nodeMap[destID]; !exists {
-			destNode := Node{
-				ID:        destID,
-				Label:     getNodeLabel(flow.DestLabels),
-				Namespace: flow.DestNamespace,
-				Type:      "pod",
-			}
 			nodeMap[destID] = destNode
 		}
 
-		// Aggregate edge information
-		if edgeMap[sourceID] == nil {
-			edgeMap[sourceID] = make(map[string][]string)
-		}
-		portProto := fmt.Sprintf("%s:%d", flow.Protocol, flow.DestPort)
-		// Check if this port/protocol combination already exists
-		exists := false
-		for _, existing := range edgeMap[sourceID][destID] {
-			if existing == portProto {
-				exists = true
-				break
+		// Aggregate edge information. Replies are drawn from the client that
+		// opened the connection to the server port it connected to, unless
+		// opts.ObservedDirection is set.
+		key := edgeKey{from: sourceID, to: destID}
+		port := flow.DestPort
+		if flow.IsReply {
+			if opts.ObservedDirection {
+				key.reply = true
+			} else {
+				key = edgeKey{from: destID, to: sourceID}
+				port = flow.SourcePort
 			}
 		}
-		if !exists {
-			edgeMap[sourceID][destID] = append(edgeMap[sourceID][destID], portProto)
+		if _, exists := edgeCounts[key]; !exists {
+			edgeKeys = append(edgeKeys, key)
+		}
+		edgeCounts[key] += flow.Occurrences()
+		if _, exists := edgeFirst[key]; !exists && flow.Protocol != "" {
+			edgeFirst[key] = Edge{Protocol: flow.Protocol, Port: port}
+		}
+		if portProto := trafficLabel(flow, port); portProto != "" && !slices.Contains(edgePorts[key], portProto) {
+			edgePorts[key] = append(edgePorts[key], portProto)
 		}
 	}
 
@@ -102,31 +165,30 @@ func GenerateGraph(flows []*hubble.ParsedFlow) *Graph {
 	}
 
 	// Convert aggregated edges to Edge slice
-	for sourceID, dests := range edgeMap {
-		for destID, portProtos := range dests {
-			// Aggregate multiple ports/protocols into a single label
-			edgeLabel := strings.Join(portProtos, ", ")
-			if len(portProtos) > 3 {
-				edgeLabel = fmt.Sprintf("%s, ... (%d total)", strings.Join(portProtos[:3], ", "), len(portProtos))
-			}
-
-			// Use first port/protocol for the edge struct (for compatibility)
-			parts := strings.Split(portProtos[0], ":")
-			protocol := parts[0]
-			var port uint16
-			if len(parts) > 1 {
-				fmt.Sscanf(parts[1], "%d", &port)
-			}
+	for _, key := range edgeKeys {
+		portProtos := edgePorts[key]
+		// Aggregate multiple ports/protocols into a single label
+		edgeLabel := strings.Join(portProtos, ", ")
+		if len(portProtos) > 3 {
+			edgeLabel = fmt.Sprintf("%s, ... (%d total)", strings.Join(portProtos[:3], ", "), len(portProtos))
+		}
 
-			edge := Edge{
-				From:     sourceID,
-				To:       destID,
-				Port:     port,
-				Protocol: protocol,
-				Label:    edgeLabel,
-			}
-			graph.Edges = append(graph.Edges, edge)
+		initiator := key.from
+		if key.reply {
+			initiator = key.to
 		}
+		_, reverse := edgeCounts[edgeKey{from: key.to, to: key.from}]
+		edge := Edge{
+			From:          key.from,
+			To:            key.to,
+			Port:          edgeFirst[key].Port,
+			Protocol:      edgeFirst[key].Protocol,
+			Label:         edgeLabel,
+			Count:         edgeCounts[key],
+			Initiator:     initiator,
+			Bidirectional: !key.reply && reverse && key.from != key.to,
+		}
+		graph.Edges = append(graph.Edges, edge)
 	}
 
 	// Sort nodes and edges for consistent output
@@ -137,99 +199,390 @@ func GenerateGraph(flows []*hubble.ParsedFlow) *Graph {
 		if graph.Edges[i].From != graph.Edges[j].From {
 			return graph.Edges[i].From < graph.Edges[j].From
 		}
-		return graph.Edges[i].To < graph.Edges[j].To
+		if graph.Edges[i].To != graph.Edges[j].To {
+			return graph.Edges[i].To < graph.Edges[j].To
+		}
+		// Observed reply edges follow the edge the other way
+		return graph.Edges[i].Initiator == graph.Edges[i].From && graph.Edges[j].Initiator != graph.Edges[j].From
 	})
 
 	return graph
 }
 
+// ToJSON serializes the graph as indented JSON for programmatic consumers.
+// Nodes are ordered by ID and edges by source then destination, as produced
+// by GenerateGraph, so output is stable between runs.
+func (g *Graph) ToJSON() ([]byte, error) {
+	data, err := json.MarshalIndent(g, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal graph to JSON: %w", err)
+	}
+	return data, nil
+}
+
+// Mermaid flowchart directions
+const (
+	DirectionTopDown   = "TD"
+	DirectionLeftRight = "LR"
+)
+
+// Default Mermaid diagram limits. Larger diagrams often fail to render
+// with Mermaid's "Maximum text size" error.
+const (
+	DefaultMaxNodes = 50
+	DefaultMaxEdges = 100
+)
+
+// MermaidOptions controls how a graph is rendered as a Mermaid diagram
+type MermaidOptions struct {
+	// Direction is the flowchart layout, DirectionTopDown (the default) or
+	// DirectionLeftRight, which often reads better for service chains
+	Direction string
+
+	// MaxNodes and MaxEdges limit the diagram size (default:
+	// DefaultMaxNodes and DefaultMaxEdges). Larger graphs are reduced to
+	// their busiest nodes and edges.
+	MaxNodes int
+	MaxEdges int
+
+	// Flat draws every node at the top level instead of grouping pods into
+	// one subgraph per namespace
+	Flat bool
+}
+
 // ToMermaid generates a Mermaid diagram string from the graph.
 // Returns a Mermaid flowchart syntax string that can be rendered
 // in HTML using the Mermaid.js library.
 // Limits diagram size to prevent Mermaid "Maximum text size" errors.
 func (g *Graph) ToMermaid() string {
+	return g.ToMermaidWithOptions(MermaidOptions{})
+}
+
+// ToMermaidWithOptions generates a Mermaid diagram string like ToMermaid,
+// using the given rendering options
+func (g *Graph) ToMermaidWithOptions(opts MermaidOptions) string {
 	// Mermaid has limits on diagram complexity
 	// Limit to reasonable sizes to prevent rendering errors
-	maxNodes := 50
-	maxEdges := 100
+	maxNodes := opts.MaxNodes
+	if maxNodes <= 0 {
+		maxNodes = DefaultMaxNodes
+	}
+	maxEdges := opts.MaxEdges
+	if maxEdges <= 0 {
+		maxEdges = DefaultMaxEdges
+	}
 
 	// If graph is too large, create a simplified version
 	if len(g.Nodes) > maxNodes || len(g.Edges) > maxEdges {
-		return g.ToMermaidSimplified(maxNodes, maxEdges)
+		return g.toMermaidSimplified(maxNodes, maxEdges, opts)
 	}
 
 	var sb strings.Builder
-	sb.WriteString("graph TD\n")
+	sb.WriteString(mermaidHeader(opts, g.Nodes))
 
-	// Add nodes
-	for _, node := range g.Nodes {
-		nodeLabel := fmt.Sprintf("%s[%s]", node.ID, node.Label)
-		if node.Namespace != "" {
-			nodeLabel = fmt.Sprintf("%s[%s<br/>ns: %s]", node.ID, node.Label, node.Namespace)
-		}
-		sb.WriteString(fmt.Sprintf("    %s\n", nodeLabel))
-	}
+	writeMermaidNodes(&sb, g.Nodes, opts)
 
 	// Add edges
 	for _, edge := range g.Edges {
-		edgeLabel := edge.Label
-		if edgeLabel == "" {
-			edgeLabel = fmt.Sprintf("%s:%d", edge.Protocol, edge.Port)
-		}
-		// Escape special characters in edge labels
-		edgeLabel = strings.ReplaceAll(edgeLabel, "|", "\\|")
-		sb.WriteString(fmt.Sprintf("    %s -->|%s| %s\n", edge.From, edgeLabel, edge.To))
+		sb.WriteString(fmt.Sprintf("    %s\n", formatMermaidEdge(edge)))
 	}
 
 	return sb.String()
 }
 
-// ToMermaidSimplified generates a simplified Mermaid diagram for large graphs
+// ToMermaidSimplified generates a simplified Mermaid diagram for large
+// graphs, showing the maxNodes nodes with the most connections and, among
+// the edges between them, the maxEdges with the most flows
 func (g *Graph) ToMermaidSimplified(maxNodes, maxEdges int) string {
-	var sb strings.Builder
+	return g.toMermaidSimplified(maxNodes, maxEdges, MermaidOptions{})
+}
+
+func (g *Graph) toMermaidSimplified(maxNodes, maxEdges int, opts MermaidOptions) string {
+	nodes := g.busiestNodes(maxNodes)
+	nodeSet := make(map[string]bool, len(nodes))
+	for _, node := range nodes {
+		nodeSet[node.ID] = true
+	}
 
-	sb.WriteString("graph TD\n")
+	// Only edges between nodes we're showing
+	candidates := make([]Edge, 0, len(g.Edges))
+	for _, edge := range g.Edges {
+		if nodeSet[edge.From] && nodeSet[edge.To] {
+			candidates = append(candidates, edge)
+		}
+	}
+	edges := (&Graph{Edges: candidates}).BusiestEdges(maxEdges)
+
+	var sb strings.Builder
+	sb.WriteString(mermaidHeader(opts, nodes))
 	sb.WriteString(fmt.Sprintf("    note1[\"⚠️ Graph Simplified<br/>Too many nodes/edges to display<br/>"))
 	sb.WriteString(fmt.Sprintf("Total: %d nodes, %d edges<br/>", len(g.Nodes), len(g.Edges)))
-	sb.WriteString(fmt.Sprintf("Showing: %d nodes, %d edges\"]\n", maxNodes, maxEdges))
+	sb.WriteString(fmt.Sprintf("Showing the busiest %d nodes, %d edges\"]\n", len(nodes), len(edges)))
+
+	writeMermaidNodes(&sb, nodes, opts)
+	for _, edge := range edges {
+		sb.WriteString(fmt.Sprintf("    %s\n", formatMermaidEdge(edge)))
+	}
 
-	// Add limited nodes
-	nodeCount := 0
-	for _, node := range g.Nodes {
-		if nodeCount >= maxNodes {
-			break
+	return sb.String()
+}
+
+// busiestNodes returns up to n nodes with the most edges, breaking ties by
+// total flow count. The result keeps the graph's node order.
+func (g *Graph) busiestNodes(n int) []Node {
+	if n < 0 || len(g.Nodes) <= n {
+		return g.Nodes
+	}
+
+	degree := make(map[string]int)
+	flows := make(map[string]int)
+	for _, edge := range g.Edges {
+		degree[edge.From]++
+		flows[edge.From] += edge.Count
+		if edge.To != edge.From {
+			degree[edge.To]++
+			flows[edge.To] += edge.Count
 		}
-		nodeLabel := fmt.Sprintf("%s[%s]", node.ID, node.Label)
-		if node.Namespace != "" {
-			nodeLabel = fmt.Sprintf("%s[%s<br/>ns: %s]", node.ID, node.Label, node.Namespace)
+	}
+
+	ranked := make([]int, len(g.Nodes))
+	for i := range ranked {
+		ranked[i] = i
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		a, b := g.Nodes[ranked[i]].ID, g.Nodes[ranked[j]].ID
+		if degree[a] != degree[b] {
+			return degree[a] > degree[b]
 		}
-		sb.WriteString(fmt.Sprintf("    %s\n", nodeLabel))
-		nodeCount++
+		return flows[a] > flows[b]
+	})
+	ranked = ranked[:n]
+	sort.Ints(ranked)
+
+	nodes := make([]Node, 0, n)
+	for _, i := range ranked {
+		nodes = append(nodes, g.Nodes[i])
 	}
+	return nodes
+}
+
+// mermaidExternalClass styles external nodes with a dashed outline
+const mermaidExternalClass = "classDef external fill:#fff7e6,stroke:#d97706,stroke-dasharray:4 2"
 
-	// Add limited edges (only between nodes we're showing)
-	nodeSet := make(map[string]bool)
-	for i := 0; i < nodeCount && i < len(g.Nodes); i++ {
-		nodeSet[g.Nodes[i].ID] = true
+// mermaidHeader returns the flowchart declaration line, defaulting to a
+// top-down layout, followed by the external class if any of nodes is
+// external
+func mermaidHeader(opts MermaidOptions, nodes []Node) string {
+	direction := opts.Direction
+	if direction == "" {
+		direction = DirectionTopDown
+	}
+	header := fmt.Sprintf("graph %s\n", direction)
+	for _, node := range nodes {
+		if node.Type == "external" {
+			return header + "    " + mermaidExternalClass + "\n"
+		}
 	}
+	return header
+}
 
-	edgeCount := 0
-	for _, edge := range g.Edges {
-		if edgeCount >= maxEdges {
-			break
+// writeMermaidNodes writes node declarations, grouping pods into one
+// subgraph per namespace unless opts.Flat is set. Nodes without a namespace
+// (hosts and external endpoints) stay at the top level. Edges are drawn
+// after the subgraphs, so cross-namespace edges connect nodes in different
+// subgraphs.
+func writeMermaidNodes(sb *strings.Builder, nodes []Node, opts MermaidOptions) {
+	if opts.Flat {
+		for _, node := range nodes {
+			sb.WriteString(fmt.Sprintf("    %s\n", formatMermaidNode(node, true)))
 		}
-		if nodeSet[edge.From] && nodeSet[edge.To] {
-			edgeLabel := edge.Label
-			if edgeLabel == "" {
-				edgeLabel = fmt.Sprintf("%s:%d", edge.Protocol, edge.Port)
-			}
-			edgeLabel = strings.ReplaceAll(edgeLabel, "|", "\\|")
-			sb.WriteString(fmt.Sprintf("    %s -->|%s| %s\n", edge.From, edgeLabel, edge.To))
-			edgeCount++
+		return
+	}
+
+	var namespaces []string
+	byNamespace := make(map[string][]Node)
+	for _, node := range nodes {
+		if node.Namespace == "" {
+			sb.WriteString(fmt.Sprintf("    %s\n", formatMermaidNode(node, false)))
+			continue
 		}
+		if _, seen := byNamespace[node.Namespace]; !seen {
+			namespaces = append(namespaces, node.Namespace)
+		}
+		byNamespace[node.Namespace] = append(byNamespace[node.Namespace], node)
+	}
+	sort.Strings(namespaces)
+
+	for _, namespace := range namespaces {
+		// Node IDs never contain "_", so the subgraph ID cannot clash with one
+		title := sanitizeID(namespace)
+		sb.WriteString(fmt.Sprintf("    subgraph ns_%s [%s]\n", title, title))
+		for _, node := range byNamespace[namespace] {
+			sb.WriteString(fmt.Sprintf("        %s\n", formatMermaidNode(node, false)))
+		}
+		sb.WriteString("    end\n")
 	}
+}
 
-	return sb.String()
+// formatMermaidNode renders a node declaration. Host nodes are drawn as
+// hexagons and external nodes as stadiums in the external class to set
+// them apart from pods, and pod nodes show their workload when known.
+// showNamespace adds the namespace to the label, for diagrams without
+// namespace subgraphs.
+func formatMermaidNode(node Node, showNamespace bool) string {
+	label := node.Label
+	if showNamespace && node.Namespace != "" {
+		label = fmt.Sprintf("%s<br/>ns: %s", node.Label, node.Namespace)
+	}
+	if node.Workload != "" {
+		label = fmt.Sprintf("%s<br/>%s", label, node.Workload)
+	}
+	switch node.Type {
+	case "host":
+		return fmt.Sprintf("%s{{%s}}", node.ID, label)
+	case "external":
+		// Quoted, since IPv6 addresses and DNS names may contain
+		// characters Mermaid treats as syntax
+		return fmt.Sprintf("%s([\"%s\"]):::external", node.ID, label)
+	}
+	return fmt.Sprintf("%s[%s]", node.ID, label)
+}
+
+// trafficLabel describes a flow's traffic on an edge as protocol:port, e.g.
+// "TCP:8080", or by ICMP type for ICMP, which has no ports. It is empty for
+// flows without an L4 protocol.
+func trafficLabel(flow *hubble.ParsedFlow, port uint16) string {
+	switch {
+	case flow.IsICMP():
+		return fmt.Sprintf("%s type %d", flow.Protocol, flow.ICMPType)
+	case flow.Protocol == "":
+		return ""
+	case port == 0:
+		return flow.Protocol
+	}
+	return fmt.Sprintf("%s:%d", flow.Protocol, port)
+}
+
+// formatMermaidEdge renders an edge, annotating its label with the flow
+// count when more than one flow was observed. Edges not drawn from their
+// initiator, i.e. observed replies, are dotted.
+func formatMermaidEdge(edge Edge) string {
+	edgeLabel := edge.Label
+	if edgeLabel == "" && edge.Protocol != "" {
+		edgeLabel = fmt.Sprintf("%s:%d", edge.Protocol, edge.Port)
+	}
+	if edge.Count > 1 {
+		edgeLabel = strings.TrimSpace(fmt.Sprintf("%s (×%d)", edgeLabel, edge.Count))
+	}
+	arrow := "-->"
+	if edge.Initiator != "" && edge.Initiator != edge.From {
+		arrow = "-.->"
+	}
+	// Flows without an L4 protocol leave nothing to label the edge with
+	if edgeLabel == "" {
+		return fmt.Sprintf("%s %s %s", edge.From, arrow, edge.To)
+	}
+	// Escape special characters in edge labels
+	edgeLabel = strings.ReplaceAll(edgeLabel, "|", "\\|")
+	return fmt.Sprintf("%s %s|%s| %s", edge.From, arrow, edgeLabel, edge.To)
+}
+
+// BusiestEdges returns up to n edges with the highest flow counts, busiest first
+func (g *Graph) BusiestEdges(n int) []Edge {
+	edges := make([]Edge, len(g.Edges))
+	copy(edges, g.Edges)
+	sort.SliceStable(edges, func(i, j int) bool {
+		return edges[i].Count > edges[j].Count
+	})
+	if n >= 0 && len(edges) > n {
+		edges = edges[:n]
+	}
+	return edges
+}
+
+// sourceNode creates the node for a flow's source, reporting false if the
+// source cannot be identified. Clients outside the cluster are external
+// nodes named by IP.
+func sourceNode(flow *hubble.ParsedFlow) (Node, bool) {
+	if flow.SourceNamespace == "" && flow.SourceEntity == "" {
+		if flow.IsExternalSource() {
+			return externalNode(flow.SourceIP), true
+		}
+		if _, world := flow.SourceLabels["reserved:world"]; world {
+			return externalNode("world"), true
+		}
+	}
+	if len(flow.SourceLabels) == 0 && flow.SourceEntity == "" {
+		return Node{}, false
+	}
+	return newNode(flow.SourceLabels, flow.SourceNamespace, flow.SourceEntity), true
+}
+
+// destinationNode creates the node for a flow's destination, reporting
+// false if the destination cannot be identified. Destinations outside the
+// cluster are external nodes named by DNS name, or IP if there is none.
+func destinationNode(flow *hubble.ParsedFlow) (Node, bool) {
+	if flow.IsExternalDestination() {
+		switch {
+		case flow.DestDNSName != "":
+			return externalNode(flow.DestDNSName), true
+		case flow.DestIP != "":
+			return externalNode(flow.DestIP), true
+		}
+		if _, world := flow.DestLabels["reserved:world"]; world {
+			return externalNode("world"), true
+		}
+		return Node{}, false
+	}
+	if len(flow.DestLabels) == 0 && flow.DestEntity == "" {
+		return Node{}, false
+	}
+	return newNode(flow.DestLabels, flow.DestNamespace, flow.DestEntity), true
+}
+
+// externalNode creates a node for an endpoint outside the cluster, named
+// by its DNS name or IP, or "world" when neither is known
+func externalNode(name string) Node {
+	return Node{
+		ID:    sanitizeID("external-" + name),
+		Label: name,
+		Type:  "external",
+	}
+}
+
+// newNode creates a node for a flow endpoint. Endpoints that are a Cilium
+// host entity (the node or a host-network pod) collapse into a single
+// host-typed node per entity, since they share the node's identity.
+func newNode(labels map[string]string, namespace string, entity string) Node {
+	if entity != "" {
+		return Node{
+			ID:    sanitizeID("entity-" + entity),
+			Label: entity,
+			Type:  "host",
+		}
+	}
+	return Node{
+		ID:        getNodeID(labels, namespace),
+		Label:     getNodeLabel(labels),
+		Namespace: namespace,
+		Type:      "pod",
+	}
+}
+
+// withPod keys a pod node on its pod name rather than its labels, keeping
+// the labels and workload as metadata. Host nodes and nodes without a pod
+// name are returned unchanged.
+func withPod(node Node, podName, workload string, labels map[string]string) Node {
+	if node.Type != "pod" || podName == "" {
+		return node
+	}
+	// The "pod-" prefix keeps pod IDs apart from label-keyed IDs
+	node.ID = sanitizeID(fmt.Sprintf("pod-%s-%s", node.Namespace, podName))
+	node.Label = podName
+	node.PodName = podName
+	node.Workload = workload
+	node.Labels = labels
+	return node
 }
 
 // getNodeID creates a unique ID for a node based on labels and namespace
@@ -0,0 +1,480 @@
+package graph
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/prabhakaran-jm/cilium-policypilot/internal/hubble"
+)
+
+func TestGenerateGraphHostNetwork(t *testing.T) {
+	flows := []*hubble.ParsedFlow{
+		{
+			SourceLabels:    map[string]string{"reserved:host": ""},
+			SourceNamespace: "kube-system",
+			SourceEntity:    "host",
+			DestLabels:      map[string]string{"k8s:app": "catalog"},
+			DestNamespace:   "default",
+			DestPort:        8080,
+			Protocol:        "TCP",
+		},
+	}
+
+	g := GenerateGraph(flows)
+	if len(g.Nodes) != 2 {
+		t.Fatalf("Expected 2 nodes, got %d", len(g.Nodes))
+	}
+
+	var host *Node
+	for i := range g.Nodes {
+		if g.Nodes[i].Type == "host" {
+			host = &g.Nodes[i]
+		}
+	}
+	if host == nil {
+		t.Fatalf("Expected a host-typed node, got %+v", g.Nodes)
+	}
+	if host.Label != "host" {
+		t.Errorf("Expected host node label 'host', got '%s'", host.Label)
+	}
+
+	mermaid := g.ToMermaid()
+	if !strings.Contains(mermaid, host.ID+"{{host}}") {
+		t.Errorf("Expected host node rendered as a hexagon, got:\n%s", mermaid)
+	}
+}
+
+func TestGenerateGraphExternal(t *testing.T) {
+	catalog := map[string]string{"k8s:app": "catalog"}
+	flows := []*hubble.ParsedFlow{
+		{
+			SourceLabels:    catalog,
+			SourceNamespace: "default",
+			DestLabels:      map[string]string{"reserved:world": ""},
+			DestIP:          "140.82.112.3",
+			DestDNSName:     "api.github.com",
+			DestPort:        443,
+			Protocol:        "TCP",
+		},
+		{
+			SourceLabels:    catalog,
+			SourceNamespace: "default",
+			DestLabels:      map[string]string{"cidr:10.20.0.0/16": ""},
+			DestIP:          "10.20.1.5",
+			DestPort:        5432,
+			Protocol:        "TCP",
+		},
+		{
+			SourceLabels:  map[string]string{"reserved:world": ""},
+			SourceIP:      "203.0.113.10",
+			DestLabels:    catalog,
+			DestNamespace: "default",
+			DestPort:      8080,
+			Protocol:      "TCP",
+		},
+		// Nothing identifies the destination
+		{
+			SourceLabels:    catalog,
+			SourceNamespace: "default",
+			DestPort:        53,
+			Protocol:        "UDP",
+		},
+	}
+
+	g := GenerateGraph(flows)
+
+	external := make(map[string]Node)
+	for _, node := range g.Nodes {
+		if node.Type == "external" {
+			external[node.Label] = node
+		}
+	}
+	for _, label := range []string{"api.github.com", "10.20.1.5", "203.0.113.10"} {
+		if _, exists := external[label]; !exists {
+			t.Errorf("Expected an external node labelled %s, got %+v", label, g.Nodes)
+		}
+	}
+	if len(g.Nodes) != 4 || len(g.Edges) != 3 {
+		t.Errorf("Expected 4 nodes and 3 edges, got %+v and %+v", g.Nodes, g.Edges)
+	}
+
+	mermaid := g.ToMermaid()
+	github := external["api.github.com"]
+	if !strings.Contains(mermaid, github.ID+`(["api.github.com"]):::external`) {
+		t.Errorf("Expected external node rendered as a stadium in the external class, got:\n%s", mermaid)
+	}
+	if !strings.Contains(mermaid, "classDef external") {
+		t.Errorf("Expected the external class to be defined, got:\n%s", mermaid)
+	}
+
+	// Graphs without external nodes don't define the class
+	if mermaid := GenerateGraph(flows[:0]).ToMermaid(); strings.Contains(mermaid, "classDef") {
+		t.Errorf("Expected no class definitions without external nodes, got:\n%s", mermaid)
+	}
+}
+
+func TestGenerateGraphPodDetail(t *testing.T) {
+	frontend := map[string]string{"k8s:app": "frontend"}
+	catalog := map[string]string{"k8s:app": "catalog"}
+
+	flows := []*hubble.ParsedFlow{
+		{SourceLabels: frontend, SourceNamespace: "shop", SourcePod: "frontend-1", DestLabels: catalog, DestNamespace: "shop", DestPod: "catalog-a", DestWorkload: "Deployment/catalog", DestPort: 8080, Protocol: "TCP"},
+		{SourceLabels: frontend, SourceNamespace: "shop", SourcePod: "frontend-1", DestLabels: catalog, DestNamespace: "shop", DestPod: "catalog-b", DestWorkload: "Deployment/catalog", DestPort: 8080, Protocol: "TCP"},
+		// Endpoints without a pod name fall back to their labels
+		{SourceLabels: frontend, SourceNamespace: "shop", DestLabels: catalog, DestNamespace: "shop", DestPort: 8080, Protocol: "TCP"},
+	}
+
+	tests := []struct {
+		name     string
+		detail   string
+		expected []string
+	}{
+		{
+			name:     "app",
+			detail:   DetailApp,
+			expected: []string{"shop-catalog", "shop-frontend"},
+		},
+		{
+			name:     "pod",
+			detail:   DetailPod,
+			expected: []string{"pod-shop-catalog-a", "pod-shop-catalog-b", "pod-shop-frontend-1", "shop-catalog", "shop-frontend"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := GenerateGraphWithOptions(flows, Options{Detail: tt.detail})
+			var ids []string
+			for _, node := range g.Nodes {
+				ids = append(ids, node.ID)
+			}
+			if strings.Join(ids, ",") != strings.Join(tt.expected, ",") {
+				t.Errorf("Node IDs = %v, want %v", ids, tt.expected)
+			}
+		})
+	}
+
+	g := GenerateGraphWithOptions(flows, Options{Detail: DetailPod})
+	node := g.Nodes[0]
+	if node.Label != "catalog-a" || node.PodName != "catalog-a" || node.Workload != "Deployment/catalog" || node.Labels["k8s:app"] != "catalog" {
+		t.Errorf("Expected pod node metadata for catalog-a, got %+v", node)
+	}
+	if mermaid := g.ToMermaid(); !strings.Contains(mermaid, "pod-shop-catalog-a[catalog-a<br/>Deployment/catalog]") {
+		t.Errorf("Expected pod node labelled with its workload, got:\n%s", mermaid)
+	}
+}
+
+func TestGenerateGraphEdgeCount(t *testing.T) {
+	frontend := map[string]string{"k8s:app": "frontend"}
+	catalog := map[string]string{"k8s:app": "catalog"}
+	database := map[string]string{"k8s:app": "database"}
+
+	flows := []*hubble.ParsedFlow{
+		{SourceLabels: frontend, SourceNamespace: "default", DestLabels: catalog, DestNamespace: "default", DestPort: 8080, Protocol: "TCP", Count: 40},
+		{SourceLabels: frontend, SourceNamespace: "default", DestLabels: catalog, DestNamespace: "default", DestPort: 9090, Protocol: "TCP", Count: 2},
+		{SourceLabels: catalog, SourceNamespace: "default", DestLabels: database, DestNamespace: "default", DestPort: 5432, Protocol: "TCP"},
+	}
+
+	g := GenerateGraph(flows)
+	if len(g.Edges) != 2 {
+		t.Fatalf("Expected 2 edges, got %d", len(g.Edges))
+	}
+
+	busiest := g.BusiestEdges(1)
+	if len(busiest) != 1 {
+		t.Fatalf("Expected 1 busiest edge, got %d", len(busiest))
+	}
+	if busiest[0].From != "default-frontend" || busiest[0].Count != 42 {
+		t.Errorf("Expected default-frontend edge with count 42, got %s with %d", busiest[0].From, busiest[0].Count)
+	}
+
+	mermaid := g.ToMermaid()
+	if !strings.Contains(mermaid, "(×42)") {
+		t.Errorf("Expected edge label annotated with flow count, got:\n%s", mermaid)
+	}
+	if strings.Contains(mermaid, "(×1)") {
+		t.Errorf("Expected single-flow edge to be unannotated, got:\n%s", mermaid)
+	}
+}
+
+func TestGenerateGraphICMP(t *testing.T) {
+	probe := map[string]string{"k8s:app": "probe"}
+	catalog := map[string]string{"k8s:app": "catalog"}
+	debug := map[string]string{"k8s:app": "debug"}
+
+	flows := []*hubble.ParsedFlow{
+		{SourceLabels: probe, SourceNamespace: "default", DestLabels: catalog, DestNamespace: "default", Protocol: "ICMP", ICMPType: 8},
+		{SourceLabels: probe, SourceNamespace: "default", DestLabels: catalog, DestNamespace: "default", DestPort: 8080, Protocol: "TCP"},
+		// No L4 protocol: the edge is drawn without a label
+		{SourceLabels: debug, SourceNamespace: "default", DestLabels: catalog, DestNamespace: "default"},
+	}
+
+	g := GenerateGraph(flows)
+	if len(g.Edges) != 2 {
+		t.Fatalf("Expected 2 edges, got %+v", g.Edges)
+	}
+	edge := g.Edges[1]
+	if edge.From != "default-probe" || edge.Label != "ICMP type 8, TCP:8080" || edge.Protocol != "ICMP" || edge.Port != 0 {
+		t.Errorf("Expected probe edge labelled \"ICMP type 8, TCP:8080\", got %+v", edge)
+	}
+
+	mermaid := g.ToMermaid()
+	for _, want := range []string{"default-debug --> default-catalog", "default-probe -->|ICMP type 8, TCP:8080 (×2)| default-catalog"} {
+		if !strings.Contains(mermaid, want) {
+			t.Errorf("Expected %q in:\n%s", want, mermaid)
+		}
+	}
+	if strings.Contains(mermaid, ":0") {
+		t.Errorf("Expected no port 0 in:\n%s", mermaid)
+	}
+}
+
+func TestGenerateGraphReplies(t *testing.T) {
+	frontend := map[string]string{"k8s:app": "frontend"}
+	catalog := map[string]string{"k8s:app": "catalog"}
+	flows := []*hubble.ParsedFlow{
+		{SourceLabels: frontend, SourceNamespace: "default", SourcePort: 40000, DestLabels: catalog, DestNamespace: "default", DestPort: 8080, Protocol: "TCP", Count: 3},
+		{SourceLabels: catalog, SourceNamespace: "default", SourcePort: 8080, DestLabels: frontend, DestNamespace: "default", DestPort: 40000, Protocol: "TCP", IsReply: true, Count: 2},
+		// catalog calls back to frontend on its own
+		{SourceLabels: catalog, SourceNamespace: "default", SourcePort: 41000, DestLabels: frontend, DestNamespace: "default", DestPort: 9090, Protocol: "TCP"},
+	}
+
+	tests := []struct {
+		name     string
+		opts     Options
+		expected []Edge
+	}{
+		{
+			name: "replies count toward the initiator's edge",
+			expected: []Edge{
+				{From: "default-catalog", To: "default-frontend", Port: 9090, Protocol: "TCP", Label: "TCP:9090", Count: 1, Initiator: "default-catalog", Bidirectional: true},
+				{From: "default-frontend", To: "default-catalog", Port: 8080, Protocol: "TCP", Label: "TCP:8080", Count: 5, Initiator: "default-frontend", Bidirectional: true},
+			},
+		},
+		{
+			name: "observed direction keeps replies apart",
+			opts: Options{ObservedDirection: true},
+			expected: []Edge{
+				{From: "default-catalog", To: "default-frontend", Port: 9090, Protocol: "TCP", Label: "TCP:9090", Count: 1, Initiator: "default-catalog", Bidirectional: true},
+				{From: "default-catalog", To: "default-frontend", Port: 40000, Protocol: "TCP", Label: "TCP:40000", Count: 2, Initiator: "default-frontend"},
+				{From: "default-frontend", To: "default-catalog", Port: 8080, Protocol: "TCP", Label: "TCP:8080", Count: 3, Initiator: "default-frontend", Bidirectional: true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := GenerateGraphWithOptions(flows, tt.opts)
+			if !reflect.DeepEqual(g.Edges, tt.expected) {
+				t.Errorf("Edges = %+v, want %+v", g.Edges, tt.expected)
+			}
+		})
+	}
+
+	// Observed replies are dotted
+	mermaid := GenerateGraphWithOptions(flows, Options{ObservedDirection: true}).ToMermaid()
+	if !strings.Contains(mermaid, "default-catalog -.->|TCP:40000 (×2)| default-frontend") {
+		t.Errorf("Expected the reply edge dotted, got:\n%s", mermaid)
+	}
+}
+
+func TestGraphToJSON(t *testing.T) {
+	flows := []*hubble.ParsedFlow{
+		{SourceLabels: map[string]string{"k8s:app": "frontend"}, SourceNamespace: "default", DestLabels: map[string]string{"k8s:app": "catalog"}, DestNamespace: "default", DestPort: 8080, Protocol: "TCP", Count: 3},
+		{SourceLabels: map[string]string{"k8s:app": "catalog"}, SourceNamespace: "default", DestLabels: map[string]string{"k8s:app": "database"}, DestNamespace: "default", DestPort: 5432, Protocol: "TCP"},
+	}
+
+	data, err := GenerateGraph(flows).ToJSON()
+	if err != nil {
+		t.Fatalf("ToJSON() error = %v", err)
+	}
+
+	var decoded struct {
+		Nodes []map[string]interface{} `json:"nodes"`
+		Edges []map[string]interface{} `json:"edges"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("ToJSON() produced invalid JSON: %v\n%s", err, data)
+	}
+
+	nodeIDs := make([]string, 0, len(decoded.Nodes))
+	for _, node := range decoded.Nodes {
+		nodeIDs = append(nodeIDs, node["id"].(string))
+	}
+	expectedIDs := []string{"default-catalog", "default-database", "default-frontend"}
+	if strings.Join(nodeIDs, ",") != strings.Join(expectedIDs, ",") {
+		t.Errorf("Node IDs = %v, want %v", nodeIDs, expectedIDs)
+	}
+	if decoded.Nodes[0]["namespace"] != "default" || decoded.Nodes[0]["type"] != "pod" || decoded.Nodes[0]["label"] != "catalog" {
+		t.Errorf("Unexpected node fields: %v", decoded.Nodes[0])
+	}
+
+	if len(decoded.Edges) != 2 {
+		t.Fatalf("Expected 2 edges, got %d", len(decoded.Edges))
+	}
+	edge := decoded.Edges[1]
+	if edge["from"] != "default-frontend" || edge["to"] != "default-catalog" || edge["port"] != float64(8080) ||
+		edge["protocol"] != "TCP" || edge["label"] != "TCP:8080" || edge["count"] != float64(3) {
+		t.Errorf("Unexpected edge fields: %v", edge)
+	}
+
+	// Output is stable between runs
+	again, _ := GenerateGraph(flows).ToJSON()
+	if string(again) != string(data) {
+		t.Errorf("Expected identical JSON across runs")
+	}
+}
+
+func TestToMermaidDirection(t *testing.T) {
+	flows := []*hubble.ParsedFlow{
+		{
+			SourceLabels:    map[string]string{"k8s:app": "frontend"},
+			SourceNamespace: "default",
+			DestLabels:      map[string]string{"k8s:app": "catalog"},
+			DestNamespace:   "default",
+			DestPort:        8080,
+			Protocol:        "TCP",
+		},
+	}
+	g := GenerateGraph(flows)
+
+	tests := []struct {
+		name     string
+		opts     MermaidOptions
+		expected string
+	}{
+		{name: "default is top-down", opts: MermaidOptions{}, expected: "graph TD\n"},
+		{name: "top-down", opts: MermaidOptions{Direction: DirectionTopDown}, expected: "graph TD\n"},
+		{name: "left-right", opts: MermaidOptions{Direction: DirectionLeftRight}, expected: "graph LR\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if mermaid := g.ToMermaidWithOptions(tt.opts); !strings.HasPrefix(mermaid, tt.expected) {
+				t.Errorf("Expected Mermaid header %q, got:\n%s", tt.expected, mermaid)
+			}
+		})
+	}
+}
+
+func TestToMermaidLimits(t *testing.T) {
+	// "aaa" sorts first but only talks to one peer; "hub" is the busiest node
+	g := &Graph{
+		Nodes: []Node{
+			{ID: "aaa", Label: "aaa", Type: "pod"},
+			{ID: "hub", Label: "hub", Type: "pod"},
+			{ID: "x", Label: "x", Type: "pod"},
+			{ID: "y", Label: "y", Type: "pod"},
+			{ID: "z", Label: "z", Type: "pod"},
+		},
+		Edges: []Edge{
+			{From: "aaa", To: "z", Protocol: "TCP", Port: 80, Count: 1},
+			{From: "x", To: "hub", Protocol: "TCP", Port: 8080, Count: 2},
+			{From: "y", To: "hub", Protocol: "TCP", Port: 8080, Count: 9},
+			{From: "hub", To: "z", Protocol: "TCP", Port: 5432, Count: 4},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		opts       MermaidOptions
+		wantNodes  []string
+		wantEdges  []string
+		simplified bool
+	}{
+		{
+			name:      "within default limits",
+			opts:      MermaidOptions{},
+			wantNodes: []string{"aaa[", "hub[", "x[", "y[", "z["},
+			wantEdges: []string{"aaa -->", "x -->", "y -->", "hub -->"},
+		},
+		{
+			name:       "busiest nodes",
+			opts:       MermaidOptions{MaxNodes: 3},
+			wantNodes:  []string{"hub[", "y[", "z["},
+			wantEdges:  []string{"y -->", "hub -->"},
+			simplified: true,
+		},
+		{
+			name:       "busiest edges",
+			opts:       MermaidOptions{MaxEdges: 2},
+			wantNodes:  []string{"aaa[", "hub[", "x[", "y[", "z["},
+			wantEdges:  []string{"y -->", "hub -->"},
+			simplified: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mermaid := g.ToMermaidWithOptions(tt.opts)
+			if strings.Contains(mermaid, "Graph Simplified") != tt.simplified {
+				t.Errorf("Expected simplified = %v, got:\n%s", tt.simplified, mermaid)
+			}
+
+			var nodes, edges []string
+			for _, line := range strings.Split(mermaid, "\n") {
+				line = strings.TrimSpace(line)
+				switch {
+				case strings.Contains(line, "-->"):
+					edges = append(edges, line[:strings.Index(line, "-->")+3])
+				case strings.Contains(line, "[") && !strings.HasPrefix(line, "note1"):
+					nodes = append(nodes, line[:strings.Index(line, "[")+1])
+				}
+			}
+			if strings.Join(nodes, " ") != strings.Join(tt.wantNodes, " ") {
+				t.Errorf("Nodes = %v, want %v", nodes, tt.wantNodes)
+			}
+			if strings.Join(edges, " ") != strings.Join(tt.wantEdges, " ") {
+				t.Errorf("Edges = %v, want %v", edges, tt.wantEdges)
+			}
+		})
+	}
+}
+
+func TestToMermaidNamespaceSubgraphs(t *testing.T) {
+	flows := []*hubble.ParsedFlow{
+		{SourceLabels: map[string]string{"k8s:app": "frontend"}, SourceNamespace: "web", DestLabels: map[string]string{"k8s:app": "catalog"}, DestNamespace: "shop", DestPort: 8080, Protocol: "TCP"},
+		{SourceLabels: map[string]string{"k8s:app": "catalog"}, SourceNamespace: "shop", DestLabels: map[string]string{"k8s:app": "cart"}, DestNamespace: "shop", DestPort: 7070, Protocol: "TCP"},
+		{SourceEntity: "host", DestLabels: map[string]string{"k8s:app": "catalog"}, DestNamespace: "shop", DestPort: 8080, Protocol: "TCP"},
+	}
+	g := GenerateGraph(flows)
+
+	t.Run("subgraphs", func(t *testing.T) {
+		mermaid := g.ToMermaid()
+		expected := "    subgraph ns_shop [shop]\n" +
+			"        shop-cart[cart]\n" +
+			"        shop-catalog[catalog]\n" +
+			"    end\n" +
+			"    subgraph ns_web [web]\n" +
+			"        web-frontend[frontend]\n" +
+			"    end\n"
+		if !strings.Contains(mermaid, expected) {
+			t.Errorf("Expected namespace subgraphs:\n%s\ngot:\n%s", expected, mermaid)
+		}
+		if !strings.Contains(mermaid, "\n    entity-host{{host}}\n") {
+			t.Errorf("Expected host node outside subgraphs, got:\n%s", mermaid)
+		}
+		if !strings.Contains(mermaid, "web-frontend -->|TCP:8080| shop-catalog") {
+			t.Errorf("Expected cross-namespace edge, got:\n%s", mermaid)
+		}
+	})
+
+	t.Run("flat", func(t *testing.T) {
+		mermaid := g.ToMermaidWithOptions(MermaidOptions{Flat: true})
+		if strings.Contains(mermaid, "subgraph") {
+			t.Errorf("Expected no subgraphs, got:\n%s", mermaid)
+		}
+		if !strings.Contains(mermaid, "shop-catalog[catalog<br/>ns: shop]") {
+			t.Errorf("Expected namespace in node label, got:\n%s", mermaid)
+		}
+	})
+
+	t.Run("sanitized title", func(t *testing.T) {
+		g := &Graph{Nodes: []Node{{ID: "a", Label: "a", Namespace: "Team A.dev", Type: "pod"}}}
+		if mermaid := g.ToMermaid(); !strings.Contains(mermaid, "subgraph ns_team-a-dev [team-a-dev]") {
+			t.Errorf("Expected sanitized subgraph title, got:\n%s", mermaid)
+		}
+	})
+}
@@ -0,0 +1,269 @@
+package hubble
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	flowpb "github.com/cilium/cilium/api/v1/flow"
+	observerpb "github.com/cilium/cilium/api/v1/observer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultAPILast is the number of recent flows requested from the Hubble API
+// when no count is given
+const DefaultAPILast = 1000
+
+// APIOptions configures how flows are read from the Hubble API
+type APIOptions struct {
+	// Number of most recent flows to request (default: DefaultAPILast)
+	Last uint64
+
+	// Keep streaming new flows for this long after the recent ones have been
+	// returned. Zero disables following.
+	Follow time.Duration
+
+	// Use TLS for the connection instead of plaintext
+	TLS bool
+
+	// CA certificate file used to verify the server (default: system roots)
+	TLSCAFile string
+
+	// Server name to verify the certificate against (default: endpoint host)
+	TLSServerName string
+}
+
+// ReadFlowsFromHubbleAPI reads flows directly from the Hubble observer gRPC
+// API (Hubble Relay or a Cilium agent's Hubble server) at endpoint.
+// Requests the last opts.Last flows and, if opts.Follow is set, keeps
+// streaming until it elapses or ctx is cancelled.
+func (r *HubbleReader) ReadFlowsFromHubbleAPI(ctx context.Context, endpoint string, opts APIOptions) (*FlowCollection, error) {
+	if endpoint == "" {
+		return nil, fmt.Errorf("hubble API endpoint is empty")
+	}
+
+	creds, err := transportCredentials(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := grpc.NewClient(endpoint, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to hubble API at %s: %w", endpoint, err)
+	}
+	defer conn.Close()
+
+	last := opts.Last
+	if last == 0 {
+		last = DefaultAPILast
+	}
+
+	if opts.Follow > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Follow)
+		defer cancel()
+	}
+
+	client := observerpb.NewObserverClient(conn)
+	stream, err := client.GetFlows(ctx, &observerpb.GetFlowsRequest{
+		Number: last,
+		Follow: opts.Follow > 0,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to request flows from hubble API: %w", err)
+	}
+
+	collection := &FlowCollection{
+		Schema: CurrentSchema,
+		Flows:  []*Flow{},
+	}
+	for {
+		resp, err := stream.Recv()
+		if err != nil {
+			if errors.Is(err, io.EOF) || (opts.Follow > 0 && isStreamTimeout(err)) {
+				break
+			}
+			return nil, fmt.Errorf("failed to receive flows from hubble API: %w", err)
+		}
+
+		// Node status and lost-event notifications carry no flow
+		if f := resp.GetFlow(); f != nil {
+			collection.Flows = append(collection.Flows, FlowFromProto(f))
+		}
+	}
+
+	return collection, nil
+}
+
+// transportCredentials returns plaintext or TLS credentials for opts
+func transportCredentials(opts APIOptions) (credentials.TransportCredentials, error) {
+	if !opts.TLS {
+		return insecure.NewCredentials(), nil
+	}
+
+	config := &tls.Config{
+		ServerName: opts.TLSServerName,
+		MinVersion: tls.VersionTLS12,
+	}
+	if opts.TLSCAFile != "" {
+		pem, err := os.ReadFile(opts.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read TLS CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in TLS CA file %s", opts.TLSCAFile)
+		}
+		config.RootCAs = pool
+	}
+	return credentials.NewTLS(config), nil
+}
+
+// isStreamTimeout reports whether err is the stream ending because the
+// follow window elapsed
+func isStreamTimeout(err error) bool {
+	switch status.Code(err) {
+	case codes.DeadlineExceeded, codes.Canceled:
+		return true
+	}
+	return errors.Is(err, context.DeadlineExceeded)
+}
+
+// FlowFromProto converts a Hubble observer protobuf flow into a Flow, using
+// the same representation as flows read from `hubble observe -o json`
+func FlowFromProto(f *flowpb.Flow) *Flow {
+	flow := &Flow{
+		Source:           endpointFromProto(f.GetSource()),
+		Destination:      endpointFromProto(f.GetDestination()),
+		Verdict:          f.GetVerdict().String(),
+		Type:             f.GetType().String(),
+		SourceNames:      f.GetSourceNames(),
+		DestinationNames: f.GetDestinationNames(),
+	}
+
+	if ts := f.GetTime(); ts != nil {
+		t := ts.AsTime()
+		flow.Time = &t
+	}
+
+	if reason := f.GetDropReasonDesc(); reason != flowpb.DropReason_DROP_REASON_UNKNOWN {
+		flow.DropReasonDesc = reason.String()
+	}
+
+	if ip := f.GetIP(); ip != nil {
+		flow.IP = &IP{
+			Source:      ip.GetSource(),
+			Destination: ip.GetDestination(),
+		}
+		switch ip.GetIpVersion() {
+		case flowpb.IPVersion_IPv4:
+			flow.IP.IPVersion = 4
+		case flowpb.IPVersion_IPv6:
+			flow.IP.IPVersion = 6
+		}
+	}
+
+	if l4 := f.GetL4(); l4 != nil {
+		if tcp := l4.GetTCP(); tcp != nil {
+			flow.L4 = &Layer4{TCP: &TCP{
+				SourcePort:      uint16(tcp.GetSourcePort()),
+				DestinationPort: uint16(tcp.GetDestinationPort()),
+			}}
+			if flags := tcp.GetFlags(); flags != nil {
+				flow.L4.TCP.Flags = &TCPFlags{
+					SYN: flags.GetSYN(),
+					ACK: flags.GetACK(),
+					FIN: flags.GetFIN(),
+					RST: flags.GetRST(),
+				}
+			}
+		} else if udp := l4.GetUDP(); udp != nil {
+			flow.L4 = &Layer4{UDP: &UDP{
+				SourcePort:      uint16(udp.GetSourcePort()),
+				DestinationPort: uint16(udp.GetDestinationPort()),
+			}}
+		} else if sctp := l4.GetSCTP(); sctp != nil {
+			flow.L4 = &Layer4{SCTP: &SCTP{
+				SourcePort:      uint16(sctp.GetSourcePort()),
+				DestinationPort: uint16(sctp.GetDestinationPort()),
+			}}
+		} else if icmp := l4.GetICMPv4(); icmp != nil {
+			flow.L4 = &Layer4{ICMPv4: &ICMP{Type: icmp.GetType(), Code: icmp.GetCode()}}
+		} else if icmp := l4.GetICMPv6(); icmp != nil {
+			flow.L4 = &Layer4{ICMPv6: &ICMP{Type: icmp.GetType(), Code: icmp.GetCode()}}
+		}
+	}
+
+	if l7 := f.GetL7(); l7 != nil {
+		flow.L7 = &Layer7{}
+		if l7.GetType() != flowpb.L7FlowType_UNKNOWN_L7_TYPE {
+			flow.L7.Type = l7.GetType().String()
+		}
+		if http := l7.GetHttp(); http != nil {
+			flow.L7.HTTP = &HTTP{
+				Code:     http.GetCode(),
+				Method:   http.GetMethod(),
+				URL:      http.GetUrl(),
+				Protocol: http.GetProtocol(),
+			}
+			for _, h := range http.GetHeaders() {
+				flow.L7.HTTP.Headers = append(flow.L7.HTTP.Headers, &HTTPHeader{Key: h.GetKey(), Value: h.GetValue()})
+			}
+		}
+		if dns := l7.GetDns(); dns != nil {
+			flow.L7.DNS = &DNS{
+				Query:  dns.GetQuery(),
+				Rcode:  dns.GetRcode(),
+				Qtypes: dns.GetQtypes(),
+			}
+		}
+		if kafka := l7.GetKafka(); kafka != nil {
+			flow.L7.Kafka = &Kafka{
+				APIKey:    kafka.GetApiKey(),
+				Topic:     kafka.GetTopic(),
+				ErrorCode: kafka.GetErrorCode(),
+			}
+		}
+	}
+
+	if isReply := f.GetIsReply(); isReply != nil {
+		reply := isReply.GetValue()
+		flow.IsReply = &reply
+	}
+
+	if et := f.GetEventType(); et != nil {
+		flow.EventType = &EventType{Type: et.GetType()}
+	}
+
+	return flow
+}
+
+// endpointFromProto converts a protobuf endpoint, returning nil for nil input
+func endpointFromProto(ep *flowpb.Endpoint) *Endpoint {
+	if ep == nil {
+		return nil
+	}
+
+	endpoint := &Endpoint{
+		Labels:    ep.GetLabels(),
+		Namespace: ep.GetNamespace(),
+		PodName:   ep.GetPodName(),
+		Identity:  uint64(ep.GetIdentity()),
+	}
+	for _, w := range ep.GetWorkloads() {
+		endpoint.Workloads = append(endpoint.Workloads, &Workload{
+			Name: w.GetName(),
+			Kind: w.GetKind(),
+		})
+	}
+	return endpoint
+}
@@ -0,0 +1,108 @@
+package hubble
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	flowpb "github.com/cilium/cilium/api/v1/flow"
+	observerpb "github.com/cilium/cilium/api/v1/observer"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// fakeObserver serves a fixed set of GetFlows responses
+type fakeObserver struct {
+	observerpb.UnimplementedObserverServer
+	responses []*observerpb.GetFlowsResponse
+	request   *observerpb.GetFlowsRequest
+}
+
+func (o *fakeObserver) GetFlows(req *observerpb.GetFlowsRequest, stream observerpb.Observer_GetFlowsServer) error {
+	o.request = req
+	for _, resp := range o.responses {
+		if err := stream.Send(resp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestReadFlowsFromHubbleAPI(t *testing.T) {
+	observer := &fakeObserver{
+		responses: []*observerpb.GetFlowsResponse{
+			{ResponseTypes: &observerpb.GetFlowsResponse_LostEvents{LostEvents: &flowpb.LostEvent{NumEventsLost: 3}}},
+			{ResponseTypes: &observerpb.GetFlowsResponse_Flow{Flow: &flowpb.Flow{
+				Verdict: flowpb.Verdict_FORWARDED,
+				IP: &flowpb.IP{
+					Source:      "10.0.1.5",
+					Destination: "10.0.2.7",
+					IpVersion:   flowpb.IPVersion_IPv4,
+				},
+				L4: &flowpb.Layer4{Protocol: &flowpb.Layer4_TCP{TCP: &flowpb.TCP{
+					SourcePort:      54321,
+					DestinationPort: 8080,
+				}}},
+				Source: &flowpb.Endpoint{
+					Identity:  12345,
+					Namespace: "default",
+					Labels:    []string{"k8s:app=frontend"},
+					PodName:   "frontend-abc",
+				},
+				Destination: &flowpb.Endpoint{
+					Namespace: "default",
+					Labels:    []string{"k8s:app=catalog"},
+					Workloads: []*flowpb.Workload{{Name: "catalog", Kind: "Deployment"}},
+				},
+				IsReply: wrapperspb.Bool(false),
+			}}},
+		},
+	}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen() error = %v", err)
+	}
+	server := grpc.NewServer()
+	observerpb.RegisterObserverServer(server, observer)
+	go server.Serve(lis)
+	defer server.Stop()
+
+	reader := NewHubbleReader()
+	collection, err := reader.ReadFlowsFromHubbleAPI(context.Background(), lis.Addr().String(), APIOptions{Last: 50})
+	if err != nil {
+		t.Fatalf("ReadFlowsFromHubbleAPI() error = %v", err)
+	}
+
+	if observer.request.GetNumber() != 50 || observer.request.GetFollow() {
+		t.Errorf("Expected request for last 50 flows without follow, got %v", observer.request)
+	}
+	if len(collection.Flows) != 1 {
+		t.Fatalf("Expected 1 flow, got %d", len(collection.Flows))
+	}
+
+	pf, err := ParseFlow(collection.Flows[0])
+	if err != nil {
+		t.Fatalf("ParseFlow() error = %v", err)
+	}
+	if pf.Protocol != "TCP" || pf.DestPort != 8080 {
+		t.Errorf("Expected TCP/8080, got %s/%d", pf.Protocol, pf.DestPort)
+	}
+	if pf.SourceLabels["k8s:app"] != "frontend" || pf.DestLabels["k8s:app"] != "catalog" {
+		t.Errorf("Unexpected labels: source %v, destination %v", pf.SourceLabels, pf.DestLabels)
+	}
+	if pf.SourceIP != "10.0.1.5" || pf.DestIP != "10.0.2.7" {
+		t.Errorf("SourceIP/DestIP = %s/%s, want 10.0.1.5/10.0.2.7", pf.SourceIP, pf.DestIP)
+	}
+	if pf.Verdict != "FORWARDED" {
+		t.Errorf("Verdict = %s, want FORWARDED", pf.Verdict)
+	}
+
+	flow := collection.Flows[0]
+	if flow.IsReply == nil || *flow.IsReply {
+		t.Errorf("Expected IsReply = false, got %v", flow.IsReply)
+	}
+	if len(flow.Destination.Workloads) != 1 || flow.Destination.Workloads[0].Kind != "Deployment" {
+		t.Errorf("Expected Deployment workload, got %v", flow.Destination.Workloads)
+	}
+}
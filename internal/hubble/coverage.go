@@ -0,0 +1,91 @@
+package hubble
+
+// Coverage measures how complete a capture looks. Counts are weighted by
+// Occurrences.
+type Coverage struct {
+	Flows int
+	// CompleteFlows counts flows with both endpoints identified (by labels,
+	// entity, IP or DNS name) and an L4 protocol
+	CompleteFlows int
+	// SourceOnly and DestinationOnly name the pods seen only opening
+	// connections or only accepting them, as in PortExposure, sorted. Either
+	// may mean traffic in the other direction was not captured.
+	SourceOnly      []string
+	DestinationOnly []string
+}
+
+// Ratio returns the share of complete flows, from 0 to 1, or 1 if there
+// are no flows
+func (c *Coverage) Ratio() float64 {
+	if c.Flows == 0 {
+		return 1
+	}
+	return float64(c.CompleteFlows) / float64(c.Flows)
+}
+
+// ComputeCoverage measures the coverage of flows. Reply flows count toward
+// the pod that opened the connection, so a server answering its clients is
+// not taken to open connections.
+func ComputeCoverage(flows []*ParsedFlow) *Coverage {
+	coverage := &Coverage{}
+	clients := make(map[string]bool)
+	servers := make(map[string]bool)
+
+	for _, flow := range flows {
+		count := flow.Occurrences()
+		coverage.Flows += count
+		if isCompleteFlow(flow) {
+			coverage.CompleteFlows += count
+		}
+
+		client, server := sourcePod(flow), destinationPod(flow)
+		if flow.IsReply {
+			client, server = server, client
+		}
+		if client != "" {
+			clients[client] = true
+		}
+		if server != "" {
+			servers[server] = true
+		}
+	}
+
+	coverage.SourceOnly = namesOnlyIn(clients, servers)
+	coverage.DestinationOnly = namesOnlyIn(servers, clients)
+	return coverage
+}
+
+// isCompleteFlow reports whether both of a flow's endpoints are identified
+// and its L4 protocol is known
+func isCompleteFlow(flow *ParsedFlow) bool {
+	source := len(flow.SourceLabels) > 0 || flow.SourceEntity != "" || flow.SourceIP != ""
+	dest := len(flow.DestLabels) > 0 || flow.DestEntity != "" || flow.DestIP != "" || flow.DestDNSName != ""
+	return source && dest && flow.Protocol != ""
+}
+
+// sourcePod names a flow's source if it is a pod, or returns ""
+func sourcePod(flow *ParsedFlow) string {
+	if flow.SourceNamespace == "" || flow.SourceEntity != "" {
+		return ""
+	}
+	return sourceName(flow)
+}
+
+// destinationPod names a flow's destination if it is a pod, or returns ""
+func destinationPod(flow *ParsedFlow) string {
+	if flow.DestNamespace == "" || flow.DestEntity != "" {
+		return ""
+	}
+	return destinationName(flow)
+}
+
+// namesOnlyIn returns the names in set that are not in other, sorted
+func namesOnlyIn(set, other map[string]bool) []string {
+	only := make(map[string]bool)
+	for name := range set {
+		if !other[name] {
+			only[name] = true
+		}
+	}
+	return sortedNames(only)
+}
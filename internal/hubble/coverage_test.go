@@ -0,0 +1,43 @@
+package hubble
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestComputeCoverage(t *testing.T) {
+	pod := func(app string) map[string]string {
+		return map[string]string{"k8s:app": app}
+	}
+	flows := []*ParsedFlow{
+		{SourceLabels: pod("loadgen"), SourceNamespace: "shop", DestLabels: pod("frontend"), DestNamespace: "shop", DestPort: 8080, Protocol: "TCP", Count: 4},
+		{SourceLabels: pod("frontend"), SourceNamespace: "shop", DestLabels: pod("catalog"), DestNamespace: "shop", DestPort: 8080, Protocol: "TCP"},
+		// A reply from the database counts toward catalog opening the
+		// connection
+		{SourceLabels: pod("database"), SourceNamespace: "shop", DestLabels: pod("catalog"), DestNamespace: "shop", SourcePort: 5432, Protocol: "TCP", IsReply: true},
+		// External peers and host endpoints are not pods
+		{SourceIP: "203.0.113.10", DestLabels: pod("frontend"), DestNamespace: "shop", DestPort: 8080, Protocol: "TCP"},
+		{SourceLabels: pod("catalog"), SourceNamespace: "shop", DestEntity: "host", DestLabels: map[string]string{"reserved:host": ""}, DestPort: 10250, Protocol: "TCP"},
+		// Incomplete: no L4, and no destination
+		{SourceLabels: pod("frontend"), SourceNamespace: "shop", DestLabels: pod("catalog"), DestNamespace: "shop"},
+		{SourceLabels: pod("frontend"), SourceNamespace: "shop", DestPort: 53, Protocol: "UDP", Count: 2},
+	}
+
+	expected := &Coverage{
+		Flows:           11,
+		CompleteFlows:   8,
+		SourceOnly:      []string{"shop/loadgen"},
+		DestinationOnly: []string{"shop/database"},
+	}
+	coverage := ComputeCoverage(flows)
+	if !reflect.DeepEqual(coverage, expected) {
+		t.Errorf("ComputeCoverage() = %+v, want %+v", coverage, expected)
+	}
+	if ratio := coverage.Ratio(); ratio < 0.72 || ratio > 0.73 {
+		t.Errorf("Ratio() = %v, want 8/11", ratio)
+	}
+
+	if ratio := ComputeCoverage(nil).Ratio(); ratio != 1 {
+		t.Errorf("Ratio() without flows = %v, want 1", ratio)
+	}
+}
@@ -0,0 +1,144 @@
+package hubble
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+)
+
+// FlowDeduper tracks which flows have been seen by fingerprint. Only a
+// fixed-size hash is kept per unique flow, so memory grows with the number
+// of distinct flows rather than the size of the capture.
+type FlowDeduper struct {
+	seen  map[[16]byte]struct{}
+	total int
+}
+
+// NewFlowDeduper creates an empty FlowDeduper
+func NewFlowDeduper() *FlowDeduper {
+	return &FlowDeduper{
+		seen: make(map[[16]byte]struct{}),
+	}
+}
+
+// Add records a flow and reports whether it is the first with its fingerprint
+func (d *FlowDeduper) Add(flow *ParsedFlow) bool {
+	d.total++
+	fp := FlowFingerprint(flow)
+	if _, exists := d.seen[fp]; exists {
+		return false
+	}
+	d.seen[fp] = struct{}{}
+	return true
+}
+
+// Total returns the number of flows added so far
+func (d *FlowDeduper) Total() int {
+	return d.total
+}
+
+// Unique returns the number of distinct flows added so far
+func (d *FlowDeduper) Unique() int {
+	return len(d.seen)
+}
+
+// FlowFingerprint returns a hash of the fields that matter for policy
+// generation: source and destination identity, port, protocol, verdict and
+// drop reason, reply direction, and HTTP request. Pod names and IPs of in-cluster
+// endpoints are excluded so replicas of the same workload collapse; IPs of
+// endpoints outside the cluster are kept, as they are their only identity.
+func FlowFingerprint(flow *ParsedFlow) [16]byte {
+	h := fnv.New128a()
+	h.Write([]byte(flowFingerprintKey(flow)))
+
+	var fp [16]byte
+	copy(fp[:], h.Sum(nil))
+	return fp
+}
+
+// flowFingerprintKey builds the canonical string hashed by FlowFingerprint
+func flowFingerprintKey(flow *ParsedFlow) string {
+	// External endpoints have no labels to tell them apart, so their
+	// address (and a destination's DNS name) is part of their identity
+	sourceIP, destIP := "", ""
+	if flow.IsExternalSource() {
+		sourceIP = flow.SourceIP
+	}
+	if flow.IsExternalDestination() {
+		destIP = flow.DestIP
+	}
+
+	return strings.Join([]string{
+		sourceIP,
+		flow.SourceNamespace,
+		canonicalLabels(flow.SourceLabels),
+		flow.SourceEntity,
+		flow.DestNamespace,
+		canonicalLabels(flow.DestLabels),
+		flow.DestEntity,
+		destIP,
+		flow.DestDNSName,
+		fmt.Sprintf("%d/%s/%d", flow.DestPort, NormalizeProtocol(flow.Protocol), flow.ICMPType),
+		flow.DestPortName,
+		flow.Verdict,
+		flow.DropReason,
+		fmt.Sprintf("%t", flow.IsReply),
+		flow.L7Protocol,
+		flow.HTTPMethod,
+		flow.HTTPPath,
+	}, "\x00")
+}
+
+// canonicalLabels renders labels as sorted key=value pairs
+func canonicalLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// DeduplicateFlows collapses flows with the same fingerprint (see
+// FlowFingerprint) into a single entry whose Count is the sum of the merged
+// flows' counts and whose Time and LastTime span their timestamps. Allowed
+// and denied flows are never merged. The first occurrence of each flow is
+// kept, in input order.
+func DeduplicateFlows(flows []*ParsedFlow) []*ParsedFlow {
+	result := make([]*ParsedFlow, 0, len(flows))
+	index := make(map[[16]byte]*ParsedFlow, len(flows))
+
+	for _, flow := range flows {
+		fp := FlowFingerprint(flow)
+		if existing, exists := index[fp]; exists {
+			existing.Count = existing.Occurrences() + flow.Occurrences()
+			mergeTimes(existing, flow)
+			continue
+		}
+
+		merged := *flow
+		merged.Count = flow.Occurrences()
+		index[fp] = &merged
+		result = append(result, &merged)
+	}
+
+	return result
+}
+
+// mergeTimes widens existing's Time and LastTime to cover flow's timestamps
+func mergeTimes(existing, flow *ParsedFlow) {
+	last := flow.LastTime
+	if last.IsZero() {
+		last = flow.Time
+	}
+	if existing.LastTime.IsZero() {
+		existing.LastTime = existing.Time
+	}
+	if existing.Time.IsZero() || (!flow.Time.IsZero() && flow.Time.Before(existing.Time)) {
+		existing.Time = flow.Time
+	}
+	if last.After(existing.LastTime) {
+		existing.LastTime = last
+	}
+}
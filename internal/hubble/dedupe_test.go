@@ -0,0 +1,151 @@
+package hubble
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDeduplicateFlows(t *testing.T) {
+	newFlow := func(pod string, port uint16, verdict string) *ParsedFlow {
+		return &ParsedFlow{
+			SourceLabels:    map[string]string{"k8s:app": "frontend"},
+			SourceNamespace: "default",
+			SourcePod:       pod,
+			DestLabels:      map[string]string{"k8s:app": "catalog"},
+			DestNamespace:   "default",
+			DestPort:        port,
+			Protocol:        "TCP",
+			Verdict:         verdict,
+			Count:           1,
+		}
+	}
+
+	flows := []*ParsedFlow{
+		newFlow("frontend-a", 8080, "FORWARDED"),
+		newFlow("frontend-b", 8080, "FORWARDED"),
+		newFlow("frontend-a", 8080, "DROPPED"),
+		newFlow("frontend-a", 9090, "FORWARDED"),
+		newFlow("frontend-c", 8080, "FORWARDED"),
+	}
+
+	result := DeduplicateFlows(flows)
+	if len(result) != 3 {
+		t.Fatalf("Expected 3 unique flows, got %d", len(result))
+	}
+
+	expected := []struct {
+		port    uint16
+		verdict string
+		count   int
+	}{
+		{8080, "FORWARDED", 3},
+		{8080, "DROPPED", 1},
+		{9090, "FORWARDED", 1},
+	}
+	for i, want := range expected {
+		got := result[i]
+		if got.DestPort != want.port || got.Verdict != want.verdict || got.Count != want.count {
+			t.Errorf("result[%d] = %d/%s x%d, want %d/%s x%d", i, got.DestPort, got.Verdict, got.Count, want.port, want.verdict, want.count)
+		}
+	}
+
+	// Input flows are not modified
+	if flows[0].Count != 1 {
+		t.Errorf("Expected input flow count to stay 1, got %d", flows[0].Count)
+	}
+
+	// Deduplicating again merges counts rather than resetting them
+	again := DeduplicateFlows(append(result, newFlow("frontend-d", 8080, "FORWARDED")))
+	if again[0].Count != 4 {
+		t.Errorf("Expected merged count 4, got %d", again[0].Count)
+	}
+}
+
+func TestDeduplicateFlowsExternalEndpoints(t *testing.T) {
+	newFlow := func(sourceIP, destIP string) *ParsedFlow {
+		flow := &ParsedFlow{
+			SourceIP:      sourceIP,
+			SourceLabels:  map[string]string{"reserved:world": ""},
+			DestIP:        destIP,
+			DestLabels:    map[string]string{"k8s:app": "gateway"},
+			DestNamespace: "default",
+			DestPort:      443,
+			Protocol:      "TCP",
+		}
+		if destIP != "" {
+			flow.DestLabels, flow.DestNamespace = map[string]string{"reserved:world": ""}, ""
+			flow.SourceIP, flow.SourceLabels, flow.SourceNamespace = "10.0.0.5", map[string]string{"k8s:app": "frontend"}, "default"
+		}
+		return flow
+	}
+
+	tests := []struct {
+		name     string
+		flows    []*ParsedFlow
+		expected int
+	}{
+		{name: "different external clients", flows: []*ParsedFlow{newFlow("203.0.113.10", ""), newFlow("198.51.100.20", "")}, expected: 2},
+		{name: "same external client", flows: []*ParsedFlow{newFlow("203.0.113.10", ""), newFlow("203.0.113.10", "")}, expected: 1},
+		{name: "different external destinations", flows: []*ParsedFlow{newFlow("", "203.0.113.10"), newFlow("", "198.51.100.20")}, expected: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := len(DeduplicateFlows(tt.flows)); got != tt.expected {
+				t.Errorf("DeduplicateFlows() kept %d flows, want %d", got, tt.expected)
+			}
+		})
+	}
+
+	// In-cluster sources still collapse across pod IPs
+	a, b := newFlow("", "203.0.113.10"), newFlow("", "203.0.113.10")
+	b.SourceIP = "10.0.0.6"
+	if got := len(DeduplicateFlows([]*ParsedFlow{a, b})); got != 1 {
+		t.Errorf("DeduplicateFlows() kept %d flows from two replicas, want 1", got)
+	}
+}
+
+func TestDeduplicateFlowsTimes(t *testing.T) {
+	at := func(hour int) time.Time { return time.Date(2024, 1, 2, hour, 0, 0, 0, time.UTC) }
+	newFlow := func(observed time.Time) *ParsedFlow {
+		return &ParsedFlow{
+			Time:            observed,
+			SourceLabels:    map[string]string{"k8s:app": "frontend"},
+			SourceNamespace: "default",
+			DestLabels:      map[string]string{"k8s:app": "catalog"},
+			DestNamespace:   "default",
+			DestPort:        8080,
+			Protocol:        "TCP",
+		}
+	}
+
+	tests := []struct {
+		name        string
+		flows       []*ParsedFlow
+		first, last time.Time
+	}{
+		{name: "single flow", flows: []*ParsedFlow{newFlow(at(8))}, first: at(8)},
+		{name: "in order", flows: []*ParsedFlow{newFlow(at(8)), newFlow(at(9)), newFlow(at(12))}, first: at(8), last: at(12)},
+		{name: "out of order", flows: []*ParsedFlow{newFlow(at(9)), newFlow(at(12)), newFlow(at(8))}, first: at(8), last: at(12)},
+		{name: "without timestamps", flows: []*ParsedFlow{newFlow(time.Time{}), newFlow(at(9)), newFlow(time.Time{})}, first: at(9), last: at(9)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := DeduplicateFlows(tt.flows)
+			if len(result) != 1 {
+				t.Fatalf("Expected 1 flow, got %d", len(result))
+			}
+			if !result[0].Time.Equal(tt.first) || !result[0].LastTime.Equal(tt.last) {
+				t.Errorf("Time..LastTime = %v..%v, want %v..%v", result[0].Time, result[0].LastTime, tt.first, tt.last)
+			}
+		})
+	}
+
+	// Merging already merged flows keeps the whole span
+	merged := DeduplicateFlows([]*ParsedFlow{newFlow(at(10)), newFlow(at(11))})
+	again := DeduplicateFlows(append(merged, DeduplicateFlows([]*ParsedFlow{newFlow(at(8)), newFlow(at(9))})...))
+	if !again[0].Time.Equal(at(8)) || !again[0].LastTime.Equal(at(11)) {
+		t.Errorf("Time..LastTime = %v..%v, want %v..%v", again[0].Time, again[0].LastTime, at(8), at(11))
+	}
+}
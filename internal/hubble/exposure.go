@@ -0,0 +1,126 @@
+package hubble
+
+import (
+	"fmt"
+	"sort"
+)
+
+// PortKey identifies a destination port and its protocol
+type PortKey struct {
+	Port     uint16
+	Protocol string
+}
+
+// String renders the key as port/protocol, e.g. "8080/TCP"
+func (k PortKey) String() string {
+	return fmt.Sprintf("%d/%s", k.Port, k.Protocol)
+}
+
+// PortExposure lists the endpoints serving a destination port and the
+// endpoints connecting to it. Endpoints are named "namespace/workload" for
+// pods, "entity:name" for host-network endpoints, and by DNS name or IP for
+// peers outside the cluster; both lists are sorted.
+type PortExposure struct {
+	Servers []string
+	Clients []string
+	// Flows is the number of observed flows to the port
+	Flows int
+}
+
+// PortExposureMap groups flows by destination port across all endpoints,
+// showing for each port who exposes it and who connects to it. Reply flows
+// and flows without a destination port (e.g. ICMP) are skipped.
+func PortExposureMap(flows []*ParsedFlow) map[PortKey]*PortExposure {
+	exposures := make(map[PortKey]*PortExposure)
+	servers := make(map[PortKey]map[string]bool)
+	clients := make(map[PortKey]map[string]bool)
+
+	for _, flow := range flows {
+		if flow.IsReply || flow.DestPort == 0 {
+			continue
+		}
+
+		protocol := NormalizeProtocol(flow.Protocol)
+		if protocol == "" {
+			protocol = "TCP"
+		}
+		key := PortKey{Port: flow.DestPort, Protocol: protocol}
+
+		if exposures[key] == nil {
+			exposures[key] = &PortExposure{}
+			servers[key] = make(map[string]bool)
+			clients[key] = make(map[string]bool)
+		}
+		exposures[key].Flows += flow.Occurrences()
+		servers[key][destinationName(flow)] = true
+		clients[key][sourceName(flow)] = true
+	}
+
+	for key, exposure := range exposures {
+		exposure.Servers = sortedNames(servers[key])
+		exposure.Clients = sortedNames(clients[key])
+	}
+
+	return exposures
+}
+
+// SortedPortKeys returns the ports of an exposure map ordered by port number,
+// then protocol
+func SortedPortKeys(exposures map[PortKey]*PortExposure) []PortKey {
+	keys := make([]PortKey, 0, len(exposures))
+	for key := range exposures {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Port != keys[j].Port {
+			return keys[i].Port < keys[j].Port
+		}
+		return keys[i].Protocol < keys[j].Protocol
+	})
+	return keys
+}
+
+// sourceName names a flow's source, identifying sources without labels
+// (e.g. traffic from outside the cluster) by IP
+func sourceName(flow *ParsedFlow) string {
+	if flow.IsExternalSource() {
+		return flow.SourceIP
+	}
+	return endpointName(flow.SourceNamespace, flow.SourceLabels, flow.SourceEntity)
+}
+
+// destinationName names a flow's destination, identifying external
+// destinations by DNS name or IP since they have no workload labels
+func destinationName(flow *ParsedFlow) string {
+	if flow.IsExternalDestination() {
+		if flow.DestDNSName != "" {
+			return flow.DestDNSName
+		}
+		return flow.DestIP
+	}
+	return endpointName(flow.DestNamespace, flow.DestLabels, flow.DestEntity)
+}
+
+// endpointName names an in-cluster endpoint by namespace and workload label,
+// falling back to all of its labels
+func endpointName(namespace string, labels map[string]string, entity string) string {
+	if entity != "" {
+		return "entity:" + entity
+	}
+	for _, key := range []string{"k8s:app", "app", "k8s:app.kubernetes.io/name", "app.kubernetes.io/name"} {
+		if value, exists := labels[key]; exists {
+			return namespace + "/" + value
+		}
+	}
+	return namespace + "/" + canonicalLabels(labels)
+}
+
+// sortedNames returns the keys of a set in sorted order
+func sortedNames(set map[string]bool) []string {
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
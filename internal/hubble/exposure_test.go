@@ -0,0 +1,92 @@
+package hubble
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPortExposureMap(t *testing.T) {
+	pod := func(app string) map[string]string {
+		return map[string]string{"k8s:app": app, "k8s:version": "v1"}
+	}
+
+	tests := []struct {
+		name     string
+		flows    []*ParsedFlow
+		expected map[PortKey]*PortExposure
+	}{
+		{
+			name: "servers and clients are aggregated per port",
+			flows: []*ParsedFlow{
+				{SourceLabels: pod("frontend"), SourceNamespace: "shop", DestLabels: pod("catalog"), DestNamespace: "shop", DestPort: 8080, Protocol: "TCP", Count: 3},
+				{SourceLabels: pod("checkout"), SourceNamespace: "shop", DestLabels: pod("catalog"), DestNamespace: "shop", DestPort: 8080, Protocol: "TCP"},
+				{SourceLabels: pod("frontend"), SourceNamespace: "web", DestLabels: pod("cart"), DestNamespace: "shop", DestPort: 8080, Protocol: "TCP"},
+				{SourceLabels: pod("frontend"), SourceNamespace: "shop", DestLabels: pod("catalog"), DestNamespace: "shop", DestPort: 8080, Protocol: "TCP"},
+			},
+			expected: map[PortKey]*PortExposure{
+				{Port: 8080, Protocol: "TCP"}: {
+					Servers: []string{"shop/cart", "shop/catalog"},
+					Clients: []string{"shop/checkout", "shop/frontend", "web/frontend"},
+					Flows:   6,
+				},
+			},
+		},
+		{
+			name: "protocols are kept apart",
+			flows: []*ParsedFlow{
+				{SourceLabels: pod("frontend"), SourceNamespace: "shop", DestLabels: map[string]string{"k8s:k8s-app": "kube-dns"}, DestNamespace: "kube-system", DestPort: 53, Protocol: "UDP"},
+				{SourceLabels: pod("frontend"), SourceNamespace: "shop", DestLabels: map[string]string{"k8s:k8s-app": "kube-dns"}, DestNamespace: "kube-system", DestPort: 53},
+			},
+			expected: map[PortKey]*PortExposure{
+				{Port: 53, Protocol: "UDP"}: {Servers: []string{"kube-system/k8s:k8s-app=kube-dns"}, Clients: []string{"shop/frontend"}, Flows: 1},
+				{Port: 53, Protocol: "TCP"}: {Servers: []string{"kube-system/k8s:k8s-app=kube-dns"}, Clients: []string{"shop/frontend"}, Flows: 1},
+			},
+		},
+		{
+			name: "hosts and external peers",
+			flows: []*ParsedFlow{
+				{SourceLabels: map[string]string{"reserved:host": ""}, SourceEntity: "host", DestLabels: pod("catalog"), DestNamespace: "shop", DestPort: 8080, Protocol: "TCP"},
+				{SourceIP: "198.51.100.7", DestLabels: pod("catalog"), DestNamespace: "shop", DestPort: 8080, Protocol: "TCP"},
+				{SourceLabels: pod("catalog"), SourceNamespace: "shop", DestLabels: map[string]string{"reserved:world": ""}, DestIP: "140.82.112.6", DestDNSName: "api.github.com", DestPort: 443, Protocol: "TCP"},
+				{SourceLabels: pod("catalog"), SourceNamespace: "shop", DestLabels: map[string]string{"reserved:world": ""}, DestIP: "203.0.113.10", DestPort: 443, Protocol: "TCP"},
+			},
+			expected: map[PortKey]*PortExposure{
+				{Port: 443, Protocol: "TCP"}:  {Servers: []string{"203.0.113.10", "api.github.com"}, Clients: []string{"shop/catalog"}, Flows: 2},
+				{Port: 8080, Protocol: "TCP"}: {Servers: []string{"shop/catalog"}, Clients: []string{"198.51.100.7", "entity:host"}, Flows: 2},
+			},
+		},
+		{
+			name: "replies and portless flows are skipped",
+			flows: []*ParsedFlow{
+				{SourceLabels: pod("catalog"), SourceNamespace: "shop", DestLabels: pod("frontend"), DestNamespace: "shop", DestPort: 41234, Protocol: "TCP", IsReply: true},
+				{SourceLabels: pod("frontend"), SourceNamespace: "shop", DestLabels: pod("catalog"), DestNamespace: "shop", Protocol: "ICMP", ICMPType: 8},
+			},
+			expected: map[PortKey]*PortExposure{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := PortExposureMap(tt.flows)
+			if !reflect.DeepEqual(result, tt.expected) {
+				for key, exposure := range result {
+					t.Logf("got %s: %+v", key, *exposure)
+				}
+				t.Errorf("PortExposureMap() returned %d ports, want %d", len(result), len(tt.expected))
+			}
+		})
+	}
+}
+
+func TestSortedPortKeys(t *testing.T) {
+	exposures := map[PortKey]*PortExposure{
+		{Port: 8080, Protocol: "TCP"}: {},
+		{Port: 53, Protocol: "UDP"}:   {},
+		{Port: 53, Protocol: "TCP"}:   {},
+	}
+
+	expected := []PortKey{{53, "TCP"}, {53, "UDP"}, {8080, "TCP"}}
+	if keys := SortedPortKeys(exposures); !reflect.DeepEqual(keys, expected) {
+		t.Errorf("SortedPortKeys() = %v, want %v", keys, expected)
+	}
+}
@@ -0,0 +1,71 @@
+package hubble
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+)
+
+// gzipMagic is the header every gzip stream starts with
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// StdinPath is the flows file path that reads from standard input
+const StdinPath = "-"
+
+// flowsFile reads a flows file, decompressing it if it is gzipped
+type flowsFile struct {
+	io.Reader
+	// closer is nil for inputs the caller owns, such as stdin
+	closer io.Closer
+	gz     *gzip.Reader
+}
+
+// openFlowsFile opens a flows file for reading, or standard input for
+// StdinPath. Gzipped input is detected by its magic bytes rather than the
+// .gz extension and decompressed transparently.
+func openFlowsFile(filePath string) (*flowsFile, error) {
+	if filePath == StdinPath {
+		return newFlowsReader(os.Stdin, nil)
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	flows, err := newFlowsReader(file, file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return flows, nil
+}
+
+// newFlowsReader wraps r, decompressing it if it is gzipped. closer, if
+// non-nil, is closed along with the returned reader.
+func newFlowsReader(r io.Reader, closer io.Closer) (*flowsFile, error) {
+	buffered := bufio.NewReader(r)
+	header, _ := buffered.Peek(len(gzipMagic))
+	if !bytes.Equal(header, gzipMagic) {
+		return &flowsFile{Reader: buffered, closer: closer}, nil
+	}
+
+	gz, err := gzip.NewReader(buffered)
+	if err != nil {
+		return nil, fmt.Errorf("invalid gzip data: %w", err)
+	}
+	return &flowsFile{Reader: gz, closer: closer, gz: gz}, nil
+}
+
+// Close closes the decompressor, if any, and the underlying file
+func (f *flowsFile) Close() error {
+	if f.gz != nil {
+		f.gz.Close()
+	}
+	if f.closer == nil {
+		return nil
+	}
+	return f.closer.Close()
+}
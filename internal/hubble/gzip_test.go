@@ -0,0 +1,106 @@
+package hubble
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeGzipFile writes content gzip-compressed to name in a temp directory
+func writeGzipFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadFlowsFromGzipFile(t *testing.T) {
+	const flow = `{"source":{"labels":["k8s:app=frontend"],"namespace":"default"},` +
+		`"destination":{"labels":["k8s:app=catalog"],"namespace":"default"},` +
+		`"IP":{"source":"10.0.0.1","destination":"10.0.0.2","ipVersion":"IPv4"},` +
+		`"l4":{"TCP":{"destination_port":8080}},"verdict":"FORWARDED"}`
+
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		wantFmt FlowFormat
+	}{
+		{
+			name:    "policypilot object",
+			file:    "flows.json.gz",
+			content: `{"schema":"cpp.flows.v1","flows":[` + flow + `,` + flow + `]}`,
+			wantFmt: FormatPolicyPilot,
+		},
+		{
+			name:    "hubble observe output",
+			file:    "flows.json.gz",
+			content: `{"flow":` + flow + `}` + "\n" + `{"flow":` + flow + `}` + "\n",
+			wantFmt: FormatJSONPB,
+		},
+		{
+			// Detected by magic bytes, not the extension
+			name:    "without gz extension",
+			file:    "flows.json",
+			content: `{"schema":"cpp.flows.v1","flows":[` + flow + `,` + flow + `]}`,
+			wantFmt: FormatPolicyPilot,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeGzipFile(t, tt.file, tt.content)
+
+			collection, format, err := ReadFlowsFromFileWithFormat(path)
+			if err != nil {
+				t.Fatalf("ReadFlowsFromFileWithFormat() error = %v", err)
+			}
+			if format != tt.wantFmt {
+				t.Errorf("format = %q, want %q", format, tt.wantFmt)
+			}
+			if len(collection.Flows) != 2 {
+				t.Fatalf("Expected 2 flows, got %d", len(collection.Flows))
+			}
+			if f := collection.Flows[0]; f.IP == nil || f.IP.Source != "10.0.0.1" {
+				t.Errorf("Flow not decoded correctly: %+v", f)
+			}
+
+			unique, dedup, err := ReadUniqueFlowsFromFile(path)
+			if err != nil {
+				t.Fatalf("ReadUniqueFlowsFromFile() error = %v", err)
+			}
+			if len(unique.Flows) != 1 || dedup.Total() != 2 {
+				t.Errorf("Expected 1 unique flow of 2, got %d of %d", len(unique.Flows), dedup.Total())
+			}
+		})
+	}
+}
+
+func TestReadFlowsFromGzipFileCorrupt(t *testing.T) {
+	path := writeGzipFile(t, "flows.json.gz", `{"schema":"cpp.flows.v1","flows":[]}`)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data[:len(data)/2], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := ReadFlowsFromFileWithFormat(path); err == nil {
+		t.Error("Expected error for truncated gzip file")
+	}
+}
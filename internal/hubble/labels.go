@@ -0,0 +1,65 @@
+package hubble
+
+import "strings"
+
+// namespaceLabel scopes an endpoint to its namespace, so it is never
+// dropped as noise
+const namespaceLabel = "k8s:io.kubernetes.pod.namespace"
+
+// DefaultIgnoredLabelPrefixes are label key prefixes, without their "k8s:"
+// source, that Cilium and Kubernetes attach to endpoints but that do not
+// identify a workload: Cilium's cluster, service account and namespace
+// labels, and per-rollout or per-pod hashes
+var DefaultIgnoredLabelPrefixes = []string{
+	"io.cilium.k8s.policy.",
+	"io.cilium.k8s.namespace.labels.",
+	"pod-template-hash",
+	"controller-revision-hash",
+	"pod-template-generation",
+	"statefulset.kubernetes.io/pod-name",
+	"controller-uid",
+	"batch.kubernetes.io/controller-uid",
+}
+
+// IsIgnoredLabel reports whether a label key, ignoring a source prefix such
+// as "k8s:", starts with one of prefixes. The namespace label is never
+// ignored.
+func IsIgnoredLabel(key string, prefixes []string) bool {
+	if key == namespaceLabel {
+		return false
+	}
+	if _, name, found := strings.Cut(key, ":"); found {
+		key = name
+	}
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(key, strings.TrimPrefix(prefix, "k8s:")) {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizeLabels returns labels without the keys ignored by prefixes (see
+// IsIgnoredLabel)
+func NormalizeLabels(labels map[string]string, prefixes []string) map[string]string {
+	result := make(map[string]string, len(labels))
+	for key, value := range labels {
+		if !IsIgnoredLabel(key, prefixes) {
+			result[key] = value
+		}
+	}
+	return result
+}
+
+// NormalizeFlowLabels returns copies of flows with NormalizeLabels applied
+// to their source and destination labels; flows itself is left unchanged
+func NormalizeFlowLabels(flows []*ParsedFlow, prefixes []string) []*ParsedFlow {
+	result := make([]*ParsedFlow, 0, len(flows))
+	for _, flow := range flows {
+		normalized := *flow
+		normalized.SourceLabels = NormalizeLabels(flow.SourceLabels, prefixes)
+		normalized.DestLabels = NormalizeLabels(flow.DestLabels, prefixes)
+		result = append(result, &normalized)
+	}
+	return result
+}
@@ -0,0 +1,91 @@
+package hubble
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeLabels(t *testing.T) {
+	// Labels as Hubble reports them for a Deployment pod
+	labels := ParseLabels([]string{
+		"k8s:app=checkout",
+		"k8s:version=v2",
+		"k8s:pod-template-hash=7d4b9c8f6",
+		"k8s:io.kubernetes.pod.namespace=shop",
+		"k8s:io.cilium.k8s.policy.cluster=default",
+		"k8s:io.cilium.k8s.policy.serviceaccount=checkout",
+		"k8s:io.cilium.k8s.namespace.labels.kubernetes.io/metadata.name=shop",
+		"k8s:io.cilium.k8s.namespace.labels.team=payments",
+	})
+
+	tests := []struct {
+		name     string
+		labels   map[string]string
+		prefixes []string
+		expected map[string]string
+	}{
+		{
+			name:     "default prefixes",
+			labels:   labels,
+			prefixes: DefaultIgnoredLabelPrefixes,
+			expected: map[string]string{
+				"k8s:app":                         "checkout",
+				"k8s:version":                     "v2",
+				"k8s:io.kubernetes.pod.namespace": "shop",
+			},
+		},
+		{
+			name:     "extra prefix with source",
+			labels:   labels,
+			prefixes: append(DefaultIgnoredLabelPrefixes, "k8s:version"),
+			expected: map[string]string{
+				"k8s:app":                         "checkout",
+				"k8s:io.kubernetes.pod.namespace": "shop",
+			},
+		},
+		{
+			name:     "namespace label is never dropped",
+			labels:   map[string]string{"k8s:app": "checkout", "k8s:io.kubernetes.pod.namespace": "shop"},
+			prefixes: []string{"io.kubernetes."},
+			expected: map[string]string{"k8s:app": "checkout", "k8s:io.kubernetes.pod.namespace": "shop"},
+		},
+		{
+			name:     "Job pod",
+			labels:   map[string]string{"k8s:job-name": "migrate", "k8s:controller-uid": "1f2e", "k8s:batch.kubernetes.io/controller-uid": "1f2e"},
+			prefixes: DefaultIgnoredLabelPrefixes,
+			expected: map[string]string{"k8s:job-name": "migrate"},
+		},
+		{
+			name:     "reserved labels are kept",
+			labels:   map[string]string{"reserved:world": ""},
+			prefixes: DefaultIgnoredLabelPrefixes,
+			expected: map[string]string{"reserved:world": ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := NormalizeLabels(tt.labels, tt.prefixes); !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("NormalizeLabels() = %v, want %v", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestNormalizeFlowLabels(t *testing.T) {
+	flow := &ParsedFlow{
+		SourceLabels: map[string]string{"k8s:app": "frontend", "k8s:pod-template-hash": "abc"},
+		DestLabels:   map[string]string{"k8s:app": "checkout", "k8s:io.cilium.k8s.policy.cluster": "default"},
+	}
+
+	normalized := NormalizeFlowLabels([]*ParsedFlow{flow}, DefaultIgnoredLabelPrefixes)
+	if !reflect.DeepEqual(normalized[0].SourceLabels, map[string]string{"k8s:app": "frontend"}) {
+		t.Errorf("SourceLabels = %v", normalized[0].SourceLabels)
+	}
+	if !reflect.DeepEqual(normalized[0].DestLabels, map[string]string{"k8s:app": "checkout"}) {
+		t.Errorf("DestLabels = %v", normalized[0].DestLabels)
+	}
+	if len(flow.SourceLabels) != 2 || len(flow.DestLabels) != 2 {
+		t.Errorf("Expected the original flow to keep its raw labels, got %+v", flow)
+	}
+}
@@ -0,0 +1,78 @@
+package hubble
+
+import (
+	"fmt"
+	"sort"
+)
+
+// FlowSummary is one distinct connection in a capture, as listed by
+// ListFlows
+type FlowSummary struct {
+	// Source and Destination name the endpoints as in PortExposure
+	Source      string
+	Destination string
+	// Traffic is the protocol and destination port, e.g. "TCP/8080", or the
+	// protocol alone for flows without a port such as ICMP
+	Traffic string
+	Verdict string
+	// Flows is the number of observed flows, weighted by Occurrences
+	Flows int
+}
+
+// ListFlows merges flows with the same source, destination, traffic and
+// verdict into one summary each, ordered by the number of flows, most
+// first, then by source, destination and traffic
+func ListFlows(flows []*ParsedFlow) []FlowSummary {
+	summaries := make(map[FlowSummary]int)
+	for _, flow := range flows {
+		key := FlowSummary{
+			Source:      sourceName(flow),
+			Destination: destinationName(flow),
+			Traffic:     flowTraffic(flow),
+			Verdict:     flow.Verdict,
+		}
+		summaries[key] += flow.Occurrences()
+	}
+
+	result := make([]FlowSummary, 0, len(summaries))
+	for summary, count := range summaries {
+		summary.Flows = count
+		result = append(result, summary)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.Flows != b.Flows {
+			return a.Flows > b.Flows
+		}
+		if a.Source != b.Source {
+			return a.Source < b.Source
+		}
+		if a.Destination != b.Destination {
+			return a.Destination < b.Destination
+		}
+		if a.Traffic != b.Traffic {
+			return a.Traffic < b.Traffic
+		}
+		return a.Verdict < b.Verdict
+	})
+	return result
+}
+
+// flowTraffic formats a flow's protocol and destination port, or its ICMP
+// type. Flows without an L4 protocol or port are "unknown".
+func flowTraffic(flow *ParsedFlow) string {
+	if flow.IsICMP() {
+		return fmt.Sprintf("%s type %d", flow.Protocol, flow.ICMPType)
+	}
+	if flow.DestPort == 0 {
+		if flow.Protocol == "" {
+			return "unknown"
+		}
+		return flow.Protocol
+	}
+	protocol := flow.Protocol
+	if protocol == "" {
+		protocol = "TCP"
+	}
+	return fmt.Sprintf("%s/%d", protocol, flow.DestPort)
+}
@@ -0,0 +1,49 @@
+package hubble
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestListFlows(t *testing.T) {
+	flow := func(source, dest string, port uint16, verdict string, count int) *ParsedFlow {
+		return &ParsedFlow{
+			SourceLabels:    map[string]string{"k8s:app": source},
+			SourceNamespace: "shop",
+			DestLabels:      map[string]string{"k8s:app": dest},
+			DestNamespace:   "shop",
+			DestPort:        port,
+			Protocol:        "TCP",
+			Verdict:         verdict,
+			Count:           count,
+		}
+	}
+
+	flows := []*ParsedFlow{
+		flow("frontend", "catalog", 8080, "FORWARDED", 2),
+		flow("checkout", "cart", 7070, "DROPPED", 1),
+		flow("frontend", "catalog", 8080, "FORWARDED", 3),
+		flow("frontend", "catalog", 8080, "DROPPED", 1),
+		flow("frontend", "cart", 7070, "FORWARDED", 0),
+		{
+			SourceLabels:    map[string]string{"k8s:app": "frontend"},
+			SourceNamespace: "shop",
+			DestLabels:      map[string]string{"reserved:world": ""},
+			DestDNSName:     "api.example.com",
+			Protocol:        "ICMP",
+			ICMPType:        8,
+		},
+	}
+
+	expected := []FlowSummary{
+		{Source: "shop/frontend", Destination: "shop/catalog", Traffic: "TCP/8080", Verdict: "FORWARDED", Flows: 5},
+		{Source: "shop/checkout", Destination: "shop/cart", Traffic: "TCP/7070", Verdict: "DROPPED", Flows: 1},
+		{Source: "shop/frontend", Destination: "api.example.com", Traffic: "ICMP type 8", Flows: 1},
+		{Source: "shop/frontend", Destination: "shop/cart", Traffic: "TCP/7070", Verdict: "FORWARDED", Flows: 1},
+		{Source: "shop/frontend", Destination: "shop/catalog", Traffic: "TCP/8080", Verdict: "DROPPED", Flows: 1},
+	}
+
+	if result := ListFlows(flows); !reflect.DeepEqual(result, expected) {
+		t.Errorf("ListFlows() = %+v, want %+v", result, expected)
+	}
+}
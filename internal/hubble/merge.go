@@ -0,0 +1,26 @@
+package hubble
+
+import "fmt"
+
+// MergeCollections concatenates the flows of several collections, e.g.
+// captures split per namespace or per hour, in the order given. All
+// collections must have the same schema.
+func MergeCollections(collections ...*FlowCollection) (*FlowCollection, error) {
+	if len(collections) == 0 {
+		return nil, fmt.Errorf("no flow collections to merge")
+	}
+
+	merged := &FlowCollection{Flows: []*Flow{}}
+	for i, collection := range collections {
+		if collection == nil {
+			return nil, fmt.Errorf("flow collection %d is nil", i+1)
+		}
+		if i == 0 {
+			merged.Schema = collection.Schema
+		} else if collection.Schema != merged.Schema {
+			return nil, fmt.Errorf("incompatible flow schemas: %q and %q", merged.Schema, collection.Schema)
+		}
+		merged.Flows = append(merged.Flows, collection.Flows...)
+	}
+	return merged, nil
+}
@@ -0,0 +1,79 @@
+package hubble
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMergeCollections(t *testing.T) {
+	first := &Flow{Verdict: "FORWARDED"}
+	second := &Flow{Verdict: "DROPPED"}
+	third := &Flow{Verdict: "AUDIT"}
+
+	tests := []struct {
+		name        string
+		collections []*FlowCollection
+		expected    []*Flow
+		wantErr     string
+	}{
+		{
+			name: "flows are concatenated in order",
+			collections: []*FlowCollection{
+				{Schema: "cpp.flows.v1", Flows: []*Flow{first, second}},
+				{Schema: "cpp.flows.v1", Flows: []*Flow{third}},
+			},
+			expected: []*Flow{first, second, third},
+		},
+		{
+			name:        "a single collection",
+			collections: []*FlowCollection{{Schema: "cpp.flows.v1", Flows: []*Flow{first}}},
+			expected:    []*Flow{first},
+		},
+		{
+			name: "empty collections add nothing",
+			collections: []*FlowCollection{
+				{Schema: "cpp.flows.v1"},
+				{Schema: "cpp.flows.v1", Flows: []*Flow{second}},
+			},
+			expected: []*Flow{second},
+		},
+		{
+			name: "incompatible schemas",
+			collections: []*FlowCollection{
+				{Schema: "cpp.flows.v1", Flows: []*Flow{first}},
+				{Schema: "cpp.flows.v2", Flows: []*Flow{second}},
+			},
+			wantErr: `incompatible flow schemas: "cpp.flows.v1" and "cpp.flows.v2"`,
+		},
+		{
+			name:    "nothing to merge",
+			wantErr: "no flow collections to merge",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged, err := MergeCollections(tt.collections...)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("MergeCollections() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("MergeCollections() error = %v", err)
+			}
+			if merged.Schema != "cpp.flows.v1" {
+				t.Errorf("Schema = %q, want cpp.flows.v1", merged.Schema)
+			}
+			if len(merged.Flows) != len(tt.expected) {
+				t.Fatalf("Got %d flows, want %d", len(merged.Flows), len(tt.expected))
+			}
+			for i := range tt.expected {
+				if merged.Flows[i] != tt.expected[i] {
+					t.Errorf("Flow %d = %+v, want %+v", i, merged.Flows[i], tt.expected[i])
+				}
+			}
+		})
+	}
+}
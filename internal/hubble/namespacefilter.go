@@ -0,0 +1,57 @@
+package hubble
+
+import "slices"
+
+// NamespaceFilter selects flows by the namespaces of their endpoints. An
+// empty Include keeps flows in every namespace.
+type NamespaceFilter struct {
+	// Include keeps flows whose source or destination is in one of these
+	// namespaces
+	Include []string
+	// Exclude drops flows whose source or destination is in one of these
+	// namespaces, even if it is also included
+	Exclude []string
+}
+
+// IsZero reports whether the filter keeps every flow
+func (f NamespaceFilter) IsZero() bool {
+	return len(f.Include) == 0 && len(f.Exclude) == 0
+}
+
+// FilterFlowsByNamespace returns the flows matching filter
+func FilterFlowsByNamespace(flows []*ParsedFlow, filter NamespaceFilter) []*ParsedFlow {
+	if filter.IsZero() {
+		return flows
+	}
+
+	result := make([]*ParsedFlow, 0, len(flows))
+	for _, flow := range flows {
+		if len(filter.Include) > 0 && !flowInNamespaces(flow, filter.Include) {
+			continue
+		}
+		if flowInNamespaces(flow, filter.Exclude) {
+			continue
+		}
+		result = append(result, flow)
+	}
+	return result
+}
+
+// CountFlowsInNamespace returns the number of flows whose source or
+// destination is in namespace
+func CountFlowsInNamespace(flows []*ParsedFlow, namespace string) int {
+	count := 0
+	for _, flow := range flows {
+		if flowInNamespaces(flow, []string{namespace}) {
+			count++
+		}
+	}
+	return count
+}
+
+// flowInNamespaces reports whether the flow's source or destination is in
+// one of namespaces
+func flowInNamespaces(flow *ParsedFlow, namespaces []string) bool {
+	return (flow.SourceNamespace != "" && slices.Contains(namespaces, flow.SourceNamespace)) ||
+		(flow.DestNamespace != "" && slices.Contains(namespaces, flow.DestNamespace))
+}
@@ -0,0 +1,39 @@
+package hubble
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFilterFlowsByNamespace(t *testing.T) {
+	shop := &ParsedFlow{SourceNamespace: "shop", DestNamespace: "shop"}
+	billing := &ParsedFlow{SourceNamespace: "shop", DestNamespace: "billing"}
+	dns := &ParsedFlow{SourceNamespace: "shop", DestNamespace: "kube-system"}
+	external := &ParsedFlow{SourceNamespace: "billing", DestIP: "203.0.113.10"}
+	flows := []*ParsedFlow{shop, billing, dns, external}
+
+	tests := []struct {
+		name     string
+		filter   NamespaceFilter
+		expected []*ParsedFlow
+	}{
+		{name: "no filter", filter: NamespaceFilter{}, expected: flows},
+		{name: "include one", filter: NamespaceFilter{Include: []string{"billing"}}, expected: []*ParsedFlow{billing, external}},
+		{name: "include several", filter: NamespaceFilter{Include: []string{"shop", "billing"}}, expected: flows},
+		{name: "exclude", filter: NamespaceFilter{Exclude: []string{"kube-system"}}, expected: []*ParsedFlow{shop, billing, external}},
+		{name: "exclude wins over include", filter: NamespaceFilter{Include: []string{"shop"}, Exclude: []string{"billing", "kube-system"}}, expected: []*ParsedFlow{shop}},
+		{name: "no match", filter: NamespaceFilter{Include: []string{"web"}}, expected: []*ParsedFlow{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FilterFlowsByNamespace(flows, tt.filter); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("FilterFlowsByNamespace() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+
+	if got := CountFlowsInNamespace(flows, "billing"); got != 2 {
+		t.Errorf("CountFlowsInNamespace(billing) = %d, want 2", got)
+	}
+}
@@ -1,38 +1,115 @@
 package hubble
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/json"
 	"fmt"
-	"os"
+	"io"
+	"net/netip"
+	"net/url"
+	"runtime"
 	"strings"
+	"sync"
+
+	"github.com/prabhakaran-jm/cilium-policypilot/internal/fileutil"
 )
 
-// ReadFlowsFromFile reads and parses flows from a JSON file.
-// Supports both PolicyPilot format (single JSON object with flows array)
-// and Hubble NDJSON format (newline-delimited JSON with flow objects).
+// FlowFormat identifies the layout of a flows file as detected by
+// ReadFlowsFromFileWithFormat
+type FlowFormat string
+
+const (
+	// FormatPolicyPilot is a {"schema":...,"flows":[...]} object matching FlowCollection
+	FormatPolicyPilot FlowFormat = "policypilot"
+	// FormatPolicyPilotLenient is a PolicyPilot object whose flows only decoded
+	// individually, e.g. because some fields have unexpected types
+	FormatPolicyPilotLenient FlowFormat = "policypilot-lenient"
+	// FormatArray is a top-level JSON array of flows
+	FormatArray FlowFormat = "array"
+	// FormatNDJSON is one bare flow object per line
+	FormatNDJSON FlowFormat = "ndjson"
+	// FormatJSONPB is one GetFlowsResponse per line, as written by
+	// `hubble observe -o json` and `-o jsonpb`
+	FormatJSONPB FlowFormat = "jsonpb"
+)
+
+// ReadFlowsFromFile reads and parses flows from a JSON file, or from standard
+// input if filePath is StdinPath. See ReadFlows for the supported formats.
 func ReadFlowsFromFile(filePath string) (*FlowCollection, error) {
-	data, err := os.ReadFile(filePath)
+	collection, _, err := ReadFlowsFromFileWithFormat(filePath)
+	return collection, err
+}
+
+// ReadFlowsFromFileWithFormat is like ReadFlowsFromFile but also reports
+// which input format the file was interpreted as
+func ReadFlowsFromFileWithFormat(filePath string) (*FlowCollection, FlowFormat, error) {
+	file, err := openFlowsFile(filePath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read flows file: %w", err)
+		return nil, "", fmt.Errorf("failed to read flows file: %w", err)
 	}
+	defer file.Close()
+
+	return readFlows(file, isNDJSONFile(filePath))
+}
+
+// ReadFlows reads and parses flows from r.
+// Supports both PolicyPilot format (single JSON object with flows array)
+// and Hubble NDJSON format (newline-delimited JSON with flow objects), either
+// of which may be gzipped.
+func ReadFlows(r io.Reader) (*FlowCollection, error) {
+	collection, _, err := ReadFlowsWithFormat(r)
+	return collection, err
+}
+
+// ReadFlowsWithFormat is like ReadFlows but also reports which input format
+// the data was interpreted as
+func ReadFlowsWithFormat(r io.Reader) (*FlowCollection, FlowFormat, error) {
+	flows, err := newFlowsReader(r, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read flows file: %w", err)
+	}
+	defer flows.Close()
+
+	return readFlows(flows, false)
+}
+
+// readFlows parses decompressed flows from r. NDJSON captures can be many
+// gigabytes, so they are decoded a line at a time instead of being loaded
+// whole. They are recognized by ndjson (e.g. from the file extension) or by
+// a first line that is a complete flow.
+func readFlows(r io.Reader, ndjson bool) (*FlowCollection, FlowFormat, error) {
+	buffered := bufio.NewReaderSize(r, 64*1024)
+	head, err := readFirstLine(buffered)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read flows file: %w", err)
+	}
+	if ndjson || isFlowLine(head) {
+		return readNDJSONFlows(io.MultiReader(bytes.NewReader(head), buffered))
+	}
+
+	data, err := io.ReadAll(io.MultiReader(bytes.NewReader(head), buffered))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read flows file: %w", err)
+	}
+	return parseFlowsData(data)
+}
 
+// parseFlowsData parses a flows file held in memory, trying each supported
+// format in turn
+func parseFlowsData(data []byte) (*FlowCollection, FlowFormat, error) {
 	// Try parsing as single JSON object first (PolicyPilot format)
-	// Normalize field names first: "IP" -> "ip", "ipVersion" string -> int
-	dataStr := string(data)
-	dataStr = strings.ReplaceAll(dataStr, `"IP":`, `"ip":`)
-	dataStr = strings.ReplaceAll(dataStr, `"ipVersion":"IPv4"`, `"ipVersion":4`)
-	dataStr = strings.ReplaceAll(dataStr, `"ipVersion":"IPv6"`, `"ipVersion":6`)
 
 	// Try unmarshaling into FlowCollection
 	var collection FlowCollection
-	if err := json.Unmarshal([]byte(dataStr), &collection); err == nil && collection.Schema != "" {
-		return &collection, nil
+	if err := json.Unmarshal(data, &collection); err == nil && collection.Schema != "" {
+		return &collection, FormatPolicyPilot, nil
 	}
 
 	// If that failed, try a more lenient approach: unmarshal into map and convert
 	// This handles cases where the JSON has extra fields that don't match the struct
 	var rawCollection map[string]interface{}
-	if err2 := json.Unmarshal([]byte(dataStr), &rawCollection); err2 == nil {
+	if err2 := json.Unmarshal(data, &rawCollection); err2 == nil {
 		if schema, ok := rawCollection["schema"].(string); ok && schema != "" {
 			if flowsRaw, ok := rawCollection["flows"].([]interface{}); ok {
 				flows := make([]*Flow, 0, len(flowsRaw))
@@ -48,62 +125,145 @@ func ReadFlowsFromFile(filePath string) (*FlowCollection, error) {
 					return &FlowCollection{
 						Schema: schema,
 						Flows:  flows,
-					}, nil
+					}, FormatPolicyPilotLenient, nil
 				}
 			}
 		}
 	}
 
-	// If that fails, try parsing as NDJSON (Hubble format)
-	// Each line is: {"flow":{...},"node_name":"...","time":"..."}
-	lines := strings.Split(string(data), "\n")
-	flows := make([]*Flow, 0)
-
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
+	// Try a top-level array of flows (bare or wrapped in {"flow":...})
+	var elements []json.RawMessage
+	if err := json.Unmarshal(data, &elements); err == nil {
+		flows := make([]*Flow, 0, len(elements))
+		for _, element := range elements {
+			if flow, _, ok := decodeFlowLine([]byte(element)); ok {
+				flows = append(flows, flow)
+			}
 		}
+		if len(flows) > 0 {
+			return &FlowCollection{
+				Schema: CurrentSchema,
+				Flows:  flows,
+			}, FormatArray, nil
+		}
+	}
+
+	// If that fails, try parsing as NDJSON. Hubble writes one
+	// {"flow":{...},"node_name":"...","time":"..."} per line; bare flow
+	// objects per line are accepted too
+	if collection, format, err := readNDJSONFlows(bytes.NewReader(data)); err == nil {
+		return collection, format, nil
+	}
+
+	return nil, "", fmt.Errorf("failed to parse flows JSON: could not parse as single JSON, array or NDJSON format")
+}
 
-		// Parse line as JSON
-		var lineObj map[string]interface{}
-		if err := json.Unmarshal([]byte(line), &lineObj); err != nil {
-			continue // Skip invalid lines
+// isNDJSONFile reports whether a file is named as NDJSON, e.g. flows.ndjson
+// or flows.ndjson.gz
+func isNDJSONFile(filePath string) bool {
+	name := strings.TrimSuffix(strings.ToLower(filePath), ".gz")
+	return strings.HasSuffix(name, ".ndjson") || strings.HasSuffix(name, ".jsonl")
+}
+
+// readFirstLine reads up to and including the first non-blank line, returning
+// every byte consumed so the caller can replay it
+func readFirstLine(r *bufio.Reader) ([]byte, error) {
+	var consumed []byte
+	for {
+		line, err := r.ReadBytes('\n')
+		consumed = append(consumed, line...)
+		if len(bytes.TrimSpace(line)) > 0 || err == io.EOF {
+			return consumed, nil
+		}
+		if err != nil {
+			return nil, err
 		}
+	}
+}
 
-		// Extract flow object
-		if flowData, ok := lineObj["flow"]; ok {
-			flowJSON, err := json.Marshal(flowData)
-			if err != nil {
-				continue
-			}
+// isFlowLine reports whether data holds exactly one flow object, as the
+// first line of an NDJSON file does
+func isFlowLine(data []byte) bool {
+	_, _, ok := decodeFlowLine(bytes.TrimSpace(data))
+	return ok
+}
+
+// decodeFlowLine decodes a single JSON object that is either a Hubble
+// GetFlowsResponse (wrapped reports true) or a bare flow. Objects with
+// neither a flow nor a source/destination are rejected.
+func decodeFlowLine(data []byte) (flow *Flow, wrapped bool, ok bool) {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, false, false
+	}
 
-			// Normalize field names: "IP" -> "ip", handle ipVersion string -> int
-			flowJSONStr := string(flowJSON)
-			flowJSONStr = strings.ReplaceAll(flowJSONStr, `"IP":`, `"ip":`)
+	if flowData, found := obj["flow"]; found {
+		var f Flow
+		if err := json.Unmarshal(flowData, &f); err != nil {
+			return nil, false, false
+		}
+		return &f, true, true
+	}
 
-			// Convert ipVersion string to int if needed
-			if strings.Contains(flowJSONStr, `"ipVersion":"IPv4"`) {
-				flowJSONStr = strings.ReplaceAll(flowJSONStr, `"ipVersion":"IPv4"`, `"ipVersion":4`)
-			} else if strings.Contains(flowJSONStr, `"ipVersion":"IPv6"`) {
-				flowJSONStr = strings.ReplaceAll(flowJSONStr, `"ipVersion":"IPv6"`, `"ipVersion":6`)
-			}
+	_, hasSource := obj["source"]
+	_, hasDestination := obj["destination"]
+	if !hasSource && !hasDestination {
+		return nil, false, false
+	}
+	var f Flow
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, false, false
+	}
+	return &f, false, true
+}
 
-			var flow Flow
-			if err := json.Unmarshal([]byte(flowJSONStr), &flow); err == nil {
-				flows = append(flows, &flow)
+// workloadName returns an endpoint's first workload as kind/name, or just the
+// name when the kind is unknown
+func workloadName(endpoint *Endpoint) string {
+	if len(endpoint.Workloads) == 0 || endpoint.Workloads[0] == nil || endpoint.Workloads[0].Name == "" {
+		return ""
+	}
+	workload := endpoint.Workloads[0]
+	if workload.Kind == "" {
+		return workload.Name
+	}
+	return workload.Kind + "/" + workload.Name
+}
+
+// ipVersion returns the IP version Hubble reported or, without one, the
+// family of the first address that parses; v4-mapped IPv6 addresses count
+// as IPv4
+func ipVersion(ip *IP) int {
+	if ip.IPVersion == 4 || ip.IPVersion == 6 {
+		return ip.IPVersion
+	}
+	for _, address := range []string{ip.Destination, ip.Source} {
+		if addr, err := netip.ParseAddr(address); err == nil {
+			if addr.Unmap().Is4() {
+				return 4
 			}
+			return 6
 		}
 	}
+	return 0
+}
 
-	if len(flows) > 0 {
-		return &FlowCollection{
-			Schema: "cpp.flows.v1",
-			Flows:  flows,
-		}, nil
+// portName returns the name of port/protocol among an endpoint's named
+// ports, or "" if it has none
+func portName(namedPorts []NamedPort, port uint16, protocol string) string {
+	if port == 0 {
+		return ""
 	}
-
-	return nil, fmt.Errorf("failed to parse flows JSON: could not parse as single JSON or NDJSON format")
+	for _, named := range namedPorts {
+		namedProtocol := named.Protocol
+		if namedProtocol == "" {
+			namedProtocol = "TCP"
+		}
+		if named.Port == port && strings.EqualFold(namedProtocol, protocol) {
+			return named.Name
+		}
+	}
+	return ""
 }
 
 // ParseFlow extracts key metadata from a Flow for policy generation
@@ -117,9 +277,13 @@ func ParseFlow(flow *Flow) (*ParsedFlow, error) {
 		DestLabels:      make(map[string]string),
 		SourceNamespace: "",
 		DestNamespace:   "",
-		Protocol:        "TCP",     // default
 		Direction:       "ingress", // default from destination perspective
 		Verdict:         flow.Verdict,
+		DropReason:      flow.DropReasonDesc,
+		Count:           1,
+	}
+	if flow.Time != nil {
+		parsed.Time = *flow.Time
 	}
 
 	// Extract source endpoint information
@@ -127,6 +291,8 @@ func ParseFlow(flow *Flow) (*ParsedFlow, error) {
 		parsed.SourceLabels = ParseLabels(flow.Source.Labels)
 		parsed.SourceNamespace = flow.Source.Namespace
 		parsed.SourcePod = flow.Source.PodName
+		parsed.SourceWorkload = workloadName(flow.Source)
+		parsed.SourceEntity = HostEntity(flow.Source)
 	}
 
 	// Extract destination endpoint information
@@ -134,19 +300,77 @@ func ParseFlow(flow *Flow) (*ParsedFlow, error) {
 		parsed.DestLabels = ParseLabels(flow.Destination.Labels)
 		parsed.DestNamespace = flow.Destination.Namespace
 		parsed.DestPod = flow.Destination.PodName
+		parsed.DestWorkload = workloadName(flow.Destination)
+		parsed.DestEntity = HostEntity(flow.Destination)
+	}
+
+	// Extract network layer information
+	if flow.IP != nil {
+		parsed.SourceIP = flow.IP.Source
+		parsed.DestIP = flow.IP.Destination
+		parsed.IPVersion = ipVersion(flow.IP)
+	}
+
+	// Extract destination DNS name (Hubble reports FQDNs with a trailing dot)
+	for _, name := range flow.DestinationNames {
+		name = strings.TrimSuffix(strings.TrimSpace(name), ".")
+		if name != "" {
+			parsed.DestDNSName = strings.ToLower(name)
+			break
+		}
 	}
 
 	// Extract transport layer information
 	if flow.L4 != nil {
 		if flow.L4.TCP != nil {
 			parsed.Protocol = "TCP"
+			parsed.SourcePort = flow.L4.TCP.SourcePort
 			parsed.DestPort = flow.L4.TCP.DestinationPort
+			parsed.TCPFlags = flow.L4.TCP.Flags
 		} else if flow.L4.UDP != nil {
 			parsed.Protocol = "UDP"
+			parsed.SourcePort = flow.L4.UDP.SourcePort
 			parsed.DestPort = flow.L4.UDP.DestinationPort
+		} else if flow.L4.SCTP != nil {
+			parsed.Protocol = "SCTP"
+			parsed.SourcePort = flow.L4.SCTP.SourcePort
+			parsed.DestPort = flow.L4.SCTP.DestinationPort
+		} else if flow.L4.ICMPv4 != nil {
+			parsed.Protocol = "ICMP"
+			parsed.ICMPType = uint8(flow.L4.ICMPv4.Type)
+		} else if flow.L4.ICMPv6 != nil {
+			parsed.Protocol = "ICMPv6"
+			parsed.ICMPType = uint8(flow.L4.ICMPv6.Type)
+		}
+	}
+	if flow.Destination != nil {
+		parsed.DestPortName = portName(flow.Destination.NamedPorts, parsed.DestPort, parsed.Protocol)
+	}
+
+	// Extract the application protocol of L7 records
+	if flow.L7 != nil {
+		switch {
+		case flow.L7.HTTP != nil:
+			parsed.L7Protocol = "HTTP"
+		case flow.L7.DNS != nil:
+			parsed.L7Protocol = "DNS"
+		case flow.L7.Kafka != nil:
+			parsed.L7Protocol = "Kafka"
 		}
 	}
 
+	// Extract HTTP request metadata (responses repeat the request's method
+	// and URL but travel server -> client, so only requests are used)
+	if flow.L7 != nil && flow.L7.HTTP != nil && flow.L7.Type != "RESPONSE" {
+		parseHTTP(flow.L7.HTTP, parsed)
+	}
+
+	// Reply flows travel server -> client; their destination port is ephemeral
+	if flow.IsReply != nil {
+		parsed.IsReply = *flow.IsReply
+		parsed.ReplyReported = true
+	}
+
 	// Determine direction: if we have both source and dest, it's ingress to destination
 	// For now, we'll treat flows as ingress to the destination pod
 	if parsed.DestPod != "" {
@@ -156,14 +380,54 @@ func ParseFlow(flow *Flow) (*ParsedFlow, error) {
 	return parsed, nil
 }
 
-// ParseFlows extracts metadata from all flows in a collection
+// parseHTTP fills the HTTP fields of parsed from an observed HTTP request
+func parseHTTP(http *HTTP, parsed *ParsedFlow) {
+	if http.Method == "" {
+		return
+	}
+
+	parsed.HTTPMethod = strings.ToUpper(http.Method)
+	parsed.HTTPPath = "/"
+	if u, err := url.Parse(http.URL); err == nil {
+		if u.Path != "" {
+			parsed.HTTPPath = u.Path
+		}
+		parsed.HTTPHost = u.Host
+	}
+
+	for _, header := range http.Headers {
+		if header == nil {
+			continue
+		}
+		if key := strings.ToLower(header.Key); parsed.HTTPHost == "" && (key == ":authority" || key == "host") {
+			parsed.HTTPHost = header.Value
+		}
+	}
+}
+
+// parallelParseThreshold is the smallest collection ParseFlows spreads
+// across workers; below it the goroutine overhead outweighs the gain
+const parallelParseThreshold = 1024
+
+// ParseFlows extracts metadata from all flows in a collection. Large
+// collections are parsed by a worker pool sized to GOMAXPROCS; the result
+// keeps the input order either way. Flows that cannot be parsed are skipped.
 func ParseFlows(collection *FlowCollection) ([]*ParsedFlow, error) {
 	if collection == nil {
 		return nil, fmt.Errorf("flow collection is nil")
 	}
 
-	parsedFlows := make([]*ParsedFlow, 0, len(collection.Flows))
-	for _, flow := range collection.Flows {
+	workers := runtime.GOMAXPROCS(0)
+	if workers < 2 || len(collection.Flows) < parallelParseThreshold {
+		return parseFlowsSerial(collection.Flows), nil
+	}
+	return parseFlowsParallel(collection.Flows, workers), nil
+}
+
+// parseFlowsSerial parses flows one after another
+func parseFlowsSerial(flows []*Flow) []*ParsedFlow {
+	parsedFlows := make([]*ParsedFlow, 0, len(flows))
+	for _, flow := range flows {
 		parsed, err := ParseFlow(flow)
 		if err != nil {
 			// Log error but continue processing other flows
@@ -171,8 +435,39 @@ func ParseFlows(collection *FlowCollection) ([]*ParsedFlow, error) {
 		}
 		parsedFlows = append(parsedFlows, parsed)
 	}
+	return parsedFlows
+}
+
+// parseFlowsParallel splits flows into one contiguous chunk per worker.
+// ParseFlow shares no state between flows, so workers only write their own
+// slots of the result.
+func parseFlowsParallel(flows []*Flow, workers int) []*ParsedFlow {
+	results := make([]*ParsedFlow, len(flows))
+	chunk := (len(flows) + workers - 1) / workers
+
+	var wg sync.WaitGroup
+	for start := 0; start < len(flows); start += chunk {
+		end := min(start+chunk, len(flows))
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			for i := start; i < end; i++ {
+				if parsed, err := ParseFlow(flows[i]); err == nil {
+					results[i] = parsed
+				}
+			}
+		}(start, end)
+	}
+	wg.Wait()
 
-	return parsedFlows, nil
+	// Drop the slots of flows that failed to parse
+	parsedFlows := results[:0]
+	for _, parsed := range results {
+		if parsed != nil {
+			parsedFlows = append(parsedFlows, parsed)
+		}
+	}
+	return parsedFlows
 }
 
 // WriteFlowsToFile writes a FlowCollection to a JSON file
@@ -182,7 +477,7 @@ func WriteFlowsToFile(collection *FlowCollection, filePath string) error {
 		return fmt.Errorf("failed to marshal flows: %w", err)
 	}
 
-	if err := os.WriteFile(filePath, data, 0644); err != nil {
+	if err := fileutil.WriteFile(filePath, data, 0644); err != nil {
 		return fmt.Errorf("failed to write flows file: %w", err)
 	}
 
@@ -1,6 +1,13 @@
 package hubble
 
 import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
 	"testing"
 )
 
@@ -105,6 +112,45 @@ func TestParseFlow(t *testing.T) {
 				}
 			},
 		},
+		{
+			name: "dropped flow",
+			flow: &Flow{
+				Source:         &Endpoint{Labels: []string{"k8s:app=frontend"}, Namespace: "default"},
+				Destination:    &Endpoint{Labels: []string{"k8s:app=catalog"}, Namespace: "default"},
+				L4:             &Layer4{TCP: &TCP{DestinationPort: 8080}},
+				Verdict:        "DROPPED",
+				DropReasonDesc: "POLICY_DENIED",
+			},
+			validate: func(t *testing.T, pf *ParsedFlow) {
+				if pf.Verdict != "DROPPED" || pf.DropReason != "POLICY_DENIED" {
+					t.Errorf("Verdict, DropReason = %s, %s, want DROPPED, POLICY_DENIED", pf.Verdict, pf.DropReason)
+				}
+			},
+		},
+		{
+			name: "workloads",
+			flow: &Flow{
+				Source: &Endpoint{
+					Labels:    []string{"k8s:app=frontend"},
+					Namespace: "default",
+					Workloads: []*Workload{{Name: "frontend", Kind: "Deployment"}},
+				},
+				Destination: &Endpoint{
+					Labels:    []string{"k8s:app=catalog"},
+					Namespace: "default",
+					Workloads: []*Workload{{Name: "catalog"}},
+				},
+				L4: &Layer4{TCP: &TCP{DestinationPort: 8080}},
+			},
+			validate: func(t *testing.T, pf *ParsedFlow) {
+				if pf.SourceWorkload != "Deployment/frontend" {
+					t.Errorf("SourceWorkload = %s, want Deployment/frontend", pf.SourceWorkload)
+				}
+				if pf.DestWorkload != "catalog" {
+					t.Errorf("DestWorkload = %s, want catalog", pf.DestWorkload)
+				}
+			},
+		},
 		{
 			name: "valid UDP flow",
 			flow: &Flow{
@@ -132,6 +178,276 @@ func TestParseFlow(t *testing.T) {
 				}
 			},
 		},
+		{
+			name: "external destination with DNS name",
+			flow: &Flow{
+				Source: &Endpoint{
+					Labels:    []string{"k8s:app=frontend"},
+					Namespace: "default",
+				},
+				Destination:      &Endpoint{},
+				DestinationNames: []string{"api.github.com."},
+				IP: &IP{
+					Source:      "10.0.1.5",
+					Destination: "140.82.112.6",
+					IPVersion:   4,
+				},
+				L4: &Layer4{
+					TCP: &TCP{
+						DestinationPort: 443,
+					},
+				},
+			},
+			wantErr: false,
+			validate: func(t *testing.T, pf *ParsedFlow) {
+				if pf.DestDNSName != "api.github.com" {
+					t.Errorf("DestDNSName = %s, want api.github.com", pf.DestDNSName)
+				}
+				if !pf.IsExternalDestination() {
+					t.Errorf("IsExternalDestination() = false, want true")
+				}
+				if pf.SourceIP != "10.0.1.5" || pf.DestIP != "140.82.112.6" {
+					t.Errorf("SourceIP/DestIP = %s/%s, want 10.0.1.5/140.82.112.6", pf.SourceIP, pf.DestIP)
+				}
+				if pf.IPVersion != 4 {
+					t.Errorf("IPVersion = %d, want 4", pf.IPVersion)
+				}
+			},
+		},
+		{
+			name: "reply flow",
+			flow: &Flow{
+				Source: &Endpoint{
+					Labels:    []string{"k8s:app=catalog"},
+					Namespace: "default",
+				},
+				Destination: &Endpoint{
+					Labels:    []string{"k8s:app=frontend"},
+					Namespace: "default",
+				},
+				L4: &Layer4{
+					TCP: &TCP{
+						SourcePort:      8080,
+						DestinationPort: 54321,
+					},
+				},
+				IsReply: boolPtr(true),
+			},
+			wantErr: false,
+			validate: func(t *testing.T, pf *ParsedFlow) {
+				if !pf.IsReply || !pf.ReplyReported {
+					t.Errorf("IsReply/ReplyReported = %t/%t, want true/true", pf.IsReply, pf.ReplyReported)
+				}
+				if pf.SourcePort != 8080 {
+					t.Errorf("SourcePort = %d, want 8080", pf.SourcePort)
+				}
+			},
+		},
+		{
+			name: "TCP flags without is_reply",
+			flow: &Flow{
+				Source:      &Endpoint{Labels: []string{"k8s:app=catalog"}, Namespace: "default"},
+				Destination: &Endpoint{Labels: []string{"k8s:app=frontend"}, Namespace: "default"},
+				L4: &Layer4{
+					TCP: &TCP{SourcePort: 8080, DestinationPort: 54321, Flags: &TCPFlags{SYN: true, ACK: true}},
+				},
+			},
+			wantErr: false,
+			validate: func(t *testing.T, pf *ParsedFlow) {
+				if pf.IsReply || pf.ReplyReported {
+					t.Errorf("IsReply/ReplyReported = %t/%t, want false/false", pf.IsReply, pf.ReplyReported)
+				}
+				if pf.TCPFlags == nil || !pf.TCPFlags.SYN || !pf.TCPFlags.ACK {
+					t.Errorf("TCPFlags = %+v, want SYN and ACK", pf.TCPFlags)
+				}
+			},
+		},
+		{
+			name: "L7 HTTP request",
+			flow: &Flow{
+				Source: &Endpoint{
+					Labels:    []string{"k8s:app=frontend"},
+					Namespace: "default",
+				},
+				Destination: &Endpoint{
+					Labels:    []string{"k8s:app=catalog"},
+					Namespace: "default",
+				},
+				L4: &Layer4{
+					TCP: &TCP{
+						DestinationPort: 8080,
+					},
+				},
+				L7: &Layer7{
+					Type: "REQUEST",
+					HTTP: &HTTP{
+						Method: "get",
+						URL:    "http://catalog:8080/api/v1?page=2",
+					},
+				},
+			},
+			wantErr: false,
+			validate: func(t *testing.T, pf *ParsedFlow) {
+				if pf.HTTPMethod != "GET" || pf.HTTPPath != "/api/v1" {
+					t.Errorf("HTTP request = %s %s, want GET /api/v1", pf.HTTPMethod, pf.HTTPPath)
+				}
+				if pf.HTTPHost != "catalog:8080" {
+					t.Errorf("HTTPHost = %s, want catalog:8080", pf.HTTPHost)
+				}
+			},
+		},
+		{
+			name: "L7 HTTP response is ignored",
+			flow: &Flow{
+				Source: &Endpoint{
+					Labels:    []string{"k8s:app=catalog"},
+					Namespace: "default",
+				},
+				Destination: &Endpoint{
+					Labels:    []string{"k8s:app=frontend"},
+					Namespace: "default",
+				},
+				L7: &Layer7{
+					Type: "RESPONSE",
+					HTTP: &HTTP{
+						Code:   200,
+						Method: "GET",
+						URL:    "http://catalog:8080/api/v1",
+					},
+				},
+			},
+			wantErr: false,
+			validate: func(t *testing.T, pf *ParsedFlow) {
+				if pf.HTTPMethod != "" {
+					t.Errorf("HTTPMethod = %s, want empty for response", pf.HTTPMethod)
+				}
+			},
+		},
+		{
+			name: "L7 DNS response",
+			flow: &Flow{
+				Source:      &Endpoint{Labels: []string{"k8s:k8s-app=kube-dns"}, Namespace: "kube-system"},
+				Destination: &Endpoint{Labels: []string{"k8s:app=frontend"}, Namespace: "default"},
+				L4:          &Layer4{UDP: &UDP{SourcePort: 53, DestinationPort: 41234}},
+				L7:          &Layer7{Type: "RESPONSE", DNS: &DNS{Query: "api.github.com.", Qtypes: []string{"A"}}},
+			},
+			wantErr: false,
+			validate: func(t *testing.T, pf *ParsedFlow) {
+				if pf.L7Protocol != "DNS" {
+					t.Errorf("L7Protocol = %s, want DNS", pf.L7Protocol)
+				}
+			},
+		},
+		{
+			name: "L7 Kafka request",
+			flow: &Flow{
+				Source:      &Endpoint{Labels: []string{"k8s:app=producer"}, Namespace: "default"},
+				Destination: &Endpoint{Labels: []string{"k8s:app=kafka"}, Namespace: "default"},
+				L4:          &Layer4{TCP: &TCP{DestinationPort: 9092}},
+				L7:          &Layer7{Type: "REQUEST", Kafka: &Kafka{APIKey: "produce", Topic: "orders"}},
+			},
+			wantErr: false,
+			validate: func(t *testing.T, pf *ParsedFlow) {
+				if pf.L7Protocol != "Kafka" {
+					t.Errorf("L7Protocol = %s, want Kafka", pf.L7Protocol)
+				}
+				if pf.HTTPMethod != "" {
+					t.Errorf("HTTPMethod = %s, want empty for Kafka", pf.HTTPMethod)
+				}
+			},
+		},
+		{
+			name: "SCTP flow",
+			flow: &Flow{
+				Source:      &Endpoint{Labels: []string{"k8s:app=mme"}, Namespace: "core"},
+				Destination: &Endpoint{Labels: []string{"k8s:app=hss"}, Namespace: "core"},
+				L4:          &Layer4{SCTP: &SCTP{SourcePort: 36412, DestinationPort: 3868}},
+			},
+			wantErr: false,
+			validate: func(t *testing.T, pf *ParsedFlow) {
+				if pf.Protocol != "SCTP" || pf.DestPort != 3868 {
+					t.Errorf("Got %s/%d, want SCTP/3868", pf.Protocol, pf.DestPort)
+				}
+			},
+		},
+		{
+			name: "named destination port",
+			flow: &Flow{
+				Source: &Endpoint{Labels: []string{"k8s:app=frontend"}, Namespace: "default"},
+				Destination: &Endpoint{
+					Labels:     []string{"k8s:app=catalog"},
+					Namespace:  "default",
+					NamedPorts: []NamedPort{{Name: "dns", Port: 8080, Protocol: "UDP"}, {Name: "http", Port: 8080}},
+				},
+				L4: &Layer4{TCP: &TCP{DestinationPort: 8080}},
+			},
+			validate: func(t *testing.T, pf *ParsedFlow) {
+				if pf.DestPortName != "http" {
+					t.Errorf("DestPortName = %q, want http", pf.DestPortName)
+				}
+			},
+		},
+		{
+			name: "unnamed destination port",
+			flow: &Flow{
+				Source: &Endpoint{Labels: []string{"k8s:app=frontend"}, Namespace: "default"},
+				Destination: &Endpoint{
+					Labels:     []string{"k8s:app=catalog"},
+					Namespace:  "default",
+					NamedPorts: []NamedPort{{Name: "metrics", Port: 9090}},
+				},
+				L4: &Layer4{TCP: &TCP{DestinationPort: 8080}},
+			},
+			validate: func(t *testing.T, pf *ParsedFlow) {
+				if pf.DestPortName != "" {
+					t.Errorf("DestPortName = %q, want empty", pf.DestPortName)
+				}
+			},
+		},
+		{
+			name: "ICMPv4 echo request",
+			flow: &Flow{
+				Source:      &Endpoint{Labels: []string{"k8s:app=probe"}, Namespace: "default"},
+				Destination: &Endpoint{Labels: []string{"k8s:app=catalog"}, Namespace: "default"},
+				L4:          &Layer4{ICMPv4: &ICMP{Type: 8}},
+			},
+			wantErr: false,
+			validate: func(t *testing.T, pf *ParsedFlow) {
+				if pf.Protocol != "ICMP" || pf.ICMPType != 8 || pf.DestPort != 0 {
+					t.Errorf("Got %s type %d port %d, want ICMP type 8 without port", pf.Protocol, pf.ICMPType, pf.DestPort)
+				}
+				if !pf.IsICMP() {
+					t.Error("IsICMP() = false, want true")
+				}
+			},
+		},
+		{
+			name: "ICMPv6 echo request",
+			flow: &Flow{
+				Source:      &Endpoint{Labels: []string{"k8s:app=probe"}, Namespace: "default"},
+				Destination: &Endpoint{Labels: []string{"k8s:app=catalog"}, Namespace: "default"},
+				L4:          &Layer4{ICMPv6: &ICMP{Type: 128}},
+			},
+			wantErr: false,
+			validate: func(t *testing.T, pf *ParsedFlow) {
+				if pf.Protocol != "ICMPv6" || pf.ICMPType != 128 {
+					t.Errorf("Got %s type %d, want ICMPv6 type 128", pf.Protocol, pf.ICMPType)
+				}
+			},
+		},
+		{
+			name: "no L4 section",
+			flow: &Flow{
+				Source:      &Endpoint{Labels: []string{"k8s:app=probe"}, Namespace: "default"},
+				Destination: &Endpoint{Labels: []string{"k8s:app=catalog"}, Namespace: "default"},
+			},
+			wantErr: false,
+			validate: func(t *testing.T, pf *ParsedFlow) {
+				if pf.Protocol != "" || pf.DestPort != 0 {
+					t.Errorf("Got %q port %d, want no protocol or port rather than TCP port 0", pf.Protocol, pf.DestPort)
+				}
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -149,3 +465,465 @@ func TestParseFlow(t *testing.T) {
 		})
 	}
 }
+
+func TestReadFlowsFromFileWithFormat(t *testing.T) {
+	const bareFlow = `{"source":{"labels":["k8s:app=frontend"],"namespace":"default"},` +
+		`"destination":{"labels":["k8s:app=catalog"],"namespace":"default"},` +
+		`"IP":{"source":"10.0.0.1","destination":"10.0.0.2","ipVersion":"IPv4"},` +
+		`"l4":{"TCP":{"destination_port":8080}},"verdict":"FORWARDED"}`
+
+	tests := []struct {
+		name      string
+		content   string
+		wantFmt   FlowFormat
+		wantFlows int
+	}{
+		{
+			name:      "policypilot object",
+			content:   `{"schema":"cpp.flows.v1","flows":[` + bareFlow + `]}`,
+			wantFmt:   FormatPolicyPilot,
+			wantFlows: 1,
+		},
+		{
+			name:      "policypilot object with mistyped field",
+			content:   `{"schema":"cpp.flows.v1","flows":[` + bareFlow + `,{"source":{},"verdict":1}]}`,
+			wantFmt:   FormatPolicyPilotLenient,
+			wantFlows: 1,
+		},
+		{
+			name:      "array of bare flows",
+			content:   `[` + bareFlow + `,` + bareFlow + `]`,
+			wantFmt:   FormatArray,
+			wantFlows: 2,
+		},
+		{
+			name:      "array of hubble responses",
+			content:   `[{"flow":` + bareFlow + `,"node_name":"node-1"}]`,
+			wantFmt:   FormatArray,
+			wantFlows: 1,
+		},
+		{
+			name:      "ndjson of bare flows",
+			content:   bareFlow + "\n" + bareFlow + "\n",
+			wantFmt:   FormatNDJSON,
+			wantFlows: 2,
+		},
+		{
+			name:      "hubble observe output",
+			content:   `{"flow":` + bareFlow + `,"node_name":"node-1"}` + "\n" + `{"flow":` + bareFlow + `,"node_name":"node-2"}`,
+			wantFmt:   FormatJSONPB,
+			wantFlows: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "flows.json")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			collection, format, err := ReadFlowsFromFileWithFormat(path)
+			if err != nil {
+				t.Fatalf("ReadFlowsFromFileWithFormat() error = %v", err)
+			}
+			if format != tt.wantFmt {
+				t.Errorf("format = %q, want %q", format, tt.wantFmt)
+			}
+			if len(collection.Flows) != tt.wantFlows {
+				t.Fatalf("Expected %d flows, got %d", tt.wantFlows, len(collection.Flows))
+			}
+			if flow := collection.Flows[0]; flow.IP == nil || flow.IP.Source != "10.0.0.1" || flow.L4 == nil || flow.L4.TCP == nil {
+				t.Errorf("Flow not decoded correctly: %+v", flow)
+			}
+
+			// Reading from an io.Reader detects the same format
+			fromReader, readerFmt, err := ReadFlowsWithFormat(strings.NewReader(tt.content))
+			if err != nil {
+				t.Fatalf("ReadFlowsWithFormat() error = %v", err)
+			}
+			if readerFmt != tt.wantFmt || len(fromReader.Flows) != tt.wantFlows {
+				t.Errorf("ReadFlowsWithFormat() = %d flows as %q, want %d as %q", len(fromReader.Flows), readerFmt, tt.wantFlows, tt.wantFmt)
+			}
+		})
+	}
+}
+
+func TestReadFlowsFromFileStdin(t *testing.T) {
+	const flow = `{"flow":{"source":{"labels":["k8s:app=frontend"],"namespace":"default"},` +
+		`"destination":{"labels":["k8s:app=catalog"],"namespace":"default"},` +
+		`"l4":{"TCP":{"destination_port":8080}},"verdict":"FORWARDED"}}`
+
+	tests := []struct {
+		name string
+		path string
+	}{
+		{name: "plain", path: filepath.Join(t.TempDir(), "flows.json")},
+		{name: "gzipped", path: writeGzipFile(t, "flows.json.gz", flow+"\n"+flow+"\n")},
+	}
+	if err := os.WriteFile(tests[0].path, []byte(flow+"\n"+flow+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdin, err := os.Open(tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer stdin.Close()
+			saved := os.Stdin
+			os.Stdin = stdin
+			defer func() { os.Stdin = saved }()
+
+			collection, format, err := ReadFlowsFromFileWithFormat(StdinPath)
+			if err != nil {
+				t.Fatalf("ReadFlowsFromFileWithFormat(%q) error = %v", StdinPath, err)
+			}
+			if format != FormatJSONPB || len(collection.Flows) != 2 {
+				t.Errorf("Got %d flows as %q, want 2 as %q", len(collection.Flows), format, FormatJSONPB)
+			}
+		})
+	}
+}
+
+func TestIPVersion(t *testing.T) {
+	tests := []struct {
+		name     string
+		ip       IP
+		expected int
+	}{
+		{name: "reported IPv4", ip: IP{Source: "10.0.0.1", Destination: "10.0.0.2", IPVersion: 4}, expected: 4},
+		{name: "reported IPv6", ip: IP{Source: "fd00::1", Destination: "2001:db8::1", IPVersion: 6}, expected: 6},
+		{name: "IPv4 addresses", ip: IP{Source: "10.0.0.1", Destination: "203.0.113.10"}, expected: 4},
+		{name: "IPv6 addresses", ip: IP{Source: "fd00::1", Destination: "2001:db8::1"}, expected: 6},
+		{name: "v4-mapped address", ip: IP{Destination: "::ffff:203.0.113.10"}, expected: 4},
+		{name: "source only", ip: IP{Source: "fd00::1"}, expected: 6},
+		{name: "no addresses", ip: IP{}, expected: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ipVersion(&tt.ip); got != tt.expected {
+				t.Errorf("ipVersion() = %d, want %d", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestIPUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected IP
+		wantErr  bool
+	}{
+		{
+			name:     "hubble enum name",
+			input:    `{"source":"10.0.0.1","destination":"10.0.0.2","ipVersion":"IPv4"}`,
+			expected: IP{Source: "10.0.0.1", Destination: "10.0.0.2", IPVersion: 4},
+		},
+		{
+			name:     "ipv6 enum name",
+			input:    `{"source":"fd00::1","ipVersion":"IPv6"}`,
+			expected: IP{Source: "fd00::1", IPVersion: 6},
+		},
+		{
+			name:     "number",
+			input:    `{"source":"10.0.0.1","ipVersion":4}`,
+			expected: IP{Source: "10.0.0.1", IPVersion: 4},
+		},
+		{
+			name:     "not used",
+			input:    `{"source":"10.0.0.1","ipVersion":"IP_NOT_USED"}`,
+			expected: IP{Source: "10.0.0.1"},
+		},
+		{
+			name:     "missing",
+			input:    `{"source":"10.0.0.1"}`,
+			expected: IP{Source: "10.0.0.1"},
+		},
+		{
+			name:    "invalid type",
+			input:   `{"ipVersion":[4]}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ip IP
+			err := json.Unmarshal([]byte(tt.input), &ip)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unmarshal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && ip != tt.expected {
+				t.Errorf("Unmarshal() = %+v, want %+v", ip, tt.expected)
+			}
+		})
+	}
+}
+
+func TestReadFlowsFromFileFieldNamesInValues(t *testing.T) {
+	// Label values and pod names that contain field-name-like text must
+	// survive decoding untouched
+	labels := []string{`k8s:app=frontend`, `k8s:note="IP":1.2.3.4`, `k8s:version="ipVersion":"IPv4"`}
+	flow := &Flow{
+		Source: &Endpoint{Labels: labels, Namespace: "default", PodName: `frontend-"IP":`},
+		Destination: &Endpoint{
+			Labels:    []string{"k8s:app=catalog"},
+			Namespace: "default",
+		},
+		L4:      &Layer4{TCP: &TCP{DestinationPort: 8080}},
+		Verdict: "FORWARDED",
+	}
+	data, err := json.Marshal(flow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Hubble's own spelling of the IP field
+	line := strings.Replace(string(data), `{`, `{"IP":{"source":"10.0.0.1","destination":"10.0.0.2","ipVersion":"IPv4"},`, 1)
+
+	for _, content := range []string{
+		`{"schema":"cpp.flows.v1","flows":[` + line + `]}`,
+		`{"flow":` + line + "}\n",
+	} {
+		path := filepath.Join(t.TempDir(), "flows.json")
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		collection, _, err := ReadFlowsFromFileWithFormat(path)
+		if err != nil {
+			t.Fatalf("ReadFlowsFromFileWithFormat() error = %v", err)
+		}
+		if len(collection.Flows) != 1 {
+			t.Fatalf("Expected 1 flow, got %d", len(collection.Flows))
+		}
+
+		got := collection.Flows[0]
+		if !reflect.DeepEqual(got.Source.Labels, labels) {
+			t.Errorf("Labels = %q, want %q", got.Source.Labels, labels)
+		}
+		if got.Source.PodName != flow.Source.PodName {
+			t.Errorf("PodName = %q, want %q", got.Source.PodName, flow.Source.PodName)
+		}
+		if got.IP == nil || got.IP.Source != "10.0.0.1" || got.IP.IPVersion != 4 {
+			t.Errorf("IP = %+v, want source 10.0.0.1 and version 4", got.IP)
+		}
+	}
+}
+
+func TestReadFlowsFromFileWithFormatInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "flows.json")
+	if err := os.WriteFile(path, []byte(`{"kind":"NotFlows"}`+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ReadFlowsFromFileWithFormat(path); err == nil {
+		t.Error("Expected error for file without flows")
+	}
+}
+
+func TestIsExternalDestination(t *testing.T) {
+	tests := []struct {
+		name     string
+		flow     *ParsedFlow
+		expected bool
+	}{
+		{
+			name:     "no namespace or labels",
+			flow:     &ParsedFlow{DestLabels: map[string]string{}},
+			expected: true,
+		},
+		{
+			name:     "world identity",
+			flow:     &ParsedFlow{DestLabels: map[string]string{"reserved:world": ""}},
+			expected: true,
+		},
+		{
+			name: "in-cluster pod",
+			flow: &ParsedFlow{
+				DestLabels:    map[string]string{"k8s:app": "catalog"},
+				DestNamespace: "default",
+			},
+			expected: false,
+		},
+		{
+			name:     "labels without namespace",
+			flow:     &ParsedFlow{DestLabels: map[string]string{"reserved:host": ""}},
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := tt.flow.IsExternalDestination(); result != tt.expected {
+				t.Errorf("IsExternalDestination() = %v, want %v", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestIsExternalSource(t *testing.T) {
+	tests := []struct {
+		name     string
+		flow     *ParsedFlow
+		expected bool
+	}{
+		{
+			name:     "IP without labels",
+			flow:     &ParsedFlow{SourceIP: "203.0.113.10"},
+			expected: true,
+		},
+		{
+			name:     "world identity",
+			flow:     &ParsedFlow{SourceIP: "203.0.113.10", SourceLabels: map[string]string{"reserved:world": ""}},
+			expected: true,
+		},
+		{
+			name:     "no IP",
+			flow:     &ParsedFlow{SourceLabels: map[string]string{"reserved:world": ""}},
+			expected: false,
+		},
+		{
+			name: "in-cluster pod",
+			flow: &ParsedFlow{
+				SourceIP:        "10.0.1.5",
+				SourceLabels:    map[string]string{"k8s:app": "frontend"},
+				SourceNamespace: "default",
+			},
+			expected: false,
+		},
+		{
+			name:     "host entity",
+			flow:     &ParsedFlow{SourceIP: "10.0.0.1", SourceLabels: map[string]string{"reserved:host": ""}, SourceEntity: "host"},
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := tt.flow.IsExternalSource(); result != tt.expected {
+				t.Errorf("IsExternalSource() = %v, want %v", result, tt.expected)
+			}
+		})
+	}
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+func TestHostEntity(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint *Endpoint
+		expected string
+	}{
+		{
+			name:     "nil endpoint",
+			endpoint: nil,
+			expected: "",
+		},
+		{
+			name: "regular pod",
+			endpoint: &Endpoint{
+				Labels:    []string{"k8s:app=frontend"},
+				Namespace: "default",
+				Identity:  12345,
+			},
+			expected: "",
+		},
+		{
+			name: "host-network pod with reserved:host label",
+			endpoint: &Endpoint{
+				Labels:    []string{"reserved:host"},
+				Namespace: "kube-system",
+				PodName:   "node-exporter-abcde",
+			},
+			expected: "host",
+		},
+		{
+			name:     "remote node by identity",
+			endpoint: &Endpoint{Identity: IdentityRemoteNode},
+			expected: "remote-node",
+		},
+		{
+			name:     "api server by identity",
+			endpoint: &Endpoint{Identity: IdentityKubeAPIServer},
+			expected: "kube-apiserver",
+		},
+		{
+			name:     "api server on the node",
+			endpoint: &Endpoint{Labels: []string{"reserved:host", "reserved:kube-apiserver"}, Identity: IdentityHost},
+			expected: "kube-apiserver",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := HostEntity(tt.endpoint); result != tt.expected {
+				t.Errorf("HostEntity() = %q, want %q", result, tt.expected)
+			}
+		})
+	}
+}
+
+// testFlows returns n distinct flows; every tenth one is nil and fails to parse
+func testFlows(n int) []*Flow {
+	flows := make([]*Flow, n)
+	for i := range flows {
+		if i%10 == 9 {
+			continue
+		}
+		flows[i] = &Flow{
+			Source:      &Endpoint{Labels: []string{"k8s:app=frontend"}, Namespace: "default", PodName: fmt.Sprintf("frontend-%d", i)},
+			Destination: &Endpoint{Labels: []string{"k8s:app=catalog"}, Namespace: "default"},
+			L4:          &Layer4{TCP: &TCP{DestinationPort: uint16(1 + i%65535)}},
+			Verdict:     "FORWARDED",
+		}
+	}
+	return flows
+}
+
+func TestParseFlowsKeepsOrder(t *testing.T) {
+	flows := testFlows(5 * parallelParseThreshold)
+	parsed, err := ParseFlows(&FlowCollection{Flows: flows})
+	if err != nil {
+		t.Fatalf("ParseFlows() error = %v", err)
+	}
+
+	expected := parseFlowsSerial(flows)
+	if len(parsed) != len(expected) {
+		t.Fatalf("Expected %d parsed flows, got %d", len(expected), len(parsed))
+	}
+	for i := range parsed {
+		if parsed[i].SourcePod != expected[i].SourcePod {
+			t.Fatalf("parsed[%d] = %s, want %s", i, parsed[i].SourcePod, expected[i].SourcePod)
+		}
+	}
+
+	if parallel := parseFlowsParallel(flows, 3); !reflect.DeepEqual(parallel, expected) {
+		t.Errorf("parseFlowsParallel() differs from parseFlowsSerial()")
+	}
+}
+
+// BenchmarkParseFlows compares parsing a large capture serially and with a
+// worker pool
+func BenchmarkParseFlows(b *testing.B) {
+	flows := testFlows(200000)
+
+	b.Run("serial", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			parseFlowsSerial(flows)
+		}
+	})
+
+	b.Run("parallel", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			parseFlowsParallel(flows, runtime.GOMAXPROCS(0))
+		}
+	})
+}
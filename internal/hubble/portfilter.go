@@ -0,0 +1,63 @@
+package hubble
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// PortFilter selects flows by destination port and L4 protocol. Empty lists
+// match every flow.
+type PortFilter struct {
+	Ports     []uint16
+	Protocols []string
+}
+
+// IsZero reports whether the filter keeps every flow
+func (f PortFilter) IsZero() bool {
+	return len(f.Ports) == 0 && len(f.Protocols) == 0
+}
+
+// FilterFlowsByPort returns the flows whose destination port is in
+// filter.Ports and whose protocol is in filter.Protocols (case-insensitive).
+// Flows without a port, such as ICMP, never match a port filter.
+func FilterFlowsByPort(flows []*ParsedFlow, filter PortFilter) []*ParsedFlow {
+	if filter.IsZero() {
+		return flows
+	}
+
+	result := make([]*ParsedFlow, 0, len(flows))
+	for _, flow := range flows {
+		if len(filter.Ports) > 0 && (flow.DestPort == 0 || !slices.Contains(filter.Ports, flow.DestPort)) {
+			continue
+		}
+		if len(filter.Protocols) > 0 && !slices.ContainsFunc(filter.Protocols, func(p string) bool {
+			return strings.EqualFold(p, flow.Protocol)
+		}) {
+			continue
+		}
+		result = append(result, flow)
+	}
+	return result
+}
+
+// ParseProtocol returns the canonical name of an L4 protocol as used in
+// ParsedFlow.Protocol, e.g. "tcp" -> "TCP" and "icmpv6" -> "ICMPv6"
+func ParseProtocol(value string) (string, error) {
+	for _, protocol := range []string{"TCP", "UDP", "SCTP", "ICMP", "ICMPv6"} {
+		if strings.EqualFold(value, protocol) {
+			return protocol, nil
+		}
+	}
+	return "", fmt.Errorf("unknown protocol '%s': must be TCP, UDP, SCTP, ICMP or ICMPv6", value)
+}
+
+// NormalizeProtocol returns the canonical name of a known L4 protocol, as
+// ParseProtocol does, and any other protocol upper-cased, so that "tcp" and
+// "TCP" compare equal. An empty protocol stays empty.
+func NormalizeProtocol(protocol string) string {
+	if canonical, err := ParseProtocol(protocol); err == nil {
+		return canonical
+	}
+	return strings.ToUpper(protocol)
+}
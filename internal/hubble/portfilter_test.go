@@ -0,0 +1,80 @@
+package hubble
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFilterFlowsByPort(t *testing.T) {
+	https := &ParsedFlow{DestPort: 443, Protocol: "TCP"}
+	web := &ParsedFlow{DestPort: 8080, Protocol: "TCP"}
+	dns := &ParsedFlow{DestPort: 53, Protocol: "UDP"}
+	ping := &ParsedFlow{Protocol: "ICMP", ICMPType: 8}
+	flows := []*ParsedFlow{https, web, dns, ping}
+
+	tests := []struct {
+		name     string
+		filter   PortFilter
+		expected []*ParsedFlow
+	}{
+		{name: "no filter", filter: PortFilter{}, expected: flows},
+		{name: "ports", filter: PortFilter{Ports: []uint16{443, 8080}}, expected: []*ParsedFlow{https, web}},
+		{name: "protocol is case-insensitive", filter: PortFilter{Protocols: []string{"udp", "icmp"}}, expected: []*ParsedFlow{dns, ping}},
+		{name: "ports and protocols", filter: PortFilter{Ports: []uint16{53, 443}, Protocols: []string{"TCP"}}, expected: []*ParsedFlow{https}},
+		{name: "port filter drops portless flows", filter: PortFilter{Ports: []uint16{0}, Protocols: []string{"ICMP"}}, expected: []*ParsedFlow{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FilterFlowsByPort(flows, tt.filter); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("FilterFlowsByPort() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseProtocol(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected string
+		wantErr  bool
+	}{
+		{value: "tcp", expected: "TCP"},
+		{value: "SCTP", expected: "SCTP"},
+		{value: "icmpv6", expected: "ICMPv6"},
+		{value: "http", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseProtocol(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseProtocol(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if got != tt.expected {
+				t.Errorf("ParseProtocol(%q) = %q, want %q", tt.value, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestNormalizeProtocol(t *testing.T) {
+	tests := []struct {
+		protocol string
+		expected string
+	}{
+		{protocol: "tcp", expected: "TCP"},
+		{protocol: "Udp", expected: "UDP"},
+		{protocol: "ICMPV6", expected: "ICMPv6"},
+		{protocol: "any", expected: "ANY"},
+		{protocol: "", expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.protocol, func(t *testing.T) {
+			if got := NormalizeProtocol(tt.protocol); got != tt.expected {
+				t.Errorf("NormalizeProtocol(%q) = %q, want %q", tt.protocol, got, tt.expected)
+			}
+		})
+	}
+}
@@ -1,10 +1,17 @@
 package hubble
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/prabhakaran-jm/cilium-policypilot/internal/fileutil"
 )
 
 // HubbleReader handles reading flows from Hubble
@@ -24,45 +31,135 @@ func NewHubbleReader() *HubbleReader {
 	}
 }
 
-// CaptureFlows captures flows from Hubble CLI and saves to file
-// This runs: hubble observe -o json > output_file
-func (r *HubbleReader) CaptureFlows(duration string, outputFile string) error {
-	// Ensure output directory exists
-	if err := os.MkdirAll(filepath.Dir(outputFile), 0755); err != nil {
-		return fmt.Errorf("failed to create output directory: %w", err)
-	}
+// CaptureOptions selects the flows CaptureFlows asks hubble observe for.
+// Filters of one kind match any of their values; different kinds must all
+// match.
+type CaptureOptions struct {
+	// Since limits the capture to recent flows, as a duration (e.g. "5m")
+	// or RFC3339 timestamp (default: hubble's most recent flows)
+	Since string
+
+	// Namespaces, Pods and Nodes filter flows server-side. Pods are
+	// "[namespace/]name" patterns and Nodes are node names, both as
+	// accepted by hubble observe --pod and --node-name.
+	Namespaces []string
+	Pods       []string
+	Nodes      []string
+
+	// Timeout stops each hubble observe run that takes longer, e.g. because
+	// Relay hangs. Zero means no timeout.
+	Timeout time.Duration
 
-	// Build hubble observe command
+	// Attempts is how often hubble observe is run before giving up; runs
+	// that fail or time out are retried after RetryBackoff, doubling each
+	// time. Values below 1 mean a single attempt.
+	Attempts     int
+	RetryBackoff time.Duration
+
+	// OnRetry, if set, is called with the failed attempt's number and error
+	// before waiting to retry
+	OnRetry func(attempt int, err error, wait time.Duration)
+}
+
+// Defaults for capturing with the hubble CLI from the command line
+const (
+	DefaultCaptureTimeout      = 5 * time.Minute
+	DefaultCaptureAttempts     = 3
+	DefaultCaptureRetryBackoff = 2 * time.Second
+)
+
+// captureArgs builds the hubble observe arguments for opts. Values are
+// passed as --flag=value, so none can be mistaken for another flag.
+func captureArgs(opts CaptureOptions) ([]string, error) {
 	args := []string{"observe", "-o", "json"}
+	if opts.Since != "" {
+		args = append(args, "--since="+opts.Since)
+	}
 
-	// Add duration if specified (e.g., "--since 5m" or "--last 100")
-	if duration != "" {
-		args = append(args, duration)
+	filters := []struct {
+		flag   string
+		values []string
+	}{
+		{"namespace", opts.Namespaces},
+		{"pod", opts.Pods},
+		{"node-name", opts.Nodes},
+	}
+	for _, filter := range filters {
+		for _, value := range filter.values {
+			if strings.TrimSpace(value) == "" {
+				return nil, fmt.Errorf("empty --%s filter", filter.flag)
+			}
+			args = append(args, fmt.Sprintf("--%s=%s", filter.flag, value))
+		}
 	}
 
-	// Execute hubble observe command
-	cmd := exec.Command(r.HubbleCLI, args...)
+	return args, nil
+}
 
-	// Capture output to file
-	outFile, err := os.Create(outputFile)
+// CaptureFlows captures flows from Hubble CLI and saves to file
+// This runs: hubble observe -o json [filters] > output_file
+// Failed runs are retried as set by opts.Attempts. outputFile is only
+// replaced by a complete capture: on failure it keeps its previous content,
+// or stays absent.
+func (r *HubbleReader) CaptureFlows(ctx context.Context, opts CaptureOptions, outputFile string) error {
+	args, err := captureArgs(opts)
 	if err != nil {
-		return fmt.Errorf("failed to create output file: %w", err)
+		return err
 	}
-	defer outFile.Close()
-
-	cmd.Stdout = outFile
-	cmd.Stderr = os.Stderr
 
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to execute hubble observe: %w", err)
+	// Ensure output directory exists
+	if err := os.MkdirAll(filepath.Dir(outputFile), 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
 	}
 
-	return nil
+	attempts := max(opts.Attempts, 1)
+	backoff := opts.RetryBackoff
+	attempt := 1
+	for ; ; attempt++ {
+		err = r.runCapture(ctx, args, opts.Timeout, outputFile)
+		if err == nil || attempt == attempts || ctx.Err() != nil || errors.Is(err, exec.ErrNotFound) {
+			break
+		}
+
+		if opts.OnRetry != nil {
+			opts.OnRetry(attempt, err, backoff)
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return fmt.Errorf("capture cancelled: %w", ctx.Err())
+		}
+		backoff *= 2
+	}
+	if err != nil && attempt > 1 {
+		return fmt.Errorf("%w (after %d attempts)", err, attempt)
+	}
+	return err
 }
 
-// ReadFlowsFromHubbleAPI reads flows directly from Hubble API
-// This is a placeholder for future API integration
-func (r *HubbleReader) ReadFlowsFromHubbleAPI(endpoint string) (*FlowCollection, error) {
-	// TODO: Implement Hubble API client
-	return nil, fmt.Errorf("hubble API integration not yet implemented")
+// runCapture runs hubble observe once, writing its output to outputFile
+// atomically. The process is killed when timeout elapses.
+func (r *HubbleReader) runCapture(ctx context.Context, args []string, timeout time.Duration, outputFile string) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	// Execute hubble observe command
+	cmd := exec.CommandContext(ctx, r.HubbleCLI, args...)
+
+	cmd.Stderr = os.Stderr
+
+	// Capture output to file, keeping any previous capture if hubble fails
+	return fileutil.WriteAtomic(outputFile, 0644, func(w io.Writer) error {
+		cmd.Stdout = w
+		if err := cmd.Run(); err != nil {
+			if timeout > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return fmt.Errorf("hubble observe timed out after %s", timeout)
+			}
+			return fmt.Errorf("failed to execute hubble observe: %w", err)
+		}
+		return nil
+	})
 }
@@ -0,0 +1,153 @@
+package hubble
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCaptureArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     CaptureOptions
+		expected []string
+		wantErr  bool
+	}{
+		{
+			name:     "no filters",
+			expected: []string{"observe", "-o", "json"},
+		},
+		{
+			name: "all filters",
+			opts: CaptureOptions{
+				Since:      "5m",
+				Namespaces: []string{"shop", "web"},
+				Pods:       []string{"shop/frontend"},
+				Nodes:      []string{"kind-worker"},
+			},
+			expected: []string{"observe", "-o", "json", "--since=5m", "--namespace=shop", "--namespace=web", "--pod=shop/frontend", "--node-name=kind-worker"},
+		},
+		{
+			name:     "values stay single arguments",
+			opts:     CaptureOptions{Namespaces: []string{"shop; rm -rf /"}, Pods: []string{"--output=x"}},
+			expected: []string{"observe", "-o", "json", "--namespace=shop; rm -rf /", "--pod=--output=x"},
+		},
+		{
+			name:    "empty filter",
+			opts:    CaptureOptions{Nodes: []string{" "}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, err := captureArgs(tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("captureArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(args, tt.expected) {
+				t.Errorf("captureArgs() = %q, want %q", args, tt.expected)
+			}
+		})
+	}
+}
+
+// fakeHubble writes a shell script standing in for the hubble CLI
+func fakeHubble(t *testing.T, script string) *HubbleReader {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake hubble CLI is a shell script")
+	}
+	path := filepath.Join(t.TempDir(), "hubble")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return &HubbleReader{HubbleCLI: path}
+}
+
+func TestCaptureFlowsRetry(t *testing.T) {
+	dir := t.TempDir()
+	marker := filepath.Join(dir, "failed-once")
+	output := filepath.Join(dir, "flows.json")
+
+	// Fails on the first run and succeeds on the second
+	reader := fakeHubble(t, "if [ -f "+marker+" ]; then echo '{}'; else touch "+marker+"; exit 1; fi\n")
+
+	var retries []int
+	opts := CaptureOptions{
+		Attempts:     3,
+		RetryBackoff: time.Millisecond,
+		OnRetry:      func(attempt int, err error, wait time.Duration) { retries = append(retries, attempt) },
+	}
+	if err := reader.CaptureFlows(context.Background(), opts, output); err != nil {
+		t.Fatalf("CaptureFlows() error = %v", err)
+	}
+	if !reflect.DeepEqual(retries, []int{1}) {
+		t.Errorf("OnRetry called for attempts %v, want [1]", retries)
+	}
+	if data, _ := os.ReadFile(output); string(data) != "{}\n" {
+		t.Errorf("output = %q, want the second run's output", data)
+	}
+}
+
+func TestCaptureFlowsMissingCLI(t *testing.T) {
+	// A missing CLI is not retried, so no attempts are reported
+	reader := &HubbleReader{HubbleCLI: "cpp-test-missing-hubble"}
+	opts := CaptureOptions{Attempts: 3, RetryBackoff: time.Millisecond}
+	err := reader.CaptureFlows(context.Background(), opts, filepath.Join(t.TempDir(), "flows.json"))
+	if !errors.Is(err, exec.ErrNotFound) {
+		t.Fatalf("CaptureFlows() error = %v, want exec.ErrNotFound", err)
+	}
+	if strings.Contains(err.Error(), "attempts") {
+		t.Errorf("CaptureFlows() error = %q, want no attempt count", err)
+	}
+}
+
+func TestCaptureFlowsFailureKeepsPreviousCapture(t *testing.T) {
+	tests := []struct {
+		name    string
+		script  string
+		opts    CaptureOptions
+		wantErr string
+	}{
+		{
+			name:    "timeout",
+			script:  "echo partial\nexec sleep 10\n",
+			opts:    CaptureOptions{Timeout: 100 * time.Millisecond},
+			wantErr: "hubble observe timed out after 100ms",
+		},
+		{
+			name:    "every attempt fails",
+			script:  "echo partial\nexit 1\n",
+			opts:    CaptureOptions{Attempts: 2, RetryBackoff: time.Millisecond},
+			wantErr: "(after 2 attempts)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := filepath.Join(t.TempDir(), "flows.json")
+			if err := os.WriteFile(output, []byte("previous"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			err := fakeHubble(t, tt.script).CaptureFlows(context.Background(), tt.opts, output)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("CaptureFlows() error = %v, want %q", err, tt.wantErr)
+			}
+			if data, _ := os.ReadFile(output); string(data) != "previous" {
+				t.Errorf("output = %q, want the previous capture", data)
+			}
+			if entries, _ := os.ReadDir(filepath.Dir(output)); len(entries) != 1 {
+				t.Errorf("Expected no temporary files left, got %v", entries)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package hubble
+
+import "fmt"
+
+// DetectReplies marks flows as replies when Hubble did not report is_reply
+// but the flow looks like the response half of a connection, so only the
+// connection-initiating direction drives policy rules:
+//
+//   - A TCP segment with SYN and ACK set answers a SYN and is a reply; one
+//     with SYN alone opens the connection and is not.
+//   - Otherwise, a flow whose mirror was also observed (same addresses and
+//     ports, swapped) belongs to the same connection. If Hubble or the SYN
+//     flag classified the mirror, the flow is its opposite; if not, the side
+//     sending to the higher port is taken to reply, since clients send from
+//     an ephemeral port above the server's.
+//
+// Flows without ports or without addresses or pod names to match are left
+// unchanged. It returns the number of flows marked. Run it before
+// DeduplicateFlows, which merges flows with different source ports.
+func DetectReplies(flows []*ParsedFlow) int {
+	connections := make(map[string]*ParsedFlow, len(flows))
+	for _, flow := range flows {
+		if key := connectionKey(flow, false); key != "" {
+			if _, exists := connections[key]; !exists {
+				connections[key] = flow
+			}
+		}
+	}
+
+	marked := 0
+	for _, flow := range flows {
+		if flow.ReplyReported || flow.IsReply {
+			continue
+		}
+		if isReplyFlow(flow, connections) {
+			flow.IsReply = true
+			marked++
+		}
+	}
+	return marked
+}
+
+// isReplyFlow applies the DetectReplies heuristics to a flow Hubble did not
+// classify
+func isReplyFlow(flow *ParsedFlow, connections map[string]*ParsedFlow) bool {
+	if flags := flow.TCPFlags; flags != nil && flags.SYN {
+		return flags.ACK
+	}
+
+	key := connectionKey(flow, true)
+	if key == "" {
+		return false
+	}
+	mirror, exists := connections[key]
+	if !exists {
+		return false
+	}
+	if mirror.ReplyReported {
+		return !mirror.IsReply
+	}
+	if flags := mirror.TCPFlags; flags != nil && flags.SYN {
+		return !flags.ACK
+	}
+	return flow.DestPort > flow.SourcePort
+}
+
+// connectionKey identifies a flow's connection by protocol, addresses and
+// ports, from the mirror's point of view if reverse is set. It is empty when
+// the flow has no ports or no address or pod name on either side.
+func connectionKey(flow *ParsedFlow, reverse bool) string {
+	if flow.SourcePort == 0 || flow.DestPort == 0 {
+		return ""
+	}
+	source := endpointAddress(flow.SourceIP, flow.SourceNamespace, flow.SourcePod)
+	dest := endpointAddress(flow.DestIP, flow.DestNamespace, flow.DestPod)
+	if source == "" || dest == "" {
+		return ""
+	}
+
+	if reverse {
+		return fmt.Sprintf("%s %s:%d %s:%d", flow.Protocol, dest, flow.DestPort, source, flow.SourcePort)
+	}
+	return fmt.Sprintf("%s %s:%d %s:%d", flow.Protocol, source, flow.SourcePort, dest, flow.DestPort)
+}
+
+// endpointAddress returns an endpoint's IP, or its namespace/pod name if
+// the flow has no IP
+func endpointAddress(ip, namespace, pod string) string {
+	if ip != "" {
+		return ip
+	}
+	if pod != "" {
+		return namespace + "/" + pod
+	}
+	return ""
+}
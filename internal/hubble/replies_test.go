@@ -0,0 +1,99 @@
+package hubble
+
+import "testing"
+
+func TestDetectReplies(t *testing.T) {
+	flow := func(sourceIP string, sourcePort uint16, destIP string, destPort uint16) *ParsedFlow {
+		return &ParsedFlow{
+			SourceIP:   sourceIP,
+			SourcePort: sourcePort,
+			DestIP:     destIP,
+			DestPort:   destPort,
+			Protocol:   "TCP",
+		}
+	}
+	reported := func(f *ParsedFlow, reply bool) *ParsedFlow {
+		f.IsReply = reply
+		f.ReplyReported = true
+		return f
+	}
+	withFlags := func(f *ParsedFlow, flags TCPFlags) *ParsedFlow {
+		f.TCPFlags = &flags
+		return f
+	}
+
+	tests := []struct {
+		name     string
+		flows    []*ParsedFlow
+		expected []bool
+	}{
+		{
+			name:     "SYN-ACK is a reply",
+			flows:    []*ParsedFlow{withFlags(flow("10.0.0.2", 8080, "10.0.0.1", 41000), TCPFlags{SYN: true, ACK: true})},
+			expected: []bool{true},
+		},
+		{
+			name:     "SYN opens the connection",
+			flows:    []*ParsedFlow{withFlags(flow("10.0.0.1", 41000, "10.0.0.2", 8080), TCPFlags{SYN: true})},
+			expected: []bool{false},
+		},
+		{
+			name:     "mirror from the lower port is the server",
+			flows:    []*ParsedFlow{flow("10.0.0.1", 41000, "10.0.0.2", 8080), flow("10.0.0.2", 8080, "10.0.0.1", 41000)},
+			expected: []bool{false, true},
+		},
+		{
+			name:     "mirror of an opening SYN is a reply",
+			flows:    []*ParsedFlow{withFlags(flow("10.0.0.1", 80, "10.0.0.2", 8080), TCPFlags{SYN: true}), flow("10.0.0.2", 8080, "10.0.0.1", 80)},
+			expected: []bool{false, true},
+		},
+		{
+			name:     "mirror reported by Hubble decides",
+			flows:    []*ParsedFlow{reported(flow("10.0.0.1", 30000, "10.0.0.2", 40000), true), flow("10.0.0.2", 40000, "10.0.0.1", 30000)},
+			expected: []bool{true, false},
+		},
+		{
+			name:     "reported flows are kept",
+			flows:    []*ParsedFlow{reported(flow("10.0.0.1", 41000, "10.0.0.2", 8080), false), reported(flow("10.0.0.2", 8080, "10.0.0.1", 41000), false)},
+			expected: []bool{false, false},
+		},
+		{
+			name:     "flow without a mirror is kept",
+			flows:    []*ParsedFlow{flow("10.0.0.2", 8080, "10.0.0.1", 41000)},
+			expected: []bool{false},
+		},
+		{
+			name:     "mirror with another protocol does not match",
+			flows:    []*ParsedFlow{flow("10.0.0.1", 41000, "10.0.0.2", 8080), {SourceIP: "10.0.0.2", SourcePort: 8080, DestIP: "10.0.0.1", DestPort: 41000, Protocol: "UDP"}},
+			expected: []bool{false, false},
+		},
+		{
+			name: "pod names match without IPs",
+			flows: []*ParsedFlow{
+				{SourceNamespace: "shop", SourcePod: "frontend-1", SourcePort: 41000, DestNamespace: "shop", DestPod: "catalog-1", DestPort: 8080, Protocol: "TCP"},
+				{SourceNamespace: "shop", SourcePod: "catalog-1", SourcePort: 8080, DestNamespace: "shop", DestPod: "frontend-1", DestPort: 41000, Protocol: "TCP"},
+			},
+			expected: []bool{false, true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wantMarked := 0
+			for i, f := range tt.flows {
+				if tt.expected[i] && !f.IsReply {
+					wantMarked++
+				}
+			}
+
+			if marked := DetectReplies(tt.flows); marked != wantMarked {
+				t.Errorf("DetectReplies() = %d, want %d", marked, wantMarked)
+			}
+			for i, f := range tt.flows {
+				if f.IsReply != tt.expected[i] {
+					t.Errorf("flow %d IsReply = %t, want %t", i, f.IsReply, tt.expected[i])
+				}
+			}
+		})
+	}
+}
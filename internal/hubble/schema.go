@@ -0,0 +1,76 @@
+package hubble
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Flow file schemas
+const (
+	// SchemaV1 holds Hubble flows as read from the API or hubble observe
+	SchemaV1 = "cpp.flows.v1"
+	// CurrentSchema is the schema written by this version, which
+	// ValidateSchema migrates older files to
+	CurrentSchema = SchemaV1
+)
+
+// schemaPrefix starts every flow file schema, followed by the version
+const schemaPrefix = "cpp.flows.v"
+
+// schemaMigrations upgrade a collection from the keyed schema to the next
+// version. A new schema registers the migration from the previous one here,
+// so files in every older schema keep loading.
+var schemaMigrations = map[string]func(*FlowCollection) error{}
+
+// ValidateSchema checks that a collection has a known schema, migrating
+// collections in an older schema to CurrentSchema in place. Collections in
+// a newer schema, written by a later version of cpp, or in an unknown one
+// are rejected.
+func ValidateSchema(collection *FlowCollection) error {
+	return validateSchema(collection, CurrentSchema, schemaMigrations)
+}
+
+// validateSchema is ValidateSchema with the current schema and its
+// migrations as parameters
+func validateSchema(collection *FlowCollection, current string, migrations map[string]func(*FlowCollection) error) error {
+	if collection == nil {
+		return fmt.Errorf("flow collection is nil")
+	}
+	if collection.Schema == "" {
+		return fmt.Errorf("missing schema field")
+	}
+
+	version, ok := schemaVersion(collection.Schema)
+	if !ok {
+		return fmt.Errorf("unknown schema %q: expected %s", collection.Schema, current)
+	}
+	if currentVersion, _ := schemaVersion(current); version > currentVersion {
+		return fmt.Errorf("schema %s is newer than %s, the latest this version of cpp reads; upgrade cpp to read it", collection.Schema, current)
+	}
+
+	for collection.Schema != current {
+		migrate, exists := migrations[collection.Schema]
+		if !exists {
+			return fmt.Errorf("unsupported schema %s: no migration to %s", collection.Schema, current)
+		}
+		from := collection.Schema
+		if err := migrate(collection); err != nil {
+			return fmt.Errorf("failed to migrate flows from schema %s: %w", from, err)
+		}
+	}
+	return nil
+}
+
+// schemaVersion returns the version of a cpp.flows.v<N> schema
+func schemaVersion(schema string) (int, bool) {
+	digits, found := strings.CutPrefix(schema, schemaPrefix)
+	if !found {
+		return 0, false
+	}
+	version, err := strconv.Atoi(digits)
+	if err != nil || version < 1 || strconv.Itoa(version) != digits {
+		return 0, false
+	}
+	return version, true
+}
@@ -0,0 +1,77 @@
+package hubble
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateSchema(t *testing.T) {
+	tests := []struct {
+		name    string
+		schema  string
+		wantErr string
+	}{
+		{name: "v1", schema: "cpp.flows.v1"},
+		{name: "missing", schema: "", wantErr: "missing schema field"},
+		{name: "newer version", schema: "cpp.flows.v2", wantErr: "schema cpp.flows.v2 is newer than cpp.flows.v1"},
+		{name: "unknown schema", schema: "hubble.flows", wantErr: `unknown schema "hubble.flows"`},
+		{name: "malformed version", schema: "cpp.flows.v01", wantErr: "unknown schema"},
+		{name: "version zero", schema: "cpp.flows.v0", wantErr: "unknown schema"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flow := &Flow{Verdict: "FORWARDED"}
+			collection := &FlowCollection{Schema: tt.schema, Flows: []*Flow{flow}}
+			err := ValidateSchema(collection)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("ValidateSchema() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ValidateSchema() error = %v", err)
+			}
+			if collection.Schema != CurrentSchema || len(collection.Flows) != 1 || collection.Flows[0] != flow {
+				t.Errorf("Expected the collection unchanged, got %+v", collection)
+			}
+		})
+	}
+
+	if err := ValidateSchema(nil); err == nil {
+		t.Errorf("Expected an error for a nil collection")
+	}
+}
+
+func TestValidateSchemaMigration(t *testing.T) {
+	// With v3 current, v1 files migrate through v2
+	migrations := map[string]func(*FlowCollection) error{
+		"cpp.flows.v1": func(collection *FlowCollection) error {
+			for _, flow := range collection.Flows {
+				flow.Verdict = strings.ToUpper(flow.Verdict)
+			}
+			collection.Schema = "cpp.flows.v2"
+			return nil
+		},
+		"cpp.flows.v2": func(collection *FlowCollection) error {
+			collection.Schema = "cpp.flows.v3"
+			return nil
+		},
+	}
+
+	collection := &FlowCollection{Schema: "cpp.flows.v1", Flows: []*Flow{{Verdict: "forwarded"}}}
+	if err := validateSchema(collection, "cpp.flows.v3", migrations); err != nil {
+		t.Fatalf("validateSchema() error = %v", err)
+	}
+	if collection.Schema != "cpp.flows.v3" || collection.Flows[0].Verdict != "FORWARDED" {
+		t.Errorf("Expected the collection migrated to v3, got %+v", collection)
+	}
+
+	// A gap in the migrations is an error rather than a silent misread
+	delete(migrations, "cpp.flows.v2")
+	collection = &FlowCollection{Schema: "cpp.flows.v1"}
+	if err := validateSchema(collection, "cpp.flows.v3", migrations); err == nil || !strings.Contains(err.Error(), "no migration") {
+		t.Errorf("validateSchema() error = %v, want a missing migration", err)
+	}
+}
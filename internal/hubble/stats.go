@@ -0,0 +1,83 @@
+package hubble
+
+import "sort"
+
+// topTalkerLimit is the number of endpoints listed in Stats.TopTalkers
+const topTalkerLimit = 5
+
+// Stats summarizes a set of flows, to tell at a glance whether a capture is
+// useful for proposing policies. Counts are weighted by Occurrences.
+type Stats struct {
+	Flows int
+	// Allowed counts flows with any verdict other than DROPPED, DENIED or
+	// ERROR; Denied counts those. Flows without a verdict count as neither.
+	Allowed int
+	Denied  int
+	// Verdicts counts flows by verdict, e.g. FORWARDED or DROPPED
+	Verdicts map[string]int
+	// Sources and Destinations are the numbers of distinct endpoints, named
+	// as in PortExposure
+	Sources      int
+	Destinations int
+	// Namespaces lists the source and destination namespaces, sorted
+	Namespaces []string
+	// TopTalkers are the sources with the most flows, most first
+	TopTalkers []Talker
+}
+
+// Talker is a source endpoint and the number of flows it sent
+type Talker struct {
+	Endpoint string
+	Flows    int
+}
+
+// ComputeStats summarizes flows
+func ComputeStats(flows []*ParsedFlow) *Stats {
+	stats := &Stats{Verdicts: make(map[string]int)}
+	sources := make(map[string]int)
+	destinations := make(map[string]bool)
+	namespaces := make(map[string]bool)
+
+	for _, flow := range flows {
+		count := flow.Occurrences()
+		stats.Flows += count
+
+		switch {
+		case flow.Verdict == "":
+		case flow.IsDenied():
+			stats.Denied += count
+		default:
+			stats.Allowed += count
+		}
+		if flow.Verdict != "" {
+			stats.Verdicts[flow.Verdict] += count
+		}
+
+		sources[sourceName(flow)] += count
+		destinations[destinationName(flow)] = true
+		for _, namespace := range []string{flow.SourceNamespace, flow.DestNamespace} {
+			if namespace != "" {
+				namespaces[namespace] = true
+			}
+		}
+	}
+
+	stats.Sources = len(sources)
+	stats.Destinations = len(destinations)
+	stats.Namespaces = sortedNames(namespaces)
+
+	for endpoint, count := range sources {
+		stats.TopTalkers = append(stats.TopTalkers, Talker{Endpoint: endpoint, Flows: count})
+	}
+	sort.Slice(stats.TopTalkers, func(i, j int) bool {
+		if stats.TopTalkers[i].Flows != stats.TopTalkers[j].Flows {
+			return stats.TopTalkers[i].Flows > stats.TopTalkers[j].Flows
+		}
+		return stats.TopTalkers[i].Endpoint < stats.TopTalkers[j].Endpoint
+	})
+	if len(stats.TopTalkers) > topTalkerLimit {
+		stats.TopTalkers = stats.TopTalkers[:topTalkerLimit]
+	}
+
+	return stats
+}
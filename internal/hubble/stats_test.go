@@ -0,0 +1,60 @@
+package hubble
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestComputeStats(t *testing.T) {
+	flow := func(source, sourceNamespace, dest string, verdict string, count int) *ParsedFlow {
+		return &ParsedFlow{
+			SourceLabels:    map[string]string{"k8s:app": source},
+			SourceNamespace: sourceNamespace,
+			DestLabels:      map[string]string{"k8s:app": dest},
+			DestNamespace:   "shop",
+			DestPort:        8080,
+			Protocol:        "TCP",
+			Verdict:         verdict,
+			Count:           count,
+		}
+	}
+
+	flows := []*ParsedFlow{
+		flow("frontend", "shop", "catalog", "FORWARDED", 10),
+		flow("frontend", "shop", "cart", "FORWARDED", 2),
+		flow("checkout", "shop", "cart", "DROPPED", 3),
+		flow("prometheus", "monitoring", "catalog", "AUDIT", 1),
+		flow("loadgen", "test", "catalog", "", 1),
+		flow("a", "test", "catalog", "FORWARDED", 1),
+		flow("b", "test", "catalog", "FORWARDED", 1),
+		{SourceIP: "203.0.113.10", DestLabels: map[string]string{"k8s:app": "catalog"}, DestNamespace: "shop", DestPort: 8080, Protocol: "TCP", Verdict: "DENIED"},
+	}
+
+	expected := &Stats{
+		Flows:        20,
+		Allowed:      15,
+		Denied:       4,
+		Verdicts:     map[string]int{"FORWARDED": 14, "DROPPED": 3, "AUDIT": 1, "DENIED": 1},
+		Sources:      7,
+		Destinations: 2,
+		Namespaces:   []string{"monitoring", "shop", "test"},
+		TopTalkers: []Talker{
+			{Endpoint: "shop/frontend", Flows: 12},
+			{Endpoint: "shop/checkout", Flows: 3},
+			{Endpoint: "203.0.113.10", Flows: 1},
+			{Endpoint: "monitoring/prometheus", Flows: 1},
+			{Endpoint: "test/a", Flows: 1},
+		},
+	}
+
+	if stats := ComputeStats(flows); !reflect.DeepEqual(stats, expected) {
+		t.Errorf("ComputeStats() = %+v, want %+v", stats, expected)
+	}
+}
+
+func TestComputeStatsEmpty(t *testing.T) {
+	stats := ComputeStats(nil)
+	if stats.Flows != 0 || stats.Sources != 0 || len(stats.Namespaces) != 0 || len(stats.TopTalkers) != 0 {
+		t.Errorf("ComputeStats(nil) = %+v, want an empty summary", stats)
+	}
+}
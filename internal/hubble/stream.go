@@ -0,0 +1,195 @@
+package hubble
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// StreamFlows decodes flows from r one at a time and calls fn for each, so
+// the input never has to be held in memory. Accepts both the PolicyPilot
+// format ({"schema":...,"flows":[...]}) and Hubble NDJSON, where each line is
+// {"flow":{...},"node_name":"...","time":"..."}. Returning an error from fn
+// stops the stream.
+func StreamFlows(r io.Reader, fn func(*Flow) error) error {
+	dec := json.NewDecoder(bufio.NewReaderSize(r, 64*1024))
+
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read flows: %w", err)
+		}
+		if delim, ok := tok.(json.Delim); !ok || delim != '{' {
+			return fmt.Errorf("failed to read flows: expected JSON object, got %v", tok)
+		}
+
+		if err := streamObject(dec, fn); err != nil {
+			return err
+		}
+	}
+}
+
+// streamObject walks the keys of a top-level object whose opening brace has
+// already been read, emitting its "flow" value or each "flows" element
+func streamObject(dec *json.Decoder, fn func(*Flow) error) error {
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return fmt.Errorf("failed to read flows: %w", err)
+		}
+
+		switch key, _ := tok.(string); key {
+		case "flow":
+			var flow Flow
+			if err := dec.Decode(&flow); err != nil {
+				return fmt.Errorf("failed to decode flow: %w", err)
+			}
+			if err := fn(&flow); err != nil {
+				return err
+			}
+
+		case "flows":
+			tok, err := dec.Token()
+			if err != nil {
+				return fmt.Errorf("failed to read flows: %w", err)
+			}
+			if tok == nil { // "flows": null
+				continue
+			}
+			if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+				return fmt.Errorf("failed to read flows: expected array for flows, got %v", tok)
+			}
+			for dec.More() {
+				var flow Flow
+				if err := dec.Decode(&flow); err != nil {
+					return fmt.Errorf("failed to decode flow: %w", err)
+				}
+				if err := fn(&flow); err != nil {
+					return err
+				}
+			}
+			if _, err := dec.Token(); err != nil { // closing ']'
+				return fmt.Errorf("failed to read flows: %w", err)
+			}
+
+		default:
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return fmt.Errorf("failed to read flows: %w", err)
+			}
+		}
+	}
+
+	// Closing '}'
+	if _, err := dec.Token(); err != nil {
+		return fmt.Errorf("failed to read flows: %w", err)
+	}
+	return nil
+}
+
+// maxFlowLineSize is the longest NDJSON line readNDJSONFlows accepts
+const maxFlowLineSize = 16 * 1024 * 1024
+
+// readNDJSONFlows decodes one flow per line from r, holding only the current
+// line in memory. Lines that are not flows are skipped, like the in-memory
+// NDJSON path does.
+func readNDJSONFlows(r io.Reader) (*FlowCollection, FlowFormat, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxFlowLineSize)
+
+	flows := make([]*Flow, 0)
+	wrapped := 0
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		flow, isWrapped, ok := decodeFlowLine(line)
+		if !ok {
+			continue
+		}
+		flows = append(flows, flow)
+		if isWrapped {
+			wrapped++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, "", fmt.Errorf("failed to read flows file: %w", err)
+	}
+
+	if len(flows) == 0 {
+		return nil, "", fmt.Errorf("failed to parse flows JSON: no flows found in NDJSON input")
+	}
+
+	format := FormatNDJSON
+	if wrapped > 0 {
+		format = FormatJSONPB
+	}
+	return &FlowCollection{
+		Schema: CurrentSchema,
+		Flows:  flows,
+	}, format, nil
+}
+
+// StreamUniqueFlows streams flows from r and calls fn only for the first
+// occurrence of each fingerprint, together with its parsed form. Flows that
+// cannot be parsed are skipped. dedup.Unique() gives the running count of
+// unique flows and may be shared across several inputs.
+func StreamUniqueFlows(r io.Reader, dedup *FlowDeduper, fn func(*Flow, *ParsedFlow) error) error {
+	return StreamFlows(r, func(flow *Flow) error {
+		parsed, err := ParseFlow(flow)
+		if err != nil {
+			return nil
+		}
+		if !dedup.Add(parsed) {
+			return nil
+		}
+		return fn(flow, parsed)
+	})
+}
+
+// ReadUniqueFlowsFromFile streams a flows file, keeping only the first
+// occurrence of each distinct flow. The returned deduper reports how many
+// flows were read in total. The file may be gzipped.
+func ReadUniqueFlowsFromFile(filePath string) (*FlowCollection, *FlowDeduper, error) {
+	return ReadUniqueFlowsFromFiles(filePath)
+}
+
+// ReadUniqueFlowsFromFiles is like ReadUniqueFlowsFromFile for several
+// files, keeping only the first occurrence of each distinct flow across all
+// of them
+func ReadUniqueFlowsFromFiles(filePaths ...string) (*FlowCollection, *FlowDeduper, error) {
+	collection := &FlowCollection{
+		Schema: CurrentSchema,
+		Flows:  []*Flow{},
+	}
+	dedup := NewFlowDeduper()
+	for _, filePath := range filePaths {
+		if err := streamUniqueFlowsFromFile(filePath, dedup, collection); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return collection, dedup, nil
+}
+
+// streamUniqueFlowsFromFile appends the flows of a file not yet seen by
+// dedup to collection
+func streamUniqueFlowsFromFile(filePath string, dedup *FlowDeduper, collection *FlowCollection) error {
+	file, err := openFlowsFile(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to open flows file: %w", err)
+	}
+	defer file.Close()
+
+	return StreamUniqueFlows(file, dedup, func(flow *Flow, _ *ParsedFlow) error {
+		collection.Flows = append(collection.Flows, flow)
+		return nil
+	})
+}
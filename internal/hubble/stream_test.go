@@ -0,0 +1,220 @@
+package hubble
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStreamUniqueFlows(t *testing.T) {
+	// Three distinct tuples repeated many times, with per-replica pod names
+	// that must not defeat deduplication
+	tuples := []struct {
+		source, dest string
+		port         int
+		verdict      string
+	}{
+		{"frontend", "catalog", 8080, "FORWARDED"},
+		{"frontend", "catalog", 8080, "DROPPED"},
+		{"catalog", "database", 5432, "FORWARDED"},
+	}
+
+	var sb strings.Builder
+	const repeats = 1000
+	for i := 0; i < repeats; i++ {
+		for _, tuple := range tuples {
+			fmt.Fprintf(&sb, `{"flow":{"source":{"labels":["k8s:app=%s"],"namespace":"default","pod_name":"%s-%d"},`+
+				`"destination":{"labels":["k8s:app=%s"],"namespace":"default"},`+
+				`"IP":{"source":"10.0.0.%d","destination":"10.0.1.1","ipVersion":"IPv4"},`+
+				`"l4":{"TCP":{"source_port":%d,"destination_port":%d}},"verdict":"%s"},"node_name":"node-1"}`+"\n",
+				tuple.source, tuple.source, i, tuple.dest, i%250, 30000+i, tuple.port, tuple.verdict)
+		}
+	}
+
+	dedup := NewFlowDeduper()
+	var unique []*ParsedFlow
+	err := StreamUniqueFlows(strings.NewReader(sb.String()), dedup, func(flow *Flow, parsed *ParsedFlow) error {
+		unique = append(unique, parsed)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("StreamUniqueFlows() error = %v", err)
+	}
+
+	if dedup.Total() != repeats*len(tuples) {
+		t.Errorf("Total() = %d, want %d", dedup.Total(), repeats*len(tuples))
+	}
+	if dedup.Unique() != len(tuples) {
+		t.Errorf("Unique() = %d, want %d", dedup.Unique(), len(tuples))
+	}
+	if len(unique) != len(tuples) {
+		t.Fatalf("Expected %d unique flows, got %d", len(tuples), len(unique))
+	}
+	if unique[0].Verdict != "FORWARDED" || unique[1].Verdict != "DROPPED" {
+		t.Errorf("Expected allowed and denied flows to stay separate, got %s and %s", unique[0].Verdict, unique[1].Verdict)
+	}
+}
+
+func TestStreamFlowsCollectionFormat(t *testing.T) {
+	input := `{
+  "schema": "cpp.flows.v1",
+  "flows": [
+    {"source": {"labels": ["k8s:app=frontend"], "namespace": "default"},
+     "destination": {"labels": ["k8s:app=catalog"], "namespace": "default"},
+     "l4": {"TCP": {"destination_port": 8080}}},
+    {"source": {"labels": ["k8s:app=catalog"], "namespace": "default"},
+     "destination": {"labels": ["k8s:app=database"], "namespace": "default"},
+     "l4": {"TCP": {"destination_port": 5432}}}
+  ]
+}`
+
+	var ports []uint16
+	err := StreamFlows(strings.NewReader(input), func(flow *Flow) error {
+		ports = append(ports, flow.L4.TCP.DestinationPort)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("StreamFlows() error = %v", err)
+	}
+	if len(ports) != 2 || ports[0] != 8080 || ports[1] != 5432 {
+		t.Errorf("Expected ports [8080 5432], got %v", ports)
+	}
+}
+
+// ndjsonFlows returns n Hubble NDJSON flow lines
+func ndjsonFlows(n int) string {
+	var sb strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&sb, `{"flow":{"source":{"labels":["k8s:app=frontend"],"namespace":"default","pod_name":"frontend-%d"},`+
+			`"destination":{"labels":["k8s:app=catalog"],"namespace":"default"},`+
+			`"IP":{"source":"10.0.0.%d","destination":"10.0.1.1","ipVersion":"IPv4"},`+
+			`"l4":{"TCP":{"source_port":%d,"destination_port":8080}},"verdict":"FORWARDED"},"node_name":"node-1"}`+"\n",
+			i, i%250, 30000+i%30000)
+	}
+	return sb.String()
+}
+
+func TestReadFlowsFromFileNDJSONStreaming(t *testing.T) {
+	longLabel := strings.Repeat("x", 100*1024)
+	longLine := `{"flow":{"source":{"labels":["k8s:app=frontend","k8s:note=` + longLabel + `"],"namespace":"default"},` +
+		`"destination":{"labels":["k8s:app=catalog"],"namespace":"default"},"verdict":"FORWARDED"}}` + "\n"
+
+	tests := []struct {
+		name      string
+		file      string
+		content   string
+		wantFmt   FlowFormat
+		wantFlows int
+	}{
+		{
+			name:      "detected from first line",
+			file:      "flows.json",
+			content:   ndjsonFlows(3),
+			wantFmt:   FormatJSONPB,
+			wantFlows: 3,
+		},
+		{
+			name:      "leading blank lines",
+			file:      "flows.json",
+			content:   "\n\n" + ndjsonFlows(2),
+			wantFmt:   FormatJSONPB,
+			wantFlows: 2,
+		},
+		{
+			name:      "ndjson extension with invalid first line",
+			file:      "flows.ndjson",
+			content:   "not json\n" + ndjsonFlows(2),
+			wantFmt:   FormatJSONPB,
+			wantFlows: 2,
+		},
+		{
+			name:      "line longer than the default scanner buffer",
+			file:      "flows.json",
+			content:   longLine + ndjsonFlows(1),
+			wantFmt:   FormatJSONPB,
+			wantFlows: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			collection, format, err := ReadFlowsFromFileWithFormat(path)
+			if err != nil {
+				t.Fatalf("ReadFlowsFromFileWithFormat() error = %v", err)
+			}
+			if format != tt.wantFmt {
+				t.Errorf("format = %q, want %q", format, tt.wantFmt)
+			}
+			if len(collection.Flows) != tt.wantFlows {
+				t.Errorf("Expected %d flows, got %d", tt.wantFlows, len(collection.Flows))
+			}
+		})
+	}
+}
+
+// BenchmarkReadFlowsFromFile compares the streaming NDJSON path with parsing
+// the whole file in memory
+func BenchmarkReadFlowsFromFile(b *testing.B) {
+	path := filepath.Join(b.TempDir(), "flows.json")
+	if err := os.WriteFile(path, []byte(ndjsonFlows(20000)), 0644); err != nil {
+		b.Fatal(err)
+	}
+
+	b.Run("streaming", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, _, err := ReadFlowsFromFileWithFormat(path); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("in-memory", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, _, err := parseFlowsData(data); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestReadUniqueFlowsFromFiles(t *testing.T) {
+	dir := t.TempDir()
+	dropped := `{"flow":{"source":{"labels":["k8s:app=frontend"],"namespace":"default"},` +
+		`"destination":{"labels":["k8s:app=catalog"],"namespace":"default"},` +
+		`"l4":{"TCP":{"source_port":30000,"destination_port":8080}},"verdict":"DROPPED"}}` + "\n"
+	files := map[string]string{
+		"first.json":  ndjsonFlows(2),
+		"second.json": ndjsonFlows(3) + dropped,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	collection, dedup, err := ReadUniqueFlowsFromFiles(filepath.Join(dir, "first.json"), filepath.Join(dir, "second.json"))
+	if err != nil {
+		t.Fatalf("ReadUniqueFlowsFromFiles() error = %v", err)
+	}
+	// Every forwarded flow is the same tuple, in either file
+	if dedup.Total() != 6 || dedup.Unique() != 2 || len(collection.Flows) != 2 {
+		t.Errorf("Got %d of %d flows unique and %d collected, want 2 of 6 and 2", dedup.Unique(), dedup.Total(), len(collection.Flows))
+	}
+
+	if _, _, err := ReadUniqueFlowsFromFiles(filepath.Join(dir, "first.json"), filepath.Join(dir, "missing.json")); err == nil {
+		t.Errorf("Expected an error for a missing file")
+	}
+}
@@ -0,0 +1,64 @@
+package hubble
+
+import (
+	"fmt"
+	"time"
+)
+
+// TimeFilter selects flows observed within a time window. Zero bounds are
+// open.
+type TimeFilter struct {
+	Since time.Time
+	Until time.Time
+	// RequireTimestamp drops flows without a timestamp, which are otherwise
+	// kept since they cannot be placed in the window
+	RequireTimestamp bool
+}
+
+// IsZero reports whether the filter keeps every flow
+func (f TimeFilter) IsZero() bool {
+	return f.Since.IsZero() && f.Until.IsZero() && !f.RequireTimestamp
+}
+
+// FilterFlowsByTime returns the flows observed between filter.Since and
+// filter.Until, both inclusive
+func FilterFlowsByTime(flows []*ParsedFlow, filter TimeFilter) []*ParsedFlow {
+	if filter.IsZero() {
+		return flows
+	}
+
+	result := make([]*ParsedFlow, 0, len(flows))
+	for _, flow := range flows {
+		if flow.Time.IsZero() {
+			if !filter.RequireTimestamp {
+				result = append(result, flow)
+			}
+			continue
+		}
+		if !filter.Since.IsZero() && flow.Time.Before(filter.Since) {
+			continue
+		}
+		if !filter.Until.IsZero() && flow.Time.After(filter.Until) {
+			continue
+		}
+		result = append(result, flow)
+	}
+	return result
+}
+
+// ParseTimeBound parses a --since/--until value: an RFC3339 timestamp such as
+// "2025-01-02T15:04:05Z", or a duration such as "30m" or "2h" meaning that
+// long before now
+func ParseTimeBound(value string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q: must be RFC3339 (e.g. 2025-01-02T15:04:05Z) or a duration (e.g. 30m)", value)
+	}
+	if d < 0 {
+		return time.Time{}, fmt.Errorf("invalid time %q: duration must not be negative", value)
+	}
+	return now.Add(-d), nil
+}
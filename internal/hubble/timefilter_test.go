@@ -0,0 +1,88 @@
+package hubble
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimeBound(t *testing.T) {
+	now := time.Date(2025, 1, 2, 15, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		input    string
+		expected time.Time
+		wantErr  bool
+	}{
+		{input: "2025-01-02T14:30:00Z", expected: time.Date(2025, 1, 2, 14, 30, 0, 0, time.UTC)},
+		{input: "30m", expected: time.Date(2025, 1, 2, 14, 30, 0, 0, time.UTC)},
+		{input: "2h", expected: time.Date(2025, 1, 2, 13, 0, 0, 0, time.UTC)},
+		{input: "-5m", wantErr: true},
+		{input: "yesterday", wantErr: true},
+		{input: "2025-01-02", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := ParseTimeBound(tt.input, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseTimeBound() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !result.Equal(tt.expected) {
+				t.Errorf("ParseTimeBound() = %v, want %v", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFilterFlowsByTime(t *testing.T) {
+	at := func(minute int) *ParsedFlow {
+		ts := time.Date(2025, 1, 2, 14, minute, 0, 0, time.UTC)
+		parsed, err := ParseFlow(&Flow{Time: &ts})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+	untimed := &ParsedFlow{}
+	flows := []*ParsedFlow{at(0), at(15), at(30), untimed, at(45)}
+
+	tests := []struct {
+		name     string
+		filter   TimeFilter
+		expected []*ParsedFlow
+	}{
+		{
+			name:     "no filter",
+			expected: flows,
+		},
+		{
+			name:     "since is inclusive",
+			filter:   TimeFilter{Since: flows[1].Time},
+			expected: []*ParsedFlow{flows[1], flows[2], untimed, flows[4]},
+		},
+		{
+			name:     "window",
+			filter:   TimeFilter{Since: flows[1].Time, Until: flows[2].Time},
+			expected: []*ParsedFlow{flows[1], flows[2], untimed},
+		},
+		{
+			name:     "require timestamp",
+			filter:   TimeFilter{Until: flows[1].Time, RequireTimestamp: true},
+			expected: []*ParsedFlow{flows[0], flows[1]},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := FilterFlowsByTime(flows, tt.filter)
+			if len(result) != len(tt.expected) {
+				t.Fatalf("Expected %d flows, got %d", len(tt.expected), len(result))
+			}
+			for i := range result {
+				if result[i] != tt.expected[i] {
+					t.Errorf("flow[%d] = %v, want %v", i, result[i].Time, tt.expected[i].Time)
+				}
+			}
+		})
+	}
+}
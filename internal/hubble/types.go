@@ -1,6 +1,11 @@
 package hubble
 
-import "time"
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
 
 // Flow represents a single network flow observed by Hubble
 type Flow struct {
@@ -13,20 +18,37 @@ type Flow struct {
 	// Destination endpoint information
 	Destination *Endpoint `json:"destination,omitempty"`
 
-	// Network layer information (supports both "ip" and "IP" field names from Hubble)
+	// Network layer information. Hubble writes "IP"; encoding/json matches
+	// field names case-insensitively, so both spellings decode here.
 	IP *IP `json:"ip,omitempty"`
 
 	// Transport layer information
 	L4 *Layer4 `json:"l4,omitempty"`
 
+	// Application layer information (only present for flows proxied by Envoy)
+	L7 *Layer7 `json:"l7,omitempty"`
+
 	// Flow verdict (ALLOWED, DENIED, etc.)
 	Verdict string `json:"verdict,omitempty"`
 
+	// Why the flow was dropped (e.g. POLICY_DENIED), for dropped flows
+	DropReasonDesc string `json:"drop_reason_desc,omitempty"`
+
+	// Whether the flow is a reply to a connection initiated by the destination
+	// (nil when Hubble could not determine it)
+	IsReply *bool `json:"is_reply,omitempty"`
+
 	// Flow type (L3_L4, L7, etc.) - can be string or FlowType struct
 	Type interface{} `json:"type,omitempty" json:"Type,omitempty"`
 
 	// Event type (PolicyVerdict, Trace, etc.)
 	EventType *EventType `json:"event_type,omitempty"`
+
+	// DNS names resolved for the source IP (from Hubble's DNS cache)
+	SourceNames []string `json:"source_names,omitempty"`
+
+	// DNS names resolved for the destination IP (from Hubble's DNS cache)
+	DestinationNames []string `json:"destination_names,omitempty"`
 }
 
 // Endpoint represents a network endpoint (pod, service, etc.)
@@ -45,6 +67,18 @@ type Endpoint struct {
 
 	// Identity (security identity)
 	Identity uint64 `json:"identity,omitempty"`
+
+	// Named container ports of the pod. Hubble does not report them, but
+	// captures enriched from the Kubernetes API may.
+	NamedPorts []NamedPort `json:"named_ports,omitempty"`
+}
+
+// NamedPort is a named container port, e.g. "http" for 8080/TCP
+type NamedPort struct {
+	Name string `json:"name"`
+	Port uint16 `json:"port"`
+	// Protocol defaults to TCP, as in a Kubernetes container port
+	Protocol string `json:"protocol,omitempty"`
 }
 
 // Workload represents a Kubernetes workload
@@ -64,8 +98,46 @@ type IP struct {
 	// Destination IP address
 	Destination string `json:"destination,omitempty"`
 
-	// IP version (4 or 6) - can be int or string like "IPv4"
-	IPVersion interface{} `json:"ipVersion,omitempty"`
+	// IP version (4 or 6). Decoded from a number or from Hubble's enum name
+	// such as "IPv4"; see UnmarshalJSON.
+	IPVersion int `json:"ipVersion,omitempty"`
+}
+
+// UnmarshalJSON decodes an IP, accepting ipVersion either as a number or as
+// Hubble's enum name ("IPv4", "IPv6"). Other names, such as "IP_NOT_USED",
+// decode as 0.
+func (ip *IP) UnmarshalJSON(data []byte) error {
+	type plainIP IP
+	aux := struct {
+		*plainIP
+		IPVersion json.RawMessage `json:"ipVersion,omitempty"`
+	}{plainIP: (*plainIP)(ip)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	ip.IPVersion = 0
+	if len(aux.IPVersion) == 0 || string(aux.IPVersion) == "null" {
+		return nil
+	}
+
+	var version int
+	if err := json.Unmarshal(aux.IPVersion, &version); err == nil {
+		ip.IPVersion = version
+		return nil
+	}
+
+	var name string
+	if err := json.Unmarshal(aux.IPVersion, &name); err != nil {
+		return fmt.Errorf("invalid ipVersion %s: must be a number or a name like \"IPv4\"", aux.IPVersion)
+	}
+	switch strings.ToUpper(name) {
+	case "IPV4", "4":
+		ip.IPVersion = 4
+	case "IPV6", "6":
+		ip.IPVersion = 6
+	}
+	return nil
 }
 
 // Layer4 represents transport layer information
@@ -75,6 +147,15 @@ type Layer4 struct {
 
 	// UDP information
 	UDP *UDP `json:"UDP,omitempty"`
+
+	// SCTP information
+	SCTP *SCTP `json:"SCTP,omitempty"`
+
+	// ICMP information (IPv4)
+	ICMPv4 *ICMP `json:"ICMPv4,omitempty"`
+
+	// ICMP information (IPv6)
+	ICMPv6 *ICMP `json:"ICMPv6,omitempty"`
 }
 
 // TCP represents TCP protocol information
@@ -84,6 +165,17 @@ type TCP struct {
 
 	// Destination port
 	DestinationPort uint16 `json:"destination_port,omitempty"`
+
+	// Flags set on the observed segment, if Hubble reported them
+	Flags *TCPFlags `json:"flags,omitempty"`
+}
+
+// TCPFlags are the TCP header flags of an observed segment
+type TCPFlags struct {
+	SYN bool `json:"SYN,omitempty"`
+	ACK bool `json:"ACK,omitempty"`
+	FIN bool `json:"FIN,omitempty"`
+	RST bool `json:"RST,omitempty"`
 }
 
 // UDP represents UDP protocol information
@@ -95,6 +187,87 @@ type UDP struct {
 	DestinationPort uint16 `json:"destination_port,omitempty"`
 }
 
+// SCTP represents SCTP protocol information
+type SCTP struct {
+	// Source port
+	SourcePort uint16 `json:"source_port,omitempty"`
+
+	// Destination port
+	DestinationPort uint16 `json:"destination_port,omitempty"`
+}
+
+// ICMP represents ICMPv4 or ICMPv6 message information
+type ICMP struct {
+	// Message type (e.g. 8 for an ICMPv4 echo request)
+	Type uint32 `json:"type,omitempty"`
+
+	// Message code
+	Code uint32 `json:"code,omitempty"`
+}
+
+// Layer7 represents application layer information
+type Layer7 struct {
+	// Record type (REQUEST, RESPONSE, SAMPLE)
+	Type string `json:"type,omitempty"`
+
+	// HTTP information
+	HTTP *HTTP `json:"http,omitempty"`
+
+	// DNS information
+	DNS *DNS `json:"dns,omitempty"`
+
+	// Kafka information
+	Kafka *Kafka `json:"kafka,omitempty"`
+}
+
+// HTTP represents an HTTP request or response observed by the L7 proxy
+type HTTP struct {
+	// Response status code (0 for requests)
+	Code uint32 `json:"code,omitempty"`
+
+	// Request method (GET, POST, etc.)
+	Method string `json:"method,omitempty"`
+
+	// Full request URL, e.g. "http://catalog:8080/api/v1?page=2"
+	URL string `json:"url,omitempty"`
+
+	// Protocol version (HTTP/1.1, HTTP/2)
+	Protocol string `json:"protocol,omitempty"`
+
+	// Request headers
+	Headers []*HTTPHeader `json:"headers,omitempty"`
+}
+
+// HTTPHeader represents a single HTTP header
+type HTTPHeader struct {
+	Key   string `json:"key,omitempty"`
+	Value string `json:"value,omitempty"`
+}
+
+// DNS represents a DNS query or response observed by the DNS proxy
+type DNS struct {
+	// Queried name, e.g. "api.github.com."
+	Query string `json:"query,omitempty"`
+
+	// Response code (0 for queries and successful responses)
+	Rcode uint32 `json:"rcode,omitempty"`
+
+	// Query types (A, AAAA, ...)
+	Qtypes []string `json:"qtypes,omitempty"`
+}
+
+// Kafka represents a Kafka request or response observed by the L7 proxy
+type Kafka struct {
+	// Request type, e.g. "produce" or "fetch"
+	APIKey string `json:"api_key,omitempty"`
+
+	// Topic name
+	Topic string `json:"topic,omitempty"`
+
+	// Error code (0 for requests and successful responses)
+	ErrorCode int32 `json:"error_code,omitempty"`
+}
+
 // FlowType represents the type of flow
 type FlowType struct {
 	Type int32 `json:"type,omitempty"`
@@ -113,6 +286,14 @@ type FlowCollection struct {
 
 // ParsedFlow contains extracted metadata from a Flow for policy generation
 type ParsedFlow struct {
+	// When the flow was observed; zero if the flow had no timestamp. For
+	// flows merged by DeduplicateFlows, the earliest timestamp.
+	Time time.Time
+
+	// The latest timestamp of the flows DeduplicateFlows merged into this
+	// one; zero if none was merged or none had a timestamp
+	LastTime time.Time
+
 	// Source pod labels (as map for easy lookup)
 	SourceLabels map[string]string
 
@@ -122,6 +303,21 @@ type ParsedFlow struct {
 	// Source pod name
 	SourcePod string
 
+	// Workload owning the source pod as kind/name (e.g.
+	// "Deployment/frontend"), if Hubble reported one
+	SourceWorkload string
+
+	// Source IP address
+	SourceIP string
+
+	// Source port; for the client side of a connection it is ephemeral
+	SourcePort uint16
+
+	// Cilium reserved entity of the source ("host", "remote-node",
+	// "kube-apiserver") when it is the node itself, a host-network pod or the
+	// API server rather than a regular pod
+	SourceEntity string
+
 	// Destination pod labels (as map for easy lookup)
 	DestLabels map[string]string
 
@@ -131,17 +327,186 @@ type ParsedFlow struct {
 	// Destination pod name
 	DestPod string
 
+	// Workload owning the destination pod as kind/name, if Hubble reported one
+	DestWorkload string
+
+	// Destination IP address
+	DestIP string
+
+	// IP version of the flow, 4 or 6: Hubble's ipVersion or, if it is
+	// missing, the family of the addresses; 0 if unknown
+	IPVersion int
+
+	// Cilium reserved entity of the destination ("host", "remote-node",
+	// "kube-apiserver") when it is the node itself, a host-network pod or the
+	// API server rather than a regular pod
+	DestEntity string
+
+	// Destination DNS name (e.g. "api.github.com"), if observed
+	DestDNSName string
+
 	// Destination port
 	DestPort uint16
 
-	// Protocol (TCP, UDP, etc.)
+	// Name of DestPort on the destination pod (e.g. "http"), if the capture
+	// carries the pod's named ports
+	DestPortName string
+
+	// Protocol (TCP, UDP, SCTP, ICMP, ICMPv6), empty if the flow has no L4
+	// section Hubble could decode. Such flows have no ports and yield no
+	// rules.
 	Protocol string
 
+	// ICMP message type, if Protocol is ICMP or ICMPv6. ICMP flows have no
+	// DestPort.
+	ICMPType uint8
+
+	// Application protocol seen by the L7 proxy (HTTP, DNS, Kafka), if any.
+	// Unlike the HTTP fields this is set for responses too.
+	L7Protocol string
+
+	// HTTP request method, if the flow is an observed L7 HTTP request
+	HTTPMethod string
+
+	// HTTP request path without query string, if HTTPMethod is set
+	HTTPPath string
+
+	// HTTP request host (URL host or :authority/Host header), if HTTPMethod is set
+	HTTPHost string
+
 	// Direction (ingress/egress from destination perspective)
 	Direction string
 
+	// IsReply is true when the flow is the response half of a connection,
+	// so DestPort is the client's ephemeral port rather than a service port
+	IsReply bool
+
+	// ReplyReported is true when Hubble reported is_reply, so IsReply is
+	// not guessed by DetectReplies
+	ReplyReported bool
+
+	// TCP flags of the observed segment, if Protocol is TCP and Hubble
+	// reported them
+	TCPFlags *TCPFlags
+
 	// Verdict
 	Verdict string
+
+	// DropReason is Hubble's reason for dropping the flow (e.g.
+	// POLICY_DENIED), if it was dropped
+	DropReason string
+
+	// Count is the number of observed flows this entry stands for (see
+	// DeduplicateFlows); zero is treated as one
+	Count int
+}
+
+// Occurrences returns the number of observed flows this entry stands for
+func (f *ParsedFlow) Occurrences() int {
+	if f.Count < 1 {
+		return 1
+	}
+	return f.Count
+}
+
+// IsDenied reports whether the flow was not allowed: dropped, denied or
+// failed with an error
+func (f *ParsedFlow) IsDenied() bool {
+	switch f.Verdict {
+	case "DROPPED", "DENIED", "ERROR":
+		return true
+	}
+	return false
+}
+
+// IsICMP reports whether the flow is ICMPv4 or ICMPv6 traffic
+func (f *ParsedFlow) IsICMP() bool {
+	protocol := NormalizeProtocol(f.Protocol)
+	return protocol == "ICMP" || protocol == "ICMPv6"
+}
+
+// IsExternalDestination reports whether the destination lies outside the cluster,
+// i.e. it has no namespace and no pod labels other than Cilium's world/CIDR/FQDN
+// identity labels
+func (f *ParsedFlow) IsExternalDestination() bool {
+	if f.DestNamespace != "" || f.DestEntity != "" {
+		return false
+	}
+	for key := range f.DestLabels {
+		if !isExternalIdentityLabel(key) {
+			return false
+		}
+	}
+	return true
+}
+
+// IsExternalSource reports whether the source is a client outside the cluster,
+// i.e. it has an IP but no namespace and no pod labels other than Cilium's
+// world/CIDR/FQDN identity labels
+func (f *ParsedFlow) IsExternalSource() bool {
+	if f.SourceIP == "" || f.SourceNamespace != "" || f.SourceEntity != "" {
+		return false
+	}
+	for key := range f.SourceLabels {
+		if !isExternalIdentityLabel(key) {
+			return false
+		}
+	}
+	return true
+}
+
+// isExternalIdentityLabel reports whether a label key is one Cilium attaches
+// to identities outside the cluster
+func isExternalIdentityLabel(key string) bool {
+	for _, prefix := range []string{"reserved:world", "cidr:", "fqdn:"} {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reserved Cilium security identities for node and API server endpoints
+const (
+	IdentityHost          uint64 = 1
+	IdentityRemoteNode    uint64 = 6
+	IdentityKubeAPIServer uint64 = 7
+)
+
+// HostEntity returns the Cilium entity ("host", "remote-node" or
+// "kube-apiserver") for an endpoint that is a node, a host-network pod or the
+// Kubernetes API server, or "" for regular pods. Host-network pods share the
+// node's identity, so they carry the reserved:host / reserved:remote-node
+// labels instead of their pod labels. An API server on a node carries both
+// reserved:kube-apiserver and a node label; kube-apiserver wins as the more
+// specific entity.
+func HostEntity(endpoint *Endpoint) string {
+	if endpoint == nil {
+		return ""
+	}
+	entity := ""
+	for _, label := range endpoint.Labels {
+		switch label {
+		case "reserved:kube-apiserver", "reserved:kube-apiserver=":
+			return "kube-apiserver"
+		case "reserved:host", "reserved:host=":
+			entity = "host"
+		case "reserved:remote-node", "reserved:remote-node=":
+			entity = "remote-node"
+		}
+	}
+	if entity != "" {
+		return entity
+	}
+	switch endpoint.Identity {
+	case IdentityHost:
+		return "host"
+	case IdentityRemoteNode:
+		return "remote-node"
+	case IdentityKubeAPIServer:
+		return "kube-apiserver"
+	}
+	return ""
 }
 
 // ParseLabels converts a slice of label strings (format: "key=value") into a map
@@ -0,0 +1,91 @@
+package hubble
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// WatchOptions controls WatchFlows
+type WatchOptions struct {
+	// Capture selects the flows of each capture. Its Since is replaced by
+	// Interval, so consecutive captures overlap instead of leaving gaps.
+	Capture CaptureOptions
+
+	// Interval is the time between the starts of consecutive captures
+	Interval time.Duration
+
+	// OnCapture, if set, is called after each capture with the flows
+	// accumulated so far and the number of distinct flows it added.
+	// Returning an error stops watching.
+	OnCapture func(collection *FlowCollection, added int) error
+
+	// OnError, if set, is called when a capture fails; watching continues
+	// with the next capture
+	OnError func(err error)
+}
+
+// WatchFlows captures flows with hubble observe every opts.Interval until
+// ctx is cancelled, keeping only the first occurrence of each distinct flow
+// so that repeated captures of the same traffic converge. It returns the
+// flows accumulated so far, also when it stops because ctx was cancelled,
+// in which case the error is nil.
+func (r *HubbleReader) WatchFlows(ctx context.Context, opts WatchOptions) (*FlowCollection, error) {
+	if opts.Interval <= 0 {
+		return nil, fmt.Errorf("invalid watch interval %s: must be positive", opts.Interval)
+	}
+
+	dir, err := os.MkdirTemp("", "cpp-watch-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create capture directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	captureFile := filepath.Join(dir, "capture.json")
+
+	collection := &FlowCollection{
+		Schema: CurrentSchema,
+		Flows:  []*Flow{},
+	}
+	dedup := NewFlowDeduper()
+	captureOpts := opts.Capture
+	captureOpts.Since = opts.Interval.String()
+
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+	for {
+		added, err := r.captureUniqueFlows(ctx, captureOpts, captureFile, dedup, collection)
+		if ctx.Err() != nil {
+			return collection, nil
+		}
+		if err != nil {
+			if opts.OnError != nil {
+				opts.OnError(err)
+			}
+		} else if opts.OnCapture != nil {
+			if err := opts.OnCapture(collection, added); err != nil {
+				return collection, err
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return collection, nil
+		}
+	}
+}
+
+// captureUniqueFlows runs one capture into captureFile and appends the
+// flows not yet seen by dedup to collection, returning how many it appended
+func (r *HubbleReader) captureUniqueFlows(ctx context.Context, opts CaptureOptions, captureFile string, dedup *FlowDeduper, collection *FlowCollection) (int, error) {
+	if err := r.CaptureFlows(ctx, opts, captureFile); err != nil {
+		return 0, err
+	}
+	before := len(collection.Flows)
+	if err := streamUniqueFlowsFromFile(captureFile, dedup, collection); err != nil {
+		return 0, fmt.Errorf("failed to read capture: %w", err)
+	}
+	return len(collection.Flows) - before, nil
+}
@@ -0,0 +1,81 @@
+package hubble
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatchFlows(t *testing.T) {
+	dir := t.TempDir()
+	runs := filepath.Join(dir, "runs")
+	args := filepath.Join(dir, "args")
+
+	flow := func(source string) string {
+		return `{"flow":{"source":{"labels":["k8s:app=` + source + `"],"namespace":"default"},` +
+			`"destination":{"labels":["k8s:app=catalog"],"namespace":"default"},` +
+			`"l4":{"TCP":{"destination_port":8080}},"verdict":"FORWARDED"}}`
+	}
+	// The first run sees frontend, the second also checkout and the third
+	// fails; later runs see both again
+	script := "echo x >> " + runs + "\necho \"$@\" > " + args + "\n" +
+		"n=$(wc -l < " + runs + ")\n" +
+		"echo '" + flow("frontend") + "'\n" +
+		"if [ $n -eq 3 ]; then exit 1; fi\n" +
+		"if [ $n -ge 2 ]; then echo '" + flow("checkout") + "'; fi\n"
+	reader := fakeHubble(t, script)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var added []int
+	var failures int
+	opts := WatchOptions{
+		Capture:  CaptureOptions{Since: "1h", Namespaces: []string{"default"}},
+		Interval: 10 * time.Millisecond,
+		OnCapture: func(collection *FlowCollection, n int) error {
+			added = append(added, n)
+			if len(added) == 3 {
+				cancel()
+			}
+			return nil
+		},
+		OnError: func(err error) { failures++ },
+	}
+
+	collection, err := reader.WatchFlows(ctx, opts)
+	if err != nil {
+		t.Fatalf("WatchFlows() error = %v", err)
+	}
+	if !reflect.DeepEqual(added, []int{1, 1, 0}) {
+		t.Errorf("OnCapture added %v, want [1 1 0]", added)
+	}
+	if failures != 1 {
+		t.Errorf("OnError called %d times, want 1", failures)
+	}
+	if len(collection.Flows) != 2 || collection.Schema != CurrentSchema {
+		t.Errorf("Expected 2 accumulated flows with schema %s, got %d with %q", CurrentSchema, len(collection.Flows), collection.Schema)
+	}
+	if data, _ := os.ReadFile(args); strings.TrimSpace(string(data)) != "observe -o json --since=10ms --namespace=default" {
+		t.Errorf("hubble arguments = %q, want the interval as --since", data)
+	}
+}
+
+func TestWatchFlowsCallbackError(t *testing.T) {
+	reader := fakeHubble(t, "echo '{}'\n")
+	stop := errors.New("stop")
+	opts := WatchOptions{
+		Interval:  time.Hour,
+		OnCapture: func(*FlowCollection, int) error { return stop },
+	}
+	if _, err := reader.WatchFlows(context.Background(), opts); !errors.Is(err, stop) {
+		t.Errorf("WatchFlows() error = %v, want the callback's error", err)
+	}
+	if _, err := reader.WatchFlows(context.Background(), WatchOptions{}); err == nil {
+		t.Error("WatchFlows() with no interval: expected an error")
+	}
+}
@@ -0,0 +1,235 @@
+// Package policymatch decides which flow endpoints the selectors, entities
+// and CIDRs of a Cilium policy match. It is shared by simulate and by
+// verify's flow checks so both read policies the same way.
+package policymatch
+
+import (
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/prabhakaran-jm/cilium-policypilot/internal/hubble"
+)
+
+// NamespaceLabel is the label Cilium gives every endpoint for its namespace
+const NamespaceLabel = "k8s:io.kubernetes.pod.namespace"
+
+// Selector selects endpoints. An endpoint must match all of MatchLabels and
+// all of MatchExpressions.
+type Selector struct {
+	MatchLabels      map[string]string `yaml:"matchLabels" json:"matchLabels"`
+	MatchExpressions []Expression      `yaml:"matchExpressions,omitempty" json:"matchExpressions,omitempty"`
+}
+
+// Expression is a set-based selector requirement. Operator is In, NotIn,
+// Exists or DoesNotExist; only In and NotIn take Values.
+type Expression struct {
+	Key      string   `yaml:"key" json:"key"`
+	Operator string   `yaml:"operator" json:"operator"`
+	Values   []string `yaml:"values,omitempty" json:"values,omitempty"`
+}
+
+// Endpoint is one side of a flow, as policies see it
+type Endpoint struct {
+	Namespace string
+	Labels    map[string]string
+	// Entity is the reserved entity of nodes and the API server, e.g. "host"
+	Entity  string
+	IP      string
+	DNSName string
+}
+
+// SourceEndpoint returns the source side of a flow
+func SourceEndpoint(flow *hubble.ParsedFlow) Endpoint {
+	return Endpoint{
+		Namespace: flow.SourceNamespace,
+		Labels:    flow.SourceLabels,
+		Entity:    flow.SourceEntity,
+		IP:        flow.SourceIP,
+	}
+}
+
+// DestEndpoint returns the destination side of a flow
+func DestEndpoint(flow *hubble.ParsedFlow) Endpoint {
+	return Endpoint{
+		Namespace: flow.DestNamespace,
+		Labels:    flow.DestLabels,
+		Entity:    flow.DestEntity,
+		IP:        flow.DestIP,
+		DNSName:   flow.DestDNSName,
+	}
+}
+
+// IsPod reports whether the endpoint is a pod, which selectors can select
+func (e Endpoint) IsPod() bool {
+	return e.Namespace != "" && e.Entity == ""
+}
+
+// IsWorld reports whether the endpoint lies outside the cluster
+func (e Endpoint) IsWorld() bool {
+	return e.Namespace == "" && e.Entity == ""
+}
+
+// Selects reports whether a policy's endpointSelector selects a pod. A
+// namespaced policy only selects pods in its own namespace, whatever its
+// selector says; policyNamespace is empty for cluster-wide policies.
+func (s Selector) Selects(ep Endpoint, policyNamespace string) bool {
+	if !ep.IsPod() {
+		return false
+	}
+	if policyNamespace != "" && ep.Namespace != policyNamespace {
+		return false
+	}
+	return s.Matches(ep, "")
+}
+
+// Matches reports whether a rule's selector selects a pod. Like Cilium, a
+// selector without a namespace label only matches pods in namespace, the
+// policy's namespace; namespace is empty for cluster-wide policies.
+// Unknown operators match nothing.
+func (s Selector) Matches(ep Endpoint, namespace string) bool {
+	if !ep.IsPod() {
+		return false
+	}
+
+	pinned := false
+	for key := range s.MatchLabels {
+		pinned = pinned || IsNamespaceKey(key)
+	}
+	for _, expression := range s.MatchExpressions {
+		pinned = pinned || IsNamespaceKey(expression.Key)
+	}
+	if !pinned && namespace != "" && ep.Namespace != namespace {
+		return false
+	}
+
+	for key, value := range s.MatchLabels {
+		if actual, exists := ep.label(key); !exists || actual != value {
+			return false
+		}
+	}
+
+	for _, expression := range s.MatchExpressions {
+		actual, exists := ep.label(expression.Key)
+		switch expression.Operator {
+		case "In":
+			if !exists || !slices.Contains(expression.Values, actual) {
+				return false
+			}
+		case "NotIn":
+			if exists && slices.Contains(expression.Values, actual) {
+				return false
+			}
+		case "Exists":
+			if !exists {
+				return false
+			}
+		case "DoesNotExist":
+			if exists {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// AnyMatches reports whether any of selectors selects a pod (see
+// Selector.Matches)
+func AnyMatches(selectors []Selector, ep Endpoint, namespace string) bool {
+	for _, selector := range selectors {
+		if selector.Matches(ep, namespace) {
+			return true
+		}
+	}
+	return false
+}
+
+// label returns the value of a label. The namespace label always holds the
+// endpoint's namespace. Keys without a source, or with the "any" source,
+// match a label of that name from any source, e.g. app matches k8s:app.
+func (e Endpoint) label(key string) (string, bool) {
+	if IsNamespaceKey(key) {
+		return e.Namespace, true
+	}
+	if value, exists := e.Labels[key]; exists {
+		return value, true
+	}
+
+	name := strings.TrimPrefix(key, "any:")
+	if strings.Contains(name, ":") {
+		return "", false
+	}
+	for label, value := range e.Labels {
+		if _, labelName, found := strings.Cut(label, ":"); found && labelName == name {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// IsNamespaceKey reports whether a label key names the namespace label,
+// with the k8s or any source or without one
+func IsNamespaceKey(key string) bool {
+	name := strings.TrimPrefix(strings.TrimPrefix(key, "any:"), "k8s:")
+	return name == strings.TrimPrefix(NamespaceLabel, "k8s:")
+}
+
+// EntitiesMatch reports whether any of entities includes the endpoint
+func EntitiesMatch(entities []string, ep Endpoint) bool {
+	for _, entity := range entities {
+		switch entity {
+		case "all":
+			return true
+		case "cluster":
+			if !ep.IsWorld() {
+				return true
+			}
+		case "world":
+			if ep.IsWorld() {
+				return true
+			}
+		case "world-ipv4", "world-ipv6":
+			if ep.IsWorld() && worldEntity(ep.IP) == entity {
+				return true
+			}
+		default:
+			if ep.Entity == entity {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// worldEntity returns the world entity of an IP's family, world-ipv4 or
+// world-ipv6, or "" if ip does not parse
+func worldEntity(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ""
+	}
+	if addr.Unmap().Is4() {
+		return "world-ipv4"
+	}
+	return "world-ipv6"
+}
+
+// CIDRsMatch reports whether any of cidrs contains the IP of an endpoint
+// outside the cluster. Like Cilium, CIDR rules do not select pods.
+func CIDRsMatch(cidrs []string, ep Endpoint) bool {
+	if !ep.IsWorld() {
+		return false
+	}
+	addr, err := netip.ParseAddr(ep.IP)
+	if err != nil {
+		return false
+	}
+	for _, cidr := range cidrs {
+		if prefix, err := netip.ParsePrefix(cidr); err == nil && prefix.Contains(addr.Unmap()) {
+			return true
+		}
+	}
+	return false
+}
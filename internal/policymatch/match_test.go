@@ -0,0 +1,127 @@
+package policymatch
+
+import "testing"
+
+func TestSelectorMatches(t *testing.T) {
+	catalog := Endpoint{Namespace: "shop", Labels: map[string]string{"k8s:app": "catalog", "k8s:tier": "backend"}}
+
+	tests := []struct {
+		name      string
+		selector  Selector
+		namespace string
+		expected  bool
+	}{
+		{name: "empty selector in the namespace", namespace: "shop", expected: true},
+		{name: "empty selector in another namespace", namespace: "web", expected: false},
+		{name: "empty cluster-wide selector", expected: true},
+		{name: "labels", selector: Selector{MatchLabels: map[string]string{"k8s:app": "catalog"}}, namespace: "shop", expected: true},
+		{name: "other value", selector: Selector{MatchLabels: map[string]string{"k8s:app": "cart"}}, namespace: "shop", expected: false},
+		{name: "key without source", selector: Selector{MatchLabels: map[string]string{"app": "catalog"}}, namespace: "shop", expected: true},
+		{name: "any source", selector: Selector{MatchLabels: map[string]string{"any:tier": "backend"}}, namespace: "shop", expected: true},
+		{name: "other source", selector: Selector{MatchLabels: map[string]string{"container:app": "catalog"}}, namespace: "shop", expected: false},
+		{name: "namespace label pins another namespace", selector: Selector{MatchLabels: map[string]string{NamespaceLabel: "shop"}}, namespace: "web", expected: true},
+		{name: "namespace label without source", selector: Selector{MatchLabels: map[string]string{"io.kubernetes.pod.namespace": "shop"}}, namespace: "web", expected: true},
+		{name: "namespace label with any source", selector: Selector{MatchLabels: map[string]string{"any:io.kubernetes.pod.namespace": "shop"}}, namespace: "web", expected: true},
+		{name: "namespace label without source pins the wrong namespace", selector: Selector{MatchLabels: map[string]string{"io.kubernetes.pod.namespace": "web"}}, namespace: "web", expected: false},
+		{
+			name: "In",
+			selector: Selector{MatchExpressions: []Expression{
+				{Key: "k8s:app", Operator: "In", Values: []string{"cart", "catalog"}},
+			}},
+			namespace: "shop",
+			expected:  true,
+		},
+		{
+			name: "NotIn",
+			selector: Selector{MatchExpressions: []Expression{
+				{Key: "k8s:app", Operator: "NotIn", Values: []string{"catalog"}},
+			}},
+			namespace: "shop",
+			expected:  false,
+		},
+		{
+			name: "Exists",
+			selector: Selector{MatchExpressions: []Expression{
+				{Key: "k8s:tier", Operator: "Exists"},
+			}},
+			namespace: "shop",
+			expected:  true,
+		},
+		{
+			name: "unknown operator",
+			selector: Selector{MatchExpressions: []Expression{
+				{Key: "k8s:app", Operator: "Equals", Values: []string{"catalog"}},
+			}},
+			namespace: "shop",
+			expected:  false,
+		},
+		{
+			name: "DoesNotExist",
+			selector: Selector{MatchExpressions: []Expression{
+				{Key: "k8s:version", Operator: "DoesNotExist"},
+			}},
+			namespace: "shop",
+			expected:  true,
+		},
+		{
+			name: "namespace expression with any source",
+			selector: Selector{MatchExpressions: []Expression{
+				{Key: "any:io.kubernetes.pod.namespace", Operator: "Exists"},
+			}},
+			namespace: "web",
+			expected:  true,
+		},
+		{
+			name: "namespace expression",
+			selector: Selector{MatchExpressions: []Expression{
+				{Key: NamespaceLabel, Operator: "In", Values: []string{"shop", "web"}},
+			}},
+			namespace: "web",
+			expected:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.selector.Matches(catalog, tt.namespace); got != tt.expected {
+				t.Errorf("Matches() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestEntitiesAndCIDRsMatch(t *testing.T) {
+	world := Endpoint{IP: "203.0.113.10"}
+	host := Endpoint{Entity: "host", IP: "10.0.0.1"}
+	pod := Endpoint{Namespace: "shop", IP: "10.0.1.5"}
+
+	tests := []struct {
+		name     string
+		entities []string
+		cidrs    []string
+		ep       Endpoint
+		expected bool
+	}{
+		{name: "world", entities: []string{"world"}, ep: world, expected: true},
+		{name: "world is not a pod", entities: []string{"world"}, ep: pod, expected: false},
+		{name: "world-ipv4", entities: []string{"world-ipv4"}, ep: world, expected: true},
+		{name: "world-ipv6 is not IPv4", entities: []string{"world-ipv6"}, ep: world, expected: false},
+		{name: "world-ipv6", entities: []string{"world-ipv6"}, ep: Endpoint{IP: "2001:db8::1"}, expected: true},
+		{name: "world-ipv4 is not a pod", entities: []string{"world-ipv4"}, ep: pod, expected: false},
+		{name: "cluster", entities: []string{"cluster"}, ep: host, expected: true},
+		{name: "cluster is not world", entities: []string{"cluster"}, ep: world, expected: false},
+		{name: "host", entities: []string{"host"}, ep: host, expected: true},
+		{name: "all", entities: []string{"all"}, ep: world, expected: true},
+		{name: "CIDR", cidrs: []string{"203.0.113.0/24"}, ep: world, expected: true},
+		{name: "CIDR without the IP", cidrs: []string{"198.51.100.0/24"}, ep: world, expected: false},
+		{name: "CIDR does not select pods", cidrs: []string{"10.0.0.0/8"}, ep: pod, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EntitiesMatch(tt.entities, tt.ep) || CIDRsMatch(tt.cidrs, tt.ep); got != tt.expected {
+				t.Errorf("match = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package sim
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/prabhakaran-jm/cilium-policypilot/internal/hubble"
+	"github.com/prabhakaran-jm/cilium-policypilot/internal/policymatch"
+	"github.com/prabhakaran-jm/cilium-policypilot/internal/synth"
+)
+
+// MatchFlow reports whether a policy allows a flow: whether it selects the
+// flow's destination and one of its ingress rules allows the flow in, or it
+// selects the source and one of its egress rules allows the flow out. Other
+// policies selecting the same endpoints are not considered.
+func MatchFlow(flow *hubble.ParsedFlow, policy *synth.Policy) bool {
+	if _, ok := MatchIngress(flow, policy); ok {
+		return true
+	}
+	_, ok := MatchEgress(flow, policy)
+	return ok
+}
+
+// MatchIngress returns the index of the first ingress rule of a policy that
+// allows a flow into its destination. ok is false if the policy does not
+// select the destination or none of its ingress rules allows the flow.
+func MatchIngress(flow *hubble.ParsedFlow, policy *synth.Policy) (rule int, ok bool) {
+	source, dest := policymatch.SourceEndpoint(flow), policymatch.DestEndpoint(flow)
+	if !selects(policy, dest) {
+		return 0, false
+	}
+	for i, ingress := range policy.Spec.Ingress {
+		if ingressPeerMatches(ingress, source, policyNamespace(policy)) && trafficMatches(ingress.ToPorts, ingress.ICMPs, flow) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// MatchEgress returns the index of the first egress rule of a policy that
+// allows a flow out of its source. ok is false if the policy does not select
+// the source or none of its egress rules allows the flow.
+func MatchEgress(flow *hubble.ParsedFlow, policy *synth.Policy) (rule int, ok bool) {
+	source, dest := policymatch.SourceEndpoint(flow), policymatch.DestEndpoint(flow)
+	if !selects(policy, source) {
+		return 0, false
+	}
+	for i, egress := range policy.Spec.Egress {
+		if egressPeerMatches(egress, dest, policyNamespace(policy)) && trafficMatches(egress.ToPorts, egress.ICMPs, flow) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// selects reports whether a policy's endpointSelector selects a pod
+func selects(policy *synth.Policy, ep policymatch.Endpoint) bool {
+	return policy.Spec.EndpointSelector.Selects(ep, policyNamespace(policy))
+}
+
+// ingressPeerMatches reports whether an ingress rule's peers include the
+// source. A rule without peers allows every source.
+func ingressPeerMatches(rule synth.IngressRule, source policymatch.Endpoint, namespace string) bool {
+	if len(rule.FromEndpoints) == 0 && len(rule.FromEntities) == 0 && len(rule.FromCIDR) == 0 {
+		return true
+	}
+	return policymatch.AnyMatches(rule.FromEndpoints, source, namespace) ||
+		policymatch.EntitiesMatch(rule.FromEntities, source) ||
+		policymatch.CIDRsMatch(rule.FromCIDR, source)
+}
+
+// egressPeerMatches reports whether an egress rule's peers include the
+// destination. A rule without peers allows every destination.
+func egressPeerMatches(rule synth.EgressRule, dest policymatch.Endpoint, namespace string) bool {
+	if len(rule.ToEndpoints) == 0 && len(rule.ToEntities) == 0 && len(rule.ToCIDR) == 0 && len(rule.ToFQDNs) == 0 {
+		return true
+	}
+	return policymatch.AnyMatches(rule.ToEndpoints, dest, namespace) ||
+		policymatch.EntitiesMatch(rule.ToEntities, dest) ||
+		policymatch.CIDRsMatch(rule.ToCIDR, dest) ||
+		fqdnsMatch(rule.ToFQDNs, dest)
+}
+
+// fqdnsMatch reports whether any of selectors matches the DNS name of an
+// endpoint outside the cluster
+func fqdnsMatch(selectors []synth.FQDNSelector, ep policymatch.Endpoint) bool {
+	name := strings.ToLower(strings.TrimSuffix(ep.DNSName, "."))
+	if !ep.IsWorld() || name == "" {
+		return false
+	}
+	for _, selector := range selectors {
+		if selector.MatchName != "" && strings.EqualFold(strings.TrimSuffix(selector.MatchName, "."), name) {
+			return true
+		}
+		if selector.MatchPattern != "" && fqdnPatternMatches(selector.MatchPattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// fqdnPatternMatches reports whether a toFQDNs matchPattern matches a DNS
+// name. As in Cilium, "*" alone matches every name and otherwise matches
+// any run of DNS name characters within one label.
+func fqdnPatternMatches(pattern, name string) bool {
+	pattern = strings.ToLower(strings.TrimSuffix(pattern, "."))
+	if pattern == "*" {
+		return true
+	}
+	parts := strings.Split(pattern, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	re, err := regexp.Compile("^" + strings.Join(parts, "[-a-z0-9_]*") + "$")
+	return err == nil && re.MatchString(name)
+}
+
+// trafficMatches reports whether a rule's toPorts and icmps allow a flow's
+// traffic. A rule with neither allows all traffic; one with only toPorts
+// allows no ICMP, and one with only icmps allows nothing but ICMP.
+func trafficMatches(portRules []synth.PortRule, icmpRules []synth.ICMPRule, flow *hubble.ParsedFlow) bool {
+	if len(portRules) == 0 && len(icmpRules) == 0 {
+		return true
+	}
+	if flow.IsICMP() {
+		return icmpMatches(icmpRules, flow)
+	}
+	for _, portRule := range portRules {
+		for _, port := range portRule.Ports {
+			if portMatches(port, flow) && httpMatches(portRule.Rules, flow) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// portMatches reports whether a port entry allows a flow's destination port
+// and protocol. Port 0 or an empty port allows every port.
+func portMatches(port synth.PortProtocol, flow *hubble.ParsedFlow) bool {
+	protocol := hubble.NormalizeProtocol(port.Protocol)
+	if protocol != "" && protocol != "ANY" && protocol != hubble.NormalizeProtocol(flow.Protocol) {
+		return false
+	}
+	if port.Port == "" || port.Port == "0" {
+		return true
+	}
+	start, err := strconv.Atoi(port.Port)
+	if err != nil {
+		return flow.DestPortName != "" && port.Port == flow.DestPortName
+	}
+	end := start
+	if port.EndPort > start {
+		end = port.EndPort
+	}
+	return int(flow.DestPort) >= start && int(flow.DestPort) <= end
+}
+
+// httpMatches reports whether L7 rules allow a flow's HTTP request. Flows
+// without one, e.g. the L4 flows of a proxied connection, are allowed.
+func httpMatches(rules *synth.L7Rules, flow *hubble.ParsedFlow) bool {
+	if rules == nil || len(rules.HTTP) == 0 || flow.HTTPMethod == "" {
+		return true
+	}
+	for _, rule := range rules.HTTP {
+		if fullMatch(rule.Method, flow.HTTPMethod) && fullMatch(rule.Path, flow.HTTPPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// fullMatch reports whether an HTTP rule's regex matches all of value; an
+// empty regex matches anything
+func fullMatch(expr, value string) bool {
+	if expr == "" {
+		return true
+	}
+	re, err := regexp.Compile("^(?:" + expr + ")$")
+	return err == nil && re.MatchString(value)
+}
+
+// icmpMatches reports whether any of rules allows an ICMP flow's type
+func icmpMatches(rules []synth.ICMPRule, flow *hubble.ParsedFlow) bool {
+	family := "IPv4"
+	if hubble.NormalizeProtocol(flow.Protocol) == "ICMPv6" {
+		family = "IPv6"
+	}
+	for _, rule := range rules {
+		for _, field := range rule.Fields {
+			fieldFamily := field.Family
+			if fieldFamily == "" {
+				fieldFamily = "IPv4"
+			}
+			if fieldFamily == family && field.Type == flow.ICMPType {
+				return true
+			}
+		}
+	}
+	return false
+}
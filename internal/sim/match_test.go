@@ -0,0 +1,136 @@
+package sim
+
+import (
+	"testing"
+
+	"github.com/prabhakaran-jm/cilium-policypilot/internal/hubble"
+	"github.com/prabhakaran-jm/cilium-policypilot/internal/synth"
+)
+
+func TestFQDNPatternMatches(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		name     string
+		expected bool
+	}{
+		{pattern: "*", name: "api.example.com", expected: true},
+		{pattern: "*.example.com", name: "api.example.com", expected: true},
+		{pattern: "*.example.com", name: "example.com", expected: false},
+		{pattern: "*.example.com", name: "a.b.example.com", expected: false},
+		{pattern: "api.*.com.", name: "api.example.com", expected: true},
+		{pattern: "*.example.com", name: "api.example.org", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.name, func(t *testing.T) {
+			if got := fqdnPatternMatches(tt.pattern, tt.name); got != tt.expected {
+				t.Errorf("fqdnPatternMatches(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestTrafficMatches(t *testing.T) {
+	web := []synth.PortRule{{Ports: []synth.PortProtocol{{Port: "8080", Protocol: "TCP"}}}}
+	nodePorts := []synth.PortRule{{Ports: []synth.PortProtocol{{Port: "30000", EndPort: 30100, Protocol: "TCP"}}}}
+	http := []synth.PortRule{{Ports: []synth.PortProtocol{{Port: "http", Protocol: "TCP"}}}}
+	ping := []synth.ICMPRule{{Fields: []synth.ICMPField{{Type: 8}}}}
+
+	tests := []struct {
+		name     string
+		ports    []synth.PortRule
+		icmps    []synth.ICMPRule
+		flow     *hubble.ParsedFlow
+		expected bool
+	}{
+		{name: "no ports allows everything", flow: &hubble.ParsedFlow{DestPort: 22, Protocol: "TCP"}, expected: true},
+		{name: "port", ports: web, flow: &hubble.ParsedFlow{DestPort: 8080, Protocol: "TCP"}, expected: true},
+		{name: "protocol is case-insensitive", ports: web, flow: &hubble.ParsedFlow{DestPort: 8080, Protocol: "tcp"}, expected: true},
+		{name: "other protocol", ports: web, flow: &hubble.ParsedFlow{DestPort: 8080, Protocol: "UDP"}, expected: false},
+		{name: "other port", ports: web, flow: &hubble.ParsedFlow{DestPort: 8081, Protocol: "TCP"}, expected: false},
+		{name: "range start", ports: nodePorts, flow: &hubble.ParsedFlow{DestPort: 30000, Protocol: "TCP"}, expected: true},
+		{name: "in range", ports: nodePorts, flow: &hubble.ParsedFlow{DestPort: 30050, Protocol: "TCP"}, expected: true},
+		{name: "range end", ports: nodePorts, flow: &hubble.ParsedFlow{DestPort: 30100, Protocol: "TCP"}, expected: true},
+		{name: "below range", ports: nodePorts, flow: &hubble.ParsedFlow{DestPort: 29999, Protocol: "TCP"}, expected: false},
+		{name: "above range", ports: nodePorts, flow: &hubble.ParsedFlow{DestPort: 30101, Protocol: "TCP"}, expected: false},
+		{
+			name:     "endPort below port is a single port",
+			ports:    []synth.PortRule{{Ports: []synth.PortProtocol{{Port: "8080", EndPort: 80, Protocol: "TCP"}}}},
+			flow:     &hubble.ParsedFlow{DestPort: 8081, Protocol: "TCP"},
+			expected: false,
+		},
+		{
+			name:     "port 0 allows every port",
+			ports:    []synth.PortRule{{Ports: []synth.PortProtocol{{Port: "0", Protocol: "TCP"}}}},
+			flow:     &hubble.ParsedFlow{DestPort: 22, Protocol: "TCP"},
+			expected: true,
+		},
+		{
+			name:     "ANY protocol",
+			ports:    []synth.PortRule{{Ports: []synth.PortProtocol{{Port: "53", Protocol: "ANY"}}}},
+			flow:     &hubble.ParsedFlow{DestPort: 53, Protocol: "UDP"},
+			expected: true,
+		},
+		{name: "named port", ports: http, flow: &hubble.ParsedFlow{DestPort: 8080, DestPortName: "http", Protocol: "TCP"}, expected: true},
+		{name: "other named port", ports: http, flow: &hubble.ParsedFlow{DestPort: 8080, DestPortName: "metrics", Protocol: "TCP"}, expected: false},
+		{name: "flow without a port name", ports: http, flow: &hubble.ParsedFlow{DestPort: 8080, Protocol: "TCP"}, expected: false},
+		{
+			name: "HTTP rule",
+			ports: []synth.PortRule{{
+				Ports: []synth.PortProtocol{{Port: "8080", Protocol: "TCP"}},
+				Rules: &synth.L7Rules{HTTP: []synth.PortRuleHTTP{{Method: "GET", Path: "/api/.*"}}},
+			}},
+			flow:     &hubble.ParsedFlow{DestPort: 8080, Protocol: "TCP", HTTPMethod: "POST", HTTPPath: "/api/items"},
+			expected: false,
+		},
+		{name: "ports do not allow ICMP", ports: web, flow: &hubble.ParsedFlow{Protocol: "ICMP", ICMPType: 8}, expected: false},
+		{name: "ICMP type", icmps: ping, flow: &hubble.ParsedFlow{Protocol: "ICMP", ICMPType: 8}, expected: true},
+		{name: "ICMPv6 is another family", icmps: ping, flow: &hubble.ParsedFlow{Protocol: "ICMPv6", ICMPType: 8}, expected: false},
+		{name: "ICMP rules do not allow ports", icmps: ping, flow: &hubble.ParsedFlow{DestPort: 8080, Protocol: "TCP"}, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := trafficMatches(tt.ports, tt.icmps, tt.flow); got != tt.expected {
+				t.Errorf("trafficMatches() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestMatchFlow(t *testing.T) {
+	external := podFlow("shop", "catalog", "", "", 443)
+	external.DestDNSName = "api.example.com"
+
+	tests := []struct {
+		name    string
+		flow    *hubble.ParsedFlow
+		ingress int
+		egress  int
+	}{
+		{name: "ingress rule", flow: podFlow("shop", "frontend", "shop", "catalog", 8080), ingress: 0, egress: -1},
+		{name: "first egress rule", flow: podFlow("shop", "catalog", "data", "postgres", 5432), ingress: -1, egress: 0},
+		{name: "second egress rule", flow: external, ingress: -1, egress: 1},
+		{name: "no rule", flow: podFlow("shop", "admin", "shop", "catalog", 8080), ingress: -1, egress: -1},
+		{name: "unselected endpoints", flow: podFlow("shop", "frontend", "shop", "cart", 7070), ingress: -1, egress: -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ingress, ok := MatchIngress(tt.flow, catalogPolicy)
+			if !ok {
+				ingress = -1
+			}
+			egress, ok := MatchEgress(tt.flow, catalogPolicy)
+			if !ok {
+				egress = -1
+			}
+			if ingress != tt.ingress || egress != tt.egress {
+				t.Errorf("MatchIngress, MatchEgress = %d, %d, want %d, %d", ingress, egress, tt.ingress, tt.egress)
+			}
+			if want := tt.ingress >= 0 || tt.egress >= 0; MatchFlow(tt.flow, catalogPolicy) != want {
+				t.Errorf("MatchFlow() = %v, want %v", !want, want)
+			}
+		})
+	}
+}
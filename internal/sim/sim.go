@@ -0,0 +1,259 @@
+// Package sim replays observed flows against Cilium policies to find the
+// flows the policies would deny
+package sim
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/prabhakaran-jm/cilium-policypilot/internal/hubble"
+	"github.com/prabhakaran-jm/cilium-policypilot/internal/policymatch"
+	"github.com/prabhakaran-jm/cilium-policypilot/internal/synth"
+)
+
+// Direction values of UncoveredFlow
+const (
+	DirectionIngress = "ingress"
+	DirectionEgress  = "egress"
+)
+
+// Result is the outcome of replaying flows against policies. Flow counts
+// are weighted by ParsedFlow.Occurrences.
+type Result struct {
+	// Flows is the number of flows replayed; replies are not replayed, as
+	// Cilium allows them on the connection their request opened
+	Flows int `json:"flows"`
+	// Allowed is the number of replayed flows the policies allow
+	Allowed int `json:"allowed"`
+	// Replies is the number of reply flows skipped
+	Replies int `json:"replies"`
+	// Covered lists the allowed flows with the rules allowing them, most
+	// frequent first
+	Covered []CoveredFlow `json:"covered"`
+	// Uncovered lists the denied flows, most frequent first
+	Uncovered []UncoveredFlow `json:"uncovered"`
+}
+
+// Coverage returns the percentage of replayed flows the policies allow,
+// 100 if there were none
+func (r *Result) Coverage() float64 {
+	if r.Flows == 0 {
+		return 100
+	}
+	return 100 * float64(r.Allowed) / float64(r.Flows)
+}
+
+// RuleMatch identifies the policy rule that allows a flow
+type RuleMatch struct {
+	// Policy is the policy as namespace/name, or name if cluster-wide
+	Policy string `json:"policy"`
+	// Direction is "ingress" or "egress"
+	Direction string `json:"direction"`
+	// Rule is the index of the rule in the policy's ingress or egress list
+	Rule int `json:"rule"`
+}
+
+// String formats the match as e.g. "shop/catalog-policy ingress[0]"
+func (m RuleMatch) String() string {
+	return fmt.Sprintf("%s %s[%d]", m.Policy, m.Direction, m.Rule)
+}
+
+// CoveredFlow is a connection the policies allow
+type CoveredFlow struct {
+	// Source, Destination and Traffic describe the connection as in
+	// hubble.FlowSummary
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	Traffic     string `json:"traffic"`
+	// AllowedBy lists the rules allowing the connection into its
+	// destination and out of its source; it is empty when no policy
+	// selects either endpoint
+	AllowedBy []RuleMatch `json:"allowedBy"`
+	// Flows is the number of allowed flows
+	Flows int `json:"flows"`
+}
+
+// UncoveredFlow is a connection the policies deny in one direction
+type UncoveredFlow struct {
+	// Source, Destination and Traffic describe the connection as in
+	// hubble.FlowSummary
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	Traffic     string `json:"traffic"`
+	// Direction is "ingress" if the destination's policies deny the flow,
+	// "egress" if the source's do
+	Direction string `json:"direction"`
+	// Policies are the policies selecting the endpoint in that direction,
+	// as namespace/name, none of which allows the flow
+	Policies []string `json:"policies"`
+	// Flows is the number of denied flows
+	Flows int `json:"flows"`
+}
+
+// Simulate replays flows against policies and reports the flows they deny.
+// Like Cilium, a flow is allowed in a direction if no policy selecting the
+// endpoint has rules for that direction, or if any rule of those policies
+// matches it; it is covered if both its source's egress and its
+// destination's ingress allow it. Deny rules, node selectors and Kubernetes
+// services are not modeled.
+func Simulate(policies []*synth.Policy, flows []*hubble.ParsedFlow) *Result {
+	result := &Result{Covered: []CoveredFlow{}, Uncovered: []UncoveredFlow{}}
+	covered := make(map[string]*CoveredFlow)
+	uncovered := make(map[string]*UncoveredFlow)
+	var coveredOrder, uncoveredOrder []string
+
+	for _, flow := range flows {
+		if flow.IsReply {
+			result.Replies += flow.Occurrences()
+			continue
+		}
+		result.Flows += flow.Occurrences()
+
+		summary := hubble.ListFlows([]*hubble.ParsedFlow{flow})[0]
+		connection := summary.Source + "\x00" + summary.Destination + "\x00" + summary.Traffic
+		var allowedBy []RuleMatch
+		denied := false
+		for _, direction := range []string{DirectionEgress, DirectionIngress} {
+			match, enforcing := evaluate(policies, flow, direction)
+			if match != nil {
+				allowedBy = append(allowedBy, *match)
+				continue
+			}
+			if enforcing == nil {
+				continue
+			}
+			denied = true
+
+			key := direction + "\x00" + connection
+			if entry, exists := uncovered[key]; exists {
+				entry.Flows += flow.Occurrences()
+				continue
+			}
+			uncovered[key] = &UncoveredFlow{
+				Source:      summary.Source,
+				Destination: summary.Destination,
+				Traffic:     summary.Traffic,
+				Direction:   direction,
+				Policies:    policyNames(enforcing),
+				Flows:       flow.Occurrences(),
+			}
+			uncoveredOrder = append(uncoveredOrder, key)
+		}
+		if denied {
+			continue
+		}
+
+		result.Allowed += flow.Occurrences()
+		if entry, exists := covered[connection]; exists {
+			entry.Flows += flow.Occurrences()
+			for _, match := range allowedBy {
+				if !slices.Contains(entry.AllowedBy, match) {
+					entry.AllowedBy = append(entry.AllowedBy, match)
+				}
+			}
+			continue
+		}
+		covered[connection] = &CoveredFlow{
+			Source:      summary.Source,
+			Destination: summary.Destination,
+			Traffic:     summary.Traffic,
+			AllowedBy:   append([]RuleMatch{}, allowedBy...),
+			Flows:       flow.Occurrences(),
+		}
+		coveredOrder = append(coveredOrder, connection)
+	}
+
+	for _, key := range coveredOrder {
+		result.Covered = append(result.Covered, *covered[key])
+	}
+	sort.SliceStable(result.Covered, func(i, j int) bool {
+		a, b := result.Covered[i], result.Covered[j]
+		return connectionLess(a.Flows, a.Source, a.Destination, a.Traffic, b.Flows, b.Source, b.Destination, b.Traffic)
+	})
+	for _, key := range uncoveredOrder {
+		result.Uncovered = append(result.Uncovered, *uncovered[key])
+	}
+	sort.SliceStable(result.Uncovered, func(i, j int) bool {
+		a, b := result.Uncovered[i], result.Uncovered[j]
+		if a.Flows == b.Flows && a.Source == b.Source && a.Destination == b.Destination && a.Traffic == b.Traffic {
+			return a.Direction < b.Direction
+		}
+		return connectionLess(a.Flows, a.Source, a.Destination, a.Traffic, b.Flows, b.Source, b.Destination, b.Traffic)
+	})
+	return result
+}
+
+// connectionLess orders connections by flows, most first, then by source,
+// destination and traffic
+func connectionLess(aFlows int, aSource, aDest, aTraffic string, bFlows int, bSource, bDest, bTraffic string) bool {
+	if aFlows != bFlows {
+		return aFlows > bFlows
+	}
+	if aSource != bSource {
+		return aSource < bSource
+	}
+	if aDest != bDest {
+		return aDest < bDest
+	}
+	return aTraffic < bTraffic
+}
+
+// evaluate checks a flow in one direction against the policies enforcing
+// that direction on its endpoint: those selecting its destination with
+// ingress rules, or its source with egress rules. It returns the first
+// rule allowing the flow, or nil and the enforcing policies, none if the
+// direction is not enforced.
+func evaluate(policies []*synth.Policy, flow *hubble.ParsedFlow, direction string) (*RuleMatch, []*synth.Policy) {
+	var enforcing []*synth.Policy
+	for _, policy := range policies {
+		if !enforces(policy, flow, direction) {
+			continue
+		}
+		enforcing = append(enforcing, policy)
+
+		match := MatchIngress
+		if direction == DirectionEgress {
+			match = MatchEgress
+		}
+		if rule, ok := match(flow, policy); ok {
+			return &RuleMatch{Policy: policyNames([]*synth.Policy{policy})[0], Direction: direction, Rule: rule}, nil
+		}
+	}
+	return nil, enforcing
+}
+
+// enforces reports whether a policy restricts a flow in one direction: it
+// selects the flow's endpoint on that side and has rules or enables
+// default-deny for that direction
+func enforces(policy *synth.Policy, flow *hubble.ParsedFlow, direction string) bool {
+	if direction == DirectionIngress {
+		return policy.Spec.EnforcesIngress() && selects(policy, policymatch.DestEndpoint(flow))
+	}
+	return policy.Spec.EnforcesEgress() && selects(policy, policymatch.SourceEndpoint(flow))
+}
+
+// policyNamespace returns the namespace a policy's selectors are scoped to:
+// its namespace, "default" if it omits one, or "" for cluster-wide policies
+func policyNamespace(policy *synth.Policy) string {
+	if policy.Kind == "CiliumClusterwideNetworkPolicy" {
+		return ""
+	}
+	if policy.Metadata.Namespace == "" {
+		return "default"
+	}
+	return policy.Metadata.Namespace
+}
+
+// policyNames returns the policies as namespace/name, or name if cluster-wide
+func policyNames(policies []*synth.Policy) []string {
+	names := make([]string, 0, len(policies))
+	for _, policy := range policies {
+		if namespace := policyNamespace(policy); namespace != "" {
+			names = append(names, namespace+"/"+policy.Metadata.Name)
+		} else {
+			names = append(names, policy.Metadata.Name)
+		}
+	}
+	return names
+}
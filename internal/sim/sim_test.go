@@ -0,0 +1,287 @@
+package sim
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/prabhakaran-jm/cilium-policypilot/internal/hubble"
+	"github.com/prabhakaran-jm/cilium-policypilot/internal/policymatch"
+	"github.com/prabhakaran-jm/cilium-policypilot/internal/synth"
+)
+
+// catalogPolicy allows frontend to reach catalog on 8080/TCP and catalog to
+// reach the database and api.example.com
+var catalogPolicy = &synth.Policy{
+	Kind:     "CiliumNetworkPolicy",
+	Metadata: synth.PolicyMetadata{Name: "catalog-policy", Namespace: "shop"},
+	Spec: synth.PolicySpec{
+		EndpointSelector: synth.EndpointSelector{MatchLabels: map[string]string{"k8s:app": "catalog"}},
+		Ingress: []synth.IngressRule{{
+			FromEndpoints: []synth.EndpointSelector{{MatchLabels: map[string]string{"k8s:app": "frontend"}}},
+			ToPorts:       []synth.PortRule{{Ports: []synth.PortProtocol{{Port: "8080", Protocol: "TCP"}}}},
+		}},
+		Egress: []synth.EgressRule{
+			{
+				ToEndpoints: []synth.EndpointSelector{{MatchLabels: map[string]string{
+					"k8s:app":                  "postgres",
+					policymatch.NamespaceLabel: "data",
+				}}},
+				ToPorts: []synth.PortRule{{Ports: []synth.PortProtocol{{Port: "5432", Protocol: "TCP"}}}},
+			},
+			{
+				ToFQDNs: []synth.FQDNSelector{{MatchName: "api.example.com"}},
+				ToPorts: []synth.PortRule{{Ports: []synth.PortProtocol{{Port: "443", Protocol: "TCP"}}}},
+			},
+		},
+	},
+}
+
+func podFlow(sourceNamespace, sourceApp, destNamespace, destApp string, port uint16) *hubble.ParsedFlow {
+	return &hubble.ParsedFlow{
+		SourceNamespace: sourceNamespace,
+		SourceLabels:    map[string]string{"k8s:app": sourceApp},
+		DestNamespace:   destNamespace,
+		DestLabels:      map[string]string{"k8s:app": destApp},
+		DestPort:        port,
+		Protocol:        "TCP",
+	}
+}
+
+func TestSimulate(t *testing.T) {
+	external := podFlow("shop", "catalog", "", "", 443)
+	external.DestLabels = map[string]string{"reserved:world": ""}
+	external.DestIP = "203.0.113.10"
+	external.DestDNSName = "api.example.com"
+
+	otherHost := podFlow("shop", "catalog", "", "", 443)
+	otherHost.DestLabels = nil
+	otherHost.DestIP = "203.0.113.20"
+	otherHost.DestDNSName = "evil.example.com"
+
+	reply := podFlow("shop", "catalog", "shop", "frontend", 51234)
+	reply.IsReply = true
+
+	repeated := podFlow("shop", "frontend", "shop", "catalog", 9090)
+	repeated.Count = 3
+
+	tests := []struct {
+		name      string
+		flow      *hubble.ParsedFlow
+		uncovered []string
+	}{
+		{name: "allowed ingress", flow: podFlow("shop", "frontend", "shop", "catalog", 8080)},
+		{name: "ingress on another port", flow: repeated, uncovered: []string{"ingress"}},
+		{name: "ingress from another app", flow: podFlow("shop", "admin", "shop", "catalog", 8080), uncovered: []string{"ingress"}},
+		{name: "peer selector is scoped to the policy namespace", flow: podFlow("web", "frontend", "shop", "catalog", 8080), uncovered: []string{"ingress"}},
+		{name: "endpoint selector is scoped to the policy namespace", flow: podFlow("shop", "frontend", "staging", "catalog", 9999)},
+		{name: "allowed egress to another namespace", flow: podFlow("shop", "catalog", "data", "postgres", 5432)},
+		{name: "egress to an unlisted pod", flow: podFlow("shop", "catalog", "data", "redis", 6379), uncovered: []string{"egress"}},
+		{name: "allowed egress by DNS name", flow: external},
+		{name: "egress to another DNS name", flow: otherHost, uncovered: []string{"egress"}},
+		{name: "replies are skipped", flow: reply},
+		{name: "unselected endpoints allow everything", flow: podFlow("shop", "frontend", "shop", "cart", 7070)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := Simulate([]*synth.Policy{catalogPolicy}, []*hubble.ParsedFlow{tt.flow})
+
+			var directions []string
+			for _, uncovered := range result.Uncovered {
+				directions = append(directions, uncovered.Direction)
+				if !reflect.DeepEqual(uncovered.Policies, []string{"shop/catalog-policy"}) {
+					t.Errorf("Policies = %v, want [shop/catalog-policy]", uncovered.Policies)
+				}
+				if uncovered.Flows != tt.flow.Occurrences() {
+					t.Errorf("Flows = %d, want %d", uncovered.Flows, tt.flow.Occurrences())
+				}
+			}
+			if !reflect.DeepEqual(directions, tt.uncovered) {
+				t.Errorf("Uncovered directions = %v, want %v", directions, tt.uncovered)
+			}
+
+			if tt.flow.IsReply {
+				if result.Flows != 0 || result.Replies != 1 {
+					t.Errorf("Expected the reply to be skipped, got %+v", result)
+				}
+				return
+			}
+			allowed := tt.flow.Occurrences()
+			if len(tt.uncovered) > 0 {
+				allowed = 0
+			}
+			if result.Flows != tt.flow.Occurrences() || result.Allowed != allowed {
+				t.Errorf("Flows, Allowed = %d, %d, want %d, %d", result.Flows, result.Allowed, tt.flow.Occurrences(), allowed)
+			}
+		})
+	}
+}
+
+func TestSimulateExternalClients(t *testing.T) {
+	client := func(ip string) *hubble.ParsedFlow {
+		flow := podFlow("", "", "shop", "gateway", 443)
+		flow.SourceLabels = map[string]string{"reserved:world": ""}
+		flow.SourceIP = ip
+		return flow
+	}
+	policy := &synth.Policy{
+		Kind:     "CiliumNetworkPolicy",
+		Metadata: synth.PolicyMetadata{Name: "gateway-policy", Namespace: "shop"},
+		Spec: synth.PolicySpec{
+			EndpointSelector: synth.EndpointSelector{MatchLabels: map[string]string{"k8s:app": "gateway"}},
+			Ingress: []synth.IngressRule{{
+				FromCIDR: []string{"203.0.113.10/32"},
+				ToPorts:  []synth.PortRule{{Ports: []synth.PortProtocol{{Port: "443", Protocol: "TCP"}}}},
+			}},
+		},
+	}
+
+	result := Simulate([]*synth.Policy{policy}, []*hubble.ParsedFlow{client("203.0.113.10"), client("198.51.100.20")})
+	expected := []UncoveredFlow{{
+		Source:      "198.51.100.20",
+		Destination: "shop/gateway",
+		Traffic:     "TCP/443",
+		Direction:   DirectionIngress,
+		Policies:    []string{"shop/gateway-policy"},
+		Flows:       1,
+	}}
+	if !reflect.DeepEqual(result.Uncovered, expected) {
+		t.Errorf("Uncovered = %+v, want %+v", result.Uncovered, expected)
+	}
+	if result.Coverage() != 50 {
+		t.Errorf("Coverage() = %.1f, want 50", result.Coverage())
+	}
+}
+
+func TestSimulateCoverage(t *testing.T) {
+	flows := []*hubble.ParsedFlow{
+		podFlow("shop", "frontend", "shop", "catalog", 8080),
+		podFlow("shop", "frontend", "shop", "catalog", 8080),
+		podFlow("shop", "frontend", "shop", "catalog", 8080),
+		podFlow("shop", "admin", "shop", "catalog", 8080),
+	}
+
+	result := Simulate([]*synth.Policy{catalogPolicy}, flows)
+	if result.Coverage() != 75 {
+		t.Errorf("Coverage() = %v, want 75", result.Coverage())
+	}
+	expected := []UncoveredFlow{{
+		Source:      "shop/admin",
+		Destination: "shop/catalog",
+		Traffic:     "TCP/8080",
+		Direction:   DirectionIngress,
+		Policies:    []string{"shop/catalog-policy"},
+		Flows:       1,
+	}}
+	if !reflect.DeepEqual(result.Uncovered, expected) {
+		t.Errorf("Uncovered = %+v, want %+v", result.Uncovered, expected)
+	}
+
+	covered := []CoveredFlow{{
+		Source:      "shop/frontend",
+		Destination: "shop/catalog",
+		Traffic:     "TCP/8080",
+		AllowedBy:   []RuleMatch{{Policy: "shop/catalog-policy", Direction: DirectionIngress, Rule: 0}},
+		Flows:       3,
+	}}
+	if !reflect.DeepEqual(result.Covered, covered) {
+		t.Errorf("Covered = %+v, want %+v", result.Covered, covered)
+	}
+
+	if coverage := Simulate(nil, nil).Coverage(); coverage != 100 {
+		t.Errorf("Coverage() without flows = %v, want 100", coverage)
+	}
+}
+
+func TestSimulateDefaultDeny(t *testing.T) {
+	deny := &synth.Policy{
+		Kind:     "CiliumNetworkPolicy",
+		Metadata: synth.PolicyMetadata{Name: "catalog-default-deny", Namespace: "shop"},
+		Spec: synth.PolicySpec{
+			EndpointSelector:  synth.EndpointSelector{MatchLabels: map[string]string{"k8s:app": "catalog"}},
+			EnableDefaultDeny: &synth.DefaultDenyConfig{Ingress: true},
+		},
+	}
+
+	result := Simulate([]*synth.Policy{deny}, []*hubble.ParsedFlow{podFlow("shop", "frontend", "shop", "catalog", 8080)})
+	if len(result.Uncovered) != 1 || result.Uncovered[0].Direction != DirectionIngress {
+		t.Fatalf("Expected enableDefaultDeny to deny the flow, got %+v", result.Uncovered)
+	}
+
+	// Cilium ignores an empty rule list
+	empty := &synth.Policy{Kind: deny.Kind, Metadata: deny.Metadata, Spec: synth.PolicySpec{
+		EndpointSelector: deny.Spec.EndpointSelector,
+		Ingress:          []synth.IngressRule{},
+	}}
+	result = Simulate([]*synth.Policy{empty}, []*hubble.ParsedFlow{podFlow("shop", "frontend", "shop", "catalog", 8080)})
+	if len(result.Uncovered) != 0 {
+		t.Errorf("Expected the empty ingress list to enforce nothing, got %+v", result.Uncovered)
+	}
+
+	// Combined with an allowing policy, the union of rules applies
+	result = Simulate([]*synth.Policy{deny, catalogPolicy}, []*hubble.ParsedFlow{podFlow("shop", "frontend", "shop", "catalog", 8080)})
+	if len(result.Uncovered) != 0 {
+		t.Errorf("Expected catalog-policy to allow the flow, got %+v", result.Uncovered)
+	}
+}
+
+func TestSimulateSynthesizedPolicies(t *testing.T) {
+	flows := []*hubble.ParsedFlow{
+		podFlow("shop", "frontend", "shop", "catalog", 8080),
+		podFlow("shop", "catalog", "data", "postgres", 5432),
+		{
+			SourceNamespace: "shop",
+			SourceLabels:    map[string]string{"k8s:app": "frontend"},
+			DestNamespace:   "shop",
+			DestLabels:      map[string]string{"k8s:app": "catalog"},
+			Protocol:        "ICMP",
+			ICMPType:        8,
+		},
+	}
+
+	policies, err := synth.SynthesizePolicies(flows)
+	if err != nil {
+		t.Fatalf("SynthesizePolicies() error = %v", err)
+	}
+	result := Simulate(policies, flows)
+
+	// Synthesized policies only allow DNS egress, which enforces egress for
+	// the pods they select: catalog may not open the connection postgres
+	// accepts
+	expected := []UncoveredFlow{{
+		Source:      "shop/catalog",
+		Destination: "data/postgres",
+		Traffic:     "TCP/5432",
+		Direction:   DirectionEgress,
+		Policies:    []string{"shop/catalog-policy"},
+		Flows:       1,
+	}}
+	if !reflect.DeepEqual(result.Uncovered, expected) {
+		t.Errorf("Uncovered = %+v, want %+v", result.Uncovered, expected)
+	}
+	if result.Allowed != 2 {
+		t.Errorf("Allowed = %d, want the ingress and ICMP flows", result.Allowed)
+	}
+}
+
+func TestSimulateSkipIntraNamespace(t *testing.T) {
+	flows := []*hubble.ParsedFlow{
+		podFlow("ingress", "gateway", "shop", "catalog", 8080),
+		podFlow("shop", "frontend", "shop", "catalog", 8080),
+		podFlow("shop", "catalog", "shop", "database", 5432),
+	}
+
+	policies, err := synth.SynthesizePoliciesWithOptions(flows, synth.Options{SkipIntraNamespace: true})
+	if err != nil {
+		t.Fatalf("SynthesizePoliciesWithOptions() error = %v", err)
+	}
+	if len(policies) != 1 {
+		t.Fatalf("Expected a policy for catalog only, got %d policies", len(policies))
+	}
+
+	// The intra-namespace flows are not in the rules but still allowed
+	result := Simulate(policies, flows)
+	if len(result.Uncovered) != 0 || result.Allowed != 3 {
+		t.Errorf("Expected every flow to be allowed, got uncovered %+v", result.Uncovered)
+	}
+}
@@ -0,0 +1,86 @@
+package synth
+
+import (
+	"fmt"
+	"slices"
+)
+
+// SystemNamespaces are the namespaces AuditPolicies reports allow rules for.
+// Callers may replace the list, e.g. to add a distribution's own
+// infrastructure namespaces.
+var SystemNamespaces = []string{"kube-system", "kube-public", "cilium"}
+
+// AuditPolicies returns a warning, prefixed with the policy's namespace and
+// name, for each policy that selects pods in a system namespace (see
+// SystemNamespaces) or whose fromEndpoints/toEndpoints reach into one. The
+// DNS egress rules synthesis adds are expected and not reported.
+func AuditPolicies(policies []*Policy) []string {
+	var warnings []string
+	for _, policy := range policies {
+		name := policy.Metadata.Name
+		if policy.Metadata.Namespace != "" {
+			name = policy.Metadata.Namespace + "/" + name
+		}
+
+		if namespace, ok := systemNamespace(policy.Metadata.Namespace, policy.Spec.EndpointSelector); ok {
+			warnings = append(warnings, fmt.Sprintf("%s: policy selects pods in system namespace %s", name, namespace))
+		}
+		for i, rule := range policy.Spec.Ingress {
+			for _, selector := range rule.FromEndpoints {
+				if namespace, ok := systemNamespace("", selector); ok {
+					warnings = append(warnings, fmt.Sprintf("%s: ingress[%d] allows traffic from system namespace %s", name, i, namespace))
+					break
+				}
+			}
+		}
+		for i, rule := range policy.Spec.Egress {
+			if isDNSRule(rule.ToPorts) {
+				continue
+			}
+			for _, selector := range rule.ToEndpoints {
+				if namespace, ok := systemNamespace("", selector); ok {
+					warnings = append(warnings, fmt.Sprintf("%s: egress[%d] allows traffic to system namespace %s", name, i, namespace))
+					break
+				}
+			}
+		}
+	}
+	return warnings
+}
+
+// systemNamespace returns the system namespace a selector is scoped to,
+// through its namespace label or an In expression on it, falling back to
+// the namespace the policy lives in
+func systemNamespace(policyNamespace string, selector EndpointSelector) (string, bool) {
+	namespaces := []string{policyNamespace}
+	if namespace, ok := selector.MatchLabels[ciliumNamespaceLabel]; ok {
+		namespaces = []string{namespace}
+	}
+	for _, expr := range selector.MatchExpressions {
+		if expr.Key == ciliumNamespaceLabel && expr.Operator == "In" {
+			namespaces = append(namespaces, expr.Values...)
+		}
+	}
+
+	for _, namespace := range namespaces {
+		if slices.Contains(SystemNamespaces, namespace) {
+			return namespace, true
+		}
+	}
+	return "", false
+}
+
+// isDNSRule reports whether port rules only allow DNS (port 53)
+func isDNSRule(portRules []PortRule) bool {
+	if len(portRules) == 0 {
+		return false
+	}
+	for _, portRule := range portRules {
+		for _, pp := range portRule.Ports {
+			if pp.Port != "53" || pp.EndPort != 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
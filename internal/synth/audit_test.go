@@ -0,0 +1,71 @@
+package synth
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAuditPolicies(t *testing.T) {
+	selector := func(labels map[string]string) []EndpointSelector {
+		return []EndpointSelector{{MatchLabels: labels}}
+	}
+	policy := mergeTestPolicy
+
+	tests := []struct {
+		name     string
+		policy   *Policy
+		override []string
+		want     []string
+	}{
+		{
+			name: "application traffic and DNS egress",
+			policy: policy("shop",
+				[]IngressRule{{FromEndpoints: selector(map[string]string{"k8s:app": "frontend"})}},
+				generateEgressRulesForDNS("shop")),
+		},
+		{
+			name:   "policy in a system namespace",
+			policy: policy("kube-system", nil, nil),
+			want:   []string{"kube-system/catalog-policy: policy selects pods in system namespace kube-system"},
+		},
+		{
+			name: "ingress from and egress to system pods",
+			policy: policy("shop",
+				[]IngressRule{
+					{FromEndpoints: selector(map[string]string{"k8s:app": "frontend"})},
+					{FromEndpoints: []EndpointSelector{{MatchExpressions: []MatchExpression{
+						{Key: ciliumNamespaceLabel, Operator: "In", Values: []string{"monitoring", "cilium"}},
+					}}}},
+				},
+				[]EgressRule{{
+					ToEndpoints: selector(map[string]string{ciliumNamespaceLabel: "kube-public"}),
+					ToPorts:     []PortRule{{Ports: []PortProtocol{{Port: "443", Protocol: "TCP"}}}},
+				}}),
+			want: []string{
+				"shop/catalog-policy: ingress[1] allows traffic from system namespace cilium",
+				"shop/catalog-policy: egress[0] allows traffic to system namespace kube-public",
+			},
+		},
+		{
+			name:     "overridden namespace list",
+			policy:   policy("platform", nil, nil),
+			override: []string{"platform"},
+			want:     []string{"platform/catalog-policy: policy selects pods in system namespace platform"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.override != nil {
+				saved := SystemNamespaces
+				SystemNamespaces = tt.override
+				defer func() { SystemNamespaces = saved }()
+			}
+
+			got := AuditPolicies([]*Policy{tt.policy})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("AuditPolicies() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
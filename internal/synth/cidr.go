@@ -0,0 +1,191 @@
+package synth
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultIPv4AggregationPrefix is the broadest IPv4 supernet AggregateCIDRs
+	// produces when no prefix length is configured
+	DefaultIPv4AggregationPrefix = 24
+
+	// DefaultIPv6AggregationPrefix is the broadest IPv6 supernet AggregateCIDRs
+	// ever produces
+	DefaultIPv6AggregationPrefix = 64
+)
+
+// AggregateCIDRs groups individual IPs into supernets no broader than
+// maxPrefixLen. IPs sharing a /maxPrefixLen block collapse into the smallest
+// prefix covering all of them; a lone IP stays a host route (/32 or /128).
+// maxPrefixLen applies to IPv4; IPv6 is never aggregated beyond /64. A value
+// of 0 or less uses the defaults (/24 for IPv4, /64 for IPv6). The result is
+// sorted with IPv4 blocks before IPv6 blocks.
+func AggregateCIDRs(ips []net.IP, maxPrefixLen int) []string {
+	v4Prefix := DefaultIPv4AggregationPrefix
+	v6Prefix := DefaultIPv6AggregationPrefix
+	if maxPrefixLen > 0 {
+		v4Prefix = min(maxPrefixLen, 32)
+		v6Prefix = min(max(maxPrefixLen, DefaultIPv6AggregationPrefix), 128)
+	}
+
+	// Bucket IPs by their enclosing /prefix block
+	type bucket struct {
+		bits int
+		ips  []net.IP
+	}
+	buckets := make(map[string]*bucket)
+	for _, ip := range ips {
+		bits, prefix := 128, v6Prefix
+		if v4 := ip.To4(); v4 != nil {
+			ip, bits, prefix = v4, 32, v4Prefix
+		} else if ip.To16() == nil {
+			continue
+		}
+
+		block := ip.Mask(net.CIDRMask(prefix, bits)).String() + "/" + strconv.Itoa(prefix)
+		b, exists := buckets[block]
+		if !exists {
+			b = &bucket{bits: bits}
+			buckets[block] = b
+		}
+		b.ips = append(b.ips, ip)
+	}
+
+	// Emit the smallest prefix covering each bucket
+	networks := make([]*net.IPNet, 0, len(buckets))
+	for _, b := range buckets {
+		ones := b.bits
+		for _, ip := range b.ips[1:] {
+			ones = min(ones, commonPrefixLen(b.ips[0], ip))
+		}
+		mask := net.CIDRMask(ones, b.bits)
+		networks = append(networks, &net.IPNet{IP: b.ips[0].Mask(mask), Mask: mask})
+	}
+
+	sort.Slice(networks, func(i, j int) bool {
+		if len(networks[i].IP) != len(networks[j].IP) {
+			return len(networks[i].IP) < len(networks[j].IP)
+		}
+		if c := bytes.Compare(networks[i].IP, networks[j].IP); c != 0 {
+			return c < 0
+		}
+		onesI, _ := networks[i].Mask.Size()
+		onesJ, _ := networks[j].Mask.Size()
+		return onesI < onesJ
+	})
+
+	cidrs := make([]string, 0, len(networks))
+	for _, network := range networks {
+		cidrs = append(cidrs, network.String())
+	}
+	return cidrs
+}
+
+// MergeCIDRs merges IPs into the fewest CIDRs that cover exactly those IPs:
+// two blocks are only combined when they are the two halves of their
+// parent, so unlike AggregateCIDRs no unobserved address is ever allowed.
+// No block is broader than maxPrefixLen for IPv4 or /64 for IPv6 (a value
+// of 0 or less uses the /24 default). The result is sorted with IPv4 blocks
+// before IPv6 blocks.
+func MergeCIDRs(ips []netip.Addr, maxPrefixLen int) []netip.Prefix {
+	v4Prefix := DefaultIPv4AggregationPrefix
+	v6Prefix := DefaultIPv6AggregationPrefix
+	if maxPrefixLen > 0 {
+		v4Prefix = min(maxPrefixLen, 32)
+		v6Prefix = min(max(maxPrefixLen, DefaultIPv6AggregationPrefix), 128)
+	}
+
+	blocks := make(map[netip.Prefix]bool)
+	for _, ip := range ips {
+		if !ip.IsValid() {
+			continue
+		}
+		ip = ip.Unmap()
+		blocks[netip.PrefixFrom(ip, ip.BitLen())] = true
+	}
+
+	// Merge sibling pairs bottom-up, from host routes to the broadest
+	// allowed prefix. Blocks never overlap, so a block and its sibling
+	// both being present means their parent is fully observed.
+	for bits := 128; bits > 0; bits-- {
+		for block := range blocks {
+			if block.Bits() != bits {
+				continue
+			}
+			limit := v6Prefix
+			if block.Addr().Is4() {
+				limit = v4Prefix
+			}
+			if bits <= limit {
+				continue
+			}
+
+			sibling := netip.PrefixFrom(flipBit(block.Addr(), bits-1), bits)
+			if !blocks[sibling] {
+				continue
+			}
+			delete(blocks, block)
+			delete(blocks, sibling)
+			parent, _ := block.Addr().Prefix(bits - 1)
+			blocks[parent] = true
+		}
+	}
+
+	merged := make([]netip.Prefix, 0, len(blocks))
+	for block := range blocks {
+		merged = append(merged, block)
+	}
+	sort.Slice(merged, func(i, j int) bool {
+		if c := merged[i].Addr().Compare(merged[j].Addr()); c != 0 {
+			return c < 0
+		}
+		return merged[i].Bits() < merged[j].Bits()
+	})
+	return merged
+}
+
+// flipBit returns addr with the given bit, counted from the most
+// significant, inverted
+func flipBit(addr netip.Addr, bit int) netip.Addr {
+	if addr.Is4() {
+		b := addr.As4()
+		b[bit/8] ^= 0x80 >> (bit % 8)
+		return netip.AddrFrom4(b)
+	}
+	b := addr.As16()
+	b[bit/8] ^= 0x80 >> (bit % 8)
+	return netip.AddrFrom16(b)
+}
+
+// commonPrefixLen returns the number of leading bits shared by two IPs of the same length
+func commonPrefixLen(a, b net.IP) int {
+	for i := range a {
+		if x := a[i] ^ b[i]; x != 0 {
+			n := i * 8
+			for x&0x80 == 0 {
+				x <<= 1
+				n++
+			}
+			return n
+		}
+	}
+	return len(a) * 8
+}
+
+// ParsePrefixLen parses a prefix length such as "/24" or "24"
+func ParsePrefixLen(s string) (int, error) {
+	n, err := strconv.Atoi(strings.TrimPrefix(strings.TrimSpace(s), "/"))
+	if err != nil {
+		return 0, fmt.Errorf("invalid prefix length %q: must be a number like /24", s)
+	}
+	if n < 1 || n > 128 {
+		return 0, fmt.Errorf("invalid prefix length %q: must be between 1 and 128", s)
+	}
+	return n, nil
+}
@@ -0,0 +1,238 @@
+package synth
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+func TestAggregateCIDRs(t *testing.T) {
+	tests := []struct {
+		name         string
+		ips          []string
+		maxPrefixLen int
+		expected     []string
+	}{
+		{
+			name:         "single IPv4 stays a host route",
+			ips:          []string{"203.0.113.10"},
+			maxPrefixLen: 24,
+			expected:     []string{"203.0.113.10/32"},
+		},
+		{
+			name:         "adjacent IPv4 collapse to smallest covering prefix",
+			ips:          []string{"203.0.113.10", "203.0.113.11"},
+			maxPrefixLen: 24,
+			expected:     []string{"203.0.113.10/31"},
+		},
+		{
+			name:         "IPv4 spread across a /24 collapse to the /24",
+			ips:          []string{"203.0.113.1", "203.0.113.200"},
+			maxPrefixLen: 24,
+			expected:     []string{"203.0.113.0/24"},
+		},
+		{
+			name:         "IPv4 in different /24s are not merged",
+			ips:          []string{"203.0.113.1", "198.51.100.1"},
+			maxPrefixLen: 24,
+			expected:     []string{"198.51.100.1/32", "203.0.113.1/32"},
+		},
+		{
+			name:         "/16 merges across /24s",
+			ips:          []string{"10.1.2.3", "10.1.200.3"},
+			maxPrefixLen: 16,
+			expected:     []string{"10.1.0.0/16"},
+		},
+		{
+			name:         "/32 disables aggregation",
+			ips:          []string{"203.0.113.10", "203.0.113.11", "203.0.113.10"},
+			maxPrefixLen: 32,
+			expected:     []string{"203.0.113.10/32", "203.0.113.11/32"},
+		},
+		{
+			name:         "default prefix is /24",
+			ips:          []string{"203.0.113.1", "203.0.113.200"},
+			maxPrefixLen: 0,
+			expected:     []string{"203.0.113.0/24"},
+		},
+		{
+			name:         "IPv6 is never aggregated beyond /64",
+			ips:          []string{"2001:db8:0:1::1", "2001:db8:0:2::1"},
+			maxPrefixLen: 24,
+			expected:     []string{"2001:db8:0:1::1/128", "2001:db8:0:2::1/128"},
+		},
+		{
+			name:         "IPv6 within a /64 collapse",
+			ips:          []string{"2001:db8::1", "2001:db8::2"},
+			maxPrefixLen: 0,
+			expected:     []string{"2001:db8::/126"},
+		},
+		{
+			name:         "IPv4 sorted before IPv6",
+			ips:          []string{"2001:db8::1", "203.0.113.10"},
+			maxPrefixLen: 24,
+			expected:     []string{"203.0.113.10/32", "2001:db8::1/128"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ips := make([]net.IP, 0, len(tt.ips))
+			for _, s := range tt.ips {
+				ips = append(ips, net.ParseIP(s))
+			}
+			result := AggregateCIDRs(ips, tt.maxPrefixLen)
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("AggregateCIDRs() = %v, want %v", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestMergeCIDRs(t *testing.T) {
+	// hosts returns base.from through base.to
+	hosts := func(base string, from, to int) []string {
+		var ips []string
+		for i := from; i <= to; i++ {
+			ips = append(ips, fmt.Sprintf("%s.%d", base, i))
+		}
+		return ips
+	}
+
+	tests := []struct {
+		name         string
+		ips          []string
+		maxPrefixLen int
+		expected     []string
+	}{
+		{
+			name:         "single IPv4 stays a host route",
+			ips:          []string{"203.0.113.10"},
+			maxPrefixLen: 24,
+			expected:     []string{"203.0.113.10/32"},
+		},
+		{
+			name:         "both halves of a /31 merge",
+			ips:          []string{"203.0.113.11", "203.0.113.10", "203.0.113.10"},
+			maxPrefixLen: 24,
+			expected:     []string{"203.0.113.10/31"},
+		},
+		{
+			name:         "adjacent IPs across a /31 boundary are not merged",
+			ips:          []string{"203.0.113.1", "203.0.113.2"},
+			maxPrefixLen: 24,
+			expected:     []string{"203.0.113.1/32", "203.0.113.2/32"},
+		},
+		{
+			name:         "a missing host keeps its neighbours as smaller blocks",
+			ips:          []string{"203.0.113.0", "203.0.113.1", "203.0.113.2"},
+			maxPrefixLen: 24,
+			expected:     []string{"203.0.113.0/31", "203.0.113.2/32"},
+		},
+		{
+			name:         "sparse IPs in a /24 are not widened",
+			ips:          []string{"203.0.113.1", "203.0.113.200"},
+			maxPrefixLen: 24,
+			expected:     []string{"203.0.113.1/32", "203.0.113.200/32"},
+		},
+		{
+			name:         "a full /24 merges",
+			ips:          hosts("203.0.113", 0, 255),
+			maxPrefixLen: 24,
+			expected:     []string{"203.0.113.0/24"},
+		},
+		{
+			name:         "two full /24s stop at the max prefix",
+			ips:          append(hosts("10.0.0", 0, 255), hosts("10.0.1", 0, 255)...),
+			maxPrefixLen: 24,
+			expected:     []string{"10.0.0.0/24", "10.0.1.0/24"},
+		},
+		{
+			name:         "two full /24s merge with a broader max prefix",
+			ips:          append(hosts("10.0.0", 0, 255), hosts("10.0.1", 0, 255)...),
+			maxPrefixLen: 23,
+			expected:     []string{"10.0.0.0/23"},
+		},
+		{
+			name:         "max prefix caps merging below the full block",
+			ips:          hosts("203.0.113", 0, 3),
+			maxPrefixLen: 31,
+			expected:     []string{"203.0.113.0/31", "203.0.113.2/31"},
+		},
+		{
+			name:         "/32 disables merging",
+			ips:          []string{"203.0.113.10", "203.0.113.11"},
+			maxPrefixLen: 32,
+			expected:     []string{"203.0.113.10/32", "203.0.113.11/32"},
+		},
+		{
+			name:         "default prefix is /24",
+			ips:          hosts("203.0.113", 0, 255),
+			maxPrefixLen: 0,
+			expected:     []string{"203.0.113.0/24"},
+		},
+		{
+			name:         "IPv6 halves merge",
+			ips:          []string{"2001:db8::", "2001:db8::1", "2001:db8::2", "2001:db8::3"},
+			maxPrefixLen: 24,
+			expected:     []string{"2001:db8::/126"},
+		},
+		{
+			name:         "IPv4-mapped IPv6 is treated as IPv4",
+			ips:          []string{"::ffff:203.0.113.10", "203.0.113.11"},
+			maxPrefixLen: 24,
+			expected:     []string{"203.0.113.10/31"},
+		},
+		{
+			name:         "IPv4 sorted before IPv6",
+			ips:          []string{"2001:db8::1", "203.0.113.10"},
+			maxPrefixLen: 24,
+			expected:     []string{"203.0.113.10/32", "2001:db8::1/128"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ips := make([]netip.Addr, 0, len(tt.ips))
+			for _, s := range tt.ips {
+				ips = append(ips, netip.MustParseAddr(s))
+			}
+			var result []string
+			for _, prefix := range MergeCIDRs(ips, tt.maxPrefixLen) {
+				result = append(result, prefix.String())
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("MergeCIDRs() = %v, want %v", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParsePrefixLen(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int
+		wantErr  bool
+	}{
+		{input: "/24", expected: 24},
+		{input: "16", expected: 16},
+		{input: "/0", wantErr: true},
+		{input: "/129", wantErr: true},
+		{input: "abc", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := ParsePrefixLen(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParsePrefixLen() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if result != tt.expected {
+				t.Errorf("ParsePrefixLen() = %d, want %d", result, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package synth
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/prabhakaran-jm/cilium-policypilot/internal/hubble"
+	"gopkg.in/yaml.v3"
+)
+
+// RuleObservation summarizes the flows a rule was derived from
+type RuleObservation struct {
+	// Flows is the number of flows, weighted by ParsedFlow.Occurrences
+	Flows int
+	// First and Last are the earliest and latest flow times; zero if no
+	// flow had a timestamp
+	First, Last time.Time
+}
+
+// observesRules reports whether rules record the flows they were derived
+// from: for rule comments, and to divide the flow-count annotation among the
+// parts of a policy split by MaxRulesPerPolicy
+func (opts Options) observesRules() bool {
+	return opts.RuleComments || (opts.Provenance != nil && opts.MaxRulesPerPolicy > 0)
+}
+
+// clearObservations drops the rule observations of policies, so that none
+// is written as a comment
+func clearObservations(policies []*Policy) {
+	for _, policy := range policies {
+		for i := range policy.Spec.Ingress {
+			policy.Spec.Ingress[i].Observed = nil
+		}
+		for i := range policy.Spec.Egress {
+			policy.Spec.Egress[i].Observed = nil
+		}
+	}
+}
+
+// add returns the observation with flow added; o may be nil
+func (o *RuleObservation) add(flow *hubble.ParsedFlow) *RuleObservation {
+	last := flow.LastTime
+	if last.IsZero() {
+		last = flow.Time
+	}
+	return o.merge(&RuleObservation{Flows: flow.Occurrences(), First: flow.Time, Last: last})
+}
+
+// merge returns the combination of two observations, either of which may
+// be nil
+func (o *RuleObservation) merge(other *RuleObservation) *RuleObservation {
+	if o == nil || other == nil {
+		if o == nil {
+			return other
+		}
+		return o
+	}
+	merged := &RuleObservation{Flows: o.Flows + other.Flows, First: o.First, Last: o.Last}
+	if merged.First.IsZero() || (!other.First.IsZero() && other.First.Before(merged.First)) {
+		merged.First = other.First
+	}
+	if other.Last.After(merged.Last) {
+		merged.Last = other.Last
+	}
+	return merged
+}
+
+// comment describes the observation for a rule, e.g. "observed 142 flows
+// from k8s:app=frontend on 2024-01-02..2024-01-03"
+func (o *RuleObservation) comment(rule IngressRule) string {
+	peers := ingressPeers(rule)
+	for i, peer := range peers {
+		peers[i] = strings.TrimPrefix(peer, "endpoints:")
+	}
+	if len(peers) == 0 {
+		peers = []string{"any source"}
+	}
+
+	flows := "flows"
+	if o.Flows == 1 {
+		flows = "flow"
+	}
+	comment := fmt.Sprintf("observed %d %s from %s", o.Flows, flows, strings.Join(peers, ", "))
+	if o.First.IsZero() {
+		return comment
+	}
+	first, last := o.First.UTC().Format(time.DateOnly), o.Last.UTC().Format(time.DateOnly)
+	if first == last {
+		return comment + " on " + first
+	}
+	return comment + " on " + first + ".." + last
+}
+
+// addRuleComments sets a head comment on each ingress rule of a policy's
+// node tree that has an observation
+func addRuleComments(node *yaml.Node, policy *Policy) {
+	ingress := mappingValue(mappingValue(node, "spec"), "ingress")
+	if ingress == nil || ingress.Kind != yaml.SequenceNode || len(ingress.Content) != len(policy.Spec.Ingress) {
+		return
+	}
+	for i, rule := range policy.Spec.Ingress {
+		if rule.Observed != nil {
+			ingress.Content[i].HeadComment = rule.Observed.comment(rule)
+		}
+	}
+}
+
+// mappingValue returns the value of key in a mapping node, or nil
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node != nil && node.Kind == yaml.DocumentNode && len(node.Content) == 1 {
+		node = node.Content[0]
+	}
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
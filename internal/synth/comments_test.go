@@ -0,0 +1,181 @@
+package synth
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prabhakaran-jm/cilium-policypilot/internal/hubble"
+)
+
+func TestSynthesizePoliciesRuleComments(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 1, d, 23, 0, 0, 0, time.UTC) }
+	flows := []*hubble.ParsedFlow{
+		{
+			SourceLabels:    map[string]string{"k8s:app": "frontend"},
+			SourceNamespace: "shop",
+			DestLabels:      map[string]string{"k8s:app": "catalog"},
+			DestNamespace:   "shop",
+			DestPort:        8080,
+			Protocol:        "TCP",
+			Count:           140,
+			Time:            day(2),
+		},
+		{
+			SourceLabels:    map[string]string{"k8s:app": "frontend"},
+			SourceNamespace: "shop",
+			DestLabels:      map[string]string{"k8s:app": "catalog"},
+			DestNamespace:   "shop",
+			DestPort:        9090,
+			Protocol:        "TCP",
+			Count:           2,
+			Time:            day(3),
+		},
+		{
+			SourceLabels:    map[string]string{"k8s:app": "gateway"},
+			SourceNamespace: "shop",
+			DestLabels:      map[string]string{"k8s:app": "catalog"},
+			DestNamespace:   "shop",
+			DestPort:        8080,
+			Protocol:        "TCP",
+		},
+	}
+
+	policies, err := SynthesizePoliciesWithOptions(flows, Options{RuleComments: true})
+	if err != nil {
+		t.Fatalf("SynthesizePoliciesWithOptions() error = %v", err)
+	}
+	if len(policies) != 1 || len(policies[0].Spec.Ingress) != 2 {
+		t.Fatalf("Expected one policy with two ingress rules, got %+v", policies)
+	}
+
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := WritePoliciesToFile(policies, path); err != nil {
+		t.Fatalf("WritePoliciesToFile() error = %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read policy file: %v", err)
+	}
+	for _, comment := range []string{
+		"# observed 142 flows from k8s:app=frontend on 2024-01-02..2024-01-03\n",
+		"# observed 1 flow from k8s:app=gateway\n",
+	} {
+		if !strings.Contains(string(data), comment) {
+			t.Errorf("Expected %q in:\n%s", comment, data)
+		}
+	}
+
+	// The comments don't change the parsed policies
+	parsed, err := ParsePoliciesFromFile(path)
+	if err != nil {
+		t.Fatalf("ParsePoliciesFromFile() error = %v", err)
+	}
+	if !reflect.DeepEqual(parsed[0].Spec.Ingress, withoutObservations(policies[0].Spec.Ingress)) {
+		t.Errorf("Parsed ingress = %+v, want %+v", parsed[0].Spec.Ingress, policies[0].Spec.Ingress)
+	}
+
+	// Without the option nothing is recorded or commented
+	policies, err = SynthesizePoliciesWithOptions(flows, Options{})
+	if err != nil {
+		t.Fatalf("SynthesizePoliciesWithOptions() error = %v", err)
+	}
+	var buf bytes.Buffer
+	if err := WritePolicies(&buf, policies); err != nil {
+		t.Fatalf("WritePolicies() error = %v", err)
+	}
+	if strings.Contains(buf.String(), "#") {
+		t.Errorf("Expected no comments without RuleComments, got:\n%s", buf.String())
+	}
+}
+
+func TestSynthesizePoliciesRuleCommentsDeduplicated(t *testing.T) {
+	newFlow := func(d int) *hubble.ParsedFlow {
+		return &hubble.ParsedFlow{
+			SourceLabels:    map[string]string{"k8s:app": "frontend"},
+			SourceNamespace: "shop",
+			DestLabels:      map[string]string{"k8s:app": "catalog"},
+			DestNamespace:   "shop",
+			DestPort:        8080,
+			Protocol:        "TCP",
+			Time:            time.Date(2024, 1, d, 12, 0, 0, 0, time.UTC),
+		}
+	}
+
+	// The same tuple seen on two days collapses into one flow
+	flows := hubble.DeduplicateFlows([]*hubble.ParsedFlow{newFlow(4), newFlow(2)})
+	policies, err := SynthesizePoliciesWithOptions(flows, Options{RuleComments: true})
+	if err != nil {
+		t.Fatalf("SynthesizePoliciesWithOptions() error = %v", err)
+	}
+	if len(policies) != 1 || len(policies[0].Spec.Ingress) != 1 {
+		t.Fatalf("Expected one policy with one ingress rule, got %+v", policies)
+	}
+	expected := "observed 2 flows from k8s:app=frontend on 2024-01-02..2024-01-04"
+	if got := policies[0].Spec.Ingress[0].Observed.comment(policies[0].Spec.Ingress[0]); got != expected {
+		t.Errorf("comment() = %q, want %q", got, expected)
+	}
+}
+
+func TestRuleObservationComment(t *testing.T) {
+	day := func(d, hour int) time.Time { return time.Date(2024, 1, d, hour, 0, 0, 0, time.UTC) }
+	frontend := IngressRule{FromEndpoints: []EndpointSelector{{MatchLabels: map[string]string{"k8s:app": "frontend"}}}}
+
+	tests := []struct {
+		name        string
+		observation *RuleObservation
+		rule        IngressRule
+		expected    string
+	}{
+		{
+			name:        "date range",
+			observation: (&RuleObservation{Flows: 3, First: day(2, 8), Last: day(2, 8)}).merge(&RuleObservation{Flows: 4, First: day(3, 9), Last: day(3, 9)}),
+			rule:        frontend,
+			expected:    "observed 7 flows from k8s:app=frontend on 2024-01-02..2024-01-03",
+		},
+		{
+			name:        "single day",
+			observation: (&RuleObservation{Flows: 1, First: day(2, 8), Last: day(2, 8)}).merge(&RuleObservation{Flows: 1, First: day(2, 20), Last: day(2, 20)}),
+			rule:        frontend,
+			expected:    "observed 2 flows from k8s:app=frontend on 2024-01-02",
+		},
+		{
+			name:        "flows without timestamps don't change the dates",
+			observation: (&RuleObservation{Flows: 1}).merge(&RuleObservation{Flows: 1, First: day(2, 8), Last: day(2, 8)}).merge(&RuleObservation{Flows: 1}),
+			rule:        frontend,
+			expected:    "observed 3 flows from k8s:app=frontend on 2024-01-02",
+		},
+		{
+			name:        "no timestamps",
+			observation: (*RuleObservation)(nil).merge(&RuleObservation{Flows: 1}),
+			rule:        IngressRule{FromEntities: []string{"host"}, FromCIDR: []string{"203.0.113.0/24"}},
+			expected:    "observed 1 flow from entity:host, cidr:203.0.113.0/24",
+		},
+		{
+			name:        "no peers",
+			observation: &RuleObservation{Flows: 5},
+			expected:    "observed 5 flows from any source",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.observation.comment(tt.rule); got != tt.expected {
+				t.Errorf("comment() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+// withoutObservations returns a copy of rules as parsed from YAML
+func withoutObservations(rules []IngressRule) []IngressRule {
+	result := make([]IngressRule, 0, len(rules))
+	for _, rule := range rules {
+		result = append(result, withoutObservation(rule))
+	}
+	return result
+}
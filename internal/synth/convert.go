@@ -0,0 +1,213 @@
+package synth
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ciliumNamespaceLabelsPrefix prefixes namespace labels that Cilium copies onto
+// each endpoint, e.g. k8s:io.cilium.k8s.namespace.labels.team
+const ciliumNamespaceLabelsPrefix = "k8s:io.cilium.k8s.namespace.labels."
+
+// ConvertFromNetworkPolicy translates a Kubernetes NetworkPolicy into a
+// CiliumNetworkPolicy. Pod labels gain the "k8s:" source prefix, namespace
+// selectors become namespace labels, and ipBlocks become fromCIDR/toCIDR.
+// The returned warnings describe each construct that was dropped or
+// approximated; peers that cannot be expressed are dropped, never widened.
+func ConvertFromNetworkPolicy(np *NetworkPolicy) (*Policy, []string) {
+	var warnings []string
+	namespace := np.Metadata.Namespace
+
+	endpointSelector := fromK8sSelector(&np.Spec.PodSelector, nil, namespace)
+	// Generated policies always scope their endpoint selector explicitly
+	if namespace != "" {
+		endpointSelector.MatchLabels[ciliumNamespaceLabel] = namespace
+	}
+
+	policy := &Policy{
+		APIVersion: "cilium.io/v2",
+		Kind:       "CiliumNetworkPolicy",
+		Metadata:   np.Metadata,
+		Spec: PolicySpec{
+			EndpointSelector: endpointSelector,
+		},
+	}
+
+	for i, rule := range np.Spec.Ingress {
+		field := fmt.Sprintf("ingress[%d]", i)
+		ciliumRule := IngressRule{ToPorts: fromNetworkPolicyPorts(rule.Ports)}
+
+		if len(rule.From) == 0 {
+			// No peers means all sources
+			if len(ciliumRule.ToPorts) == 0 {
+				ciliumRule.FromEntities = []string{"all"}
+			}
+			policy.Spec.Ingress = append(policy.Spec.Ingress, ciliumRule)
+			continue
+		}
+
+		for j, peer := range rule.From {
+			selector, cidr, err := fromNetworkPolicyPeer(peer, namespace)
+			if err != nil {
+				warnings = append(warnings, fmt.Sprintf("%s.from[%d]: %v; peer dropped", field, j, err))
+				continue
+			}
+			if cidr != "" {
+				ciliumRule.FromCIDR = append(ciliumRule.FromCIDR, cidr)
+			} else {
+				ciliumRule.FromEndpoints = append(ciliumRule.FromEndpoints, selector)
+			}
+		}
+
+		// Without peers the rule would allow all sources
+		if len(ciliumRule.FromEndpoints) == 0 && len(ciliumRule.FromCIDR) == 0 {
+			warnings = append(warnings, fmt.Sprintf("%s: no peers could be converted; rule dropped", field))
+			continue
+		}
+		policy.Spec.Ingress = append(policy.Spec.Ingress, ciliumRule)
+	}
+
+	for i, rule := range np.Spec.Egress {
+		field := fmt.Sprintf("egress[%d]", i)
+		ciliumRule := EgressRule{ToPorts: fromNetworkPolicyPorts(rule.Ports)}
+
+		if len(rule.To) == 0 {
+			if len(ciliumRule.ToPorts) == 0 {
+				ciliumRule.ToEntities = []string{"all"}
+			}
+			policy.Spec.Egress = append(policy.Spec.Egress, ciliumRule)
+			continue
+		}
+
+		for j, peer := range rule.To {
+			selector, cidr, err := fromNetworkPolicyPeer(peer, namespace)
+			if err != nil {
+				warnings = append(warnings, fmt.Sprintf("%s.to[%d]: %v; peer dropped", field, j, err))
+				continue
+			}
+			if cidr != "" {
+				ciliumRule.ToCIDR = append(ciliumRule.ToCIDR, cidr)
+			} else {
+				ciliumRule.ToEndpoints = append(ciliumRule.ToEndpoints, selector)
+			}
+		}
+
+		if len(ciliumRule.ToEndpoints) == 0 && len(ciliumRule.ToCIDR) == 0 {
+			warnings = append(warnings, fmt.Sprintf("%s: no peers could be converted; rule dropped", field))
+			continue
+		}
+		policy.Spec.Egress = append(policy.Spec.Egress, ciliumRule)
+	}
+
+	// policyTypes defaults to Ingress, plus Egress when egress rules exist.
+	// An isolated direction without rules denies all traffic, which Cilium
+	// expresses as a single empty rule.
+	ingressIsolated, egressIsolated := true, len(np.Spec.Egress) > 0
+	if len(np.Spec.PolicyTypes) > 0 {
+		ingressIsolated, egressIsolated = false, false
+		for _, policyType := range np.Spec.PolicyTypes {
+			switch policyType {
+			case "Ingress":
+				ingressIsolated = true
+			case "Egress":
+				egressIsolated = true
+			}
+		}
+	}
+	if ingressIsolated && len(policy.Spec.Ingress) == 0 {
+		policy.Spec.Ingress = []IngressRule{{}}
+	}
+	if egressIsolated && len(policy.Spec.Egress) == 0 {
+		policy.Spec.Egress = []EgressRule{{}}
+	}
+
+	return policy, warnings
+}
+
+// fromNetworkPolicyPeer converts a NetworkPolicy peer into either an endpoint
+// selector or a CIDR
+func fromNetworkPolicyPeer(peer NetworkPolicyPeer, policyNamespace string) (EndpointSelector, string, error) {
+	if peer.IPBlock != nil {
+		if len(peer.IPBlock.Except) > 0 {
+			return EndpointSelector{}, "", fmt.Errorf("ipBlock %s has except ranges, which cannot be expressed", peer.IPBlock.CIDR)
+		}
+		return EndpointSelector{}, peer.IPBlock.CIDR, nil
+	}
+
+	if peer.NamespaceSelector != nil && len(peer.NamespaceSelector.MatchLabels) == 0 && len(peer.NamespaceSelector.MatchExpressions) == 0 {
+		return EndpointSelector{}, "", fmt.Errorf("an empty namespaceSelector (all namespaces) cannot be expressed with matchLabels")
+	}
+
+	podSelector := peer.PodSelector
+	if podSelector == nil {
+		podSelector = &LabelSelector{}
+	}
+	return fromK8sSelector(podSelector, peer.NamespaceSelector, policyNamespace), "", nil
+}
+
+// fromK8sSelector converts pod and namespace selectors into a Cilium
+// endpoint selector. Without a namespace selector Cilium already scopes the
+// selector to the policy's namespace; the namespace label is only added to an
+// empty pod selector, since empty matchLabels are rejected by verify.
+func fromK8sSelector(podSelector, namespaceSelector *LabelSelector, policyNamespace string) EndpointSelector {
+	selector := EndpointSelector{
+		MatchLabels: make(map[string]string, len(podSelector.MatchLabels)+1),
+	}
+	for key, value := range podSelector.MatchLabels {
+		selector.MatchLabels["k8s:"+key] = value
+	}
+	for _, req := range podSelector.MatchExpressions {
+		selector.MatchExpressions = append(selector.MatchExpressions, fromK8sRequirement(req, "k8s:"+req.Key))
+	}
+
+	if namespaceSelector == nil {
+		if len(selector.MatchLabels) == 0 && len(selector.MatchExpressions) == 0 && policyNamespace != "" {
+			selector.MatchLabels[ciliumNamespaceLabel] = policyNamespace
+		}
+		return selector
+	}
+
+	for key, value := range namespaceSelector.MatchLabels {
+		selector.MatchLabels[fromK8sNamespaceKey(key)] = value
+	}
+	for _, req := range namespaceSelector.MatchExpressions {
+		selector.MatchExpressions = append(selector.MatchExpressions, fromK8sRequirement(req, fromK8sNamespaceKey(req.Key)))
+	}
+	return selector
+}
+
+// fromK8sNamespaceKey returns the Cilium label for a namespace label key
+func fromK8sNamespaceKey(key string) string {
+	if key == k8sNamespaceNameLabel {
+		return ciliumNamespaceLabel
+	}
+	return ciliumNamespaceLabelsPrefix + key
+}
+
+func fromK8sRequirement(req LabelSelectorRequirement, key string) MatchExpression {
+	return MatchExpression{Key: key, Operator: req.Operator, Values: req.Values}
+}
+
+// fromNetworkPolicyPorts converts NetworkPolicy ports into a single Cilium
+// port rule. Omitted protocols default to TCP and omitted ports to "0",
+// which Cilium treats as any port.
+func fromNetworkPolicyPorts(ports []NetworkPolicyPort) []PortRule {
+	if len(ports) == 0 {
+		return nil
+	}
+
+	rule := PortRule{}
+	for _, port := range ports {
+		protocol := strings.ToUpper(port.Protocol)
+		if protocol == "" {
+			protocol = "TCP"
+		}
+		value := string(port.Port)
+		if value == "" {
+			value = "0"
+		}
+		rule.Ports = append(rule.Ports, PortProtocol{Port: value, EndPort: port.EndPort, Protocol: protocol})
+	}
+
+	return []PortRule{rule}
+}
@@ -0,0 +1,230 @@
+package synth
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestConvertNetworkPolicyLossless(t *testing.T) {
+	original := &Policy{
+		APIVersion: "cilium.io/v2",
+		Kind:       "CiliumNetworkPolicy",
+		Metadata:   PolicyMetadata{Name: "catalog-policy", Namespace: "default"},
+		Spec: PolicySpec{
+			EndpointSelector: EndpointSelector{MatchLabels: map[string]string{"k8s:app": "catalog", "k8s:io.kubernetes.pod.namespace": "default"}},
+			Ingress: []IngressRule{
+				{
+					FromEndpoints: []EndpointSelector{
+						{MatchLabels: map[string]string{"k8s:app": "frontend", "k8s:io.kubernetes.pod.namespace": "web"}},
+					},
+					ToPorts: []PortRule{{Ports: []PortProtocol{{Port: "8080", Protocol: "TCP"}}}},
+				},
+			},
+			Egress: []EgressRule{
+				{
+					ToCIDR:  []string{"10.0.0.0/24"},
+					ToPorts: []PortRule{{Ports: []PortProtocol{{Port: "443", Protocol: "TCP"}}}},
+				},
+			},
+		},
+	}
+
+	np, warnings := ConvertToNetworkPolicyWithWarnings(original)
+	if len(warnings) != 0 {
+		t.Errorf("Expected no warnings converting to NetworkPolicy, got %v", warnings)
+	}
+
+	converted, warnings := ConvertFromNetworkPolicy(np)
+	if len(warnings) != 0 {
+		t.Errorf("Expected no warnings converting back, got %v", warnings)
+	}
+	if !reflect.DeepEqual(converted, original) {
+		t.Errorf("Round trip changed the policy:\ngot  %+v\nwant %+v", converted.Spec, original.Spec)
+	}
+}
+
+func TestConvertToNetworkPolicyLossy(t *testing.T) {
+	policy := &Policy{
+		APIVersion: "cilium.io/v2",
+		Kind:       "CiliumNetworkPolicy",
+		Metadata:   PolicyMetadata{Name: "catalog-policy", Namespace: "default"},
+		Spec: PolicySpec{
+			EndpointSelector: EndpointSelector{MatchLabels: map[string]string{"k8s:app": "catalog"}},
+			Ingress: []IngressRule{
+				{FromEntities: []string{"host"}},
+				{
+					FromEndpoints: []EndpointSelector{
+						{MatchLabels: map[string]string{"k8s:app": "frontend", "reserved:remote-node": ""}},
+					},
+					ToPorts: []PortRule{{
+						Ports: []PortProtocol{{Port: "8080", Protocol: "TCP"}},
+						Rules: &L7Rules{HTTP: []PortRuleHTTP{{Method: "GET", Path: "/api"}}},
+					}},
+				},
+			},
+			Egress: []EgressRule{
+				{ToFQDNs: []FQDNSelector{{MatchName: "api.example.com"}}},
+			},
+		},
+	}
+
+	np, warnings := ConvertToNetworkPolicyWithWarnings(policy)
+
+	wantWarnings := []string{
+		"ingress[0]: fromEntities",
+		"ingress[1].fromEndpoints[0]: labels reserved:remote-node",
+		"ingress[1].toPorts[0]: HTTP rules",
+		"egress[0]: toFQDNs",
+	}
+	if len(warnings) != len(wantWarnings) {
+		t.Fatalf("Expected %d warnings, got %d: %v", len(wantWarnings), len(warnings), warnings)
+	}
+	for i, want := range wantWarnings {
+		if !strings.HasPrefix(warnings[i], want) {
+			t.Errorf("warnings[%d] = %q, want prefix %q", i, warnings[i], want)
+		}
+	}
+
+	if len(np.Spec.Ingress) != 1 || len(np.Spec.Ingress[0].Ports) != 1 {
+		t.Fatalf("Expected 1 ingress rule with 1 port, got %+v", np.Spec.Ingress)
+	}
+	if len(np.Spec.Egress) != 0 {
+		t.Errorf("Expected toFQDNs rule to be dropped, got %+v", np.Spec.Egress)
+	}
+	// Egress stays isolated even though its only rule was dropped
+	if !reflect.DeepEqual(np.Spec.PolicyTypes, []string{"Ingress", "Egress"}) {
+		t.Errorf("Expected policyTypes [Ingress Egress], got %v", np.Spec.PolicyTypes)
+	}
+}
+
+func TestConvertFromNetworkPolicyLossy(t *testing.T) {
+	np := &NetworkPolicy{
+		APIVersion: "networking.k8s.io/v1",
+		Kind:       "NetworkPolicy",
+		Metadata:   PolicyMetadata{Name: "api", Namespace: "web"},
+		Spec: NetworkPolicySpec{
+			PodSelector: LabelSelector{},
+			PolicyTypes: []string{"Ingress", "Egress"},
+			Ingress: []NetworkPolicyIngressRule{
+				{
+					From: []NetworkPolicyPeer{
+						{IPBlock: &IPBlock{CIDR: "10.0.0.0/8", Except: []string{"10.1.0.0/16"}}},
+						{PodSelector: &LabelSelector{MatchLabels: map[string]string{"app": "frontend"}}},
+					},
+					Ports: []NetworkPolicyPort{{Port: "8000", EndPort: 8100}},
+				},
+				{
+					From: []NetworkPolicyPeer{
+						{NamespaceSelector: &LabelSelector{}},
+					},
+				},
+			},
+		},
+	}
+
+	policy, warnings := ConvertFromNetworkPolicy(np)
+
+	wantWarnings := []string{
+		"ingress[0].from[0]: ipBlock 10.0.0.0/8 has except ranges",
+		"ingress[1].from[0]: an empty namespaceSelector",
+		"ingress[1]: no peers could be converted",
+	}
+	if len(warnings) != len(wantWarnings) {
+		t.Fatalf("Expected %d warnings, got %d: %v", len(wantWarnings), len(warnings), warnings)
+	}
+	for i, want := range wantWarnings {
+		if !strings.HasPrefix(warnings[i], want) {
+			t.Errorf("warnings[%d] = %q, want prefix %q", i, warnings[i], want)
+		}
+	}
+
+	wantSelector := map[string]string{"k8s:io.kubernetes.pod.namespace": "web"}
+	if !reflect.DeepEqual(policy.Spec.EndpointSelector.MatchLabels, wantSelector) {
+		t.Errorf("Expected empty podSelector to select the namespace, got %v", policy.Spec.EndpointSelector.MatchLabels)
+	}
+
+	wantIngress := []IngressRule{
+		{
+			FromEndpoints: []EndpointSelector{{MatchLabels: map[string]string{"k8s:app": "frontend"}}},
+			ToPorts:       []PortRule{{Ports: []PortProtocol{{Port: "8000", EndPort: 8100, Protocol: "TCP"}}}},
+		},
+	}
+	if !reflect.DeepEqual(policy.Spec.Ingress, wantIngress) {
+		t.Errorf("Ingress = %+v, want %+v", policy.Spec.Ingress, wantIngress)
+	}
+
+	// Egress is isolated without rules, i.e. deny all
+	if !reflect.DeepEqual(policy.Spec.Egress, []EgressRule{{}}) {
+		t.Errorf("Expected a single empty egress rule, got %+v", policy.Spec.Egress)
+	}
+}
+
+func TestConvertMatchExpressions(t *testing.T) {
+	np := &NetworkPolicy{
+		APIVersion: "networking.k8s.io/v1",
+		Kind:       "NetworkPolicy",
+		Metadata:   PolicyMetadata{Name: "api", Namespace: "web"},
+		Spec: NetworkPolicySpec{
+			PodSelector: LabelSelector{
+				MatchLabels:      map[string]string{},
+				MatchExpressions: []LabelSelectorRequirement{{Key: "tier", Operator: "In", Values: []string{"api", "web"}}},
+			},
+			PolicyTypes: []string{"Ingress"},
+			Ingress: []NetworkPolicyIngressRule{{
+				From: []NetworkPolicyPeer{{
+					PodSelector: &LabelSelector{
+						MatchLabels:      map[string]string{},
+						MatchExpressions: []LabelSelectorRequirement{{Key: "app", Operator: "Exists"}},
+					},
+					NamespaceSelector: &LabelSelector{
+						MatchExpressions: []LabelSelectorRequirement{{Key: k8sNamespaceNameLabel, Operator: "NotIn", Values: []string{"test"}}},
+					},
+				}},
+				Ports: []NetworkPolicyPort{{Protocol: "TCP", Port: "8080"}},
+			}},
+		},
+	}
+
+	policy, warnings := ConvertFromNetworkPolicy(np)
+	if len(warnings) != 0 {
+		t.Errorf("Expected no warnings, got %v", warnings)
+	}
+
+	wantSelector := EndpointSelector{
+		MatchLabels:      map[string]string{ciliumNamespaceLabel: "web"},
+		MatchExpressions: []MatchExpression{{Key: "k8s:tier", Operator: "In", Values: []string{"api", "web"}}},
+	}
+	if !reflect.DeepEqual(policy.Spec.EndpointSelector, wantSelector) {
+		t.Errorf("EndpointSelector = %+v, want %+v", policy.Spec.EndpointSelector, wantSelector)
+	}
+	wantPeer := EndpointSelector{
+		MatchLabels: map[string]string{},
+		MatchExpressions: []MatchExpression{
+			{Key: "k8s:app", Operator: "Exists"},
+			{Key: ciliumNamespaceLabel, Operator: "NotIn", Values: []string{"test"}},
+		},
+	}
+	if got := policy.Spec.Ingress[0].FromEndpoints; len(got) != 1 || !reflect.DeepEqual(got[0], wantPeer) {
+		t.Errorf("FromEndpoints = %+v, want [%+v]", got, wantPeer)
+	}
+
+	back, warnings := ConvertToNetworkPolicyWithWarnings(policy)
+	if len(warnings) != 0 {
+		t.Errorf("Expected no warnings converting back, got %v", warnings)
+	}
+	if !reflect.DeepEqual(back.Spec.PodSelector, np.Spec.PodSelector) {
+		t.Errorf("PodSelector = %+v, want %+v", back.Spec.PodSelector, np.Spec.PodSelector)
+	}
+	if !reflect.DeepEqual(back.Spec.Ingress[0].From, np.Spec.Ingress[0].From) {
+		t.Errorf("From = %+v, want %+v", back.Spec.Ingress[0].From, np.Spec.Ingress[0].From)
+	}
+
+	// Expressions on non-Kubernetes labels are dropped with a warning
+	policy.Spec.Ingress[0].FromEndpoints[0].MatchExpressions = append(policy.Spec.Ingress[0].FromEndpoints[0].MatchExpressions,
+		MatchExpression{Key: "reserved:host", Operator: "DoesNotExist"})
+	_, warnings = ConvertToNetworkPolicyWithWarnings(policy)
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "matchExpressions on reserved:host") {
+		t.Errorf("Expected a dropped matchExpressions warning, got %v", warnings)
+	}
+}
@@ -0,0 +1,55 @@
+package synth
+
+import "strings"
+
+// defaultDenySuffix is appended to a policy's name to name its companion
+const defaultDenySuffix = "-default-deny"
+
+// DefaultDenyPolicies returns a companion policy for each distinct kind,
+// namespace and endpoint selector in policies, with no rules and
+// enableDefaultDeny set for ingress and egress. Cilium already denies
+// traffic in any direction a policy has rules for; the companion keeps
+// default-deny in effect for the selected endpoints if edits remove the
+// allow rules. Empty rule lists would not: Cilium ignores them.
+func DefaultDenyPolicies(policies []*Policy) []*Policy {
+	companions := make([]*Policy, 0, len(policies))
+	seen := make(map[string]bool)
+	for _, policy := range policies {
+		if policy.Spec.EnableDefaultDeny != nil {
+			continue
+		}
+		key := strings.Join([]string{policy.Kind, policy.Metadata.Namespace, formatSelector(policy.Spec.EndpointSelector)}, "|")
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		companion := &Policy{
+			APIVersion: policy.APIVersion,
+			Kind:       policy.Kind,
+			Metadata: PolicyMetadata{
+				Name:            joinPolicyName(policy.Metadata.Name, defaultDenySuffix),
+				Namespace:       policy.Metadata.Namespace,
+				OwnerReferences: policy.Metadata.OwnerReferences,
+			},
+			Spec: PolicySpec{
+				EndpointSelector:  policy.Spec.EndpointSelector,
+				EnableDefaultDeny: &DefaultDenyConfig{Ingress: true, Egress: true},
+			},
+		}
+		companions = append(companions, companion)
+	}
+	return companions
+}
+
+// EnforcesIngress reports whether the spec denies ingress its rules don't
+// allow: it has ingress rules or enables default-deny for ingress. An
+// empty rule list, like a missing one, enforces nothing.
+func (s PolicySpec) EnforcesIngress() bool {
+	return len(s.Ingress) > 0 || (s.EnableDefaultDeny != nil && s.EnableDefaultDeny.Ingress)
+}
+
+// EnforcesEgress is the egress counterpart of EnforcesIngress
+func (s PolicySpec) EnforcesEgress() bool {
+	return len(s.Egress) > 0 || (s.EnableDefaultDeny != nil && s.EnableDefaultDeny.Egress)
+}
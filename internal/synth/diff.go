@@ -0,0 +1,358 @@
+package synth
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Access is a single peer allowed to reach a single port through a policy
+// rule. DiffPolicies compares policies as sets of Access entries, so a rule
+// that gains a port and a rule that gains a source are reported the same way.
+type Access struct {
+	// Direction is "ingress" or "egress"
+	Direction string `json:"direction"`
+	// Peer is "endpoints:labels", "entity:name", "cidr:prefix",
+	// "fqdn:name" or "any"
+	Peer string `json:"peer"`
+	// Traffic is the port and protocol, e.g. "8080/TCP", "8080/TCP GET /api",
+	// "ICMP type 8" or "all ports"
+	Traffic string `json:"traffic"`
+}
+
+// String describes the access, e.g.
+// "ingress from endpoints:k8s:app=frontend on 8080/TCP"
+func (a Access) String() string {
+	preposition := "from"
+	if a.Direction == "egress" {
+		preposition = "to"
+	}
+	return fmt.Sprintf("%s %s %s on %s", a.Direction, preposition, a.Peer, a.Traffic)
+}
+
+// Change values reported in PolicyChange
+const (
+	ChangeAdded    = "added"
+	ChangeRemoved  = "removed"
+	ChangeModified = "modified"
+)
+
+// PolicyChange describes how one policy differs between two policy sets.
+// Policies are matched on kind, namespace, name and endpoint selector; a
+// policy whose selector changed is reported as removed and added.
+type PolicyChange struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	// Selector is the endpoint selector as sorted key=value pairs
+	Selector string   `json:"selector"`
+	Change   string   `json:"change"`
+	Added    []Access `json:"added,omitempty"`
+	Removed  []Access `json:"removed,omitempty"`
+}
+
+// PolicyDiff lists the policies that differ between two policy sets
+type PolicyDiff struct {
+	Changes []PolicyChange `json:"changes"`
+	// Unchanged is the number of policies in both sets that grant the same
+	// access
+	Unchanged int `json:"unchanged"`
+}
+
+// Empty reports whether the two policy sets grant the same access
+func (d *PolicyDiff) Empty() bool {
+	return len(d.Changes) == 0
+}
+
+// Counts returns the number of added, removed and modified policies
+func (d *PolicyDiff) Counts() (added, removed, modified int) {
+	for _, change := range d.Changes {
+		switch change.Change {
+		case ChangeAdded:
+			added++
+		case ChangeRemoved:
+			removed++
+		case ChangeModified:
+			modified++
+		}
+	}
+	return added, removed, modified
+}
+
+// DiffPolicies reports the access granted by newPolicies but not by
+// oldPolicies (Added) and the reverse (Removed), per policy. Policies with
+// the same Fingerprint in both sets are counted as unchanged without
+// comparing their rules. Changes are sorted by namespace, name and kind.
+func DiffPolicies(oldPolicies, newPolicies []*Policy) *PolicyDiff {
+	oldSet := policyAccessSets(oldPolicies)
+	newSet := policyAccessSets(newPolicies)
+
+	diff := &PolicyDiff{Changes: []PolicyChange{}}
+	for key, newPolicy := range newSet {
+		oldPolicy, ok := oldSet[key]
+		if !ok {
+			diff.Changes = append(diff.Changes, newPolicy.change(ChangeAdded, newPolicy.sortedAccess(nil), nil))
+			continue
+		}
+		if slices.Equal(oldPolicy.fingerprints(), newPolicy.fingerprints()) {
+			diff.Unchanged++
+			continue
+		}
+		added := newPolicy.sortedAccess(oldPolicy.accessSet())
+		removed := oldPolicy.sortedAccess(newPolicy.accessSet())
+		if len(added) > 0 || len(removed) > 0 {
+			diff.Changes = append(diff.Changes, newPolicy.change(ChangeModified, added, removed))
+		} else {
+			diff.Unchanged++
+		}
+	}
+	for key, oldPolicy := range oldSet {
+		if _, ok := newSet[key]; !ok {
+			diff.Changes = append(diff.Changes, oldPolicy.change(ChangeRemoved, nil, oldPolicy.sortedAccess(nil)))
+		}
+	}
+
+	sort.Slice(diff.Changes, func(i, j int) bool {
+		a, b := diff.Changes[i], diff.Changes[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		return a.Selector < b.Selector
+	})
+
+	return diff
+}
+
+// policyAccess is the access granted by the policies sharing one key
+type policyAccess struct {
+	kind      string
+	namespace string
+	name      string
+	selector  string
+	policies  []*Policy
+	// access is built on first use by accessSet
+	access map[Access]bool
+}
+
+// fingerprints returns the sorted fingerprints of the policies
+func (p *policyAccess) fingerprints() []string {
+	fingerprints := make([]string, 0, len(p.policies))
+	for _, policy := range p.policies {
+		fingerprints = append(fingerprints, policy.Fingerprint())
+	}
+	sort.Strings(fingerprints)
+	return fingerprints
+}
+
+// accessSet returns the access entries of the policies' rules
+func (p *policyAccess) accessSet() map[Access]bool {
+	if p.access != nil {
+		return p.access
+	}
+	p.access = make(map[Access]bool)
+	for _, policy := range p.policies {
+		for _, rule := range policy.Spec.Ingress {
+			addRuleAccess(p.access, "ingress", ingressPeers(rule), rule.ToPorts, rule.ICMPs)
+		}
+		for _, rule := range policy.Spec.Egress {
+			peers := selectorPeers(rule.ToEndpoints)
+			for _, fqdn := range rule.ToFQDNs {
+				if fqdn.MatchName != "" {
+					peers = append(peers, "fqdn:"+fqdn.MatchName)
+				} else {
+					peers = append(peers, "fqdn:"+fqdn.MatchPattern)
+				}
+			}
+			peers = append(peers, prefixed("entity:", rule.ToEntities)...)
+			peers = append(peers, prefixed("cidr:", rule.ToCIDR)...)
+			addRuleAccess(p.access, "egress", peers, rule.ToPorts, rule.ICMPs)
+		}
+	}
+	return p.access
+}
+
+func (p *policyAccess) change(change string, added, removed []Access) PolicyChange {
+	return PolicyChange{
+		Kind:      p.kind,
+		Namespace: p.namespace,
+		Name:      p.name,
+		Selector:  p.selector,
+		Change:    change,
+		Added:     added,
+		Removed:   removed,
+	}
+}
+
+// sortedAccess returns the entries of p not present in exclude, in
+// direction, peer, traffic order
+func (p *policyAccess) sortedAccess(exclude map[Access]bool) []Access {
+	result := make([]Access, 0)
+	for access := range p.accessSet() {
+		if !exclude[access] {
+			result = append(result, access)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.Direction != b.Direction {
+			return a.Direction < b.Direction
+		}
+		if a.Peer != b.Peer {
+			return a.Peer < b.Peer
+		}
+		return a.Traffic < b.Traffic
+	})
+	return result
+}
+
+// policyAccessSets groups policies by kind, namespace, name and selector.
+// Policies sharing a key are combined.
+func policyAccessSets(policies []*Policy) map[string]*policyAccess {
+	sets := make(map[string]*policyAccess)
+	for _, policy := range policies {
+		selector := formatSelector(policy.Spec.EndpointSelector)
+		key := strings.Join([]string{policy.Kind, policy.Metadata.Namespace, policy.Metadata.Name, selector}, "|")
+
+		set, ok := sets[key]
+		if !ok {
+			set = &policyAccess{
+				kind:      policy.Kind,
+				namespace: policy.Metadata.Namespace,
+				name:      policy.Metadata.Name,
+				selector:  selector,
+			}
+			sets[key] = set
+		}
+		set.policies = append(set.policies, policy)
+	}
+	return sets
+}
+
+// ingressPeers describes the sources of an ingress rule
+func ingressPeers(rule IngressRule) []string {
+	peers := selectorPeers(rule.FromEndpoints)
+	peers = append(peers, prefixed("entity:", rule.FromEntities)...)
+	return append(peers, prefixed("cidr:", rule.FromCIDR)...)
+}
+
+// addRuleAccess records every peer/traffic pair a rule allows. A rule
+// without peers matches any peer.
+func addRuleAccess(access map[Access]bool, direction string, peers []string, portRules []PortRule, icmps []ICMPRule) {
+	if len(peers) == 0 {
+		peers = []string{"any"}
+	}
+
+	traffic := ruleTraffic(portRules, icmps)
+	for _, peer := range peers {
+		for _, t := range traffic {
+			access[Access{Direction: direction, Peer: peer, Traffic: t}] = true
+		}
+	}
+}
+
+// ruleTraffic describes the ports and ICMP types a rule allows; a rule
+// without either allows "all ports"
+func ruleTraffic(portRules []PortRule, icmps []ICMPRule) []string {
+	traffic := portRuleTraffic(portRules)
+	for _, icmp := range icmps {
+		for _, field := range icmp.Fields {
+			protocol := "ICMP"
+			if field.Family == "IPv6" {
+				protocol = "ICMPv6"
+			}
+			traffic = append(traffic, fmt.Sprintf("%s type %d", protocol, field.Type))
+		}
+	}
+	if len(traffic) == 0 {
+		traffic = []string{"all ports"}
+	}
+	return traffic
+}
+
+// portRuleTraffic describes each port in portRules, once per HTTP rule
+// when the port is restricted to L7 requests
+func portRuleTraffic(portRules []PortRule) []string {
+	var traffic []string
+	for _, portRule := range portRules {
+		for _, pp := range portRule.Ports {
+			port := pp.Port
+			if pp.EndPort != 0 {
+				port = fmt.Sprintf("%s-%d", pp.Port, pp.EndPort)
+			}
+			protocol := pp.Protocol
+			if protocol == "" {
+				protocol = "ANY"
+			}
+			base := port + "/" + protocol
+
+			if portRule.Rules == nil || len(portRule.Rules.HTTP) == 0 {
+				traffic = append(traffic, base)
+				continue
+			}
+			for _, http := range portRule.Rules.HTTP {
+				method := http.Method
+				if method == "" {
+					method = "*"
+				}
+				path := http.Path
+				if path == "" {
+					path = "*"
+				}
+				traffic = append(traffic, fmt.Sprintf("%s %s %s", base, method, path))
+			}
+		}
+	}
+	return traffic
+}
+
+// selectorPeers describes endpoint selectors as "endpoints:labels", or
+// "endpoints:all" for an empty selector
+func selectorPeers(selectors []EndpointSelector) []string {
+	peers := make([]string, 0, len(selectors))
+	for _, selector := range selectors {
+		formatted := formatSelector(selector)
+		if formatted == "" {
+			formatted = "all"
+		}
+		peers = append(peers, "endpoints:"+formatted)
+	}
+	return peers
+}
+
+// formatSelector renders a selector as sorted key=value pairs followed by
+// its match expressions, e.g. "k8s:app=web,k8s:tier In (a|b)"
+func formatSelector(selector EndpointSelector) string {
+	parts := make([]string, 0, len(selector.MatchExpressions)+1)
+	if len(selector.MatchLabels) > 0 {
+		parts = append(parts, formatLabels(selector.MatchLabels))
+	}
+
+	expressions := make([]string, 0, len(selector.MatchExpressions))
+	for _, expr := range selector.MatchExpressions {
+		formatted := expr.Key + " " + expr.Operator
+		if len(expr.Values) > 0 {
+			values := slices.Clone(expr.Values)
+			sort.Strings(values)
+			formatted += " (" + strings.Join(values, "|") + ")"
+		}
+		expressions = append(expressions, formatted)
+	}
+	sort.Strings(expressions)
+
+	return strings.Join(append(parts, expressions...), ",")
+}
+
+func prefixed(prefix string, values []string) []string {
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		result = append(result, prefix+value)
+	}
+	return result
+}
@@ -0,0 +1,123 @@
+package synth
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffPolicies(t *testing.T) {
+	frontend := []EndpointSelector{{MatchLabels: map[string]string{"k8s:app": "frontend"}}}
+	checkout := []EndpointSelector{{MatchLabels: map[string]string{"k8s:app": "checkout"}}}
+	tcp := func(ports ...string) []PortRule {
+		rule := PortRule{}
+		for _, port := range ports {
+			rule.Ports = append(rule.Ports, PortProtocol{Port: port, Protocol: "TCP"})
+		}
+		return []PortRule{rule}
+	}
+	policy := func(name string, ingress ...IngressRule) *Policy {
+		p := mergeTestPolicy("shop", ingress, nil)
+		p.Metadata.Name = name
+		return p
+	}
+	access := func(peer, traffic string) Access {
+		return Access{Direction: "ingress", Peer: peer, Traffic: traffic}
+	}
+
+	tests := []struct {
+		name      string
+		old, new  []*Policy
+		want      []PolicyChange
+		unchanged int
+	}{
+		{
+			name:      "identical",
+			old:       []*Policy{policy("catalog-policy", IngressRule{FromEndpoints: frontend, ToPorts: tcp("8080")})},
+			new:       []*Policy{policy("catalog-policy", IngressRule{FromEndpoints: frontend, ToPorts: tcp("8080")})},
+			want:      []PolicyChange{},
+			unchanged: 1,
+		},
+		{
+			name: "rules regrouped without changing access",
+			old: []*Policy{policy("catalog-policy",
+				IngressRule{FromEndpoints: frontend, ToPorts: tcp("8080")},
+				IngressRule{FromEndpoints: frontend, ToPorts: tcp("9090")})},
+			new:       []*Policy{policy("catalog-policy", IngressRule{FromEndpoints: frontend, ToPorts: tcp("8080", "9090")})},
+			want:      []PolicyChange{},
+			unchanged: 1,
+		},
+		{
+			name: "port and source added, port removed",
+			old:  []*Policy{policy("catalog-policy", IngressRule{FromEndpoints: frontend, ToPorts: tcp("8080", "9090")})},
+			new: []*Policy{policy("catalog-policy",
+				IngressRule{FromEndpoints: frontend, ToPorts: tcp("8080", "8443")},
+				IngressRule{FromEndpoints: checkout, ToPorts: tcp("8080")})},
+			want: []PolicyChange{{
+				Kind: "CiliumNetworkPolicy", Namespace: "shop", Name: "catalog-policy", Selector: "k8s:app=catalog",
+				Change: ChangeModified,
+				Added: []Access{
+					access("endpoints:k8s:app=checkout", "8080/TCP"),
+					access("endpoints:k8s:app=frontend", "8443/TCP"),
+				},
+				Removed: []Access{access("endpoints:k8s:app=frontend", "9090/TCP")},
+			}},
+		},
+		{
+			name: "policy added and removed",
+			old:  []*Policy{policy("cart-policy", IngressRule{FromEntities: []string{"host"}})},
+			new:  []*Policy{policy("catalog-policy", IngressRule{FromCIDR: []string{"10.0.0.0/8"}, ToPorts: tcp("8080")})},
+			want: []PolicyChange{
+				{
+					Kind: "CiliumNetworkPolicy", Namespace: "shop", Name: "cart-policy", Selector: "k8s:app=catalog",
+					Change:  ChangeRemoved,
+					Removed: []Access{access("entity:host", "all ports")},
+				},
+				{
+					Kind: "CiliumNetworkPolicy", Namespace: "shop", Name: "catalog-policy", Selector: "k8s:app=catalog",
+					Change: ChangeAdded,
+					Added:  []Access{access("cidr:10.0.0.0/8", "8080/TCP")},
+				},
+			},
+		},
+		{
+			name: "L7 and ICMP traffic",
+			old:  []*Policy{policy("catalog-policy", IngressRule{FromEndpoints: frontend, ICMPs: []ICMPRule{{Fields: []ICMPField{{Type: 8}}}}})},
+			new: []*Policy{policy("catalog-policy", IngressRule{FromEndpoints: frontend, ToPorts: []PortRule{{
+				Ports: []PortProtocol{{Port: "8080", Protocol: "TCP"}},
+				Rules: &L7Rules{HTTP: []PortRuleHTTP{{Method: "GET", Path: "/api"}}},
+			}}})},
+			want: []PolicyChange{{
+				Kind: "CiliumNetworkPolicy", Namespace: "shop", Name: "catalog-policy", Selector: "k8s:app=catalog",
+				Change:  ChangeModified,
+				Added:   []Access{access("endpoints:k8s:app=frontend", "8080/TCP GET /api")},
+				Removed: []Access{access("endpoints:k8s:app=frontend", "ICMP type 8")},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := DiffPolicies(tt.old, tt.new)
+			if !reflect.DeepEqual(got.Changes, tt.want) {
+				t.Errorf("DiffPolicies() =\n%+v\nwant\n%+v", got.Changes, tt.want)
+			}
+			if got.Empty() != (len(tt.want) == 0) {
+				t.Errorf("Empty() = %v, want %v", got.Empty(), len(tt.want) == 0)
+			}
+			if got.Unchanged != tt.unchanged {
+				t.Errorf("Unchanged = %d, want %d", got.Unchanged, tt.unchanged)
+			}
+		})
+	}
+}
+
+func TestDiffPoliciesSelectorChange(t *testing.T) {
+	old := mergeTestPolicy("shop", []IngressRule{{FromEntities: []string{"host"}}}, nil)
+	new := mergeTestPolicy("shop", []IngressRule{{FromEntities: []string{"host"}}}, nil)
+	new.Spec.EndpointSelector.MatchLabels = map[string]string{"k8s:app": "catalog", "k8s:tier": "web"}
+
+	added, removed, modified := DiffPolicies([]*Policy{old}, []*Policy{new}).Counts()
+	if added != 1 || removed != 1 || modified != 0 {
+		t.Errorf("Counts() = %d, %d, %d, want 1, 1, 0", added, removed, modified)
+	}
+}
@@ -0,0 +1,325 @@
+package synth
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/prabhakaran-jm/cilium-policypilot/internal/hubble"
+)
+
+// groupExternalFlowsBySource groups flows to destinations outside the cluster,
+// and to reserved entities such as the node or the API server, by their
+// source endpoint
+func groupExternalFlowsBySource(flows []*hubble.ParsedFlow, opts Options) []*EndpointFlows {
+	groups := make(map[string]*EndpointFlows)
+
+	for _, flow := range flows {
+		if !isExternalEgressFlow(flow) {
+			continue
+		}
+
+		key := EndpointKey{
+			Namespace: flow.SourceNamespace,
+			Labels:    selectorLabels(flow.SourceLabels, opts),
+		}
+		keyStr := endpointKeyToString(key)
+
+		group, exists := groups[keyStr]
+		if !exists {
+			group = &EndpointFlows{
+				Key:   key,
+				Flows: make([]*hubble.ParsedFlow, 0),
+			}
+			groups[keyStr] = group
+		}
+
+		group.Flows = append(group.Flows, flow)
+	}
+
+	return sortedEndpointGroups(groups)
+}
+
+// isExternalEgressFlow reports whether a flow can produce an egress rule to
+// an external destination or a reserved entity. The source must be a pod,
+// since host-network sources cannot be selected by a pod endpointSelector,
+// and external destinations need a DNS name or an IP.
+func isExternalEgressFlow(flow *hubble.ParsedFlow) bool {
+	// Replies to external clients carry an ephemeral destination port
+	if flow.IsReply {
+		return false
+	}
+	if flow.SourceNamespace == "" || len(flow.SourceLabels) == 0 || flow.SourceEntity != "" {
+		return false
+	}
+	return flow.DestEntity != "" || (flow.IsExternalDestination() && (flow.DestDNSName != "" || flow.DestIP != ""))
+}
+
+// generateExternalEgressRules creates egress rules for flows to destinations
+// outside the cluster and to reserved entities. Entities (host, remote-node,
+// kube-apiserver) become toEntities rules, since no label selector matches
+// them; destinations with a DNS name become toFQDNs rules; the rest become
+// toCIDR rules grouped by opts.CIDRPrefixLen, IPv4 and IPv6 apart.
+func generateExternalEgressRules(flows []*hubble.ParsedFlow, opts Options) []EgressRule {
+	// Collect observed ports and ICMP types per entity, per FQDN and per
+	// destination IP
+	entityPorts := make(map[string][]PortProtocol)
+	entityICMP := make(map[string][]ICMPField)
+	fqdnPorts := make(map[string][]PortProtocol)
+	fqdnICMP := make(map[string][]ICMPField)
+	ipPorts := make(map[netip.Addr][]PortProtocol)
+	ipICMP := make(map[netip.Addr][]ICMPField)
+	addrs := make([]netip.Addr, 0)
+
+	// Observed port and ICMP flows per destination, if opts.observesRules()
+	observed := make(map[string]*RuleObservation)
+	observe := func(destination string, flow *hubble.ParsedFlow) {
+		if !opts.observesRules() {
+			return
+		}
+		if flow.IsICMP() {
+			destination = "icmp " + destination
+		}
+		observed[destination] = observed[destination].add(flow)
+	}
+
+	for _, flow := range flows {
+		// Destinations are registered in the ports maps even when only
+		// ICMP is seen, so every destination gets a rule
+		if entity := flow.DestEntity; entity != "" {
+			if _, exists := entityPorts[entity]; !exists {
+				entityPorts[entity] = nil
+			}
+			if flow.IsICMP() {
+				entityICMP[entity] = addICMPField(entityICMP[entity], icmpFieldFor(flow))
+			} else {
+				entityPorts[entity] = addFlowPort(entityPorts[entity], flow)
+			}
+			observe("entity:"+entity, flow)
+			continue
+		}
+
+		if flow.DestDNSName != "" {
+			name := flow.DestDNSName
+			if _, exists := fqdnPorts[name]; !exists {
+				fqdnPorts[name] = nil
+			}
+			if flow.IsICMP() {
+				fqdnICMP[name] = addICMPField(fqdnICMP[name], icmpFieldFor(flow))
+			} else {
+				fqdnPorts[name] = addFlowPort(fqdnPorts[name], flow)
+			}
+			observe("fqdn:"+name, flow)
+			continue
+		}
+
+		addr, ok := destAddr(flow)
+		if !ok {
+			continue
+		}
+		if _, exists := ipPorts[addr]; !exists {
+			addrs = append(addrs, addr)
+			ipPorts[addr] = nil
+		}
+		if flow.IsICMP() {
+			ipICMP[addr] = addICMPField(ipICMP[addr], icmpFieldFor(flow))
+		} else {
+			ipPorts[addr] = addFlowPort(ipPorts[addr], flow)
+		}
+		observe("ip:"+addr.String(), flow)
+	}
+
+	entities := make([]string, 0, len(entityPorts))
+	for entity := range entityPorts {
+		entities = append(entities, entity)
+	}
+	sort.Strings(entities)
+
+	rules := make([]EgressRule, 0, len(entities)+len(fqdnPorts))
+	for _, entity := range entities {
+		rules = append(rules, externalEgressRules(EgressRule{ToEntities: []string{entity}}, entityPorts[entity], entityICMP[entity],
+			observed["entity:"+entity], observed["icmp entity:"+entity])...)
+	}
+
+	names := make([]string, 0, len(fqdnPorts))
+	for name := range fqdnPorts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		selector := []FQDNSelector{fqdnSelectorFor(name)}
+		rules = append(rules, externalEgressRules(EgressRule{ToFQDNs: selector}, fqdnPorts[name], fqdnICMP[name],
+			observed["fqdn:"+name], observed["icmp fqdn:"+name])...)
+	}
+
+	for _, prefix := range groupCIDRs(addrs, opts) {
+		// Union the ports and ICMP types observed for every IP inside this
+		// block; a block never contains addresses of the other family
+		var ports []PortProtocol
+		var icmp []ICMPField
+		var portsObserved, icmpObserved *RuleObservation
+		for _, addr := range addrs {
+			if prefix.Contains(addr) {
+				for _, pp := range ipPorts[addr] {
+					ports = addPort(ports, pp)
+				}
+				for _, field := range ipICMP[addr] {
+					icmp = addICMPField(icmp, field)
+				}
+				portsObserved = portsObserved.merge(observed["ip:"+addr.String()])
+				icmpObserved = icmpObserved.merge(observed["icmp ip:"+addr.String()])
+			}
+		}
+
+		rules = append(rules, externalEgressRules(EgressRule{ToCIDR: []string{prefix.String()}}, ports, icmp, portsObserved, icmpObserved)...)
+	}
+
+	return rules
+}
+
+// externalEgressRules completes a rule selecting an external destination
+// with its ports, adding a separate rule for ICMP, and records the flows
+// observed for each. A destination seen without any port or ICMP type gets
+// a rule allowing all ports.
+func externalEgressRules(peer EgressRule, ports []PortProtocol, icmp []ICMPField, portsObserved, icmpObserved *RuleObservation) []EgressRule {
+	var rules []EgressRule
+	if len(ports) > 0 || len(icmp) == 0 {
+		rule := peer
+		rule.ToPorts = portRulesFor(ports)
+		rule.Observed = portsObserved
+		rules = append(rules, rule)
+	}
+	if len(icmp) > 0 {
+		rule := peer
+		rule.ICMPs = icmpRulesFor(icmp)
+		rule.Observed = icmpObserved
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// destAddr returns a flow's destination IP, with v4-mapped IPv6 addresses
+// unmapped. ok is false if the IP does not parse or its family contradicts
+// the flow's IP version, so a malformed flow cannot put an address of the
+// wrong family in a toCIDR block.
+func destAddr(flow *hubble.ParsedFlow) (addr netip.Addr, ok bool) {
+	addr, err := netip.ParseAddr(flow.DestIP)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	addr = addr.Unmap().WithZone("")
+	if (flow.IPVersion == 4 && !addr.Is4()) || (flow.IPVersion == 6 && !addr.Is6()) {
+		return netip.Addr{}, false
+	}
+	return addr, true
+}
+
+// groupCIDRs converts external IPs to toCIDR entries, grouping IPv4 and
+// IPv6 addresses separately so no block spans both families. With
+// opts.CIDRMergePrefixLen set they are merged exactly (see MergeCIDRs);
+// otherwise they are aggregated by opts.CIDRPrefixLen, where 0 gives each IP
+// its own /32 or /128 entry. IPv4 blocks come first.
+func groupCIDRs(addrs []netip.Addr, opts Options) []netip.Prefix {
+	var v4, v6 []netip.Addr
+	for _, addr := range addrs {
+		if addr.Is4() {
+			v4 = append(v4, addr)
+		} else {
+			v6 = append(v6, addr)
+		}
+	}
+
+	var prefixes []netip.Prefix
+	for _, family := range [][]netip.Addr{v4, v6} {
+		if len(family) == 0 {
+			continue
+		}
+		if opts.CIDRMergePrefixLen > 0 {
+			prefixes = append(prefixes, MergeCIDRs(family, opts.CIDRMergePrefixLen)...)
+			continue
+		}
+
+		prefixLen := opts.CIDRPrefixLen
+		if prefixLen <= 0 {
+			prefixLen = 128
+		}
+		ips := make([]net.IP, 0, len(family))
+		for _, addr := range family {
+			ips = append(ips, net.IP(addr.AsSlice()))
+		}
+		for _, cidr := range AggregateCIDRs(ips, prefixLen) {
+			if prefix, err := netip.ParsePrefix(cidr); err == nil {
+				prefixes = append(prefixes, prefix)
+			}
+		}
+	}
+	return prefixes
+}
+
+// addFlowPort adds the flow's destination port/protocol to ports if not already present
+func addFlowPort(ports []PortProtocol, flow *hubble.ParsedFlow) []PortProtocol {
+	if flow.DestPort == 0 {
+		return ports
+	}
+	return addPort(ports, flowPort(flow))
+}
+
+// flowPort returns the flow's destination port/protocol, preferring the
+// port's name on the destination pod, e.g. "http", when it is known
+func flowPort(flow *hubble.ParsedFlow) PortProtocol {
+	protocol := flow.Protocol
+	if protocol == "" {
+		protocol = "TCP"
+	}
+	port := flow.DestPortName
+	if port == "" {
+		port = fmt.Sprintf("%d", flow.DestPort)
+	}
+	return PortProtocol{Port: port, Protocol: protocol}
+}
+
+// addPort appends pp to ports if not already present
+func addPort(ports []PortProtocol, pp PortProtocol) []PortProtocol {
+	for _, existing := range ports {
+		if existing == pp {
+			return ports
+		}
+	}
+	return append(ports, pp)
+}
+
+// portRulesFor wraps ports in a single PortRule sorted by port number, then
+// protocol, or returns nil if there are no ports (meaning all ports are
+// allowed). Named ports sort after numeric ones.
+func portRulesFor(ports []PortProtocol) []PortRule {
+	if len(ports) == 0 {
+		return nil
+	}
+	sort.Slice(ports, func(a, b int) bool {
+		portA, errA := strconv.Atoi(ports[a].Port)
+		portB, errB := strconv.Atoi(ports[b].Port)
+		switch {
+		case errA == nil && errB == nil && portA != portB:
+			return portA < portB
+		case (errA == nil) != (errB == nil):
+			return errA == nil
+		case ports[a].Port != ports[b].Port:
+			return ports[a].Port < ports[b].Port
+		}
+		return ports[a].Protocol < ports[b].Protocol
+	})
+	return []PortRule{{Ports: ports}}
+}
+
+// fqdnSelectorFor returns a matchName selector for an exact DNS name, or a
+// matchPattern selector if the name contains a wildcard
+func fqdnSelectorFor(name string) FQDNSelector {
+	if strings.Contains(name, "*") {
+		return FQDNSelector{MatchPattern: name}
+	}
+	return FQDNSelector{MatchName: name}
+}
@@ -0,0 +1,310 @@
+package synth
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/prabhakaran-jm/cilium-policypilot/internal/hubble"
+	"gopkg.in/yaml.v3"
+)
+
+func externalFlow(destIP string, port uint16) *hubble.ParsedFlow {
+	return &hubble.ParsedFlow{
+		SourceLabels:    map[string]string{"k8s:app": "frontend"},
+		SourceNamespace: "default",
+		DestLabels:      map[string]string{"reserved:world": ""},
+		DestIP:          destIP,
+		DestPort:        port,
+		Protocol:        "TCP",
+	}
+}
+
+func TestGenerateExternalEgressRulesCIDR(t *testing.T) {
+	tests := []struct {
+		name     string
+		flows    []*hubble.ParsedFlow
+		opts     Options
+		expected [][]string
+		ports    [][]string
+	}{
+		{
+			name: "one host route per IP by default",
+			flows: []*hubble.ParsedFlow{
+				externalFlow("203.0.113.10", 443),
+				externalFlow("203.0.113.11", 443),
+			},
+			expected: [][]string{{"203.0.113.10/32"}, {"203.0.113.11/32"}},
+			ports:    [][]string{{"443"}, {"443"}},
+		},
+		{
+			name: "IPs in the same subnet collapse with a prefix",
+			flows: []*hubble.ParsedFlow{
+				externalFlow("203.0.113.10", 443),
+				externalFlow("203.0.113.200", 8443),
+			},
+			opts:     Options{CIDRPrefixLen: 24},
+			expected: [][]string{{"203.0.113.0/24"}},
+			ports:    [][]string{{"443", "8443"}},
+		},
+		{
+			name: "exact merging keeps sparse IPs as host routes",
+			flows: []*hubble.ParsedFlow{
+				externalFlow("203.0.113.10", 443),
+				externalFlow("203.0.113.11", 8443),
+				externalFlow("203.0.113.200", 443),
+			},
+			opts:     Options{CIDRMergePrefixLen: 24},
+			expected: [][]string{{"203.0.113.10/31"}, {"203.0.113.200/32"}},
+			ports:    [][]string{{"443", "8443"}, {"443"}},
+		},
+		{
+			name: "IPv6 destinations",
+			flows: []*hubble.ParsedFlow{
+				externalFlow("2001:db8::10", 443),
+				externalFlow("203.0.113.10", 443),
+			},
+			expected: [][]string{{"203.0.113.10/32"}, {"2001:db8::10/128"}},
+			ports:    [][]string{{"443"}, {"443"}},
+		},
+		{
+			name: "aggregation keeps families apart",
+			flows: []*hubble.ParsedFlow{
+				externalFlow("2001:db8::1", 8443),
+				externalFlow("203.0.113.10", 443),
+				externalFlow("2001:db8::2", 8443),
+				externalFlow("203.0.113.20", 443),
+				externalFlow("::ffff:203.0.113.30", 443),
+			},
+			opts:     Options{CIDRPrefixLen: 24},
+			expected: [][]string{{"203.0.113.0/27"}, {"2001:db8::/126"}},
+			ports:    [][]string{{"443"}, {"8443"}},
+		},
+		{
+			name: "exact merging keeps families apart",
+			flows: []*hubble.ParsedFlow{
+				externalFlow("2001:db8::", 8443),
+				externalFlow("203.0.113.10", 443),
+				externalFlow("2001:db8::1", 8443),
+				externalFlow("203.0.113.11", 443),
+			},
+			opts:     Options{CIDRMergePrefixLen: 24},
+			expected: [][]string{{"203.0.113.10/31"}, {"2001:db8::/127"}},
+			ports:    [][]string{{"443"}, {"8443"}},
+		},
+		{
+			name: "address contradicting the IP version is skipped",
+			flows: []*hubble.ParsedFlow{
+				externalFlow("203.0.113.10", 443),
+				func() *hubble.ParsedFlow {
+					f := externalFlow("2001:db8::1", 443)
+					f.IPVersion = 4
+					return f
+				}(),
+			},
+			expected: [][]string{{"203.0.113.10/32"}},
+			ports:    [][]string{{"443"}},
+		},
+		{
+			name: "DNS name takes precedence over IP",
+			flows: []*hubble.ParsedFlow{
+				func() *hubble.ParsedFlow {
+					f := externalFlow("140.82.112.6", 443)
+					f.DestDNSName = "api.github.com"
+					return f
+				}(),
+			},
+			expected: [][]string{nil},
+			ports:    [][]string{{"443"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := generateExternalEgressRules(tt.flows, tt.opts)
+			if len(rules) != len(tt.expected) {
+				t.Fatalf("Expected %d rules, got %d: %+v", len(tt.expected), len(rules), rules)
+			}
+			for i, rule := range rules {
+				if !reflect.DeepEqual(rule.ToCIDR, tt.expected[i]) {
+					t.Errorf("rule[%d].ToCIDR = %v, want %v", i, rule.ToCIDR, tt.expected[i])
+				}
+				ports := make([]string, 0)
+				for _, pp := range rule.ToPorts[0].Ports {
+					ports = append(ports, pp.Port)
+				}
+				if !reflect.DeepEqual(ports, tt.ports[i]) {
+					t.Errorf("rule[%d] ports = %v, want %v", i, ports, tt.ports[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSynthesizePoliciesCIDRPrefixLen(t *testing.T) {
+	flows := []*hubble.ParsedFlow{
+		externalFlow("203.0.113.10", 443),
+		externalFlow("203.0.113.200", 443),
+	}
+
+	policies, err := SynthesizePoliciesWithOptions(flows, Options{CIDRPrefixLen: 24})
+	if err != nil {
+		t.Fatalf("SynthesizePoliciesWithOptions() error = %v", err)
+	}
+	if len(policies) != 1 {
+		t.Fatalf("Expected 1 policy, got %d", len(policies))
+	}
+	var cidrs []string
+	for _, rule := range policies[0].Spec.Egress {
+		cidrs = append(cidrs, rule.ToCIDR...)
+	}
+	if !reflect.DeepEqual(cidrs, []string{"203.0.113.0/24"}) {
+		t.Errorf("toCIDR = %v, want [203.0.113.0/24]", cidrs)
+	}
+}
+
+func TestGenerateExternalEgressRulesICMP(t *testing.T) {
+	ping := externalFlow("203.0.113.10", 0)
+	ping.Protocol = "ICMP"
+	ping.ICMPType = 8
+
+	tests := []struct {
+		name     string
+		flows    []*hubble.ParsedFlow
+		expected []EgressRule
+	}{
+		{
+			name:  "ICMP only",
+			flows: []*hubble.ParsedFlow{ping},
+			expected: []EgressRule{
+				{ToCIDR: []string{"203.0.113.10/32"}, ICMPs: []ICMPRule{{Fields: []ICMPField{{Type: 8}}}}},
+			},
+		},
+		{
+			name:  "ICMP and TCP to the same IP",
+			flows: []*hubble.ParsedFlow{ping, externalFlow("203.0.113.10", 443)},
+			expected: []EgressRule{
+				{ToCIDR: []string{"203.0.113.10/32"}, ToPorts: []PortRule{{Ports: []PortProtocol{{Port: "443", Protocol: "TCP"}}}}},
+				{ToCIDR: []string{"203.0.113.10/32"}, ICMPs: []ICMPRule{{Fields: []ICMPField{{Type: 8}}}}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := generateExternalEgressRules(tt.flows, Options{})
+			if !reflect.DeepEqual(rules, tt.expected) {
+				t.Errorf("generateExternalEgressRules() = %+v, want %+v", rules, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSynthesizePoliciesEntityEgress(t *testing.T) {
+	newFlow := func(destination *hubble.Endpoint, destIP string, port uint16) *hubble.ParsedFlow {
+		parsed, err := hubble.ParseFlow(&hubble.Flow{
+			Source:      &hubble.Endpoint{Labels: []string{"k8s:app=operator"}, Namespace: "ops"},
+			Destination: destination,
+			IP:          &hubble.IP{Source: "10.0.1.5", Destination: destIP},
+			L4:          &hubble.Layer4{TCP: &hubble.TCP{DestinationPort: port}},
+			Verdict:     "FORWARDED",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+
+	flows := []*hubble.ParsedFlow{
+		newFlow(&hubble.Endpoint{Labels: []string{"reserved:kube-apiserver"}, Identity: hubble.IdentityKubeAPIServer}, "10.96.0.1", 443),
+		newFlow(&hubble.Endpoint{Identity: hubble.IdentityKubeAPIServer}, "172.18.0.2", 6443),
+		newFlow(&hubble.Endpoint{Labels: []string{"reserved:host"}, Identity: hubble.IdentityHost}, "172.18.0.3", 10250),
+	}
+
+	policies, err := SynthesizePolicies(flows)
+	if err != nil {
+		t.Fatalf("SynthesizePolicies() error = %v", err)
+	}
+	if len(policies) != 1 {
+		t.Fatalf("Expected 1 policy for the operator, got %d", len(policies))
+	}
+
+	var entityRules []EgressRule
+	for _, rule := range policies[0].Spec.Egress {
+		if len(rule.ToCIDR) > 0 {
+			t.Errorf("Expected no toCIDR rule for in-cluster entities, got %+v", rule)
+		}
+		if len(rule.ToEntities) > 0 {
+			entityRules = append(entityRules, rule)
+		}
+	}
+
+	expected := []EgressRule{
+		{
+			ToEntities: []string{"host"},
+			ToPorts:    []PortRule{{Ports: []PortProtocol{{Port: "10250", Protocol: "TCP"}}}},
+		},
+		{
+			ToEntities: []string{"kube-apiserver"},
+			ToPorts: []PortRule{{Ports: []PortProtocol{
+				{Port: "443", Protocol: "TCP"},
+				{Port: "6443", Protocol: "TCP"},
+			}}},
+		},
+	}
+	if !reflect.DeepEqual(entityRules, expected) {
+		t.Errorf("toEntities rules = %+v, want %+v", entityRules, expected)
+	}
+}
+
+func TestSynthesizePoliciesFQDNEgressDNSRules(t *testing.T) {
+	flow := externalFlow("140.82.112.6", 443)
+	flow.DestDNSName = "api.github.com"
+
+	policies, err := SynthesizePolicies([]*hubble.ParsedFlow{flow})
+	if err != nil {
+		t.Fatalf("SynthesizePolicies() error = %v", err)
+	}
+	var buf bytes.Buffer
+	if err := WritePolicies(&buf, policies); err != nil {
+		t.Fatalf("WritePolicies() error = %v", err)
+	}
+
+	// Cilium only resolves toFQDNs names from queries its DNS proxy sees,
+	// so every port-53 rule must carry rules.dns
+	var doc struct {
+		Spec struct {
+			Egress []struct {
+				ToFQDNs []map[string]string `yaml:"toFQDNs"`
+				ToPorts []struct {
+					Ports []map[string]string `yaml:"ports"`
+					Rules struct {
+						DNS []map[string]string `yaml:"dns"`
+					} `yaml:"rules"`
+				} `yaml:"toPorts"`
+			} `yaml:"egress"`
+		} `yaml:"spec"`
+	}
+	if err := yaml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("yaml.Unmarshal() error = %v\n%s", err, buf.String())
+	}
+
+	dnsRules, fqdnRules := 0, 0
+	for _, rule := range doc.Spec.Egress {
+		if len(rule.ToFQDNs) > 0 {
+			fqdnRules++
+		}
+		for _, portRule := range rule.ToPorts {
+			if len(portRule.Ports) == 0 || portRule.Ports[0]["port"] != "53" {
+				continue
+			}
+			dnsRules++
+			if want := []map[string]string{{"matchPattern": "*"}}; !reflect.DeepEqual(portRule.Rules.DNS, want) {
+				t.Errorf("port 53 rules.dns = %v, want %v in:\n%s", portRule.Rules.DNS, want, buf.String())
+			}
+		}
+	}
+	if fqdnRules != 1 || dnsRules == 0 {
+		t.Errorf("Expected a toFQDNs rule and port 53 rules, got %d and %d in:\n%s", fqdnRules, dnsRules, buf.String())
+	}
+}
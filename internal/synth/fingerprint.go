@@ -0,0 +1,163 @@
+package synth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"slices"
+	"sort"
+
+	"github.com/prabhakaran-jm/cilium-policypilot/internal/hubble"
+)
+
+// AnnotationFingerprint is the policy's Fingerprint, set with the other
+// provenance annotations so GitOps tooling can tell whether a regenerated
+// policy changed
+const AnnotationFingerprint = "policypilot.io/fingerprint"
+
+// Fingerprint returns a short hash of the policy's endpoint selector and
+// rules. Policies that allow the same traffic through the same rules get
+// the same fingerprint whatever the order of their labels, peers, ports and
+// rules; metadata such as names and provenance annotations is left out.
+func (p *Policy) Fingerprint() string {
+	spec := canonicalSpec(p.Spec)
+	data, _ := json.Marshal(struct {
+		EndpointSelector EndpointSelector `json:"endpointSelector"`
+		Ingress          []IngressRule    `json:"ingress"`
+		Egress           []EgressRule     `json:"egress"`
+		// A direction is default-deny when it has rules or default deny is
+		// enabled; an empty rule list, like a missing one, enforces nothing
+		IngressEnforced bool `json:"ingressEnforced"`
+		EgressEnforced  bool `json:"egressEnforced"`
+	}{
+		EndpointSelector: spec.EndpointSelector,
+		Ingress:          spec.Ingress,
+		Egress:           spec.Egress,
+		IngressEnforced:  p.Spec.EnforcesIngress(),
+		EgressEnforced:   p.Spec.EnforcesEgress(),
+	})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// canonicalSpec returns a copy of spec with every list sorted and
+// deduplicated and protocols and ICMP families spelled out
+func canonicalSpec(spec PolicySpec) PolicySpec {
+	result := PolicySpec{EndpointSelector: canonicalSelector(spec.EndpointSelector)}
+
+	ingress := make([]IngressRule, 0, len(spec.Ingress))
+	for _, rule := range spec.Ingress {
+		ingress = append(ingress, IngressRule{
+			FromEndpoints: canonicalSelectors(rule.FromEndpoints),
+			FromEntities:  sortedByJSON(rule.FromEntities),
+			FromCIDR:      sortedByJSON(rule.FromCIDR),
+			ToPorts:       canonicalPortRules(rule.ToPorts),
+			ICMPs:         canonicalICMPRules(rule.ICMPs),
+		})
+	}
+	result.Ingress = sortedByJSON(ingress)
+
+	egress := make([]EgressRule, 0, len(spec.Egress))
+	for _, rule := range spec.Egress {
+		egress = append(egress, EgressRule{
+			ToEndpoints: canonicalSelectors(rule.ToEndpoints),
+			ToFQDNs:     sortedByJSON(rule.ToFQDNs),
+			ToEntities:  sortedByJSON(rule.ToEntities),
+			ToCIDR:      sortedByJSON(rule.ToCIDR),
+			ToPorts:     canonicalPortRules(rule.ToPorts),
+			ICMPs:       canonicalICMPRules(rule.ICMPs),
+		})
+	}
+	result.Egress = sortedByJSON(egress)
+	return result
+}
+
+// canonicalSelector returns a copy of selector with sorted expressions and
+// values; an empty matchLabels map becomes nil
+func canonicalSelector(selector EndpointSelector) EndpointSelector {
+	result := EndpointSelector{}
+	if len(selector.MatchLabels) > 0 {
+		result.MatchLabels = selector.MatchLabels
+	}
+	expressions := make([]MatchExpression, 0, len(selector.MatchExpressions))
+	for _, expression := range selector.MatchExpressions {
+		expression.Values = sortedByJSON(expression.Values)
+		expressions = append(expressions, expression)
+	}
+	result.MatchExpressions = sortedByJSON(expressions)
+	return result
+}
+
+func canonicalSelectors(selectors []EndpointSelector) []EndpointSelector {
+	result := make([]EndpointSelector, 0, len(selectors))
+	for _, selector := range selectors {
+		result = append(result, canonicalSelector(selector))
+	}
+	return sortedByJSON(result)
+}
+
+// canonicalPortRules sorts port rules, their ports and their HTTP rules. An
+// empty protocol is written as ANY, which Cilium assumes for it.
+func canonicalPortRules(portRules []PortRule) []PortRule {
+	result := make([]PortRule, 0, len(portRules))
+	for _, portRule := range portRules {
+		ports := make([]PortProtocol, 0, len(portRule.Ports))
+		for _, port := range portRule.Ports {
+			port.Protocol = hubble.NormalizeProtocol(port.Protocol)
+			if port.Protocol == "" {
+				port.Protocol = "ANY"
+			}
+			ports = append(ports, port)
+		}
+
+		canonical := PortRule{Ports: sortedByJSON(ports)}
+		if portRule.Rules != nil && len(portRule.Rules.HTTP)+len(portRule.Rules.DNS) > 0 {
+			canonical.Rules = &L7Rules{HTTP: sortedByJSON(portRule.Rules.HTTP), DNS: sortedByJSON(portRule.Rules.DNS)}
+		}
+		result = append(result, canonical)
+	}
+	return sortedByJSON(result)
+}
+
+// canonicalICMPRules sorts ICMP rules and their fields, spelling out the
+// default IPv4 family
+func canonicalICMPRules(icmps []ICMPRule) []ICMPRule {
+	result := make([]ICMPRule, 0, len(icmps))
+	for _, icmp := range icmps {
+		fields := make([]ICMPField, 0, len(icmp.Fields))
+		for _, field := range icmp.Fields {
+			if field.Family == "" {
+				field.Family = "IPv4"
+			}
+			fields = append(fields, field)
+		}
+		result = append(result, ICMPRule{Fields: sortedByJSON(fields)})
+	}
+	return sortedByJSON(result)
+}
+
+// sortedByJSON returns items sorted by their JSON encoding, without
+// duplicates, or nil if there are none. Maps encode with sorted keys, so
+// items differing only in map order compare equal.
+func sortedByJSON[T any](items []T) []T {
+	if len(items) == 0 {
+		return nil
+	}
+	type encoded struct {
+		key  string
+		item T
+	}
+	entries := make([]encoded, 0, len(items))
+	for _, item := range items {
+		data, _ := json.Marshal(item)
+		entries = append(entries, encoded{string(data), item})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].key < entries[j].key })
+	entries = slices.CompactFunc(entries, func(a, b encoded) bool { return a.key == b.key })
+
+	result := make([]T, 0, len(entries))
+	for _, entry := range entries {
+		result = append(result, entry.item)
+	}
+	return result
+}
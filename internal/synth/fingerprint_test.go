@@ -0,0 +1,151 @@
+package synth
+
+import (
+	"testing"
+)
+
+func TestPolicyFingerprint(t *testing.T) {
+	// labels builds the map in the given order, so maps with the same
+	// entries are built in different insertion orders
+	labels := func(pairs ...string) map[string]string {
+		m := make(map[string]string)
+		for i := 0; i < len(pairs); i += 2 {
+			m[pairs[i]] = pairs[i+1]
+		}
+		return m
+	}
+	catalog := func() *Policy {
+		policy := mergeTestPolicy("shop", []IngressRule{
+			{
+				FromEndpoints: []EndpointSelector{
+					{MatchLabels: labels("k8s:app", "frontend", "k8s:tier", "web")},
+					{MatchLabels: labels("k8s:app", "checkout")},
+				},
+				ToPorts: []PortRule{{Ports: []PortProtocol{{Port: "8080", Protocol: "TCP"}, {Port: "9090", Protocol: "TCP"}}}},
+			},
+			{FromEntities: []string{"host", "remote-node"}},
+		}, []EgressRule{{
+			ToFQDNs: []FQDNSelector{{MatchName: "api.example.com"}, {MatchPattern: "*.example.org"}},
+			ToPorts: []PortRule{{Ports: []PortProtocol{{Port: "443", Protocol: "TCP"}}}},
+		}})
+		policy.Spec.EndpointSelector.MatchExpressions = []MatchExpression{
+			{Key: "k8s:tier", Operator: "In", Values: []string{"backend", "api"}},
+			{Key: "k8s:canary", Operator: "DoesNotExist"},
+		}
+		return policy
+	}
+
+	reordered := mergeTestPolicy("shop", []IngressRule{
+		{FromEntities: []string{"remote-node", "host"}},
+		{
+			FromEndpoints: []EndpointSelector{
+				{MatchLabels: labels("k8s:app", "checkout")},
+				{MatchLabels: labels("k8s:tier", "web", "k8s:app", "frontend")},
+			},
+			ToPorts: []PortRule{{Ports: []PortProtocol{{Port: "9090", Protocol: "tcp"}, {Port: "8080", Protocol: "TCP"}}}},
+		},
+	}, []EgressRule{{
+		ToFQDNs: []FQDNSelector{{MatchPattern: "*.example.org"}, {MatchName: "api.example.com"}},
+		ToPorts: []PortRule{{Ports: []PortProtocol{{Port: "443", Protocol: "TCP"}}}},
+	}})
+	reordered.Spec.EndpointSelector.MatchExpressions = []MatchExpression{
+		{Key: "k8s:canary", Operator: "DoesNotExist"},
+		{Key: "k8s:tier", Operator: "In", Values: []string{"api", "backend"}},
+	}
+	reordered.Metadata = PolicyMetadata{
+		Name:        "catalog",
+		Namespace:   "staging",
+		Annotations: map[string]string{AnnotationGeneratedAt: "2025-03-01T11:30:00Z"},
+	}
+
+	want := catalog().Fingerprint()
+	if len(want) != 16 {
+		t.Errorf("Fingerprint() = %q, want 16 hex digits", want)
+	}
+	for i := 0; i < 20; i++ {
+		if got := catalog().Fingerprint(); got != want {
+			t.Fatalf("Fingerprint() = %s on run %d, want %s", got, i, want)
+		}
+	}
+	if got := reordered.Fingerprint(); got != want {
+		t.Errorf("Fingerprint() of the reordered policy = %s, want %s", got, want)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*Policy)
+	}{
+		{name: "selector", modify: func(p *Policy) { p.Spec.EndpointSelector.MatchLabels["k8s:app"] = "cart" }},
+		{name: "port", modify: func(p *Policy) { p.Spec.Ingress[0].ToPorts[0].Ports[1].Port = "9091" }},
+		{name: "port range", modify: func(p *Policy) { p.Spec.Ingress[0].ToPorts[0].Ports[1].EndPort = 9099 }},
+		{name: "peer", modify: func(p *Policy) { p.Spec.Ingress[1].FromEntities = []string{"host"} }},
+		{name: "rule moved to egress", modify: func(p *Policy) {
+			p.Spec.Egress = append(p.Spec.Egress, EgressRule{ToEntities: p.Spec.Ingress[1].FromEntities})
+			p.Spec.Ingress = p.Spec.Ingress[:1]
+		}},
+		{name: "HTTP rule", modify: func(p *Policy) {
+			p.Spec.Ingress[0].ToPorts[0].Rules = &L7Rules{HTTP: []PortRuleHTTP{{Method: "GET"}}}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := catalog()
+			tt.modify(policy)
+			if got := policy.Fingerprint(); got == want {
+				t.Errorf("Fingerprint() = %s, want it to change", got)
+			}
+		})
+	}
+}
+
+func TestPolicyFingerprintDefaults(t *testing.T) {
+	tests := []struct {
+		name     string
+		a, b     *Policy
+		expected bool
+	}{
+		{
+			name:     "empty protocol is ANY",
+			a:        mergeTestPolicy("shop", []IngressRule{{ToPorts: []PortRule{{Ports: []PortProtocol{{Port: "53"}}}}}}, nil),
+			b:        mergeTestPolicy("shop", []IngressRule{{ToPorts: []PortRule{{Ports: []PortProtocol{{Port: "53", Protocol: "ANY"}}}}}}, nil),
+			expected: true,
+		},
+		{
+			name:     "empty ICMP family is IPv4",
+			a:        mergeTestPolicy("shop", []IngressRule{{ICMPs: []ICMPRule{{Fields: []ICMPField{{Type: 8}}}}}}, nil),
+			b:        mergeTestPolicy("shop", []IngressRule{{ICMPs: []ICMPRule{{Fields: []ICMPField{{Family: "IPv4", Type: 8}}}}}}, nil),
+			expected: true,
+		},
+		{
+			name:     "duplicate rules",
+			a:        mergeTestPolicy("shop", []IngressRule{{FromEntities: []string{"host"}}}, nil),
+			b:        mergeTestPolicy("shop", []IngressRule{{FromEntities: []string{"host"}}, {FromEntities: []string{"host", "host"}}}, nil),
+			expected: true,
+		},
+		{
+			name:     "empty ingress list enforces nothing",
+			a:        mergeTestPolicy("shop", nil, nil),
+			b:        mergeTestPolicy("shop", []IngressRule{}, nil),
+			expected: true,
+		},
+		{
+			name: "default deny enforces both directions",
+			a:    mergeTestPolicy("shop", nil, nil),
+			b: func() *Policy {
+				p := mergeTestPolicy("shop", nil, nil)
+				p.Spec.EnableDefaultDeny = &DefaultDenyConfig{Ingress: true, Egress: true}
+				return p
+			}(),
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.a.Fingerprint() == tt.b.Fingerprint(); got != tt.expected {
+				t.Errorf("Fingerprints equal = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
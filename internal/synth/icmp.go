@@ -0,0 +1,41 @@
+package synth
+
+import (
+	"sort"
+
+	"github.com/prabhakaran-jm/cilium-policypilot/internal/hubble"
+)
+
+// icmpFieldFor returns the ICMP field matching an ICMP flow's message type
+func icmpFieldFor(flow *hubble.ParsedFlow) ICMPField {
+	field := ICMPField{Type: flow.ICMPType}
+	if flow.Protocol == "ICMPv6" {
+		field.Family = "IPv6"
+	}
+	return field
+}
+
+// addICMPField appends field to fields if not already present
+func addICMPField(fields []ICMPField, field ICMPField) []ICMPField {
+	for _, existing := range fields {
+		if existing == field {
+			return fields
+		}
+	}
+	return append(fields, field)
+}
+
+// icmpRulesFor wraps fields in a single sorted ICMPRule, or returns nil if
+// there are none
+func icmpRulesFor(fields []ICMPField) []ICMPRule {
+	if len(fields) == 0 {
+		return nil
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		if fields[i].Family != fields[j].Family {
+			return fields[i].Family < fields[j].Family
+		}
+		return fields[i].Type < fields[j].Type
+	})
+	return []ICMPRule{{Fields: fields}}
+}
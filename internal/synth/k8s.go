@@ -0,0 +1,356 @@
+package synth
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// k8sNamespaceNameLabel is the label Kubernetes sets on every namespace
+const k8sNamespaceNameLabel = "kubernetes.io/metadata.name"
+
+// NetworkPolicy represents a Kubernetes networking.k8s.io/v1 NetworkPolicy
+type NetworkPolicy struct {
+	APIVersion string            `yaml:"apiVersion"`
+	Kind       string            `yaml:"kind"`
+	Metadata   PolicyMetadata    `yaml:"metadata"`
+	Spec       NetworkPolicySpec `yaml:"spec"`
+}
+
+// NetworkPolicySpec contains the NetworkPolicy specification
+type NetworkPolicySpec struct {
+	PodSelector LabelSelector              `yaml:"podSelector"`
+	PolicyTypes []string                   `yaml:"policyTypes,omitempty"`
+	Ingress     []NetworkPolicyIngressRule `yaml:"ingress,omitempty"`
+	Egress      []NetworkPolicyEgressRule  `yaml:"egress,omitempty"`
+}
+
+// LabelSelector is a Kubernetes label selector. An empty selector matches everything.
+type LabelSelector struct {
+	MatchLabels      map[string]string          `yaml:"matchLabels,omitempty"`
+	MatchExpressions []LabelSelectorRequirement `yaml:"matchExpressions,omitempty"`
+}
+
+// LabelSelectorRequirement is a set-based label selector requirement
+type LabelSelectorRequirement struct {
+	Key      string   `yaml:"key"`
+	Operator string   `yaml:"operator"`
+	Values   []string `yaml:"values,omitempty"`
+}
+
+// NetworkPolicyIngressRule defines a NetworkPolicy ingress rule
+type NetworkPolicyIngressRule struct {
+	From  []NetworkPolicyPeer `yaml:"from,omitempty"`
+	Ports []NetworkPolicyPort `yaml:"ports,omitempty"`
+}
+
+// NetworkPolicyEgressRule defines a NetworkPolicy egress rule
+type NetworkPolicyEgressRule struct {
+	To    []NetworkPolicyPeer `yaml:"to,omitempty"`
+	Ports []NetworkPolicyPort `yaml:"ports,omitempty"`
+}
+
+// NetworkPolicyPeer selects the pods, namespaces, or IP blocks a rule applies to
+type NetworkPolicyPeer struct {
+	PodSelector       *LabelSelector `yaml:"podSelector,omitempty"`
+	NamespaceSelector *LabelSelector `yaml:"namespaceSelector,omitempty"`
+	IPBlock           *IPBlock       `yaml:"ipBlock,omitempty"`
+}
+
+// IPBlock selects a CIDR range
+type IPBlock struct {
+	CIDR   string   `yaml:"cidr"`
+	Except []string `yaml:"except,omitempty"`
+}
+
+// NetworkPolicyPort defines a port and protocol
+type NetworkPolicyPort struct {
+	Protocol string    `yaml:"protocol,omitempty"`
+	Port     PortValue `yaml:"port,omitempty"`
+	EndPort  int       `yaml:"endPort,omitempty"`
+}
+
+// PortValue is a port number or named port. Numeric values are emitted as
+// YAML integers, matching the Kubernetes IntOrString encoding.
+type PortValue string
+
+// MarshalYAML implements yaml.Marshaler
+func (p PortValue) MarshalYAML() (interface{}, error) {
+	if n, err := strconv.Atoi(string(p)); err == nil {
+		return n, nil
+	}
+	return string(p), nil
+}
+
+// ConvertToNetworkPolicy translates a CiliumNetworkPolicy into a Kubernetes
+// NetworkPolicy. Cilium label keys are stripped of their "k8s:" source prefix
+// and the namespace label becomes a namespaceSelector. Constructs NetworkPolicy
+// cannot express (toFQDNs, fromEntities, non-k8s labels) are dropped.
+func ConvertToNetworkPolicy(policy *Policy) *NetworkPolicy {
+	np, _ := ConvertToNetworkPolicyWithWarnings(policy)
+	return np
+}
+
+// ConvertToNetworkPolicyWithWarnings is like ConvertToNetworkPolicy but also
+// describes each construct that was dropped or approximated
+func ConvertToNetworkPolicyWithWarnings(policy *Policy) (*NetworkPolicy, []string) {
+	var warnings []string
+	warnDropped := func(field string, selector EndpointSelector) {
+		if dropped := nonK8sLabels(selector.MatchLabels); len(dropped) > 0 {
+			warnings = append(warnings, fmt.Sprintf("%s: labels %s have no Kubernetes equivalent and were dropped, widening the selector", field, strings.Join(dropped, ", ")))
+		}
+		if _, _, dropped := toK8sExpressions(selector.MatchExpressions); len(dropped) > 0 {
+			warnings = append(warnings, fmt.Sprintf("%s: matchExpressions on %s have no Kubernetes equivalent and were dropped, widening the selector", field, strings.Join(dropped, ", ")))
+		}
+	}
+
+	podLabels, namespace := toK8sLabels(policy.Spec.EndpointSelector.MatchLabels)
+	podExpressions, namespaceExpressions, _ := toK8sExpressions(policy.Spec.EndpointSelector.MatchExpressions)
+	warnDropped("endpointSelector", policy.Spec.EndpointSelector)
+	if len(namespaceExpressions) > 0 {
+		warnings = append(warnings, "endpointSelector: namespace matchExpressions cannot be expressed; the NetworkPolicy only applies to the namespace it is created in")
+	}
+
+	np := &NetworkPolicy{
+		APIVersion: "networking.k8s.io/v1",
+		Kind:       "NetworkPolicy",
+		Metadata:   policy.Metadata,
+		Spec: NetworkPolicySpec{
+			PodSelector: LabelSelector{MatchLabels: podLabels, MatchExpressions: podExpressions},
+		},
+	}
+
+	if policy.Kind == "CiliumClusterwideNetworkPolicy" {
+		if namespace != "" {
+			np.Metadata.Namespace = namespace
+			warnings = append(warnings, fmt.Sprintf("cluster-wide policy converted to a NetworkPolicy in namespace '%s'", namespace))
+		} else {
+			warnings = append(warnings, "cluster-wide policy selects endpoints in all namespaces; the NetworkPolicy only applies to the namespace it is created in")
+		}
+	}
+
+	for i, rule := range policy.Spec.Ingress {
+		field := fmt.Sprintf("ingress[%d]", i)
+
+		// NetworkPolicy has no ICMP; the rule's empty port list would
+		// otherwise allow every port
+		if len(rule.ICMPs) > 0 {
+			warnings = append(warnings, fmt.Sprintf("%s: icmps cannot be expressed; rule dropped", field))
+			continue
+		}
+
+		// fromEntities has no NetworkPolicy equivalent; dropping only its
+		// peers would widen the rule to all sources, so drop the whole rule.
+		// The "all" entity is the one exception: it is a rule without peers.
+		allSources := false
+		if len(rule.FromEntities) > 0 {
+			if !slices.Contains(rule.FromEntities, "all") {
+				warnings = append(warnings, fmt.Sprintf("%s: fromEntities %v cannot be expressed; rule dropped", field, rule.FromEntities))
+				continue
+			}
+			allSources = true
+		}
+
+		// An empty Cilium rule allows nothing, while an empty NetworkPolicy
+		// rule allows everything
+		if !allSources && len(rule.FromEndpoints) == 0 && len(rule.FromCIDR) == 0 && len(rule.ToPorts) == 0 {
+			continue
+		}
+
+		npRule := NetworkPolicyIngressRule{
+			Ports: toNetworkPolicyPorts(rule.ToPorts),
+		}
+		if !allSources {
+			for j, ep := range rule.FromEndpoints {
+				npRule.From = append(npRule.From, toNetworkPolicyPeer(ep))
+				warnDropped(fmt.Sprintf("%s.fromEndpoints[%d]", field, j), ep)
+			}
+			for _, cidr := range rule.FromCIDR {
+				npRule.From = append(npRule.From, NetworkPolicyPeer{IPBlock: &IPBlock{CIDR: cidr}})
+			}
+		}
+		warnings = append(warnings, l7Warnings(field, rule.ToPorts)...)
+		np.Spec.Ingress = append(np.Spec.Ingress, npRule)
+	}
+
+	for i, rule := range policy.Spec.Egress {
+		field := fmt.Sprintf("egress[%d]", i)
+
+		if len(rule.ICMPs) > 0 {
+			warnings = append(warnings, fmt.Sprintf("%s: icmps cannot be expressed; rule dropped", field))
+			continue
+		}
+
+		// toFQDNs has no NetworkPolicy equivalent; dropping only its peers
+		// would widen the rule to all destinations, so drop the whole rule
+		if len(rule.ToFQDNs) > 0 {
+			warnings = append(warnings, fmt.Sprintf("%s: toFQDNs cannot be expressed; rule dropped", field))
+			continue
+		}
+
+		allDestinations := false
+		if len(rule.ToEntities) > 0 {
+			if !slices.Contains(rule.ToEntities, "all") {
+				warnings = append(warnings, fmt.Sprintf("%s: toEntities %v cannot be expressed; rule dropped", field, rule.ToEntities))
+				continue
+			}
+			allDestinations = true
+		}
+
+		if !allDestinations && len(rule.ToEndpoints) == 0 && len(rule.ToCIDR) == 0 && len(rule.ToPorts) == 0 {
+			continue
+		}
+
+		npRule := NetworkPolicyEgressRule{
+			Ports: toNetworkPolicyPorts(rule.ToPorts),
+		}
+		if !allDestinations {
+			for j, ep := range rule.ToEndpoints {
+				npRule.To = append(npRule.To, toNetworkPolicyPeer(ep))
+				warnDropped(fmt.Sprintf("%s.toEndpoints[%d]", field, j), ep)
+			}
+			for _, cidr := range rule.ToCIDR {
+				npRule.To = append(npRule.To, NetworkPolicyPeer{IPBlock: &IPBlock{CIDR: cidr}})
+			}
+		}
+		warnings = append(warnings, l7Warnings(field, rule.ToPorts)...)
+		np.Spec.Egress = append(np.Spec.Egress, npRule)
+	}
+
+	// A Cilium policy with an ingress or egress section isolates that
+	// direction even if none of its rules survived the conversion
+	if len(policy.Spec.Ingress) > 0 {
+		np.Spec.PolicyTypes = append(np.Spec.PolicyTypes, "Ingress")
+	}
+	if len(policy.Spec.Egress) > 0 {
+		np.Spec.PolicyTypes = append(np.Spec.PolicyTypes, "Egress")
+	}
+
+	return np, warnings
+}
+
+// l7Warnings reports L7 rules, which NetworkPolicy cannot express; their
+// ports are kept, so all traffic on them is allowed
+func l7Warnings(field string, portRules []PortRule) []string {
+	var warnings []string
+	for i, portRule := range portRules {
+		if portRule.Rules != nil && len(portRule.Rules.HTTP) > 0 {
+			warnings = append(warnings, fmt.Sprintf("%s.toPorts[%d]: HTTP rules cannot be expressed; all traffic on the port is allowed", field, i))
+		}
+	}
+	return warnings
+}
+
+// nonK8sLabels returns the sorted keys toK8sLabels drops because they come
+// from a non-Kubernetes source, such as reserved:host
+func nonK8sLabels(labels map[string]string) []string {
+	var dropped []string
+	for key := range labels {
+		if source, _, found := strings.Cut(key, ":"); found && source != "k8s" {
+			dropped = append(dropped, key)
+		}
+	}
+	sort.Strings(dropped)
+	return dropped
+}
+
+// toNetworkPolicyPeer converts a Cilium endpoint selector to a NetworkPolicy peer
+func toNetworkPolicyPeer(selector EndpointSelector) NetworkPolicyPeer {
+	podLabels, namespace := toK8sLabels(selector.MatchLabels)
+	podExpressions, namespaceExpressions, _ := toK8sExpressions(selector.MatchExpressions)
+
+	peer := NetworkPolicyPeer{}
+	if namespace != "" || len(namespaceExpressions) > 0 {
+		peer.NamespaceSelector = &LabelSelector{MatchExpressions: namespaceExpressions}
+		if namespace != "" {
+			peer.NamespaceSelector.MatchLabels = map[string]string{k8sNamespaceNameLabel: namespace}
+		}
+	}
+	if len(podLabels) > 0 || len(podExpressions) > 0 || peer.NamespaceSelector == nil {
+		peer.PodSelector = &LabelSelector{MatchLabels: podLabels, MatchExpressions: podExpressions}
+	}
+	return peer
+}
+
+// toK8sExpressions converts Cilium match expressions to Kubernetes
+// requirements, splitting them into pod and namespace requirements like
+// toK8sLabels. It also returns the sorted keys of expressions dropped because
+// they come from a non-Kubernetes source.
+func toK8sExpressions(expressions []MatchExpression) (pod, namespace []LabelSelectorRequirement, dropped []string) {
+	for _, expr := range expressions {
+		req := LabelSelectorRequirement{Operator: expr.Operator, Values: expr.Values}
+
+		key := expr.Key
+		if key == ciliumNamespaceLabel {
+			req.Key = k8sNamespaceNameLabel
+			namespace = append(namespace, req)
+			continue
+		}
+		if name, found := strings.CutPrefix(key, ciliumNamespaceLabelsPrefix); found {
+			req.Key = name
+			namespace = append(namespace, req)
+			continue
+		}
+
+		if source, name, found := strings.Cut(key, ":"); found {
+			if source != "k8s" {
+				dropped = append(dropped, key)
+				continue
+			}
+			key = name
+		}
+		req.Key = key
+		pod = append(pod, req)
+	}
+	sort.Strings(dropped)
+	return pod, namespace, dropped
+}
+
+// toNetworkPolicyPorts flattens Cilium port rules into NetworkPolicy ports
+func toNetworkPolicyPorts(portRules []PortRule) []NetworkPolicyPort {
+	var ports []NetworkPolicyPort
+	for _, portRule := range portRules {
+		for _, pp := range portRule.Ports {
+			ports = append(ports, NetworkPolicyPort{
+				Protocol: pp.Protocol,
+				Port:     PortValue(pp.Port),
+				EndPort:  pp.EndPort,
+			})
+		}
+	}
+	return ports
+}
+
+// toK8sLabels converts Cilium labels to plain Kubernetes labels. The "k8s:"
+// source prefix is stripped, the namespace label is returned separately, and
+// labels from other sources (reserved:, cidr:, ...) are dropped since they
+// have no Kubernetes equivalent.
+func toK8sLabels(labels map[string]string) (map[string]string, string) {
+	result := make(map[string]string)
+	namespace := ""
+
+	for key, value := range labels {
+		if key == ciliumNamespaceLabel {
+			namespace = value
+			continue
+		}
+
+		if source, name, found := strings.Cut(key, ":"); found {
+			if source != "k8s" {
+				continue
+			}
+			key = name
+		}
+
+		// Cilium-internal labels are not set on the pod itself
+		if strings.HasPrefix(key, "io.cilium.k8s.") || strings.HasPrefix(key, "io.kubernetes.pod.") {
+			continue
+		}
+
+		result[key] = value
+	}
+
+	return result, namespace
+}
@@ -0,0 +1,139 @@
+package synth
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/prabhakaran-jm/cilium-policypilot/internal/hubble"
+	"gopkg.in/yaml.v3"
+)
+
+// upstreamNetworkPolicy mirrors the networking.k8s.io/v1 NetworkPolicy schema
+// so that strict decoding rejects any field the API server would not accept
+type upstreamNetworkPolicy struct {
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+	Metadata   struct {
+		Name      string `yaml:"name"`
+		Namespace string `yaml:"namespace"`
+	} `yaml:"metadata"`
+	Spec struct {
+		PodSelector upstreamLabelSelector `yaml:"podSelector"`
+		PolicyTypes []string              `yaml:"policyTypes"`
+		Ingress     []struct {
+			From  []upstreamPeer `yaml:"from"`
+			Ports []upstreamPort `yaml:"ports"`
+		} `yaml:"ingress"`
+		Egress []struct {
+			To    []upstreamPeer `yaml:"to"`
+			Ports []upstreamPort `yaml:"ports"`
+		} `yaml:"egress"`
+	} `yaml:"spec"`
+}
+
+type upstreamLabelSelector struct {
+	MatchLabels map[string]string `yaml:"matchLabels"`
+}
+
+type upstreamPeer struct {
+	PodSelector       *upstreamLabelSelector `yaml:"podSelector"`
+	NamespaceSelector *upstreamLabelSelector `yaml:"namespaceSelector"`
+	IPBlock           *struct {
+		CIDR   string   `yaml:"cidr"`
+		Except []string `yaml:"except"`
+	} `yaml:"ipBlock"`
+}
+
+type upstreamPort struct {
+	Protocol string      `yaml:"protocol"`
+	Port     interface{} `yaml:"port"`
+	EndPort  *int32      `yaml:"endPort"`
+}
+
+func TestConvertToNetworkPolicyRoundTrip(t *testing.T) {
+	flows := []*hubble.ParsedFlow{
+		{
+			SourceLabels:    map[string]string{"k8s:app": "frontend", "k8s:io.kubernetes.pod.namespace": "web"},
+			SourceNamespace: "web",
+			DestLabels:      map[string]string{"k8s:app": "catalog", "k8s:io.kubernetes.pod.namespace": "default"},
+			DestNamespace:   "default",
+			DestPort:        8080,
+			Protocol:        "TCP",
+		},
+	}
+
+	policies, err := SynthesizePoliciesWithOptions(flows, Options{})
+	if err != nil {
+		t.Fatalf("SynthesizePoliciesWithOptions() error = %v", err)
+	}
+	if len(policies) != 1 {
+		t.Fatalf("Expected 1 policy, got %d", len(policies))
+	}
+
+	data, err := yaml.Marshal(ConvertToNetworkPolicy(policies[0]))
+	if err != nil {
+		t.Fatalf("yaml.Marshal() error = %v", err)
+	}
+
+	var np upstreamNetworkPolicy
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&np); err != nil {
+		t.Fatalf("YAML does not match upstream NetworkPolicy shape: %v\n%s", err, data)
+	}
+
+	if np.APIVersion != "networking.k8s.io/v1" || np.Kind != "NetworkPolicy" {
+		t.Errorf("Unexpected apiVersion/kind: %s/%s", np.APIVersion, np.Kind)
+	}
+	if np.Metadata.Namespace != "default" {
+		t.Errorf("Expected namespace 'default', got '%s'", np.Metadata.Namespace)
+	}
+	if len(np.Spec.PodSelector.MatchLabels) != 1 || np.Spec.PodSelector.MatchLabels["app"] != "catalog" {
+		t.Errorf("Expected podSelector {app: catalog}, got %v", np.Spec.PodSelector.MatchLabels)
+	}
+	if len(np.Spec.PolicyTypes) != 2 || np.Spec.PolicyTypes[0] != "Ingress" || np.Spec.PolicyTypes[1] != "Egress" {
+		t.Errorf("Expected policyTypes [Ingress Egress], got %v", np.Spec.PolicyTypes)
+	}
+
+	if len(np.Spec.Ingress) != 1 || len(np.Spec.Ingress[0].From) != 1 {
+		t.Fatalf("Expected 1 ingress rule with 1 peer, got %+v", np.Spec.Ingress)
+	}
+	peer := np.Spec.Ingress[0].From[0]
+	if peer.PodSelector == nil || peer.PodSelector.MatchLabels["app"] != "frontend" {
+		t.Errorf("Expected podSelector {app: frontend}, got %+v", peer.PodSelector)
+	}
+	if _, exists := peer.PodSelector.MatchLabels["k8s:app"]; exists {
+		t.Errorf("Expected k8s: prefix to be stripped, got %v", peer.PodSelector.MatchLabels)
+	}
+	if peer.NamespaceSelector == nil || peer.NamespaceSelector.MatchLabels["kubernetes.io/metadata.name"] != "web" {
+		t.Errorf("Expected namespaceSelector for 'web', got %+v", peer.NamespaceSelector)
+	}
+
+	ports := np.Spec.Ingress[0].Ports
+	if len(ports) != 1 || ports[0].Port != 8080 || ports[0].Protocol != "TCP" {
+		t.Errorf("Expected port 8080/TCP as an integer, got %+v", ports)
+	}
+}
+
+func TestToK8sLabels(t *testing.T) {
+	labels, namespace := toK8sLabels(map[string]string{
+		"k8s:app":                          "frontend",
+		"k8s:io.kubernetes.pod.namespace":  "web",
+		"k8s:io.cilium.k8s.policy.cluster": "default",
+		"reserved:host":                    "",
+		"tier":                             "web",
+	})
+
+	if namespace != "web" {
+		t.Errorf("namespace = %s, want web", namespace)
+	}
+	expected := map[string]string{"app": "frontend", "tier": "web"}
+	if len(labels) != len(expected) {
+		t.Errorf("toK8sLabels() = %v, want %v", labels, expected)
+	}
+	for k, v := range expected {
+		if labels[k] != v {
+			t.Errorf("toK8sLabels()[%s] = %s, want %s", k, labels[k], v)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package synth
+
+import (
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/prabhakaran-jm/cilium-policypilot/internal/hubble"
+)
+
+// preferredSelectorKeys lists label keys (without their "k8s:" source
+// prefix) that identify a workload most stably, best first
+var preferredSelectorKeys = []string{
+	"app.kubernetes.io/name",
+	"app",
+	"k8s-app",
+	"name",
+	"app.kubernetes.io/component",
+	"component",
+	"app.kubernetes.io/part-of",
+	"app.kubernetes.io/instance",
+	"tier",
+	"role",
+}
+
+// selectorLabels returns the labels that select an endpoint: those with one
+// of opts.LabelKeys if set, otherwise all but noise labels such as
+// pod-template-hash (see ignoredLabelPrefixes), capped at
+// opts.MaxSelectorLabels. An endpoint with none of the chosen keys keeps its
+// labels rather than being widened to its whole namespace.
+func selectorLabels(labels map[string]string, opts Options) map[string]string {
+	ignored := ignoredLabelPrefixes(opts)
+	if stable := filterSelectorLabels(labels, func(key string) bool {
+		return !hubble.IsIgnoredLabel(key, ignored)
+	}); stable != nil {
+		labels = stable
+	}
+
+	if len(opts.LabelKeys) > 0 {
+		wanted := make(map[string]bool, len(opts.LabelKeys))
+		for _, key := range opts.LabelKeys {
+			wanted[labelKeyName(key)] = true
+		}
+		if chosen := filterSelectorLabels(labels, func(key string) bool {
+			return wanted[key]
+		}); chosen != nil {
+			labels = chosen
+		}
+	}
+
+	return limitSelectorLabels(labels, opts.MaxSelectorLabels)
+}
+
+// ignoredLabelPrefixes returns the label key prefixes left out of
+// selectors: hubble.DefaultIgnoredLabelPrefixes plus opts.IgnoreLabelPrefixes
+func ignoredLabelPrefixes(opts Options) []string {
+	return append(slices.Clone(hubble.DefaultIgnoredLabelPrefixes), opts.IgnoreLabelPrefixes...)
+}
+
+// filterSelectorLabels returns the labels whose key, without its source
+// prefix, satisfies keep. The namespace label and reserved labels are always
+// kept. It returns nil if no other label is kept.
+func filterSelectorLabels(labels map[string]string, keep func(key string) bool) map[string]string {
+	result := make(map[string]string, len(labels))
+	kept := false
+	for key, value := range labels {
+		switch {
+		case key == ciliumNamespaceLabel || strings.HasPrefix(key, "reserved:"):
+			result[key] = value
+		case keep(labelKeyName(key)):
+			result[key] = value
+			kept = true
+		}
+	}
+	if !kept {
+		return nil
+	}
+	return result
+}
+
+// labelKeyName strips the source prefix, e.g. "k8s:", from a label key
+func labelKeyName(key string) string {
+	if _, name, found := strings.Cut(key, ":"); found {
+		return name
+	}
+	return key
+}
+
+// limitSelectorLabels returns at most max labels, keeping the most stable
+// keys (see selectorKeyRank). The namespace label is always kept and does not
+// count towards max, since dropping it would widen the selector to every
+// namespace. max <= 0 returns labels unchanged.
+func limitSelectorLabels(labels map[string]string, max int) map[string]string {
+	if max <= 0 || len(labels) <= max {
+		return labels
+	}
+
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		if key != ciliumNamespaceLabel {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) <= max {
+		return labels
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		ri, rj := selectorKeyRank(keys[i]), selectorKeyRank(keys[j])
+		if ri != rj {
+			return ri < rj
+		}
+		return keys[i] < keys[j]
+	})
+
+	result := make(map[string]string, max+1)
+	for _, key := range keys[:max] {
+		result[key] = labels[key]
+	}
+	if ns, exists := labels[ciliumNamespaceLabel]; exists {
+		result[ciliumNamespaceLabel] = ns
+	}
+	return result
+}
+
+// selectorKeyRank orders label keys for selectors: preferred keys in list
+// order, then all other keys, then keys of hubble.DefaultIgnoredLabelPrefixes,
+// which change on every rollout or per pod and are the first to go when a
+// selector is capped
+func selectorKeyRank(key string) int {
+	key = labelKeyName(key)
+	for i, preferred := range preferredSelectorKeys {
+		if key == preferred {
+			return i
+		}
+	}
+	if hubble.IsIgnoredLabel(key, hubble.DefaultIgnoredLabelPrefixes) {
+		return len(preferredSelectorKeys) + 1
+	}
+	return len(preferredSelectorKeys)
+}
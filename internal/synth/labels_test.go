@@ -0,0 +1,218 @@
+package synth
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/prabhakaran-jm/cilium-policypilot/internal/hubble"
+)
+
+func TestLimitSelectorLabels(t *testing.T) {
+	labels := map[string]string{
+		"k8s:pod-template-hash":             "5d8f7c6b9",
+		"k8s:version":                       "v2",
+		"k8s:app":                           "catalog",
+		"k8s:app.kubernetes.io/name":        "catalog",
+		"k8s:tier":                          "backend",
+		"k8s:io.kubernetes.pod.namespace":   "shop",
+		"k8s:io.cilium.k8s.policy.cluster":  "default",
+		"k8s:controller-revision-hash":      "abc",
+		"k8s:app.kubernetes.io/managed-by":  "helm",
+		"k8s:app.kubernetes.io/part-of":     "store",
+		"k8s:statefulset.kubernetes.io/pod": "x",
+	}
+
+	tests := []struct {
+		name     string
+		max      int
+		expected map[string]string
+	}{
+		{
+			name:     "no limit",
+			max:      0,
+			expected: labels,
+		},
+		{
+			name: "top 2 preferred keys plus namespace",
+			max:  2,
+			expected: map[string]string{
+				"k8s:app.kubernetes.io/name":      "catalog",
+				"k8s:app":                         "catalog",
+				"k8s:io.kubernetes.pod.namespace": "shop",
+			},
+		},
+		{
+			name: "preferred keys before other keys",
+			max:  4,
+			expected: map[string]string{
+				"k8s:app.kubernetes.io/name":      "catalog",
+				"k8s:app":                         "catalog",
+				"k8s:app.kubernetes.io/part-of":   "store",
+				"k8s:tier":                        "backend",
+				"k8s:io.kubernetes.pod.namespace": "shop",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := limitSelectorLabels(labels, tt.max)
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("limitSelectorLabels() = %v, want %v", result, tt.expected)
+			}
+		})
+	}
+
+	// Keys of the default ignored label prefixes are dropped before any
+	// other key
+	result := limitSelectorLabels(labels, len(labels)-4)
+	for _, key := range []string{"k8s:pod-template-hash", "k8s:controller-revision-hash", "k8s:io.cilium.k8s.policy.cluster"} {
+		if _, exists := result[key]; exists {
+			t.Errorf("Expected volatile label %s to be dropped, got %v", key, result)
+		}
+	}
+}
+
+func TestSelectorLabels(t *testing.T) {
+	tests := []struct {
+		name     string
+		labels   map[string]string
+		opts     Options
+		expected map[string]string
+	}{
+		{
+			name:     "volatile keys are dropped by default",
+			labels:   map[string]string{"k8s:app": "catalog", "k8s:pod-template-hash": "5d8f", "k8s:controller-revision-hash": "abc"},
+			expected: map[string]string{"k8s:app": "catalog"},
+		},
+		{
+			name: "Cilium noise labels are dropped",
+			labels: map[string]string{
+				"k8s:app":                                 "catalog",
+				"k8s:io.cilium.k8s.policy.cluster":        "default",
+				"k8s:io.cilium.k8s.policy.serviceaccount": "catalog",
+				"k8s:io.kubernetes.pod.namespace":         "shop",
+			},
+			expected: map[string]string{"k8s:app": "catalog", "k8s:io.kubernetes.pod.namespace": "shop"},
+		},
+		{
+			name:     "extra ignored prefixes",
+			labels:   map[string]string{"k8s:app": "catalog", "k8s:version": "v2"},
+			opts:     Options{IgnoreLabelPrefixes: []string{"version"}},
+			expected: map[string]string{"k8s:app": "catalog"},
+		},
+		{
+			name:     "only volatile keys are kept rather than widening the selector",
+			labels:   map[string]string{"k8s:pod-template-hash": "5d8f", "k8s:io.kubernetes.pod.namespace": "shop"},
+			expected: map[string]string{"k8s:pod-template-hash": "5d8f", "k8s:io.kubernetes.pod.namespace": "shop"},
+		},
+		{
+			name:     "label keys select by name without source prefix",
+			labels:   map[string]string{"k8s:app": "catalog", "k8s:component": "api", "k8s:version": "v2"},
+			opts:     Options{LabelKeys: []string{"app", "k8s:component"}},
+			expected: map[string]string{"k8s:app": "catalog", "k8s:component": "api"},
+		},
+		{
+			name:     "label keys keep namespace and reserved labels",
+			labels:   map[string]string{"k8s:app": "catalog", "k8s:version": "v2", "k8s:io.kubernetes.pod.namespace": "shop", "reserved:host": ""},
+			opts:     Options{LabelKeys: []string{"app"}},
+			expected: map[string]string{"k8s:app": "catalog", "k8s:io.kubernetes.pod.namespace": "shop", "reserved:host": ""},
+		},
+		{
+			name:     "endpoint without any label key keeps its stable labels",
+			labels:   map[string]string{"k8s:run": "debug", "k8s:pod-template-hash": "5d8f"},
+			opts:     Options{LabelKeys: []string{"app"}},
+			expected: map[string]string{"k8s:run": "debug"},
+		},
+		{
+			name:     "label keys are capped by max selector labels",
+			labels:   map[string]string{"k8s:app": "catalog", "k8s:tier": "backend"},
+			opts:     Options{LabelKeys: []string{"app", "tier"}, MaxSelectorLabels: 1},
+			expected: map[string]string{"k8s:app": "catalog"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := selectorLabels(tt.labels, tt.opts); !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("selectorLabels() = %v, want %v", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSynthesizePoliciesLabelKeys(t *testing.T) {
+	flows := []*hubble.ParsedFlow{
+		{
+			SourceLabels:    map[string]string{"k8s:app": "frontend", "k8s:version": "v1"},
+			SourceNamespace: "default",
+			DestLabels:      map[string]string{"k8s:app": "catalog", "k8s:version": "v1"},
+			DestNamespace:   "default",
+			DestPort:        8080,
+			Protocol:        "TCP",
+		},
+		// A new version of both workloads keeps the same policy and rule
+		{
+			SourceLabels:    map[string]string{"k8s:app": "frontend", "k8s:version": "v2"},
+			SourceNamespace: "default",
+			DestLabels:      map[string]string{"k8s:app": "catalog", "k8s:version": "v2"},
+			DestNamespace:   "default",
+			DestPort:        8080,
+			Protocol:        "TCP",
+		},
+	}
+
+	policies, err := SynthesizePoliciesWithOptions(flows, Options{LabelKeys: []string{"app"}})
+	if err != nil {
+		t.Fatalf("SynthesizePoliciesWithOptions() error = %v", err)
+	}
+	if len(policies) != 1 {
+		t.Fatalf("Expected 1 policy, got %d", len(policies))
+	}
+	if selector := policies[0].Spec.EndpointSelector.MatchLabels; !reflect.DeepEqual(selector, map[string]string{"k8s:app": "catalog"}) {
+		t.Errorf("Expected endpointSelector {k8s:app: catalog}, got %v", selector)
+	}
+	if ingress := policies[0].Spec.Ingress; len(ingress) != 1 || !reflect.DeepEqual(ingress[0].FromEndpoints[0].MatchLabels, map[string]string{"k8s:app": "frontend"}) {
+		t.Errorf("Expected one ingress rule from {k8s:app: frontend}, got %+v", ingress)
+	}
+}
+
+func TestSynthesizePoliciesMaxSelectorLabels(t *testing.T) {
+	flows := []*hubble.ParsedFlow{
+		{
+			SourceLabels:    map[string]string{"k8s:app": "frontend", "k8s:version": "v1", "k8s:pod-template-hash": "abc"},
+			SourceNamespace: "default",
+			DestLabels:      map[string]string{"k8s:app": "catalog", "k8s:tier": "backend", "k8s:pod-template-hash": "def"},
+			DestNamespace:   "default",
+			DestPort:        8080,
+			Protocol:        "TCP",
+		},
+		// Another replica set of the same destination collapses into one policy
+		{
+			SourceLabels:    map[string]string{"k8s:app": "frontend", "k8s:version": "v1", "k8s:pod-template-hash": "abc"},
+			SourceNamespace: "default",
+			DestLabels:      map[string]string{"k8s:app": "catalog", "k8s:tier": "backend", "k8s:pod-template-hash": "ghi"},
+			DestNamespace:   "default",
+			DestPort:        8080,
+			Protocol:        "TCP",
+		},
+	}
+
+	policies, err := SynthesizePoliciesWithOptions(flows, Options{MaxSelectorLabels: 1})
+	if err != nil {
+		t.Fatalf("SynthesizePoliciesWithOptions() error = %v", err)
+	}
+	if len(policies) != 1 {
+		t.Fatalf("Expected 1 policy, got %d", len(policies))
+	}
+
+	selector := policies[0].Spec.EndpointSelector.MatchLabels
+	if !reflect.DeepEqual(selector, map[string]string{"k8s:app": "catalog"}) {
+		t.Errorf("Expected endpointSelector {k8s:app: catalog}, got %v", selector)
+	}
+
+	from := policies[0].Spec.Ingress[0].FromEndpoints[0].MatchLabels
+	if !reflect.DeepEqual(from, map[string]string{"k8s:app": "frontend"}) {
+		t.Errorf("Expected fromEndpoints {k8s:app: frontend}, got %v", from)
+	}
+}
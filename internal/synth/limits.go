@@ -0,0 +1,169 @@
+package synth
+
+import (
+	"fmt"
+	"maps"
+)
+
+// CiliumMaxPortsPerRule is the most ports Cilium accepts in one
+// toPorts[].ports list, and the default for Options.MaxPortsPerRule
+const CiliumMaxPortsPerRule = 40
+
+// LabelSplitFrom is set on every part of a policy split by
+// Options.MaxRulesPerPolicy to the name of the policy it was split from, so
+// verify expects the parts to select the same endpoints
+const LabelSplitFrom = "policypilot.io/split-from"
+
+// applyLimits enforces opts.MaxPortsPerRule and opts.MaxRulesPerPolicy on
+// merged policies, reporting each policy it changes to opts.OnLimit:
+//
+//   - toPorts entries with more ports are split into several entries of the
+//     same rule, which allow the same traffic
+//   - policies with more ingress or egress rules are split into several
+//     policies with the same selector, named <name>-2, <name>-3 and so on.
+//     Cilium allows the union of their rules, so the split does not widen
+//     or narrow what is allowed.
+func applyLimits(policies []*Policy, opts Options) []*Policy {
+	maxPorts := opts.MaxPortsPerRule
+	if maxPorts <= 0 {
+		maxPorts = CiliumMaxPortsPerRule
+	}
+
+	// Names of split parts must not collide with any other policy
+	taken := make(map[string]bool, len(policies))
+	for _, policy := range policies {
+		taken[policyNameKey(policy.Kind, policy.Metadata.Namespace, policy.Metadata.Name)] = true
+	}
+
+	result := make([]*Policy, 0, len(policies))
+	for _, policy := range policies {
+		split := false
+		for i := range policy.Spec.Ingress {
+			policy.Spec.Ingress[i].ToPorts, split = splitPortRules(policy.Spec.Ingress[i].ToPorts, maxPorts, split)
+		}
+		for i := range policy.Spec.Egress {
+			policy.Spec.Egress[i].ToPorts, split = splitPortRules(policy.Spec.Egress[i].ToPorts, maxPorts, split)
+		}
+		if split {
+			reportLimit(opts, "policy %s lists more than %d ports in a rule; split them into several toPorts entries", policyRef(policy), maxPorts)
+		}
+
+		parts := splitPolicyRules(policy, opts.MaxRulesPerPolicy, taken)
+		if len(parts) > 1 {
+			reportLimit(opts, "policy %s has %d ingress and %d egress rules, more than %d; split it into %d policies",
+				policyRef(policy), len(policy.Spec.Ingress), len(policy.Spec.Egress), opts.MaxRulesPerPolicy, len(parts))
+		}
+		result = append(result, parts...)
+	}
+	return result
+}
+
+// splitPortRules splits port rules with more than maxPorts ports into
+// chunks, setting split if it did. L7 rules apply to a single port and are
+// never split.
+func splitPortRules(portRules []PortRule, maxPorts int, split bool) ([]PortRule, bool) {
+	var result []PortRule
+	for _, portRule := range portRules {
+		if len(portRule.Ports) <= maxPorts {
+			result = append(result, portRule)
+			continue
+		}
+		split = true
+		for i := 0; i < len(portRule.Ports); i += maxPorts {
+			end := min(i+maxPorts, len(portRule.Ports))
+			result = append(result, PortRule{
+				Ports: portRule.Ports[i:end],
+				Rules: portRule.Rules,
+			})
+		}
+	}
+	return result, split
+}
+
+// splitPolicyRules splits a policy into parts with at most maxRules ingress
+// and maxRules egress rules each. The first part keeps the policy's name;
+// the others take the next numbered name not in taken, which records the
+// names it chooses. All parts keep the policy's metadata otherwise, are
+// labelled with LabelSplitFrom, and have a flow-count annotation counting
+// the flows of their own rules. maxRules 0 means no limit.
+func splitPolicyRules(policy *Policy, maxRules int, taken map[string]bool) []*Policy {
+	if maxRules <= 0 || (len(policy.Spec.Ingress) <= maxRules && len(policy.Spec.Egress) <= maxRules) {
+		return []*Policy{policy}
+	}
+
+	ingress, egress := policy.Spec.Ingress, policy.Spec.Egress
+	_, counted := policy.Metadata.Annotations[AnnotationFlowCount]
+	var parts []*Policy
+	suffix := 2
+	for len(ingress) > 0 || len(egress) > 0 {
+		part := *policy
+		part.Metadata.Labels = maps.Clone(policy.Metadata.Labels)
+		part.Metadata.Annotations = maps.Clone(policy.Metadata.Annotations)
+		if part.Metadata.Labels == nil {
+			part.Metadata.Labels = make(map[string]string)
+		}
+		part.Metadata.Labels[LabelSplitFrom] = policy.Metadata.Name
+		for len(parts) > 0 {
+			part.Metadata.Name = joinPolicyName(policy.Metadata.Name, fmt.Sprintf("-%d", suffix))
+			suffix++
+			if key := policyNameKey(part.Kind, part.Metadata.Namespace, part.Metadata.Name); !taken[key] {
+				taken[key] = true
+				break
+			}
+		}
+
+		n := min(maxRules, len(ingress))
+		part.Spec.Ingress, ingress = ingress[:n:n], ingress[n:]
+		n = min(maxRules, len(egress))
+		part.Spec.Egress, egress = egress[:n:n], egress[n:]
+		if len(part.Spec.Ingress) == 0 {
+			part.Spec.Ingress = nil
+		}
+		if len(part.Spec.Egress) == 0 {
+			part.Spec.Egress = nil
+		}
+		if counted {
+			setFlowCount(&part, observedFlows(&part))
+		}
+		parts = append(parts, &part)
+	}
+	return parts
+}
+
+// observedFlows returns the number of flows a policy's rules were derived
+// from, according to their observations
+func observedFlows(policy *Policy) int {
+	count := 0
+	for _, rule := range policy.Spec.Ingress {
+		if rule.Observed != nil {
+			count += rule.Observed.Flows
+		}
+	}
+	for _, rule := range policy.Spec.Egress {
+		if rule.Observed != nil {
+			count += rule.Observed.Flows
+		}
+	}
+	return count
+}
+
+// policyNameKey identifies a policy by kind, namespace and name, which are
+// unique in a cluster
+func policyNameKey(kind, namespace, name string) string {
+	return kind + " " + namespace + "/" + name
+}
+
+// reportLimit passes a message to opts.OnLimit, if set
+func reportLimit(opts Options, format string, args ...interface{}) {
+	if opts.OnLimit != nil {
+		opts.OnLimit(fmt.Sprintf(format, args...))
+	}
+}
+
+// policyRef names a policy as namespace/name, or name if cluster-wide
+func policyRef(policy *Policy) string {
+	if policy.Metadata.Namespace == "" {
+		return policy.Metadata.Name
+	}
+	return policy.Metadata.Namespace + "/" + policy.Metadata.Name
+}
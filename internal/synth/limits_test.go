@@ -0,0 +1,195 @@
+package synth
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"text/template"
+
+	"github.com/prabhakaran-jm/cilium-policypilot/internal/hubble"
+)
+
+func TestSynthesizePoliciesLimits(t *testing.T) {
+	flow := func(source string, port uint16) *hubble.ParsedFlow {
+		return &hubble.ParsedFlow{
+			SourceLabels:    map[string]string{"k8s:app": source},
+			SourceNamespace: "shop",
+			DestLabels:      map[string]string{"k8s:app": "catalog"},
+			DestNamespace:   "shop",
+			DestPort:        port,
+			Protocol:        "TCP",
+		}
+	}
+	// Five sources, one of which uses 45 ports
+	var flows []*hubble.ParsedFlow
+	for i := 1; i <= 5; i++ {
+		flows = append(flows, flow(fmt.Sprintf("client-%d", i), 8080))
+	}
+	for port := uint16(9000); port < 9045; port++ {
+		flows = append(flows, flow("client-1", port))
+	}
+
+	tests := []struct {
+		name     string
+		opts     Options
+		names    []string
+		rules    []int
+		ports    []int
+		messages []string
+	}{
+		{
+			name:  "defaults split only at Cilium's port limit",
+			names: []string{"catalog-policy"},
+			rules: []int{5},
+			ports: []int{40, 6},
+			messages: []string{
+				"policy shop/catalog-policy lists more than 40 ports in a rule; split them into several toPorts entries",
+			},
+		},
+		{
+			name:  "lower port limit",
+			opts:  Options{MaxPortsPerRule: 20},
+			names: []string{"catalog-policy"},
+			rules: []int{5},
+			ports: []int{20, 20, 6},
+			messages: []string{
+				"policy shop/catalog-policy lists more than 20 ports in a rule; split them into several toPorts entries",
+			},
+		},
+		{
+			name:  "rule limit splits the policy",
+			opts:  Options{MaxRulesPerPolicy: 2},
+			names: []string{"catalog-policy", "catalog-policy-2", "catalog-policy-3"},
+			rules: []int{2, 2, 1},
+			ports: []int{40, 6},
+			messages: []string{
+				"policy shop/catalog-policy lists more than 40 ports in a rule; split them into several toPorts entries",
+				"policy shop/catalog-policy has 5 ingress and 2 egress rules, more than 2; split it into 3 policies",
+			},
+		},
+		{
+			name:  "limits that are not exceeded change nothing",
+			opts:  Options{MaxRulesPerPolicy: 5, MaxPortsPerRule: 40},
+			names: []string{"catalog-policy"},
+			rules: []int{5},
+			ports: []int{40, 6},
+			messages: []string{
+				"policy shop/catalog-policy lists more than 40 ports in a rule; split them into several toPorts entries",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var messages []string
+			tt.opts.OnLimit = func(message string) { messages = append(messages, message) }
+			policies, err := SynthesizePoliciesWithOptions(flows, tt.opts)
+			if err != nil {
+				t.Fatalf("SynthesizePoliciesWithOptions() error = %v", err)
+			}
+
+			var names []string
+			var rules []int
+			egress := 0
+			for _, policy := range policies {
+				names = append(names, policy.Metadata.Name)
+				rules = append(rules, len(policy.Spec.Ingress))
+				egress += len(policy.Spec.Egress)
+				if !reflect.DeepEqual(policy.Spec.EndpointSelector, policies[0].Spec.EndpointSelector) {
+					t.Errorf("Policy %s selects %v, want the original selector", policy.Metadata.Name, policy.Spec.EndpointSelector)
+				}
+			}
+			if !reflect.DeepEqual(names, tt.names) || !reflect.DeepEqual(rules, tt.rules) {
+				t.Errorf("Got policies %v with %v ingress rules, want %v with %v", names, rules, tt.names, tt.rules)
+			}
+			if egress != 2 {
+				t.Errorf("Expected the 2 DNS egress rules once, got %d egress rules", egress)
+			}
+
+			var ports []int
+			for _, portRule := range policies[0].Spec.Ingress[0].ToPorts {
+				ports = append(ports, len(portRule.Ports))
+			}
+			if !reflect.DeepEqual(ports, tt.ports) {
+				t.Errorf("client-1 toPorts sizes = %v, want %v", ports, tt.ports)
+			}
+			if !reflect.DeepEqual(messages, tt.messages) {
+				t.Errorf("OnLimit messages = %q, want %q", messages, tt.messages)
+			}
+		})
+	}
+}
+
+func TestSynthesizePoliciesSplitParts(t *testing.T) {
+	flow := func(source, dest string, count int) *hubble.ParsedFlow {
+		return &hubble.ParsedFlow{
+			SourceLabels:    map[string]string{"k8s:app": source},
+			SourceNamespace: "shop",
+			DestLabels:      map[string]string{"k8s:app": dest},
+			DestNamespace:   "shop",
+			DestPort:        8080,
+			Protocol:        "TCP",
+			Count:           count,
+		}
+	}
+	flows := []*hubble.ParsedFlow{
+		flow("client-1", "catalog", 10),
+		flow("client-2", "catalog", 20),
+		flow("client-3", "catalog", 40),
+		flow("client-1", "catalog-2", 1),
+	}
+
+	// catalog's second part may not take the name of the catalog-2 policy
+	policies, err := SynthesizePoliciesWithOptions(flows, Options{
+		MaxRulesPerPolicy: 2,
+		NameTemplate:      template.Must(template.New("name").Parse("{{.App}}")),
+		Provenance:        &Provenance{},
+	})
+	if err != nil {
+		t.Fatalf("SynthesizePoliciesWithOptions() error = %v", err)
+	}
+
+	type part struct {
+		name, splitFrom, flowCount string
+	}
+	var got []part
+	for _, policy := range policies {
+		got = append(got, part{policy.Metadata.Name, policy.Metadata.Labels[LabelSplitFrom], policy.Metadata.Annotations[AnnotationFlowCount]})
+		for _, rule := range policy.Spec.Ingress {
+			if rule.Observed != nil {
+				t.Errorf("Policy %s keeps an observation without RuleComments", policy.Metadata.Name)
+			}
+		}
+	}
+	expected := []part{
+		{"catalog-2", "", "1"},
+		{"catalog", "catalog", "30"},
+		{"catalog-3", "catalog", "40"},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Policies = %+v, want %+v", got, expected)
+	}
+}
+
+func TestSynthesizePoliciesSplitEgressFlowCounts(t *testing.T) {
+	var flows []*hubble.ParsedFlow
+	for i, count := range []int{5, 6, 7} {
+		flow := externalFlow(fmt.Sprintf("203.0.113.%d", i+1), 443)
+		flow.Count = count
+		flows = append(flows, flow)
+	}
+
+	policies, err := SynthesizePoliciesWithOptions(flows, Options{MaxRulesPerPolicy: 2, Provenance: &Provenance{}})
+	if err != nil {
+		t.Fatalf("SynthesizePoliciesWithOptions() error = %v", err)
+	}
+
+	// Two DNS rules, then the three toCIDR rules
+	var counts []string
+	for _, policy := range policies {
+		counts = append(counts, policy.Metadata.Annotations[AnnotationFlowCount])
+	}
+	if expected := []string{"0", "11", "7"}; !reflect.DeepEqual(counts, expected) {
+		t.Errorf("Flow counts = %v, want %v", counts, expected)
+	}
+}
@@ -0,0 +1,172 @@
+package synth
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+)
+
+// MergePolicies coalesces policies of the same kind that share a namespace
+// and endpoint selector, e.g. after flows from several captures were combined
+// or --policy-namespace moved policies into one namespace. The first policy of
+// each set is kept in place and receives the union of the others' rules:
+// rules with the same peers have their ports or ICMP fields combined, exact
+// duplicates are dropped, and new rules are appended in input order. Their
+// flow-count annotations are added up.
+// Policies in different namespaces are never merged.
+func MergePolicies(policies []*Policy) []*Policy {
+	result := make([]*Policy, 0, len(policies))
+	index := make(map[string]*Policy)
+
+	for _, policy := range policies {
+		key := fmt.Sprintf("%s/%s", policy.Kind, endpointKeyToString(EndpointKey{
+			Namespace: policy.Metadata.Namespace,
+			Labels:    policy.Spec.EndpointSelector.MatchLabels,
+		}))
+
+		merged, exists := index[key]
+		if !exists {
+			index[key] = policy
+			result = append(result, policy)
+			continue
+		}
+
+		for _, rule := range policy.Spec.Ingress {
+			merged.Spec.Ingress = mergeIngressRule(merged.Spec.Ingress, rule)
+		}
+		if _, counted := policy.Metadata.Annotations[AnnotationFlowCount]; counted {
+			setFlowCount(merged, flowCount(merged)+flowCount(policy))
+		}
+		for _, rule := range policy.Spec.Egress {
+			merged.Spec.Egress = mergeEgressRule(merged.Spec.Egress, rule)
+		}
+	}
+
+	return result
+}
+
+// mergeIngressRule adds rule to rules, combining it with an existing rule
+// for the same peers where possible
+func mergeIngressRule(rules []IngressRule, rule IngressRule) []IngressRule {
+	peers := fmt.Sprintf("%v|%v|%v", rule.FromEndpoints, rule.FromEntities, rule.FromCIDR)
+
+	for i, existing := range rules {
+		// Observations do not change what a rule allows; they add up
+		if reflect.DeepEqual(withoutObservation(existing), withoutObservation(rule)) {
+			rules[i].Observed = rules[i].Observed.merge(rule.Observed)
+			return rules
+		}
+		if len(rule.FromEndpoints)+len(rule.FromEntities)+len(rule.FromCIDR) == 0 ||
+			fmt.Sprintf("%v|%v|%v", existing.FromEndpoints, existing.FromEntities, existing.FromCIDR) != peers {
+			continue
+		}
+		if ports, icmps, ok := mergeRuleTraffic(existing.ToPorts, existing.ICMPs, rule.ToPorts, rule.ICMPs); ok {
+			rules[i].ToPorts, rules[i].ICMPs = ports, icmps
+			rules[i].Observed = rules[i].Observed.merge(rule.Observed)
+			return rules
+		}
+	}
+
+	return append(rules, rule)
+}
+
+// withoutObservation returns rule with its Observed field cleared
+func withoutObservation(rule IngressRule) IngressRule {
+	rule.Observed = nil
+	return rule
+}
+
+// withoutEgressObservation returns rule with its Observed field cleared
+func withoutEgressObservation(rule EgressRule) EgressRule {
+	rule.Observed = nil
+	return rule
+}
+
+// mergeEgressRule adds rule to rules, combining it with an existing rule for
+// the same peers where possible
+func mergeEgressRule(rules []EgressRule, rule EgressRule) []EgressRule {
+	peers := fmt.Sprintf("%v|%v|%v|%v", rule.ToEndpoints, rule.ToFQDNs, rule.ToEntities, rule.ToCIDR)
+
+	for i, existing := range rules {
+		if reflect.DeepEqual(withoutEgressObservation(existing), withoutEgressObservation(rule)) {
+			rules[i].Observed = rules[i].Observed.merge(rule.Observed)
+			return rules
+		}
+		if len(rule.ToEndpoints)+len(rule.ToFQDNs)+len(rule.ToEntities)+len(rule.ToCIDR) == 0 ||
+			fmt.Sprintf("%v|%v|%v|%v", existing.ToEndpoints, existing.ToFQDNs, existing.ToEntities, existing.ToCIDR) != peers {
+			continue
+		}
+		if ports, icmps, ok := mergeRuleTraffic(existing.ToPorts, existing.ICMPs, rule.ToPorts, rule.ICMPs); ok {
+			rules[i].ToPorts, rules[i].ICMPs = ports, icmps
+			rules[i].Observed = rules[i].Observed.merge(rule.Observed)
+			return rules
+		}
+	}
+
+	return append(rules, rule)
+}
+
+// mergeRuleTraffic combines the toPorts and icmps of two rules with the same
+// peers. It reports false when only one of them is an ICMP rule, since Cilium
+// rejects rules mixing icmps with toPorts.
+func mergeRuleTraffic(ports []PortRule, icmps []ICMPRule, addedPorts []PortRule, addedICMPs []ICMPRule) ([]PortRule, []ICMPRule, bool) {
+	if (len(icmps) > 0) != (len(addedICMPs) > 0) {
+		return nil, nil, false
+	}
+
+	if len(icmps) > 0 {
+		var fields []ICMPField
+		for _, rule := range append(append([]ICMPRule{}, icmps...), addedICMPs...) {
+			for _, field := range rule.Fields {
+				fields = appendUnique(fields, field)
+			}
+		}
+		return nil, []ICMPRule{{Fields: fields}}, true
+	}
+
+	// A rule without toPorts already allows every port
+	if len(ports) == 0 || len(addedPorts) == 0 {
+		return nil, nil, true
+	}
+	return mergePortRules(ports, addedPorts), nil, true
+}
+
+// mergePortRules unions L4-only port rules into the first such rule, keeping
+// port order and dropping duplicates. L7 port rules are appended unless an
+// identical one already exists.
+func mergePortRules(existing, added []PortRule) []PortRule {
+	result := make([]PortRule, 0, len(existing)+len(added))
+	for _, rule := range existing {
+		result = append(result, PortRule{Ports: append([]PortProtocol{}, rule.Ports...), Rules: rule.Rules})
+	}
+
+	for _, rule := range added {
+		merged := false
+		for i := range result {
+			if rule.Rules == nil && result[i].Rules == nil {
+				for _, pp := range rule.Ports {
+					result[i].Ports = appendUnique(result[i].Ports, pp)
+				}
+				merged = true
+				break
+			}
+			if reflect.DeepEqual(result[i], rule) {
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			result = append(result, rule)
+		}
+	}
+
+	return result
+}
+
+// appendUnique appends item to items unless it is already present
+func appendUnique[T comparable](items []T, item T) []T {
+	if slices.Contains(items, item) {
+		return items
+	}
+	return append(items, item)
+}
@@ -0,0 +1,183 @@
+package synth
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/prabhakaran-jm/cilium-policypilot/internal/hubble"
+)
+
+func mergeTestPolicy(namespace string, ingress []IngressRule, egress []EgressRule) *Policy {
+	return &Policy{
+		APIVersion: "cilium.io/v2",
+		Kind:       "CiliumNetworkPolicy",
+		Metadata:   PolicyMetadata{Name: "catalog-policy", Namespace: namespace},
+		Spec: PolicySpec{
+			EndpointSelector: EndpointSelector{MatchLabels: map[string]string{"k8s:app": "catalog"}},
+			Ingress:          ingress,
+			Egress:           egress,
+		},
+	}
+}
+
+func TestMergePolicies(t *testing.T) {
+	frontend := []EndpointSelector{{MatchLabels: map[string]string{"k8s:app": "frontend"}}}
+	checkout := []EndpointSelector{{MatchLabels: map[string]string{"k8s:app": "checkout"}}}
+	tcp := func(ports ...string) []PortRule {
+		rule := PortRule{}
+		for _, port := range ports {
+			rule.Ports = append(rule.Ports, PortProtocol{Port: port, Protocol: "TCP"})
+		}
+		return []PortRule{rule}
+	}
+	ping := func(types ...uint8) []ICMPRule {
+		rule := ICMPRule{}
+		for _, icmpType := range types {
+			rule.Fields = append(rule.Fields, ICMPField{Type: icmpType})
+		}
+		return []ICMPRule{rule}
+	}
+
+	tests := []struct {
+		name     string
+		policies []*Policy
+		expected []*Policy
+	}{
+		{
+			name: "different namespaces are not merged",
+			policies: []*Policy{
+				mergeTestPolicy("shop", []IngressRule{{FromEndpoints: frontend, ToPorts: tcp("8080")}}, nil),
+				mergeTestPolicy("web", []IngressRule{{FromEndpoints: frontend, ToPorts: tcp("8080")}}, nil),
+			},
+			expected: []*Policy{
+				mergeTestPolicy("shop", []IngressRule{{FromEndpoints: frontend, ToPorts: tcp("8080")}}, nil),
+				mergeTestPolicy("web", []IngressRule{{FromEndpoints: frontend, ToPorts: tcp("8080")}}, nil),
+			},
+		},
+		{
+			name: "ports for the same source are unioned",
+			policies: []*Policy{
+				mergeTestPolicy("shop", []IngressRule{{FromEndpoints: frontend, ToPorts: tcp("8080", "9090")}}, generateEgressRulesForDNS("shop")),
+				mergeTestPolicy("shop", []IngressRule{{FromEndpoints: frontend, ToPorts: tcp("9090", "8443")}}, generateEgressRulesForDNS("shop")),
+			},
+			expected: []*Policy{
+				mergeTestPolicy("shop", []IngressRule{{FromEndpoints: frontend, ToPorts: tcp("8080", "9090", "8443")}}, generateEgressRulesForDNS("shop")),
+			},
+		},
+		{
+			name: "rules for new sources are appended in order",
+			policies: []*Policy{
+				mergeTestPolicy("shop", []IngressRule{{FromEndpoints: frontend, ToPorts: tcp("8080")}}, nil),
+				mergeTestPolicy("shop", []IngressRule{{FromEndpoints: checkout, ToPorts: tcp("8080")}}, nil),
+				mergeTestPolicy("shop", []IngressRule{{FromEntities: []string{"host"}, ToPorts: tcp("8080")}}, nil),
+			},
+			expected: []*Policy{
+				mergeTestPolicy("shop", []IngressRule{
+					{FromEndpoints: frontend, ToPorts: tcp("8080")},
+					{FromEndpoints: checkout, ToPorts: tcp("8080")},
+					{FromEntities: []string{"host"}, ToPorts: tcp("8080")},
+				}, nil),
+			},
+		},
+		{
+			name: "a rule without ports absorbs port rules",
+			policies: []*Policy{
+				mergeTestPolicy("shop", []IngressRule{{FromEndpoints: frontend}}, nil),
+				mergeTestPolicy("shop", []IngressRule{{FromEndpoints: frontend, ToPorts: tcp("8080")}}, nil),
+			},
+			expected: []*Policy{
+				mergeTestPolicy("shop", []IngressRule{{FromEndpoints: frontend}}, nil),
+			},
+		},
+		{
+			name: "ICMP rules stay separate from port rules",
+			policies: []*Policy{
+				mergeTestPolicy("shop", nil, []EgressRule{{ToCIDR: []string{"203.0.113.10/32"}, ToPorts: tcp("443")}}),
+				mergeTestPolicy("shop", nil, []EgressRule{{ToCIDR: []string{"203.0.113.10/32"}, ICMPs: ping(8)}}),
+				mergeTestPolicy("shop", nil, []EgressRule{{ToCIDR: []string{"203.0.113.10/32"}, ICMPs: ping(8, 0)}}),
+			},
+			expected: []*Policy{
+				mergeTestPolicy("shop", nil, []EgressRule{
+					{ToCIDR: []string{"203.0.113.10/32"}, ToPorts: tcp("443")},
+					{ToCIDR: []string{"203.0.113.10/32"}, ICMPs: ping(8, 0)},
+				}),
+			},
+		},
+		{
+			name: "L7 port rules are kept distinct",
+			policies: []*Policy{
+				mergeTestPolicy("shop", []IngressRule{{FromEndpoints: frontend, ToPorts: []PortRule{
+					{Ports: []PortProtocol{{Port: "8080", Protocol: "TCP"}}, Rules: &L7Rules{HTTP: []PortRuleHTTP{{Method: "GET"}}}},
+				}}}, nil),
+				mergeTestPolicy("shop", []IngressRule{{FromEndpoints: frontend, ToPorts: []PortRule{
+					{Ports: []PortProtocol{{Port: "8080", Protocol: "TCP"}}, Rules: &L7Rules{HTTP: []PortRuleHTTP{{Method: "GET"}}}},
+					{Ports: []PortProtocol{{Port: "9090", Protocol: "TCP"}}},
+				}}}, nil),
+			},
+			expected: []*Policy{
+				mergeTestPolicy("shop", []IngressRule{{FromEndpoints: frontend, ToPorts: []PortRule{
+					{Ports: []PortProtocol{{Port: "8080", Protocol: "TCP"}}, Rules: &L7Rules{HTTP: []PortRuleHTTP{{Method: "GET"}}}},
+					{Ports: []PortProtocol{{Port: "9090", Protocol: "TCP"}}},
+				}}}, nil),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged := MergePolicies(tt.policies)
+			if !reflect.DeepEqual(merged, tt.expected) {
+				t.Errorf("MergePolicies() mismatch:")
+				for i, policy := range merged {
+					t.Errorf("  got[%d]  %+v", i, policy.Spec)
+				}
+				for i, policy := range tt.expected {
+					t.Errorf("  want[%d] %+v", i, policy.Spec)
+				}
+			}
+		})
+	}
+}
+
+func TestSynthesizePoliciesKeepsOverriddenNamespacesApart(t *testing.T) {
+	flows := []*hubble.ParsedFlow{
+		{
+			SourceLabels:    map[string]string{"k8s:app": "frontend"},
+			SourceNamespace: "web",
+			DestLabels:      map[string]string{"k8s:app": "catalog"},
+			DestNamespace:   "shop",
+			DestPort:        8080,
+			Protocol:        "TCP",
+		},
+		{
+			SourceLabels:    map[string]string{"k8s:app": "frontend"},
+			SourceNamespace: "web",
+			DestLabels:      map[string]string{"k8s:app": "catalog"},
+			DestNamespace:   "shop-canary",
+			DestPort:        9090,
+			Protocol:        "TCP",
+		},
+	}
+
+	// The same app in two namespaces stays two policies, with their own
+	// names and selectors, once both are moved into one namespace
+	policies, err := SynthesizePoliciesWithOptions(flows, Options{PolicyNamespace: "policies"})
+	if err != nil {
+		t.Fatalf("SynthesizePoliciesWithOptions() error = %v", err)
+	}
+	expected := map[string]string{"shop-catalog-policy": "shop", "shop-canary-catalog-policy": "shop-canary"}
+	if len(policies) != len(expected) {
+		t.Fatalf("Expected %d policies, got %d", len(expected), len(policies))
+	}
+	for _, policy := range policies {
+		namespace, ok := expected[policy.Metadata.Name]
+		if !ok {
+			t.Errorf("Unexpected policy %s", policy.Metadata.Name)
+			continue
+		}
+		want := map[string]string{"k8s:app": "catalog", ciliumNamespaceLabel: namespace}
+		if !reflect.DeepEqual(policy.Spec.EndpointSelector.MatchLabels, want) {
+			t.Errorf("%s: endpointSelector = %v, want %v", policy.Metadata.Name, policy.Spec.EndpointSelector.MatchLabels, want)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package synth
+
+import (
+	"fmt"
+	"strings"
+)
+
+// OwnerReference identifies an object that owns a generated policy. A
+// namespaced policy's owner must be cluster-scoped or live in the policy's
+// namespace; Kubernetes garbage-collects dependents whose owner it cannot find.
+type OwnerReference struct {
+	APIVersion string `yaml:"apiVersion" json:"apiVersion"`
+	Kind       string `yaml:"kind" json:"kind"`
+	Name       string `yaml:"name" json:"name"`
+	UID        string `yaml:"uid" json:"uid"`
+}
+
+// ParseOwnerReference parses an owner given as apiVersion/Kind/name/uid, e.g.
+// "policypilot.io/v1alpha1/PolicyPilot/prod/4b6f..." or "v1/ConfigMap/cfg/4b6f...".
+// The apiVersion may itself contain a slash, so the string is split from the
+// right.
+func ParseOwnerReference(s string) (OwnerReference, error) {
+	parts := strings.Split(strings.TrimSpace(s), "/")
+	if len(parts) < 4 {
+		return OwnerReference{}, fmt.Errorf("invalid owner reference %q: must be apiVersion/Kind/name/uid", s)
+	}
+
+	n := len(parts)
+	ref := OwnerReference{
+		APIVersion: strings.Join(parts[:n-3], "/"),
+		Kind:       parts[n-3],
+		Name:       parts[n-2],
+		UID:        parts[n-1],
+	}
+	for _, field := range []struct{ name, value string }{
+		{"apiVersion", ref.APIVersion},
+		{"kind", ref.Kind},
+		{"name", ref.Name},
+		{"uid", ref.UID},
+	} {
+		if field.value == "" {
+			return OwnerReference{}, fmt.Errorf("invalid owner reference %q: %s cannot be empty", s, field.name)
+		}
+	}
+
+	return ref, nil
+}
@@ -0,0 +1,106 @@
+package synth
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prabhakaran-jm/cilium-policypilot/internal/hubble"
+)
+
+func TestParseOwnerReference(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected OwnerReference
+		wantErr  bool
+	}{
+		{
+			input:    "policypilot.io/v1alpha1/PolicyPilot/prod/4b6f2c1e",
+			expected: OwnerReference{APIVersion: "policypilot.io/v1alpha1", Kind: "PolicyPilot", Name: "prod", UID: "4b6f2c1e"},
+		},
+		{
+			input:    "v1/ConfigMap/policies/4b6f2c1e",
+			expected: OwnerReference{APIVersion: "v1", Kind: "ConfigMap", Name: "policies", UID: "4b6f2c1e"},
+		},
+		{input: "ConfigMap/policies/4b6f2c1e", wantErr: true},
+		{input: "v1/ConfigMap/policies/", wantErr: true},
+		{input: "v1//policies/4b6f2c1e", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := ParseOwnerReference(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseOwnerReference() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if result != tt.expected {
+				t.Errorf("ParseOwnerReference() = %+v, want %+v", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSynthesizePoliciesOwnerReferences(t *testing.T) {
+	flows := []*hubble.ParsedFlow{
+		{
+			SourceLabels:    map[string]string{"k8s:app": "frontend"},
+			SourceNamespace: "shop",
+			DestLabels:      map[string]string{"k8s:app": "catalog"},
+			DestNamespace:   "shop",
+			DestPort:        8080,
+			Protocol:        "TCP",
+		},
+		{
+			SourceLabels:    map[string]string{"k8s:app": "catalog"},
+			SourceNamespace: "shop",
+			DestLabels:      map[string]string{"k8s:app": "database"},
+			DestNamespace:   "shop",
+			DestPort:        5432,
+			Protocol:        "TCP",
+		},
+	}
+
+	owner := OwnerReference{APIVersion: "policypilot.io/v1alpha1", Kind: "PolicyPilot", Name: "shop", UID: "4b6f2c1e"}
+	policies, err := SynthesizePoliciesWithOptions(flows, Options{OwnerReferences: []OwnerReference{owner}})
+	if err != nil {
+		t.Fatalf("SynthesizePoliciesWithOptions() error = %v", err)
+	}
+	if len(policies) != 2 {
+		t.Fatalf("Expected 2 policies, got %d", len(policies))
+	}
+
+	expected := `metadata:
+    name: catalog-policy
+    namespace: shop
+    ownerReferences:
+        - apiVersion: policypilot.io/v1alpha1
+          kind: PolicyPilot
+          name: shop
+          uid: 4b6f2c1e
+`
+	for _, policy := range policies {
+		yamlStr, err := PolicyToYAML(policy)
+		if err != nil {
+			t.Fatalf("PolicyToYAML() error = %v", err)
+		}
+		want := strings.ReplaceAll(expected, "catalog-policy", policy.Metadata.Name)
+		if !strings.Contains(yamlStr, want) {
+			t.Errorf("Expected %s to contain owner reference block:\n%s\ngot:\n%s", policy.Metadata.Name, want, yamlStr)
+		}
+	}
+
+	// Each policy gets its own copy
+	policies[0].Metadata.OwnerReferences[0].Name = "changed"
+	if policies[1].Metadata.OwnerReferences[0].Name != "shop" {
+		t.Errorf("Expected owner references not to be shared between policies")
+	}
+
+	// Without owners the field is omitted
+	policies, err = SynthesizePoliciesWithOptions(flows, Options{})
+	if err != nil {
+		t.Fatalf("SynthesizePoliciesWithOptions() error = %v", err)
+	}
+	if yamlStr, _ := PolicyToYAML(policies[0]); strings.Contains(yamlStr, "ownerReferences") {
+		t.Errorf("Expected no ownerReferences without owners, got:\n%s", yamlStr)
+	}
+}
@@ -1,60 +1,143 @@
 package synth
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"net/netip"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
+	"text/template"
 
 	"github.com/prabhakaran-jm/cilium-policypilot/internal/hubble"
+	"github.com/prabhakaran-jm/cilium-policypilot/internal/policymatch"
+	"github.com/prabhakaran-jm/cilium-policypilot/internal/validate"
 )
 
+// ciliumNamespaceLabel is the label Cilium uses to scope selectors to a namespace
+const ciliumNamespaceLabel = "k8s:io.kubernetes.pod.namespace"
+
 // Policy represents a CiliumNetworkPolicy
 type Policy struct {
-	APIVersion string         `yaml:"apiVersion"`
-	Kind       string         `yaml:"kind"`
-	Metadata   PolicyMetadata `yaml:"metadata"`
-	Spec       PolicySpec     `yaml:"spec"`
+	APIVersion string         `yaml:"apiVersion" json:"apiVersion"`
+	Kind       string         `yaml:"kind" json:"kind"`
+	Metadata   PolicyMetadata `yaml:"metadata" json:"metadata"`
+	Spec       PolicySpec     `yaml:"spec" json:"spec"`
 }
 
 // PolicyMetadata contains policy metadata
 type PolicyMetadata struct {
-	Name      string `yaml:"name"`
-	Namespace string `yaml:"namespace,omitempty"`
+	Name            string            `yaml:"name" json:"name"`
+	Namespace       string            `yaml:"namespace,omitempty" json:"namespace,omitempty"`
+	Labels          map[string]string `yaml:"labels,omitempty" json:"labels,omitempty"`
+	Annotations     map[string]string `yaml:"annotations,omitempty" json:"annotations,omitempty"`
+	OwnerReferences []OwnerReference  `yaml:"ownerReferences,omitempty" json:"ownerReferences,omitempty"`
 }
 
 // PolicySpec contains the policy specification
 type PolicySpec struct {
-	EndpointSelector EndpointSelector `yaml:"endpointSelector"`
-	Ingress          []IngressRule    `yaml:"ingress,omitempty"`
-	Egress           []EgressRule     `yaml:"egress,omitempty"`
+	EndpointSelector EndpointSelector `yaml:"endpointSelector" json:"endpointSelector"`
+	Ingress          []IngressRule    `yaml:"ingress,omitempty" json:"ingress,omitempty"`
+	Egress           []EgressRule     `yaml:"egress,omitempty" json:"egress,omitempty"`
+
+	// EnableDefaultDeny turns on default-deny for the selected endpoints
+	// even in a direction without rules; see DefaultDenyPolicies
+	EnableDefaultDeny *DefaultDenyConfig `yaml:"enableDefaultDeny,omitempty" json:"enableDefaultDeny,omitempty"`
 }
 
-// EndpointSelector selects endpoints for the policy
-type EndpointSelector struct {
-	MatchLabels map[string]string `yaml:"matchLabels"`
+// DefaultDenyConfig enables default-deny per direction
+type DefaultDenyConfig struct {
+	Ingress bool `yaml:"ingress" json:"ingress"`
+	Egress  bool `yaml:"egress" json:"egress"`
 }
 
+// EndpointSelector selects endpoints for the policy. An endpoint must match
+// all of MatchLabels and all of MatchExpressions.
+type EndpointSelector = policymatch.Selector
+
+// MatchExpression is a set-based selector requirement. Operator is In,
+// NotIn, Exists or DoesNotExist; only In and NotIn take Values.
+type MatchExpression = policymatch.Expression
+
 // IngressRule defines an ingress rule
 type IngressRule struct {
-	FromEndpoints []EndpointSelector `yaml:"fromEndpoints,omitempty"`
-	ToPorts       []PortRule         `yaml:"toPorts,omitempty"`
+	FromEndpoints []EndpointSelector `yaml:"fromEndpoints,omitempty" json:"fromEndpoints,omitempty"`
+	FromEntities  []string           `yaml:"fromEntities,omitempty" json:"fromEntities,omitempty"`
+	FromCIDR      []string           `yaml:"fromCIDR,omitempty" json:"fromCIDR,omitempty"`
+	ToPorts       []PortRule         `yaml:"toPorts,omitempty" json:"toPorts,omitempty"`
+	ICMPs         []ICMPRule         `yaml:"icmps,omitempty" json:"icmps,omitempty"`
+
+	// Observed records the flows the rule was derived from, with
+	// Options.RuleComments; WritePolicies writes it as a comment
+	Observed *RuleObservation `yaml:"-" json:"-"`
 }
 
 // EgressRule defines an egress rule
 type EgressRule struct {
-	ToEndpoints []EndpointSelector `yaml:"toEndpoints,omitempty"`
-	ToPorts     []PortRule         `yaml:"toPorts,omitempty"`
+	ToEndpoints []EndpointSelector `yaml:"toEndpoints,omitempty" json:"toEndpoints,omitempty"`
+	ToFQDNs     []FQDNSelector     `yaml:"toFQDNs,omitempty" json:"toFQDNs,omitempty"`
+	ToEntities  []string           `yaml:"toEntities,omitempty" json:"toEntities,omitempty"`
+	ToCIDR      []string           `yaml:"toCIDR,omitempty" json:"toCIDR,omitempty"`
+	ToPorts     []PortRule         `yaml:"toPorts,omitempty" json:"toPorts,omitempty"`
+	ICMPs       []ICMPRule         `yaml:"icmps,omitempty" json:"icmps,omitempty"`
+
+	// Observed records the flows the rule was derived from, like
+	// IngressRule.Observed; it is not written
+	Observed *RuleObservation `yaml:"-" json:"-"`
+}
+
+// FQDNSelector selects external destinations by DNS name
+type FQDNSelector struct {
+	MatchName    string `yaml:"matchName,omitempty" json:"matchName,omitempty"`
+	MatchPattern string `yaml:"matchPattern,omitempty" json:"matchPattern,omitempty"`
+}
+
+// ICMPRule allows the listed ICMP messages. Cilium rejects rules that
+// combine icmps with toPorts, so ICMP gets rules of its own.
+type ICMPRule struct {
+	Fields []ICMPField `yaml:"fields" json:"fields"`
+}
+
+// ICMPField matches an ICMP message type. Family defaults to IPv4.
+type ICMPField struct {
+	Family string `yaml:"family,omitempty" json:"family,omitempty"`
+	Type   uint8  `yaml:"type" json:"type"`
 }
 
 // PortRule defines port and protocol rules
 type PortRule struct {
-	Ports []PortProtocol `yaml:"ports"`
+	Ports []PortProtocol `yaml:"ports" json:"ports"`
+	Rules *L7Rules       `yaml:"rules,omitempty" json:"rules,omitempty"`
+}
+
+// L7Rules restricts traffic on a port to the listed application requests
+type L7Rules struct {
+	HTTP []PortRuleHTTP `yaml:"http,omitempty" json:"http,omitempty"`
+	DNS  []DNSRule      `yaml:"dns,omitempty" json:"dns,omitempty"`
+}
+
+// PortRuleHTTP matches HTTP requests. Path is an extended POSIX regex.
+type PortRuleHTTP struct {
+	Method string `yaml:"method,omitempty" json:"method,omitempty"`
+	Path   string `yaml:"path,omitempty" json:"path,omitempty"`
 }
 
-// PortProtocol defines a port and protocol
+// DNSRule matches DNS queries by name or by a "*" wildcard pattern. Cilium
+// learns the IPs behind toFQDNs selectors only from queries a DNS rule
+// sends through its proxy.
+type DNSRule struct {
+	MatchName    string `yaml:"matchName,omitempty" json:"matchName,omitempty"`
+	MatchPattern string `yaml:"matchPattern,omitempty" json:"matchPattern,omitempty"`
+}
+
+// PortProtocol defines a port and protocol. A non-zero EndPort makes the
+// entry the inclusive range Port-EndPort.
 type PortProtocol struct {
-	Port     string `yaml:"port"`
-	Protocol string `yaml:"protocol"`
+	Port     string `yaml:"port" json:"port"`
+	EndPort  int    `yaml:"endPort,omitempty" json:"endPort,omitempty"`
+	Protocol string `yaml:"protocol" json:"protocol"`
 }
 
 // EndpointKey uniquely identifies an endpoint for grouping flows
@@ -69,47 +152,304 @@ type EndpointFlows struct {
 	Flows []*hubble.ParsedFlow
 }
 
-// SynthesizePolicies generates CiliumNetworkPolicies from parsed flows.
-// It groups flows by destination endpoint and creates ingress rules based on
-// observed source endpoints, ports, and protocols. Returns a list of policies,
-// one per unique destination endpoint.
+// Options controls optional synthesis behavior
+type Options struct {
+	// CIDRPrefixLen is the broadest prefix external IPs are aggregated into
+	// for toCIDR rules (see AggregateCIDRs). 0 disables aggregation so each
+	// IP gets its own /32 or /128 entry.
+	CIDRPrefixLen int
+
+	// CIDRMergePrefixLen, if set, merges external IPs into the fewest CIDRs
+	// that cover exactly the observed IPs, none broader than this prefix
+	// (see MergeCIDRs). It takes precedence over CIDRPrefixLen.
+	CIDRMergePrefixLen int
+
+	// ClusterWide emits CiliumClusterwideNetworkPolicies with
+	// namespace-qualified selectors instead of namespaced policies
+	ClusterWide bool
+
+	// PolicyNamespace, if set, overrides metadata.namespace on every
+	// policy regardless of the flows' namespaces. Endpoint selectors are
+	// pinned to the endpoint's own namespace and names are qualified by it,
+	// as for ClusterWide, which it cannot be combined with.
+	PolicyNamespace string
+
+	// MaxSelectorLabels caps the number of labels in each generated selector,
+	// keeping the most stable keys (see limitSelectorLabels). 0 means no limit.
+	MaxSelectorLabels int
+
+	// LabelKeys, if set, limits selectors to labels with these keys (without
+	// their "k8s:" source prefix), e.g. app and component
+	LabelKeys []string
+
+	// IgnoreLabelPrefixes lists label key prefixes left out of selectors in
+	// addition to hubble.DefaultIgnoredLabelPrefixes, e.g. version
+	IgnoreLabelPrefixes []string
+
+	// L7 adds toPorts[].rules.http entries for ports where HTTP requests
+	// were observed, restricting them to the observed methods and paths
+	L7 bool
+
+	// CollapsePorts merges contiguous ingress ports with the same source and
+	// protocol into a single port/endPort range
+	CollapsePorts bool
+
+	// MinFlows is the number of times a source must have been observed on a
+	// destination port before it gets an ingress rule, counting each flow's
+	// Occurrences so flows merged by hubble.DeduplicateFlows still count.
+	// A capture that kept one copy of each distinct flow (learn --dedupe)
+	// has lost those counts. Connections seen less often are reported as
+	// SuppressedRules. 0 and 1 keep every connection.
+	MinFlows int
+
+	// CrossNamespaceWildcard allows a source seen in more than one namespace
+	// talking to the same endpoint from any namespace with a single rule,
+	// instead of one rule per namespace (see anyNamespaceSources)
+	CrossNamespaceWildcard bool
+
+	// SkipIntraNamespace ignores flows whose source and destination are in
+	// the same namespace, so only cross-namespace and external traffic is
+	// controlled: every policy allows all traffic from and to the pods of
+	// its endpoint's namespace
+	SkipIntraNamespace bool
+
+	// GroupBy selects how endpoints are keyed: GroupByLabels (the default
+	// when empty) or GroupByWorkload
+	GroupBy string
+
+	// OwnerReferences are set on every generated policy so that deleting
+	// the owner garbage-collects the policies
+	OwnerReferences []OwnerReference
+
+	// DefaultDeny adds a companion policy enabling default-deny in both
+	// directions for each selected endpoint (see DefaultDenyPolicies)
+	DefaultDeny bool
+
+	// RuleComments records on each ingress rule the flows it was derived
+	// from (see IngressRule.Observed), so the YAML output explains why the
+	// rule exists
+	RuleComments bool
+
+	// NameTemplate, if set, names each policy instead of "<app>-policy". It
+	// is executed with a PolicyNameData and must yield a valid Kubernetes
+	// name; cluster-wide names are used as is, not qualified by namespace.
+	NameTemplate *template.Template
+
+	// ExternalIngress selects how clients outside the cluster are allowed
+	// into in-cluster endpoints: ExternalIngressCIDR (the default when
+	// empty) or ExternalIngressWorld
+	ExternalIngress string
+
+	// Provenance, if set, labels every policy as managed by PolicyPilot and
+	// annotates it with its generation time, source capture, Fingerprint
+	// and, for policies with rules, the number of flows they were derived
+	// from
+	Provenance *Provenance
+
+	// MaxPortsPerRule caps the ports in each toPorts entry; longer lists
+	// are split into several entries. 0 means CiliumMaxPortsPerRule, which
+	// is also the most Cilium accepts.
+	MaxPortsPerRule int
+
+	// MaxRulesPerPolicy caps the ingress and the egress rules of each
+	// policy; policies with more are split into several policies with the
+	// same selector (see applyLimits). 0 means no limit.
+	MaxRulesPerPolicy int
+
+	// OnLimit, if set, is called with a description of each policy changed
+	// because of MaxPortsPerRule or MaxRulesPerPolicy
+	OnLimit func(message string)
+
+	// ReviewRule, if set, is offered every generated ingress rule after
+	// policies are merged and keeps only the rules it approves (see
+	// ReviewIngressRules)
+	ReviewRule func(ProposedRule) (bool, error)
+}
+
+// Values for Options.ExternalIngress
+const (
+	// ExternalIngressCIDR allows each external client by its own IP, as a
+	// /32 or /128 fromCIDR entry
+	ExternalIngressCIDR = "cidr"
+	// ExternalIngressWorld allows every external client with
+	// fromEntities: [world]
+	ExternalIngressWorld = "world"
+)
+
+// PolicyNameData is the data Options.NameTemplate is executed with
+type PolicyNameData struct {
+	// Namespace is the selected endpoint's namespace
+	Namespace string
+	// App is the value of the endpoint's app, name or component label, as
+	// used in the default "<app>-policy" name
+	App string
+	// Direction is "ingress", or "egress" for egress-only policies
+	Direction string
+	// Labels are the endpoint's selector labels
+	Labels map[string]string
+}
+
+// SynthesizePolicies generates CiliumNetworkPolicies from parsed flows
+// using default options.
 func SynthesizePolicies(flows []*hubble.ParsedFlow) ([]*Policy, error) {
+	return SynthesizePoliciesWithOptions(flows, Options{})
+}
+
+// SynthesizePoliciesWithOptions generates CiliumNetworkPolicies from parsed flows.
+// It groups flows by destination endpoint and creates ingress rules based on
+// observed source endpoints, ports, and protocols. Flows to destinations
+// outside the cluster become toFQDNs (or, without a DNS name, toCIDR) egress
+// rules on the source endpoint.
+// Returns a list of policies, one per unique endpoint (see MergePolicies).
+func SynthesizePoliciesWithOptions(flows []*hubble.ParsedFlow, opts Options) ([]*Policy, error) {
+	policies, _, err := SynthesizePoliciesWithSuppressed(flows, opts)
+	return policies, err
+}
+
+// SynthesizePoliciesWithSuppressed is SynthesizePoliciesWithOptions, also
+// returning the connections left out because of opts.MinFlows, ordered by
+// destination, source, and port
+func SynthesizePoliciesWithSuppressed(flows []*hubble.ParsedFlow, opts Options) ([]*Policy, []SuppressedRule, error) {
 	if len(flows) == 0 {
-		return nil, fmt.Errorf("no flows provided")
+		return nil, nil, fmt.Errorf("no flows provided")
+	}
+	if opts.ClusterWide && opts.PolicyNamespace != "" {
+		return nil, nil, fmt.Errorf("a policy namespace cannot be set for cluster-wide policies")
+	}
+
+	flows = withCanonicalProtocols(flows)
+	if opts.SkipIntraNamespace {
+		flows = withoutIntraNamespaceFlows(flows)
+	}
+	if opts.GroupBy == GroupByWorkload {
+		flows = withWorkloadLabels(flows)
 	}
 
 	// Group flows by destination endpoint
-	endpointGroups := groupFlowsByEndpoint(flows)
+	endpointGroups := groupFlowsByEndpoint(flows, opts)
 
 	// Generate policies for each endpoint group
 	policies := make([]*Policy, 0, len(endpointGroups))
+	policyIndex := make(map[string]*Policy)
+	var suppressed []SuppressedRule
 	for _, group := range endpointGroups {
-		policy, err := generatePolicyForEndpoint(group)
+		policy, groupSuppressed, err := generatePolicyForEndpoint(group, opts)
 		if err != nil {
-			return nil, fmt.Errorf("failed to generate policy for endpoint: %w", err)
+			return nil, nil, fmt.Errorf("failed to generate policy for endpoint: %w", err)
 		}
+		suppressed = append(suppressed, groupSuppressed...)
 		if policy != nil {
 			policies = append(policies, policy)
+			policyIndex[endpointKeyToString(group.Key)] = policy
 		}
 	}
 
-	return policies, nil
+	// Add egress rules for external destinations and reserved entities,
+	// grouped by source endpoint
+	for _, group := range groupExternalFlowsBySource(flows, opts) {
+		egressRules := generateExternalEgressRules(group.Flows, opts)
+		if len(egressRules) == 0 {
+			continue
+		}
+
+		if policy, exists := policyIndex[endpointKeyToString(group.Key)]; exists {
+			policy.Spec.Egress = append(policy.Spec.Egress, egressRules...)
+			if opts.Provenance != nil {
+				addFlowCount(policy, group.Flows)
+			}
+			continue
+		}
+
+		policy, err := newPolicy(group.Key, nil, append(generateEgressRulesForDNS(group.Key.Namespace), egressRules...), opts)
+		if err != nil {
+			return nil, nil, err
+		}
+		if opts.Provenance != nil {
+			addFlowCount(policy, group.Flows)
+		}
+		policies = append(policies, policy)
+		policyIndex[endpointKeyToString(group.Key)] = policy
+	}
+
+	policies = MergePolicies(policies)
+	disambiguatePolicyNames(policies)
+	if opts.ReviewRule != nil {
+		var err error
+		if policies, err = ReviewIngressRules(policies, opts.ReviewRule); err != nil {
+			return nil, nil, err
+		}
+	}
+	policies = applyLimits(policies, opts)
+	if !opts.RuleComments {
+		clearObservations(policies)
+	}
+	if opts.DefaultDeny {
+		policies = append(policies, DefaultDenyPolicies(policies)...)
+	}
+
+	if len(opts.OwnerReferences) > 0 {
+		for _, policy := range policies {
+			policy.Metadata.OwnerReferences = append([]OwnerReference{}, opts.OwnerReferences...)
+		}
+	}
+	if opts.Provenance != nil {
+		for _, policy := range policies {
+			applyProvenance(policy, opts.Provenance)
+		}
+	}
+
+	return policies, suppressed, nil
+}
+
+// withCanonicalProtocols returns flows with their protocols normalized by
+// hubble.NormalizeProtocol, so that flows differing only in the case of their
+// protocol, e.g. "tcp" and "TCP", add a single port to a rule. Flows that
+// need it are copied; the caller's flows are left unchanged.
+func withCanonicalProtocols(flows []*hubble.ParsedFlow) []*hubble.ParsedFlow {
+	result := make([]*hubble.ParsedFlow, 0, len(flows))
+	for _, flow := range flows {
+		if protocol := hubble.NormalizeProtocol(flow.Protocol); protocol != flow.Protocol {
+			normalized := *flow
+			normalized.Protocol = protocol
+			flow = &normalized
+		}
+		result = append(result, flow)
+	}
+	return result
+}
+
+// withoutIntraNamespaceFlows drops flows between endpoints of the same
+// namespace. The policies then allow that traffic wholesale (see
+// namespaceSelector), since rules for the other traffic would deny it.
+func withoutIntraNamespaceFlows(flows []*hubble.ParsedFlow) []*hubble.ParsedFlow {
+	result := make([]*hubble.ParsedFlow, 0, len(flows))
+	for _, flow := range flows {
+		if flow.SourceNamespace != "" && flow.SourceNamespace == flow.DestNamespace {
+			continue
+		}
+		result = append(result, flow)
+	}
+	return result
+}
+
+// namespaceSelector selects every pod in namespace
+func namespaceSelector(namespace string) []EndpointSelector {
+	return []EndpointSelector{{MatchLabels: map[string]string{ciliumNamespaceLabel: namespace}}}
 }
 
 // groupFlowsByEndpoint groups flows by their destination endpoint
-func groupFlowsByEndpoint(flows []*hubble.ParsedFlow) []*EndpointFlows {
+func groupFlowsByEndpoint(flows []*hubble.ParsedFlow, opts Options) []*EndpointFlows {
 	groups := make(map[string]*EndpointFlows)
 
 	for _, flow := range flows {
-		// Skip flows without destination information
-		if flow.DestNamespace == "" || len(flow.DestLabels) == 0 {
+		if !hasDestEndpoint(flow) {
 			continue
 		}
 
 		// Create key for destination endpoint
 		key := EndpointKey{
 			Namespace: flow.DestNamespace,
-			Labels:    flow.DestLabels,
+			Labels:    selectorLabels(flow.DestLabels, opts),
 		}
 
 		// Create string key for map lookup
@@ -128,6 +468,11 @@ func groupFlowsByEndpoint(flows []*hubble.ParsedFlow) []*EndpointFlows {
 		group.Flows = append(group.Flows, flow)
 	}
 
+	return sortedEndpointGroups(groups)
+}
+
+// sortedEndpointGroups converts a group map to a slice sorted by namespace and labels
+func sortedEndpointGroups(groups map[string]*EndpointFlows) []*EndpointFlows {
 	// Convert map to slice
 	result := make([]*EndpointFlows, 0, len(groups))
 	for _, group := range groups {
@@ -159,195 +504,596 @@ func endpointKeyToString(key EndpointKey) string {
 }
 
 // generatePolicyForEndpoint generates a policy for a specific endpoint group
-func generatePolicyForEndpoint(group *EndpointFlows) (*Policy, error) {
+func generatePolicyForEndpoint(group *EndpointFlows, opts Options) (*Policy, []SuppressedRule, error) {
 	if len(group.Flows) == 0 {
-		return nil, nil
+		return nil, nil, nil
 	}
 
-	// Extract app label for policy name, fallback to first label key
-	policyName := generatePolicyName(group.Key.Labels)
-
 	// Generate ingress rules from flows
-	ingressRules := generateIngressRules(group.Flows)
+	ingressRules, suppressed := generateIngressRules(group.Flows, opts)
+	for i := range suppressed {
+		suppressed[i].Namespace = group.Key.Namespace
+		suppressed[i].Destination = group.Key.Labels
+	}
 
 	// Only create policy if we have ingress rules
 	if len(ingressRules) == 0 {
-		return nil, nil
+		return nil, suppressed, nil
 	}
 
 	// Generate egress rules for DNS (required for service discovery)
 	egressRules := generateEgressRulesForDNS(group.Key.Namespace)
 
+	policy, err := newPolicy(group.Key, ingressRules, egressRules, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	if opts.Provenance != nil {
+		addFlowCount(policy, group.Flows)
+	}
+	return policy, suppressed, nil
+}
+
+// newPolicy builds a policy selecting the given endpoint. With opts.ClusterWide
+// it is a CiliumClusterwideNetworkPolicy whose selector is pinned to the
+// endpoint's namespace via the namespace label.
+func newPolicy(key EndpointKey, ingressRules []IngressRule, egressRules []EgressRule, opts Options) (*Policy, error) {
+	direction := "ingress"
+	if len(ingressRules) == 0 {
+		direction = "egress"
+	}
+	name, err := policyName(key, direction, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.SkipIntraNamespace {
+		if len(ingressRules) > 0 {
+			ingressRules = append(ingressRules, IngressRule{FromEndpoints: namespaceSelector(key.Namespace)})
+		}
+		egressRules = append(egressRules, EgressRule{ToEndpoints: namespaceSelector(key.Namespace)})
+	}
+
 	policy := &Policy{
 		APIVersion: "cilium.io/v2",
 		Kind:       "CiliumNetworkPolicy",
 		Metadata: PolicyMetadata{
-			Name:      policyName,
-			Namespace: group.Key.Namespace,
+			Name:      name,
+			Namespace: key.Namespace,
 		},
 		Spec: PolicySpec{
 			EndpointSelector: EndpointSelector{
-				MatchLabels: group.Key.Labels,
+				MatchLabels: key.Labels,
 			},
 			Ingress: ingressRules,
 			Egress:  egressRules,
 		},
 	}
 
+	if opts.PolicyNamespace != "" {
+		// A selector without a namespace label would select the endpoint's
+		// namesakes in the policy namespace instead
+		policy.Metadata.Namespace = opts.PolicyNamespace
+		policy.Spec.EndpointSelector.MatchLabels = withNamespaceLabel(key.Labels, key.Namespace)
+	}
+
+	if opts.ClusterWide {
+		policy.Kind = "CiliumClusterwideNetworkPolicy"
+		policy.Metadata.Namespace = ""
+		policy.Spec.EndpointSelector.MatchLabels = withNamespaceLabel(key.Labels, key.Namespace)
+	}
+
 	return policy, nil
 }
 
-// generatePolicyName creates a policy name from endpoint labels
-func generatePolicyName(labels map[string]string) string {
+// policyName names the policy for an endpoint, with opts.NameTemplate if set
+func policyName(key EndpointKey, direction string, opts Options) (string, error) {
+	if opts.NameTemplate == nil {
+		// Cluster-wide names, and names moved into the policy namespace,
+		// share one scope, so qualify them by namespace
+		if opts.ClusterWide || opts.PolicyNamespace != "" {
+			return generatePolicyName(key.Labels, key.Namespace), nil
+		}
+		return generatePolicyName(key.Labels, ""), nil
+	}
+
+	var name strings.Builder
+	data := PolicyNameData{
+		Namespace: key.Namespace,
+		App:       policyApp(key.Labels),
+		Direction: direction,
+		Labels:    key.Labels,
+	}
+	if err := opts.NameTemplate.Execute(&name, data); err != nil {
+		return "", fmt.Errorf("failed to execute name template: %w", err)
+	}
+	if err := validate.PolicyName(name.String()); err != nil {
+		return "", fmt.Errorf("name template yields an invalid policy name for %s/%s: %w", key.Namespace, policyApp(key.Labels), err)
+	}
+	return name.String(), nil
+}
+
+// withNamespaceLabel returns a copy of labels qualified with Cilium's namespace
+// label, so a selector only matches endpoints in that namespace
+func withNamespaceLabel(labels map[string]string, namespace string) map[string]string {
+	result := make(map[string]string, len(labels)+1)
+	for k, v := range labels {
+		result[k] = v
+	}
+	if namespace != "" {
+		result[ciliumNamespaceLabel] = namespace
+	}
+	return result
+}
+
+// withoutNamespaceLabel returns a copy of labels without Cilium's namespace
+// label
+func withoutNamespaceLabel(labels map[string]string) map[string]string {
+	result := make(map[string]string, len(labels))
+	for k, v := range labels {
+		if k != ciliumNamespaceLabel {
+			result[k] = v
+		}
+	}
+	return result
+}
+
+// anyNamespaceSources returns the pod sources among flows, keyed by their
+// selector without its namespace label, that were seen in more than one
+// namespace. Cilium matches "any namespace" with an Exists expression on
+// the namespace label; a matchLabels value of "" only matches pods whose
+// namespace label is empty. Selectors left without any other label are
+// skipped, as they would allow every pod in the cluster.
+func anyNamespaceSources(flows []*hubble.ParsedFlow, opts Options) map[string]bool {
+	namespaces := make(map[string]map[string]bool)
+	for _, flow := range flows {
+		if !isIngressRuleFlow(flow) || flow.SourceEntity != "" || flow.IsExternalSource() {
+			continue
+		}
+		labels := withoutNamespaceLabel(selectorLabels(flow.SourceLabels, opts))
+		if len(labels) == 0 {
+			continue
+		}
+		key := fmt.Sprintf("%v", labels)
+		if namespaces[key] == nil {
+			namespaces[key] = make(map[string]bool)
+		}
+		namespaces[key][flow.SourceNamespace] = true
+	}
+
+	result := make(map[string]bool)
+	for key, seen := range namespaces {
+		if len(seen) > 1 {
+			result[key] = true
+		}
+	}
+	return result
+}
+
+// generatePolicyName creates a policy name from endpoint labels, prefixed by
+// namespace if set. Label values may hold characters policy names cannot,
+// so the name is sanitized and shortened to a valid policy name.
+func generatePolicyName(labels map[string]string, namespace string) string {
+	prefix := policyNameSegment(policyApp(labels))
+	if namespace != "" {
+		prefix = namespace + "-" + prefix
+	}
+	return joinPolicyName(prefix, "-policy")
+}
+
+// policyNameSegment lowercases value and replaces the characters a policy
+// name cannot hold with '-', trimming them from the ends; "default" if
+// nothing is left
+func policyNameSegment(value string) string {
+	segment := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '-' {
+			return r
+		}
+		return '-'
+	}, strings.ToLower(value))
+	if segment = strings.Trim(segment, "-"); segment == "" {
+		return "default"
+	}
+	return segment
+}
+
+// joinPolicyName returns prefix+suffix. If that is longer than
+// validate.MaxPolicyNameLength, the end of prefix is replaced by a hash of
+// the full name, so that shortened names stay distinct.
+func joinPolicyName(prefix, suffix string) string {
+	name := prefix + suffix
+	if len(name) <= validate.MaxPolicyNameLength {
+		return name
+	}
+	hash := nameHash(name)
+	keep := validate.MaxPolicyNameLength - len(suffix) - len(hash) - 1
+	return strings.TrimRight(prefix[:keep], "-") + "-" + hash + suffix
+}
+
+// nameHash returns the short hash that keeps generated names distinct
+func nameHash(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:4])
+}
+
+// disambiguatePolicyNames renames policies that got the name of an earlier
+// policy with another selector, e.g. app=App_1 and app=app-1, which both
+// give app-1-policy. The first keeps the name; the others get a hash of
+// their selector appended, like the one joinPolicyName shortens names with.
+func disambiguatePolicyNames(policies []*Policy) {
+	taken := make(map[string]bool, len(policies))
+	for _, policy := range policies {
+		if key := policyNameKey(policy.Kind, policy.Metadata.Namespace, policy.Metadata.Name); !taken[key] {
+			taken[key] = true
+			continue
+		}
+		selector := formatSelector(policy.Spec.EndpointSelector)
+		for i := 0; ; i++ {
+			hashed := selector
+			if i > 0 {
+				hashed += "#" + strconv.Itoa(i)
+			}
+			name := joinPolicyName(policy.Metadata.Name, "-"+nameHash(hashed))
+			if key := policyNameKey(policy.Kind, policy.Metadata.Namespace, name); !taken[key] {
+				policy.Metadata.Name = name
+				taken[key] = true
+				break
+			}
+		}
+	}
+}
+
+// policyApp returns the label value that names an endpoint's policy
+func policyApp(labels map[string]string) string {
 	// Try to find common label keys
 	preferredKeys := []string{"app", "k8s:app", "name", "component"}
 
 	for _, key := range preferredKeys {
 		if value, exists := labels[key]; exists {
-			return fmt.Sprintf("%s-policy", value)
+			return value
 		}
 	}
 
 	// Fallback to first label value
 	for _, value := range labels {
-		return fmt.Sprintf("%s-policy", value)
+		return value
 	}
 
-	return "default-policy"
+	return "default"
 }
 
-// generateIngressRules creates ingress rules from flows
-func generateIngressRules(flows []*hubble.ParsedFlow) []IngressRule {
-	// Group flows by source endpoint and port/protocol
+// generateIngressRules creates ingress rules from flows, leaving out
+// connections observed fewer than opts.MinFlows times
+func generateIngressRules(flows []*hubble.ParsedFlow, opts Options) ([]IngressRule, []SuppressedRule) {
+	// Group flows by source endpoint, collecting every port/protocol pair
+	// the source used
 	ruleMap := make(map[string]*IngressRule)
+	ports := make(map[string][]PortProtocol)
+
+	// Observed HTTP requests by source endpoint and port (only with opts.L7)
+	httpRules := make(map[string]map[PortProtocol]map[PortRuleHTTP]bool)
+
+	// ICMP rules by source endpoint, kept apart from the port rules
+	icmpRules := make(map[string]*IngressRule)
+	icmpFields := make(map[string][]ICMPField)
+
+	// Observed flows per rule, if opts.observesRules()
+	observed := make(map[string]*RuleObservation)
+
+	// Sources allowed from any namespace, with opts.CrossNamespaceWildcard
+	var anyNamespace map[string]bool
+	if opts.CrossNamespaceWildcard {
+		anyNamespace = anyNamespaceSources(flows, opts)
+	}
 
+	// Observed flows per source and port, to apply opts.MinFlows
+	counts := make(map[string]int)
 	for _, flow := range flows {
-		// Skip flows without source information
-		if len(flow.SourceLabels) == 0 {
-			continue
+		if isIngressRuleFlow(flow) {
+			sourceKey, _ := ingressSource(flow, opts, anyNamespace)
+			counts[sourceKey+" "+ingressTraffic(flow)] += flow.Occurrences()
 		}
+	}
+	suppressed := make(map[string]*SuppressedRule)
 
-		// Skip flows without port information
-		if flow.DestPort == 0 {
+	for _, flow := range flows {
+		if !isIngressRuleFlow(flow) {
 			continue
 		}
 
-		// Create a key for grouping: source labels + port + protocol
-		// We'll group by source endpoint first, then combine ports
-		sourceKey := fmt.Sprintf("%v", flow.SourceLabels)
+		// Group by source endpoint first, then combine ports
+		sourceKey, newRule := ingressSource(flow, opts, anyNamespace)
 
-		rule, exists := ruleMap[sourceKey]
-		if !exists {
-			rule = &IngressRule{
-				FromEndpoints: []EndpointSelector{
-					{MatchLabels: flow.SourceLabels},
-				},
-				ToPorts: []PortRule{},
+		traffic := ingressTraffic(flow)
+		if ruleKey := sourceKey + " " + traffic; counts[ruleKey] < opts.MinFlows {
+			if _, exists := suppressed[ruleKey]; !exists {
+				suppressed[ruleKey] = &SuppressedRule{
+					Source:  describeSource(flow),
+					Traffic: traffic,
+					Flows:   counts[ruleKey],
+				}
+			}
+			continue
+		}
+
+		if flow.IsICMP() {
+			if _, exists := icmpRules[sourceKey]; !exists {
+				icmpRules[sourceKey] = &newRule
+			}
+			icmpFields[sourceKey] = addICMPField(icmpFields[sourceKey], icmpFieldFor(flow))
+			if opts.observesRules() {
+				observed["icmp "+sourceKey] = observed["icmp "+sourceKey].add(flow)
 			}
-			ruleMap[sourceKey] = rule
+			continue
 		}
 
-		// Add port if not already present
-		portStr := fmt.Sprintf("%d", flow.DestPort)
-		protocol := flow.Protocol
-		if protocol == "" {
-			protocol = "TCP"
+		if _, exists := ruleMap[sourceKey]; !exists {
+			ruleMap[sourceKey] = &newRule
+		}
+		if opts.observesRules() {
+			observed[sourceKey] = observed[sourceKey].add(flow)
 		}
+		ports[sourceKey] = addFlowPort(ports[sourceKey], flow)
 
-		portExists := false
-		for _, portRule := range rule.ToPorts {
-			for _, pp := range portRule.Ports {
-				if pp.Port == portStr && pp.Protocol == protocol {
-					portExists = true
-					break
-				}
+		if opts.L7 && flow.HTTPMethod != "" {
+			port := flowPort(flow)
+			if httpRules[sourceKey] == nil {
+				httpRules[sourceKey] = make(map[PortProtocol]map[PortRuleHTTP]bool)
 			}
-			if portExists {
-				break
+			if httpRules[sourceKey][port] == nil {
+				httpRules[sourceKey][port] = make(map[PortRuleHTTP]bool)
 			}
+			httpRules[sourceKey][port][PortRuleHTTP{
+				Method: flow.HTTPMethod,
+				Path:   httpPathRegex(flow.HTTPPath),
+			}] = true
+		}
+	}
+
+	// Convert map to slice; applyLimits splits large port lists once
+	// policies are merged
+	rules := make([]IngressRule, 0, len(ruleMap))
+	for sourceKey, rule := range ruleMap {
+		// One toPorts entry carries every port of the source, whatever its
+		// protocol; ports with HTTP rules get entries of their own
+		rule.ToPorts = portRulesFor(ports[sourceKey])
+		rule.Observed = observed[sourceKey]
+
+		if len(httpRules[sourceKey]) > 0 {
+			rule.ToPorts = withHTTPRules(rule.ToPorts, httpRules[sourceKey])
 		}
 
-		if !portExists {
-			// Find or create PortRule for this protocol
-			portRuleIndex := -1
-			for i, pr := range rule.ToPorts {
-				if len(pr.Ports) > 0 && pr.Ports[0].Protocol == protocol {
-					portRuleIndex = i
-					break
+		// L7 rules apply to a single port, so only L4 port rules are collapsed
+		if opts.CollapsePorts {
+			for i := range rule.ToPorts {
+				if rule.ToPorts[i].Rules == nil {
+					rule.ToPorts[i].Ports = collapsePortRanges(rule.ToPorts[i].Ports)
 				}
 			}
+		}
 
-			if portRuleIndex >= 0 {
-				// Add port to existing PortRule
-				rule.ToPorts[portRuleIndex].Ports = append(rule.ToPorts[portRuleIndex].Ports, PortProtocol{
-					Port:     portStr,
-					Protocol: protocol,
-				})
-			} else {
-				// Create new PortRule
-				rule.ToPorts = append(rule.ToPorts, PortRule{
-					Ports: []PortProtocol{
-						{
-							Port:     portStr,
-							Protocol: protocol,
-						},
-					},
-				})
+		rules = append(rules, *rule)
+	}
+
+	// ICMP rules follow the port rules; the stable sort keeps that order
+	// for a source that has both
+	for sourceKey, rule := range icmpRules {
+		rule.ICMPs = icmpRulesFor(icmpFields[sourceKey])
+		rule.Observed = observed["icmp "+sourceKey]
+		rules = append(rules, *rule)
+	}
+
+	// Sort rules by source for consistent output
+	sort.SliceStable(rules, func(i, j int) bool {
+		return ingressRuleSortKey(rules[i]) < ingressRuleSortKey(rules[j])
+	})
+
+	return rules, sortedSuppressedRules(suppressed)
+}
+
+// hasDestEndpoint reports whether a flow's destination is a pod that an
+// endpointSelector can select. Host-network destinations share the node
+// identity and are skipped.
+func hasDestEndpoint(flow *hubble.ParsedFlow) bool {
+	return flow.DestNamespace != "" && len(flow.DestLabels) > 0 && flow.DestEntity == ""
+}
+
+// isIngressRuleFlow reports whether a flow can produce an ingress rule
+func isIngressRuleFlow(flow *hubble.ParsedFlow) bool {
+	// Skip flows without source information; external clients only have
+	// an IP
+	if len(flow.SourceLabels) == 0 && flow.SourceEntity == "" && !flow.IsExternalSource() {
+		return false
+	}
+
+	// Skip flows without port information (ICMP has none)
+	if flow.DestPort == 0 && !flow.IsICMP() {
+		return false
+	}
+
+	// Skip reply flows: their destination port is the client's ephemeral
+	// port, not a port the destination serves on
+	return !flow.IsReply
+}
+
+// ContributesRule reports whether synthesis can derive an ingress or egress
+// rule from a flow, before options such as MinFlows are applied. Flows
+// without enough endpoint or port information are skipped, as are reply
+// flows.
+func ContributesRule(flow *hubble.ParsedFlow) bool {
+	if hasDestEndpoint(flow) {
+		return isIngressRuleFlow(flow)
+	}
+	return isExternalEgressFlow(flow)
+}
+
+// ingressSource returns the grouping key for a flow's source and an ingress
+// rule selecting it. Host-network sources share the node identity and can
+// only be matched as an entity, not by pod labels; clients outside the
+// cluster are matched by IP or as the world entity (see
+// Options.ExternalIngress). Pods whose selector, without its namespace
+// label, is in anyNamespace are matched in every namespace.
+func ingressSource(flow *hubble.ParsedFlow, opts Options, anyNamespace map[string]bool) (string, IngressRule) {
+	if flow.SourceEntity != "" {
+		return "entity:" + flow.SourceEntity, IngressRule{
+			FromEntities: []string{flow.SourceEntity},
+		}
+	}
+
+	if flow.IsExternalSource() {
+		addr, err := netip.ParseAddr(flow.SourceIP)
+		if opts.ExternalIngress == ExternalIngressWorld || err != nil {
+			return "entity:world", IngressRule{
+				FromEntities: []string{"world"},
 			}
 		}
+		addr = addr.Unmap()
+		cidr := netip.PrefixFrom(addr, addr.BitLen()).String()
+		return "cidr:" + cidr, IngressRule{
+			FromCIDR: []string{cidr},
+		}
 	}
 
-	// Convert map to slice and split large port lists
-	rules := make([]IngressRule, 0, len(ruleMap))
-	const maxPortsPerRule = 40 // Cilium limit: max 40 ports per toPorts[].ports
+	// Selectors without a namespace label only match endpoints in the
+	// policy's own namespace, so sources elsewhere are pinned to theirs
+	policyNamespace := flow.DestNamespace
+	if opts.PolicyNamespace != "" {
+		policyNamespace = opts.PolicyNamespace
+	}
+	sourceLabels := selectorLabels(flow.SourceLabels, opts)
+	if key := fmt.Sprintf("%v", withoutNamespaceLabel(sourceLabels)); anyNamespace[key] {
+		return "any-namespace " + key, IngressRule{
+			FromEndpoints: []EndpointSelector{{
+				MatchLabels:      withoutNamespaceLabel(sourceLabels),
+				MatchExpressions: []MatchExpression{{Key: ciliumNamespaceLabel, Operator: "Exists"}},
+			}},
+		}
+	}
+	if opts.ClusterWide || flow.SourceNamespace != policyNamespace {
+		sourceLabels = withNamespaceLabel(sourceLabels, flow.SourceNamespace)
+	}
+	return fmt.Sprintf("%v", sourceLabels), IngressRule{
+		FromEndpoints: []EndpointSelector{
+			{MatchLabels: sourceLabels},
+		},
+	}
+}
+
+// withHTTPRules moves each port with observed HTTP requests into its own
+// PortRule carrying those requests as rules.http, since L7 rules apply to
+// every port in a PortRule
+func withHTTPRules(portRules []PortRule, http map[PortProtocol]map[PortRuleHTTP]bool) []PortRule {
+	var result []PortRule
+	var l7PortRules []PortRule
+
+	for _, portRule := range portRules {
+		var l4Ports []PortProtocol
+		for _, pp := range portRule.Ports {
+			requests, exists := http[pp]
+			if !exists {
+				l4Ports = append(l4Ports, pp)
+				continue
+			}
+
+			rules := make([]PortRuleHTTP, 0, len(requests))
+			for request := range requests {
+				rules = append(rules, request)
+			}
+			sort.Slice(rules, func(i, j int) bool {
+				if rules[i].Path != rules[j].Path {
+					return rules[i].Path < rules[j].Path
+				}
+				return rules[i].Method < rules[j].Method
+			})
 
-	for _, rule := range ruleMap {
-		// Sort ports within each rule
-		for i := range rule.ToPorts {
-			sort.Slice(rule.ToPorts[i].Ports, func(a, b int) bool {
-				return rule.ToPorts[i].Ports[a].Port < rule.ToPorts[i].Ports[b].Port
+			l7PortRules = append(l7PortRules, PortRule{
+				Ports: []PortProtocol{pp},
+				Rules: &L7Rules{HTTP: rules},
 			})
 		}
+		if len(l4Ports) > 0 {
+			result = append(result, PortRule{Ports: l4Ports})
+		}
+	}
 
-		// Split large port lists into multiple PortRules
-		var splitPortRules []PortRule
-		for _, portRule := range rule.ToPorts {
-			if len(portRule.Ports) <= maxPortsPerRule {
-				// No splitting needed
-				splitPortRules = append(splitPortRules, portRule)
-			} else {
-				// Split into chunks of maxPortsPerRule
-				for i := 0; i < len(portRule.Ports); i += maxPortsPerRule {
-					end := i + maxPortsPerRule
-					if end > len(portRule.Ports) {
-						end = len(portRule.Ports)
-					}
-					splitPortRules = append(splitPortRules, PortRule{
-						Ports: portRule.Ports[i:end],
-					})
-				}
+	return append(result, l7PortRules...)
+}
+
+// collapsePortRanges merges runs of consecutive numeric ports with the same
+// protocol into one entry with an EndPort. The result is ordered by protocol
+// then port number; named ports are kept unchanged.
+func collapsePortRanges(ports []PortProtocol) []PortProtocol {
+	type numericPort struct {
+		start, end int
+		protocol   string
+	}
+
+	var numeric []numericPort
+	var named []PortProtocol
+	for _, pp := range ports {
+		start, err := strconv.Atoi(pp.Port)
+		if err != nil {
+			named = append(named, pp)
+			continue
+		}
+		end := start
+		if pp.EndPort > start {
+			end = pp.EndPort
+		}
+		numeric = append(numeric, numericPort{start: start, end: end, protocol: pp.Protocol})
+	}
+
+	sort.Slice(numeric, func(i, j int) bool {
+		if numeric[i].protocol != numeric[j].protocol {
+			return numeric[i].protocol < numeric[j].protocol
+		}
+		return numeric[i].start < numeric[j].start
+	})
+
+	var merged []numericPort
+	for _, run := range numeric {
+		if last := len(merged) - 1; last >= 0 && merged[last].protocol == run.protocol && run.start <= merged[last].end+1 {
+			if run.end > merged[last].end {
+				merged[last].end = run.end
 			}
+			continue
 		}
+		merged = append(merged, run)
+	}
 
-		// Create new rule with split port rules
-		newRule := IngressRule{
-			FromEndpoints: rule.FromEndpoints,
-			ToPorts:       splitPortRules,
+	result := make([]PortProtocol, 0, len(merged)+len(named))
+	for _, run := range merged {
+		pp := PortProtocol{Port: strconv.Itoa(run.start), Protocol: run.protocol}
+		if run.end > run.start {
+			pp.EndPort = run.end
 		}
-		rules = append(rules, newRule)
+		result = append(result, pp)
 	}
+	return append(result, named...)
+}
 
-	// Sort rules by source labels for consistent output
-	sort.Slice(rules, func(i, j int) bool {
-		return fmt.Sprintf("%v", rules[i].FromEndpoints[0].MatchLabels) <
-			fmt.Sprintf("%v", rules[j].FromEndpoints[0].MatchLabels)
-	})
+// httpPathRegex returns a path regex matching exactly the observed path
+func httpPathRegex(path string) string {
+	if path == "" {
+		path = "/"
+	}
+	return regexp.QuoteMeta(path)
+}
 
-	return rules
+// ingressRuleSortKey returns a string ordering ingress rules by their source
+func ingressRuleSortKey(rule IngressRule) string {
+	if len(rule.FromEndpoints) > 0 {
+		return fmt.Sprintf("%v", rule.FromEndpoints[0].MatchLabels)
+	}
+	if len(rule.FromCIDR) > 0 {
+		return "cidr:" + strings.Join(rule.FromCIDR, ",")
+	}
+	return "entity:" + strings.Join(rule.FromEntities, ",")
 }
 
 // generateEgressRulesForDNS creates egress rules to allow DNS queries to kube-dns
-// This is required for pods to resolve service names and connect to other services
+// This is required for pods to resolve service names and connect to other services.
+// The DNS rule sends queries through Cilium's DNS proxy so toFQDNs rules can match.
 func generateEgressRulesForDNS(namespace string) []EgressRule {
 	// Allow DNS queries to kube-dns in kube-system namespace
 	// This allows pods to resolve service names like "frontend.demo.svc.cluster.local"
@@ -372,6 +1118,7 @@ func generateEgressRulesForDNS(namespace string) []EgressRule {
 							Protocol: "TCP",
 						},
 					},
+					Rules: &L7Rules{DNS: []DNSRule{{MatchPattern: "*"}}},
 				},
 			},
 		},
@@ -396,6 +1143,7 @@ func generateEgressRulesForDNS(namespace string) []EgressRule {
 							Protocol: "TCP",
 						},
 					},
+					Rules: &L7Rules{DNS: []DNSRule{{MatchPattern: "*"}}},
 				},
 			},
 		},
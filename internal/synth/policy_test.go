@@ -1,9 +1,18 @@
 package synth
 
 import (
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
 	"testing"
+	"text/template"
 
 	"github.com/prabhakaran-jm/cilium-policypilot/internal/hubble"
+	"github.com/prabhakaran-jm/cilium-policypilot/internal/validate"
+	"github.com/prabhakaran-jm/cilium-policypilot/internal/verify"
+	"gopkg.in/yaml.v3"
 )
 
 func TestSynthesizePolicies(t *testing.T) {
@@ -97,6 +106,94 @@ func TestSynthesizePolicies(t *testing.T) {
 				}
 			},
 		},
+		{
+			name: "external destination with DNS name",
+			flows: []*hubble.ParsedFlow{
+				{
+					SourceLabels:    map[string]string{"k8s:app": "frontend"},
+					SourceNamespace: "default",
+					DestLabels:      map[string]string{},
+					DestDNSName:     "api.github.com",
+					DestPort:        443,
+					Protocol:        "TCP",
+				},
+			},
+			wantErr: false,
+			validate: func(t *testing.T, policies []*Policy) {
+				if len(policies) != 1 {
+					t.Errorf("Expected 1 policy, got %d", len(policies))
+					return
+				}
+				policy := policies[0]
+				if policy.Metadata.Name != "frontend-policy" {
+					t.Errorf("Expected policy name 'frontend-policy', got '%s'", policy.Metadata.Name)
+				}
+				var fqdnRule *EgressRule
+				for i := range policy.Spec.Egress {
+					if len(policy.Spec.Egress[i].ToFQDNs) > 0 {
+						fqdnRule = &policy.Spec.Egress[i]
+					}
+				}
+				if fqdnRule == nil {
+					t.Fatalf("Expected a toFQDNs egress rule, got none")
+				}
+				if fqdnRule.ToFQDNs[0].MatchName != "api.github.com" {
+					t.Errorf("Expected matchName 'api.github.com', got '%s'", fqdnRule.ToFQDNs[0].MatchName)
+				}
+				if len(fqdnRule.ToPorts) != 1 || fqdnRule.ToPorts[0].Ports[0].Port != "443" {
+					t.Errorf("Expected toPorts with port 443, got %+v", fqdnRule.ToPorts)
+				}
+
+				yamlStr, err := PolicyToYAML(policy)
+				if err != nil {
+					t.Fatalf("PolicyToYAML() error = %v", err)
+				}
+				if !strings.Contains(yamlStr, "toFQDNs:") || !strings.Contains(yamlStr, "matchName: api.github.com") {
+					t.Errorf("Expected toFQDNs matchName in YAML, got:\n%s", yamlStr)
+				}
+			},
+		},
+		{
+			name: "reply flows do not produce ephemeral ports",
+			flows: []*hubble.ParsedFlow{
+				{
+					SourceLabels:    map[string]string{"k8s:app": "frontend"},
+					SourceNamespace: "default",
+					DestLabels:      map[string]string{"k8s:app": "catalog"},
+					DestNamespace:   "default",
+					DestPort:        8080,
+					Protocol:        "TCP",
+				},
+				{
+					SourceLabels:    map[string]string{"k8s:app": "catalog"},
+					SourceNamespace: "default",
+					DestLabels:      map[string]string{"k8s:app": "frontend"},
+					DestNamespace:   "default",
+					DestPort:        54321,
+					Protocol:        "TCP",
+					IsReply:         true,
+				},
+			},
+			wantErr: false,
+			validate: func(t *testing.T, policies []*Policy) {
+				if len(policies) != 1 {
+					t.Fatalf("Expected 1 policy, got %d", len(policies))
+				}
+				policy := policies[0]
+				if policy.Metadata.Name != "catalog-policy" {
+					t.Errorf("Expected policy name 'catalog-policy', got '%s'", policy.Metadata.Name)
+				}
+				for _, rule := range policy.Spec.Ingress {
+					for _, portRule := range rule.ToPorts {
+						for _, pp := range portRule.Ports {
+							if pp.Port != "8080" {
+								t.Errorf("Unexpected ingress port %s", pp.Port)
+							}
+						}
+					}
+				}
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -117,9 +214,10 @@ func TestSynthesizePolicies(t *testing.T) {
 
 func TestGeneratePolicyName(t *testing.T) {
 	tests := []struct {
-		name     string
-		labels   map[string]string
-		expected string
+		name      string
+		labels    map[string]string
+		namespace string
+		expected  string
 	}{
 		{
 			name:     "app label",
@@ -141,14 +239,1364 @@ func TestGeneratePolicyName(t *testing.T) {
 			labels:   map[string]string{"version": "v1"},
 			expected: "v1-policy",
 		},
+		{
+			name:     "invalid characters",
+			labels:   map[string]string{"k8s:app": "_My.App_"},
+			expected: "my-app-policy",
+		},
+		{
+			name:     "no valid characters",
+			labels:   map[string]string{"k8s:app": "__"},
+			expected: "default-policy",
+		},
+		{
+			name:      "cluster-wide",
+			labels:    map[string]string{"k8s:app": "catalog"},
+			namespace: "shop",
+			expected:  "shop-catalog-policy",
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := generatePolicyName(tt.labels)
+			result := generatePolicyName(tt.labels, tt.namespace)
 			if result != tt.expected {
 				t.Errorf("generatePolicyName() = %v, want %v", result, tt.expected)
 			}
 		})
 	}
 }
+
+func TestSynthesizePoliciesLongAppLabel(t *testing.T) {
+	// Two 70-character apps differing only in their last character
+	long := strings.Repeat("catalog-", 8) + "serv"
+	flows := []*hubble.ParsedFlow{
+		{
+			SourceLabels:    map[string]string{"k8s:app": "frontend"},
+			SourceNamespace: "shop",
+			DestLabels:      map[string]string{"k8s:app": long + "e1"},
+			DestNamespace:   "shop",
+			DestPort:        8080,
+			Protocol:        "TCP",
+		},
+		{
+			SourceLabels:    map[string]string{"k8s:app": "frontend"},
+			SourceNamespace: "shop",
+			DestLabels:      map[string]string{"k8s:app": long + "e2"},
+			DestNamespace:   "shop",
+			DestPort:        8080,
+			Protocol:        "TCP",
+		},
+	}
+
+	for _, opts := range []Options{{}, {DefaultDeny: true}, {ClusterWide: true, DefaultDeny: true}} {
+		policies, err := SynthesizePoliciesWithOptions(flows, opts)
+		if err != nil {
+			t.Fatalf("SynthesizePoliciesWithOptions(%+v) error = %v", opts, err)
+		}
+		names := make(map[string]bool)
+		for _, policy := range policies {
+			name := policy.Metadata.Name
+			if err := validate.PolicyName(name); err != nil {
+				t.Errorf("%+v: %v", opts, err)
+			}
+			if !strings.HasPrefix(name, "catalog-catalog-") && !strings.HasPrefix(name, "shop-catalog-catalog-") {
+				t.Errorf("%+v: name %q does not start with the app", opts, name)
+			}
+			names[name] = true
+		}
+		if len(names) != len(policies) {
+			t.Errorf("%+v: names %v are not distinct", opts, names)
+		}
+	}
+}
+
+func TestSynthesizePoliciesNameCollisions(t *testing.T) {
+	flow := func(app string) *hubble.ParsedFlow {
+		return &hubble.ParsedFlow{
+			SourceLabels:    map[string]string{"k8s:app": "frontend"},
+			SourceNamespace: "shop",
+			DestLabels:      map[string]string{"k8s:app": app},
+			DestNamespace:   "shop",
+			DestPort:        8080,
+			Protocol:        "TCP",
+		}
+	}
+	// All three apps give the name app-1-policy
+	flows := []*hubble.ParsedFlow{flow("app-1"), flow("App_1"), flow("app.1")}
+
+	for _, opts := range []Options{{}, {DefaultDeny: true}} {
+		policies, err := SynthesizePoliciesWithOptions(flows, opts)
+		if err != nil {
+			t.Fatalf("SynthesizePoliciesWithOptions(%+v) error = %v", opts, err)
+		}
+		names := make(map[string]bool)
+		for _, policy := range policies {
+			name := policy.Metadata.Name
+			if err := validate.PolicyName(name); err != nil {
+				t.Errorf("%+v: %v", opts, err)
+			}
+			if !strings.HasPrefix(name, "app-1-policy") {
+				t.Errorf("%+v: name %q does not start with app-1-policy", opts, name)
+			}
+			names[name] = true
+		}
+		if len(names) != len(policies) {
+			t.Errorf("%+v: names %v are not distinct", opts, names)
+		}
+		if !names["app-1-policy"] {
+			t.Errorf("%+v: expected the first policy to keep app-1-policy, got %v", opts, names)
+		}
+	}
+
+	// The suffix depends on the selector, not on the order of the flows
+	first, err := SynthesizePolicies(flows)
+	if err != nil {
+		t.Fatalf("SynthesizePolicies() error = %v", err)
+	}
+	second, err := SynthesizePolicies([]*hubble.ParsedFlow{flows[0], flows[2], flows[1]})
+	if err != nil {
+		t.Fatalf("SynthesizePolicies() error = %v", err)
+	}
+	names := func(policies []*Policy) map[string]string {
+		result := make(map[string]string)
+		for _, policy := range policies {
+			result[formatSelector(policy.Spec.EndpointSelector)] = policy.Metadata.Name
+		}
+		return result
+	}
+	if !reflect.DeepEqual(names(first), names(second)) {
+		t.Errorf("Names by selector = %v and %v, want them equal", names(first), names(second))
+	}
+}
+
+func TestSynthesizePoliciesNameTemplate(t *testing.T) {
+	flows := []*hubble.ParsedFlow{
+		{
+			SourceLabels:    map[string]string{"k8s:app": "frontend"},
+			SourceNamespace: "shop",
+			DestLabels:      map[string]string{"k8s:app": "catalog", "k8s:tier": "backend"},
+			DestNamespace:   "shop",
+			DestPort:        8080,
+			Protocol:        "TCP",
+		},
+		// frontend only gets an egress policy
+		{
+			SourceLabels:    map[string]string{"k8s:app": "frontend"},
+			SourceNamespace: "shop",
+			DestIP:          "203.0.113.10",
+			DestPort:        443,
+			Protocol:        "TCP",
+		},
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		opts     Options
+		expected []string
+		wantErr  string
+	}{
+		{
+			name:     "namespace, app and direction",
+			template: "{{.Namespace}}-{{.App}}-{{.Direction}}",
+			expected: []string{"shop-catalog-ingress", "shop-frontend-egress"},
+		},
+		{
+			name:     "labels",
+			template: `{{index .Labels "k8s:app"}}{{with index .Labels "k8s:tier"}}-{{.}}{{end}}`,
+			expected: []string{"catalog-backend", "frontend"},
+		},
+		{
+			name:     "cluster-wide names are not qualified",
+			template: "{{.App}}-{{.Direction}}",
+			opts:     Options{ClusterWide: true},
+			expected: []string{"catalog-ingress", "frontend-egress"},
+		},
+		{
+			name:     "invalid name",
+			template: "{{.App}}_{{.Direction}}",
+			wantErr:  `invalid policy name "catalog_ingress"`,
+		},
+		{
+			name:     "name too long",
+			template: "{{.Namespace}}-{{.App}}-{{.Direction}}-01234567890123456789012345678901234567890123456789",
+			wantErr:  "must be at most 63",
+		},
+		{
+			name:     "unknown field",
+			template: "{{.Workload}}",
+			wantErr:  "failed to execute name template",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			opts.NameTemplate = template.Must(template.New("name").Parse(tt.template))
+
+			policies, err := SynthesizePoliciesWithOptions(flows, opts)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("SynthesizePoliciesWithOptions() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SynthesizePoliciesWithOptions() error = %v", err)
+			}
+
+			var names []string
+			for _, policy := range policies {
+				names = append(names, policy.Metadata.Name)
+			}
+			sort.Strings(names)
+			if !reflect.DeepEqual(names, tt.expected) {
+				t.Errorf("Policy names = %v, want %v", names, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSynthesizePoliciesClusterWide(t *testing.T) {
+	flows := []*hubble.ParsedFlow{
+		{
+			SourceLabels:    map[string]string{"k8s:app": "prometheus"},
+			SourceNamespace: "monitoring",
+			DestLabels:      map[string]string{"k8s:app": "catalog"},
+			DestNamespace:   "shop",
+			DestPort:        9090,
+			Protocol:        "TCP",
+		},
+	}
+
+	policies, err := SynthesizePoliciesWithOptions(flows, Options{ClusterWide: true})
+	if err != nil {
+		t.Fatalf("SynthesizePoliciesWithOptions() error = %v", err)
+	}
+	if len(policies) != 1 {
+		t.Fatalf("Expected 1 policy, got %d", len(policies))
+	}
+
+	policy := policies[0]
+	if policy.Kind != "CiliumClusterwideNetworkPolicy" {
+		t.Errorf("Expected kind CiliumClusterwideNetworkPolicy, got %s", policy.Kind)
+	}
+	if policy.Metadata.Namespace != "" {
+		t.Errorf("Expected no namespace, got '%s'", policy.Metadata.Namespace)
+	}
+	if policy.Metadata.Name != "shop-catalog-policy" {
+		t.Errorf("Expected name 'shop-catalog-policy', got '%s'", policy.Metadata.Name)
+	}
+	if policy.Spec.EndpointSelector.MatchLabels["k8s:io.kubernetes.pod.namespace"] != "shop" {
+		t.Errorf("Expected endpointSelector qualified with namespace 'shop', got %v", policy.Spec.EndpointSelector.MatchLabels)
+	}
+
+	from := policy.Spec.Ingress[0].FromEndpoints[0].MatchLabels
+	if from["k8s:io.kubernetes.pod.namespace"] != "monitoring" || from["k8s:app"] != "prometheus" {
+		t.Errorf("Expected fromEndpoints qualified with namespace 'monitoring', got %v", from)
+	}
+
+	yamlStr, err := PolicyToYAML(policy)
+	if err != nil {
+		t.Fatalf("PolicyToYAML() error = %v", err)
+	}
+	if strings.Contains(yamlStr, "\n    namespace:") {
+		t.Errorf("Expected metadata.namespace to be omitted, got:\n%s", yamlStr)
+	}
+}
+
+func TestSynthesizePoliciesPolicyNamespace(t *testing.T) {
+	flows := []*hubble.ParsedFlow{
+		{
+			SourceLabels:    map[string]string{"k8s:app": "frontend"},
+			SourceNamespace: "web",
+			DestLabels:      map[string]string{"k8s:app": "catalog"},
+			DestNamespace:   "shop",
+			DestPort:        8080,
+			Protocol:        "TCP",
+		},
+		{
+			SourceLabels:    map[string]string{"k8s:app": "catalog"},
+			SourceNamespace: "shop",
+			DestLabels:      map[string]string{"k8s:app": "database"},
+			DestNamespace:   "data",
+			DestPort:        5432,
+			Protocol:        "TCP",
+		},
+	}
+
+	policies, err := SynthesizePoliciesWithOptions(flows, Options{PolicyNamespace: "policies"})
+	if err != nil {
+		t.Fatalf("SynthesizePoliciesWithOptions() error = %v", err)
+	}
+	if len(policies) != 2 {
+		t.Fatalf("Expected 2 policies, got %d", len(policies))
+	}
+
+	// Selectors keep to the endpoints' namespaces, peers included
+	expected := []struct {
+		name     string
+		selector map[string]string
+		source   map[string]string
+	}{
+		{
+			name:     "data-database-policy",
+			selector: map[string]string{"k8s:app": "database", ciliumNamespaceLabel: "data"},
+			source:   map[string]string{"k8s:app": "catalog", ciliumNamespaceLabel: "shop"},
+		},
+		{
+			name:     "shop-catalog-policy",
+			selector: map[string]string{"k8s:app": "catalog", ciliumNamespaceLabel: "shop"},
+			source:   map[string]string{"k8s:app": "frontend", ciliumNamespaceLabel: "web"},
+		},
+	}
+	for i, policy := range policies {
+		want := expected[i]
+		if policy.Metadata.Namespace != "policies" || policy.Metadata.Name != want.name {
+			t.Errorf("Policy = %s/%s, want policies/%s", policy.Metadata.Namespace, policy.Metadata.Name, want.name)
+		}
+		if !reflect.DeepEqual(policy.Spec.EndpointSelector.MatchLabels, want.selector) {
+			t.Errorf("%s: endpointSelector = %v, want %v", want.name, policy.Spec.EndpointSelector.MatchLabels, want.selector)
+		}
+		if source := policy.Spec.Ingress[0].FromEndpoints[0].MatchLabels; !reflect.DeepEqual(source, want.source) {
+			t.Errorf("%s: fromEndpoints = %v, want %v", want.name, source, want.source)
+		}
+	}
+
+	if _, err := SynthesizePoliciesWithOptions(flows, Options{PolicyNamespace: "policies", ClusterWide: true}); err == nil {
+		t.Error("Expected an error combining a policy namespace with cluster-wide policies")
+	}
+}
+
+func TestSynthesizePoliciesHostNetwork(t *testing.T) {
+	flows := []*hubble.ParsedFlow{
+		// Host-network pod (e.g. a kubelet probe) talking to a regular pod
+		{
+			SourceLabels:    map[string]string{"reserved:host": ""},
+			SourceNamespace: "kube-system",
+			SourceEntity:    "host",
+			DestLabels:      map[string]string{"k8s:app": "catalog"},
+			DestNamespace:   "default",
+			DestPort:        8080,
+			Protocol:        "TCP",
+		},
+		// Regular pod talking to a host-network pod
+		{
+			SourceLabels:    map[string]string{"k8s:app": "catalog"},
+			SourceNamespace: "default",
+			DestLabels:      map[string]string{"reserved:host": ""},
+			DestNamespace:   "kube-system",
+			DestEntity:      "host",
+			DestPort:        9100,
+			Protocol:        "TCP",
+		},
+	}
+
+	policies, err := SynthesizePolicies(flows)
+	if err != nil {
+		t.Fatalf("SynthesizePolicies() error = %v", err)
+	}
+	if len(policies) != 1 {
+		t.Fatalf("Expected 1 policy (none selecting the host), got %d", len(policies))
+	}
+
+	policy := policies[0]
+	if policy.Metadata.Name != "catalog-policy" {
+		t.Errorf("Expected policy name 'catalog-policy', got '%s'", policy.Metadata.Name)
+	}
+	if len(policy.Spec.Ingress) != 1 {
+		t.Fatalf("Expected 1 ingress rule, got %d", len(policy.Spec.Ingress))
+	}
+	rule := policy.Spec.Ingress[0]
+	if len(rule.FromEndpoints) != 0 {
+		t.Errorf("Expected no fromEndpoints for host source, got %v", rule.FromEndpoints)
+	}
+	if len(rule.FromEntities) != 1 || rule.FromEntities[0] != "host" {
+		t.Errorf("Expected fromEntities [host], got %v", rule.FromEntities)
+	}
+}
+
+func TestSynthesizePoliciesExternalClients(t *testing.T) {
+	flows := []*hubble.ParsedFlow{
+		// External clients reaching an ingress gateway, with and without
+		// Cilium's world identity label
+		{
+			SourceIP:      "203.0.113.10",
+			SourceLabels:  map[string]string{"reserved:world": ""},
+			DestLabels:    map[string]string{"k8s:app": "gateway"},
+			DestNamespace: "default",
+			DestPort:      443,
+			Protocol:      "TCP",
+		},
+		{
+			SourceIP:      "2001:db8::7",
+			DestLabels:    map[string]string{"k8s:app": "gateway"},
+			DestNamespace: "default",
+			DestPort:      443,
+			Protocol:      "TCP",
+		},
+		{
+			SourceIP:      "203.0.113.10",
+			DestLabels:    map[string]string{"k8s:app": "gateway"},
+			DestNamespace: "default",
+			DestPort:      80,
+			Protocol:      "TCP",
+		},
+		// A second world client on the same port must survive deduplication
+		{
+			SourceIP:      "198.51.100.20",
+			SourceLabels:  map[string]string{"reserved:world": ""},
+			DestLabels:    map[string]string{"k8s:app": "gateway"},
+			DestNamespace: "default",
+			DestPort:      443,
+			Protocol:      "TCP",
+		},
+	}
+
+	tests := []struct {
+		name     string
+		opts     Options
+		expected []IngressRule
+	}{
+		{
+			name: "one fromCIDR rule per client by default",
+			expected: []IngressRule{
+				{FromCIDR: []string{"198.51.100.20/32"}, ToPorts: []PortRule{{Ports: []PortProtocol{{Port: "443", Protocol: "TCP"}}}}},
+				{FromCIDR: []string{"2001:db8::7/128"}, ToPorts: []PortRule{{Ports: []PortProtocol{{Port: "443", Protocol: "TCP"}}}}},
+				{FromCIDR: []string{"203.0.113.10/32"}, ToPorts: []PortRule{{Ports: []PortProtocol{{Port: "80", Protocol: "TCP"}, {Port: "443", Protocol: "TCP"}}}}},
+			},
+		},
+		{
+			name: "world entity for every client",
+			opts: Options{ExternalIngress: ExternalIngressWorld},
+			expected: []IngressRule{
+				{FromEntities: []string{"world"}, ToPorts: []PortRule{{Ports: []PortProtocol{{Port: "80", Protocol: "TCP"}, {Port: "443", Protocol: "TCP"}}}}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policies, err := SynthesizePoliciesWithOptions(hubble.DeduplicateFlows(flows), tt.opts)
+			if err != nil {
+				t.Fatalf("SynthesizePoliciesWithOptions() error = %v", err)
+			}
+			if len(policies) != 1 {
+				t.Fatalf("Expected 1 policy, got %d", len(policies))
+			}
+			if ingress := policies[0].Spec.Ingress; !reflect.DeepEqual(ingress, tt.expected) {
+				t.Errorf("Ingress = %+v, want %+v", ingress, tt.expected)
+			}
+
+			// The policy passes verify and allows the observed flows
+			path := filepath.Join(t.TempDir(), "policy.yaml")
+			if err := WritePoliciesToFile(policies, path); err != nil {
+				t.Fatalf("WritePoliciesToFile() error = %v", err)
+			}
+			result, err := verify.VerifyPolicies(path)
+			if err != nil {
+				t.Fatalf("VerifyPolicies() error = %v", err)
+			}
+			if !result.Valid {
+				t.Errorf("Expected a valid policy, got errors: %v", result.Errors)
+			}
+		})
+	}
+}
+
+func TestContributesRule(t *testing.T) {
+	catalog := map[string]string{"k8s:app": "catalog"}
+	frontend := map[string]string{"k8s:app": "frontend"}
+
+	tests := []struct {
+		name     string
+		flow     *hubble.ParsedFlow
+		expected bool
+	}{
+		{
+			name:     "pod to pod",
+			flow:     &hubble.ParsedFlow{SourceLabels: frontend, SourceNamespace: "shop", DestLabels: catalog, DestNamespace: "shop", DestPort: 8080, Protocol: "TCP"},
+			expected: true,
+		},
+		{
+			name:     "external client",
+			flow:     &hubble.ParsedFlow{SourceIP: "203.0.113.10", DestLabels: catalog, DestNamespace: "shop", DestPort: 8080, Protocol: "TCP"},
+			expected: true,
+		},
+		{
+			name:     "pod to external destination",
+			flow:     &hubble.ParsedFlow{SourceLabels: catalog, SourceNamespace: "shop", DestLabels: map[string]string{"reserved:world": ""}, DestDNSName: "api.github.com", DestPort: 443, Protocol: "TCP"},
+			expected: true,
+		},
+		{
+			name:     "pod to host",
+			flow:     &hubble.ParsedFlow{SourceLabels: catalog, SourceNamespace: "shop", DestEntity: "host", DestPort: 10250, Protocol: "TCP"},
+			expected: true,
+		},
+		{
+			name: "reply",
+			flow: &hubble.ParsedFlow{SourceLabels: catalog, SourceNamespace: "shop", DestLabels: frontend, DestNamespace: "shop", DestPort: 41000, Protocol: "TCP", IsReply: true},
+		},
+		{
+			name: "no port",
+			flow: &hubble.ParsedFlow{SourceLabels: frontend, SourceNamespace: "shop", DestLabels: catalog, DestNamespace: "shop"},
+		},
+		{
+			name: "no source",
+			flow: &hubble.ParsedFlow{DestLabels: catalog, DestNamespace: "shop", DestPort: 8080, Protocol: "TCP"},
+		},
+		{
+			name: "no destination",
+			flow: &hubble.ParsedFlow{SourceLabels: frontend, SourceNamespace: "shop", DestPort: 8080, Protocol: "TCP"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := ContributesRule(tt.flow); result != tt.expected {
+				t.Errorf("ContributesRule() = %v, want %v", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSynthesizePoliciesL7(t *testing.T) {
+	flows := []*hubble.ParsedFlow{
+		{
+			SourceLabels:    map[string]string{"k8s:app": "frontend"},
+			SourceNamespace: "default",
+			DestLabels:      map[string]string{"k8s:app": "catalog"},
+			DestNamespace:   "default",
+			DestPort:        8080,
+			Protocol:        "TCP",
+			HTTPMethod:      "GET",
+			HTTPPath:        "/api/v1",
+		},
+		// L3/L4-only flow on another port keeps a plain port rule
+		{
+			SourceLabels:    map[string]string{"k8s:app": "frontend"},
+			SourceNamespace: "default",
+			DestLabels:      map[string]string{"k8s:app": "catalog"},
+			DestNamespace:   "default",
+			DestPort:        9090,
+			Protocol:        "TCP",
+		},
+	}
+
+	t.Run("disabled by default", func(t *testing.T) {
+		policies, err := SynthesizePolicies(flows)
+		if err != nil {
+			t.Fatalf("SynthesizePolicies() error = %v", err)
+		}
+		for _, portRule := range policies[0].Spec.Ingress[0].ToPorts {
+			if portRule.Rules != nil {
+				t.Errorf("Expected no L7 rules without L7 option, got %+v", portRule.Rules)
+			}
+		}
+	})
+
+	t.Run("GET /api/v1 yields http rule", func(t *testing.T) {
+		policies, err := SynthesizePoliciesWithOptions(flows, Options{L7: true})
+		if err != nil {
+			t.Fatalf("SynthesizePoliciesWithOptions() error = %v", err)
+		}
+		if len(policies) != 1 || len(policies[0].Spec.Ingress) != 1 {
+			t.Fatalf("Expected 1 policy with 1 ingress rule, got %+v", policies)
+		}
+
+		toPorts := policies[0].Spec.Ingress[0].ToPorts
+		if len(toPorts) != 2 {
+			t.Fatalf("Expected 2 port rules (L4 and L7), got %+v", toPorts)
+		}
+		if toPorts[0].Rules != nil || len(toPorts[0].Ports) != 1 || toPorts[0].Ports[0].Port != "9090" {
+			t.Errorf("Expected plain port rule for 9090, got %+v", toPorts[0])
+		}
+
+		l7 := toPorts[1]
+		if len(l7.Ports) != 1 || l7.Ports[0].Port != "8080" {
+			t.Errorf("Expected L7 port rule for 8080, got %+v", l7.Ports)
+		}
+		if l7.Rules == nil || len(l7.Rules.HTTP) != 1 {
+			t.Fatalf("Expected 1 http rule, got %+v", l7.Rules)
+		}
+		if l7.Rules.HTTP[0].Method != "GET" || l7.Rules.HTTP[0].Path != "/api/v1" {
+			t.Errorf("Expected GET /api/v1, got %+v", l7.Rules.HTTP[0])
+		}
+
+		yamlStr, err := PolicyToYAML(policies[0])
+		if err != nil {
+			t.Fatalf("PolicyToYAML() error = %v", err)
+		}
+		if !strings.Contains(yamlStr, "rules:\n") || !strings.Contains(yamlStr, "http:\n") || !strings.Contains(yamlStr, "path: /api/v1") {
+			t.Errorf("Expected rules.http block in YAML, got:\n%s", yamlStr)
+		}
+	})
+}
+
+func TestSynthesizePoliciesCollapsePorts(t *testing.T) {
+	var flows []*hubble.ParsedFlow
+	for _, port := range []uint16{8083, 8080, 8082, 8081, 9090} {
+		flows = append(flows, &hubble.ParsedFlow{
+			SourceLabels:    map[string]string{"k8s:app": "frontend"},
+			SourceNamespace: "default",
+			DestLabels:      map[string]string{"k8s:app": "catalog"},
+			DestNamespace:   "default",
+			DestPort:        port,
+			Protocol:        "TCP",
+		})
+	}
+
+	tests := []struct {
+		name     string
+		opts     Options
+		expected []PortProtocol
+	}{
+		{
+			name: "disabled by default",
+			opts: Options{},
+			expected: []PortProtocol{
+				{Port: "8080", Protocol: "TCP"},
+				{Port: "8081", Protocol: "TCP"},
+				{Port: "8082", Protocol: "TCP"},
+				{Port: "8083", Protocol: "TCP"},
+				{Port: "9090", Protocol: "TCP"},
+			},
+		},
+		{
+			name: "8080-8083 collapse into one entry",
+			opts: Options{CollapsePorts: true},
+			expected: []PortProtocol{
+				{Port: "8080", EndPort: 8083, Protocol: "TCP"},
+				{Port: "9090", Protocol: "TCP"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policies, err := SynthesizePoliciesWithOptions(flows, tt.opts)
+			if err != nil {
+				t.Fatalf("SynthesizePoliciesWithOptions() error = %v", err)
+			}
+			toPorts := policies[0].Spec.Ingress[0].ToPorts
+			if len(toPorts) != 1 {
+				t.Fatalf("Expected 1 port rule, got %+v", toPorts)
+			}
+			if len(toPorts[0].Ports) != len(tt.expected) {
+				t.Fatalf("Ports = %+v, want %+v", toPorts[0].Ports, tt.expected)
+			}
+			for i, pp := range toPorts[0].Ports {
+				if pp != tt.expected[i] {
+					t.Errorf("Ports[%d] = %+v, want %+v", i, pp, tt.expected[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSynthesizePoliciesMixedProtocols(t *testing.T) {
+	var flows []*hubble.ParsedFlow
+	for _, traffic := range []struct {
+		port     uint16
+		protocol string
+	}{{80, "TCP"}, {53, "UDP"}, {80, "TCP"}, {1000, "TCP"}} {
+		flows = append(flows, &hubble.ParsedFlow{
+			SourceLabels:    map[string]string{"k8s:app": "frontend"},
+			SourceNamespace: "default",
+			DestLabels:      map[string]string{"k8s:app": "gateway"},
+			DestNamespace:   "default",
+			DestPort:        traffic.port,
+			Protocol:        traffic.protocol,
+		})
+	}
+
+	policies, err := SynthesizePolicies(flows)
+	if err != nil {
+		t.Fatalf("SynthesizePolicies() error = %v", err)
+	}
+	if len(policies) != 1 || len(policies[0].Spec.Ingress) != 1 {
+		t.Fatalf("Expected 1 policy with 1 ingress rule, got %+v", policies)
+	}
+
+	// Ports sort numerically, so 1000 follows 80
+	toPorts := policies[0].Spec.Ingress[0].ToPorts
+	expected := []PortRule{{Ports: []PortProtocol{
+		{Port: "53", Protocol: "UDP"},
+		{Port: "80", Protocol: "TCP"},
+		{Port: "1000", Protocol: "TCP"},
+	}}}
+	if !reflect.DeepEqual(toPorts, expected) {
+		t.Errorf("ToPorts = %+v, want %+v", toPorts, expected)
+	}
+}
+
+func TestSynthesizePoliciesNamedPortsAndSCTP(t *testing.T) {
+	collection := &hubble.FlowCollection{Flows: []*hubble.Flow{
+		{
+			Source: &hubble.Endpoint{Labels: []string{"k8s:app=frontend"}, Namespace: "core"},
+			Destination: &hubble.Endpoint{
+				Labels:     []string{"k8s:app=hss"},
+				Namespace:  "core",
+				NamedPorts: []hubble.NamedPort{{Name: "http", Port: 8080}},
+			},
+			L4: &hubble.Layer4{TCP: &hubble.TCP{DestinationPort: 8080}},
+		},
+		{
+			Source:      &hubble.Endpoint{Labels: []string{"k8s:app=mme"}, Namespace: "core"},
+			Destination: &hubble.Endpoint{Labels: []string{"k8s:app=hss"}, Namespace: "core"},
+			L4:          &hubble.Layer4{SCTP: &hubble.SCTP{DestinationPort: 3868}},
+		},
+	}}
+	flows, err := hubble.ParseFlows(collection)
+	if err != nil {
+		t.Fatalf("ParseFlows() error = %v", err)
+	}
+
+	policies, err := SynthesizePolicies(flows)
+	if err != nil {
+		t.Fatalf("SynthesizePolicies() error = %v", err)
+	}
+	if len(policies) != 1 || len(policies[0].Spec.Ingress) != 2 {
+		t.Fatalf("Expected 1 policy with 2 ingress rules, got %+v", policies)
+	}
+
+	var ports []PortProtocol
+	for _, rule := range policies[0].Spec.Ingress {
+		ports = append(ports, rule.ToPorts[0].Ports...)
+	}
+	expected := []PortProtocol{{Port: "http", Protocol: "TCP"}, {Port: "3868", Protocol: "SCTP"}}
+	if !reflect.DeepEqual(ports, expected) {
+		t.Errorf("Ingress ports = %+v, want %+v", ports, expected)
+	}
+
+	// The policy passes verify as written
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := WritePoliciesToFile(policies, path); err != nil {
+		t.Fatalf("WritePoliciesToFile() error = %v", err)
+	}
+	result, err := verify.VerifyPolicies(path)
+	if err != nil {
+		t.Fatalf("VerifyPolicies() error = %v", err)
+	}
+	if !result.Valid {
+		t.Errorf("Expected a valid policy, got errors: %v", result.Errors)
+	}
+}
+
+func TestSynthesizePoliciesDefaultDeny(t *testing.T) {
+	flow := func(source, dest string) *hubble.ParsedFlow {
+		return &hubble.ParsedFlow{
+			SourceLabels:    map[string]string{"k8s:app": source},
+			SourceNamespace: "default",
+			DestLabels:      map[string]string{"k8s:app": dest},
+			DestNamespace:   "default",
+			DestPort:        8080,
+			Protocol:        "TCP",
+		}
+	}
+	flows := []*hubble.ParsedFlow{flow("frontend", "catalog"), flow("checkout", "catalog"), flow("frontend", "cart")}
+
+	policies, err := SynthesizePoliciesWithOptions(flows, Options{DefaultDeny: true})
+	if err != nil {
+		t.Fatalf("SynthesizePoliciesWithOptions() error = %v", err)
+	}
+
+	var names []string
+	for _, policy := range policies {
+		names = append(names, policy.Metadata.Name)
+	}
+	expected := []string{"cart-policy", "catalog-policy", "cart-policy-default-deny", "catalog-policy-default-deny"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Fatalf("Policies = %v, want %v", names, expected)
+	}
+
+	companion := policies[3]
+	if !companion.Spec.EnforcesIngress() || !companion.Spec.EnforcesEgress() || len(companion.Spec.Ingress) != 0 || len(companion.Spec.Egress) != 0 {
+		t.Errorf("Expected a companion without rules, got %+v", companion.Spec)
+	}
+	if !reflect.DeepEqual(companion.Spec.EndpointSelector, policies[1].Spec.EndpointSelector) {
+		t.Errorf("Companion selector = %+v, want %+v", companion.Spec.EndpointSelector, policies[1].Spec.EndpointSelector)
+	}
+
+	written, err := PolicyToYAML(companion)
+	if err != nil {
+		t.Fatalf("PolicyToYAML() error = %v", err)
+	}
+	if want := "enableDefaultDeny:\n        ingress: true\n        egress: true\n"; !strings.Contains(written, want) {
+		t.Errorf("Companion YAML missing %q:\n%s", want, written)
+	}
+	if strings.Contains(written, "ingress: []") || strings.Contains(written, "egress: []") {
+		t.Errorf("Expected no empty rule lists, Cilium ignores them:\n%s", written)
+	}
+
+	// The field survives a round trip through YAML
+	var parsed Policy
+	if err := yaml.Unmarshal([]byte(written), &parsed); err != nil {
+		t.Fatalf("yaml.Unmarshal() error = %v", err)
+	}
+	if !parsed.Spec.EnforcesIngress() || !parsed.Spec.EnforcesEgress() {
+		t.Errorf("Parsed companion spec = %+v, want default-deny in both directions", parsed.Spec)
+	}
+
+	// Without the option, no companions are generated
+	policies, err = SynthesizePolicies(flows)
+	if err != nil {
+		t.Fatalf("SynthesizePolicies() error = %v", err)
+	}
+	if len(policies) != 2 {
+		t.Errorf("Expected 2 policies without DefaultDeny, got %d", len(policies))
+	}
+}
+
+func TestSynthesizePoliciesMinFlows(t *testing.T) {
+	flow := func(source string, port uint16, count int) *hubble.ParsedFlow {
+		return &hubble.ParsedFlow{
+			SourceLabels:    map[string]string{"k8s:app": source},
+			SourceNamespace: "default",
+			DestLabels:      map[string]string{"k8s:app": "catalog"},
+			DestNamespace:   "default",
+			DestPort:        port,
+			Protocol:        "TCP",
+			Count:           count,
+		}
+	}
+	flows := []*hubble.ParsedFlow{
+		flow("frontend", 8080, 40),
+		flow("frontend", 9090, 1),
+		flow("debug", 8080, 2),
+		// Counts add up across entries for the same source and port
+		flow("debug", 8080, 1),
+	}
+
+	tests := []struct {
+		name       string
+		minFlows   int
+		ports      map[string][]string
+		suppressed []string
+	}{
+		{
+			name:     "default keeps every connection",
+			minFlows: 0,
+			ports:    map[string][]string{"debug": {"8080"}, "frontend": {"8080", "9090"}},
+		},
+		{
+			name:       "single flows are suppressed",
+			minFlows:   2,
+			ports:      map[string][]string{"debug": {"8080"}, "frontend": {"8080"}},
+			suppressed: []string{"default/k8s:app=frontend -> default/k8s:app=catalog on 9090/TCP (1 flow)"},
+		},
+		{
+			name:     "whole sources are dropped below the threshold",
+			minFlows: 10,
+			ports:    map[string][]string{"frontend": {"8080"}},
+			suppressed: []string{
+				"default/k8s:app=debug -> default/k8s:app=catalog on 8080/TCP (3 flows)",
+				"default/k8s:app=frontend -> default/k8s:app=catalog on 9090/TCP (1 flow)",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policies, suppressed, err := SynthesizePoliciesWithSuppressed(flows, Options{MinFlows: tt.minFlows})
+			if err != nil {
+				t.Fatalf("SynthesizePoliciesWithSuppressed() error = %v", err)
+			}
+			if len(policies) != 1 {
+				t.Fatalf("Expected 1 policy, got %d", len(policies))
+			}
+
+			ports := make(map[string][]string)
+			for _, rule := range policies[0].Spec.Ingress {
+				source := rule.FromEndpoints[0].MatchLabels["k8s:app"]
+				for _, pp := range rule.ToPorts[0].Ports {
+					ports[source] = append(ports[source], pp.Port)
+				}
+			}
+			if !reflect.DeepEqual(ports, tt.ports) {
+				t.Errorf("ports = %v, want %v", ports, tt.ports)
+			}
+
+			var descriptions []string
+			for _, rule := range suppressed {
+				descriptions = append(descriptions, rule.String())
+			}
+			if !reflect.DeepEqual(descriptions, tt.suppressed) {
+				t.Errorf("suppressed = %q, want %q", descriptions, tt.suppressed)
+			}
+		})
+	}
+}
+
+func TestSynthesizePoliciesMinFlowsDeduplicated(t *testing.T) {
+	flow := func(source string, port uint16) *hubble.ParsedFlow {
+		return &hubble.ParsedFlow{
+			SourceLabels:    map[string]string{"k8s:app": source},
+			SourceNamespace: "default",
+			DestLabels:      map[string]string{"k8s:app": "catalog"},
+			DestNamespace:   "default",
+			DestPort:        port,
+			Protocol:        "TCP",
+		}
+	}
+	raw := []*hubble.ParsedFlow{
+		flow("debug", 8080),
+		flow("debug", 8080),
+		flow("debug", 8080),
+		flow("frontend", 9090),
+	}
+
+	// A capture written by learn --dedupe keeps one copy of each distinct
+	// flow, without the number of flows it stood for
+	dedup := hubble.NewFlowDeduper()
+	var learned []*hubble.ParsedFlow
+	for _, flow := range raw {
+		if dedup.Add(flow) {
+			learned = append(learned, flow)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		flows      []*hubble.ParsedFlow
+		ingress    int
+		suppressed []string
+	}{
+		{
+			name:       "raw capture",
+			flows:      raw,
+			ingress:    1,
+			suppressed: []string{"default/k8s:app=frontend -> default/k8s:app=catalog on 9090/TCP (1 flow)"},
+		},
+		{
+			// Merged entries count for every flow they stand for
+			name:       "deduplicated in memory",
+			flows:      hubble.DeduplicateFlows(raw),
+			ingress:    1,
+			suppressed: []string{"default/k8s:app=frontend -> default/k8s:app=catalog on 9090/TCP (1 flow)"},
+		},
+		{
+			name:    "learn --dedupe capture",
+			flows:   learned,
+			ingress: 0,
+			suppressed: []string{
+				"default/k8s:app=debug -> default/k8s:app=catalog on 8080/TCP (1 flow)",
+				"default/k8s:app=frontend -> default/k8s:app=catalog on 9090/TCP (1 flow)",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policies, suppressed, err := SynthesizePoliciesWithSuppressed(tt.flows, Options{MinFlows: 3})
+			if err != nil {
+				t.Fatalf("SynthesizePoliciesWithSuppressed() error = %v", err)
+			}
+			ingress := 0
+			for _, policy := range policies {
+				ingress += len(policy.Spec.Ingress)
+			}
+			if ingress != tt.ingress {
+				t.Errorf("Expected %d ingress rules, got %d", tt.ingress, ingress)
+			}
+
+			var descriptions []string
+			for _, rule := range suppressed {
+				descriptions = append(descriptions, rule.String())
+			}
+			if !reflect.DeepEqual(descriptions, tt.suppressed) {
+				t.Errorf("suppressed = %q, want %q", descriptions, tt.suppressed)
+			}
+		})
+	}
+}
+
+func TestSynthesizePoliciesSkipIntraNamespace(t *testing.T) {
+	flows := []*hubble.ParsedFlow{
+		{
+			SourceLabels:    map[string]string{"k8s:app": "frontend"},
+			SourceNamespace: "shop",
+			DestLabels:      map[string]string{"k8s:app": "catalog"},
+			DestNamespace:   "shop",
+			DestPort:        8080,
+			Protocol:        "TCP",
+		},
+		{
+			SourceLabels:    map[string]string{"k8s:app": "gateway"},
+			SourceNamespace: "ingress",
+			DestLabels:      map[string]string{"k8s:app": "catalog"},
+			DestNamespace:   "shop",
+			DestPort:        8080,
+			Protocol:        "TCP",
+		},
+		{
+			SourceLabels:    map[string]string{"k8s:app": "catalog"},
+			SourceNamespace: "shop",
+			DestLabels:      map[string]string{"k8s:app": "database"},
+			DestNamespace:   "shop",
+			DestPort:        5432,
+			Protocol:        "TCP",
+		},
+		{
+			SourceLabels:    map[string]string{"k8s:app": "catalog"},
+			SourceNamespace: "shop",
+			DestLabels:      map[string]string{"reserved:world": ""},
+			DestIP:          "203.0.113.10",
+			DestPort:        443,
+			Protocol:        "TCP",
+		},
+	}
+
+	tests := []struct {
+		name     string
+		opts     Options
+		policies []string
+		sources  []string
+	}{
+		{
+			name:     "all traffic by default",
+			opts:     Options{},
+			policies: []string{"catalog-policy", "database-policy"},
+			sources:  []string{"k8s:app=frontend", "k8s:app=gateway,k8s:io.kubernetes.pod.namespace=ingress"},
+		},
+		{
+			// Traffic within shop is allowed wholesale rather than denied
+			name:     "only cross-namespace and external traffic",
+			opts:     Options{SkipIntraNamespace: true},
+			policies: []string{"catalog-policy"},
+			sources:  []string{"k8s:app=gateway,k8s:io.kubernetes.pod.namespace=ingress", "k8s:io.kubernetes.pod.namespace=shop"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policies, err := SynthesizePoliciesWithOptions(flows, tt.opts)
+			if err != nil {
+				t.Fatalf("SynthesizePoliciesWithOptions() error = %v", err)
+			}
+
+			var names []string
+			for _, policy := range policies {
+				names = append(names, policy.Metadata.Name)
+			}
+			if !reflect.DeepEqual(names, tt.policies) {
+				t.Fatalf("policies = %v, want %v", names, tt.policies)
+			}
+
+			catalog := policies[0]
+			var sources []string
+			for _, rule := range catalog.Spec.Ingress {
+				sources = append(sources, formatSelector(rule.FromEndpoints[0]))
+			}
+			if !reflect.DeepEqual(sources, tt.sources) {
+				t.Errorf("catalog sources = %v, want %v", sources, tt.sources)
+			}
+
+			// The external egress rule is kept either way
+			external := slices.ContainsFunc(catalog.Spec.Egress, func(rule EgressRule) bool {
+				return reflect.DeepEqual(rule.ToCIDR, []string{"203.0.113.10/32"})
+			})
+			if !external {
+				t.Errorf("Expected external egress rule, got %+v", catalog.Spec.Egress)
+			}
+		})
+	}
+}
+
+func TestSynthesizePoliciesCrossNamespaceSource(t *testing.T) {
+	newFlow := func(sourceNamespace string) *hubble.ParsedFlow {
+		return &hubble.ParsedFlow{
+			SourceLabels:    map[string]string{"k8s:app": "frontend"},
+			SourceNamespace: sourceNamespace,
+			DestLabels:      map[string]string{"k8s:app": "catalog"},
+			DestNamespace:   "shop",
+			DestPort:        8080,
+			Protocol:        "TCP",
+		}
+	}
+
+	tests := []struct {
+		name     string
+		flow     *hubble.ParsedFlow
+		opts     Options
+		expected map[string]string
+	}{
+		{
+			name:     "same namespace",
+			flow:     newFlow("shop"),
+			expected: map[string]string{"k8s:app": "frontend"},
+		},
+		{
+			name:     "different namespace",
+			flow:     newFlow("web"),
+			expected: map[string]string{"k8s:app": "frontend", ciliumNamespaceLabel: "web"},
+		},
+		{
+			name:     "same namespace moved by policy namespace",
+			flow:     newFlow("shop"),
+			opts:     Options{PolicyNamespace: "security"},
+			expected: map[string]string{"k8s:app": "frontend", ciliumNamespaceLabel: "shop"},
+		},
+		{
+			name:     "different namespace moved into source namespace",
+			flow:     newFlow("web"),
+			opts:     Options{PolicyNamespace: "web"},
+			expected: map[string]string{"k8s:app": "frontend"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policies, err := SynthesizePoliciesWithOptions([]*hubble.ParsedFlow{tt.flow}, tt.opts)
+			if err != nil {
+				t.Fatalf("SynthesizePoliciesWithOptions() error = %v", err)
+			}
+			if len(policies) != 1 || len(policies[0].Spec.Ingress) != 1 {
+				t.Fatalf("Expected 1 policy with 1 ingress rule, got %+v", policies)
+			}
+
+			selector := policies[0].Spec.Ingress[0].FromEndpoints[0].MatchLabels
+			if !reflect.DeepEqual(selector, tt.expected) {
+				t.Errorf("fromEndpoints matchLabels = %v, want %v", selector, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSynthesizePoliciesCrossNamespaceWildcard(t *testing.T) {
+	newFlow := func(app, namespace string, port uint16) *hubble.ParsedFlow {
+		return &hubble.ParsedFlow{
+			SourceLabels:    map[string]string{"k8s:app": app, ciliumNamespaceLabel: namespace},
+			SourceNamespace: namespace,
+			DestLabels:      map[string]string{"k8s:app": "catalog"},
+			DestNamespace:   "shop",
+			DestPort:        port,
+			Protocol:        "TCP",
+		}
+	}
+	// frontend runs in three namespaces; gateway and checkout in one each
+	flows := []*hubble.ParsedFlow{
+		newFlow("frontend", "web", 8080),
+		newFlow("frontend", "mobile", 8080),
+		newFlow("frontend", "partner", 9090),
+		newFlow("gateway", "ingress", 8080),
+		newFlow("checkout", "shop", 8080),
+	}
+
+	tests := []struct {
+		name     string
+		opts     Options
+		expected []string
+	}{
+		{
+			name: "a rule per namespace by default",
+			expected: []string{
+				"k8s:app=checkout,k8s:io.kubernetes.pod.namespace=shop",
+				"k8s:app=frontend,k8s:io.kubernetes.pod.namespace=mobile",
+				"k8s:app=frontend,k8s:io.kubernetes.pod.namespace=partner",
+				"k8s:app=frontend,k8s:io.kubernetes.pod.namespace=web",
+				"k8s:app=gateway,k8s:io.kubernetes.pod.namespace=ingress",
+			},
+		},
+		{
+			name: "one rule for any namespace",
+			opts: Options{CrossNamespaceWildcard: true},
+			expected: []string{
+				"k8s:app=checkout,k8s:io.kubernetes.pod.namespace=shop",
+				"k8s:app=frontend,k8s:io.kubernetes.pod.namespace Exists",
+				"k8s:app=gateway,k8s:io.kubernetes.pod.namespace=ingress",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policies, err := SynthesizePoliciesWithOptions(flows, tt.opts)
+			if err != nil {
+				t.Fatalf("SynthesizePoliciesWithOptions() error = %v", err)
+			}
+			if len(policies) != 1 {
+				t.Fatalf("Expected 1 policy, got %d", len(policies))
+			}
+
+			var sources []string
+			for _, rule := range policies[0].Spec.Ingress {
+				sources = append(sources, formatSelector(rule.FromEndpoints[0]))
+				if len(rule.FromEndpoints[0].MatchExpressions) > 0 && len(rule.ToPorts[0].Ports) != 2 {
+					t.Errorf("Expected the any-namespace rule to allow both ports, got %+v", rule.ToPorts)
+				}
+			}
+			sort.Strings(sources)
+			if !reflect.DeepEqual(sources, tt.expected) {
+				t.Errorf("Sources = %v, want %v", sources, tt.expected)
+			}
+
+			path := filepath.Join(t.TempDir(), "policy.yaml")
+			if err := WritePoliciesToFile(policies, path); err != nil {
+				t.Fatalf("WritePoliciesToFile() error = %v", err)
+			}
+			result, err := verify.VerifyPolicies(path)
+			if err != nil {
+				t.Fatalf("VerifyPolicies() error = %v", err)
+			}
+			if !result.Valid {
+				t.Errorf("Expected a valid policy, got errors: %v", result.Errors)
+			}
+		})
+	}
+}
+
+func TestCollapsePortRanges(t *testing.T) {
+	ports := []PortProtocol{
+		{Port: "53", Protocol: "UDP"},
+		{Port: "10000", Protocol: "TCP"},
+		{Port: "9999", Protocol: "TCP"},
+		{Port: "54", Protocol: "TCP"},
+		{Port: "53", Protocol: "TCP"},
+		{Port: "9997", EndPort: 9998, Protocol: "TCP"},
+		{Port: "http", Protocol: "TCP"},
+	}
+
+	expected := []PortProtocol{
+		{Port: "53", EndPort: 54, Protocol: "TCP"},
+		{Port: "9997", EndPort: 10000, Protocol: "TCP"},
+		{Port: "53", Protocol: "UDP"},
+		{Port: "http", Protocol: "TCP"},
+	}
+
+	result := collapsePortRanges(ports)
+	if len(result) != len(expected) {
+		t.Fatalf("collapsePortRanges() = %+v, want %+v", result, expected)
+	}
+	for i := range expected {
+		if result[i] != expected[i] {
+			t.Errorf("collapsePortRanges()[%d] = %+v, want %+v", i, result[i], expected[i])
+		}
+	}
+}
+
+func TestSynthesizePoliciesICMP(t *testing.T) {
+	flows := []*hubble.ParsedFlow{
+		{
+			SourceLabels:    map[string]string{"k8s:app": "probe"},
+			SourceNamespace: "default",
+			DestLabels:      map[string]string{"k8s:app": "catalog"},
+			DestNamespace:   "default",
+			Protocol:        "ICMP",
+			ICMPType:        8,
+		},
+		{
+			SourceLabels:    map[string]string{"k8s:app": "probe"},
+			SourceNamespace: "default",
+			DestLabels:      map[string]string{"k8s:app": "catalog"},
+			DestNamespace:   "default",
+			Protocol:        "ICMPv6",
+			ICMPType:        128,
+		},
+		{
+			SourceLabels:    map[string]string{"k8s:app": "probe"},
+			SourceNamespace: "default",
+			DestLabels:      map[string]string{"k8s:app": "catalog"},
+			DestNamespace:   "default",
+			DestPort:        8080,
+			Protocol:        "TCP",
+		},
+	}
+
+	policies, err := SynthesizePolicies(flows)
+	if err != nil {
+		t.Fatalf("SynthesizePolicies() error = %v", err)
+	}
+	if len(policies) != 1 || len(policies[0].Spec.Ingress) != 2 {
+		t.Fatalf("Expected 1 policy with a port rule and an ICMP rule, got %+v", policies)
+	}
+
+	portRule, icmpRule := policies[0].Spec.Ingress[0], policies[0].Spec.Ingress[1]
+	if len(portRule.ToPorts) != 1 || len(portRule.ToPorts[0].Ports) != 1 || portRule.ToPorts[0].Ports[0].Port != "8080" {
+		t.Errorf("Expected port rule for 8080 only, got %+v", portRule.ToPorts)
+	}
+	if len(portRule.ICMPs) != 0 {
+		t.Errorf("Expected no icmps in the port rule, got %+v", portRule.ICMPs)
+	}
+
+	if len(icmpRule.ToPorts) != 0 {
+		t.Errorf("Expected no toPorts in the ICMP rule, got %+v", icmpRule.ToPorts)
+	}
+	if len(icmpRule.FromEndpoints) != 1 || icmpRule.FromEndpoints[0].MatchLabels["k8s:app"] != "probe" {
+		t.Errorf("Expected ICMP rule from probe, got %+v", icmpRule.FromEndpoints)
+	}
+	expected := []ICMPField{{Type: 8}, {Family: "IPv6", Type: 128}}
+	if len(icmpRule.ICMPs) != 1 || len(icmpRule.ICMPs[0].Fields) != len(expected) {
+		t.Fatalf("Expected icmps fields %+v, got %+v", expected, icmpRule.ICMPs)
+	}
+	for i, field := range icmpRule.ICMPs[0].Fields {
+		if field != expected[i] {
+			t.Errorf("Fields[%d] = %+v, want %+v", i, field, expected[i])
+		}
+	}
+}
+
+func TestSynthesizePoliciesICMPFromHubble(t *testing.T) {
+	// An echo request as reported by hubble observe, and a flow whose L4
+	// section Hubble could not decode
+	input := `{"flow":{"source":{"labels":["k8s:app=probe"],"namespace":"default"},` +
+		`"destination":{"labels":["k8s:app=catalog"],"namespace":"default"},"l4":{"ICMPv4":{"type":8}},"verdict":"FORWARDED"}}
+{"flow":{"source":{"labels":["k8s:app=debug"],"namespace":"default"},` +
+		`"destination":{"labels":["k8s:app=catalog"],"namespace":"default"},"verdict":"FORWARDED"}}
+`
+	collection, err := hubble.ReadFlows(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ReadFlows() error = %v", err)
+	}
+	flows, err := hubble.ParseFlows(collection)
+	if err != nil {
+		t.Fatalf("ParseFlows() error = %v", err)
+	}
+
+	policies, err := SynthesizePolicies(flows)
+	if err != nil {
+		t.Fatalf("SynthesizePolicies() error = %v", err)
+	}
+	if len(policies) != 1 || len(policies[0].Spec.Ingress) != 1 {
+		t.Fatalf("Expected 1 policy with only the ICMP rule, got %+v", policies)
+	}
+	rule := policies[0].Spec.Ingress[0]
+	if len(rule.ToPorts) != 0 || !reflect.DeepEqual(rule.ICMPs, []ICMPRule{{Fields: []ICMPField{{Type: 8}}}}) {
+		t.Errorf("Expected icmps [{fields: [{type: 8}]}] without toPorts, got %+v", rule)
+	}
+	if rule.FromEndpoints[0].MatchLabels["k8s:app"] != "probe" {
+		t.Errorf("Expected the ICMP rule from probe, got %+v", rule.FromEndpoints)
+	}
+}
+
+func TestSynthesizePoliciesMixedCaseProtocols(t *testing.T) {
+	newFlow := func(protocol string) *hubble.ParsedFlow {
+		return &hubble.ParsedFlow{
+			SourceNamespace: "default",
+			SourceLabels:    map[string]string{"k8s:app": "frontend"},
+			DestNamespace:   "default",
+			DestLabels:      map[string]string{"k8s:app": "catalog"},
+			DestPort:        8080,
+			Protocol:        protocol,
+		}
+	}
+	flows := []*hubble.ParsedFlow{newFlow("tcp"), newFlow("TCP"), newFlow("Tcp")}
+
+	policies, err := SynthesizePolicies(flows)
+	if err != nil {
+		t.Fatalf("SynthesizePolicies() error = %v", err)
+	}
+	if len(policies) != 1 || len(policies[0].Spec.Ingress) != 1 {
+		t.Fatalf("Expected 1 policy with 1 ingress rule, got %+v", policies)
+	}
+	expected := []PortRule{{Ports: []PortProtocol{{Port: "8080", Protocol: "TCP"}}}}
+	if got := policies[0].Spec.Ingress[0].ToPorts; !reflect.DeepEqual(got, expected) {
+		t.Errorf("ToPorts = %+v, want a single 8080/TCP port", got)
+	}
+
+	// The caller's flows keep their protocols
+	if flows[0].Protocol != "tcp" {
+		t.Errorf("Expected input flow to be unmodified, got protocol %q", flows[0].Protocol)
+	}
+}
@@ -0,0 +1,75 @@
+package synth
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prabhakaran-jm/cilium-policypilot/internal/hubble"
+)
+
+// Provenance annotations and labels set on generated policies (see
+// Options.Provenance)
+const (
+	// AnnotationGeneratedAt is when the policy was generated, in RFC3339 UTC
+	AnnotationGeneratedAt = "policypilot.io/generated-at"
+	// AnnotationFlowCount is the number of observed flows the policy's
+	// rules were derived from
+	AnnotationFlowCount = "policypilot.io/flow-count"
+	// AnnotationSourceCapture names the capture the flows were read from
+	AnnotationSourceCapture = "policypilot.io/source-capture"
+
+	// LabelManagedBy marks generated policies so they can be listed with a
+	// label selector
+	LabelManagedBy = "app.kubernetes.io/managed-by"
+	// ManagedByValue is the value of LabelManagedBy
+	ManagedByValue = "cilium-policypilot"
+)
+
+// Provenance records where generated policies came from
+type Provenance struct {
+	// GeneratedAt is the generation time
+	GeneratedAt time.Time
+	// SourceCapture names the flows file, e.g. out/flows.json (optional)
+	SourceCapture string
+}
+
+// addFlowCount adds the number of flows to a policy's flow-count annotation
+func addFlowCount(policy *Policy, flows []*hubble.ParsedFlow) {
+	count := 0
+	for _, flow := range flows {
+		count += flow.Occurrences()
+	}
+	setFlowCount(policy, flowCount(policy)+count)
+}
+
+// flowCount returns a policy's flow-count annotation, 0 if it has none
+func flowCount(policy *Policy) int {
+	count, _ := strconv.Atoi(policy.Metadata.Annotations[AnnotationFlowCount])
+	return count
+}
+
+// setFlowCount sets a policy's flow-count annotation
+func setFlowCount(policy *Policy, count int) {
+	if policy.Metadata.Annotations == nil {
+		policy.Metadata.Annotations = make(map[string]string)
+	}
+	policy.Metadata.Annotations[AnnotationFlowCount] = strconv.Itoa(count)
+}
+
+// applyProvenance sets the managed-by label and the generated-at,
+// source-capture and fingerprint annotations on a policy
+func applyProvenance(policy *Policy, provenance *Provenance) {
+	if policy.Metadata.Labels == nil {
+		policy.Metadata.Labels = make(map[string]string)
+	}
+	policy.Metadata.Labels[LabelManagedBy] = ManagedByValue
+
+	if policy.Metadata.Annotations == nil {
+		policy.Metadata.Annotations = make(map[string]string)
+	}
+	policy.Metadata.Annotations[AnnotationGeneratedAt] = provenance.GeneratedAt.UTC().Format(time.RFC3339)
+	if provenance.SourceCapture != "" {
+		policy.Metadata.Annotations[AnnotationSourceCapture] = provenance.SourceCapture
+	}
+	policy.Metadata.Annotations[AnnotationFingerprint] = policy.Fingerprint()
+}
@@ -0,0 +1,111 @@
+package synth
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/prabhakaran-jm/cilium-policypilot/internal/hubble"
+	"github.com/prabhakaran-jm/cilium-policypilot/internal/verify"
+)
+
+func TestSynthesizePoliciesProvenance(t *testing.T) {
+	flows := []*hubble.ParsedFlow{
+		{
+			SourceLabels:    map[string]string{"k8s:app": "frontend"},
+			SourceNamespace: "shop",
+			DestLabels:      map[string]string{"k8s:app": "catalog"},
+			DestNamespace:   "shop",
+			DestPort:        8080,
+			Protocol:        "TCP",
+			Count:           3,
+		},
+		{
+			SourceLabels:    map[string]string{"k8s:app": "gateway"},
+			SourceNamespace: "shop",
+			DestLabels:      map[string]string{"k8s:app": "catalog"},
+			DestNamespace:   "shop",
+			DestPort:        8080,
+			Protocol:        "TCP",
+		},
+		// Egress from the catalog adds to its own policy's count
+		{
+			SourceLabels:    map[string]string{"k8s:app": "catalog"},
+			SourceNamespace: "shop",
+			DestLabels:      map[string]string{"reserved:world": ""},
+			DestIP:          "203.0.113.10",
+			DestPort:        443,
+			Protocol:        "TCP",
+			Count:           2,
+		},
+	}
+	provenance := &Provenance{
+		GeneratedAt:   time.Date(2025, 3, 1, 12, 30, 0, 0, time.FixedZone("CET", 3600)),
+		SourceCapture: "out/flows.json",
+	}
+
+	policies, err := SynthesizePoliciesWithOptions(flows, Options{Provenance: provenance, DefaultDeny: true})
+	if err != nil {
+		t.Fatalf("SynthesizePoliciesWithOptions() error = %v", err)
+	}
+	if len(policies) != 2 {
+		t.Fatalf("Expected a policy and its default-deny companion, got %d policies", len(policies))
+	}
+
+	expectedLabels := map[string]string{LabelManagedBy: ManagedByValue}
+	expected := []map[string]string{
+		{
+			AnnotationGeneratedAt:   "2025-03-01T11:30:00Z",
+			AnnotationSourceCapture: "out/flows.json",
+			AnnotationFlowCount:     "6",
+			AnnotationFingerprint:   policies[0].Fingerprint(),
+		},
+		// The companion has no rules, so no flow count
+		{
+			AnnotationGeneratedAt:   "2025-03-01T11:30:00Z",
+			AnnotationSourceCapture: "out/flows.json",
+			AnnotationFingerprint:   policies[1].Fingerprint(),
+		},
+	}
+	for i, policy := range policies {
+		if !reflect.DeepEqual(policy.Metadata.Labels, expectedLabels) {
+			t.Errorf("%s: labels = %v, want %v", policy.Metadata.Name, policy.Metadata.Labels, expectedLabels)
+		}
+		if !reflect.DeepEqual(policy.Metadata.Annotations, expected[i]) {
+			t.Errorf("%s: annotations = %v, want %v", policy.Metadata.Name, policy.Metadata.Annotations, expected[i])
+		}
+	}
+
+	// Labels and annotations round-trip through the policy file, which
+	// verify accepts
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := WritePoliciesToFile(policies, path); err != nil {
+		t.Fatalf("WritePoliciesToFile() error = %v", err)
+	}
+	parsed, err := ParsePoliciesFromFile(path)
+	if err != nil {
+		t.Fatalf("ParsePoliciesFromFile() error = %v", err)
+	}
+	for i, policy := range parsed {
+		if !reflect.DeepEqual(policy.Metadata, policies[i].Metadata) {
+			t.Errorf("Parsed metadata = %+v, want %+v", policy.Metadata, policies[i].Metadata)
+		}
+	}
+	result, err := verify.VerifyPolicies(path)
+	if err != nil {
+		t.Fatalf("VerifyPolicies() error = %v", err)
+	}
+	if !result.Valid {
+		t.Errorf("Expected valid policies, got errors: %v", result.Errors)
+	}
+
+	// Without provenance, policies carry no labels or annotations
+	policies, err = SynthesizePoliciesWithOptions(flows, Options{})
+	if err != nil {
+		t.Fatalf("SynthesizePoliciesWithOptions() error = %v", err)
+	}
+	if metadata := policies[0].Metadata; metadata.Labels != nil || metadata.Annotations != nil {
+		t.Errorf("Expected no labels or annotations, got %+v", metadata)
+	}
+}
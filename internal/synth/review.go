@@ -0,0 +1,76 @@
+package synth
+
+import "reflect"
+
+// ProposedRule is a generated ingress rule offered to Options.ReviewRule
+type ProposedRule struct {
+	// Policy is the name of the policy the rule belongs to
+	Policy string
+	// Sources describe the rule's peers as in PolicyDiff, e.g.
+	// "endpoints:k8s:app=frontend", "entity:world" or "cidr:203.0.113.10/32"
+	Sources []string
+	// Destination is the selected endpoints, e.g. "shop/k8s:app=catalog"
+	Destination string
+	// Traffic lists the allowed ports and ICMP types, e.g. "8080/TCP"
+	Traffic []string
+	Rule    IngressRule
+}
+
+// ReviewIngressRules offers each ingress rule of policies to review, in
+// order, and keeps only those it approves. A policy left without ingress
+// rules is dropped unless it has egress rules other than the DNS rules
+// added to every policy, in which case it is kept for those. An error from
+// review stops the review and is returned.
+func ReviewIngressRules(policies []*Policy, review func(ProposedRule) (bool, error)) ([]*Policy, error) {
+	result := make([]*Policy, 0, len(policies))
+	for _, policy := range policies {
+		if len(policy.Spec.Ingress) == 0 {
+			result = append(result, policy)
+			continue
+		}
+
+		destination := formatSelector(policy.Spec.EndpointSelector)
+		if policy.Metadata.Namespace != "" {
+			destination = policy.Metadata.Namespace + "/" + destination
+		}
+
+		var kept []IngressRule
+		for _, rule := range policy.Spec.Ingress {
+			approved, err := review(ProposedRule{
+				Policy:      policy.Metadata.Name,
+				Sources:     ingressPeers(rule),
+				Destination: destination,
+				Traffic:     ruleTraffic(rule.ToPorts, rule.ICMPs),
+				Rule:        rule,
+			})
+			if err != nil {
+				return nil, err
+			}
+			if approved {
+				kept = append(kept, rule)
+			}
+		}
+
+		policy.Spec.Ingress = kept
+		if len(kept) > 0 || hasNonDNSEgress(policy) {
+			result = append(result, policy)
+		}
+	}
+	return result, nil
+}
+
+// hasNonDNSEgress reports whether a policy has egress rules other than the
+// ones from generateEgressRulesForDNS
+func hasNonDNSEgress(policy *Policy) bool {
+	dns := generateEgressRulesForDNS(policy.Metadata.Namespace)
+	for _, rule := range policy.Spec.Egress {
+		isDNS := false
+		for _, dnsRule := range dns {
+			isDNS = isDNS || reflect.DeepEqual(rule, dnsRule)
+		}
+		if !isDNS {
+			return true
+		}
+	}
+	return false
+}
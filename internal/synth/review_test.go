@@ -0,0 +1,80 @@
+package synth
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/prabhakaran-jm/cilium-policypilot/internal/hubble"
+)
+
+func TestSynthesizePoliciesReviewRule(t *testing.T) {
+	flow := func(source, dest string, port uint16) *hubble.ParsedFlow {
+		return &hubble.ParsedFlow{
+			SourceLabels:    map[string]string{"k8s:app": source},
+			SourceNamespace: "shop",
+			DestLabels:      map[string]string{"k8s:app": dest},
+			DestNamespace:   "shop",
+			DestPort:        port,
+			Protocol:        "TCP",
+		}
+	}
+	flows := []*hubble.ParsedFlow{
+		flow("frontend", "catalog", 8080),
+		flow("gateway", "catalog", 8080),
+		flow("frontend", "cart", 7070),
+		flow("checkout", "payment", 50051),
+		{
+			SourceLabels:    map[string]string{"k8s:app": "cart"},
+			SourceNamespace: "shop",
+			DestLabels:      map[string]string{"reserved:world": ""},
+			DestIP:          "203.0.113.10",
+			DestPort:        443,
+			Protocol:        "TCP",
+		},
+	}
+
+	var reviewed []ProposedRule
+	opts := Options{
+		ReviewRule: func(rule ProposedRule) (bool, error) {
+			reviewed = append(reviewed, rule)
+			return rule.Sources[0] == "endpoints:k8s:app=gateway", nil
+		},
+	}
+	policies, err := SynthesizePoliciesWithOptions(flows, opts)
+	if err != nil {
+		t.Fatalf("SynthesizePoliciesWithOptions() error = %v", err)
+	}
+
+	if len(reviewed) != 4 {
+		t.Fatalf("Expected 4 rules to be reviewed, got %d", len(reviewed))
+	}
+	expected := ProposedRule{
+		Policy:      "cart-policy",
+		Sources:     []string{"endpoints:k8s:app=frontend"},
+		Destination: "shop/k8s:app=cart",
+		Traffic:     []string{"7070/TCP"},
+		Rule:        reviewed[0].Rule,
+	}
+	if !reflect.DeepEqual(reviewed[0], expected) {
+		t.Errorf("First reviewed rule = %+v, want %+v", reviewed[0], expected)
+	}
+
+	// The catalog keeps its approved rule, the cart its external egress
+	// without ingress, and the payment policy, left with only DNS egress,
+	// is dropped
+	names := make(map[string]int)
+	for _, policy := range policies {
+		names[policy.Metadata.Name] = len(policy.Spec.Ingress)
+	}
+	if !reflect.DeepEqual(names, map[string]int{"catalog-policy": 1, "cart-policy": 0}) {
+		t.Errorf("Expected catalog-policy with 1 ingress rule and cart-policy with none, got %v", names)
+	}
+
+	// An error from the reviewer stops synthesis
+	stop := errors.New("review aborted")
+	opts.ReviewRule = func(ProposedRule) (bool, error) { return false, stop }
+	if _, err := SynthesizePoliciesWithOptions(flows, opts); !errors.Is(err, stop) {
+		t.Errorf("Expected the reviewer's error, got %v", err)
+	}
+}
@@ -0,0 +1,81 @@
+package synth
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/prabhakaran-jm/cilium-policypilot/internal/hubble"
+)
+
+// SuppressedRule is a connection left out of the generated ingress rules
+// because it was observed fewer than Options.MinFlows times
+type SuppressedRule struct {
+	// Namespace and Destination identify the destination endpoint
+	Namespace   string
+	Destination map[string]string
+	// Source is "namespace/labels" for pods or "entity:name" for host sources
+	Source string
+	// Traffic is the port and protocol, e.g. "8080/TCP" or "ICMP type 8"
+	Traffic string
+	// Flows is the number of times the connection was observed
+	Flows int
+}
+
+// String describes the connection, e.g.
+// "web/k8s:app=frontend -> shop/k8s:app=catalog on 8080/TCP (1 flow)"
+func (r SuppressedRule) String() string {
+	unit := "flows"
+	if r.Flows == 1 {
+		unit = "flow"
+	}
+	return fmt.Sprintf("%s -> %s/%s on %s (%d %s)", r.Source, r.Namespace, formatLabels(r.Destination), r.Traffic, r.Flows, unit)
+}
+
+// ingressTraffic describes the destination port of a flow, or its ICMP type
+func ingressTraffic(flow *hubble.ParsedFlow) string {
+	if flow.IsICMP() {
+		return fmt.Sprintf("%s type %d", flow.Protocol, flow.ICMPType)
+	}
+	protocol := flow.Protocol
+	if protocol == "" {
+		protocol = "TCP"
+	}
+	return fmt.Sprintf("%d/%s", flow.DestPort, protocol)
+}
+
+// describeSource returns a readable identifier for a flow's source
+func describeSource(flow *hubble.ParsedFlow) string {
+	if flow.SourceEntity != "" {
+		return "entity:" + flow.SourceEntity
+	}
+	if flow.IsExternalSource() {
+		return flow.SourceIP
+	}
+	return fmt.Sprintf("%s/%s", flow.SourceNamespace, formatLabels(flow.SourceLabels))
+}
+
+// formatLabels renders labels as sorted key=value pairs
+func formatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// sortedSuppressedRules orders suppressed rules by source, then traffic
+func sortedSuppressedRules(suppressed map[string]*SuppressedRule) []SuppressedRule {
+	result := make([]SuppressedRule, 0, len(suppressed))
+	for _, rule := range suppressed {
+		result = append(result, *rule)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Source != result[j].Source {
+			return result[i].Source < result[j].Source
+		}
+		return result[i].Traffic < result[j].Traffic
+	})
+	return result
+}
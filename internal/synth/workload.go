@@ -0,0 +1,80 @@
+package synth
+
+import (
+	"github.com/prabhakaran-jm/cilium-policypilot/internal/hubble"
+)
+
+// Values for Options.GroupBy
+const (
+	// GroupByLabels keys endpoints on their pod labels
+	GroupByLabels = "labels"
+	// GroupByWorkload keys endpoints on the workload (e.g. Deployment) owning
+	// the pod, falling back to labels for pods without one
+	GroupByWorkload = "workload"
+)
+
+// withWorkloadLabels returns copies of the flows in which each endpoint that
+// belongs to a workload carries the labels shared by every pod of that
+// workload seen in the flows. Per-pod and per-rollout labels such as
+// pod-template-hash drop out, so all replicas end up with one selector.
+func withWorkloadLabels(flows []*hubble.ParsedFlow) []*hubble.ParsedFlow {
+	common := make(map[string]map[string]string)
+	collect := func(namespace, workload string, labels map[string]string) {
+		if workload == "" || len(labels) == 0 {
+			return
+		}
+		key := namespace + "/" + workload
+		if existing, exists := common[key]; exists {
+			common[key] = intersectLabels(existing, labels)
+		} else {
+			common[key] = labels
+		}
+	}
+	for _, flow := range flows {
+		if flow.SourceEntity == "" {
+			collect(flow.SourceNamespace, flow.SourceWorkload, flow.SourceLabels)
+		}
+		if flow.DestEntity == "" {
+			collect(flow.DestNamespace, flow.DestWorkload, flow.DestLabels)
+		}
+	}
+
+	result := make([]*hubble.ParsedFlow, 0, len(flows))
+	for _, flow := range flows {
+		source := common[flow.SourceNamespace+"/"+flow.SourceWorkload]
+		dest := common[flow.DestNamespace+"/"+flow.DestWorkload]
+		if flow.SourceWorkload == "" || flow.SourceEntity != "" {
+			source = nil
+		}
+		if flow.DestWorkload == "" || flow.DestEntity != "" {
+			dest = nil
+		}
+		if len(source) == 0 && len(dest) == 0 {
+			result = append(result, flow)
+			continue
+		}
+
+		// Keep a pod's own labels if its replicas share none
+		grouped := *flow
+		if len(source) > 0 {
+			grouped.SourceLabels = source
+		}
+		if len(dest) > 0 {
+			grouped.DestLabels = dest
+		}
+		result = append(result, &grouped)
+	}
+
+	return result
+}
+
+// intersectLabels returns the labels present with the same value in both sets
+func intersectLabels(a, b map[string]string) map[string]string {
+	result := make(map[string]string)
+	for key, value := range a {
+		if other, exists := b[key]; exists && other == value {
+			result[key] = value
+		}
+	}
+	return result
+}
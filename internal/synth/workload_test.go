@@ -0,0 +1,95 @@
+package synth
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/prabhakaran-jm/cilium-policypilot/internal/hubble"
+)
+
+func TestSynthesizePoliciesGroupByWorkload(t *testing.T) {
+	newFlow := func(sourceHash, destHash string) *hubble.ParsedFlow {
+		return &hubble.ParsedFlow{
+			SourceLabels:    map[string]string{"k8s:app": "frontend", "k8s:pod-template-hash": sourceHash},
+			SourceNamespace: "shop",
+			SourceWorkload:  "Deployment/frontend",
+			DestLabels:      map[string]string{"k8s:app": "catalog", "k8s:pod-template-hash": destHash},
+			DestNamespace:   "shop",
+			DestWorkload:    "Deployment/catalog",
+			DestPort:        8080,
+			Protocol:        "TCP",
+		}
+	}
+	// Replicas from two rollouts of each Deployment, plus a pod without a
+	// workload that keeps its own labels
+	flows := []*hubble.ParsedFlow{
+		newFlow("5d8f", "7c9a"),
+		newFlow("6b21", "7c9a"),
+		newFlow("5d8f", "84e0"),
+		{
+			SourceLabels:    map[string]string{"k8s:app": "debug", "k8s:run": "debug"},
+			SourceNamespace: "shop",
+			DestLabels:      map[string]string{"k8s:app": "catalog", "k8s:pod-template-hash": "84e0"},
+			DestNamespace:   "shop",
+			DestWorkload:    "Deployment/catalog",
+			DestPort:        8080,
+			Protocol:        "TCP",
+		},
+	}
+
+	tests := []struct {
+		name      string
+		groupBy   string
+		selectors []map[string]string
+	}{
+		{
+			// pod-template-hash is volatile and left out of selectors
+			name:      "labels",
+			groupBy:   GroupByLabels,
+			selectors: []map[string]string{{"k8s:app": "catalog"}},
+		},
+		{
+			name:      "workload",
+			groupBy:   GroupByWorkload,
+			selectors: []map[string]string{{"k8s:app": "catalog"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policies, err := SynthesizePoliciesWithOptions(flows, Options{GroupBy: tt.groupBy})
+			if err != nil {
+				t.Fatalf("SynthesizePoliciesWithOptions() error = %v", err)
+			}
+
+			var selectors []map[string]string
+			for _, policy := range policies {
+				selectors = append(selectors, policy.Spec.EndpointSelector.MatchLabels)
+			}
+			if !reflect.DeepEqual(selectors, tt.selectors) {
+				t.Fatalf("endpoint selectors = %v, want %v", selectors, tt.selectors)
+			}
+
+			if tt.groupBy != GroupByWorkload {
+				return
+			}
+			// Replicas of the frontend share one rule
+			expected := []map[string]string{
+				{"k8s:app": "debug", "k8s:run": "debug"},
+				{"k8s:app": "frontend"},
+			}
+			var sources []map[string]string
+			for _, rule := range policies[0].Spec.Ingress {
+				sources = append(sources, rule.FromEndpoints[0].MatchLabels)
+			}
+			if !reflect.DeepEqual(sources, expected) {
+				t.Errorf("ingress sources = %v, want %v", sources, expected)
+			}
+		})
+	}
+
+	// The caller's flows are left as is
+	if flows[0].SourceLabels["k8s:pod-template-hash"] != "5d8f" {
+		t.Errorf("Expected input flows to be unmodified, got %v", flows[0].SourceLabels)
+	}
+}
@@ -1,55 +1,379 @@
 package synth
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
+	"github.com/prabhakaran-jm/cilium-policypilot/internal/fileutil"
+	"github.com/prabhakaran-jm/cilium-policypilot/internal/validate"
 	"gopkg.in/yaml.v3"
 )
 
-// WritePoliciesToFile writes policies to a YAML file
+// WritePoliciesToFile writes policies to a YAML file, ordered by namespace
+// then name so the file diffs cleanly regardless of synthesis order
 func WritePoliciesToFile(policies []*Policy, filePath string) error {
+	return writeFile(filePath, func(w io.Writer) error {
+		return WritePolicies(w, policies)
+	})
+}
+
+// WritePolicies writes policies to w as multi-document YAML, ordered like
+// WritePoliciesToFile, e.g. to pipe them into kubectl apply -f -
+func WritePolicies(w io.Writer, policies []*Policy) error {
+	sorted := sortedByMetadata(policies, func(policy *Policy) PolicyMetadata { return policy.Metadata })
+
+	docs := make([]interface{}, 0, len(sorted))
+	for _, policy := range sorted {
+		docs = append(docs, policy)
+	}
+	return writeYAMLDocuments(w, docs)
+}
+
+// PoliciesToJSON marshals policies as an indented JSON array, ordered like
+// WritePoliciesToFile. encoding/json writes map keys sorted, so the output
+// is byte-for-byte stable for the same policies.
+func PoliciesToJSON(policies []*Policy) ([]byte, error) {
+	sorted := sortedByMetadata(policies, func(policy *Policy) PolicyMetadata { return policy.Metadata })
+
+	data, err := json.MarshalIndent(sorted, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal policies to JSON: %w", err)
+	}
+	return append(data, '\n'), nil
+}
+
+// WritePoliciesToJSONFile writes policies to a JSON file as an array (see
+// PoliciesToJSON)
+func WritePoliciesToJSONFile(policies []*Policy, filePath string) error {
 	if len(policies) == 0 {
 		return fmt.Errorf("no policies to write")
 	}
 
+	data, err := PoliciesToJSON(policies)
+	if err != nil {
+		return err
+	}
+
 	// Ensure output directory exists
 	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
 		return fmt.Errorf("failed to create output directory: %w", err)
 	}
 
-	// Generate YAML content
-	var yamlContent strings.Builder
+	if err := fileutil.WriteFile(filePath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write policies file: %w", err)
+	}
+	return nil
+}
+
+// WriteNetworkPoliciesToFile writes Kubernetes NetworkPolicies to a YAML file,
+// ordered by namespace then name
+func WriteNetworkPoliciesToFile(policies []*NetworkPolicy, filePath string) error {
+	return writeFile(filePath, func(w io.Writer) error {
+		return WriteNetworkPolicies(w, policies)
+	})
+}
+
+// WriteNetworkPolicies writes Kubernetes NetworkPolicies to w as
+// multi-document YAML, ordered by namespace then name
+func WriteNetworkPolicies(w io.Writer, policies []*NetworkPolicy) error {
+	sorted := sortedByMetadata(policies, func(policy *NetworkPolicy) PolicyMetadata { return policy.Metadata })
+
+	docs := make([]interface{}, 0, len(sorted))
+	for _, policy := range sorted {
+		docs = append(docs, policy)
+	}
+	return writeYAMLDocuments(w, docs)
+}
+
+// WritePoliciesToDir writes each policy to its own YAML file in dir, named
+// <namespace>-<name>.yaml (or <name>.yaml for cluster-wide policies), for
+// repositories that keep one manifest per file. Existing files are
+// overwritten. It returns the written paths in namespace, then name order.
+func WritePoliciesToDir(policies []*Policy, dir string) ([]string, error) {
+	sorted := sortedByMetadata(policies, func(policy *Policy) PolicyMetadata { return policy.Metadata })
+
+	docs := make([]interface{}, 0, len(sorted))
+	metadata := make([]PolicyMetadata, 0, len(sorted))
+	for _, policy := range sorted {
+		docs = append(docs, policy)
+		metadata = append(metadata, policy.Metadata)
+	}
+	return writeYAMLDocumentsToDir(docs, metadata, dir)
+}
+
+// WriteNetworkPoliciesToDir writes each Kubernetes NetworkPolicy to its own
+// YAML file in dir, named like WritePoliciesToDir
+func WriteNetworkPoliciesToDir(policies []*NetworkPolicy, dir string) ([]string, error) {
+	sorted := sortedByMetadata(policies, func(policy *NetworkPolicy) PolicyMetadata { return policy.Metadata })
+
+	docs := make([]interface{}, 0, len(sorted))
+	metadata := make([]PolicyMetadata, 0, len(sorted))
+	for _, policy := range sorted {
+		docs = append(docs, policy)
+		metadata = append(metadata, policy.Metadata)
+	}
+	return writeYAMLDocumentsToDir(docs, metadata, dir)
+}
+
+// sortedByMetadata returns a copy of policies ordered by namespace, then
+// name, keeping the input order of equal names
+func sortedByMetadata[T any](policies []T, metadata func(T) PolicyMetadata) []T {
+	sorted := make([]T, len(policies))
+	copy(sorted, policies)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return metadataLess(metadata(sorted[i]), metadata(sorted[j]))
+	})
+	return sorted
+}
+
+// metadataLess orders policies by namespace, then name
+func metadataLess(a, b PolicyMetadata) bool {
+	if a.Namespace != b.Namespace {
+		return a.Namespace < b.Namespace
+	}
+	return a.Name < b.Name
+}
+
+// writeYAMLDocuments writes docs to w as multi-document YAML
+func writeYAMLDocuments(w io.Writer, docs []interface{}) error {
+	if len(docs) == 0 {
+		return fmt.Errorf("no policies to write")
+	}
 
 	// Write each policy separated by "---"
-	for i, policy := range policies {
-		if i > 0 {
-			yamlContent.WriteString("---\n")
+	data, err := encodeYAML(docs...)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("failed to write policies: %w", err)
+	}
+	return nil
+}
+
+// writeFile writes the output of write to filePath, creating its directory.
+// Nothing is written to the file if write fails.
+func writeFile(filePath string, write func(w io.Writer) error) error {
+	var buf bytes.Buffer
+	if err := write(&buf); err != nil {
+		return err
+	}
+
+	// Ensure output directory exists
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	if err := fileutil.WriteFile(filePath, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write policies file: %w", err)
+	}
+	return nil
+}
+
+// yamlIndent is the indentation of generated YAML, yaml.v3's default
+const yamlIndent = 4
+
+// encodeYAML encodes docs as a YAML stream separated by "---". Struct fields
+// are written in declaration order and map keys sorted, so the same docs
+// always give the same bytes. Each doc is built as a node tree first and
+// rejected if it contains anchors, aliases or merge keys, which not every
+// manifest consumer resolves the same way. Ingress rules of policies with
+// an observation (see Options.RuleComments) get a comment describing it.
+func encodeYAML(docs ...interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(yamlIndent)
+
+	for _, doc := range docs {
+		var node yaml.Node
+		if err := node.Encode(doc); err != nil {
+			return nil, fmt.Errorf("failed to marshal policy to YAML: %w", err)
+		}
+		if err := checkPlainYAML(&node); err != nil {
+			return nil, fmt.Errorf("failed to marshal policy to YAML: %w", err)
+		}
+		if policy, ok := doc.(*Policy); ok {
+			addRuleComments(&node, policy)
 		}
+		if err := encoder.Encode(&node); err != nil {
+			return nil, fmt.Errorf("failed to marshal policy to YAML: %w", err)
+		}
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, fmt.Errorf("failed to marshal policy to YAML: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// checkPlainYAML returns an error if node or any of its children is an
+// anchor, an alias or a "<<" merge key
+func checkPlainYAML(node *yaml.Node) error {
+	if node.Anchor != "" {
+		return fmt.Errorf("unexpected YAML anchor &%s", node.Anchor)
+	}
+	if node.Kind == yaml.AliasNode {
+		return fmt.Errorf("unexpected YAML alias *%s", node.Value)
+	}
+	for i, child := range node.Content {
+		if node.Kind == yaml.MappingNode && i%2 == 0 && child.Value == "<<" && child.Tag == "!!merge" {
+			return fmt.Errorf("unexpected YAML merge key")
+		}
+		if err := checkPlainYAML(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeYAMLDocumentsToDir writes each doc to its own file in dir, named
+// after the matching metadata
+func writeYAMLDocumentsToDir(docs []interface{}, metadata []PolicyMetadata, dir string) ([]string, error) {
+	if len(docs) == 0 {
+		return nil, fmt.Errorf("no policies to write")
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %w", err)
+	}
 
-		data, err := yaml.Marshal(policy)
+	paths := make([]string, 0, len(docs))
+	used := make(map[string]bool)
+	for i, doc := range docs {
+		data, err := encodeYAML(doc)
 		if err != nil {
-			return fmt.Errorf("failed to marshal policy to YAML: %w", err)
+			return nil, err
 		}
 
-		yamlContent.Write(data)
+		// Names can collide once sanitized, e.g. a cluster-wide policy named
+		// "web-api" and policy "api" in namespace "web"; later ones get a suffix
+		base := policyFileBase(metadata[i])
+		name := base + ".yaml"
+		for n := 2; used[name]; n++ {
+			name = fmt.Sprintf("%s-%d.yaml", base, n)
+		}
+		used[name] = true
+
+		path := filepath.Join(dir, name)
+		if err := fileutil.WriteFile(path, data, 0644); err != nil {
+			return nil, fmt.Errorf("failed to write policy file: %w", err)
+		}
+		paths = append(paths, path)
 	}
 
-	// Write to file
-	if err := os.WriteFile(filePath, []byte(yamlContent.String()), 0644); err != nil {
-		return fmt.Errorf("failed to write policies file: %w", err)
+	return paths, nil
+}
+
+// policyFileBase returns the sanitized file name, without extension, for a
+// policy: lowercase letters, digits, dots and hyphens only
+func policyFileBase(metadata PolicyMetadata) string {
+	name := metadata.Name
+	if metadata.Namespace != "" {
+		name = metadata.Namespace + "-" + name
 	}
 
-	return nil
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '.' || r == '-' {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('-')
+		}
+	}
+
+	base := strings.Trim(b.String(), ".-")
+	if base == "" {
+		return "policy"
+	}
+	return base
 }
 
 // PolicyToYAML converts a single policy to YAML string
 func PolicyToYAML(policy *Policy) (string, error) {
-	data, err := yaml.Marshal(policy)
+	data, err := encodeYAML(policy)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal policy to YAML: %w", err)
+		return "", err
 	}
 	return string(data), nil
 }
+
+// ParsePoliciesFromFile reads CiliumNetworkPolicies and
+// CiliumClusterwideNetworkPolicies from a multi-document YAML file.
+// Fields the Policy type does not model are ignored.
+func ParsePoliciesFromFile(filePath string) ([]*Policy, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %w", err)
+	}
+
+	policies := make([]*Policy, 0)
+	for i, doc := range validate.SplitYAMLDocuments(string(data)) {
+		if strings.TrimSpace(doc) == "" {
+			continue
+		}
+
+		var policy Policy
+		if err := yaml.Unmarshal([]byte(doc), &policy); err != nil {
+			return nil, fmt.Errorf("document %d: invalid policy YAML: %w", i+1, err)
+		}
+
+		// Comment-only documents unmarshal to an empty policy
+		if policy.Kind == "" && policy.Metadata.Name == "" {
+			continue
+		}
+		if policy.Kind != "CiliumNetworkPolicy" && policy.Kind != "CiliumClusterwideNetworkPolicy" {
+			return nil, fmt.Errorf("document %d: unsupported kind '%s'", i+1, policy.Kind)
+		}
+
+		policies = append(policies, &policy)
+	}
+
+	if len(policies) == 0 {
+		return nil, fmt.Errorf("no policies found in %s", filePath)
+	}
+
+	return policies, nil
+}
+
+// ParseNetworkPoliciesFromFile reads Kubernetes NetworkPolicies from a
+// multi-document YAML file. Fields the NetworkPolicy type does not model are
+// ignored.
+func ParseNetworkPoliciesFromFile(filePath string) ([]*NetworkPolicy, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %w", err)
+	}
+
+	policies := make([]*NetworkPolicy, 0)
+	for i, doc := range validate.SplitYAMLDocuments(string(data)) {
+		if strings.TrimSpace(doc) == "" {
+			continue
+		}
+
+		var policy NetworkPolicy
+		if err := yaml.Unmarshal([]byte(doc), &policy); err != nil {
+			return nil, fmt.Errorf("document %d: invalid policy YAML: %w", i+1, err)
+		}
+
+		// Comment-only documents unmarshal to an empty policy
+		if policy.Kind == "" && policy.Metadata.Name == "" {
+			continue
+		}
+		if policy.Kind != "NetworkPolicy" {
+			return nil, fmt.Errorf("document %d: unsupported kind '%s'", i+1, policy.Kind)
+		}
+
+		policies = append(policies, &policy)
+	}
+
+	if len(policies) == 0 {
+		return nil, fmt.Errorf("no policies found in %s", filePath)
+	}
+
+	return policies, nil
+}
@@ -0,0 +1,479 @@
+package synth
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/prabhakaran-jm/cilium-policypilot/internal/hubble"
+	"gopkg.in/yaml.v3"
+)
+
+func TestWritePoliciesToFileSorted(t *testing.T) {
+	newPolicy := func(namespace, name string) *Policy {
+		return &Policy{
+			APIVersion: "cilium.io/v2",
+			Kind:       "CiliumNetworkPolicy",
+			Metadata:   PolicyMetadata{Name: name, Namespace: namespace},
+			Spec: PolicySpec{
+				EndpointSelector: EndpointSelector{MatchLabels: map[string]string{"k8s:app": name}},
+			},
+		}
+	}
+
+	policies := []*Policy{
+		newPolicy("shop", "catalog-policy"),
+		newPolicy("default", "frontend-policy"),
+		newPolicy("shop", "cart-policy"),
+		newPolicy("data", "database-policy"),
+		newPolicy("default", "backend-policy"),
+	}
+
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := WritePoliciesToFile(policies, path); err != nil {
+		t.Fatalf("WritePoliciesToFile() error = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read policy file: %v", err)
+	}
+
+	var order []string
+	decoder := yaml.NewDecoder(strings.NewReader(string(data)))
+	for {
+		var policy Policy
+		if err := decoder.Decode(&policy); err != nil {
+			break
+		}
+		order = append(order, policy.Metadata.Namespace+"/"+policy.Metadata.Name)
+	}
+
+	expected := []string{
+		"data/database-policy",
+		"default/backend-policy",
+		"default/frontend-policy",
+		"shop/cart-policy",
+		"shop/catalog-policy",
+	}
+	if !reflect.DeepEqual(order, expected) {
+		t.Errorf("On-disk order = %v, want %v", order, expected)
+	}
+
+	// The caller's slice is left as is
+	if policies[0].Metadata.Name != "catalog-policy" {
+		t.Errorf("Expected input slice to be unmodified, got %s first", policies[0].Metadata.Name)
+	}
+}
+
+func TestWritePolicies(t *testing.T) {
+	policies := []*Policy{
+		{
+			APIVersion: "cilium.io/v2",
+			Kind:       "CiliumNetworkPolicy",
+			Metadata:   PolicyMetadata{Name: "frontend-policy", Namespace: "shop"},
+			Spec: PolicySpec{
+				EndpointSelector: EndpointSelector{MatchLabels: map[string]string{"k8s:app": "frontend"}},
+			},
+		},
+		{
+			APIVersion: "cilium.io/v2",
+			Kind:       "CiliumNetworkPolicy",
+			Metadata:   PolicyMetadata{Name: "backend-policy", Namespace: "shop"},
+			Spec: PolicySpec{
+				EndpointSelector: EndpointSelector{MatchLabels: map[string]string{"k8s:app": "backend"}},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := WritePolicies(&buf, policies); err != nil {
+		t.Fatalf("WritePolicies() error = %v", err)
+	}
+
+	// The file writer produces the same bytes
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := WritePoliciesToFile(policies, path); err != nil {
+		t.Fatalf("WritePoliciesToFile() error = %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read policy file: %v", err)
+	}
+	if buf.String() != string(data) {
+		t.Errorf("WritePolicies() wrote:\n%s\nwant the file contents:\n%s", buf.String(), data)
+	}
+	if !strings.HasPrefix(buf.String(), "apiVersion: cilium.io/v2") || strings.Count(buf.String(), "\n---\n") != 1 {
+		t.Errorf("Expected two YAML documents separated by ---, got:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if err := WritePolicies(&buf, nil); err == nil {
+		t.Error("Expected an error writing no policies")
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Expected nothing written for no policies, got %q", buf.String())
+	}
+}
+
+func TestWritePoliciesToDir(t *testing.T) {
+	newPolicy := func(kind, namespace, name string) *Policy {
+		return &Policy{
+			APIVersion: "cilium.io/v2",
+			Kind:       kind,
+			Metadata:   PolicyMetadata{Name: name, Namespace: namespace},
+			Spec: PolicySpec{
+				EndpointSelector: EndpointSelector{MatchLabels: map[string]string{"k8s:app": name}},
+			},
+		}
+	}
+
+	dir := filepath.Join(t.TempDir(), "policies")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	// A file from an earlier run is overwritten
+	if err := os.WriteFile(filepath.Join(dir, "shop-cart-policy.yaml"), []byte("stale"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	policies := []*Policy{
+		newPolicy("CiliumNetworkPolicy", "shop", "cart-policy"),
+		newPolicy("CiliumNetworkPolicy", "default", "Frontend_Policy"),
+		newPolicy("CiliumClusterwideNetworkPolicy", "", "shop-cart-policy"),
+	}
+
+	paths, err := WritePoliciesToDir(policies, dir)
+	if err != nil {
+		t.Fatalf("WritePoliciesToDir() error = %v", err)
+	}
+
+	var names []string
+	for _, path := range paths {
+		names = append(names, filepath.Base(path))
+	}
+	expected := []string{"shop-cart-policy.yaml", "default-frontend-policy.yaml", "shop-cart-policy-2.yaml"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("Written files = %v, want %v", names, expected)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Failed to read output directory: %v", err)
+	}
+	if len(entries) != len(expected) {
+		t.Errorf("Expected %d files in output directory, got %d", len(expected), len(entries))
+	}
+
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", path, err)
+		}
+		if strings.Contains(string(data), "---") {
+			t.Errorf("%s: expected a single document, got:\n%s", filepath.Base(path), data)
+		}
+		var policy Policy
+		if err := yaml.Unmarshal(data, &policy); err != nil {
+			t.Fatalf("%s: invalid YAML: %v", filepath.Base(path), err)
+		}
+		if policy.Metadata.Name == "" {
+			t.Errorf("%s: expected a policy, got:\n%s", filepath.Base(path), data)
+		}
+	}
+
+	// Cluster-wide policies sort first, so the colliding namespaced policy
+	// gets the suffix
+	data, err := os.ReadFile(filepath.Join(dir, "shop-cart-policy-2.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "namespace: shop") {
+		t.Errorf("Expected shop-cart-policy-2.yaml to hold the namespaced policy, got:\n%s", data)
+	}
+}
+
+func TestParsePoliciesFromFile(t *testing.T) {
+	t.Run("round trip", func(t *testing.T) {
+		flows := []*hubble.ParsedFlow{
+			{
+				SourceLabels:    map[string]string{"k8s:app": "frontend"},
+				SourceNamespace: "shop",
+				DestLabels:      map[string]string{"k8s:app": "catalog"},
+				DestNamespace:   "shop",
+				DestPort:        8080,
+				Protocol:        "TCP",
+			},
+			{
+				SourceLabels:    map[string]string{"k8s:app": "catalog"},
+				SourceNamespace: "shop",
+				DestLabels:      map[string]string{"k8s:app": "database"},
+				DestNamespace:   "data",
+				DestPort:        5432,
+				Protocol:        "TCP",
+			},
+		}
+		policies, err := SynthesizePolicies(flows)
+		if err != nil {
+			t.Fatalf("SynthesizePolicies() error = %v", err)
+		}
+
+		path := filepath.Join(t.TempDir(), "policy.yaml")
+		if err := WritePoliciesToFile(policies, path); err != nil {
+			t.Fatalf("WritePoliciesToFile() error = %v", err)
+		}
+
+		parsed, err := ParsePoliciesFromFile(path)
+		if err != nil {
+			t.Fatalf("ParsePoliciesFromFile() error = %v", err)
+		}
+		if len(parsed) != len(policies) {
+			t.Fatalf("Expected %d policies, got %d", len(policies), len(parsed))
+		}
+		for _, policy := range policies {
+			found := false
+			for _, p := range parsed {
+				if reflect.DeepEqual(p, policy) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				t.Errorf("Policy %s/%s did not round-trip", policy.Metadata.Namespace, policy.Metadata.Name)
+			}
+		}
+	})
+
+	t.Run("hand-edited file", func(t *testing.T) {
+		content := `# Hand-edited policies
+---
+apiVersion: cilium.io/v2
+kind: CiliumNetworkPolicy
+metadata:
+  name: catalog-policy
+  namespace: shop
+spec:
+  endpointSelector:
+    matchLabels:
+      k8s:app: catalog
+  ingress:
+  - fromEndpoints:
+    - matchLabels:
+        k8s:app: frontend
+    toPorts:
+    - ports:
+      - port: "8443"
+        protocol: TCP
+`
+		path := filepath.Join(t.TempDir(), "policy.yaml")
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write policy file: %v", err)
+		}
+
+		parsed, err := ParsePoliciesFromFile(path)
+		if err != nil {
+			t.Fatalf("ParsePoliciesFromFile() error = %v", err)
+		}
+		if len(parsed) != 1 {
+			t.Fatalf("Expected 1 policy, got %d", len(parsed))
+		}
+		if port := parsed[0].Spec.Ingress[0].ToPorts[0].Ports[0].Port; port != "8443" {
+			t.Errorf("Expected hand-edited port 8443, got %s", port)
+		}
+	})
+
+	t.Run("matchExpressions survive round trip", func(t *testing.T) {
+		content := `apiVersion: cilium.io/v2
+kind: CiliumNetworkPolicy
+metadata:
+  name: catalog-policy
+  namespace: shop
+spec:
+  endpointSelector:
+    matchLabels:
+      k8s:app: catalog
+    matchExpressions:
+    - key: k8s:tier
+      operator: In
+      values:
+      - web
+      - api
+  ingress:
+  - fromEndpoints:
+    - matchExpressions:
+      - key: k8s:app
+        operator: Exists
+`
+		path := filepath.Join(t.TempDir(), "policy.yaml")
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write policy file: %v", err)
+		}
+
+		parsed, err := ParsePoliciesFromFile(path)
+		if err != nil {
+			t.Fatalf("ParsePoliciesFromFile() error = %v", err)
+		}
+		wantSelector := []MatchExpression{{Key: "k8s:tier", Operator: "In", Values: []string{"web", "api"}}}
+		if got := parsed[0].Spec.EndpointSelector.MatchExpressions; !reflect.DeepEqual(got, wantSelector) {
+			t.Errorf("endpointSelector.matchExpressions = %+v, want %+v", got, wantSelector)
+		}
+
+		written, err := PolicyToYAML(parsed[0])
+		if err != nil {
+			t.Fatalf("PolicyToYAML() error = %v", err)
+		}
+		for _, want := range []string{"operator: In", "- api", "operator: Exists"} {
+			if !strings.Contains(written, want) {
+				t.Errorf("Written policy missing %q:\n%s", want, written)
+			}
+		}
+	})
+
+	t.Run("unsupported kind", func(t *testing.T) {
+		content := `apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: catalog-policy
+`
+		path := filepath.Join(t.TempDir(), "policy.yaml")
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write policy file: %v", err)
+		}
+
+		if _, err := ParsePoliciesFromFile(path); err == nil {
+			t.Errorf("Expected error for NetworkPolicy document")
+		}
+	})
+}
+
+func TestPoliciesToJSONStable(t *testing.T) {
+	flows := []*hubble.ParsedFlow{
+		{
+			SourceLabels:    map[string]string{"k8s:app": "frontend", "k8s:tier": "web", "k8s:version": "v2", "k8s:team": "shop"},
+			SourceNamespace: "shop",
+			DestLabels:      map[string]string{"k8s:app": "catalog", "k8s:tier": "api", "k8s:version": "v1", "k8s:team": "shop"},
+			DestNamespace:   "shop",
+			DestPort:        8080,
+			Protocol:        "TCP",
+		},
+		{
+			SourceLabels:    map[string]string{"k8s:app": "catalog", "k8s:tier": "api"},
+			SourceNamespace: "shop",
+			DestLabels:      map[string]string{"k8s:app": "database", "k8s:tier": "data"},
+			DestNamespace:   "data",
+			DestPort:        5432,
+			Protocol:        "TCP",
+		},
+	}
+
+	var first []byte
+	for run := 0; run < 10; run++ {
+		policies, err := SynthesizePoliciesWithOptions(flows, Options{DefaultDeny: true})
+		if err != nil {
+			t.Fatalf("SynthesizePoliciesWithOptions() error = %v", err)
+		}
+		// Input order must not matter either
+		if run%2 == 1 {
+			for i, j := 0, len(policies)-1; i < j; i, j = i+1, j-1 {
+				policies[i], policies[j] = policies[j], policies[i]
+			}
+		}
+
+		data, err := PoliciesToJSON(policies)
+		if err != nil {
+			t.Fatalf("PoliciesToJSON() error = %v", err)
+		}
+		if run == 0 {
+			first = data
+			continue
+		}
+		if string(data) != string(first) {
+			t.Fatalf("Run %d produced different JSON:\n%s\nwant\n%s", run, data, first)
+		}
+	}
+
+	var decoded []map[string]interface{}
+	if err := json.Unmarshal(first, &decoded); err != nil {
+		t.Fatalf("PoliciesToJSON() produced invalid JSON: %v", err)
+	}
+	if len(decoded) != 4 {
+		t.Fatalf("Expected 4 policies, got %d", len(decoded))
+	}
+	if name := decoded[0]["metadata"].(map[string]interface{})["name"]; name != "database-policy" {
+		t.Errorf("Expected data/database-policy first, got %v", name)
+	}
+	if want := `"enableDefaultDeny": {`; !strings.Contains(string(first), want) {
+		t.Errorf("Expected default-deny companion with %s", want)
+	}
+	app, tier := strings.Index(string(first), `"k8s:app": "catalog"`), strings.Index(string(first), `"k8s:tier": "api"`)
+	if app < 0 || tier < 0 || app > tier {
+		t.Errorf("Expected matchLabels keys in sorted order")
+	}
+}
+
+// updateGolden rewrites testdata/policy.golden.yaml from the current output:
+// go test ./internal/synth -run Golden -update
+var updateGolden = flag.Bool("update", false, "update golden files")
+
+func TestWritePoliciesToFileGolden(t *testing.T) {
+	collection, err := hubble.ReadFlowsFromFile(filepath.Join("testdata", "flows.json"))
+	if err != nil {
+		t.Fatalf("ReadFlowsFromFile() error = %v", err)
+	}
+	flows, err := hubble.ParseFlows(collection)
+	if err != nil {
+		t.Fatalf("ParseFlows() error = %v", err)
+	}
+	policies, err := SynthesizePolicies(hubble.DeduplicateFlows(flows))
+	if err != nil {
+		t.Fatalf("SynthesizePolicies() error = %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := WritePoliciesToFile(policies, path); err != nil {
+		t.Fatalf("WritePoliciesToFile() error = %v", err)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+
+	golden := filepath.Join("testdata", "policy.golden.yaml")
+	if *updateGolden {
+		if err := os.WriteFile(golden, got, 0644); err != nil {
+			t.Fatalf("Failed to update golden file: %v", err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("Failed to read golden file (run with -update to create it): %v", err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("WritePoliciesToFile() output differs from %s (run with -update if the change is intended):\n%s", golden, got)
+	}
+}
+
+func TestEncodeYAMLRejectsAnchors(t *testing.T) {
+	var node yaml.Node
+	if err := yaml.Unmarshal([]byte("base: &base {a: 1}\nderived:\n  <<: *base\n"), &node); err != nil {
+		t.Fatalf("yaml.Unmarshal() error = %v", err)
+	}
+	if _, err := encodeYAML(&node); err == nil || !strings.Contains(err.Error(), "anchor") {
+		t.Errorf("encodeYAML() error = %v, want an anchor error", err)
+	}
+
+	// Map keys are sorted however the map was built
+	data, err := encodeYAML(map[string]string{"k8s:tier": "api", "k8s:app": "catalog", "k8s:io.kubernetes.pod.namespace": "shop"})
+	if err != nil {
+		t.Fatalf("encodeYAML() error = %v", err)
+	}
+	expected := "k8s:app: catalog\nk8s:io.kubernetes.pod.namespace: shop\nk8s:tier: api\n"
+	if string(data) != expected {
+		t.Errorf("encodeYAML() = %q, want %q", data, expected)
+	}
+}
@@ -0,0 +1,63 @@
+package validate
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	// labelNamePattern matches the name part of a label key and label values
+	labelNamePattern = regexp.MustCompile(`^[A-Za-z0-9]([-A-Za-z0-9_.]*[A-Za-z0-9])?$`)
+	// dnsSubdomainPattern matches the optional prefix of a label key
+	dnsSubdomainPattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9.]*[a-z0-9])?$`)
+)
+
+// LabelKey validates a selector label key: an optional Cilium source such as
+// "k8s:" or "reserved:", then an optional DNS subdomain prefix and "/", then
+// a name of up to 63 alphanumeric characters, '-', '_' or '.'. Keys from the
+// cidr: and fqdn: sources hold CIDRs and DNS patterns and are not checked.
+func LabelKey(key string) error {
+	name := key
+	if source, rest, found := strings.Cut(key, ":"); found {
+		if source == "cidr" || source == "fqdn" {
+			return nil
+		}
+		name = rest
+	}
+
+	if prefix, rest, found := strings.Cut(name, "/"); found {
+		if prefix == "" || len(prefix) > 253 || !dnsSubdomainPattern.MatchString(prefix) {
+			return fmt.Errorf("invalid label key %q: prefix %q must be a lowercase DNS subdomain", key, prefix)
+		}
+		name = rest
+	}
+
+	if name == "" {
+		return fmt.Errorf("invalid label key %q: name cannot be empty", key)
+	}
+	if len(name) > 63 {
+		return fmt.Errorf("invalid label key %q: name must be at most 63 characters", key)
+	}
+	if !labelNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid label key %q: name must consist of alphanumeric characters, '-', '_' or '.', and start and end with an alphanumeric character", key)
+	}
+
+	return nil
+}
+
+// LabelValue validates a label value: empty, or up to 63 alphanumeric
+// characters, '-', '_' or '.' starting and ending with an alphanumeric
+// character
+func LabelValue(value string) error {
+	if value == "" {
+		return nil
+	}
+	if len(value) > 63 {
+		return fmt.Errorf("invalid label value %q: must be at most 63 characters", value)
+	}
+	if !labelNamePattern.MatchString(value) {
+		return fmt.Errorf("invalid label value %q: must consist of alphanumeric characters, '-', '_' or '.', and start and end with an alphanumeric character", value)
+	}
+	return nil
+}
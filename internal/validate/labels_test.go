@@ -0,0 +1,63 @@
+package validate
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLabelKey(t *testing.T) {
+	tests := []struct {
+		key     string
+		wantErr bool
+	}{
+		{key: "app"},
+		{key: "k8s:app"},
+		{key: "k8s:app.kubernetes.io/name"},
+		{key: "k8s:io.kubernetes.pod.namespace"},
+		{key: "k8s:io.cilium.k8s.namespace.labels.kubernetes.io/metadata.name"},
+		{key: "reserved:host"},
+		{key: "cidr:2001:db8::/32"},
+		{key: "fqdn:*.example.com"},
+		{key: "k8s:front end", wantErr: true},
+		{key: "k8s:-app", wantErr: true},
+		{key: "k8s:", wantErr: true},
+		{key: "k8s:Example.com/app", wantErr: true},
+		{key: "k8s:/app", wantErr: true},
+		{key: "k8s:example.com/", wantErr: true},
+		{key: "k8s:a/b/c", wantErr: true},
+		{key: "k8s:" + strings.Repeat("a", 64), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			err := LabelKey(tt.key)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LabelKey(%q) error = %v, wantErr %v", tt.key, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLabelValue(t *testing.T) {
+	tests := []struct {
+		value   string
+		wantErr bool
+	}{
+		{value: ""},
+		{value: "frontend"},
+		{value: "v1.2.3_rc-1"},
+		{value: "front end", wantErr: true},
+		{value: "frontend-", wantErr: true},
+		{value: "a/b", wantErr: true},
+		{value: strings.Repeat("a", 64), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			err := LabelValue(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LabelValue(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+		})
+	}
+}
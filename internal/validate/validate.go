@@ -55,15 +55,50 @@ func Namespace(ns string) error {
 	}
 
 	// Basic validation: alphanumeric and hyphens, must start/end with alphanumeric
-	if !isValidK8sName(ns) {
+	if !IsValidK8sName(ns) {
 		return fmt.Errorf("invalid namespace name: %s (must be lowercase alphanumeric with hyphens)", ns)
 	}
 
 	return nil
 }
 
-// isValidK8sName validates Kubernetes resource names
-func isValidK8sName(name string) bool {
+// ResourceName validates a Kubernetes resource name, such as a policy name
+func ResourceName(name string) error {
+	if !IsValidK8sName(name) {
+		return fmt.Errorf("invalid resource name %q (must be at most 253 lowercase alphanumeric characters or hyphens, starting and ending with an alphanumeric)", name)
+	}
+	return nil
+}
+
+// MaxPolicyNameLength is the longest policy name Cilium accepts: it copies
+// the name into a label value on every rule, and label values are limited to
+// 63 characters
+const MaxPolicyNameLength = 63
+
+// PolicyName validates a Cilium policy name: a Kubernetes resource name of at
+// most MaxPolicyNameLength characters
+func PolicyName(name string) error {
+	if name == "" {
+		return fmt.Errorf("policy name cannot be empty")
+	}
+	if len(name) > MaxPolicyNameLength {
+		return fmt.Errorf("invalid policy name %q: %d characters, must be at most %d", name, len(name), MaxPolicyNameLength)
+	}
+	if !IsValidK8sName(name) {
+		for i, r := range name {
+			if !isAlphanumeric(r) && r != '-' {
+				return fmt.Errorf("invalid policy name %q: invalid character %q at position %d (must be lowercase alphanumeric or '-')", name, r, i)
+			}
+		}
+		return fmt.Errorf("invalid policy name %q: must start and end with a lowercase alphanumeric character", name)
+	}
+	return nil
+}
+
+// IsValidK8sName reports whether name is a valid Kubernetes resource name:
+// at most 253 lowercase alphanumeric characters or hyphens, starting and
+// ending with an alphanumeric
+func IsValidK8sName(name string) bool {
 	if len(name) == 0 || len(name) > 253 {
 		return false
 	}
@@ -102,3 +137,22 @@ func FileExtension(path string, expectedExt string) error {
 
 	return nil
 }
+
+// FileExtensionOrGzip validates that a file has the expected extension,
+// optionally followed by .gz (e.g. flows.json or flows.json.gz)
+func FileExtensionOrGzip(path string, expectedExt string) error {
+	if !strings.HasPrefix(expectedExt, ".") {
+		expectedExt = "." + expectedExt
+	}
+
+	trimmed := path
+	if strings.EqualFold(filepath.Ext(path), ".gz") {
+		trimmed = strings.TrimSuffix(path, filepath.Ext(path))
+	}
+
+	if err := FileExtension(trimmed, expectedExt); err != nil {
+		return fmt.Errorf("file must have %s or %s.gz extension, got %s", expectedExt, expectedExt, filepath.Ext(path))
+	}
+
+	return nil
+}
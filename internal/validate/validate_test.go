@@ -3,6 +3,7 @@ package validate
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -145,6 +146,54 @@ func TestNamespace(t *testing.T) {
 	}
 }
 
+func TestResourceName(t *testing.T) {
+	tests := []struct {
+		name         string
+		resourceName string
+		wantErr      bool
+	}{
+		{name: "valid name", resourceName: "shop-catalog-ingress", wantErr: false},
+		{name: "empty name", resourceName: "", wantErr: true},
+		{name: "uppercase", resourceName: "Catalog-policy", wantErr: true},
+		{name: "underscore", resourceName: "catalog_policy", wantErr: true},
+		{name: "trailing hyphen", resourceName: "catalog-", wantErr: true},
+		{name: "too long", resourceName: strings.Repeat("a", 254), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ResourceName(tt.resourceName)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ResourceName() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPolicyName(t *testing.T) {
+	tests := []struct {
+		name       string
+		policyName string
+		wantErr    bool
+	}{
+		{name: "valid name", policyName: "shop-catalog-policy", wantErr: false},
+		{name: "63 characters", policyName: strings.Repeat("a", 63), wantErr: false},
+		{name: "empty name", policyName: "", wantErr: true},
+		{name: "64 characters", policyName: strings.Repeat("a", 64), wantErr: true},
+		{name: "dot", policyName: "catalog.policy", wantErr: true},
+		{name: "leading hyphen", policyName: "-catalog", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := PolicyName(tt.policyName)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("PolicyName() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestFileExtension(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -187,3 +236,27 @@ func TestFileExtension(t *testing.T) {
 		})
 	}
 }
+
+func TestFileExtensionOrGzip(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		wantErr bool
+	}{
+		{name: "plain", path: "flows.json"},
+		{name: "gzipped", path: "flows.json.gz"},
+		{name: "case insensitive", path: "flows.JSON.GZ"},
+		{name: "gzipped wrong extension", path: "flows.txt.gz", wantErr: true},
+		{name: "gzip only", path: "flows.gz", wantErr: true},
+		{name: "wrong extension", path: "flows.yaml", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := FileExtensionOrGzip(tt.path, ".json")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("FileExtensionOrGzip() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,28 @@
+package validate
+
+import "strings"
+
+// SplitYAMLDocuments splits multi-document YAML into individual documents
+func SplitYAMLDocuments(yamlContent string) []string {
+	documents := make([]string, 0)
+	currentDoc := strings.Builder{}
+
+	lines := strings.Split(yamlContent, "\n")
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "---" {
+			if currentDoc.Len() > 0 {
+				documents = append(documents, currentDoc.String())
+				currentDoc.Reset()
+			}
+			continue
+		}
+		currentDoc.WriteString(line)
+		currentDoc.WriteString("\n")
+	}
+
+	if currentDoc.Len() > 0 {
+		documents = append(documents, currentDoc.String())
+	}
+
+	return documents
+}
@@ -0,0 +1,33 @@
+package validate
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitYAMLDocuments(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected []string
+	}{
+		{
+			name:     "single document",
+			content:  "kind: A\n",
+			expected: []string{"kind: A\n\n"},
+		},
+		{
+			name:     "leading separator",
+			content:  "---\nkind: A\n---\nkind: B",
+			expected: []string{"kind: A\n", "kind: B\n"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SplitYAMLDocuments(tt.content); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("SplitYAMLDocuments() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
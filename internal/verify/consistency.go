@@ -0,0 +1,155 @@
+package verify
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// filePolicy holds the parts of a policy document compared by the
+// file-level checks
+type filePolicy struct {
+	Document int    `yaml:"-"`
+	Kind     string `yaml:"kind"`
+	Metadata struct {
+		Name      string            `yaml:"name"`
+		Namespace string            `yaml:"namespace"`
+		Labels    map[string]string `yaml:"labels"`
+	} `yaml:"metadata"`
+	Spec struct {
+		EndpointSelector map[string]interface{} `yaml:"endpointSelector"`
+		Ingress          []interface{}          `yaml:"ingress"`
+		Egress           []interface{}          `yaml:"egress"`
+	} `yaml:"spec"`
+}
+
+// parseFilePolicy decodes the parts of a document the file-level checks use
+func parseFilePolicy(doc string, docNum int) (*filePolicy, error) {
+	var policy filePolicy
+	if err := yaml.Unmarshal([]byte(doc), &policy); err != nil {
+		return nil, err
+	}
+	policy.Document = docNum
+	return &policy, nil
+}
+
+// namespace returns the policy's namespace, "default" for namespaced
+// policies without one and "" for cluster-wide policies
+func (p *filePolicy) namespace() string {
+	if p.Kind == "CiliumClusterwideNetworkPolicy" {
+		return ""
+	}
+	if p.Metadata.Namespace == "" {
+		return "default"
+	}
+	return p.Metadata.Namespace
+}
+
+// qualifiedName returns the policy's kind and namespace/name, which must be
+// unique in a cluster
+func (p *filePolicy) qualifiedName() string {
+	if namespace := p.namespace(); namespace != "" {
+		return fmt.Sprintf("%s %s/%s", p.Kind, namespace, p.Metadata.Name)
+	}
+	return fmt.Sprintf("%s %s", p.Kind, p.Metadata.Name)
+}
+
+// hasRules reports whether the policy allows any traffic, as opposed to
+// only denying by default with empty ingress and egress
+func (p *filePolicy) hasRules() bool {
+	return len(p.Spec.Ingress) > 0 || len(p.Spec.Egress) > 0
+}
+
+// splitFromLabel marks the parts of a policy propose split to stay under
+// --max-rules-per-policy with the name of the original policy
+// (synth.LabelSplitFrom)
+const splitFromLabel = "policypilot.io/split-from"
+
+// selectorScope identifies the endpoints a policy selects
+type selectorScope struct {
+	kind      string
+	namespace string
+	// selector is the endpointSelector as YAML, with sorted keys
+	selector string
+}
+
+// checkFileConsistency runs the checks that compare documents with each
+// other, appending to result.Errors and result.Warnings:
+//
+//   - two policies with the same kind, namespace and name are an error, as
+//     applying the file keeps only the last one
+//   - two policies with rules selecting exactly the same endpoints are a
+//     warning: Cilium allows the union of their rules, so neither restricts
+//     what the other allows. Default-deny policies without rules are
+//     expected next to the policy they complement, and the parts of a split
+//     policy, labelled with the same split-from name, next to each other.
+func checkFileConsistency(result *VerificationResult, policies []*filePolicy) {
+	names := make(map[string][]int)
+	var nameKeys []string
+	selectors := make(map[selectorScope][]int)
+	var selectorKeys []selectorScope
+	// The policies selecting each set of endpoints, with the parts of a
+	// split policy counted once
+	origins := make(map[selectorScope]map[string]bool)
+
+	for _, policy := range policies {
+		if policy.Metadata.Name == "" {
+			continue
+		}
+		name := policy.qualifiedName()
+		if _, seen := names[name]; !seen {
+			nameKeys = append(nameKeys, name)
+		}
+		names[name] = append(names[name], policy.Document)
+
+		if !policy.hasRules() || policy.Spec.EndpointSelector == nil {
+			continue
+		}
+		selector, err := yaml.Marshal(policy.Spec.EndpointSelector)
+		if err != nil {
+			continue
+		}
+		key := selectorScope{kind: policy.Kind, namespace: policy.namespace(), selector: string(selector)}
+		if _, seen := selectors[key]; !seen {
+			selectorKeys = append(selectorKeys, key)
+			origins[key] = make(map[string]bool)
+		}
+		selectors[key] = append(selectors[key], policy.Document)
+		origin := strconv.Itoa(policy.Document)
+		if splitFrom := policy.Metadata.Labels[splitFromLabel]; splitFrom != "" {
+			origin = "split from " + splitFrom
+		}
+		origins[key][origin] = true
+	}
+
+	for _, name := range nameKeys {
+		if docs := names[name]; len(docs) > 1 {
+			result.Valid = false
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: duplicate %s; applying the file keeps only the last one", documentList(docs), name))
+		}
+	}
+
+	for _, key := range selectorKeys {
+		if docs := selectors[key]; len(origins[key]) > 1 {
+			scope := "cluster-wide"
+			if key.namespace != "" {
+				scope = "in namespace " + key.namespace
+			}
+			result.Warnings = append(result.Warnings, fmt.Sprintf("%s: policies %s select the same endpoints; Cilium allows the union of their rules, so merge them into one policy",
+				documentList(docs), scope))
+		}
+	}
+}
+
+// documentList renders document numbers as "Documents 1 and 3" or
+// "Documents 1, 2 and 4"
+func documentList(docs []int) string {
+	numbers := make([]string, len(docs))
+	for i, doc := range docs {
+		numbers[i] = strconv.Itoa(doc)
+	}
+	last := len(numbers) - 1
+	return fmt.Sprintf("Documents %s and %s", strings.Join(numbers[:last], ", "), numbers[last])
+}
@@ -0,0 +1,121 @@
+package verify
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestVerifyPoliciesFileConsistency(t *testing.T) {
+	// policy renders a policy selecting k8s:app=app in namespace, with an
+	// ingress rule unless rules is empty
+	policy := func(kind, name, namespace, app, rules string) string {
+		doc := fmt.Sprintf("apiVersion: cilium.io/v2\nkind: %s\nmetadata:\n  name: %s\n", kind, name)
+		if namespace != "" {
+			doc += fmt.Sprintf("  namespace: %s\n", namespace)
+		}
+		doc += fmt.Sprintf("spec:\n  endpointSelector:\n    matchLabels:\n      k8s:app: %s\n", app)
+		if rules == "" {
+			return doc + "  ingress: []\n  egress: []\n"
+		}
+		return doc + fmt.Sprintf("  ingress:\n  - fromEndpoints:\n    - matchLabels:\n        k8s:app: %s\n", rules)
+	}
+	// splitPart labels a policy as a part of the policy named from
+	splitPart := func(doc, from string) string {
+		return strings.Replace(doc, "metadata:\n", "metadata:\n  labels:\n    policypilot.io/split-from: "+from+"\n", 1)
+	}
+	const cnp = "CiliumNetworkPolicy"
+	const ccnp = "CiliumClusterwideNetworkPolicy"
+
+	tests := []struct {
+		name     string
+		docs     []string
+		valid    bool
+		errors   []string
+		warnings []string
+	}{
+		{
+			name: "duplicate names in default",
+			docs: []string{
+				policy(cnp, "frontend-policy", "default", "frontend", "ingress"),
+				policy(cnp, "frontend-policy", "", "web", "ingress"),
+			},
+			valid:  false,
+			errors: []string{"Documents 1 and 2: duplicate CiliumNetworkPolicy default/frontend-policy; applying the file keeps only the last one"},
+		},
+		{
+			name: "same name in other namespaces",
+			docs: []string{
+				policy(cnp, "frontend-policy", "default", "frontend", "ingress"),
+				policy(cnp, "frontend-policy", "shop", "frontend", "ingress"),
+			},
+			valid: true,
+		},
+		{
+			name: "duplicate cluster-wide names",
+			docs: []string{
+				policy(ccnp, "frontend-policy", "", "frontend", "ingress"),
+				policy(cnp, "frontend-policy", "shop", "web", "ingress"),
+				policy(ccnp, "frontend-policy", "", "web", "ingress"),
+			},
+			valid:  false,
+			errors: []string{"Documents 1 and 3: duplicate CiliumClusterwideNetworkPolicy frontend-policy; applying the file keeps only the last one"},
+		},
+		{
+			name: "policies selecting the same endpoints",
+			docs: []string{
+				policy(cnp, "frontend-policy", "shop", "frontend", "ingress"),
+				policy(cnp, "catalog-policy", "shop", "catalog", "frontend"),
+				policy(cnp, "frontend-extra", "shop", "frontend", "monitoring"),
+				policy(cnp, "frontend-more", "shop", "frontend", "admin"),
+			},
+			valid:    true,
+			warnings: []string{"Documents 1, 3 and 4: policies in namespace shop select the same endpoints; Cilium allows the union of their rules, so merge them into one policy"},
+		},
+		{
+			name: "parts of a split policy",
+			docs: []string{
+				splitPart(policy(cnp, "frontend-policy", "shop", "frontend", "ingress"), "frontend-policy"),
+				splitPart(policy(cnp, "frontend-policy-2", "shop", "frontend", "monitoring"), "frontend-policy"),
+			},
+			valid: true,
+		},
+		{
+			name: "split policy next to another policy",
+			docs: []string{
+				splitPart(policy(cnp, "frontend-policy", "shop", "frontend", "ingress"), "frontend-policy"),
+				splitPart(policy(cnp, "frontend-policy-2", "shop", "frontend", "monitoring"), "frontend-policy"),
+				policy(cnp, "frontend-extra", "shop", "frontend", "admin"),
+			},
+			valid:    true,
+			warnings: []string{"Documents 1, 2 and 3: policies in namespace shop select the same endpoints; Cilium allows the union of their rules, so merge them into one policy"},
+		},
+		{
+			name: "default-deny companion",
+			docs: []string{
+				policy(cnp, "frontend-policy", "shop", "frontend", "ingress"),
+				policy(cnp, "frontend-policy-default-deny", "shop", "frontend", ""),
+			},
+			valid: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := VerifyPolicies(writePolicyFile(t, strings.Join(tt.docs, "---\n")))
+			if err != nil {
+				t.Fatalf("VerifyPolicies() error = %v", err)
+			}
+			if result.Valid != tt.valid {
+				t.Errorf("Valid = %v, want %v (errors: %v)", result.Valid, tt.valid, result.Errors)
+			}
+			if len(result.Errors) != len(tt.errors) || (len(tt.errors) > 0 && !reflect.DeepEqual(result.Errors, tt.errors)) {
+				t.Errorf("Errors = %v, want %v", result.Errors, tt.errors)
+			}
+			if len(result.Warnings) != len(tt.warnings) || (len(tt.warnings) > 0 && !reflect.DeepEqual(result.Warnings, tt.warnings)) {
+				t.Errorf("Warnings = %v, want %v", result.Warnings, tt.warnings)
+			}
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package verify
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/prabhakaran-jm/cilium-policypilot/internal/hubble"
+)
+
+// IgnoreFile is the file in a policy directory listing glob patterns of
+// files and directories VerifyPolicyDirectory skips, one per line, as for
+// Options.Exclude. Blank lines and lines starting with # are ignored.
+const IgnoreFile = ".cppignore"
+
+// FileResult summarizes the verification of one file in a directory
+type FileResult struct {
+	// Path is relative to the directory, with forward slashes
+	Path     string `json:"path"`
+	Valid    bool   `json:"valid"`
+	Policies int    `json:"policies"`
+	Errors   int    `json:"errors"`
+	Warnings int    `json:"warnings"`
+}
+
+// VerifyPolicyDirectory verifies every *.yaml and *.yml file in a directory
+// tree like VerifyPoliciesWithOptions, except Kustomize kustomization files,
+// hidden directories and paths matching opts.Exclude or the directory's
+// IgnoreFile. The result aggregates the files: errors and warnings are
+// prefixed with the file's path, each policy records its File, and Files
+// summarizes each file. Documents are only checked against others in the
+// same file.
+func VerifyPolicyDirectory(dir string, opts Options) (*VerificationResult, error) {
+	return verifyDirectory(dir, opts, func(path string) (*VerificationResult, error) {
+		return VerifyPoliciesWithOptions(path, opts)
+	})
+}
+
+// VerifyPolicyDirectoryAgainstFlows verifies a directory tree like
+// VerifyPolicyDirectory, checking each file against flows like
+// VerifyPoliciesAgainstFlows
+func VerifyPolicyDirectoryAgainstFlows(dir string, flows []*hubble.ParsedFlow, opts Options) (*VerificationResult, error) {
+	return verifyDirectory(dir, opts, func(path string) (*VerificationResult, error) {
+		return VerifyPoliciesAgainstFlows(path, flows, opts)
+	})
+}
+
+// verifyDirectory verifies the policy files of a directory tree with
+// verifyFile and aggregates their results
+func verifyDirectory(dir string, opts Options, verifyFile func(string) (*VerificationResult, error)) (*VerificationResult, error) {
+	exclude, err := readIgnoreFile(filepath.Join(dir, IgnoreFile))
+	if err != nil {
+		return nil, err
+	}
+	exclude = append(exclude, opts.Exclude...)
+	for _, pattern := range exclude {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid exclude pattern %q: %w", pattern, err)
+		}
+	}
+
+	files, err := policyFiles(dir, exclude)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no policy files (*.yaml, *.yml) found in %s", dir)
+	}
+
+	result := &VerificationResult{
+		Valid:    true,
+		Errors:   make([]string, 0),
+		Warnings: make([]string, 0),
+		Policies: make([]PolicyInfo, 0),
+	}
+	for _, file := range files {
+		fileResult, err := verifyFile(filepath.Join(dir, filepath.FromSlash(file)))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		addFileResult(result, file, fileResult)
+	}
+	return result, nil
+}
+
+// addFileResult adds the result of verifying one file to the aggregated
+// result
+func addFileResult(result *VerificationResult, file string, fileResult *VerificationResult) {
+	summary := FileResult{
+		Path:     file,
+		Valid:    fileResult.Valid,
+		Policies: len(fileResult.Policies),
+		Errors:   len(fileResult.Errors),
+		Warnings: len(fileResult.Warnings),
+	}
+	if !fileResult.Valid {
+		result.Valid = false
+	}
+	for _, message := range fileResult.Errors {
+		result.Errors = append(result.Errors, file+": "+message)
+	}
+	for _, message := range fileResult.Warnings {
+		result.Warnings = append(result.Warnings, file+": "+message)
+	}
+	for _, policy := range fileResult.Policies {
+		policy.File = file
+		// The errors of documents that failed to parse are also in
+		// fileResult.Errors
+		if policy.Name != "" || policy.Kind != "" {
+			summary.Errors += len(policy.Errors)
+		}
+		result.Policies = append(result.Policies, policy)
+	}
+	for _, unobserved := range fileResult.UnobservedPorts {
+		unobserved.File = file
+		result.UnobservedPorts = append(result.UnobservedPorts, unobserved)
+	}
+	result.Files = append(result.Files, summary)
+}
+
+// policyFiles lists the policy files in a directory tree, relative to it
+// with forward slashes, in lexical order
+func policyFiles(dir string, exclude []string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if filePath == dir {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, filePath)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if entry.IsDir() {
+			if strings.HasPrefix(entry.Name(), ".") || isExcluded(rel, exclude) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		ext := strings.ToLower(path.Ext(rel))
+		if ext != ".yaml" && ext != ".yml" {
+			return nil
+		}
+		if strings.EqualFold(strings.TrimSuffix(entry.Name(), path.Ext(rel)), "kustomization") || isExcluded(rel, exclude) {
+			return nil
+		}
+		files = append(files, rel)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy directory: %w", err)
+	}
+	return files, nil
+}
+
+// isExcluded reports whether a relative path or its base name matches any
+// of the patterns
+func isExcluded(rel string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, rel); matched {
+			return true
+		}
+		if matched, _ := path.Match(pattern, path.Base(rel)); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// readIgnoreFile reads the patterns of an ignore file, or none if it does
+// not exist
+func readIgnoreFile(filePath string) ([]string, error) {
+	file, err := os.Open(filePath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", IgnoreFile, err)
+	}
+	defer file.Close()
+
+	var patterns []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, strings.TrimSuffix(line, "/"))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", IgnoreFile, err)
+	}
+	return patterns, nil
+}
@@ -0,0 +1,82 @@
+package verify
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestVerifyPolicyDirectory(t *testing.T) {
+	policy := func(name string) string {
+		return "apiVersion: cilium.io/v2\nkind: CiliumNetworkPolicy\nmetadata:\n  name: " + name + "\n  namespace: shop\n" +
+			"spec:\n  endpointSelector:\n    matchLabels:\n      k8s:app: " + name + "\n  ingress:\n  - fromEndpoints:\n    - matchLabels:\n        k8s:app: frontend\n"
+	}
+	invalid := "apiVersion: cilium.io/v2\nkind: CiliumNetworkPolicy\nmetadata:\n  name: broken\nspec:\n  ingress: []\n"
+
+	files := map[string]string{
+		"catalog.yaml":               policy("catalog"),
+		"apps/cart.yml":              policy("cart") + "---\n" + policy("cart-v2"),
+		"apps/broken.yaml":           invalid,
+		"apps/kustomization.yaml":    "resources:\n- cart.yml\n",
+		"apps/README.md":             "not a policy",
+		"overlays/dev/patch.yaml":    "not: a policy\n",
+		"scratch/draft.yaml":         invalid,
+		".git/config.yaml":           invalid,
+		".cppignore":                 "# work in progress\nscratch/\n",
+		"apps/catalog-test.yaml":     invalid,
+		"apps/nested/database.yaml":  policy("database"),
+		"apps/nested/database.yml.j": invalid,
+	}
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	result, err := VerifyPolicyDirectory(dir, Options{Exclude: []string{"overlays", "*-test.yaml"}})
+	if err != nil {
+		t.Fatalf("VerifyPolicyDirectory() error = %v", err)
+	}
+
+	expected := []FileResult{
+		{Path: "apps/broken.yaml", Valid: false, Policies: 1, Errors: 1},
+		{Path: "apps/cart.yml", Valid: true, Policies: 2},
+		{Path: "apps/nested/database.yaml", Valid: true, Policies: 1},
+		{Path: "catalog.yaml", Valid: true, Policies: 1},
+	}
+	if !reflect.DeepEqual(result.Files, expected) {
+		t.Errorf("Files = %+v, want %+v", result.Files, expected)
+	}
+	if result.Valid {
+		t.Errorf("Expected the directory to be invalid because of apps/broken.yaml")
+	}
+	if len(result.Policies) != 5 || result.Policies[0].File != "apps/broken.yaml" || result.Policies[4].File != "catalog.yaml" {
+		t.Errorf("Expected 5 policies attributed to their files, got %+v", result.Policies)
+	}
+
+	// Without the invalid file, the directory is valid
+	valid, err := VerifyPolicyDirectory(dir, Options{Exclude: []string{"overlays", "*-test.yaml", "broken.yaml"}})
+	if err != nil {
+		t.Fatalf("VerifyPolicyDirectory() error = %v", err)
+	}
+	if !valid.Valid || len(valid.Files) != 3 {
+		t.Errorf("Expected 3 valid files, got %+v", valid)
+	}
+}
+
+func TestVerifyPolicyDirectoryErrors(t *testing.T) {
+	empty := t.TempDir()
+	if _, err := VerifyPolicyDirectory(empty, Options{}); err == nil || !strings.Contains(err.Error(), "no policy files") {
+		t.Errorf("Expected an error for a directory without policy files, got %v", err)
+	}
+	if _, err := VerifyPolicyDirectory(empty, Options{Exclude: []string{"["}}); err == nil || !strings.Contains(err.Error(), "invalid exclude pattern") {
+		t.Errorf("Expected an error for an invalid pattern, got %v", err)
+	}
+}
@@ -0,0 +1,215 @@
+package verify
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/prabhakaran-jm/cilium-policypilot/internal/hubble"
+	"github.com/prabhakaran-jm/cilium-policypilot/internal/policymatch"
+	"github.com/prabhakaran-jm/cilium-policypilot/internal/validate"
+	"gopkg.in/yaml.v3"
+)
+
+// UnobservedPort is a port an ingress rule allows that no flow used, which
+// may indicate an over-permissive or stale rule
+type UnobservedPort struct {
+	Document  int    `json:"document"`
+	Policy    string `json:"policy"`
+	Namespace string `json:"namespace,omitempty"`
+	// Rule is the rule's position, e.g. "ingress[0]"
+	Rule string `json:"rule"`
+	// Port is the allowed port or range and protocol, e.g. "9090/TCP"
+	Port string `json:"port"`
+	// File is the policy's file, only set by VerifyPolicyDirectoryAgainstFlows
+	File string `json:"file,omitempty"`
+}
+
+// flowCheckPolicy holds the parts of a policy needed to match it against flows
+type flowCheckPolicy struct {
+	Kind     string `yaml:"kind"`
+	Metadata struct {
+		Name      string `yaml:"name"`
+		Namespace string `yaml:"namespace"`
+	} `yaml:"metadata"`
+	Spec struct {
+		EndpointSelector policymatch.Selector `yaml:"endpointSelector"`
+		Ingress          []struct {
+			FromEndpoints []policymatch.Selector `yaml:"fromEndpoints"`
+			FromEntities  []string               `yaml:"fromEntities"`
+			FromCIDR      []string               `yaml:"fromCIDR"`
+			ToPorts       []struct {
+				Ports []flowCheckPort `yaml:"ports"`
+			} `yaml:"toPorts"`
+		} `yaml:"ingress"`
+	} `yaml:"spec"`
+}
+
+type flowCheckPort struct {
+	Port     string `yaml:"port"`
+	EndPort  int    `yaml:"endPort"`
+	Protocol string `yaml:"protocol"`
+}
+
+// VerifyPoliciesAgainstFlows verifies policies like VerifyPoliciesWithOptions
+// and also lists, in UnobservedPorts and as warnings, the ports that ingress
+// rules allow but no flow from the rule's sources to the selected endpoints
+// used. Named ports and rules without toPorts are not checked.
+func VerifyPoliciesAgainstFlows(filePath string, flows []*hubble.ParsedFlow, opts Options) (*VerificationResult, error) {
+	result, err := VerifyPoliciesWithOptions(filePath, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %w", err)
+	}
+
+	for i, doc := range validate.SplitYAMLDocuments(string(data)) {
+		if strings.TrimSpace(doc) == "" {
+			continue
+		}
+		var policy flowCheckPolicy
+		if err := yaml.Unmarshal([]byte(doc), &policy); err != nil {
+			// Already reported as a syntax error
+			continue
+		}
+
+		for _, unobserved := range unobservedIngressPorts(&policy, flows) {
+			unobserved.Document = i + 1
+			result.UnobservedPorts = append(result.UnobservedPorts, unobserved)
+			result.Warnings = append(result.Warnings, fmt.Sprintf("Document %d (%s): %s allows %s, which was not observed in the flows",
+				unobserved.Document, unobserved.Policy, unobserved.Rule, unobserved.Port))
+		}
+	}
+
+	if opts.Strict && len(result.Warnings) > 0 {
+		result.Valid = false
+	}
+
+	return result, nil
+}
+
+// unobservedIngressPorts returns the ingress ports of a policy no flow used
+func unobservedIngressPorts(policy *flowCheckPolicy, flows []*hubble.ParsedFlow) []UnobservedPort {
+	namespace := policy.Metadata.Namespace
+	if namespace == "" && policy.Kind == "CiliumNetworkPolicy" {
+		namespace = "default"
+	}
+
+	// Flows reaching the endpoints the policy selects
+	var selected []*hubble.ParsedFlow
+	for _, flow := range flows {
+		if !flow.IsReply && policy.Spec.EndpointSelector.Selects(policymatch.DestEndpoint(flow), namespace) {
+			selected = append(selected, flow)
+		}
+	}
+
+	var unobserved []UnobservedPort
+	for i, rule := range policy.Spec.Ingress {
+		var ruleFlows []*hubble.ParsedFlow
+		for _, flow := range selected {
+			if ingressPeerMatches(rule.FromEndpoints, rule.FromEntities, rule.FromCIDR, flow, namespace) {
+				ruleFlows = append(ruleFlows, flow)
+			}
+		}
+
+		for _, portRule := range rule.ToPorts {
+			for _, port := range portRule.Ports {
+				observed := false
+				if start, err := strconv.Atoi(port.Port); err == nil {
+					if start == 0 {
+						// Port 0 allows all ports
+						continue
+					}
+					observed = portObserved(port, start, ruleFlows)
+				} else if hasPortNames(ruleFlows) {
+					observed = namedPortObserved(port, ruleFlows)
+				} else {
+					// Named ports cannot be matched without the flows'
+					// port names
+					continue
+				}
+				if !observed {
+					unobserved = append(unobserved, UnobservedPort{
+						Policy:    policy.Metadata.Name,
+						Namespace: policy.Metadata.Namespace,
+						Rule:      fmt.Sprintf("ingress[%d]", i),
+						Port:      formatFlowCheckPort(port),
+					})
+				}
+			}
+		}
+	}
+
+	return unobserved
+}
+
+// portObserved reports whether any flow used the port or port range
+func portObserved(port flowCheckPort, start int, flows []*hubble.ParsedFlow) bool {
+	end := start
+	if port.EndPort > start {
+		end = port.EndPort
+	}
+	protocol := strings.ToUpper(port.Protocol)
+
+	for _, flow := range flows {
+		if protocol != "" && protocol != "ANY" && protocol != strings.ToUpper(flow.Protocol) {
+			continue
+		}
+		if int(flow.DestPort) >= start && int(flow.DestPort) <= end {
+			return true
+		}
+	}
+	return false
+}
+
+// namedPortObserved reports whether any flow used the named port
+func namedPortObserved(port flowCheckPort, flows []*hubble.ParsedFlow) bool {
+	protocol := strings.ToUpper(port.Protocol)
+	for _, flow := range flows {
+		if protocol != "" && protocol != "ANY" && protocol != strings.ToUpper(flow.Protocol) {
+			continue
+		}
+		if flow.DestPortName == port.Port {
+			return true
+		}
+	}
+	return false
+}
+
+// hasPortNames reports whether any flow carries its destination port's name
+func hasPortNames(flows []*hubble.ParsedFlow) bool {
+	for _, flow := range flows {
+		if flow.DestPortName != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// ingressPeerMatches reports whether a flow's source is one of the peers of
+// an ingress rule. A rule without peers matches every source.
+func ingressPeerMatches(endpoints []policymatch.Selector, entities []string, cidrs []string, flow *hubble.ParsedFlow, policyNamespace string) bool {
+	if len(endpoints) == 0 && len(entities) == 0 && len(cidrs) == 0 {
+		return true
+	}
+	source := policymatch.SourceEndpoint(flow)
+	return policymatch.AnyMatches(endpoints, source, policyNamespace) ||
+		policymatch.EntitiesMatch(entities, source) ||
+		policymatch.CIDRsMatch(cidrs, source)
+}
+
+// formatFlowCheckPort renders a port as port[-endPort]/protocol
+func formatFlowCheckPort(port flowCheckPort) string {
+	value := port.Port
+	if port.EndPort > 0 {
+		value = fmt.Sprintf("%s-%d", port.Port, port.EndPort)
+	}
+	if port.Protocol == "" {
+		return value
+	}
+	return value + "/" + port.Protocol
+}
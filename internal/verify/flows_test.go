@@ -0,0 +1,238 @@
+package verify
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/prabhakaran-jm/cilium-policypilot/internal/hubble"
+)
+
+func TestVerifyPoliciesAgainstFlows(t *testing.T) {
+	const policy = `apiVersion: cilium.io/v2
+kind: CiliumNetworkPolicy
+metadata:
+  name: catalog-policy
+  namespace: shop
+spec:
+  endpointSelector:
+    matchLabels:
+      k8s:app: catalog
+  ingress:
+  - fromEndpoints:
+    - matchLabels:
+        k8s:app: frontend
+    toPorts:
+    - ports:
+      - port: "8080"
+        protocol: TCP
+      - port: "9090"
+        protocol: TCP
+  - fromEndpoints:
+    - matchLabels:
+        k8s:app: prometheus
+        k8s:io.kubernetes.pod.namespace: monitoring
+    toPorts:
+    - ports:
+      - port: "9100"
+        endPort: 9110
+        protocol: TCP
+  - fromEntities:
+    - host
+    toPorts:
+    - ports:
+      - port: "8081"
+        protocol: TCP
+`
+	flow := func(sourceApp, sourceNamespace string, destNamespace string, port uint16) *hubble.ParsedFlow {
+		return &hubble.ParsedFlow{
+			SourceLabels:    map[string]string{"k8s:app": sourceApp},
+			SourceNamespace: sourceNamespace,
+			DestLabels:      map[string]string{"k8s:app": "catalog"},
+			DestNamespace:   destNamespace,
+			DestPort:        port,
+			Protocol:        "TCP",
+		}
+	}
+
+	tests := []struct {
+		name     string
+		flows    []*hubble.ParsedFlow
+		expected []string
+	}{
+		{
+			name: "every port observed",
+			flows: []*hubble.ParsedFlow{
+				flow("frontend", "shop", "shop", 8080),
+				flow("frontend", "shop", "shop", 9090),
+				flow("prometheus", "monitoring", "shop", 9105),
+				{SourceEntity: "host", DestLabels: map[string]string{"k8s:app": "catalog"}, DestNamespace: "shop", DestPort: 8081, Protocol: "TCP"},
+			},
+		},
+		{
+			name: "unused port and range",
+			flows: []*hubble.ParsedFlow{
+				flow("frontend", "shop", "shop", 8080),
+				{SourceEntity: "host", DestLabels: map[string]string{"k8s:app": "catalog"}, DestNamespace: "shop", DestPort: 8081, Protocol: "TCP"},
+			},
+			expected: []string{"ingress[0] 9090/TCP", "ingress[1] 9100-9110/TCP"},
+		},
+		{
+			name: "traffic from other sources or namespaces does not count",
+			flows: []*hubble.ParsedFlow{
+				flow("frontend", "shop", "shop", 8080),
+				flow("checkout", "shop", "shop", 9090),
+				flow("frontend", "staging", "staging", 9090),
+				flow("prometheus", "shop", "shop", 9100),
+				flow("frontend", "shop", "shop", 8081),
+			},
+			expected: []string{"ingress[0] 9090/TCP", "ingress[1] 9100-9110/TCP", "ingress[2] 8081/TCP"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := VerifyPoliciesAgainstFlows(writePolicyFile(t, policy), tt.flows, Options{})
+			if err != nil {
+				t.Fatalf("VerifyPoliciesAgainstFlows() error = %v", err)
+			}
+			if !result.Valid {
+				t.Errorf("Expected unobserved ports to be warnings only, got errors %v", result.Policies[0].Errors)
+			}
+
+			var unobserved []string
+			for _, port := range result.UnobservedPorts {
+				unobserved = append(unobserved, port.Rule+" "+port.Port)
+			}
+			if !reflect.DeepEqual(unobserved, tt.expected) {
+				t.Errorf("UnobservedPorts = %v, want %v", unobserved, tt.expected)
+			}
+			if len(result.Warnings) != len(tt.expected) {
+				t.Errorf("Expected %d warnings, got %v", len(tt.expected), result.Warnings)
+			}
+		})
+	}
+}
+
+func TestIngressPeerMatchesWorldFamily(t *testing.T) {
+	ipv4 := &hubble.ParsedFlow{SourceIP: "203.0.113.10"}
+	ipv6 := &hubble.ParsedFlow{SourceIP: "2001:db8::1"}
+	pod := &hubble.ParsedFlow{SourceIP: "10.0.1.5", SourceNamespace: "shop"}
+
+	tests := []struct {
+		name     string
+		entity   string
+		flow     *hubble.ParsedFlow
+		expected bool
+	}{
+		{name: "world-ipv4", entity: "world-ipv4", flow: ipv4, expected: true},
+		{name: "world-ipv4 is not IPv6", entity: "world-ipv4", flow: ipv6, expected: false},
+		{name: "world-ipv6", entity: "world-ipv6", flow: ipv6, expected: true},
+		{name: "world-ipv4 is not a pod", entity: "world-ipv4", flow: pod, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ingressPeerMatches(nil, []string{tt.entity}, nil, tt.flow, "shop"); got != tt.expected {
+				t.Errorf("ingressPeerMatches() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestVerifyPoliciesAgainstFlowsNamedPorts(t *testing.T) {
+	const policy = `apiVersion: cilium.io/v2
+kind: CiliumNetworkPolicy
+metadata:
+  name: catalog-policy
+  namespace: shop
+spec:
+  endpointSelector:
+    matchLabels:
+      k8s:app: catalog
+  ingress:
+  - toPorts:
+    - ports:
+      - port: http
+        protocol: TCP
+`
+	flow := func(port uint16, name string) *hubble.ParsedFlow {
+		return &hubble.ParsedFlow{
+			SourceLabels:    map[string]string{"k8s:app": "frontend"},
+			SourceNamespace: "shop",
+			DestLabels:      map[string]string{"k8s:app": "catalog"},
+			DestNamespace:   "shop",
+			DestPort:        port,
+			DestPortName:    name,
+			Protocol:        "TCP",
+		}
+	}
+
+	tests := []struct {
+		name     string
+		flows    []*hubble.ParsedFlow
+		expected []string
+	}{
+		{
+			name:  "flows without port names cannot be checked",
+			flows: []*hubble.ParsedFlow{flow(8080, "")},
+		},
+		{
+			name:  "named port observed",
+			flows: []*hubble.ParsedFlow{flow(8080, "http")},
+		},
+		{
+			name:     "only other named ports observed",
+			flows:    []*hubble.ParsedFlow{flow(9090, "metrics")},
+			expected: []string{"ingress[0] http/TCP"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := VerifyPoliciesAgainstFlows(writePolicyFile(t, policy), tt.flows, Options{})
+			if err != nil {
+				t.Fatalf("VerifyPoliciesAgainstFlows() error = %v", err)
+			}
+
+			var unobserved []string
+			for _, port := range result.UnobservedPorts {
+				unobserved = append(unobserved, port.Rule+" "+port.Port)
+			}
+			if !reflect.DeepEqual(unobserved, tt.expected) {
+				t.Errorf("UnobservedPorts = %v, want %v", unobserved, tt.expected)
+			}
+		})
+	}
+}
+
+func TestVerifyPoliciesAgainstFlowsStrict(t *testing.T) {
+	const policy = `apiVersion: cilium.io/v2
+kind: CiliumNetworkPolicy
+metadata:
+  name: catalog-policy
+  namespace: shop
+spec:
+  endpointSelector:
+    matchLabels:
+      k8s:app: catalog
+  ingress:
+  - fromEndpoints:
+    - matchLabels:
+        k8s:app: frontend
+    toPorts:
+    - ports:
+      - port: "9090"
+        protocol: TCP
+`
+	result, err := VerifyPoliciesAgainstFlows(writePolicyFile(t, policy), nil, Options{Strict: true})
+	if err != nil {
+		t.Fatalf("VerifyPoliciesAgainstFlows() error = %v", err)
+	}
+	if result.Valid {
+		t.Errorf("Expected an unobserved port to fail strict verification")
+	}
+	want := "Document 1 (catalog-policy): ingress[0] allows 9090/TCP, which was not observed in the flows"
+	if !reflect.DeepEqual(result.Warnings, []string{want}) {
+		t.Errorf("Warnings = %q, want %q", result.Warnings, want)
+	}
+}
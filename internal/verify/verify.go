@@ -2,33 +2,103 @@ package verify
 
 import (
 	"fmt"
+	"net"
 	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 
+	"github.com/prabhakaran-jm/cilium-policypilot/internal/validate"
 	"gopkg.in/yaml.v3"
 )
 
 // VerificationResult contains the result of policy verification
 type VerificationResult struct {
-	Valid    bool
-	Errors   []string
-	Warnings []string
-	Policies []PolicyInfo
+	Valid    bool         `json:"valid"`
+	Errors   []string     `json:"errors,omitempty"`
+	Warnings []string     `json:"warnings,omitempty"`
+	Policies []PolicyInfo `json:"policies"`
+	// UnobservedPorts is only set by VerifyPoliciesAgainstFlows
+	UnobservedPorts []UnobservedPort `json:"unobservedPorts,omitempty"`
+	// Files is only set by VerifyPolicyDirectory
+	Files []FileResult `json:"files,omitempty"`
 }
 
 // PolicyInfo contains information about a verified policy
 type PolicyInfo struct {
-	Name      string
-	Namespace string
-	Kind      string
-	Valid     bool
-	Errors    []string
+	Name      string   `json:"name"`
+	Namespace string   `json:"namespace,omitempty"`
+	Kind      string   `json:"kind"`
+	Valid     bool     `json:"valid"`
+	Errors    []string `json:"errors,omitempty"`
+	Warnings  []string `json:"warnings,omitempty"`
+	// File is the policy's file, only set by VerifyPolicyDirectory
+	File string `json:"file,omitempty"`
 }
 
-// VerifyPolicies validates policy YAML files for correct syntax and structure.
-// Supports multi-document YAML files and validates each policy document.
-// Returns a VerificationResult with validation status and detailed error messages.
+// Severity classifies a verification finding
+type Severity int
+
+const (
+	// SeverityWarning marks findings that are valid Cilium but likely
+	// mistakes, such as overly broad selectors. They are reported as
+	// warnings unless Options.Strict is set.
+	SeverityWarning Severity = iota
+	// SeverityError marks findings that make a policy invalid
+	SeverityError
+)
+
+// Options controls optional verification checks
+type Options struct {
+	// APIVersions are the accepted policy apiVersions (default:
+	// DefaultAPIVersions). Other cilium.io versions are reported as
+	// warnings, anything else as errors.
+	APIVersions []string
+
+	// RequireNamespace flags CiliumNetworkPolicies without an explicit
+	// metadata.namespace as errors instead of letting them fall back to "default"
+	RequireNamespace bool
+
+	// Strict promotes SeverityWarning findings to errors, so any warning
+	// makes the result invalid
+	Strict bool
+
+	// Exclude lists glob patterns of files and directories
+	// VerifyPolicyDirectory skips, matched against the path relative to the
+	// directory and against the base name, e.g. "*-test.yaml" or
+	// "overlays/*"
+	Exclude []string
+}
+
+// DefaultAPIVersions are the policy apiVersions accepted without a warning
+var DefaultAPIVersions = []string{"cilium.io/v2", "cilium.io/v2alpha1"}
+
+// ciliumAPIVersionPattern matches cilium.io versions Kubernetes-style, e.g.
+// cilium.io/v3 or cilium.io/v2beta1
+var ciliumAPIVersionPattern = regexp.MustCompile(`^cilium\.io/v[1-9][0-9]*((alpha|beta)[1-9][0-9]*)?$`)
+
+// report records a finding on the policy according to its severity
+func (info *PolicyInfo) report(severity Severity, message string, opts Options) {
+	if severity == SeverityWarning && !opts.Strict {
+		info.Warnings = append(info.Warnings, message)
+		return
+	}
+	info.Valid = false
+	info.Errors = append(info.Errors, message)
+}
+
+// VerifyPolicies validates policy YAML files using default options.
 func VerifyPolicies(filePath string) (*VerificationResult, error) {
+	return VerifyPoliciesWithOptions(filePath, Options{})
+}
+
+// VerifyPoliciesWithOptions validates policy YAML files for correct syntax and structure.
+// Supports multi-document YAML files and validates each policy document,
+// then checks the documents against each other (see checkFileConsistency).
+// Returns a VerificationResult with validation status and detailed error messages.
+func VerifyPoliciesWithOptions(filePath string, opts Options) (*VerificationResult, error) {
 	result := &VerificationResult{
 		Valid:    true,
 		Errors:   make([]string, 0),
@@ -43,15 +113,16 @@ func VerifyPolicies(filePath string) (*VerificationResult, error) {
 	}
 
 	// Split multi-document YAML
-	documents := splitYAMLDocuments(string(data))
+	documents := validate.SplitYAMLDocuments(string(data))
 
 	// Verify each document
+	var filePolicies []*filePolicy
 	for i, doc := range documents {
 		if strings.TrimSpace(doc) == "" {
 			continue
 		}
 
-		policyInfo, err := verifyPolicyDocument(doc, i+1)
+		policyInfo, err := verifyPolicyDocument(doc, i+1, opts)
 		if err != nil {
 			result.Valid = false
 			result.Errors = append(result.Errors, fmt.Sprintf("Document %d: %v", i+1, err))
@@ -65,20 +136,53 @@ func VerifyPolicies(filePath string) (*VerificationResult, error) {
 		if !policyInfo.Valid {
 			result.Valid = false
 		}
+		for _, warning := range policyInfo.Warnings {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("Document %d (%s): %s", i+1, policyInfo.Name, warning))
+		}
 
 		result.Policies = append(result.Policies, *policyInfo)
+		if policy, err := parseFilePolicy(doc, i+1); err == nil {
+			filePolicies = append(filePolicies, policy)
+		}
 	}
+	checkFileConsistency(result, filePolicies)
 
 	if len(result.Policies) == 0 {
 		result.Valid = false
 		result.Errors = append(result.Errors, "no valid policies found in file")
 	}
 
+	if opts.Strict && len(result.Warnings) > 0 {
+		result.Valid = false
+	}
+
 	return result, nil
 }
 
+// checkAPIVersion reports an apiVersion outside opts.APIVersions: as a
+// warning if it looks like another cilium.io version, otherwise as an error
+func checkAPIVersion(info *PolicyInfo, apiVersion string, opts Options) {
+	allowed := opts.APIVersions
+	if len(allowed) == 0 {
+		allowed = DefaultAPIVersions
+	}
+	for _, version := range allowed {
+		if apiVersion == version {
+			return
+		}
+	}
+
+	expected := "'" + strings.Join(allowed, "', '") + "'"
+	if ciliumAPIVersionPattern.MatchString(apiVersion) {
+		info.report(SeverityWarning, fmt.Sprintf("unknown apiVersion '%s': expected %s; check that the cluster's Cilium CRDs serve it", apiVersion, expected), opts)
+		return
+	}
+	info.Valid = false
+	info.Errors = append(info.Errors, fmt.Sprintf("invalid apiVersion: expected %s, got '%s'", expected, apiVersion))
+}
+
 // verifyPolicyDocument validates a single policy document
-func verifyPolicyDocument(yamlDoc string, docNum int) (*PolicyInfo, error) {
+func verifyPolicyDocument(yamlDoc string, docNum int, opts Options) (*PolicyInfo, error) {
 	var policy map[string]interface{}
 
 	if err := yaml.Unmarshal([]byte(yamlDoc), &policy); err != nil {
@@ -92,10 +196,7 @@ func verifyPolicyDocument(yamlDoc string, docNum int) (*PolicyInfo, error) {
 
 	// Check required top-level fields
 	if apiVersion, ok := policy["apiVersion"].(string); ok {
-		if apiVersion != "cilium.io/v2" {
-			info.Valid = false
-			info.Errors = append(info.Errors, fmt.Sprintf("invalid apiVersion: expected 'cilium.io/v2', got '%s'", apiVersion))
-		}
+		checkAPIVersion(info, apiVersion, opts)
 	} else {
 		info.Valid = false
 		info.Errors = append(info.Errors, "missing required field: apiVersion")
@@ -103,9 +204,9 @@ func verifyPolicyDocument(yamlDoc string, docNum int) (*PolicyInfo, error) {
 
 	if kind, ok := policy["kind"].(string); ok {
 		info.Kind = kind
-		if kind != "CiliumNetworkPolicy" {
+		if kind != "CiliumNetworkPolicy" && kind != "CiliumClusterwideNetworkPolicy" {
 			info.Valid = false
-			info.Errors = append(info.Errors, fmt.Sprintf("invalid kind: expected 'CiliumNetworkPolicy', got '%s'", kind))
+			info.Errors = append(info.Errors, fmt.Sprintf("invalid kind: expected 'CiliumNetworkPolicy' or 'CiliumClusterwideNetworkPolicy', got '%s'", kind))
 		}
 	} else {
 		info.Valid = false
@@ -119,6 +220,9 @@ func verifyPolicyDocument(yamlDoc string, docNum int) (*PolicyInfo, error) {
 			if name == "" {
 				info.Valid = false
 				info.Errors = append(info.Errors, "metadata.name cannot be empty")
+			} else if err := validate.PolicyName(name); err != nil {
+				info.Valid = false
+				info.Errors = append(info.Errors, fmt.Sprintf("metadata.name: %v", err))
 			}
 		} else {
 			info.Valid = false
@@ -128,77 +232,394 @@ func verifyPolicyDocument(yamlDoc string, docNum int) (*PolicyInfo, error) {
 		if namespace, ok := metadata["namespace"].(string); ok {
 			info.Namespace = namespace
 		}
+
+		// Namespaced policies without a namespace land in "default"
+		if opts.RequireNamespace && info.Kind == "CiliumNetworkPolicy" && info.Namespace == "" {
+			info.Valid = false
+			info.Errors = append(info.Errors, "missing required field: metadata.namespace (policy would be applied to 'default')")
+		}
 	} else {
 		info.Valid = false
 		info.Errors = append(info.Errors, "missing required field: metadata")
 	}
 
-	// Check spec
-	if spec, ok := policy["spec"].(map[string]interface{}); ok {
-		// Check endpointSelector
-		if endpointSelector, ok := spec["endpointSelector"].(map[string]interface{}); ok {
-			if matchLabels, ok := endpointSelector["matchLabels"].(map[string]interface{}); ok {
-				if len(matchLabels) == 0 {
-					info.Valid = false
-					info.Errors = append(info.Errors, "endpointSelector.matchLabels cannot be empty")
-				}
+	// Check spec, and the list of rule blocks in specs; a policy needs at
+	// least one of them
+	spec, hasSpec := policy["spec"]
+	if hasSpec {
+		if specMap, ok := spec.(map[string]interface{}); ok {
+			verifySpec(info, specMap, "spec", opts)
+		} else {
+			info.Valid = false
+			info.Errors = append(info.Errors, "spec must be a map")
+		}
+	}
+	specs, hasSpecs := policy["specs"]
+	if hasSpecs {
+		specList, ok := specs.([]interface{})
+		if !ok || len(specList) == 0 {
+			info.Valid = false
+			info.Errors = append(info.Errors, "specs must be a non-empty list")
+		}
+		for i, spec := range specList {
+			field := fmt.Sprintf("specs[%d]", i)
+			if specMap, ok := spec.(map[string]interface{}); ok {
+				verifySpec(info, specMap, field, opts)
 			} else {
 				info.Valid = false
-				info.Errors = append(info.Errors, "missing required field: spec.endpointSelector.matchLabels")
+				info.Errors = append(info.Errors, field+" must be a map")
 			}
-		} else {
+		}
+	}
+	if !hasSpec && !hasSpecs {
+		info.Valid = false
+		info.Errors = append(info.Errors, "missing required field: spec (or specs)")
+	}
+
+	return info, nil
+}
+
+// verifySpec validates one rule block, the policy's spec or an element of
+// its specs, adding its findings to info. field names the block, e.g.
+// "specs[1]"; findings in specs elements are prefixed with it.
+func verifySpec(info *PolicyInfo, spec map[string]interface{}, field string, opts Options) {
+	prefix := ""
+	if field != "spec" {
+		prefix = field + ": "
+	}
+	addError := func(message string) {
+		info.Valid = false
+		info.Errors = append(info.Errors, prefix+message)
+	}
+	addWarning := func(message string) {
+		info.report(SeverityWarning, prefix+message, opts)
+	}
+
+	// Check endpointSelector
+	if endpointSelector, ok := spec["endpointSelector"].(map[string]interface{}); ok {
+		matchLabels, hasLabels := endpointSelector["matchLabels"].(map[string]interface{})
+		matchExpressions, hasExpressions := endpointSelector["matchExpressions"]
+		switch {
+		case hasExpressions:
+			// Expressions select endpoints on their own, so matchLabels
+			// may be empty or absent
+			if err := validateMatchExpressions(matchExpressions, "endpointSelector"); err != nil {
+				addError(err.Error())
+			} else if len(matchLabels) > 0 {
+				if err := validateMatchLabels(matchLabels, "endpointSelector"); err != nil {
+					addError(err.Error())
+				}
+			}
+		case hasLabels:
+			if err := validateMatchLabels(matchLabels, "endpointSelector"); err != nil {
+				addError(err.Error())
+			} else if warning := broadEndpointSelectorWarning(matchLabels, info.Kind); warning != "" {
+				addWarning(warning)
+			}
+		default:
 			info.Valid = false
-			info.Errors = append(info.Errors, "missing required field: spec.endpointSelector")
+			info.Errors = append(info.Errors, fmt.Sprintf("missing required field: %s.endpointSelector.matchLabels", field))
+		}
+	} else {
+		info.Valid = false
+		info.Errors = append(info.Errors, fmt.Sprintf("missing required field: %s.endpointSelector", field))
+	}
+
+	// Validate ingress rules if present
+	if ingress, ok := spec["ingress"].([]interface{}); ok {
+		for i, rule := range ingress {
+			warnings, err := validateIngressRule(rule, i)
+			if err != nil {
+				addError(fmt.Sprintf("ingress[%d]: %v", i, err))
+			}
+			for _, warning := range warnings {
+				addWarning(fmt.Sprintf("ingress[%d]: %s", i, warning))
+			}
+		}
+	}
+
+	// Validate egress rules if present
+	if egress, ok := spec["egress"].([]interface{}); ok {
+		for i, rule := range egress {
+			warnings, err := validateEgressRule(rule, i)
+			if err != nil {
+				addError(fmt.Sprintf("egress[%d]: %v", i, err))
+			}
+			for _, warning := range warnings {
+				addWarning(fmt.Sprintf("egress[%d]: %s", i, warning))
+			}
+		}
+	}
+
+	for _, warning := range ruleSelectorWarnings(spec, info.Namespace) {
+		addWarning(warning)
+	}
+	if warning := fqdnDNSWarning(spec); warning != "" {
+		addWarning(warning)
+	}
+
+	// Optional fields Cilium accepts on every rule block
+	if err := validateOptionalSpecFields(spec); err != nil {
+		addError(err.Error())
+	}
+}
+
+// validateOptionalSpecFields checks the optional rule block fields other
+// than rules: description is a string, labels a list of {key, value,
+// source} and enableDefaultDeny a map of ingress/egress booleans
+func validateOptionalSpecFields(spec map[string]interface{}) error {
+	if description, exists := spec["description"]; exists {
+		if _, ok := description.(string); !ok {
+			return fmt.Errorf("description must be a string")
 		}
+	}
 
-		// Validate ingress rules if present
-		if ingress, ok := spec["ingress"].([]interface{}); ok {
-			for i, rule := range ingress {
-				if err := validateIngressRule(rule, i); err != nil {
-					info.Valid = false
-					info.Errors = append(info.Errors, fmt.Sprintf("ingress[%d]: %v", i, err))
+	if labels, exists := spec["labels"]; exists {
+		labelList, ok := labels.([]interface{})
+		if !ok {
+			return fmt.Errorf("labels must be a list")
+		}
+		for i, label := range labelList {
+			labelMap, ok := label.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("labels[%d] must be a map", i)
+			}
+			if key, _ := labelMap["key"].(string); key == "" {
+				return fmt.Errorf("labels[%d] missing required field: key", i)
+			}
+			for _, name := range []string{"value", "source"} {
+				if value, exists := labelMap[name]; exists {
+					if _, ok := value.(string); !ok {
+						return fmt.Errorf("labels[%d].%s must be a string", i, name)
+					}
 				}
 			}
 		}
+	}
 
-		// Validate egress rules if present
-		if egress, ok := spec["egress"].([]interface{}); ok {
-			for i, rule := range egress {
-				if err := validateEgressRule(rule, i); err != nil {
-					info.Valid = false
-					info.Errors = append(info.Errors, fmt.Sprintf("egress[%d]: %v", i, err))
+	if defaultDeny, exists := spec["enableDefaultDeny"]; exists {
+		defaultDenyMap, ok := defaultDeny.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("enableDefaultDeny must be a map")
+		}
+		directions := make([]string, 0, len(defaultDenyMap))
+		for direction := range defaultDenyMap {
+			directions = append(directions, direction)
+		}
+		sort.Strings(directions)
+		for _, direction := range directions {
+			if direction != "ingress" && direction != "egress" {
+				return fmt.Errorf("enableDefaultDeny: unknown field '%s', expected 'ingress' or 'egress'", direction)
+			}
+			if _, ok := defaultDenyMap[direction].(bool); !ok {
+				return fmt.Errorf("enableDefaultDeny.%s must be a boolean", direction)
+			}
+		}
+	}
+
+	return nil
+}
+
+// ruleSelectorWarnings flags rules whose peer selector is the policy's own
+// endpointSelector (a pod allowing itself), and rules repeating another
+// rule's peer selectors, which should have been merged. Rules with icmps
+// are only compared with each other, since Cilium rejects icmps next to
+// toPorts.
+func ruleSelectorWarnings(spec map[string]interface{}, namespace string) []string {
+	var warnings []string
+	self := normalizeSelector(spec["endpointSelector"], namespace)
+
+	for _, section := range []struct{ direction, peers string }{
+		{"ingress", "fromEndpoints"},
+		{"egress", "toEndpoints"},
+	} {
+		rules, _ := spec[section.direction].([]interface{})
+		seen := make(map[int]interface{})
+		for i, rule := range rules {
+			ruleMap, ok := rule.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			selectors, ok := ruleMap[section.peers].([]interface{})
+			if !ok || len(selectors) == 0 {
+				continue
+			}
+
+			normalized := make([]interface{}, 0, len(selectors))
+			for j, selector := range selectors {
+				selector = normalizeSelector(selector, namespace)
+				if self != nil && reflect.DeepEqual(selector, self) {
+					warnings = append(warnings, fmt.Sprintf("%s[%d]: %s[%d] equals the policy's endpointSelector, so the endpoints only allow themselves", section.direction, i, section.peers, j))
+				}
+				normalized = append(normalized, selector)
+			}
+
+			_, hasICMPs := ruleMap["icmps"]
+			for k := 0; k < i; k++ {
+				other, ok := seen[k]
+				if !ok || !reflect.DeepEqual(other, normalized) {
+					continue
+				}
+				if _, otherICMPs := rules[k].(map[string]interface{})["icmps"]; otherICMPs != hasICMPs {
+					continue
 				}
+				warnings = append(warnings, fmt.Sprintf("%s[%d]: %s is identical to %s[%d]; the rules should be merged", section.direction, i, section.peers, section.direction, k))
+				break
 			}
+			seen[i] = normalized
 		}
-	} else {
-		info.Valid = false
-		info.Errors = append(info.Errors, "missing required field: spec")
 	}
+	return warnings
+}
 
-	return info, nil
+// fqdnDNSWarning flags a policy with toFQDNs but no egress rule allowing
+// DNS to kube-dns on port 53 with rules.dns. Cilium learns the IPs behind a
+// name from the DNS responses its proxy sees, so without that rule the names
+// never resolve and the toFQDNs rules allow nothing.
+func fqdnDNSWarning(spec map[string]interface{}) string {
+	egress, _ := spec["egress"].([]interface{})
+	fqdnRule := -1
+	for i, rule := range egress {
+		ruleMap, ok := rule.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if isDNSEgressRule(ruleMap) {
+			return ""
+		}
+		if toFQDNs, ok := ruleMap["toFQDNs"].([]interface{}); ok && len(toFQDNs) > 0 && fqdnRule < 0 {
+			fqdnRule = i
+		}
+	}
+	if fqdnRule < 0 {
+		return ""
+	}
+	return fmt.Sprintf("egress[%d]: toFQDNs has no effect without an egress rule allowing DNS to kube-dns on port 53 with rules.dns", fqdnRule)
+}
+
+// isDNSEgressRule reports whether an egress rule allows port 53 over UDP to
+// kube-dns, an endpoint labelled k8s-app=kube-dns or any endpoint in
+// kube-system, with rules.dns sending the queries through Cilium's DNS proxy
+func isDNSEgressRule(rule map[string]interface{}) bool {
+	toPorts, _ := rule["toPorts"].([]interface{})
+	allowsDNS := false
+	for _, portRule := range toPorts {
+		portRuleMap, _ := portRule.(map[string]interface{})
+		rules, _ := portRuleMap["rules"].(map[string]interface{})
+		if dns, _ := rules["dns"].([]interface{}); len(dns) == 0 {
+			continue
+		}
+		ports, _ := portRuleMap["ports"].([]interface{})
+		for _, port := range ports {
+			portMap, _ := port.(map[string]interface{})
+			protocol, _ := portMap["protocol"].(string)
+			if portMap["port"] == "53" && strings.EqualFold(protocol, "UDP") {
+				allowsDNS = true
+			}
+		}
+	}
+	if !allowsDNS {
+		return false
+	}
+
+	toEndpoints, _ := rule["toEndpoints"].([]interface{})
+	for _, selector := range toEndpoints {
+		selectorMap, _ := selector.(map[string]interface{})
+		matchLabels, _ := selectorMap["matchLabels"].(map[string]interface{})
+		for key, value := range matchLabels {
+			key = strings.TrimPrefix(key, "k8s:")
+			if (key == "k8s-app" && value == "kube-dns") || (key == "io.kubernetes.pod.namespace" && value == "kube-system") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// normalizeSelector returns a selector's matchLabels and matchExpressions
+// with a namespace label naming the policy's own namespace removed, since
+// Cilium implies it for fromEndpoints and toEndpoints. It returns nil for
+// anything that is not a selector.
+func normalizeSelector(selector interface{}, namespace string) interface{} {
+	selectorMap, ok := selector.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	labels := make(map[string]interface{})
+	if matchLabels, ok := selectorMap["matchLabels"].(map[string]interface{}); ok {
+		for key, value := range matchLabels {
+			if key == ciliumNamespaceLabel && value == namespace {
+				continue
+			}
+			labels[key] = value
+		}
+	}
+	return map[string]interface{}{
+		"matchLabels":      labels,
+		"matchExpressions": selectorMap["matchExpressions"],
+	}
 }
 
-// validateIngressRule validates an ingress rule
-func validateIngressRule(rule interface{}, index int) error {
+// Peer fields of ingress and egress rules. A rule without any of them
+// applies to traffic from or to anywhere.
+var (
+	ingressPeerFields = []string{"fromEndpoints", "fromCIDR", "fromEntities", "fromCIDRSet", "fromGroups", "fromNodes"}
+	egressPeerFields  = []string{"toEndpoints", "toCIDR", "toEntities", "toCIDRSet", "toFQDNs", "toServices", "toGroups", "toNodes"}
+)
+
+// peerlessWarning flags a rule that restricts ports or ICMP types but sets
+// none of peerFields, so it allows that traffic from or to anywhere, world
+// included: usually a selector was forgotten
+func peerlessWarning(ruleMap map[string]interface{}, peerFields []string, anywhere string) string {
+	for _, field := range peerFields {
+		if peers, ok := ruleMap[field].([]interface{}); ok && len(peers) > 0 {
+			return ""
+		}
+	}
+	for _, field := range []string{"toPorts", "icmps"} {
+		if traffic, ok := ruleMap[field].([]interface{}); ok && len(traffic) > 0 {
+			return fmt.Sprintf("%s has no %s or other peer, so it allows this traffic %s", field, strings.Join(peerFields[:3], ", "), anywhere)
+		}
+	}
+	return ""
+}
+
+// validateIngressRule validates an ingress rule. It returns warnings for
+// valid but overly broad constructs.
+func validateIngressRule(rule interface{}, index int) ([]string, error) {
+	var warnings []string
 	ruleMap, ok := rule.(map[string]interface{})
 	if !ok {
-		return fmt.Errorf("ingress rule must be a map")
+		return nil, fmt.Errorf("ingress rule must be a map")
+	}
+	if warning := peerlessWarning(ruleMap, ingressPeerFields, "from anywhere"); warning != "" {
+		warnings = append(warnings, warning)
 	}
 
 	// Check fromEndpoints if present
 	if fromEndpoints, ok := ruleMap["fromEndpoints"].([]interface{}); ok {
 		for i, ep := range fromEndpoints {
-			if epMap, ok := ep.(map[string]interface{}); ok {
-				if matchLabels, ok := epMap["matchLabels"].(map[string]interface{}); ok {
-					if len(matchLabels) == 0 {
-						return fmt.Errorf("fromEndpoints[%d].matchLabels cannot be empty", i)
-					}
-				} else {
-					return fmt.Errorf("fromEndpoints[%d] missing matchLabels", i)
-				}
-			} else {
-				return fmt.Errorf("fromEndpoints[%d] must be a map", i)
+			broad, err := validateEndpointSelector(ep, fmt.Sprintf("fromEndpoints[%d]", i))
+			if err != nil {
+				return nil, err
 			}
+			if broad {
+				warnings = append(warnings, fmt.Sprintf("fromEndpoints[%d] is empty and allows traffic from every endpoint", i))
+			}
+		}
+	}
+
+	// Check fromEntities if present
+	if fromEntities, ok := ruleMap["fromEntities"].([]interface{}); ok {
+		if err := validateEntities(fromEntities, "fromEntities"); err != nil {
+			return nil, err
+		}
+	}
+
+	// Check fromCIDR if present
+	if fromCIDR, ok := ruleMap["fromCIDR"].([]interface{}); ok {
+		if err := validateCIDRs(fromCIDR, "fromCIDR"); err != nil {
+			return nil, err
 		}
 	}
 
@@ -206,35 +627,75 @@ func validateIngressRule(rule interface{}, index int) error {
 	if toPorts, ok := ruleMap["toPorts"].([]interface{}); ok {
 		for i, portRule := range toPorts {
 			if err := validatePortRule(portRule, i); err != nil {
-				return fmt.Errorf("toPorts[%d]: %w", i, err)
+				return nil, fmt.Errorf("toPorts[%d]: %w", i, err)
 			}
 		}
 	}
 
-	return nil
+	// Check icmps if present; Cilium rejects them alongside toPorts
+	if icmps, ok := ruleMap["icmps"].([]interface{}); ok {
+		if _, hasPorts := ruleMap["toPorts"]; hasPorts {
+			return nil, fmt.Errorf("icmps cannot be combined with toPorts in the same rule")
+		}
+		if err := validateICMPRules(icmps); err != nil {
+			return nil, err
+		}
+	}
+
+	return warnings, nil
 }
 
-// validateEgressRule validates an egress rule
-func validateEgressRule(rule interface{}, index int) error {
+// validateEgressRule validates an egress rule. It returns warnings for valid
+// but overly broad constructs.
+func validateEgressRule(rule interface{}, index int) ([]string, error) {
+	var warnings []string
 	ruleMap, ok := rule.(map[string]interface{})
 	if !ok {
-		return fmt.Errorf("egress rule must be a map")
+		return nil, fmt.Errorf("egress rule must be a map")
+	}
+	if warning := peerlessWarning(ruleMap, egressPeerFields, "to anywhere"); warning != "" {
+		warnings = append(warnings, warning)
 	}
 
 	// Check toEndpoints if present
 	if toEndpoints, ok := ruleMap["toEndpoints"].([]interface{}); ok {
 		for i, ep := range toEndpoints {
-			if epMap, ok := ep.(map[string]interface{}); ok {
-				if matchLabels, ok := epMap["matchLabels"].(map[string]interface{}); ok {
-					if len(matchLabels) == 0 {
-						return fmt.Errorf("toEndpoints[%d].matchLabels cannot be empty", i)
-					}
-				} else {
-					return fmt.Errorf("toEndpoints[%d] missing matchLabels", i)
-				}
-			} else {
-				return fmt.Errorf("toEndpoints[%d] must be a map", i)
+			broad, err := validateEndpointSelector(ep, fmt.Sprintf("toEndpoints[%d]", i))
+			if err != nil {
+				return nil, err
 			}
+			if broad {
+				warnings = append(warnings, fmt.Sprintf("toEndpoints[%d] is empty and allows traffic to every endpoint", i))
+			}
+		}
+	}
+
+	// Check toFQDNs if present
+	if toFQDNs, ok := ruleMap["toFQDNs"].([]interface{}); ok {
+		for i, fqdn := range toFQDNs {
+			fqdnMap, ok := fqdn.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("toFQDNs[%d] must be a map", i)
+			}
+			matchName, _ := fqdnMap["matchName"].(string)
+			matchPattern, _ := fqdnMap["matchPattern"].(string)
+			if matchName == "" && matchPattern == "" {
+				return nil, fmt.Errorf("toFQDNs[%d] must specify matchName or matchPattern", i)
+			}
+		}
+	}
+
+	// Check toEntities if present
+	if toEntities, ok := ruleMap["toEntities"].([]interface{}); ok {
+		if err := validateEntities(toEntities, "toEntities"); err != nil {
+			return nil, err
+		}
+	}
+
+	// Check toCIDR if present
+	if toCIDR, ok := ruleMap["toCIDR"].([]interface{}); ok {
+		if err := validateCIDRs(toCIDR, "toCIDR"); err != nil {
+			return nil, err
 		}
 	}
 
@@ -242,7 +703,216 @@ func validateEgressRule(rule interface{}, index int) error {
 	if toPorts, ok := ruleMap["toPorts"].([]interface{}); ok {
 		for i, portRule := range toPorts {
 			if err := validatePortRule(portRule, i); err != nil {
-				return fmt.Errorf("toPorts[%d]: %w", i, err)
+				return nil, fmt.Errorf("toPorts[%d]: %w", i, err)
+			}
+		}
+	}
+
+	// Check icmps if present; Cilium rejects them alongside toPorts
+	if icmps, ok := ruleMap["icmps"].([]interface{}); ok {
+		if _, hasPorts := ruleMap["toPorts"]; hasPorts {
+			return nil, fmt.Errorf("icmps cannot be combined with toPorts in the same rule")
+		}
+		if err := validateICMPRules(icmps); err != nil {
+			return nil, err
+		}
+	}
+
+	return warnings, nil
+}
+
+// validateEndpointSelector validates a fromEndpoints/toEndpoints entry. It
+// reports true for an empty selector, which Cilium accepts and matches every
+// endpoint.
+func validateEndpointSelector(selector interface{}, field string) (bool, error) {
+	selectorMap, ok := selector.(map[string]interface{})
+	if !ok {
+		if selector == nil {
+			return true, nil
+		}
+		return false, fmt.Errorf("%s must be a map", field)
+	}
+	if len(selectorMap) == 0 {
+		return true, nil
+	}
+
+	matchExpressions, hasExpressions := selectorMap["matchExpressions"]
+	if hasExpressions {
+		if err := validateMatchExpressions(matchExpressions, field); err != nil {
+			return false, err
+		}
+	}
+
+	matchLabels, ok := selectorMap["matchLabels"].(map[string]interface{})
+	if !ok {
+		if hasExpressions {
+			return false, nil
+		}
+		return false, fmt.Errorf("%s missing matchLabels", field)
+	}
+	if len(matchLabels) == 0 {
+		return !hasExpressions, nil
+	}
+	return false, validateMatchLabels(matchLabels, field)
+}
+
+// validateMatchExpressions validates a selector's matchExpressions. In and
+// NotIn need at least one value; Exists and DoesNotExist take none.
+func validateMatchExpressions(matchExpressions interface{}, field string) error {
+	expressions, ok := matchExpressions.([]interface{})
+	if !ok {
+		return fmt.Errorf("%s.matchExpressions must be a list", field)
+	}
+
+	for i, expression := range expressions {
+		exprField := fmt.Sprintf("%s.matchExpressions[%d]", field, i)
+		exprMap, ok := expression.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s must be a map", exprField)
+		}
+
+		key, _ := exprMap["key"].(string)
+		if key == "" {
+			return fmt.Errorf("%s missing key", exprField)
+		}
+		if err := validate.LabelKey(key); err != nil {
+			return fmt.Errorf("%s: %w", exprField, err)
+		}
+
+		var values []interface{}
+		if rawValues, exists := exprMap["values"]; exists && rawValues != nil {
+			if values, ok = rawValues.([]interface{}); !ok {
+				return fmt.Errorf("%s.values must be a list", exprField)
+			}
+		}
+
+		operator, _ := exprMap["operator"].(string)
+		switch operator {
+		case "In", "NotIn":
+			if len(values) == 0 {
+				return fmt.Errorf("%s: operator %s requires at least one value", exprField, operator)
+			}
+		case "Exists", "DoesNotExist":
+			if len(values) > 0 {
+				return fmt.Errorf("%s: operator %s does not take values", exprField, operator)
+			}
+		case "":
+			return fmt.Errorf("%s missing operator", exprField)
+		default:
+			return fmt.Errorf("%s has invalid operator '%s' (must be In, NotIn, Exists or DoesNotExist)", exprField, operator)
+		}
+
+		for j, value := range values {
+			str, ok := value.(string)
+			if !ok {
+				return fmt.Errorf("%s.values[%d] must be a string, got %v", exprField, j, value)
+			}
+			if err := validate.LabelValue(str); err != nil {
+				return fmt.Errorf("%s.values[%d]: %w", exprField, j, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// broadEndpointSelectorWarning returns a warning if an endpointSelector has
+// no workload labels, i.e. only namespace or reserved labels, and so applies
+// the policy to every pod in its namespace (or cluster)
+func broadEndpointSelectorWarning(matchLabels map[string]interface{}, kind string) string {
+	keys := make([]string, 0, len(matchLabels))
+	scopedToNamespace := false
+	for key := range matchLabels {
+		switch {
+		case key == ciliumNamespaceLabel:
+			scopedToNamespace = true
+		case strings.HasPrefix(key, ciliumNamespaceLabelsPrefix), strings.HasPrefix(key, "reserved:"):
+		default:
+			return ""
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	scope := "its namespace"
+	if kind == "CiliumClusterwideNetworkPolicy" && !scopedToNamespace {
+		scope = "the cluster"
+	}
+	return fmt.Sprintf("spec.endpointSelector has no workload labels (only %s) and selects every pod in %s", strings.Join(keys, ", "), scope)
+}
+
+// Labels Cilium derives from a pod's namespace
+const (
+	ciliumNamespaceLabel        = "k8s:io.kubernetes.pod.namespace"
+	ciliumNamespaceLabelsPrefix = "k8s:io.cilium.k8s.namespace.labels."
+)
+
+// validEntities lists the Cilium entities accepted in fromEntities/toEntities
+var validEntities = map[string]bool{
+	"all":            true,
+	"world":          true,
+	"world-ipv4":     true,
+	"world-ipv6":     true,
+	"cluster":        true,
+	"host":           true,
+	"remote-node":    true,
+	"kube-apiserver": true,
+	"health":         true,
+	"init":           true,
+	"ingress":        true,
+	"unmanaged":      true,
+}
+
+// validReservedLabels lists the names Cilium accepts after the "reserved:"
+// label source, e.g. reserved:host
+var validReservedLabels = map[string]bool{
+	"host":           true,
+	"remote-node":    true,
+	"world":          true,
+	"world-ipv4":     true,
+	"world-ipv6":     true,
+	"kube-apiserver": true,
+	"health":         true,
+	"init":           true,
+	"ingress":        true,
+	"unmanaged":      true,
+	"unknown":        true,
+}
+
+// validateMatchLabels validates a selector's matchLabels. Reserved labels
+// (reserved:host, ...) may be combined with regular labels; they carry no
+// value, so an empty or null value is accepted for any key.
+func validateMatchLabels(matchLabels map[string]interface{}, field string) error {
+	if len(matchLabels) == 0 {
+		return fmt.Errorf("%s.matchLabels cannot be empty", field)
+	}
+
+	// Check keys in order so the first error reported is stable
+	keys := make([]string, 0, len(matchLabels))
+	for key := range matchLabels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := matchLabels[key]
+		if key == "" {
+			return fmt.Errorf("%s.matchLabels has an empty key", field)
+		}
+		if value != nil {
+			if _, ok := value.(string); !ok {
+				return fmt.Errorf("%s.matchLabels[%s] must be a string, got %v", field, key, value)
+			}
+		}
+		if name, found := strings.CutPrefix(key, "reserved:"); found && !validReservedLabels[name] {
+			return fmt.Errorf("%s.matchLabels has unknown reserved label: %s", field, key)
+		}
+		if err := validate.LabelKey(key); err != nil {
+			return fmt.Errorf("%s.matchLabels: %w", field, err)
+		}
+		if value, _ := value.(string); value != "" {
+			if err := validate.LabelValue(value); err != nil {
+				return fmt.Errorf("%s.matchLabels[%s]: %w", field, key, err)
 			}
 		}
 	}
@@ -250,6 +920,65 @@ func validateEgressRule(rule interface{}, index int) error {
 	return nil
 }
 
+// validateEntities validates a fromEntities/toEntities list
+func validateEntities(entities []interface{}, field string) error {
+	for i, entity := range entities {
+		name, ok := entity.(string)
+		if !ok {
+			return fmt.Errorf("%s[%d] must be a string", field, i)
+		}
+		if !validEntities[name] {
+			return fmt.Errorf("%s[%d] invalid entity: %s", field, i, name)
+		}
+	}
+	return nil
+}
+
+// validateCIDRs validates a fromCIDR/toCIDR list
+func validateCIDRs(cidrs []interface{}, field string) error {
+	for i, cidr := range cidrs {
+		cidrStr, ok := cidr.(string)
+		if !ok {
+			return fmt.Errorf("%s[%d] must be a string", field, i)
+		}
+		if _, _, err := net.ParseCIDR(cidrStr); err != nil && net.ParseIP(cidrStr) == nil {
+			return fmt.Errorf("%s[%d] invalid CIDR: %s", field, i, cidrStr)
+		}
+	}
+	return nil
+}
+
+// validateICMPRules validates an icmps list
+func validateICMPRules(icmps []interface{}) error {
+	for i, icmpRule := range icmps {
+		icmpMap, ok := icmpRule.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("icmps[%d] must be a map", i)
+		}
+		fields, ok := icmpMap["fields"].([]interface{})
+		if !ok || len(fields) == 0 {
+			return fmt.Errorf("icmps[%d] missing required field: fields", i)
+		}
+		for j, field := range fields {
+			fieldMap, ok := field.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("icmps[%d].fields[%d] must be a map", i, j)
+			}
+			icmpType, ok := fieldMap["type"].(int)
+			if !ok {
+				return fmt.Errorf("icmps[%d].fields[%d] missing required field: type", i, j)
+			}
+			if icmpType < 0 || icmpType > 255 {
+				return fmt.Errorf("icmps[%d].fields[%d].type %d must be between 0 and 255", i, j, icmpType)
+			}
+			if family, exists := fieldMap["family"]; exists && family != "IPv4" && family != "IPv6" {
+				return fmt.Errorf("icmps[%d].fields[%d].family must be IPv4 or IPv6", i, j)
+			}
+		}
+	}
+	return nil
+}
+
 // validatePortRule validates a port rule
 func validatePortRule(portRule interface{}, index int) error {
 	portRuleMap, ok := portRule.(map[string]interface{})
@@ -273,13 +1002,28 @@ func validatePortRule(portRule interface{}, index int) error {
 		}
 
 		// Check port field
-		if portVal, ok := portMap["port"].(string); ok {
-			if portVal == "" {
-				return fmt.Errorf("ports[%d].port cannot be empty", i)
-			}
-		} else {
+		portVal, ok := portMap["port"].(string)
+		if !ok {
 			return fmt.Errorf("ports[%d] missing required field: port", i)
 		}
+		if portVal == "" {
+			return fmt.Errorf("ports[%d].port cannot be empty", i)
+		}
+
+		// Check endPort if present: a range needs a numeric start port
+		if endPortVal, exists := portMap["endPort"]; exists {
+			endPort, ok := endPortVal.(int)
+			if !ok {
+				return fmt.Errorf("ports[%d].endPort must be an integer", i)
+			}
+			port, err := strconv.Atoi(portVal)
+			if err != nil {
+				return fmt.Errorf("ports[%d].endPort requires a numeric port, got '%s'", i, portVal)
+			}
+			if endPort < port || endPort > 65535 {
+				return fmt.Errorf("ports[%d].endPort %d must be between port %d and 65535", i, endPort, port)
+			}
+		}
 
 		// Check protocol field
 		if protocol, ok := portMap["protocol"].(string); ok {
@@ -297,30 +1041,22 @@ func validatePortRule(portRule interface{}, index int) error {
 		}
 	}
 
-	return nil
-}
-
-// splitYAMLDocuments splits multi-document YAML into individual documents
-func splitYAMLDocuments(yamlContent string) []string {
-	documents := make([]string, 0)
-	currentDoc := strings.Builder{}
-
-	lines := strings.Split(yamlContent, "\n")
-	for _, line := range lines {
-		if strings.TrimSpace(line) == "---" {
-			if currentDoc.Len() > 0 {
-				documents = append(documents, currentDoc.String())
-				currentDoc.Reset()
+	// Check L7 HTTP rules if present
+	if rules, ok := portRuleMap["rules"].(map[string]interface{}); ok {
+		if httpRules, ok := rules["http"].([]interface{}); ok {
+			for i, httpRule := range httpRules {
+				httpMap, ok := httpRule.(map[string]interface{})
+				if !ok {
+					return fmt.Errorf("rules.http[%d] must be a map", i)
+				}
+				if path, ok := httpMap["path"].(string); ok {
+					if _, err := regexp.Compile(path); err != nil {
+						return fmt.Errorf("rules.http[%d].path is not a valid regex: %v", i, err)
+					}
+				}
 			}
-			continue
 		}
-		currentDoc.WriteString(line)
-		currentDoc.WriteString("\n")
-	}
-
-	if currentDoc.Len() > 0 {
-		documents = append(documents, currentDoc.String())
 	}
 
-	return documents
+	return nil
 }
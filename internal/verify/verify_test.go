@@ -0,0 +1,1332 @@
+package verify
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writePolicyFile writes content to a policy file in a temporary directory
+func writePolicyFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write policy file: %v", err)
+	}
+	return path
+}
+
+func TestVerifyPoliciesRequireNamespace(t *testing.T) {
+	const withNamespace = `apiVersion: cilium.io/v2
+kind: CiliumNetworkPolicy
+metadata:
+  name: catalog-policy
+  namespace: shop
+spec:
+  endpointSelector:
+    matchLabels:
+      k8s:app: catalog
+`
+	const withoutNamespace = `apiVersion: cilium.io/v2
+kind: CiliumNetworkPolicy
+metadata:
+  name: catalog-policy
+spec:
+  endpointSelector:
+    matchLabels:
+      k8s:app: catalog
+`
+	const clusterWide = `apiVersion: cilium.io/v2
+kind: CiliumClusterwideNetworkPolicy
+metadata:
+  name: shop-catalog-policy
+spec:
+  endpointSelector:
+    matchLabels:
+      k8s:app: catalog
+`
+
+	tests := []struct {
+		name     string
+		content  string
+		opts     Options
+		expected bool
+	}{
+		{
+			name:     "namespace present, strict",
+			content:  withNamespace,
+			opts:     Options{RequireNamespace: true},
+			expected: true,
+		},
+		{
+			name:     "namespace absent, strict",
+			content:  withoutNamespace,
+			opts:     Options{RequireNamespace: true},
+			expected: false,
+		},
+		{
+			name:     "namespace absent, default options",
+			content:  withoutNamespace,
+			opts:     Options{},
+			expected: true,
+		},
+		{
+			name:     "cluster-wide policy has no namespace, strict",
+			content:  clusterWide,
+			opts:     Options{RequireNamespace: true},
+			expected: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := VerifyPoliciesWithOptions(writePolicyFile(t, tt.content), tt.opts)
+			if err != nil {
+				t.Fatalf("VerifyPoliciesWithOptions() error = %v", err)
+			}
+			if result.Valid != tt.expected {
+				t.Errorf("Valid = %v, want %v (errors: %v)", result.Valid, tt.expected, result.Policies[0].Errors)
+			}
+		})
+	}
+}
+
+func TestVerifyPoliciesAPIVersion(t *testing.T) {
+	const policyTemplate = `apiVersion: %s
+kind: CiliumClusterwideNetworkPolicy
+metadata:
+  name: shop-catalog-policy
+spec:
+  endpointSelector:
+    matchLabels:
+      k8s:app: catalog
+`
+
+	tests := []struct {
+		name        string
+		apiVersion  string
+		opts        Options
+		expected    bool
+		wantWarning bool
+	}{
+		{name: "cilium.io/v2", apiVersion: "cilium.io/v2", expected: true},
+		{name: "cilium.io/v2alpha1", apiVersion: "cilium.io/v2alpha1", expected: true},
+		{name: "unknown cilium.io version warns", apiVersion: "cilium.io/v3", expected: true, wantWarning: true},
+		{name: "unknown cilium.io beta version warns", apiVersion: "cilium.io/v2beta1", expected: true, wantWarning: true},
+		{name: "unknown cilium.io version, strict", apiVersion: "cilium.io/v3", opts: Options{Strict: true}, expected: false},
+		{name: "configured version", apiVersion: "cilium.io/v3", opts: Options{APIVersions: []string{"cilium.io/v3"}}, expected: true},
+		{name: "default version not configured warns", apiVersion: "cilium.io/v2", opts: Options{APIVersions: []string{"cilium.io/v3"}}, expected: true, wantWarning: true},
+		{name: "other group", apiVersion: "networking.k8s.io/v1", expected: false},
+		{name: "malformed cilium.io version", apiVersion: "cilium.io/latest", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := VerifyPoliciesWithOptions(writePolicyFile(t, fmt.Sprintf(policyTemplate, tt.apiVersion)), tt.opts)
+			if err != nil {
+				t.Fatalf("VerifyPoliciesWithOptions() error = %v", err)
+			}
+			if result.Valid != tt.expected {
+				t.Errorf("Valid = %v, want %v (errors: %v)", result.Valid, tt.expected, result.Policies[0].Errors)
+			}
+			if warned := len(result.Policies[0].Warnings) > 0; warned != tt.wantWarning {
+				t.Errorf("Warnings = %v, want warning %v", result.Policies[0].Warnings, tt.wantWarning)
+			}
+		})
+	}
+}
+
+func TestVerifyPoliciesCombinedSelectors(t *testing.T) {
+	const policyTemplate = `apiVersion: cilium.io/v2
+kind: CiliumNetworkPolicy
+metadata:
+  name: node-exporter-policy
+  namespace: monitoring
+spec:
+  endpointSelector:
+    matchLabels:
+%s
+  ingress:
+  - fromEndpoints:
+    - matchLabels:
+%s
+    toPorts:
+    - ports:
+      - port: "9100"
+        protocol: TCP
+`
+
+	tests := []struct {
+		name         string
+		selector     string
+		fromSelector string
+		expected     bool
+	}{
+		{
+			name:         "regular labels only",
+			selector:     `      k8s:app: node-exporter`,
+			fromSelector: `        k8s:app: prometheus`,
+			expected:     true,
+		},
+		{
+			name: "reserved and regular label in endpointSelector",
+			selector: `      reserved:host: ""
+      k8s:app: node-exporter`,
+			fromSelector: `        k8s:app: prometheus`,
+			expected:     true,
+		},
+		{
+			name:     "reserved and regular label in fromEndpoints",
+			selector: `      k8s:app: node-exporter`,
+			fromSelector: `        reserved:remote-node: ""
+        k8s:io.kubernetes.pod.namespace: monitoring`,
+			expected: true,
+		},
+		{
+			name: "reserved label with null value",
+			selector: `      reserved:host:
+      k8s:app: node-exporter`,
+			fromSelector: `        k8s:app: prometheus`,
+			expected:     true,
+		},
+		{
+			name: "unknown reserved label",
+			selector: `      reserved:bogus: ""
+      k8s:app: node-exporter`,
+			fromSelector: `        k8s:app: prometheus`,
+			expected:     false,
+		},
+		{
+			name:         "empty matchLabels",
+			selector:     `      {}`,
+			fromSelector: `        k8s:app: prometheus`,
+			expected:     false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := fmt.Sprintf(policyTemplate, tt.selector, tt.fromSelector)
+			result, err := VerifyPolicies(writePolicyFile(t, content))
+			if err != nil {
+				t.Fatalf("VerifyPolicies() error = %v", err)
+			}
+			if result.Valid != tt.expected {
+				t.Errorf("Valid = %v, want %v (errors: %v %v)", result.Valid, tt.expected, result.Errors, result.Policies[0].Errors)
+			}
+		})
+	}
+}
+
+func TestVerifyPoliciesEndPort(t *testing.T) {
+	const policyTemplate = `apiVersion: cilium.io/v2
+kind: CiliumNetworkPolicy
+metadata:
+  name: nodeport-policy
+  namespace: default
+spec:
+  endpointSelector:
+    matchLabels:
+      k8s:app: gateway
+  ingress:
+  - toPorts:
+    - ports:
+      - port: "%s"
+%s        protocol: TCP
+`
+
+	tests := []struct {
+		name     string
+		port     string
+		endPort  string
+		expected bool
+	}{
+		{name: "single port", port: "30000", expected: true},
+		{name: "range", port: "30000", endPort: "30100", expected: true},
+		{name: "range of one port", port: "30000", endPort: "30000", expected: true},
+		{name: "endPort below port", port: "30100", endPort: "30000", expected: false},
+		{name: "endPort above 65535", port: "30000", endPort: "70000", expected: false},
+		{name: "endPort with named port", port: "http", endPort: "8080", expected: false},
+		{name: "endPort not an integer", port: "30000", endPort: `"30100"`, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			endPort := ""
+			if tt.endPort != "" {
+				endPort = fmt.Sprintf("        endPort: %s\n", tt.endPort)
+			}
+			content := fmt.Sprintf(policyTemplate, tt.port, endPort)
+			result, err := VerifyPolicies(writePolicyFile(t, content))
+			if err != nil {
+				t.Fatalf("VerifyPolicies() error = %v", err)
+			}
+			if result.Valid != tt.expected {
+				t.Errorf("Valid = %v, want %v (errors: %v %v)", result.Valid, tt.expected, result.Errors, result.Policies[0].Errors)
+			}
+		})
+	}
+}
+
+func TestVerifyPoliciesProtocolCase(t *testing.T) {
+	const policyTemplate = `apiVersion: cilium.io/v2
+kind: CiliumNetworkPolicy
+metadata:
+  name: catalog-policy
+  namespace: default
+spec:
+  endpointSelector:
+    matchLabels:
+      k8s:app: catalog
+  ingress:
+  - fromEndpoints:
+    - matchLabels:
+        k8s:app: frontend
+    toPorts:
+    - ports:
+      - port: "8080"
+        protocol: %s
+`
+
+	tests := []struct {
+		protocol string
+		expected bool
+	}{
+		{protocol: "TCP", expected: true},
+		{protocol: "tcp", expected: true},
+		{protocol: "Udp", expected: true},
+		{protocol: "sctp", expected: true},
+		{protocol: "http", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.protocol, func(t *testing.T) {
+			result, err := VerifyPolicies(writePolicyFile(t, fmt.Sprintf(policyTemplate, tt.protocol)))
+			if err != nil {
+				t.Fatalf("VerifyPolicies() error = %v", err)
+			}
+			if result.Valid != tt.expected {
+				t.Errorf("Valid = %v, want %v (errors: %v %v)", result.Valid, tt.expected, result.Errors, result.Policies[0].Errors)
+			}
+		})
+	}
+}
+
+func TestVerifyPoliciesName(t *testing.T) {
+	const policyTemplate = `apiVersion: cilium.io/v2
+kind: CiliumNetworkPolicy
+metadata:
+  name: "%s"
+  namespace: default
+spec:
+  endpointSelector:
+    matchLabels:
+      k8s:app: catalog
+  ingress:
+  - fromEndpoints:
+    - matchLabels:
+        k8s:app: frontend
+`
+
+	tests := []struct {
+		name     string
+		policy   string
+		expected string
+	}{
+		{name: "valid", policy: "catalog-policy"},
+		{name: "63 characters", policy: strings.Repeat("a", 56) + "-policy"},
+		{name: "64 characters", policy: strings.Repeat("a", 57) + "-policy", expected: "64 characters, must be at most 63"},
+		{name: "uppercase", policy: "Catalog-policy", expected: "invalid character 'C' at position 0"},
+		{name: "underscore", policy: "catalog_policy", expected: "invalid character '_' at position 7"},
+		{name: "trailing hyphen", policy: "catalog-", expected: "must start and end with a lowercase alphanumeric"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := VerifyPolicies(writePolicyFile(t, fmt.Sprintf(policyTemplate, tt.policy)))
+			if err != nil {
+				t.Fatalf("VerifyPolicies() error = %v", err)
+			}
+			errors := result.Policies[0].Errors
+			if tt.expected == "" {
+				if !result.Valid {
+					t.Errorf("Expected a valid policy, got errors: %v", errors)
+				}
+				return
+			}
+			if result.Valid || len(errors) != 1 || !strings.HasPrefix(errors[0], "metadata.name: ") || !strings.Contains(errors[0], tt.expected) {
+				t.Errorf("Errors = %v, want one metadata.name error containing %q", errors, tt.expected)
+			}
+		})
+	}
+}
+
+func TestVerifyPoliciesEntities(t *testing.T) {
+	const policyTemplate = `apiVersion: cilium.io/v2
+kind: CiliumNetworkPolicy
+metadata:
+  name: operator-policy
+  namespace: ops
+spec:
+  endpointSelector:
+    matchLabels:
+      k8s:app: operator
+  egress:
+  - toEntities:
+    - %s
+    toPorts:
+    - ports:
+      - port: "443"
+        protocol: TCP
+`
+
+	tests := []struct {
+		entity   string
+		expected bool
+	}{
+		{entity: "kube-apiserver", expected: true},
+		{entity: "host", expected: true},
+		{entity: "remote-node", expected: true},
+		{entity: "world", expected: true},
+		{entity: "world-ipv4", expected: true},
+		{entity: "world-ipv6", expected: true},
+		{entity: "cluster", expected: true},
+		{entity: "apiserver", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.entity, func(t *testing.T) {
+			result, err := VerifyPolicies(writePolicyFile(t, fmt.Sprintf(policyTemplate, tt.entity)))
+			if err != nil {
+				t.Fatalf("VerifyPolicies() error = %v", err)
+			}
+			if result.Valid != tt.expected {
+				t.Errorf("Valid = %v, want %v (errors: %v %v)", result.Valid, tt.expected, result.Errors, result.Policies[0].Errors)
+			}
+		})
+	}
+}
+
+func TestVerifyPoliciesLabelSyntax(t *testing.T) {
+	const policyTemplate = `apiVersion: cilium.io/v2
+kind: CiliumNetworkPolicy
+metadata:
+  name: catalog-policy
+  namespace: shop
+spec:
+  endpointSelector:
+    matchLabels:
+      %s
+  ingress:
+  - fromEndpoints:
+    - matchLabels:
+        %s
+  egress:
+  - toEndpoints:
+    - matchLabels:
+        %s
+`
+
+	const valid = "k8s:app: catalog"
+	tests := []struct {
+		name     string
+		selector string
+		from     string
+		to       string
+		expected string
+	}{
+		{
+			name:     "valid labels",
+			selector: `k8s:app.kubernetes.io/name: catalog`,
+			from:     `k8s:io.kubernetes.pod.namespace: web`,
+			to:       `reserved:host: ""`,
+		},
+		{
+			name:     "space in endpointSelector value",
+			selector: `k8s:app: "front end"`,
+			from:     valid,
+			to:       valid,
+			expected: `endpointSelector.matchLabels[k8s:app]: invalid label value "front end"`,
+		},
+		{
+			name:     "invalid fromEndpoints key",
+			selector: valid,
+			from:     `"k8s:my app": frontend`,
+			to:       valid,
+			expected: `ingress[0]: fromEndpoints[0].matchLabels: invalid label key "k8s:my app"`,
+		},
+		{
+			name:     "invalid toEndpoints key prefix",
+			selector: valid,
+			from:     valid,
+			to:       `k8s:Example.com/app: database`,
+			expected: `egress[0]: toEndpoints[0].matchLabels: invalid label key "k8s:Example.com/app"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := fmt.Sprintf(policyTemplate, tt.selector, tt.from, tt.to)
+			result, err := VerifyPolicies(writePolicyFile(t, content))
+			if err != nil {
+				t.Fatalf("VerifyPolicies() error = %v", err)
+			}
+
+			if tt.expected == "" {
+				if !result.Valid {
+					t.Errorf("Expected valid policy, got errors: %v", result.Policies[0].Errors)
+				}
+				return
+			}
+			if result.Valid {
+				t.Fatalf("Expected invalid policy")
+			}
+			errs := strings.Join(result.Policies[0].Errors, "\n")
+			if !strings.Contains(errs, tt.expected) {
+				t.Errorf("Expected error containing %q, got:\n%s", tt.expected, errs)
+			}
+		})
+	}
+}
+
+func TestVerifyPoliciesMatchExpressions(t *testing.T) {
+	const policyTemplate = `apiVersion: cilium.io/v2
+kind: CiliumNetworkPolicy
+metadata:
+  name: catalog-policy
+  namespace: shop
+spec:
+  endpointSelector:
+%s
+  ingress:
+  - fromEndpoints:
+    - matchExpressions:
+%s
+`
+
+	const validSelector = `    matchLabels:
+      k8s:app: catalog`
+	const validExpression = `      - key: k8s:app
+        operator: Exists`
+	tests := []struct {
+		name       string
+		selector   string
+		expression string
+		expected   string
+	}{
+		{
+			name: "expressions only",
+			selector: `    matchExpressions:
+    - key: k8s:app
+      operator: In
+      values: [catalog, catalog-canary]`,
+			expression: `      - key: k8s:env
+        operator: NotIn
+        values: [test]
+      - key: k8s:io.kubernetes.pod.namespace
+        operator: DoesNotExist`,
+		},
+		{
+			name:       "invalid operator",
+			selector:   validSelector,
+			expression: "      - key: k8s:app\n        operator: Equals\n        values: [web]",
+			expected:   `ingress[0]: fromEndpoints[0].matchExpressions[0] has invalid operator 'Equals'`,
+		},
+		{
+			name:       "In without values",
+			selector:   validSelector,
+			expression: "      - key: k8s:app\n        operator: In",
+			expected:   `fromEndpoints[0].matchExpressions[0]: operator In requires at least one value`,
+		},
+		{
+			name:       "Exists with values",
+			selector:   validSelector,
+			expression: "      - key: k8s:app\n        operator: Exists\n        values: [web]",
+			expected:   `fromEndpoints[0].matchExpressions[0]: operator Exists does not take values`,
+		},
+		{
+			name: "invalid value in endpointSelector",
+			selector: `    matchExpressions:
+    - key: k8s:app
+      operator: In
+      values: ["cata log"]`,
+			expression: validExpression,
+			expected:   `endpointSelector.matchExpressions[0].values[0]: invalid label value "cata log"`,
+		},
+		{
+			name:       "missing key",
+			selector:   validSelector,
+			expression: "      - operator: Exists",
+			expected:   `fromEndpoints[0].matchExpressions[0] missing key`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := fmt.Sprintf(policyTemplate, tt.selector, tt.expression)
+			result, err := VerifyPolicies(writePolicyFile(t, content))
+			if err != nil {
+				t.Fatalf("VerifyPolicies() error = %v", err)
+			}
+
+			if tt.expected == "" {
+				if !result.Valid {
+					t.Errorf("Expected valid policy, got errors: %v", result.Policies[0].Errors)
+				}
+				if len(result.Warnings) > 0 {
+					t.Errorf("Expected no warnings, got %v", result.Warnings)
+				}
+				return
+			}
+			if result.Valid {
+				t.Fatalf("Expected invalid policy")
+			}
+			errs := strings.Join(result.Policies[0].Errors, "\n")
+			if !strings.Contains(errs, tt.expected) {
+				t.Errorf("Expected error containing %q, got:\n%s", tt.expected, errs)
+			}
+		})
+	}
+}
+
+func TestVerifyPoliciesICMP(t *testing.T) {
+	const policyTemplate = `apiVersion: cilium.io/v2
+kind: CiliumNetworkPolicy
+metadata:
+  name: catalog-policy
+  namespace: default
+spec:
+  endpointSelector:
+    matchLabels:
+      k8s:app: catalog
+  ingress:
+  - fromEndpoints:
+    - matchLabels:
+        k8s:app: probe
+%s`
+
+	tests := []struct {
+		name     string
+		rule     string
+		expected bool
+	}{
+		{
+			name: "echo request",
+			rule: `    icmps:
+    - fields:
+      - type: 8
+      - type: 128
+        family: IPv6
+`,
+			expected: true,
+		},
+		{
+			name: "type out of range",
+			rule: `    icmps:
+    - fields:
+      - type: 300
+`,
+			expected: false,
+		},
+		{
+			name: "unknown family",
+			rule: `    icmps:
+    - fields:
+      - type: 8
+        family: IPv5
+`,
+			expected: false,
+		},
+		{
+			name: "combined with toPorts",
+			rule: `    icmps:
+    - fields:
+      - type: 8
+    toPorts:
+    - ports:
+      - port: "8080"
+        protocol: TCP
+`,
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := VerifyPolicies(writePolicyFile(t, fmt.Sprintf(policyTemplate, tt.rule)))
+			if err != nil {
+				t.Fatalf("VerifyPolicies() error = %v", err)
+			}
+			if result.Valid != tt.expected {
+				t.Errorf("Valid = %v, want %v (errors: %v %v)", result.Valid, tt.expected, result.Errors, result.Policies[0].Errors)
+			}
+		})
+	}
+}
+
+func TestVerifyPoliciesBroadSelectors(t *testing.T) {
+	const policyTemplate = `apiVersion: cilium.io/v2
+kind: %s
+metadata:
+  name: broad-policy
+  namespace: default
+spec:
+  endpointSelector:
+    matchLabels:
+%s
+  ingress:
+  - fromEndpoints:
+%s
+`
+	const appSelector = "      k8s:app: catalog"
+	const appSource = `    - matchLabels:
+        k8s:app: frontend`
+
+	tests := []struct {
+		name     string
+		kind     string
+		selector string
+		sources  string
+		opts     Options
+		valid    bool
+		warnings []string
+	}{
+		{
+			name:     "workload selectors",
+			selector: appSelector,
+			sources:  appSource,
+			valid:    true,
+		},
+		{
+			name:     "namespace-only endpointSelector",
+			selector: "      k8s:io.kubernetes.pod.namespace: default",
+			sources:  appSource,
+			valid:    true,
+			warnings: []string{"Document 1 (broad-policy): spec.endpointSelector has no workload labels (only k8s:io.kubernetes.pod.namespace) and selects every pod in its namespace"},
+		},
+		{
+			name:     "reserved-only endpointSelector in a cluster-wide policy",
+			kind:     "CiliumClusterwideNetworkPolicy",
+			selector: "      reserved:world: \"\"",
+			sources:  appSource,
+			valid:    true,
+			warnings: []string{"Document 1 (broad-policy): spec.endpointSelector has no workload labels (only reserved:world) and selects every pod in the cluster"},
+		},
+		{
+			name:     "empty fromEndpoints entry",
+			selector: appSelector,
+			sources:  "    - {}",
+			valid:    true,
+			warnings: []string{"Document 1 (broad-policy): ingress[0]: fromEndpoints[0] is empty and allows traffic from every endpoint"},
+		},
+		{
+			name:     "empty fromEndpoints matchLabels",
+			selector: appSelector,
+			sources:  "    - matchLabels: {}",
+			valid:    true,
+			warnings: []string{"Document 1 (broad-policy): ingress[0]: fromEndpoints[0] is empty and allows traffic from every endpoint"},
+		},
+		{
+			name:     "strict promotes warnings to errors",
+			selector: appSelector,
+			sources:  "    - {}",
+			opts:     Options{Strict: true},
+			valid:    false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kind := tt.kind
+			if kind == "" {
+				kind = "CiliumNetworkPolicy"
+			}
+			content := fmt.Sprintf(policyTemplate, kind, tt.selector, tt.sources)
+			result, err := VerifyPoliciesWithOptions(writePolicyFile(t, content), tt.opts)
+			if err != nil {
+				t.Fatalf("VerifyPoliciesWithOptions() error = %v", err)
+			}
+			if result.Valid != tt.valid {
+				t.Errorf("Valid = %v, want %v (errors: %v)", result.Valid, tt.valid, result.Policies[0].Errors)
+			}
+			if !reflect.DeepEqual(result.Warnings, append([]string{}, tt.warnings...)) {
+				t.Errorf("Warnings = %q, want %q", result.Warnings, tt.warnings)
+			}
+		})
+	}
+}
+
+func TestVerifyPoliciesPeerlessRules(t *testing.T) {
+	const policyTemplate = `apiVersion: cilium.io/v2
+kind: CiliumNetworkPolicy
+metadata:
+  name: catalog-policy
+  namespace: default
+spec:
+  endpointSelector:
+    matchLabels:
+      k8s:app: catalog
+%s`
+	const ports = `    toPorts:
+    - ports:
+      - port: "8080"
+        protocol: TCP
+`
+
+	tests := []struct {
+		name     string
+		rules    string
+		opts     Options
+		valid    bool
+		warnings []string
+	}{
+		{
+			name:  "ingress ports from endpoints",
+			rules: "  ingress:\n  - fromEndpoints:\n    - matchLabels:\n        k8s:app: frontend\n" + ports,
+			valid: true,
+		},
+		{
+			name:  "ingress ports from a CIDR",
+			rules: "  ingress:\n  - fromCIDR:\n    - 203.0.113.0/24\n" + ports,
+			valid: true,
+		},
+		{
+			name: "egress ports to an FQDN",
+			rules: "  egress:\n  - toFQDNs:\n    - matchName: api.example.com\n" + ports +
+				"  - toEndpoints:\n    - matchLabels:\n        k8s:k8s-app: kube-dns\n    toPorts:\n    - ports:\n      - port: \"53\"\n        protocol: UDP\n      rules:\n        dns:\n        - matchPattern: \"*\"\n",
+			valid: true,
+		},
+		{
+			name:     "ingress ports without a peer",
+			rules:    "  ingress:\n  - fromEndpoints:\n    - matchLabels:\n        k8s:app: frontend\n" + ports + "  -" + ports[3:],
+			valid:    true,
+			warnings: []string{"Document 1 (catalog-policy): ingress[1]: toPorts has no fromEndpoints, fromCIDR, fromEntities or other peer, so it allows this traffic from anywhere"},
+		},
+		{
+			name:     "egress ICMP without a peer",
+			rules:    "  egress:\n  - icmps:\n    - fields:\n      - type: 8\n",
+			valid:    true,
+			warnings: []string{"Document 1 (catalog-policy): egress[0]: icmps has no toEndpoints, toCIDR, toEntities or other peer, so it allows this traffic to anywhere"},
+		},
+		{
+			name:  "strict promotes the warning to an error",
+			rules: "  ingress:\n  -" + ports[3:],
+			opts:  Options{Strict: true},
+			valid: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := fmt.Sprintf(policyTemplate, tt.rules)
+			result, err := VerifyPoliciesWithOptions(writePolicyFile(t, content), tt.opts)
+			if err != nil {
+				t.Fatalf("VerifyPoliciesWithOptions() error = %v", err)
+			}
+			if result.Valid != tt.valid {
+				t.Errorf("Valid = %v, want %v (errors: %v)", result.Valid, tt.valid, result.Policies[0].Errors)
+			}
+			if !tt.opts.Strict && !reflect.DeepEqual(result.Warnings, append([]string{}, tt.warnings...)) {
+				t.Errorf("Warnings = %q, want %q", result.Warnings, tt.warnings)
+			}
+		})
+	}
+}
+
+func TestVerifyPoliciesRuleSelectors(t *testing.T) {
+	const policyTemplate = `apiVersion: cilium.io/v2
+kind: CiliumNetworkPolicy
+metadata:
+  name: catalog-policy
+  namespace: shop
+spec:
+  endpointSelector:
+    matchLabels:
+      k8s:app: catalog
+%s`
+
+	tests := []struct {
+		name     string
+		rules    string
+		warnings []string
+	}{
+		{
+			name: "distinct sources",
+			rules: `  ingress:
+  - fromEndpoints:
+    - matchLabels:
+        k8s:app: frontend
+  - fromEndpoints:
+    - matchLabels:
+        k8s:app: checkout
+`,
+		},
+		{
+			name: "ingress from itself",
+			rules: `  ingress:
+  - fromEndpoints:
+    - matchLabels:
+        k8s:app: frontend
+    - matchLabels:
+        k8s:app: catalog
+        k8s:io.kubernetes.pod.namespace: shop
+`,
+			warnings: []string{"Document 1 (catalog-policy): ingress[0]: fromEndpoints[1] equals the policy's endpointSelector, so the endpoints only allow themselves"},
+		},
+		{
+			name: "same labels in another namespace",
+			rules: `  ingress:
+  - fromEndpoints:
+    - matchLabels:
+        k8s:app: catalog
+        k8s:io.kubernetes.pod.namespace: staging
+`,
+		},
+		{
+			name: "any namespace",
+			rules: `  ingress:
+  - fromEndpoints:
+    - matchLabels:
+        k8s:app: frontend
+      matchExpressions:
+      - key: k8s:io.kubernetes.pod.namespace
+        operator: Exists
+`,
+		},
+		{
+			name: "empty namespace label value",
+			rules: `  ingress:
+  - fromEndpoints:
+    - matchLabels:
+        k8s:app: frontend
+        k8s:io.kubernetes.pod.namespace: ""
+`,
+		},
+		{
+			name: "egress to itself",
+			rules: `  egress:
+  - toEndpoints:
+    - matchLabels:
+        k8s:app: catalog
+`,
+			warnings: []string{"Document 1 (catalog-policy): egress[0]: toEndpoints[0] equals the policy's endpointSelector, so the endpoints only allow themselves"},
+		},
+		{
+			name: "duplicate fromEndpoints",
+			rules: `  ingress:
+  - fromEndpoints:
+    - matchLabels:
+        k8s:app: frontend
+    toPorts:
+    - ports:
+      - port: "8080"
+        protocol: TCP
+  - fromEndpoints:
+    - matchLabels:
+        k8s:app: checkout
+  - fromEndpoints:
+    - matchLabels:
+        k8s:app: frontend
+    toPorts:
+    - ports:
+      - port: "9090"
+        protocol: TCP
+`,
+			warnings: []string{"Document 1 (catalog-policy): ingress[2]: fromEndpoints is identical to ingress[0]; the rules should be merged"},
+		},
+		{
+			name: "separate ICMP rule for the same source",
+			rules: `  ingress:
+  - fromEndpoints:
+    - matchLabels:
+        k8s:app: frontend
+    toPorts:
+    - ports:
+      - port: "8080"
+        protocol: TCP
+  - fromEndpoints:
+    - matchLabels:
+        k8s:app: frontend
+    icmps:
+    - fields:
+      - type: 8
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := VerifyPolicies(writePolicyFile(t, fmt.Sprintf(policyTemplate, tt.rules)))
+			if err != nil {
+				t.Fatalf("VerifyPolicies() error = %v", err)
+			}
+			if !result.Valid {
+				t.Errorf("Expected valid policy, got errors: %v", result.Errors)
+			}
+			if !reflect.DeepEqual(result.Warnings, append([]string{}, tt.warnings...)) {
+				t.Errorf("Warnings = %q, want %q", result.Warnings, tt.warnings)
+			}
+		})
+	}
+}
+
+func TestVerifyPoliciesFQDNWithoutDNS(t *testing.T) {
+	const policyTemplate = `apiVersion: cilium.io/v2
+kind: CiliumNetworkPolicy
+metadata:
+  name: catalog-policy
+  namespace: shop
+spec:
+  endpointSelector:
+    matchLabels:
+      k8s:app: catalog
+  egress:
+%s  - toFQDNs:
+    - matchName: api.github.com
+    toPorts:
+    - ports:
+      - port: "443"
+        protocol: TCP
+`
+
+	tests := []struct {
+		name     string
+		dnsRule  string
+		warnings []string
+	}{
+		{
+			name: "DNS to kube-dns",
+			dnsRule: `  - toEndpoints:
+    - matchLabels:
+        k8s:k8s-app: kube-dns
+    toPorts:
+    - ports:
+      - port: "53"
+        protocol: UDP
+      rules:
+        dns:
+        - matchPattern: "*"
+`,
+		},
+		{
+			name: "DNS to kube-system",
+			dnsRule: `  - toEndpoints:
+    - matchLabels:
+        k8s:io.kubernetes.pod.namespace: kube-system
+    toPorts:
+    - ports:
+      - port: "53"
+        protocol: udp
+      rules:
+        dns:
+        - matchPattern: "*"
+`,
+		},
+		{
+			name:     "no DNS rule",
+			warnings: []string{"Document 1 (catalog-policy): egress[0]: toFQDNs has no effect without an egress rule allowing DNS to kube-dns on port 53 with rules.dns"},
+		},
+		{
+			name: "port 53 over TCP only",
+			dnsRule: `  - toEndpoints:
+    - matchLabels:
+        k8s:k8s-app: kube-dns
+    toPorts:
+    - ports:
+      - port: "53"
+        protocol: TCP
+`,
+			warnings: []string{"Document 1 (catalog-policy): egress[1]: toFQDNs has no effect without an egress rule allowing DNS to kube-dns on port 53 with rules.dns"},
+		},
+		{
+			name: "port 53 without rules.dns",
+			dnsRule: `  - toEndpoints:
+    - matchLabels:
+        k8s:k8s-app: kube-dns
+    toPorts:
+    - ports:
+      - port: "53"
+        protocol: UDP
+`,
+			warnings: []string{"Document 1 (catalog-policy): egress[1]: toFQDNs has no effect without an egress rule allowing DNS to kube-dns on port 53 with rules.dns"},
+		},
+		{
+			name: "port 53 to another endpoint",
+			dnsRule: `  - toEndpoints:
+    - matchLabels:
+        k8s:app: resolver
+    toPorts:
+    - ports:
+      - port: "53"
+        protocol: UDP
+`,
+			warnings: []string{"Document 1 (catalog-policy): egress[1]: toFQDNs has no effect without an egress rule allowing DNS to kube-dns on port 53 with rules.dns"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := VerifyPolicies(writePolicyFile(t, fmt.Sprintf(policyTemplate, tt.dnsRule)))
+			if err != nil {
+				t.Fatalf("VerifyPolicies() error = %v", err)
+			}
+			if !result.Valid {
+				t.Errorf("Expected valid policy, got errors: %v", result.Errors)
+			}
+			if !reflect.DeepEqual(result.Warnings, append([]string{}, tt.warnings...)) {
+				t.Errorf("Warnings = %q, want %q", result.Warnings, tt.warnings)
+			}
+		})
+	}
+}
+
+func TestVerifyPoliciesEmptyRuleLists(t *testing.T) {
+	const content = `apiVersion: cilium.io/v2
+kind: CiliumNetworkPolicy
+metadata:
+  name: catalog-policy-default-deny
+  namespace: shop
+spec:
+  endpointSelector:
+    matchLabels:
+      k8s:app: catalog
+  ingress: []
+  egress: []
+`
+	result, err := VerifyPolicies(writePolicyFile(t, content))
+	if err != nil {
+		t.Fatalf("VerifyPolicies() error = %v", err)
+	}
+	if !result.Valid {
+		t.Errorf("Expected explicit empty ingress/egress to be valid, got errors: %v", result.Errors)
+	}
+	if len(result.Warnings) != 0 {
+		t.Errorf("Expected no warnings, got %v", result.Warnings)
+	}
+}
+
+func TestVerifyPoliciesStrict(t *testing.T) {
+	const broadPolicy = `apiVersion: cilium.io/v2
+kind: CiliumNetworkPolicy
+metadata:
+  name: namespace-policy
+  namespace: default
+spec:
+  endpointSelector:
+    matchLabels:
+      k8s:io.kubernetes.pod.namespace: default
+`
+
+	tests := []struct {
+		name     string
+		opts     Options
+		valid    bool
+		errors   int
+		warnings int
+	}{
+		{name: "warnings keep the result valid", opts: Options{}, valid: true, warnings: 1},
+		{name: "strict turns warnings into errors", opts: Options{Strict: true}, valid: false, errors: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := VerifyPoliciesWithOptions(writePolicyFile(t, broadPolicy), tt.opts)
+			if err != nil {
+				t.Fatalf("VerifyPoliciesWithOptions() error = %v", err)
+			}
+			if result.Valid != tt.valid {
+				t.Errorf("Valid = %v, want %v", result.Valid, tt.valid)
+			}
+			if len(result.Policies[0].Errors) != tt.errors {
+				t.Errorf("Expected %d policy errors, got %v", tt.errors, result.Policies[0].Errors)
+			}
+			if len(result.Warnings) != tt.warnings {
+				t.Errorf("Expected %d warnings, got %v", tt.warnings, result.Warnings)
+			}
+		})
+	}
+}
+
+func TestVerificationResultJSON(t *testing.T) {
+	const policies = `apiVersion: cilium.io/v2
+kind: CiliumNetworkPolicy
+metadata:
+  name: catalog-policy
+  namespace: shop
+spec:
+  endpointSelector:
+    matchLabels:
+      k8s:app: catalog
+---
+apiVersion: cilium.io/v2
+kind: CiliumNetworkPolicy
+metadata:
+  name: cart-policy
+  namespace: shop
+spec:
+  endpointSelector:
+    matchLabels:
+      k8s:app: cart
+  ingress:
+    - fromEntities:
+        - galaxy
+`
+
+	result, err := VerifyPolicies(writePolicyFile(t, policies))
+	if err != nil {
+		t.Fatalf("VerifyPolicies() error = %v", err)
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+
+	var decoded struct {
+		Valid    bool     `json:"valid"`
+		Errors   []string `json:"errors"`
+		Policies []struct {
+			Name      string   `json:"name"`
+			Namespace string   `json:"namespace"`
+			Kind      string   `json:"kind"`
+			Valid     bool     `json:"valid"`
+			Errors    []string `json:"errors"`
+		} `json:"policies"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+
+	if decoded.Valid {
+		t.Errorf("Expected valid = false in %s", data)
+	}
+	if len(decoded.Policies) != 2 {
+		t.Fatalf("Expected 2 policies in %s", data)
+	}
+	first, second := decoded.Policies[0], decoded.Policies[1]
+	if first.Name != "catalog-policy" || first.Namespace != "shop" || first.Kind != "CiliumNetworkPolicy" || !first.Valid {
+		t.Errorf("Unexpected first policy %+v", first)
+	}
+	if second.Name != "cart-policy" || second.Valid || len(second.Errors) != 1 || !strings.Contains(second.Errors[0], "galaxy") {
+		t.Errorf("Expected cart-policy to be invalid with an entity error, got %+v", second)
+	}
+}
+
+func TestVerifyPoliciesSpecs(t *testing.T) {
+	const header = `apiVersion: cilium.io/v2
+kind: CiliumNetworkPolicy
+metadata:
+  name: catalog-policy
+  namespace: shop
+`
+
+	tests := []struct {
+		name   string
+		spec   string
+		errors []string
+	}{
+		{
+			name: "optional fields on spec",
+			spec: `spec:
+  description: Catalog
+  labels:
+    - key: owner
+      value: team-catalog
+  enableDefaultDeny:
+    egress: false
+  endpointSelector:
+    matchLabels:
+      k8s:app: catalog
+`,
+		},
+		{
+			name: "spec and specs together",
+			spec: `spec:
+  endpointSelector:
+    matchLabels:
+      k8s:app: catalog
+specs:
+  - endpointSelector:
+      matchLabels:
+        k8s:app: cart
+`,
+		},
+		{
+			name: "specs element rules are validated",
+			spec: `specs:
+  - endpointSelector:
+      matchLabels:
+        k8s:app: catalog
+  - endpointSelector:
+      matchLabels:
+        k8s:app: cart
+    ingress:
+      - fromEntities:
+          - galaxy
+`,
+			errors: []string{"specs[1]: ingress[0]: fromEntities[0] invalid entity: galaxy"},
+		},
+		{
+			name: "specs element without endpointSelector",
+			spec: `specs:
+  - description: Catalog
+`,
+			errors: []string{"missing required field: specs[0].endpointSelector"},
+		},
+		{
+			name:   "empty specs",
+			spec:   "specs: []\n",
+			errors: []string{"specs must be a non-empty list"},
+		},
+		{
+			name:   "neither spec nor specs",
+			errors: []string{"missing required field: spec (or specs)"},
+		},
+		{
+			name: "invalid optional fields",
+			spec: `specs:
+  - endpointSelector:
+      matchLabels:
+        k8s:app: catalog
+    labels:
+      - value: team-catalog
+  - endpointSelector:
+      matchLabels:
+        k8s:app: cart
+    enableDefaultDeny:
+      ingress: "yes"
+`,
+			errors: []string{
+				"specs[0]: labels[0] missing required field: key",
+				"specs[1]: enableDefaultDeny.ingress must be a boolean",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := VerifyPolicies(writePolicyFile(t, header+tt.spec))
+			if err != nil {
+				t.Fatalf("VerifyPolicies() error = %v", err)
+			}
+			if result.Valid != (len(tt.errors) == 0) {
+				t.Errorf("Valid = %v, want %v", result.Valid, len(tt.errors) == 0)
+			}
+			if errors := result.Policies[0].Errors; !reflect.DeepEqual(errors, tt.errors) && (len(errors) > 0 || len(tt.errors) > 0) {
+				t.Errorf("Errors = %q, want %q", errors, tt.errors)
+			}
+		})
+	}
+
+	// The specs fixture uses every optional field and passes cleanly
+	result, err := VerifyPolicies(filepath.Join("testdata", "specs-policy.yaml"))
+	if err != nil {
+		t.Fatalf("VerifyPolicies() error = %v", err)
+	}
+	if !result.Valid || len(result.Warnings) > 0 {
+		t.Errorf("Expected the specs fixture to be valid without warnings, got errors %v, warnings %v", result.Policies[0].Errors, result.Warnings)
+	}
+}
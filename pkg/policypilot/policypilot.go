@@ -0,0 +1,120 @@
+// Package policypilot is the library entry point to PolicyPilot. It turns
+// Hubble flows into least-privilege CiliumNetworkPolicies in memory, without
+// reading or writing files, for programs that embed PolicyPilot instead of
+// running the cpp CLI. The types are aliases of the internal implementation,
+// so values can be passed between this package and the CLI's file formats.
+package policypilot
+
+import (
+	"fmt"
+
+	"github.com/prabhakaran-jm/cilium-policypilot/internal/hubble"
+	"github.com/prabhakaran-jm/cilium-policypilot/internal/synth"
+)
+
+// FlowCollection is a set of Hubble flows, as captured by `cpp learn`
+type FlowCollection = hubble.FlowCollection
+
+// Schema is the FlowCollection schema `cpp learn` writes
+const Schema = hubble.CurrentSchema
+
+// Flow is a single Hubble flow
+type Flow = hubble.Flow
+
+// Policy is a generated CiliumNetworkPolicy or CiliumClusterwideNetworkPolicy
+type Policy = synth.Policy
+
+// SuppressedRule is an ingress rule left out because it was observed fewer
+// than Options.MinFlows times
+type SuppressedRule = synth.SuppressedRule
+
+// Options controls policy synthesis; the zero value matches `cpp propose
+// --no-provenance`
+type Options = synth.Options
+
+// ProposedRule is an ingress rule offered to Options.ReviewRule
+type ProposedRule = synth.ProposedRule
+
+// Provenance sets the provenance labels and annotations of generated
+// policies (see Options.Provenance)
+type Provenance = synth.Provenance
+
+// OwnerReference identifies an object that owns the generated policies
+// (see Options.OwnerReferences)
+type OwnerReference = synth.OwnerReference
+
+// Stats summarizes a FromFlows run
+type Stats struct {
+	// Flows is the number of flows in the collection
+	Flows int
+	// ParsedFlows is the number of flows that could be parsed
+	ParsedFlows int
+	// UniqueFlows is the number of distinct flows after deduplication
+	UniqueFlows int
+	// IngressRules and EgressRules count the rules across all policies
+	IngressRules int
+	EgressRules  int
+}
+
+// Result holds the policies generated by FromFlows
+type Result struct {
+	// Policies are the generated policies, with policies selecting the same
+	// endpoints merged
+	Policies []*Policy
+	// Suppressed lists the rules dropped by Options.MinFlows
+	Suppressed []SuppressedRule
+	Stats      Stats
+}
+
+// FromFlows parses and deduplicates the flows in collection and synthesizes
+// policies from them. A collection without a Schema, e.g. one built in
+// code, is read as the current Schema. Reply flows Hubble did not mark as
+// such are detected as by `cpp propose` (see hubble.DetectReplies) and add
+// no rules.
+func FromFlows(collection *FlowCollection, opts Options) (*Result, error) {
+	if collection != nil && collection.Schema == "" {
+		withSchema := *collection
+		withSchema.Schema = Schema
+		collection = &withSchema
+	}
+	if err := hubble.ValidateSchema(collection); err != nil {
+		return nil, fmt.Errorf("invalid flow collection: %w", err)
+	}
+
+	parsed, err := hubble.ParseFlows(collection)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse flows: %w", err)
+	}
+	hubble.DetectReplies(parsed)
+	unique := hubble.DeduplicateFlows(parsed)
+	if len(unique) == 0 {
+		return nil, fmt.Errorf("no valid flows found to generate policies from")
+	}
+
+	policies, suppressed, err := synth.SynthesizePoliciesWithSuppressed(unique, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to synthesize policies: %w", err)
+	}
+
+	result := &Result{
+		Policies:   policies,
+		Suppressed: suppressed,
+		Stats: Stats{
+			Flows:       len(collection.Flows),
+			ParsedFlows: len(parsed),
+			UniqueFlows: len(unique),
+		},
+	}
+
+	for _, policy := range policies {
+		result.Stats.IngressRules += len(policy.Spec.Ingress)
+		result.Stats.EgressRules += len(policy.Spec.Egress)
+	}
+
+	return result, nil
+}
+
+// ToYAML renders a policy as a YAML manifest
+func ToYAML(policy *Policy) (string, error) {
+	return synth.PolicyToYAML(policy)
+}
@@ -0,0 +1,106 @@
+package policypilot
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prabhakaran-jm/cilium-policypilot/internal/hubble"
+)
+
+func newFlow(source, destination string, port uint16) *Flow {
+	return &Flow{
+		Source:      &hubble.Endpoint{Labels: []string{"k8s:app=" + source}, Namespace: "shop"},
+		Destination: &hubble.Endpoint{Labels: []string{"k8s:app=" + destination}, Namespace: "shop"},
+		L4:          &hubble.Layer4{TCP: &hubble.TCP{DestinationPort: port}},
+		Verdict:     "FORWARDED",
+	}
+}
+
+func TestFromFlows(t *testing.T) {
+	collection := &FlowCollection{
+		Schema: Schema,
+		Flows: []*Flow{
+			newFlow("frontend", "catalog", 8080),
+			newFlow("frontend", "catalog", 8080),
+			newFlow("catalog", "database", 5432),
+			{}, // no endpoints
+		},
+	}
+
+	result, err := FromFlows(collection, Options{})
+	if err != nil {
+		t.Fatalf("FromFlows() error = %v", err)
+	}
+
+	expected := Stats{Flows: 4, ParsedFlows: 4, UniqueFlows: 3, IngressRules: 2, EgressRules: 4}
+	if result.Stats != expected {
+		t.Errorf("Stats = %+v, want %+v", result.Stats, expected)
+	}
+	if len(result.Policies) != 2 {
+		t.Fatalf("Expected 2 policies, got %d", len(result.Policies))
+	}
+
+	yamlStr, err := ToYAML(result.Policies[0])
+	if err != nil {
+		t.Fatalf("ToYAML() error = %v", err)
+	}
+	if !strings.Contains(yamlStr, "kind: CiliumNetworkPolicy") || !strings.Contains(yamlStr, "name: catalog-policy") {
+		t.Errorf("Unexpected YAML:\n%s", yamlStr)
+	}
+}
+
+func TestFromFlowsWithoutSchema(t *testing.T) {
+	collection := &FlowCollection{Flows: []*Flow{newFlow("frontend", "catalog", 8080)}}
+
+	result, err := FromFlows(collection, Options{})
+	if err != nil {
+		t.Fatalf("FromFlows() error = %v", err)
+	}
+	if len(result.Policies) != 1 {
+		t.Errorf("Expected 1 policy, got %d", len(result.Policies))
+	}
+	if collection.Schema != "" {
+		t.Errorf("Expected the caller's collection to be left alone, got schema %q", collection.Schema)
+	}
+
+	// A schema that is set must still be one this version reads
+	collection.Schema = "cpp.flows.v99"
+	if _, err := FromFlows(collection, Options{}); err == nil {
+		t.Error("Expected an error for an unknown schema")
+	}
+}
+
+func TestFromFlowsOwnerReferences(t *testing.T) {
+	collection := &FlowCollection{Schema: Schema, Flows: []*Flow{newFlow("frontend", "catalog", 8080)}}
+	owner := OwnerReference{APIVersion: "v1", Kind: "Namespace", Name: "shop", UID: "4b6f"}
+
+	result, err := FromFlows(collection, Options{OwnerReferences: []OwnerReference{owner}})
+	if err != nil {
+		t.Fatalf("FromFlows() error = %v", err)
+	}
+	yamlStr, err := ToYAML(result.Policies[0])
+	if err != nil {
+		t.Fatalf("ToYAML() error = %v", err)
+	}
+	if !strings.Contains(yamlStr, "ownerReferences:") || !strings.Contains(yamlStr, "uid: 4b6f") {
+		t.Errorf("Expected the owner reference in the YAML:\n%s", yamlStr)
+	}
+}
+
+func TestFromFlowsErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		collection *FlowCollection
+	}{
+		{name: "nil collection"},
+		{name: "no flows", collection: &FlowCollection{Schema: Schema}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := FromFlows(tt.collection, Options{}); err == nil {
+				t.Error("Expected error")
+			}
+		})
+	}
+}